@@ -0,0 +1,89 @@
+//go:build !wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// --- Adaptive engine strength ---
+
+// With -adaptive, the two engines a person plays take their strength from
+// a ladder of presets, starting from the level the person's profile reached
+// in its last adaptive game. After every game the level moves up by
+// adaptiveStep times how far the person's score (1 for a win, 1/3 for a
+// draw) was above the profile's target win rate, and down when it was
+// below, so that it settles where the person wins about as often as they
+// asked for.
+
+// adaptivePresets are the engine strengths of the levels, from 1: the
+// weakest play the random personality's less than best moves on small
+// searches, and the rest search more and more.
+var adaptivePresets = []string{
+	"mcts:random@25",
+	"mcts:random@50",
+	"mcts:random@100",
+	"mcts@100",
+	"mcts@200",
+	"mcts@400",
+	"mcts@1000",
+	"mcts@2500",
+	"mcts@5000",
+	"mcts@10000",
+}
+
+const (
+	// adaptiveOpponents stands for the engines of adaptive games in the
+	// rating history.
+	adaptiveOpponents = "adaptive"
+	// DefaultAdaptiveTarget is the win rate adaptive engines aim to give
+	// when the profile sets none.
+	DefaultAdaptiveTarget = 0.5
+	adaptiveStartLevel    = 4
+	adaptiveStep          = 2
+)
+
+// AdaptivePreset returns the player type of the engines at level, which is
+// rounded to the nearest preset.
+func AdaptivePreset(level float64) string {
+	i := int(math.Round(level)) - 1
+	return adaptivePresets[max(0, min(i, len(adaptivePresets)-1))]
+}
+
+// AdaptiveLevel returns the level of the engines for the next adaptive game
+// of a profile with history.
+func AdaptiveLevel(history []RatingEntry) float64 {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Opponents == adaptiveOpponents {
+			return history[i].Level
+		}
+	}
+	return adaptiveStartLevel
+}
+
+// NextAdaptiveLevel returns the level after a game at level in which the
+// person scored score, aiming at target.
+func NextAdaptiveLevel(level, score, target float64) float64 {
+	level += adaptiveStep * (score - target)
+	return max(1, min(level, float64(len(adaptivePresets))))
+}
+
+// adaptiveSeats sets the engines of seats to the preset of level. They must
+// be plain engines, whose strength is the preset's to choose.
+func adaptiveSeats(seats *[3]SeatSpec, level float64) error {
+	preset, err := ParsePlayerType(AdaptivePreset(level))
+	if err != nil {
+		return err
+	}
+	for i := range seats {
+		switch s := seats[i]; {
+		case s.Kind == "human":
+		case s.Kind == "mcts" && s.Personality == nil && s.Iterations == 0:
+			seats[i] = preset
+		default:
+			return fmt.Errorf("-adaptive chooses the engines' strength: play plain mcts engines, e.g. -p2 mcts -p3 mcts")
+		}
+	}
+	return nil
+}
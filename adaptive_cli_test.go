@@ -0,0 +1,47 @@
+//go:build !wasm
+
+package main
+
+import "testing"
+
+func TestAdaptiveStrength(t *testing.T) {
+	for _, typ := range adaptivePresets {
+		if _, err := ParsePlayerType(typ); err != nil {
+			t.Errorf("Preset %s: %v", typ, err)
+		}
+	}
+	if AdaptivePreset(0.2) != adaptivePresets[0] || AdaptivePreset(4.4) != "mcts@100" || AdaptivePreset(99) != adaptivePresets[len(adaptivePresets)-1] {
+		t.Error("Expected levels to round to the nearest preset")
+	}
+
+	// Winning half the games at a target of one half keeps the level.
+	level := float64(adaptiveStartLevel)
+	for i := 0; i < 10; i++ {
+		level = NextAdaptiveLevel(level, float64(i%2), 0.5)
+	}
+	if level != adaptiveStartLevel {
+		t.Errorf("Expected an even record to keep level %d, got %v", adaptiveStartLevel, level)
+	}
+	if up, down := NextAdaptiveLevel(5, 1, 0.5), NextAdaptiveLevel(5, 0, 0.5); up != 6 || down != 4 {
+		t.Errorf("Expected a win to go up a level and a loss down one, got %v and %v", up, down)
+	}
+	if NextAdaptiveLevel(1, 0, 0.5) != 1 || NextAdaptiveLevel(10, 1, 0.5) != 10 {
+		t.Error("Expected the level to stay on the ladder")
+	}
+	history := []RatingEntry{{Opponents: adaptiveOpponents, Level: 6.5}, {Opponents: "mcts@1000 + mcts@1000"}}
+	if AdaptiveLevel(nil) != adaptiveStartLevel || AdaptiveLevel(history) != 6.5 {
+		t.Error("Expected the level of the last adaptive game")
+	}
+
+	var seats [3]SeatSpec
+	for i, typ := range []string{"mcts", "human", "mcts"} {
+		seats[i], _ = ParsePlayerType(typ)
+	}
+	if err := adaptiveSeats(&seats, 2); err != nil || seats[0].Iterations != 50 || seats[2].Personality != Personalities["random"] || seats[1].Kind != "human" {
+		t.Errorf("Unexpected seats %+v, %v", seats, err)
+	}
+	seats[0], _ = ParsePlayerType("mcts@300")
+	if adaptiveSeats(&seats, 2) == nil {
+		t.Error("Expected an engine of set strength to be refused")
+	}
+}
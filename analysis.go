@@ -0,0 +1,493 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+
+	"squava/game"
+)
+
+// MoveEval is the search result for one candidate move at the root.
+type MoveEval struct {
+	Move    game.Move
+	Visits  int
+	Winrate float32 // For the player to move
+	Outcome Outcome // Proven by the solver near the end of the game
+}
+
+// Eval formats e's evaluation for a table: the proven outcome in capitals,
+// or else the estimated winrate in percent with prec decimals.
+func (e MoveEval) Eval(prec int) string {
+	if e.Outcome != Unproven {
+		return strings.ToUpper(e.Outcome.String())
+	}
+	return fmt.Sprintf("%.*f%%", prec, e.Winrate*100)
+}
+
+// Analysis is the result of searching a single position.
+type Analysis struct {
+	PlayerID int
+	Best     game.Move
+	Winrate  float32    // Root estimate for the player to move
+	Winrates [3]float32 // Root estimate for every player
+	Moves    []MoveEval // Sorted by visits, most visited first
+	Rollouts int
+	Outcome  Outcome       // Proven for the player to move, if every move is or one wins
+	Lines    [][]game.Move // Per move of Moves, the most visited line starting with it; nil after a parallel search
+}
+
+// Eval describes the evaluation of the position for the player to move,
+// proven or estimated, with prec decimals for a winrate.
+func (a Analysis) Eval(prec int) string {
+	if a.Outcome != Unproven {
+		return "proven " + a.Outcome.String()
+	}
+	return fmt.Sprintf("estimated winrate %.*f%%", prec, a.Winrate*100)
+}
+
+// Analyze runs an MCTS search of the given size from gs for the player to
+// move and returns the ranked candidate moves. It shares the global
+// transposition table, so repeated calls on the same game reuse earlier work.
+func Analyze(gs game.GameState, iterations int) Analysis {
+	m := NewMCTSPlayer("Analysis", "?", gs.PlayerID, iterations)
+	_, rollouts := m.Search(gs)
+	return m.analysis(gs, rollouts)
+}
+
+// Analyzer serves repeated analyses from one search graph and private
+// transposition table, which persist between requests: asking again about a
+// position, or about one reached from it, builds on the earlier searches.
+// The graph is capped, recycling what the current position no longer
+// reaches, and the Analyzer has its own stream of random numbers, so it
+// never disturbs the main stream a game replays from. An Analyzer is safe
+// for concurrent use; its requests are served one at a time.
+type Analyzer struct {
+	mu sync.Mutex
+	m  *MCTSPlayer
+	r  Rand
+}
+
+// analyzerSeed seeds every Analyzer's stream, so that the same requests get
+// the same answers.
+const analyzerSeed = 0x5A0A7A
+
+// DefaultAnalyzerMB is the memory NewAnalyzer gives the graph by default.
+const DefaultAnalyzerMB = 64
+
+// NewAnalyzer returns an Analyzer whose graph holds at most maxNodes nodes,
+// or about DefaultAnalyzerMB megabytes of them for 0.
+func NewAnalyzer(maxNodes int) *Analyzer {
+	if maxNodes <= 0 {
+		maxNodes = NodesForMB(DefaultAnalyzerMB)
+	}
+	a := &Analyzer{}
+	a.r.Seed(analyzerSeed)
+	a.m = NewMCTSPlayer("Analysis", "?", 0, 0)
+	a.m.SetMaxNodes(maxNodes)
+	a.m.SetRand(&a.r)
+	return a
+}
+
+// Analyze searches gs until its root has iterations visits, counting those
+// of earlier requests, and returns the ranked candidate moves. Rollouts in
+// the result is the root's visits, reused ones included.
+func (a *Analyzer) Analyze(gs game.GameState, iterations int) Analysis {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.m.info.id = gs.PlayerID
+	a.m.iterations = iterations
+	a.m.Search(gs)
+	return a.m.analysis(gs, a.m.root.N)
+}
+
+// Reset discards the graph and table, so that later requests start afresh,
+// as if from a new Analyzer.
+func (a *Analyzer) Reset() {
+	a.ResetWithSeed(analyzerSeed)
+}
+
+// ResetWithSeed is Reset with the stream restarted from seed instead of the
+// fixed seed, so that requests get answers of their own for each seed.
+func (a *Analyzer) ResetWithSeed(seed uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.m.SetMaxNodes(a.m.arena.limit)
+	a.r.Seed(seed)
+}
+
+// analysis ranks the candidate moves at the root of m's last search, which
+// was of gs.
+func (m *MCTSPlayer) analysis(gs game.GameState, rollouts int) Analysis {
+	a := Analysis{
+		PlayerID: gs.PlayerID,
+		Winrate:  m.root.Q[gs.PlayerID],
+		Winrates: m.root.Q,
+		Rollouts: rollouts,
+	}
+	if m.merged != nil {
+		a.Moves = append(a.Moves, m.merged...)
+	} else {
+		for i := range m.root.Edges {
+			edge := &m.root.Edges[i]
+			a.Moves = append(a.Moves, MoveEval{Move: edge.Move, Visits: int(edge.N), Winrate: m.root.EdgeQs[i]})
+		}
+	}
+	sort.SliceStable(a.Moves, func(i, j int) bool {
+		return a.Moves[i].Visits > a.Moves[j].Visits
+	})
+	if m.merged == nil {
+		for _, e := range a.Moves {
+			for i := range m.root.Edges {
+				if edge := &m.root.Edges[i]; edge.Move == e.Move {
+					a.Lines = append(a.Lines, append([]game.Move{e.Move}, principalVariation(edge.Dest, statsPVLength-1)...))
+				}
+			}
+		}
+	}
+	// Near the end of the game the solver proves what the moves are worth,
+	// and the best of them is the one to play whatever the visits say.
+	if proven, _, ok := ProveMoves(gs); ok {
+		outcomes := make([]Outcome, len(a.Moves))
+		for i := range a.Moves {
+			a.Moves[i].Outcome = proven[a.Moves[i].Move.ToIndex()]
+			outcomes[i] = a.Moves[i].Outcome
+		}
+		a.Outcome = BestOutcome(outcomes)
+	}
+	if len(a.Moves) > 0 {
+		a.Best = a.Moves[0].Move
+		for _, e := range a.Moves {
+			if a.Outcome != Unproven && e.Outcome == a.Outcome {
+				a.Best = e.Move
+				break
+			}
+		}
+	} else if moves := gs.GetBestMoves(); moves != 0 {
+		a.Best = game.MoveFromIndex(PickRandomBit(moves))
+	}
+	return a
+}
+
+// Lengths of the principal variation and of the move list of SearchStats.
+const (
+	statsPVLength = 8
+	statsMoves    = 5
+)
+
+// searchStats summarizes m's last search, which was of gs, for the game
+// record, or returns nil if m has not searched.
+func (m *MCTSPlayer) searchStats(gs game.GameState) *game.SearchStats {
+	if m.root == nil {
+		return nil
+	}
+	a := m.analysis(gs, m.rollouts)
+	s := &game.SearchStats{Rollouts: m.rollouts, Visits: m.root.N}
+	for _, e := range a.Moves[:min(len(a.Moves), statsMoves)] {
+		s.Moves = append(s.Moves, game.MoveVisits{Move: e.Move, Visits: e.Visits, Winrate: e.Winrate})
+	}
+	s.PV = principalVariation(m.root, statsPVLength)
+	return s
+}
+
+// principalVariation follows the most visited edge down the graph from n
+// for at most length moves.
+func principalVariation(n *MCGSNode, length int) []game.Move {
+	var pv []game.Move
+	for n != nil && len(pv) < length {
+		best := -1
+		for i := range n.Edges {
+			if n.Edges[i].N > 0 && (best < 0 || n.Edges[i].N > n.Edges[best].N) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		pv = append(pv, n.Edges[best].Move)
+		n = n.Edges[best].Dest
+	}
+	return pv
+}
+
+// EvalPoint is every player's estimated winrate after the first Ply moves of
+// a game, and the outcome the solver proved there for the player to move,
+// if it did: "win", "draw" or "loss", as in `squava analyze -json`.
+type EvalPoint struct {
+	Ply      int        `json:"ply"`
+	Winrates [3]float32 `json:"winrates"`
+	Outcome  string     `json:"outcome,omitempty"`
+}
+
+// EvalSeries analyzes each of positions, typically a game from the empty board
+// to its final move, and returns how each player's winrate evolved. Finished
+// positions are scored exactly: 1 for the winner and 0 for everyone else, and
+// eliminated players always score 0.
+func EvalSeries(positions []game.GameState, iterations int) []EvalPoint {
+	return NewAnalyzer(0).EvalSeries(positions, iterations)
+}
+
+// EvalSeries is EvalSeries with a's graph.
+func (a *Analyzer) EvalSeries(positions []game.GameState, iterations int) []EvalPoint {
+	series := make([]EvalPoint, len(positions))
+	for i, gs := range positions {
+		series[i].Ply = i
+		if winner, terminal := gs.IsTerminal(); terminal {
+			if winner >= 0 {
+				series[i].Winrates[winner] = 1
+			}
+			continue
+		}
+		res := a.Analyze(gs, iterations)
+		for id := 0; id < 3; id++ {
+			if gs.ActiveMask&(1<<uint(id)) != 0 {
+				series[i].Winrates[id] = res.Winrates[id]
+			}
+		}
+		if res.Outcome != Unproven {
+			series[i].Outcome = res.Outcome.String()
+		}
+	}
+	return series
+}
+
+// BiggestSwing finds the move that changed some player's winrate the most. It
+// returns the ply after which the change is seen, the player, and the change;
+// ply is 0 when the series has fewer than two points.
+func BiggestSwing(series []EvalPoint) (ply, playerID int, delta float32) {
+	best := float32(0)
+	for i := 1; i < len(series); i++ {
+		for id := 0; id < 3; id++ {
+			d := series[i].Winrates[id] - series[i-1].Winrates[id]
+			abs := d
+			if abs < 0 {
+				abs = -abs
+			}
+			if abs > best {
+				best, ply, playerID, delta = abs, series[i].Ply, id, d
+			}
+		}
+	}
+	return
+}
+
+// BlunderThreshold is how much winrate a move must cost its player to count
+// as a blunder.
+const BlunderThreshold = 0.2
+
+// InaccuracyThreshold is how much winrate a move must cost its player to
+// count as an inaccuracy; from BlunderThreshold on it is a blunder.
+const InaccuracyThreshold = 0.08
+
+// CheckMove judges move, played in gs, by the winrate it cost its player
+// against the best move according to a, an analysis of gs, counting a
+// proven win as 1 and a proven loss as 0. A 3-in-a-row the search left out
+// is a blunder; for other moves a has no evaluation of, it returns "".
+func CheckMove(gs game.GameState, a Analysis, move game.Move) string {
+	value := func(e MoveEval) float32 {
+		switch e.Outcome {
+		case ProvenWin:
+			return 1
+		case ProvenLoss:
+			return 0
+		}
+		return e.Winrate
+	}
+	var best, played float32
+	found := false
+	for _, e := range a.Moves {
+		best = max(best, value(e))
+		if e.Move == move {
+			played, found = value(e), true
+		}
+	}
+	switch {
+	case !found && gs.Loses[gs.PlayerID]&(game.Bitboard(1)<<uint(move.ToIndex())) != 0:
+		return game.CheckBlunder
+	case !found:
+		return ""
+	case best-played >= BlunderThreshold:
+		return game.CheckBlunder
+	case best-played >= InaccuracyThreshold:
+		return game.CheckInaccuracy
+	}
+	return game.CheckOK
+}
+
+// Blunder is a move that cost its player at least BlunderThreshold.
+type Blunder struct {
+	Ply      int // The move number, counting from 1
+	PlayerID int
+	Before   float32
+	After    float32
+}
+
+// FindBlunders compares consecutive points of series from the mover's point of
+// view; movers[i] is the player who made move i+1.
+func FindBlunders(series []EvalPoint, movers []int) []Blunder {
+	var out []Blunder
+	for i := 0; i+1 < len(series) && i < len(movers); i++ {
+		id := movers[i]
+		before, after := series[i].Winrates[id], series[i+1].Winrates[id]
+		if before-after >= BlunderThreshold {
+			out = append(out, Blunder{i + 1, id, before, after})
+		}
+	}
+	return out
+}
+
+// DescribeMove explains the tactical effect of playing move in gs: wins,
+// blocks, new threats, and self-elimination.
+func DescribeMove(gs game.GameState, move game.Move) []string {
+	idx := move.ToIndex()
+	mask := game.Bitboard(1) << uint(idx)
+	pID := gs.PlayerID
+	reasons := []string{}
+
+	if gs.Wins[pID]&mask != 0 {
+		return append(reasons, tr("why.wins"))
+	}
+	for _, id := range gs.ActiveIDs() {
+		if id != pID && gs.Wins[id]&mask != 0 {
+			reasons = append(reasons, tr("why.blocks", tr("player", id+1)))
+		}
+	}
+	if gs.Loses[pID]&mask != 0 {
+		return append(reasons, tr("why.eliminated"))
+	}
+
+	empty := ^gs.Board.Occupied & ^mask
+	wins, _ := game.GetWinsAndLosses(gs.Board.P[pID]|mask, empty)
+	if created := wins & ^gs.Wins[pID]; created != 0 {
+		reasons = append(reasons, tr("why.threatens", formatSquares(created)))
+	}
+	return reasons
+}
+
+// formatSquares lists the squares of a bitboard in algebraic notation.
+func formatSquares(bb game.Bitboard) string {
+	squares := []string{}
+	for bb != 0 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		squares = append(squares, game.MoveFromIndex(idx).String())
+		bb &= bb - 1
+	}
+	return strings.Join(squares, ", ")
+}
+
+var lineDirections = [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// WinningLines returns every 4-in-a-row through square idx whose other three
+// squares are all in stones, i.e. the lines that make idx a winning square.
+func WinningLines(stones game.Bitboard, idx int) []game.Bitboard {
+	r, c := idx/8, idx%8
+	var lines []game.Bitboard
+	for _, d := range lineDirections {
+		for start := -3; start <= 0; start++ {
+			var line game.Bitboard
+			complete := true
+			for k := 0; k < 4; k++ {
+				nr, nc := r+(start+k)*d[0], c+(start+k)*d[1]
+				if nr < 0 || nr >= game.BoardSize || nc < 0 || nc >= game.BoardSize {
+					complete = false
+					break
+				}
+				sq := nr*8 + nc
+				if sq != idx && stones&(game.Bitboard(1)<<uint(sq)) == 0 {
+					complete = false
+					break
+				}
+				line |= game.Bitboard(1) << uint(sq)
+			}
+			if complete {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// formatLine writes the squares of a line as e.g. "A1-B2-C3-D4".
+func formatLine(line game.Bitboard) string {
+	return strings.ReplaceAll(formatSquares(line), ", ", "-")
+}
+
+// ExplainForcedMoves describes why the player to move is restricted: the
+// lines that let them win immediately, or the next player's lines that they
+// must block. It returns nil when no move is forced.
+func ExplainForcedMoves(gs game.GameState) []string {
+	forced := gs.ForcedMoves()
+	if forced == 0 {
+		return nil
+	}
+	pID := gs.PlayerID
+	var out []string
+	if gs.Wins[pID] != 0 {
+		for bb := forced; bb != 0; bb &= bb - 1 {
+			idx := bits.TrailingZeros64(uint64(bb))
+			for _, line := range WinningLines(gs.Board.P[pID], idx) {
+				out = append(out, tr("forced.why.win", game.MoveFromIndex(idx), formatLine(line)))
+			}
+		}
+		return out
+	}
+
+	nextP := gs.NextPlayer()
+	for bb := forced; bb != 0; bb &= bb - 1 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		for _, line := range WinningLines(gs.Board.P[nextP], idx) {
+			key := "forced.why.block"
+			if gs.Loses[pID]&(game.Bitboard(1)<<uint(idx)) != 0 {
+				key = "forced.why.block.own"
+			}
+			out = append(out, tr(key, game.MoveFromIndex(idx), tr("player", nextP+1), formatLine(line)))
+		}
+	}
+	if bits.OnesCount64(uint64(forced)) > 1 {
+		out = append(out, tr("forced.why.double", tr("player", nextP+1)))
+	}
+	return out
+}
+
+// DoubleThreats returns the empty squares where a stone of player id would
+// give it two or more winning squares at once, which the next player
+// cannot block with one stone. Squares that win or eliminate id already
+// are left out.
+func DoubleThreats(gs *game.GameState, id int) game.Bitboard {
+	empty := ^gs.Board.Occupied
+	var doubles game.Bitboard
+	for bb := empty &^ (gs.Wins[id] | gs.Loses[id]); bb != 0; bb &= bb - 1 {
+		mask := bb & -bb
+		if wins, _ := game.GetWinsAndLosses(gs.Board.P[id]|mask, empty&^mask); bits.OnesCount64(uint64(wins)) > 1 {
+			doubles |= mask
+		}
+	}
+	return doubles
+}
+
+// ThreatScore is an illustrative count of every player's threats in gs,
+// for showing them as one number: each active player counts 1, plus 4 for
+// every winning square and 2 for every double-threat square, less 1 for
+// every 8 of its losing squares but never below 0.1, and the counts are
+// divided by their sum. The engine does not use it; its estimates come
+// from searching. A finished game scores as it ended.
+func ThreatScore(gs *game.GameState) [3]float32 {
+	if winner, terminal := gs.IsTerminal(); terminal {
+		return ScoreTerminal(gs.ActiveMask, winner)
+	}
+	var score [3]float32
+	var sum float32
+	for _, id := range gs.ActiveIDs() {
+		s := 1 + 4*float32(bits.OnesCount64(uint64(gs.Wins[id]))) +
+			2*float32(bits.OnesCount64(uint64(DoubleThreats(gs, id)))) -
+			float32(bits.OnesCount64(uint64(gs.Loses[id])))/8
+		score[id] = max(s, 0.1)
+		sum += score[id]
+	}
+	for id := range score {
+		score[id] /= sum
+	}
+	return score
+}
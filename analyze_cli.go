@@ -0,0 +1,263 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"squava/game"
+)
+
+// --- Batch analysis ---
+
+// PositionAnalysis is the result of `squava analyze` for one position.
+type PositionAnalysis struct {
+	ID       string         `json:"id,omitempty"`
+	Line     int            `json:"line"`
+	Position string         `json:"position"`
+	Player   int            `json:"player,omitempty"` // The player to move, from 1
+	Best     string         `json:"best,omitempty"`
+	Winrate  float64        `json:"winrate"` // Of the player to move, in percent
+	Outcome  string         `json:"outcome,omitempty"`
+	Visits   int            `json:"visits"`
+	Millis   int64          `json:"ms"`
+	Lines    []AnalysisLine `json:"lines,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// AnalysisLine is one of the best moves of an analyzed position, with the
+// line the search expects after it.
+type AnalysisLine struct {
+	Move    string   `json:"move"`
+	Visits  int      `json:"visits"`
+	Winrate float64  `json:"winrate"`
+	Outcome string   `json:"outcome,omitempty"`
+	PV      []string `json:"pv"`
+}
+
+// analyzeJob is a position of the input file to analyze.
+type analyzeJob struct {
+	index int
+	entry SuiteEntry
+}
+
+// readAnalyzeInput reads one position per line in the position notation,
+// optionally followed by EPD operations of which only "id" is used. Blank
+// lines and lines starting with '#' are skipped.
+func readAnalyzeInput(r io.Reader) ([]SuiteEntry, error) {
+	var entries []SuiteEntry
+	sc := bufio.NewScanner(r)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		gs, ops, err := game.ParseEPD(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		e := SuiteEntry{Line: lineNo, Position: gs, Ops: ops}
+		for _, op := range ops {
+			if op.Name == "id" {
+				e.ID = strings.Join(op.Args, " ")
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// AnalyzePosition searches gs with a, from a fresh graph so that the result
+// does not depend on what a analyzed before, to iterations root visits, or
+// for movetime if iterations is 0, and returns its multiPV best moves.
+func AnalyzePosition(a *Analyzer, gs game.GameState, iterations int, movetime time.Duration, multiPV int) PositionAnalysis {
+	res := PositionAnalysis{Position: game.FormatPosition(gs)}
+	if gs.Terminal {
+		res.Error = "the game is over"
+		return res
+	}
+	res.Player = gs.PlayerID + 1
+	a.Reset()
+	start := time.Now()
+	var an Analysis
+	if iterations > 0 {
+		an = a.Analyze(gs, iterations)
+	} else {
+		// Search in steps until the time is up.
+		for n := analyzeStep; n == analyzeStep || time.Since(start) < movetime; n += analyzeStep {
+			an = a.Analyze(gs, n)
+		}
+	}
+	res.Millis = time.Since(start).Milliseconds()
+	res.Best, res.Visits = an.Best.String(), an.Rollouts
+	res.Winrate = winratePercent(an.Winrate)
+	if an.Outcome != Unproven {
+		res.Outcome = an.Outcome.String()
+	}
+	for i, e := range an.Moves {
+		if i == multiPV {
+			break
+		}
+		l := AnalysisLine{Move: e.Move.String(), Visits: e.Visits, Winrate: winratePercent(e.Winrate)}
+		if e.Outcome != Unproven {
+			l.Outcome = e.Outcome.String()
+		}
+		if i < len(an.Lines) {
+			for _, m := range an.Lines[i] {
+				l.PV = append(l.PV, m.String())
+			}
+		}
+		res.Lines = append(res.Lines, l)
+	}
+	return res
+}
+
+// analyzeStep is the visits a search for a time limit adds between looks at
+// the clock.
+const analyzeStep = 1000
+
+// winratePercent converts a winrate to a percentage with one decimal.
+func winratePercent(w float32) float64 {
+	return math.Round(float64(w)*1000) / 10
+}
+
+// runAnalyze implements `squava analyze`, which analyzes the positions of a
+// file on all cores and writes the results as JSON.
+func runAnalyze(args []string) int {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	input := fs.String("input", "", "File of positions, one per line (default: stdin)")
+	output := fs.String("output", "", "Write the results to this JSON file (default: stdout)")
+	movetime := fs.Duration("movetime", time.Second, "Search time per position")
+	iterations := fs.Int("iterations", 0, "Search every position to this many visits instead of for -movetime, for results that do not depend on the machine")
+	multiPV := fs.Int("multipv", 3, "Best moves to report per position, each with its line")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Positions to analyze at the same time")
+	mb := fs.Int("hash", DefaultAnalyzerMB, "Megabytes of search graph per position analyzed at the same time")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava analyze [-input positions.txt] [-output results.json] [-movetime 1s | -iterations N] [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *movetime <= 0 && *iterations <= 0 || *iterations < 0 || *multiPV < 1 || *concurrency < 1 || *mb < 1 {
+		fmt.Fprintln(os.Stderr, "-movetime or -iterations must be positive, and -multipv, -concurrency and -hash at least 1")
+		return exitUsage
+	}
+	in := io.Reader(os.Stdin)
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		in = f
+	}
+	entries, err := readAnalyzeInput(in)
+	if err != nil {
+		name := *input
+		if name == "" {
+			name = "stdin"
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+
+	results := make([]PositionAnalysis, len(entries))
+	jobs := make(chan analyzeJob)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for range min(*concurrency, max(len(entries), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := NewAnalyzer(NodesForMB(*mb))
+			for j := range jobs {
+				res := AnalyzePosition(a, j.entry.Position, *iterations, *movetime, *multiPV)
+				res.ID, res.Line = j.entry.ID, j.entry.Line
+				mu.Lock()
+				results[j.index] = res
+				done++
+				fmt.Fprintf(os.Stderr, "\rAnalyzed %d of %d positions", done, len(entries))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i, e := range entries {
+		jobs <- analyzeJob{i, e}
+	}
+	close(jobs)
+	wg.Wait()
+	if len(entries) > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return 0
+}
+
+// runBestMove implements `squava bestmove`, which searches one position and
+// prints the engine's move, for scripts that want a move without keeping
+// an engine running.
+func runBestMove(args []string) int {
+	fs := flag.NewFlagSet("bestmove", flag.ExitOnError)
+	position := fs.String("position", "", "The position, in the position notation")
+	movetime := fs.Duration("movetime", 2*time.Second, "Search time")
+	iterations := fs.Int("iterations", 0, "Search to this many visits instead of for -movetime, for a move that does not depend on the machine")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `usage: squava bestmove -position "8/8/8/8/3X4/8/8/8 2 123" [-movetime 2s | -iterations N]`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *position == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	if *movetime <= 0 && *iterations <= 0 || *iterations < 0 {
+		fmt.Fprintln(os.Stderr, "-movetime or -iterations must be positive")
+		return exitUsage
+	}
+	gs, err := game.ParsePosition(*position)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-position: %v\n", err)
+		return exitUsage
+	}
+	if gs.Terminal {
+		fmt.Fprintln(os.Stderr, "the game is over in this position")
+		return exitError
+	}
+	// A move the rules force needs no search.
+	if moves := gs.GetBestMoves(); bits.OnesCount64(uint64(moves)) == 1 {
+		fmt.Println(game.MoveFromIndex(bits.TrailingZeros64(uint64(moves))))
+		return 0
+	}
+	fmt.Println(AnalyzePosition(NewAnalyzer(0), gs, *iterations, *movetime, 1).Best)
+	return 0
+}
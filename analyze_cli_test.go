@@ -0,0 +1,44 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"squava/game"
+)
+
+func TestAnalyzePosition(t *testing.T) {
+	entries, err := readAnalyzeInput(strings.NewReader("# positions\n7Z/8/7Z/4X2Z/4X3/8/1XX5/O6O 1 123 id \"win in 2\";\n\n8/8/8/3ZO3/8/8/8/XX6 1 123\n"))
+	if err != nil || len(entries) != 2 || entries[0].ID != "win in 2" || entries[1].Line != 4 {
+		t.Fatalf("Unexpected input %+v, %v", entries, err)
+	}
+	// Results do not depend on what the analyzer searched before.
+	a := NewAnalyzer(MinMaxNodes)
+	first := AnalyzePosition(a, entries[0].Position, 2000, 0, 2)
+	AnalyzePosition(a, entries[1].Position, 2000, 0, 2)
+	again := AnalyzePosition(NewAnalyzer(MinMaxNodes), entries[0].Position, 2000, 0, 2)
+	first.Millis, again.Millis = 0, 0
+	want, _ := json.Marshal(first)
+	if got, _ := json.Marshal(again); !bytes.Equal(got, want) {
+		t.Errorf("Expected the same analysis from a fresh analyzer:\n%s\n%s", want, got)
+	}
+	if first.Best != "E2" || first.Player != 1 || first.Visits != 2000 || len(first.Lines) != 2 {
+		t.Errorf("Unexpected analysis %+v", first)
+	}
+	for _, l := range first.Lines {
+		if len(l.PV) == 0 || l.PV[0] != l.Move {
+			t.Errorf("Expected the line of %s to start with it, got %v", l.Move, l.PV)
+		}
+	}
+	if res := AnalyzePosition(a, game.NewGameState(game.Board{}, 0, 0b111), 0, time.Millisecond, 3); res.Visits < analyzeStep || len(res.Lines) != 3 {
+		t.Errorf("Expected a timed search of at least one step, got %+v", res)
+	}
+	if code := runBestMove([]string{"-position", "8/8/8 1 123"}); code != exitUsage {
+		t.Errorf("Expected a bad position to be a usage error, got exit code %d", code)
+	}
+}
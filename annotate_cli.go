@@ -0,0 +1,74 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runAnnotate implements `squava annotate game.sqv`, adding commentary on
+// every move of a saved game to its record and, optionally, an HTML report.
+func runAnnotate(args []string) int {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	depth := fs.Int("depth", commentaryDepth, "Look this many of a player's moves ahead for forced wins and losses")
+	out := fs.String("o", "", "Write the annotated record to this file (default: stdout)")
+	report := fs.String("report", "", "Also write an HTML report with the commentary to this file")
+	reportEngine := fs.String("report-engine", "", "Embed this WASM build of squava (make wasm) in -report to explore its positions with")
+	iterations := fs.Int("iterations", 20000, "MCTS iterations per position for the report's evaluation graph")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava annotate [-depth N] [-o out.sqv] [-report out.html] game.sqv")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *depth < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	g, rec, err := loadRecordFile(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load %s: %v\n", fs.Arg(0), err)
+		return exitError
+	}
+	if *reportEngine != "" {
+		wasm, err := LoadReportEngine(*reportEngine)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load %s: %v\n", *reportEngine, err)
+			return exitError
+		}
+		g.SetReportEngine(wasm)
+	}
+	if *report != "" {
+		if err := g.SaveReport(*report, *iterations); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write report: %v\n", err)
+			return exitError
+		}
+	}
+	if err := Annotate(rec, *depth); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if *out == "" {
+		if err := rec.Write(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		return 0
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if err := rec.Write(f); err != nil {
+		f.Close()
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return 0
+}
@@ -0,0 +1,603 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// --- Arena ---
+
+// arena is a ladder of engines that keeps playing: the games of an endless
+// round robin, and the ratings fitted to all games played so far, which it
+// serves over HTTP as they change.
+type arena struct {
+	m          *matchRunner
+	configPath string // The pool's -config file, reloaded on request, or ""
+
+	mu       sync.Mutex // Also guards the engines, state and standings of m
+	active   []int      // The engines, by index, that new games are played among
+	ratings  Ratings    // Fit to the games of m.state
+	games    int
+	started  time.Time
+	stopping bool // Shutting down: no new games, and those under way are saved
+}
+
+// ArenaConfig is an arena's pool as read from its -config file, which can be
+// edited and reloaded while the arena runs.
+type ArenaConfig struct {
+	Iterations int                `json:"iterations,omitempty"` // MCTS iterations for engines without @N
+	Engines    []TournamentEngine `json:"engines"`
+}
+
+// LoadArenaConfig reads and checks an arena's config file.
+func LoadArenaConfig(path string) (ArenaConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ArenaConfig{}, err
+	}
+	var c ArenaConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return ArenaConfig{}, fmt.Errorf("%s: %v", path, err)
+	}
+	if c.Iterations < 0 {
+		return ArenaConfig{}, fmt.Errorf("%s: negative iterations", path)
+	}
+	if len(c.Engines) < 2 {
+		return ArenaConfig{}, fmt.Errorf("%s: the pool needs at least 2 engines", path)
+	}
+	seen := map[string]bool{}
+	for _, e := range c.Engines {
+		if parsed, err := ParseTournamentEngine(e.Name + "=" + e.Spec); err != nil {
+			return ArenaConfig{}, fmt.Errorf("%s: %v", path, err)
+		} else if e.Name == "" || parsed != e {
+			return ArenaConfig{}, fmt.Errorf("%s: bad engine name %q", path, e.Name)
+		}
+		if seen[e.Name] {
+			return ArenaConfig{}, fmt.Errorf("%s: engine %s is listed twice", path, e.Name)
+		}
+		seen[e.Name] = true
+	}
+	return c, nil
+}
+
+// ArenaStanding is an engine's place on the ladder, as served at
+// /standings.
+type ArenaStanding struct {
+	Rank  int      `json:"rank"`
+	Name  string   `json:"name"`
+	Spec  string   `json:"spec"`
+	Elo   float64  `json:"elo"`
+	CI95  *float64 `json:"ci95,omitempty"` // Half-width of the 95% interval, if known
+	Games int      `json:"games"`
+	Score float64  `json:"score"` // In percent
+}
+
+// ArenaLadder is the ladder served at /standings.
+type ArenaLadder struct {
+	Status   string          `json:"status"` // running, or stopping once a shutdown has begun
+	Games    int             `json:"games"`
+	DrawRate float64         `json:"draw_rate"`
+	Uptime   string          `json:"uptime"`
+	Engines  []ArenaStanding `json:"engines"`
+}
+
+// ArenaQueue is the state of the arena's game slots, as served at /queue.
+type ArenaQueue struct {
+	Slots     int           `json:"slots"`
+	Running   []ArenaRunner `json:"running"`
+	Wait      *float64      `json:"wait_seconds,omitempty"` // Estimated time until the next game starts, once known
+	CPUBudget float64       `json:"cpu_budget_seconds,omitempty"`
+	MemoryMB  int           `json:"memory_mb,omitempty"`
+}
+
+// ArenaRunner is a game under way in the arena.
+type ArenaRunner struct {
+	Game    int       `json:"game"`
+	Engines [3]string `json:"engines"`
+	Seconds float64   `json:"seconds"` // Since it started, or resumed
+}
+
+// arenaGame returns the index-th game of the arena among the active engines,
+// counting from 1: the seatings of every round robin table in turn, over and
+// over.
+func arenaGame(index int, active []int, seed int64) *tournamentGame {
+	var cycle [][3]int
+	for _, table := range TournamentTables(len(active), false) {
+		for _, s := range Seatings(table) {
+			cycle = append(cycle, [3]int{active[s[0]], active[s[1]], active[s[2]]})
+		}
+	}
+	return &tournamentGame{Index: index, Seed: seed + int64(index-1), Seats: cycle[(index-1)%len(cycle)]}
+}
+
+// savedRatingGames converts finished games for the rating model.
+func savedRatingGames(games []SavedGame) []RatingGame {
+	out := make([]RatingGame, 0, len(games))
+	for _, g := range games {
+		rg := RatingGame{Seats: g.Seats, Winner: -1}
+		for seat, r := range g.Result {
+			if r == "win" {
+				rg.Winner = seat
+			}
+		}
+		out = append(out, rg)
+	}
+	return out
+}
+
+// refit fits the ratings to the games played so far. It is called with a.mu
+// held.
+func (a *arena) refit() {
+	names := make([]string, len(a.m.engines))
+	for i, e := range a.m.engines {
+		names[i] = e.Name
+	}
+	a.ratings, a.games = FitRatings(names, savedRatingGames(a.m.state.Games)), len(a.m.state.Games)
+}
+
+// apply makes cfg the pool of the games that start from now on, and returns
+// what changed. Engines new to the arena join it, and engines left out of
+// cfg stay on the ladder but play no more games. It is called with a.mu
+// held.
+func (a *arena) apply(cfg ArenaConfig) []string {
+	changes := []string{}
+	index := map[string]int{}
+	for i, e := range a.m.engines {
+		index[e.Name] = i
+	}
+	active := make([]int, 0, len(cfg.Engines))
+	kept := map[int]bool{}
+	for _, e := range cfg.Engines {
+		i, ok := index[e.Name]
+		switch {
+		case !ok:
+			i = len(a.m.engines)
+			a.m.engines = append(a.m.engines, e)
+			a.m.standings = append(a.m.standings, Standing{Name: e.Name})
+			changes = append(changes, fmt.Sprintf("%s (%s) joins the arena", e.Name, e.Spec))
+		case a.m.engines[i].Spec != e.Spec:
+			changes = append(changes, fmt.Sprintf("%s is now %s, was %s", e.Name, e.Spec, a.m.engines[i].Spec))
+			a.m.engines[i].Spec = e.Spec
+		}
+		active = append(active, i)
+		kept[i] = true
+	}
+	for _, i := range a.active {
+		if !kept[i] {
+			changes = append(changes, fmt.Sprintf("%s leaves the arena", a.m.engines[i].Name))
+		}
+	}
+	if cfg.Iterations > 0 && cfg.Iterations != a.m.state.Iterations {
+		changes = append(changes, fmt.Sprintf("Iterations are now %d, were %d", cfg.Iterations, a.m.state.Iterations))
+		a.m.state.Iterations = cfg.Iterations
+	}
+	a.m.state.Engines, a.active = a.m.engines, active
+	return changes
+}
+
+// reload reads the config file again and applies it. Games under way finish
+// with the engines they started with.
+func (a *arena) reload() ([]string, error) {
+	cfg, err := LoadArenaConfig(a.configPath)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	changes := a.apply(cfg)
+	a.refit()
+	err = a.m.checkpoint()
+	a.mu.Unlock()
+	for _, c := range changes {
+		slog.Info(c, "event", "reload_change")
+	}
+	slog.Info(fmt.Sprintf("Reloaded %s: %d change(s)", a.configPath, len(changes)), "event", "reload", "config", a.configPath, "changes", len(changes))
+	return changes, err
+}
+
+// ladder returns the current ladder.
+func (a *arena) ladder() ArenaLadder {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	specs := map[string]string{}
+	for _, e := range a.m.engines {
+		specs[e.Name] = e.Spec
+	}
+	l := ArenaLadder{Status: "running", Games: a.games, DrawRate: a.ratings.DrawRate, Uptime: time.Since(a.started).Round(time.Second).String(), Engines: []ArenaStanding{}}
+	for i, r := range a.ratings.Engines {
+		s := ArenaStanding{Rank: i + 1, Name: r.Name, Spec: specs[r.Name], Elo: math.Round(r.Elo*10) / 10, Games: r.Games,
+			Score: math.Round(1000*r.Score/float64(max(r.Games, 1))) / 10}
+		if !math.IsNaN(r.CI95) {
+			ci := math.Round(r.CI95*10) / 10
+			s.CI95 = &ci
+		}
+		l.Engines = append(l.Engines, s)
+	}
+	if a.stopping {
+		l.Status = "stopping"
+	}
+	return l
+}
+
+// queue returns the state of the game slots.
+func (a *arena) queue() ArenaQueue {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	games, wait, known := a.m.underWay(now)
+	q := ArenaQueue{Slots: a.m.concurrency, Running: []ArenaRunner{}, CPUBudget: a.m.limits.CPU.Seconds(), MemoryMB: a.m.limits.MB}
+	for _, r := range games {
+		q.Running = append(q.Running, ArenaRunner{Game: r.game.Index, Engines: a.m.names(r.game), Seconds: now.Sub(r.start).Round(100 * time.Millisecond).Seconds()})
+	}
+	if known && !a.stopping {
+		w := wait.Round(time.Second).Seconds()
+		q.Wait = &w
+	}
+	return q
+}
+
+// ServeHTTP serves the ladder, as a table at / and as JSON at /standings,
+// the game slots as JSON at /queue, and reloads the config file on POST
+// /admin/reload.
+func (a *arena) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/admin/reload" {
+		a.serveReload(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case "/":
+		a.mu.Lock()
+		ratings, games, stopping := a.ratings, a.games, a.stopping
+		a.mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Arena: %d games\n", games)
+		if stopping {
+			fmt.Fprintln(w, "The arena is shutting down; games under way will resume when it restarts.")
+		}
+		fmt.Fprintln(w)
+		ratings.Print(w)
+	case "/standings":
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(a.ladder())
+	case "/queue":
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(a.queue())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveReload reloads the config file and reports what changed.
+func (a *arena) serveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.configPath == "" {
+		http.Error(w, "the arena has no -config file to reload", http.StatusConflict)
+		return
+	}
+	a.mu.Lock()
+	stopping := a.stopping
+	a.mu.Unlock()
+	if stopping {
+		http.Error(w, "the arena is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	changes, err := a.reload()
+	if err != nil {
+		slog.Error(fmt.Sprintf("Reload failed: %v", err), "event", "reload_failed", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Changes []string `json:"changes"`
+	}{changes})
+}
+
+// runArena implements `squava arena`, which keeps playing games among a pool
+// of engines and maintains a ladder of their ratings.
+func runArena(args []string) int {
+	fs := flag.NewFlagSet("arena", flag.ExitOnError)
+	var engines engineList
+	fs.Var(&engines, "engine", "An engine of the pool as name=type, e.g. v1=mcts@1000 or net=cmd:./engine (repeatable)")
+	configPath := fs.String("config", "", "Read the pool from this JSON file instead of -engine, and read it again on SIGHUP or POST /admin/reload")
+	games := fs.Int("games", 0, "Stop once the arena has played this many games in all (0 to play until interrupted)")
+	iterations := fs.Int("iterations", 1000, "MCTS iterations for engines without @N")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Games to play at the same time")
+	seed := fs.Int64("seed", 0, "Random seed of the first game; later games count up from it (0 for time-based)")
+	statePath := fs.String("state", "", "Save the arena after every game to this file, and resume from it if it exists")
+	out := fs.String("out", "", "Append one JSON line per game to this results file")
+	recordsDir := fs.String("records", "", "Save the record of every game in this directory")
+	listen := fs.String("http", "", "Serve the ladder on this address (e.g. localhost:8080): a table at / and JSON at /standings")
+	every := fs.Int("print-every", 10, "Print the ladder after this many games (0 for never)")
+	gameCPU := fs.Duration("game-cpu", 0, "Stop a game once its process has used this much CPU time, on Linux (0 for no limit)")
+	gameMB := fs.Int("game-mb", 0, "Stop a game once its process holds this many megabytes, on Linux, and give an eighth of them to each engine's graph (0 for no limit)")
+	logs := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava arena -engine v1=mcts@1000 -engine v2=mcts:trappy@1000 [-engine ...] [-state arena.json] [-http :8080] [flags]")
+		fmt.Fprintln(os.Stderr, "       squava arena -state arena.json [-engine new=...]   (resume, adding engines to the pool)")
+		fmt.Fprintln(os.Stderr, "       squava arena -config pool.json [-state arena.json] [-http :8080] [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *games < 0 || *every < 0 || *configPath != "" && len(engines) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *gameCPU < 0 || *gameMB != 0 && *gameMB < 8 {
+		fmt.Fprintln(os.Stderr, "-game-cpu must not be negative, and -game-mb must be 0 or at least 8")
+		return exitUsage
+	}
+	stopLog, err := logs.start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	defer stopLog()
+	var cfg ArenaConfig
+	if *configPath != "" {
+		if cfg, err = LoadArenaConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	state := &TournamentState{Format: "arena", Seed: *seed, Iterations: *iterations, Engines: engines}
+	if *statePath != "" {
+		saved, err := LoadTournamentState(*statePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load the arena state: %v\n", err)
+			return exitError
+		}
+		if saved != nil {
+			if saved.Format != "arena" {
+				fmt.Fprintf(os.Stderr, "%s is not an arena but a %s tournament\n", *statePath, saved.Format)
+				return exitUsage
+			}
+			// Engines named on the command line that the arena does not have
+			// yet join the pool; the others must be as saved.
+			known := map[string]TournamentEngine{}
+			for _, e := range saved.Engines {
+				known[e.Name] = e
+			}
+			for _, e := range engines {
+				if k, ok := known[e.Name]; !ok {
+					saved.Engines = append(saved.Engines, e)
+					known[e.Name] = e
+					slog.Info(fmt.Sprintf("%s (%s) joins the arena", e.Name, e.Spec), "event", "join", "engine", e.Name, "spec", e.Spec)
+				} else if k.Spec != e.Spec {
+					fmt.Fprintf(os.Stderr, "engine %s is %s in %s, not %s\n", e.Name, k.Spec, *statePath, e.Spec)
+					return exitUsage
+				}
+			}
+			state = saved
+			slog.Info(fmt.Sprintf("Resuming from %s: %d games played", *statePath, len(state.Games)),
+				"event", "resume", "state", *statePath, "games", len(state.Games))
+		}
+	}
+	if len(state.Engines) < 2 && *configPath == "" {
+		fs.Usage()
+		return exitUsage
+	}
+
+	m, err := newMatchRunner(state, *concurrency)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	m.statePath = *statePath
+	m.limits = GameLimits{CPU: *gameCPU, MB: *gameMB}
+	if *recordsDir != "" {
+		if err := os.MkdirAll(*recordsDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		m.recordsDir = *recordsDir
+	} else if *statePath != "" {
+		// Games autosave next to the state even without -records, so that
+		// a shutdown can resume them.
+		m.spoolDir = *statePath + ".games"
+		if err := os.MkdirAll(m.spoolDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open results file: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		m.results = f
+	}
+	a := &arena{m: m, configPath: *configPath, started: time.Now()}
+	if *configPath != "" {
+		for _, c := range a.apply(cfg) {
+			slog.Info(c, "event", "config_change")
+		}
+		// SIGHUP reloads the config, as does POST /admin/reload.
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for range hup {
+				if _, err := a.reload(); err != nil {
+					slog.Error(fmt.Sprintf("Reload failed, the pool is unchanged: %v", err), "event", "reload_failed", "error", err)
+				}
+			}
+		}()
+	} else {
+		for i := range m.engines {
+			a.active = append(a.active, i)
+		}
+	}
+	a.refit()
+	if *listen != "" {
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not listen on %s: %v\n", *listen, err)
+			return exitError
+		}
+		srv := &http.Server{Handler: a}
+		go srv.Serve(ln)
+		defer func() {
+			// Let requests under way finish.
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(ctx)
+		}()
+		slog.Info(fmt.Sprintf("Serving the ladder on http://%s/", ln.Addr()), "event", "serve", "addr", ln.Addr().String())
+	}
+	slog.Info(fmt.Sprintf("Arena: %d engines, %s", len(a.active), m.pace()),
+		"event", "start", "format", "arena", "engines", len(a.active), "games", *games)
+
+	// SIGTERM or an interrupt stops the arena: no new games start, the games
+	// under way are killed and kept in the state with their records so far,
+	// and the next run resumes them first. A second signal exits at once.
+	stop := make(chan struct{})
+	m.halt = make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		s := <-sig
+		signal.Stop(sig)
+		slog.Info(fmt.Sprintf("Got %v: stopping, and saving the games under way to resume", s), "event", "shutdown", "signal", s.String())
+		a.mu.Lock()
+		a.stopping = true
+		a.mu.Unlock()
+		close(stop)
+		close(m.halt)
+	}()
+
+	// Interrupted games come first. After them, games are numbered on from
+	// 1, skipping those already played; the index and the active engines
+	// decide a game's seats and seed.
+	resume := slices.Clone(state.Interrupted)
+	done := state.played()
+	for _, u := range resume {
+		done[u.Index] = true
+	}
+	index := 0
+	next := func() *tournamentGame {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.stopping {
+			return nil
+		}
+		if len(resume) > 0 {
+			u := resume[0]
+			resume = resume[1:]
+			g := &tournamentGame{Index: u.Index, Seed: u.Seed, Seats: u.Seats, Specs: u.Specs, Iterations: u.Iterations, Resume: u.Record}
+			if g.Resume != "" {
+				if _, err := os.Stat(g.Resume); err != nil {
+					slog.Warn(fmt.Sprintf("Game %d: %v; playing it from the start", g.Index, err), "event", "resume_lost", "game", g.Index)
+					g.Resume = ""
+				}
+			}
+			slog.Info(fmt.Sprintf("Resuming game %d", g.Index), "event", "resume_game", "game", g.Index, "record", g.Resume)
+			return g
+		}
+		index++
+		for done[index] {
+			index++
+		}
+		if *games > 0 && index > *games {
+			return nil
+		}
+		g := arenaGame(index, a.active, state.Seed)
+		m.bind(g)
+		return g
+	}
+	finished, failed, interrupted := 0, 0, 0
+	for g := range m.play(next, stop) {
+		a.mu.Lock()
+		state.Interrupted = slices.DeleteFunc(state.Interrupted, func(u GameUnderWay) bool { return u.Index == g.Index })
+		if errors.Is(g.Err, errGameInterrupted) {
+			interrupted++
+			u := GameUnderWay{Index: g.Index, Seed: g.Seed, Seats: g.Seats, Specs: g.Specs, Iterations: g.Iterations}
+			if path := m.recordPath(g); path != "" {
+				if _, err := os.Stat(path); err == nil {
+					u.Record = path
+				}
+			}
+			state.Interrupted = append(state.Interrupted, u)
+			err := m.checkpoint()
+			a.mu.Unlock()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+			continue
+		}
+		if g.Err != nil {
+			failed++
+			slog.Error(fmt.Sprintf("Game %d: %v", g.Index, g.Err), m.gameAttrs(g)...)
+			a.mu.Unlock()
+			continue
+		}
+		desc, err := m.record(g)
+		slog.Info(fmt.Sprintf("Game %d %s", g.Index, desc), m.gameAttrs(g)...)
+		if err != nil {
+			a.mu.Unlock()
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		if m.recordsDir == "" && m.spoolDir != "" {
+			os.Remove(m.recordPath(g))
+		}
+		a.refit()
+		if finished++; *every > 0 && finished%*every == 0 {
+			fmt.Println()
+			a.ratings.Print(os.Stdout)
+			fmt.Println()
+		}
+		a.mu.Unlock()
+	}
+
+	fmt.Println()
+	fmt.Printf("Ladder after %d games:\n", len(state.Games))
+	a.ratings.Print(os.Stdout)
+	if interrupted > 0 && m.statePath != "" {
+		fmt.Fprintf(os.Stderr, "%d game(s) under way are saved in %s and resume when the arena runs again\n", interrupted, m.statePath)
+	} else if interrupted > 0 {
+		fmt.Fprintf(os.Stderr, "%d game(s) under way were stopped; without -state they are not resumed\n", interrupted)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d game(s) failed\n", failed)
+		return exitError
+	}
+	return 0
+}
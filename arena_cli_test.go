@@ -0,0 +1,221 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArena(t *testing.T) {
+	// Four engines cycle through 4 tables of 6 seatings each.
+	seen := map[[3]int]bool{}
+	for i := 1; i <= 24; i++ {
+		g := arenaGame(i, []int{0, 1, 2, 3}, 100)
+		if g.Seed != 100+int64(i-1) || seen[g.Seats] {
+			t.Errorf("Game %d: %+v", i, g)
+		}
+		seen[g.Seats] = true
+	}
+	if g := arenaGame(25, []int{0, 1, 2, 3}, 100); g.Seats != arenaGame(1, []int{0, 1, 2, 3}, 100).Seats {
+		t.Errorf("Game 25 does not start the cycle again: %+v", g)
+	}
+
+	// A wins every game it plays against B and C.
+	state := &TournamentState{Format: "arena", Engines: []TournamentEngine{{"A", "mcts@500"}, {"B", "mcts@100"}, {"C", "mcts@100"}}}
+	for i := 1; i <= 12; i++ {
+		g := arenaGame(i, []int{0, 1, 2}, 0)
+		saved := SavedGame{Index: i, Seats: g.Seats, Result: [3]string{"loss", "loss", "loss"}}
+		for seat, e := range g.Seats {
+			if e == 0 {
+				saved.Result[seat] = "win"
+			}
+		}
+		state.Games = append(state.Games, saved)
+	}
+	m, err := newMatchRunner(state, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &arena{m: m, active: []int{0, 1, 2}, started: time.Now()}
+	a.refit()
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/standings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var ladder ArenaLadder
+	if err := json.NewDecoder(resp.Body).Decode(&ladder); err != nil {
+		t.Fatal(err)
+	}
+	if ladder.Games != 12 || len(ladder.Engines) != 3 {
+		t.Fatalf("Unexpected ladder %+v", ladder)
+	}
+	if top := ladder.Engines[0]; top.Name != "A" || top.Spec != "mcts@500" || top.Rank != 1 || top.Score != 100 || top.Elo <= 0 || top.CI95 == nil {
+		t.Errorf("Unexpected top of the ladder %+v", top)
+	}
+	resp, err = http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "Arena: 12 games") {
+		t.Errorf("Unexpected table:\n%s", body)
+	}
+}
+
+func TestArenaReload(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pool.json")
+	write := func(config string) {
+		if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"iterations": 500, "engines": [{"name": "a", "spec": "mcts"}, {"name": "b", "spec": "mcts@200"}, {"name": "c", "spec": "mcts:trappy"}]}`)
+	cfg, err := LoadArenaConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &TournamentState{Format: "arena", Iterations: 1000}
+	m, err := newMatchRunner(state, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &arena{m: m, configPath: path, started: time.Now()}
+	a.apply(cfg)
+	a.refit()
+	under := arenaGame(1, a.active, 0)
+	m.bind(under)
+	if under.Specs != [3]string{"mcts", "mcts@200", "mcts:trappy"} || under.Iterations != 500 {
+		t.Fatalf("Unexpected game %+v", under)
+	}
+
+	// b gets a new budget, c leaves and d joins; the game under way keeps
+	// its engines.
+	write(`{"engines": [{"name": "a", "spec": "mcts"}, {"name": "b", "spec": "mcts@400"}, {"name": "d", "spec": "mcts:trappy@300"}]}`)
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reload: %d %s", rec.Code, rec.Body)
+	}
+	var resp struct{ Changes []string }
+	json.NewDecoder(rec.Body).Decode(&resp)
+	want := []string{"b is now mcts@400, was mcts@200", "d (mcts:trappy@300) joins the arena", "c leaves the arena"}
+	if !slices.Equal(resp.Changes, want) {
+		t.Errorf("Changes %q, want %q", resp.Changes, want)
+	}
+	if under.Specs[1] != "mcts@200" {
+		t.Errorf("The game under way changed: %+v", under)
+	}
+	g := arenaGame(2, a.active, 0)
+	m.bind(g)
+	if g.Specs != [3]string{"mcts", "mcts:trappy@300", "mcts@400"} || g.Iterations != 500 {
+		t.Errorf("Unexpected game after the reload %+v", g)
+	}
+	if names := a.ladder().Engines; len(names) != 4 {
+		t.Errorf("Expected all 4 engines on the ladder, got %+v", names)
+	}
+
+	// A bad config leaves the pool as it was.
+	write(`{"engines": [{"name": "a", "spec": "human"}, {"name": "b", "spec": "mcts"}]}`)
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	if rec.Code != http.StatusBadRequest || !slices.Equal(a.active, []int{0, 1, 3}) {
+		t.Errorf("Bad config: %d, active %v", rec.Code, a.active)
+	}
+}
+
+func TestArenaShutdown(t *testing.T) {
+	dir := t.TempDir()
+	state := &TournamentState{Format: "arena", Iterations: 1000, Engines: []TournamentEngine{{"a", "mcts"}, {"b", "mcts@200"}, {"c", "mcts"}},
+		Interrupted: []GameUnderWay{{Index: 3, Seed: 12, Seats: [3]int{1, 0, 2}, Specs: [3]string{"mcts@200", "mcts", "mcts"}, Iterations: 1000, Record: "game-0003.sqv"}}}
+	path := filepath.Join(dir, "arena.json")
+	if err := state.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadTournamentState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Interrupted) != 1 || loaded.Interrupted[0] != state.Interrupted[0] {
+		t.Errorf("Interrupted games did not survive saving: %+v", loaded.Interrupted)
+	}
+
+	m, err := newMatchRunner(loaded, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &arena{m: m, configPath: filepath.Join(dir, "pool.json"), active: []int{0, 1, 2}, started: time.Now(), stopping: true}
+	a.refit()
+	if l := a.ladder(); l.Status != "stopping" {
+		t.Errorf("Status %q while stopping", l.Status)
+	}
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Reload while stopping: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rec.Body.String(), "shutting down") {
+		t.Errorf("The table does not tell of the shutdown:\n%s", rec.Body)
+	}
+}
+
+func TestArenaQueue(t *testing.T) {
+	state := &TournamentState{Format: "arena", Engines: []TournamentEngine{{"a", "mcts"}, {"b", "mcts"}, {"c", "mcts"}}}
+	m, err := newMatchRunner(state, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.limits = GameLimits{CPU: time.Minute, MB: 64}
+	a := &arena{m: m, active: []int{0, 1, 2}, started: time.Now()}
+	if q := a.queue(); len(q.Running) != 0 || q.Wait == nil || *q.Wait != 0 || q.CPUBudget != 60 || q.MemoryMB != 64 {
+		t.Errorf("Unexpected queue of an idle arena %+v", q)
+	}
+
+	// Both slots are taken and no game has finished: the wait is unknown.
+	g1, g2 := arenaGame(1, a.active, 0), arenaGame(2, a.active, 0)
+	m.begin(g2)
+	m.begin(g1)
+	if q := a.queue(); len(q.Running) != 2 || q.Running[0].Game != 1 || q.Running[1].Engines != [3]string{"a", "c", "b"} || q.Wait != nil {
+		t.Errorf("Unexpected queue %+v", q)
+	}
+
+	// Games take 10 minutes on average; the one started 4 minutes ago ends
+	// in about 6.
+	m.gameTime, m.timedGames = 20*time.Minute, 2
+	now := time.Now()
+	m.running[1].start = now.Add(-4 * time.Minute)
+	m.running[2].start = now.Add(-time.Minute)
+	if _, wait, known := m.underWay(now); !known || wait != 6*time.Minute {
+		t.Errorf("Wait %v (known %v), want 6m", wait, known)
+	}
+	m.end(g1)
+	if _, wait, known := m.underWay(now); !known || wait != 0 || m.timedGames != 3 {
+		t.Errorf("Wait %v (known %v) with a free slot, %d games timed", wait, known, m.timedGames)
+	}
+
+	if used, err := processCPUTime(os.Getpid()); err != nil && !errors.Is(err, errors.ErrUnsupported) || used < 0 {
+		t.Errorf("processCPUTime: %v, %v", used, err)
+	}
+	if rss, err := processRSS(os.Getpid()); err != nil && !errors.Is(err, errors.ErrUnsupported) || err == nil && rss <= 0 {
+		t.Errorf("processRSS: %v, %v", rss, err)
+	}
+}
@@ -0,0 +1,218 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"squava/game"
+)
+
+// --- First-move advantage ---
+
+// seatOutcomes counts how games ended for each seat.
+type seatOutcomes struct {
+	Games      int
+	Wins       [3]int
+	Eliminated [3]int // Knocked out by a 3-in-a-row, or resigned
+	Draws      int
+}
+
+func (o *seatOutcomes) add(final game.GameState) {
+	o.Games++
+	for seat := range 3 {
+		if seat == final.WinnerID {
+			o.Wins[seat]++
+		} else if final.ActiveMask&(1<<uint(seat)) == 0 {
+			o.Eliminated[seat]++
+		}
+	}
+	if final.WinnerID < 0 {
+		o.Draws++
+	}
+}
+
+// BalanceStudy collects the outcomes of games between identical engines, by
+// seat and by the square of the first move.
+type BalanceStudy struct {
+	seatOutcomes
+	// Openings holds the games by their first move, turned by the board's
+	// symmetries onto one of FirstSquares.
+	Openings map[int]*seatOutcomes
+}
+
+// FirstSquares returns the squares a first move can be on up to a rotation
+// or reflection of the board: the 10 squares of one eighth of it.
+func FirstSquares() []int {
+	var squares []int
+	for idx := range game.BoardSize * game.BoardSize {
+		if canonicalFirstSquare(idx) == idx {
+			squares = append(squares, idx)
+		}
+	}
+	return squares
+}
+
+// canonicalFirstSquare maps idx to the least square a symmetry takes it to.
+func canonicalFirstSquare(idx int) int {
+	best := idx
+	for s := 1; s < game.NumSymmetries; s++ {
+		best = min(best, game.TransformSquare(idx, s))
+	}
+	return best
+}
+
+// Add counts a game finished under SquavaRules.
+func (b *BalanceStudy) Add(rec *game.GameRecord) error {
+	positions, err := rec.Positions()
+	if err != nil {
+		return err
+	}
+	final := positions[len(positions)-1]
+	if _, over := (SquavaRules{}).Terminal(&final); !over {
+		return fmt.Errorf("the game is unfinished")
+	}
+	b.add(final)
+	if len(rec.Moves) == 0 || rec.Moves[0] == game.ResignMove {
+		return nil
+	}
+	if b.Openings == nil {
+		b.Openings = map[int]*seatOutcomes{}
+	}
+	sq := canonicalFirstSquare(rec.Moves[0].ToIndex())
+	if b.Openings[sq] == nil {
+		b.Openings[sq] = &seatOutcomes{}
+	}
+	b.Openings[sq].add(final)
+	return nil
+}
+
+// rateCI formats k out of n as a percentage with its 95% confidence
+// interval. The interval is Wilson's, which unlike the normal approximation
+// stays sound for rates near 0 or 1 and for few games.
+func rateCI(k, n int) string {
+	const z = 1.96
+	p, nf := float64(k)/float64(n), float64(n)
+	centre := (p + z*z/(2*nf)) / (1 + z*z/nf)
+	half := z / (1 + z*z/nf) * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf))
+	return fmt.Sprintf("%5.1f%% (%4.1f-%5.1f)", 100*p, 100*max(centre-half, 0), 100*min(centre+half, 1))
+}
+
+// Print writes the study as two tables: the rates of each seat, and the
+// results of each first square.
+func (b *BalanceStudy) Print(w io.Writer) {
+	fmt.Fprintf(w, "%d games\n\n", b.Games)
+	fmt.Fprintf(w, "%-4s %19s %19s\n", "Seat", "Win", "Eliminated")
+	for seat := range 3 {
+		fmt.Fprintf(w, "P%-3d %19s %19s\n", seat+1, rateCI(b.Wins[seat], b.Games), rateCI(b.Eliminated[seat], b.Games))
+	}
+	fmt.Fprintf(w, "%-4s %19s\n", "Draw", rateCI(b.Draws, b.Games))
+
+	squares := make([]int, 0, len(b.Openings))
+	for sq := range b.Openings {
+		squares = append(squares, sq)
+	}
+	sort.Slice(squares, func(i, j int) bool {
+		if ni, nj := b.Openings[squares[i]].Games, b.Openings[squares[j]].Games; ni != nj {
+			return ni > nj
+		}
+		return squares[i] < squares[j]
+	})
+	fmt.Fprintf(w, "\n%-5s %6s %19s %19s %19s %19s\n", "First", "Games", "P1 win", "P2 win", "P3 win", "Draw")
+	for _, sq := range squares {
+		o := b.Openings[sq]
+		fmt.Fprintf(w, "%-5s %6d %19s %19s %19s %19s\n", game.MoveFromIndex(sq), o.Games,
+			rateCI(o.Wins[0], o.Games), rateCI(o.Wins[1], o.Games), rateCI(o.Wins[2], o.Games), rateCI(o.Draws, o.Games))
+	}
+}
+
+// runBalance implements `squava balance`, which plays the engine against
+// itself in every seat to measure how fair the seats are.
+func runBalance(args []string) int {
+	fs := flag.NewFlagSet("balance", flag.ExitOnError)
+	games := fs.Int("games", 1000, "Games to play")
+	iterations := fs.Int("iterations", 800, "MCTS visits per move")
+	temperature := fs.Float64("temperature", 1, "Play the opening moves at random by visits^(1/temperature) (0 for the most visited)")
+	tempMoves := fs.Int("temp-moves", 8, "Moves of each game played with -temperature")
+	noise := fs.Float64("noise", 0.05, "Chance of playing a random good move instead of searching")
+	everyFirst := fs.Bool("every-first", false, "Open game i on the i-th of the 10 first squares that differ up to symmetry, in turn, instead of searching")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Games to play at the same time")
+	mb := fs.Int("hash", DefaultAnalyzerMB, "Megabytes of search graph per game played at the same time")
+	seed := fs.Int64("seed", 0, "Random seed of the games, each of which gets a stream of its own from it (0 for time-based)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava balance -games 10000 [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *games < 1 || *iterations < 1 || *concurrency < 1 || *mb < 1 ||
+		*temperature < 0 || *tempMoves < 0 || *noise < 0 || *noise > 1 {
+		fmt.Fprintln(os.Stderr, "-games, -iterations, -concurrency and -hash must be at least 1, -temperature and -temp-moves not negative, and -noise from 0 to 1")
+		return exitUsage
+	}
+	if (*temperature == 0 || *tempMoves == 0) && *noise == 0 {
+		// The searches alone would play much the same game every time, and
+		// the intervals would count it as many.
+		fmt.Fprintln(os.Stderr, "-temperature and -temp-moves, or -noise, must be above 0, so that the games differ")
+		return exitUsage
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Printf("Seed %d\n", *seed)
+	settings := SelfPlaySettings{Iterations: *iterations, Temperature: *temperature, TempMoves: *tempMoves, Noise: *noise}
+	firsts := FirstSquares()
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var study BalanceStudy
+	var failed error
+	played := 0
+	start := time.Now()
+	for range min(*concurrency, *games) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := NewAnalyzer(NodesForMB(*mb))
+			for i := range next {
+				s := settings
+				if *everyFirst {
+					s.Opening = []game.Move{game.MoveFromIndex(firsts[i%len(firsts)])}
+				}
+				rec := SelfPlayGame(a, NthStream(uint64(*seed), i), s)
+
+				mu.Lock()
+				if err := study.Add(rec); err != nil && failed == nil {
+					failed = fmt.Errorf("game %d: %v", i+1, err)
+				}
+				played++
+				fmt.Fprintf(os.Stderr, "\r%d of %d games; %.1f games/s", played, *games, float64(played)/time.Since(start).Seconds())
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < *games; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	fmt.Fprintln(os.Stderr)
+	if failed != nil {
+		fmt.Fprintln(os.Stderr, failed)
+		return exitError
+	}
+	study.Print(os.Stdout)
+	return 0
+}
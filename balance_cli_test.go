@@ -0,0 +1,55 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestBalanceStudy(t *testing.T) {
+	if sq := FirstSquares(); len(sq) != 10 || sq[0] != 0 || sq[9] != 27 {
+		t.Errorf("Expected the 10 squares from A1 to D4, got %v", sq)
+	}
+	var b BalanceStudy
+	for _, moves := range []string{
+		"A1 H8 H1 B1 G8 H2 C1 A5 H3", // X and Z make 3 in a row: O wins
+		"D4 E5 C3 resign resign",     // X and O resign: Z wins
+		"E5 D4 resign resign",        // Opens on D4 turned; Z and X resign
+	} {
+		rec, _ := game.ReadGameRecord(strings.NewReader(moves))
+		if err := b.Add(rec); err != nil {
+			t.Fatalf("%s: %v", moves, err)
+		}
+	}
+	rec, _ := game.ReadGameRecord(strings.NewReader("D4 E5"))
+	if err := b.Add(rec); err == nil {
+		t.Error("Expected an unfinished game to be refused")
+	}
+	if b.Games != 3 || b.Wins != [3]int{0, 2, 1} || b.Eliminated != [3]int{3, 1, 2} || b.Draws != 0 {
+		t.Errorf("Unexpected outcomes %+v", b.seatOutcomes)
+	}
+	if d4 := b.Openings[27]; d4 == nil || d4.Games != 2 || d4.Wins[1] != 1 || d4.Wins[2] != 1 || b.Openings[0].Wins[1] != 1 {
+		t.Errorf("Unexpected first squares %v", b.Openings)
+	}
+	if got := rateCI(0, 4); got != "  0.0% ( 0.0- 49.0)" {
+		t.Errorf("Unexpected interval %q", got)
+	}
+
+	// Forcing the opening plays it, and the game still follows the seed.
+	s := SelfPlaySettings{Iterations: 50, Opening: []game.Move{game.MoveFromIndex(9)}}
+	var r Rand
+	r.Seed(1)
+	if rec := SelfPlayGame(NewAnalyzer(1<<12), &r, s); rec.Moves[0] != game.MoveFromIndex(9) {
+		t.Errorf("Expected the game to open on B2, got %v", rec.Moves[0])
+	} else if err := b.Add(rec); err != nil {
+		t.Error(err)
+	}
+
+	// Games with no randomness would all be alike.
+	if code := runBalance([]string{"-games", "2", "-temperature", "0", "-noise", "0"}); code != exitUsage {
+		t.Errorf("Expected a study without randomness refused, got exit code %d", code)
+	}
+}
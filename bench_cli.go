@@ -0,0 +1,160 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"time"
+
+	"squava/game"
+	"squava/internal/kernels"
+)
+
+// --- Benchmark ---
+
+// benchPositions are the fixed starting points of the benchmark: the empty
+// board, an opening, and two busy middlegames.
+var benchPositions = []string{
+	"8/8/8/8/8/8/8/8 1 123",
+	"8/8/8/3ZO3/3XX3/2O5/8/8 3 123",
+	"O4XOO/O1OZ4/8/1Z1Z1Z2/O1OO4/ZX1XZ2Z/1X3X1X/2X1X3 3 123",
+	"1O1ZZOZ1/OZ1O4/Z1O5/1XXZ1XZZ/OXX1Z3/O1OXO2X/2X4Z/5OX1 2 23",
+}
+
+// benchSeed fixes the random numbers of every stage.
+const benchSeed = 641728870
+
+// BenchResult is the outcome of `squava bench`. Rates are per second.
+type BenchResult struct {
+	Playouts         float64 `json:"playouts_per_sec"`
+	WinsLosses       float64 `json:"winslosses_per_sec"`
+	SearchRollouts   float64 `json:"search_rollouts_per_sec"`
+	AllocsPerRollout float64 `json:"allocs_per_rollout"`
+	BytesPerRollout  float64 `json:"bytes_per_rollout"`
+	Score            float64 `json:"score"`
+	GOOS             string  `json:"goos"`
+	GOARCH           string  `json:"goarch"`
+	Kernels          string  `json:"kernels"` // SIMD kernel set, see SIMDKernels
+}
+
+// benchStage times f, which reports how many operations it did.
+func benchStage(f func() int) float64 {
+	start := time.Now()
+	n := f()
+	return float64(n) / time.Since(start).Seconds()
+}
+
+// RunBench runs the standard workload. scale multiplies the work of every
+// stage; 1 takes a few seconds.
+func RunBench(scale float64) (BenchResult, error) {
+	var positions []game.GameState
+	for _, p := range benchPositions {
+		gs, err := game.ParsePosition(p)
+		if err != nil {
+			return BenchResult{}, err
+		}
+		positions = append(positions, gs)
+	}
+	res := BenchResult{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH, Kernels: kernels.Name()}
+
+	// Random playouts to the end of the game.
+	mainRand.Seed(benchSeed)
+	playouts := int(200000 * scale)
+	res.Playouts = benchStage(func() int {
+		for i := 0; i < playouts; i++ {
+			gs := positions[i%len(positions)]
+			RunSimulation(&gs, &mainRand)
+		}
+		return playouts
+	})
+
+	// The threat kernel on fixed pseudo-random boards.
+	mainRand.Seed(benchSeed)
+	var boards [256][2]game.Bitboard
+	for i := range boards {
+		mine, theirs := game.Bitboard(xrand()&xrand()), game.Bitboard(xrand()&xrand())
+		boards[i] = [2]game.Bitboard{mine &^ theirs, ^(mine | theirs)}
+	}
+	calls := int(20000000 * scale)
+	var sink game.Bitboard
+	res.WinsLosses = benchStage(func() int {
+		for i := 0; i < calls; i++ {
+			b := &boards[i&255]
+			w, l := game.GetWinsAndLosses(b[0], b[1])
+			sink ^= w ^ l
+		}
+		return calls
+	})
+	benchSink = sink
+
+	// Full searches from a cleared table, counting allocations.
+	mainRand.Seed(benchSeed)
+	iterations := int(25000 * scale)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	rollouts := 0
+	res.SearchRollouts = benchStage(func() int {
+		for _, gs := range positions {
+			tt.Clear()
+			p := NewMCTSPlayer("Bench", "B", gs.PlayerID, iterations)
+			_, n := p.Search(gs)
+			rollouts += n
+		}
+		return rollouts
+	})
+	runtime.ReadMemStats(&after)
+	tt.Clear()
+	res.AllocsPerRollout = float64(after.Mallocs-before.Mallocs) / float64(rollouts)
+	res.BytesPerRollout = float64(after.TotalAlloc-before.TotalAlloc) / float64(rollouts)
+
+	// The score is the geometric mean of the three rates in thousands per
+	// second, so a change in any stage moves it by the same factor.
+	res.Score = math.Cbrt(res.Playouts / 1e3 * res.WinsLosses / 1e3 * res.SearchRollouts / 1e3)
+	return res, nil
+}
+
+// runBench implements `squava bench`, a fixed workload for comparing
+// performance across commits and machines.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	scale := fs.Float64("scale", 1, "Multiply the work of every stage by this")
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	profile := addProfileFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava bench [-scale X] [-json] [profiling flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *scale <= 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	stopProfiles, err := profile.start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer stopProfiles()
+	res, err := RunBench(*scale)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(res)
+		return 0
+	}
+	fmt.Printf("Platform:            %s/%s (%s kernels)\n", res.GOOS, res.GOARCH, res.Kernels)
+	fmt.Printf("Playouts:            %12.0f /s\n", res.Playouts)
+	fmt.Printf("GetWinsAndLosses:    %12.0f /s\n", res.WinsLosses)
+	fmt.Printf("Search rollouts:     %12.0f /s\n", res.SearchRollouts)
+	fmt.Printf("Allocations:         %12.2f per rollout (%.0f bytes)\n", res.AllocsPerRollout, res.BytesPerRollout)
+	fmt.Printf("Score:               %12.0f\n", res.Score)
+	return 0
+}
@@ -0,0 +1,20 @@
+//go:build !wasm
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRunBench(t *testing.T) {
+	res, err := RunBench(0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, rate := range map[string]float64{"playouts": res.Playouts, "winslosses": res.WinsLosses, "rollouts": res.SearchRollouts, "score": res.Score} {
+		if !(rate > 0) || math.IsInf(rate, 0) {
+			t.Errorf("%s = %v, want a positive rate", name, rate)
+		}
+	}
+}
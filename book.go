@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+
+	"squava/game"
+)
+
+// --- Opening book ---
+
+// An opening book holds, for positions seen in a collection of games, the
+// moves played from them with their results. Positions are keyed by their
+// canonical hash (see SymHashes.Canonical) and moves are stored in the
+// canonical orientation, so a position and its rotations and reflections
+// share their entries.
+//
+// A book file (.sqb) is a header followed by the entries sorted by key and
+// move, all little-endian, so that a probe is a binary search of the file
+// mapped into memory:
+//
+//	magic "SQBK" | version uint16 | entry size uint16 | entries uint64
+//	key uint64 | move uint8 | reserved uint8 | weight uint16 | games uint32 | wins uint32 | draws uint32
+//
+// Readers step over entries by the size in the header and read the fields
+// they know, so a later version may add fields at the end of an entry.
+const (
+	bookMagic      = "SQBK"
+	bookHeaderSize = 16
+	bookEntrySize  = 24
+)
+
+// BookMove is a book move and the results of the games that played it, for
+// the player who made it.
+type BookMove struct {
+	Move   game.Move
+	Weight int // How often to play the move relative to the others
+	Games  int
+	Wins   int
+	Draws  int
+}
+
+// Score is the player's mean score with the move, a win counting 1 and a
+// draw 1/3.
+func (bm *BookMove) Score() float64 {
+	if bm.Games == 0 {
+		return 0
+	}
+	return (float64(bm.Wins) + float64(bm.Draws)/3) / float64(bm.Games)
+}
+
+// bookWeight weighs a move by the points it scored, in thirds, so that a
+// move that never scored is never played.
+func bookWeight(wins, draws int) int {
+	return min(3*wins+draws, 0xffff)
+}
+
+// Book is an opening book read from a file or built in memory.
+type Book struct {
+	entries []byte
+	stride  int
+	n       int
+	close   func() error
+}
+
+// ParseBook reads a book from the bytes of a book file, which it keeps.
+func ParseBook(data []byte) (*Book, error) {
+	if len(data) < bookHeaderSize || string(data[:4]) != bookMagic {
+		return nil, errors.New("not a book file")
+	}
+	version := int(binary.LittleEndian.Uint16(data[4:]))
+	if err := checkVersion("book", version, BookVersion); err != nil {
+		return nil, err
+	}
+	stride := int(binary.LittleEndian.Uint16(data[6:]))
+	n := binary.LittleEndian.Uint64(data[8:])
+	if stride < bookEntrySize || n > uint64(len(data)-bookHeaderSize)/uint64(stride) {
+		return nil, errors.New("book file is truncated")
+	}
+	return &Book{entries: data[bookHeaderSize:], stride: stride, n: int(n)}, nil
+}
+
+// OpenBook maps the book file at path into memory.
+func OpenBook(path string) (*Book, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseBook(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	b.close = unmap
+	return b, nil
+}
+
+// Close releases the book's file.
+func (b *Book) Close() error {
+	if b.close == nil {
+		return nil
+	}
+	err := b.close()
+	b.close, b.entries, b.n = nil, nil, 0
+	return err
+}
+
+// Len returns the number of entries: positions and moves.
+func (b *Book) Len() int {
+	return b.n
+}
+
+func (b *Book) key(i int) uint64 {
+	return binary.LittleEndian.Uint64(b.entries[i*b.stride:])
+}
+
+// entry returns entry i, with its move in the canonical orientation.
+func (b *Book) entry(i int) (uint64, BookMove) {
+	e := b.entries[i*b.stride:]
+	return binary.LittleEndian.Uint64(e), BookMove{
+		Move:   game.MoveFromIndex(int(e[8])),
+		Weight: int(binary.LittleEndian.Uint16(e[10:])),
+		Games:  int(binary.LittleEndian.Uint32(e[12:])),
+		Wins:   int(binary.LittleEndian.Uint32(e[16:])),
+		Draws:  int(binary.LittleEndian.Uint32(e[20:])),
+	}
+}
+
+// Probe returns the book moves of gs, heaviest first, or nil if gs is not
+// in the book.
+func (b *Book) Probe(gs *game.GameState) []BookMove {
+	h := gs.SymHashes()
+	key, s := h.Canonical()
+	inv := game.InverseSymmetry(s)
+	var moves []BookMove
+	for i := sort.Search(b.n, func(i int) bool { return b.key(i) >= key }); i < b.n && b.key(i) == key; i++ {
+		_, bm := b.entry(i)
+		bm.Move = game.MoveFromIndex(game.TransformSquare(bm.Move.ToIndex(), inv))
+		moves = append(moves, bm)
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].Weight > moves[j].Weight })
+	return moves
+}
+
+// Replies returns the legal moves of gs the book approves of: its moves
+// that scored, and in a symmetric position the squares equivalent to them.
+func (b *Book) Replies(gs *game.GameState) game.Bitboard {
+	h := gs.SymHashes()
+	var canonical game.Bitboard
+	for _, bm := range b.Probe(gs) {
+		if bm.Weight > 0 {
+			canonical |= game.Bitboard(1) << uint(h.CanonicalSquare(bm.Move.ToIndex()))
+		}
+	}
+	var replies game.Bitboard
+	for bb := gs.LegalMoves(); bb != 0 && canonical != 0; bb &= bb - 1 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		if canonical&(game.Bitboard(1)<<uint(h.CanonicalSquare(idx))) != 0 {
+			replies |= game.Bitboard(1) << uint(idx)
+		}
+	}
+	return replies
+}
+
+// Pick chooses a book move for gs at random, in proportion to the weights,
+// and reports whether there was one. Moves that are not legal in gs, as a
+// hash collision may give, are left out.
+func (b *Book) Pick(gs *game.GameState, r *Rand) (BookMove, bool) {
+	legal := gs.LegalMoves()
+	var moves []BookMove
+	total := 0
+	for _, bm := range b.Probe(gs) {
+		if bm.Weight > 0 && legal&(game.Bitboard(1)<<uint(bm.Move.ToIndex())) != 0 {
+			moves = append(moves, bm)
+			total += bm.Weight
+		}
+	}
+	if total == 0 {
+		return BookMove{}, false
+	}
+	hi, _ := bits.Mul64(r.Uint64(), uint64(total))
+	pick := int(hi)
+	for _, bm := range moves {
+		if pick < bm.Weight {
+			return bm, true
+		}
+		pick -= bm.Weight
+	}
+	return moves[len(moves)-1], true
+}
+
+// bookKey is a position, by canonical hash, and a move in its canonical
+// orientation.
+type bookKey struct {
+	hash uint64
+	move uint8
+}
+
+// BookBuilder gathers the statistics of a book from games and other books.
+type BookBuilder struct {
+	stats map[bookKey]*BookMove
+}
+
+func NewBookBuilder() *BookBuilder {
+	return &BookBuilder{stats: map[bookKey]*BookMove{}}
+}
+
+// add adds the results of bm to the move of key.
+func (bb *BookBuilder) add(key bookKey, bm *BookMove) {
+	st := bb.stats[key]
+	if st == nil {
+		st = &BookMove{Move: game.MoveFromIndex(int(key.move))}
+		bb.stats[key] = st
+	}
+	st.Games += bm.Games
+	st.Wins += bm.Wins
+	st.Draws += bm.Draws
+}
+
+// AddGame counts the first plies moves of a finished game, checking them
+// against the rules. Unfinished games are left out and reported as not
+// added.
+func (bb *BookBuilder) AddGame(rec *game.GameRecord, plies int) (bool, error) {
+	positions, err := rec.Positions()
+	if err != nil {
+		return false, err
+	}
+	end := positions[len(positions)-1]
+	if !end.Terminal {
+		return false, nil
+	}
+	for i, m := range rec.Moves[:min(plies, len(rec.Moves))] {
+		if m == game.ResignMove {
+			break
+		}
+		gs := &positions[i]
+		bm := BookMove{Games: 1}
+		switch end.WinnerID {
+		case gs.PlayerID:
+			bm.Wins = 1
+		case -1:
+			bm.Draws = 1
+		}
+		h := gs.SymHashes()
+		hash, _ := h.Canonical()
+		bb.add(bookKey{hash, uint8(h.CanonicalSquare(m.ToIndex()))}, &bm)
+	}
+	return true, nil
+}
+
+// AddBook adds the statistics of every entry of b.
+func (bb *BookBuilder) AddBook(b *Book) {
+	for i := 0; i < b.n; i++ {
+		key, bm := b.entry(i)
+		bb.add(bookKey{key, uint8(bm.Move.ToIndex())}, &bm)
+	}
+}
+
+// Write writes the book file of the moves played in at least minGames
+// games, weighing each by the points it scored.
+func (bb *BookBuilder) Write(w io.Writer, minGames int) error {
+	keys := make([]bookKey, 0, len(bb.stats))
+	for k, st := range bb.stats {
+		if st.Games >= minGames {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].hash != keys[j].hash {
+			return keys[i].hash < keys[j].hash
+		}
+		return keys[i].move < keys[j].move
+	})
+	var buf bytes.Buffer
+	buf.WriteString(bookMagic)
+	buf.Write(binary.LittleEndian.AppendUint16(nil, BookVersion))
+	buf.Write(binary.LittleEndian.AppendUint16(nil, bookEntrySize))
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(keys))))
+	e := make([]byte, bookEntrySize)
+	for _, k := range keys {
+		st := bb.stats[k]
+		binary.LittleEndian.PutUint64(e, k.hash)
+		e[8], e[9] = k.move, 0
+		binary.LittleEndian.PutUint16(e[10:], uint16(bookWeight(st.Wins, st.Draws)))
+		binary.LittleEndian.PutUint32(e[12:], uint32(st.Games))
+		binary.LittleEndian.PutUint32(e[16:], uint32(st.Wins))
+		binary.LittleEndian.PutUint32(e[20:], uint32(st.Draws))
+		buf.Write(e)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Book returns the book of the moves played in at least minGames games.
+func (bb *BookBuilder) Book(minGames int) *Book {
+	var buf bytes.Buffer
+	bb.Write(&buf, minGames)
+	b, _ := ParseBook(buf.Bytes())
+	return b
+}
@@ -0,0 +1,347 @@
+//go:build !wasm
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"strings"
+	"time"
+
+	"squava/game"
+)
+
+// bookCommands are run as `squava book <name> [args]`.
+var bookCommands = map[string]func(args []string) int{
+	"build":   runBookBuild,
+	"merge":   runBookMerge,
+	"inspect": runBookInspect,
+	"train":   runBookTrain,
+}
+
+// runBook implements `squava book`, which makes and reads opening books.
+func runBook(args []string) int {
+	if len(args) > 0 {
+		if cmd, ok := bookCommands[args[0]]; ok {
+			return cmd(args[1:])
+		}
+	}
+	fmt.Fprintln(os.Stderr, "usage: squava book build|merge|inspect|train [flags]")
+	fmt.Fprintln(os.Stderr, "Run a command with -h for its flags.")
+	return exitUsage
+}
+
+func newBookFlags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet("book "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava book "+name+" "+usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// writeBook writes the book of bb to path, replacing the file only once
+// fully written.
+func writeBook(bb *BookBuilder, path string, minGames int) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := bb.Write(f, minGames); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func runBookBuild(args []string) int {
+	fs := newBookFlags("build", "-o book.sqb [-db file] [game.sqv|dir...]")
+	out := fs.String("o", "", "Book file to write")
+	dbPath := fs.String("db", "", "Also take the games of this game database")
+	plies := fs.Int("plies", 16, "Moves of each game to put in the book")
+	minGames := fs.Int("min-games", 1, "Leave out moves played in fewer games than this")
+	fs.Parse(args)
+	if *out == "" || fs.NArg() == 0 && *dbPath == "" || *plies < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	files, err := recordPaths(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	bb := NewBookBuilder()
+	added, unfinished, skipped := 0, 0, 0
+	addGame := func(rec *game.GameRecord, source string, err error) {
+		ok := false
+		if err == nil {
+			ok, err = bb.AddGame(rec, *plies)
+		}
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v; skipped\n", source, err)
+			skipped++
+		case ok:
+			added++
+		default:
+			unfinished++
+		}
+	}
+	for _, path := range files {
+		recs, names, err := readRecordFile(path)
+		if err != nil {
+			addGame(nil, path, err)
+			continue
+		}
+		for i, rec := range recs {
+			addGame(rec, names[i], nil)
+		}
+	}
+	if *dbPath != "" {
+		db, err := game.OpenGameDB(*dbPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		for _, g := range db.Select(game.GameFilter{}) {
+			rec, err := g.ParseRecord()
+			addGame(rec, fmt.Sprintf("%s: game %d", *dbPath, g.ID), err)
+		}
+	}
+	if err := writeBook(bb, *out, *minGames); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write %s: %v\n", *out, err)
+		return exitError
+	}
+	fmt.Printf("Booked %d games (%d unfinished, %d skipped) into %s\n", added, unfinished, skipped, *out)
+	return 0
+}
+
+func runBookMerge(args []string) int {
+	fs := newBookFlags("merge", "-o book.sqb book.sqb...")
+	out := fs.String("o", "", "Book file to write")
+	minGames := fs.Int("min-games", 1, "Leave out moves played in fewer games than this, in all books together")
+	fs.Parse(args)
+	if *out == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	bb := NewBookBuilder()
+	for _, path := range fs.Args() {
+		b, err := OpenBook(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		bb.AddBook(b)
+		b.Close()
+	}
+	if err := writeBook(bb, *out, *minGames); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write %s: %v\n", *out, err)
+		return exitError
+	}
+	fmt.Printf("Merged %d books into %s\n", fs.NArg(), *out)
+	return 0
+}
+
+func runBookInspect(args []string) int {
+	fs := newBookFlags("inspect", "[-moves \"D4 E5\" | -position pos] [-plain] book.sqb")
+	movesFlag := fs.String("moves", "", "Show the book moves after these moves (default: the empty board)")
+	position := fs.String("position", "", "Show the book moves of this position, in the notation of test suites")
+	plain := fs.Bool("plain", false, "Plain ASCII board without colors or unicode stones")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *movesFlag != "" && *position != "" {
+		fmt.Fprintln(os.Stderr, "-moves and -position cannot be used together")
+		return exitUsage
+	}
+	rec, err := game.ReadGameRecord(strings.NewReader(*movesFlag))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-moves: %v\n", err)
+		return exitUsage
+	}
+	g, err := loadRecord(rec, *plain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-moves: %v\n", err)
+		return exitUsage
+	}
+	if *position != "" {
+		if g.gs, err = game.ParsePosition(*position); err != nil {
+			fmt.Fprintf(os.Stderr, "-position: %v\n", err)
+			return exitUsage
+		}
+	}
+	b, err := OpenBook(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer b.Close()
+
+	g.PrintBoard()
+	moves := b.Probe(&g.gs)
+	printPosition(g.gs)
+	fmt.Printf("%d book entries, %d for this position\n", b.Len(), len(moves))
+	if len(moves) == 0 {
+		return 0
+	}
+	fmt.Printf("%-6s %6s %6s %7s %7s %7s\n", "Move", "Weight", "Games", "Win", "Draw", "Score")
+	for _, m := range moves {
+		fmt.Printf("%-6s %6d %6d %7s %7s %6.1f%%\n", m.Move, m.Weight, m.Games,
+			percent(m.Wins, m.Games), percent(m.Draws, m.Games), m.Score()*100)
+	}
+	return 0
+}
+
+// bookMove returns the entry of the book moves of gs that move is, or is
+// equivalent to in a symmetric position.
+func bookMove(b *Book, gs *game.GameState, move game.Move) (BookMove, bool) {
+	h := gs.SymHashes()
+	for _, bm := range b.Probe(gs) {
+		if h.CanonicalSquare(bm.Move.ToIndex()) == h.CanonicalSquare(move.ToIndex()) {
+			return bm, true
+		}
+	}
+	return BookMove{}, false
+}
+
+// drillOpening plays a book line on g until the book runs out or the game
+// ends. At each turn of the player in seat me, they are asked for a move
+// and it is checked against the book's replies; the other seats play book
+// moves at random by weight. A move the book does not approve of is
+// replaced by the book's favorite, so that the drill stays in the book. It
+// returns how many moves were asked for and how many of them were book
+// moves.
+func drillOpening(g *SquavaGame, b *Book, me int) (asked, recalled int, err error) {
+	for !g.gs.Terminal {
+		replies := b.Replies(&g.gs)
+		if replies == 0 {
+			break
+		}
+		p := g.GetPlayer(g.gs.PlayerID)
+		if g.gs.PlayerID != me {
+			bm, ok := b.Pick(&g.gs, &mainRand)
+			if !ok {
+				break
+			}
+			fmt.Printf("%s (%s) plays %s from the book\n", p.Name(), p.Symbol(), bm.Move)
+			g.play(bm.Move)
+			continue
+		}
+		g.PrintBoard()
+		if legal := g.gs.LegalMoves(); bits.OnesCount64(uint64(legal)) == 1 {
+			move := game.MoveFromIndex(bits.TrailingZeros64(uint64(legal)))
+			fmt.Printf("%s (%s) must play %s\n", p.Name(), p.Symbol(), move)
+			g.play(move)
+			continue
+		}
+		move, err := readPuzzleMove(g.gs)
+		if err != nil {
+			return asked, recalled, err
+		}
+		asked++
+		favorite := b.Probe(&g.gs)[0]
+		if move != game.ResignMove && replies&(game.Bitboard(1)<<uint(move.ToIndex())) != 0 {
+			recalled++
+			bm, _ := bookMove(b, &g.gs, move)
+			fmt.Printf("Book move: played in %d games, scoring %.1f%%", bm.Games, bm.Score()*100)
+			if bm.Move == favorite.Move {
+				fmt.Print(", the book's favorite")
+			}
+			fmt.Println(".")
+		} else {
+			if move != game.ResignMove {
+				fmt.Printf("%s is not a book move here. ", move)
+			}
+			fmt.Printf("Book moves: %s; playing %s.\n", formatSquares(replies), favorite.Move)
+			move = favorite.Move
+		}
+		g.play(move)
+	}
+	return asked, recalled, nil
+}
+
+// runBookTrain implements `squava book train`, which drills the player on
+// the book's replies in the opening and plays on against the engines once
+// the book runs out.
+func runBookTrain(args []string) int {
+	fs := newBookFlags("train", "[-seat N] [-n lines] [-iterations N] [-play=false] [-plain] book.sqb")
+	seat := fs.Int("seat", 0, "Seat to play, 1 to 3 (0 for a random seat each line)")
+	lines := fs.Int("n", 5, "Lines to drill")
+	iterations := fs.Int("iterations", 1000, "MCTS iterations of the engines once the book runs out")
+	play := fs.Bool("play", true, "Play each line on to the end of the game against the engines once the book runs out")
+	plain := fs.Bool("plain", false, "Plain ASCII board without colors or unicode stones")
+	seed := fs.Int64("seed", 0, "Random seed for the book's moves (0 for time-based)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *seat < 0 || *seat > 3 || *lines < 1 || *iterations < 1 {
+		fmt.Fprintln(os.Stderr, "-seat must be from 0 to 3, and -n and -iterations at least 1")
+		return exitUsage
+	}
+	b, err := OpenBook(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer b.Close()
+	if empty := game.NewGameState(game.Board{}, 0, 0b111); b.Replies(&empty) == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no moves for the empty board\n", fs.Arg(0))
+		return exitError
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano() | 1
+	}
+	mainRand.Seed(uint64(*seed))
+
+	asked, recalled := 0, 0
+	for line := 1; line <= *lines; line++ {
+		me := *seat - 1
+		if me < 0 {
+			me = int(mainRand.Uint64() % 3)
+		}
+		g := NewSquavaGame()
+		g.SetBoardStyle(DefaultBoardStyle(*plain))
+		g.SetIterations(*iterations)
+		for i := 0; i < 3; i++ {
+			if i == me {
+				g.AddPlayer(NewHumanPlayer(tr("player", i+1), asciiStones[i], i))
+			} else {
+				g.AddPlayer(NewMCTSPlayer(tr("player", i+1), asciiStones[i], i, *iterations))
+			}
+		}
+		g.start()
+		fmt.Printf("\nLine %d: you play %s (%s)\n", line, g.GetPlayer(me).Name(), asciiStones[me])
+		a, r, err := drillOpening(g, b, me)
+		asked += a
+		recalled += r
+		if errors.Is(err, errQuit) {
+			g.Close()
+			break
+		}
+		fmt.Printf("Out of book after %d moves; you found %d of %d book moves.\n", len(g.moves), r, a)
+		if *play && !g.gs.Terminal {
+			fmt.Println("Playing on against the engines.")
+			g.Run()
+		} else if g.gs.Terminal {
+			fmt.Println(tr("result", g.resultText()))
+		}
+		g.Close()
+	}
+	if asked > 0 {
+		fmt.Printf("\nRecall: %d of %d book moves (%.0f%%)\n", recalled, asked, 100*float64(recalled)/float64(asked))
+	}
+	return 0
+}
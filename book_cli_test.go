@@ -0,0 +1,60 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestDrillOpening(t *testing.T) {
+	rec, err := game.ReadGameRecord(strings.NewReader("C8 G1 H2 H7 G5 C2 E4 H5 F8 A8 D8 G7 E6 B3 C7 F5 G6 D7 H4 G3 A5 G4 D1 A7 B7 E8 F6 E7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A book of the game's first 6 moves, each of which drew a game, so
+	// that all of them are worth playing.
+	bb := NewBookBuilder()
+	positions, _ := rec.Positions()
+	for i, m := range rec.Moves[:6] {
+		h := positions[i].SymHashes()
+		hash, _ := h.Canonical()
+		bb.add(bookKey{hash, uint8(h.CanonicalSquare(m.ToIndex()))}, &BookMove{Games: 1, Draws: 1})
+	}
+	var buf bytes.Buffer
+	if err := bb.Write(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseBook(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The empty board is symmetric, so every image of C8 is a book reply.
+	start := game.NewGameState(game.Board{}, 0, 0x07)
+	if replies := b.Replies(&start); formatSquares(replies) != "C1, F1, A3, H3, A6, H6, C8, F8" {
+		t.Errorf("Unexpected book replies [%s]", formatSquares(replies))
+	}
+
+	// F1 is C8 turned around; A1 is off the book's line and is replaced.
+	defer func(saved *bufio.Reader) { stdin = saved }(stdin)
+	stdin = bufio.NewReader(strings.NewReader("F1\nA1\n"))
+	mainRand.Seed(3)
+	g, _ := loadRecord(&game.GameRecord{}, true)
+	asked, recalled, err := drillOpening(g, b, 0)
+	if err != nil || asked != 2 || recalled != 1 {
+		t.Fatalf("Expected 1 of 2 book moves found, got %d of %d, %v", recalled, asked, err)
+	}
+	if len(g.moves) != 6 || g.moves[0].String() != "F1" || g.moves[3].String() == "A1" {
+		t.Errorf("Expected the drill to follow the book for 6 moves, got %v", g.moves)
+	}
+	for i, m := range g.moves {
+		if _, ok := bookMove(b, &g.history[i], m); !ok {
+			t.Errorf("Move %d, %s, is not in the book", i+1, m)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"squava/game"
+)
+
+// --- Position classification ---
+
+// Classification is what the exact solver proves about a position, looking
+// Depth moves ahead for each player: who can force a win and in how few of
+// their moves, the squares the player to move is forced to block on, and
+// the moves that lose by force.
+//
+// In the EPD-like format (see ParseEPD) of test suites it is written as
+// operations that `squava suite -verify` checks against the solver:
+//
+//	win P N;     player P (1-3) forces a win within N of its moves, not fewer
+//	bm S...;     with win for the player to move: exactly its winning moves
+//	block S...;  the player to move must block the next player's 4-in-a-row
+//	am S...;     with depth N: exactly the moves that lose by force
+//	depth N;     the depth of am, in moves of the other players
+type Classification struct {
+	Depth  int
+	Winner int           // The player who can force a win, or -1
+	WinIn  int           // The fewest of the winner's moves it takes
+	Best   game.Bitboard // The winning moves of the player to move, if it is the winner
+	Block  game.Bitboard // The squares the player to move must block on, or 0
+	Losing game.Bitboard // The moves of the player to move that lose by force
+}
+
+// Classify solves gs to the given depth.
+func Classify(gs game.GameState, depth int) Classification {
+	c := Classification{Depth: depth, Winner: -1}
+	if gs.Terminal {
+		return c
+	}
+	for n := 1; n <= depth && c.Winner < 0; n++ {
+		for _, id := range gs.ActiveIDs() {
+			if CanForceWin(&gs, id, n) {
+				c.Winner, c.WinIn = id, n
+				break
+			}
+		}
+	}
+	if c.Winner == gs.PlayerID {
+		c.Best = WinningMoves(gs, c.WinIn)
+	} else {
+		c.Losing = LosingMoves(gs, depth)
+	}
+	if gs.Wins[gs.PlayerID] == 0 {
+		c.Block = gs.ForcedMoves()
+	}
+	return c
+}
+
+// Ops returns the operations that state c about gs. Losing moves are left
+// out when every legal move loses, as there is nothing to avoid.
+func (c Classification) Ops(gs game.GameState) []game.EPDOp {
+	var ops []game.EPDOp
+	if c.Winner >= 0 {
+		ops = append(ops, game.EPDOp{Name: "win", Args: []string{strconv.Itoa(c.Winner + 1), strconv.Itoa(c.WinIn)}})
+	}
+	if c.Best != 0 {
+		ops = append(ops, game.EPDOp{Name: "bm", Args: squareArgs(c.Best)})
+	}
+	if c.Block != 0 {
+		ops = append(ops, game.EPDOp{Name: "block", Args: squareArgs(c.Block)})
+	}
+	if c.Losing != 0 && c.Losing != gs.LegalMoves() {
+		ops = append(ops, game.EPDOp{Name: "am", Args: squareArgs(c.Losing)}, game.EPDOp{Name: "depth", Args: []string{strconv.Itoa(c.Depth)}})
+	}
+	return ops
+}
+
+// VerifyClassification checks the classification operations among ops
+// against the exact solver, and returns the first that does not hold. bm is
+// checked only along with a win for the player to move, and am only with a
+// depth; other operations are left alone.
+func VerifyClassification(gs game.GameState, ops []game.EPDOp) error {
+	var (
+		win, block, best, avoid []string
+		depth                   int
+	)
+	for _, op := range ops {
+		switch op.Name {
+		case "win":
+			win = op.Args
+		case "block":
+			block = op.Args
+		case "bm":
+			best = op.Args
+		case "am":
+			avoid = op.Args
+		case "depth":
+			if len(op.Args) != 1 {
+				return fmt.Errorf("depth takes one argument")
+			}
+			var err error
+			if depth, err = strconv.Atoi(op.Args[0]); err != nil || depth < 1 {
+				return fmt.Errorf("bad depth %q", op.Args[0])
+			}
+		}
+	}
+
+	if win != nil {
+		if len(win) != 2 {
+			return fmt.Errorf("win takes a player and a number of moves")
+		}
+		p, err := strconv.Atoi(win[0])
+		if err != nil || p < 1 || p > 3 {
+			return fmt.Errorf("bad player %q", win[0])
+		}
+		n, err := strconv.Atoi(win[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad number of moves %q", win[1])
+		}
+		c := Classify(gs, n)
+		switch {
+		case c.Winner != p-1 && c.Winner >= 0:
+			return fmt.Errorf("win %d %d: player %d forces a win in %d", p, n, c.Winner+1, c.WinIn)
+		case c.Winner < 0:
+			return fmt.Errorf("win %d %d: nobody forces a win in %d", p, n, n)
+		case c.WinIn != n:
+			return fmt.Errorf("win %d %d: player %d forces a win in %d already", p, n, p, c.WinIn)
+		}
+		if best != nil && p-1 == gs.PlayerID {
+			if err := checkSquares("bm", best, c.Best); err != nil {
+				return err
+			}
+		}
+	}
+	if block != nil {
+		forced := game.Bitboard(0)
+		if gs.Wins[gs.PlayerID] == 0 {
+			forced = gs.ForcedMoves()
+		}
+		if err := checkSquares("block", block, forced); err != nil {
+			return err
+		}
+	}
+	if avoid != nil && depth > 0 {
+		if err := checkSquares("am", avoid, LosingMoves(gs, depth)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSquares checks that the squares args of operation op are want.
+func checkSquares(op string, args []string, want game.Bitboard) error {
+	var got game.Bitboard
+	for _, a := range args {
+		m, err := game.ParseMove(a)
+		if err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+		got |= game.Bitboard(1) << uint(m.ToIndex())
+	}
+	if got != want {
+		return fmt.Errorf("%s is %v, the solver finds %v", op, squareArgs(got), squareArgs(want))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math/bits"
+
+	"squava/game"
+)
+
+// --- Coaching ---
+
+// CoachWarning returns why a coach would stop the player to move from
+// playing move in gs, or "" if the move is fine as far as the exact solver
+// sees within depth of the players' moves: the move makes a 3-in-a-row,
+// passes up a forced win, or loses by force when another move does not.
+// Wins in one move are forced by the rules and need no warning.
+func CoachWarning(gs game.GameState, move game.Move, depth int) string {
+	id := gs.PlayerID
+	mask := game.Bitboard(1) << uint(move.ToIndex())
+	if gs.Terminal || depth < 1 || gs.Wins[id] != 0 || bits.OnesCount64(uint64(gs.LegalMoves())) < 2 {
+		return ""
+	}
+	safe := gs.LegalMoves() &^ LosingMoves(gs, depth)
+	if gs.Loses[id]&mask != 0 {
+		if safe == 0 {
+			return ""
+		}
+		return tr("coach.eliminates", move, safeSquares(safe))
+	}
+	if depth > 1 {
+		if wins := WinningMoves(gs, depth); wins != 0 && wins&mask == 0 {
+			return tr("coach.misses", move, coachSquares(wins))
+		}
+	}
+	if safe != 0 && safe&mask == 0 {
+		return tr("coach.loses", move, safeSquares(safe))
+	}
+	return ""
+}
+
+// safeSquares names at most 3 of the squares of safe as the ones to play
+// instead.
+func safeSquares(safe game.Bitboard) string {
+	if bits.OnesCount64(uint64(safe)) > 1 {
+		return tr("coach.safe.many", coachSquares(safe))
+	}
+	return tr("coach.safe", coachSquares(safe))
+}
+
+// coachSquares lists at most 3 squares of bb, as firstSquares does, in the
+// player's language.
+func coachSquares(bb game.Bitboard) string {
+	first, rest := splitSquares(bb, 3)
+	if rest != 0 {
+		return tr("squares.more", slashSquares(first))
+	}
+	return slashSquares(first)
+}
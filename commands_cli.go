@@ -0,0 +1,163 @@
+//go:build !wasm
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"squava/game"
+)
+
+// gameAction is a request from a human command that the game loop must carry
+// out after GetMove returns.
+type gameAction int
+
+const (
+	actionNone gameAction = iota
+	actionUndo
+	actionResign
+)
+
+// --- In-game command shell ---
+type shellCommand struct {
+	name  string
+	usage string
+	help  string // Message key of the description
+	run   func(g *SquavaGame, args []string) gameAction
+}
+
+var shellCommands []shellCommand
+
+func init() {
+	shellCommands = []shellCommand{
+		{"hint", "hint", "help.hint", cmdHint},
+		{"undo", "undo", "help.undo", cmdUndo},
+		{"board", "board", "help.board", cmdBoard},
+		{"threats", "threats", "help.threats", cmdThreats},
+		{"save", "save <file>", "help.save", cmdSave},
+		{"history", "history", "help.history", cmdHistory},
+		{"kifu", "kifu", "help.kifu", cmdKifu},
+		{"resign", "resign", "help.resign", cmdResign},
+		{"help", "help", "help.help", cmdHelp},
+	}
+}
+
+// dispatch runs line as a command if its first word names one. It reports
+// whether the line was a command and what the game loop should do next.
+func (g *SquavaGame) dispatch(line string) (bool, gameAction) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, actionNone
+	}
+	name := strings.ToLower(fields[0])
+	for _, cmd := range shellCommands {
+		if cmd.name == name {
+			return true, cmd.run(g, fields[1:])
+		}
+	}
+	return false, actionNone
+}
+
+func cmdHelp(g *SquavaGame, args []string) gameAction {
+	fmt.Println(tr("help.header"))
+	for _, cmd := range shellCommands {
+		fmt.Printf("  %-12s %s\n", cmd.usage, tr(cmd.help))
+	}
+	return actionNone
+}
+
+func cmdBoard(g *SquavaGame, args []string) gameAction {
+	g.PrintBoard()
+	return actionNone
+}
+
+func cmdHistory(g *SquavaGame, args []string) gameAction {
+	if len(g.moves) == 0 {
+		fmt.Println("No moves played yet.")
+		return actionNone
+	}
+	for i, m := range g.moves {
+		p := g.GetPlayer(g.history[i].PlayerID)
+		fmt.Printf("%3d. %s (%s) %s\n", i+1, p.Name(), p.Symbol(), game.FormatRecordMove(m))
+	}
+	return actionNone
+}
+
+func cmdKifu(g *SquavaGame, args []string) gameAction {
+	if g.style.Accessible {
+		return cmdHistory(g, args)
+	}
+	for _, line := range g.renderKifu() {
+		fmt.Println(line)
+	}
+	return actionNone
+}
+
+func cmdThreats(g *SquavaGame, args []string) gameAction {
+	if g.style.Accessible {
+		lines := g.describeThreats(true)
+		if lines == nil {
+			lines = []string{"No player has a threat."}
+		}
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		return actionNone
+	}
+	for _, line := range g.renderThreats() {
+		fmt.Println(line)
+	}
+	for _, id := range g.gs.ActiveIDs() {
+		p := g.GetPlayer(id)
+		fmt.Printf("%s (%s): wins at [%s], loses at [%s]\n", p.Name(), p.Symbol(),
+			formatSquares(g.gs.Wins[id]), formatSquares(g.gs.Loses[id]))
+	}
+	return actionNone
+}
+
+func cmdSave(g *SquavaGame, args []string) gameAction {
+	if len(args) != 1 {
+		fmt.Println("Usage: save <file>")
+		return actionNone
+	}
+	if err := g.SaveRecord(args[0]); err != nil {
+		fmt.Printf("Could not save game: %v\n", err)
+		return actionNone
+	}
+	fmt.Printf("Game saved to %s\n", args[0])
+	return actionNone
+}
+
+func cmdUndo(g *SquavaGame, args []string) gameAction {
+	for _, gs := range g.history {
+		if gs.PlayerID == g.gs.PlayerID {
+			return actionUndo
+		}
+	}
+	fmt.Println(tr("nothing.to.undo"))
+	return actionNone
+}
+
+func cmdResign(g *SquavaGame, args []string) gameAction {
+	return actionResign
+}
+
+func cmdHint(g *SquavaGame, args []string) gameAction {
+	a := Analyze(g.gs, g.hintIterations)
+	fmt.Println(tr("hint", a.Best, a.Eval(2)))
+	if reasons := DescribeMove(g.gs, a.Best); len(reasons) > 0 {
+		fmt.Println(tr("hint.why", strings.Join(reasons, "; ")))
+	}
+	for i, e := range a.Moves {
+		if i == 3 {
+			break
+		}
+		if e.Outcome != Unproven {
+			fmt.Printf("  %s: Visits: %d, Proven %s\n", e.Move, e.Visits, e.Outcome)
+		} else {
+			fmt.Printf("  %s: Visits: %d, Winrate: %.2f%%\n", e.Move, e.Visits, e.Winrate*100)
+		}
+	}
+	return actionNone
+}
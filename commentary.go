@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"squava/game"
+)
+
+// --- Game commentary ---
+
+// commentaryDepth is how many of a player's own moves the commentary looks
+// ahead with the solver for forced wins and losses.
+const commentaryDepth = 2
+
+// playerName is the default name of player id in commentary.
+func playerName(id int) string {
+	return fmt.Sprintf("Player %d", id+1)
+}
+
+// slashSquares lists the squares of bb as "D5/F5".
+func slashSquares(bb game.Bitboard) string {
+	return strings.ReplaceAll(formatSquares(bb), ", ", "/")
+}
+
+// blockerOf returns the player who must block id's threats: the one who
+// moves just before id's next turn, or -1 if id is alone.
+func blockerOf(gs game.GameState, id int) int {
+	for _, p := range gs.ActiveIDs() {
+		if p != id && game.NextPlayer(p, gs.ActiveMask) == id {
+			return p
+		}
+	}
+	return -1
+}
+
+// Commentary describes each move of a game in a sentence or two, from the
+// threats on the board and the exact solver searching depth of a player's
+// moves ahead: wins and eliminations, forced blocks, new threats, forced
+// wins found or missed, and moves that lose by force. positions holds the
+// position before each move followed by the final one, as returned by
+// GameRecord.Positions. Moves with nothing to remark on get "".
+func Commentary(positions []game.GameState, moves []game.Move, depth int) []string {
+	notes := make([]string, len(moves))
+	var winning [3]bool // Whether each player is known to have a forced win
+	for i, move := range moves {
+		before, after := positions[i], positions[i+1]
+		mover := before.PlayerID
+		name := playerName(mover)
+		var s []string
+
+		if move == game.ResignMove {
+			s = append(s, name+" resigns.")
+			if after.Terminal && after.WinnerID >= 0 {
+				s = append(s, playerName(after.WinnerID)+" wins as the last player left.")
+			}
+			notes[i] = strings.Join(s, " ")
+			continue
+		}
+		mask := game.Bitboard(1) << uint(move.ToIndex())
+		forced := before.ForcedMoves()
+		legal := bits.OnesCount64(uint64(before.LegalMoves()))
+
+		switch {
+		case before.Wins[mover]&mask != 0:
+			s = append(s, fmt.Sprintf("%s completes a 4-in-a-row and wins.", name))
+		case forced != 0:
+			threat := before.NextPlayer()
+			if bits.OnesCount64(uint64(forced)) > 1 {
+				s = append(s, fmt.Sprintf("%s can block only one of %s's threats at %s.", name, playerName(threat), slashSquares(forced)))
+			} else {
+				s = append(s, fmt.Sprintf("%s is forced to block %s at %s.", name, playerName(threat), move))
+			}
+		}
+		if before.Loses[mover]&mask != 0 && before.Wins[mover]&mask == 0 {
+			s = append(s, fmt.Sprintf("%s makes a 3-in-a-row and is eliminated.", name))
+			if after.Terminal && after.WinnerID >= 0 {
+				s = append(s, playerName(after.WinnerID)+" wins as the last player left.")
+			}
+		}
+
+		if !after.Terminal && after.ActiveMask&(1<<uint(mover)) != 0 {
+			if threats := after.Wins[mover] &^ before.Wins[mover]; threats != 0 {
+				blocker := blockerOf(after, mover)
+				if bits.OnesCount64(uint64(threats)) > 1 {
+					s = append(s, fmt.Sprintf("This creates a double threat at %s", slashSquares(threats)))
+				} else {
+					s = append(s, fmt.Sprintf("This threatens to win at %s", slashSquares(threats)))
+				}
+				if blocker >= 0 {
+					s[len(s)-1] += fmt.Sprintf("; %s must block.", playerName(blocker))
+				} else {
+					s[len(s)-1] += "."
+				}
+			}
+		}
+
+		// The solver only has something to say when there was a choice and
+		// the move did not simply win.
+		if depth > 1 && legal > 1 && before.Wins[mover] == 0 {
+			wins := WinningMoves(before, depth)
+			switch {
+			case wins&mask != 0:
+				if !winning[mover] {
+					k := 2
+					for k < depth && !CanForceWin(&after, mover, k-1) {
+						k++
+					}
+					s = append(s, fmt.Sprintf("%s forces a win within %d moves.", move, k))
+				}
+				winning[mover] = true
+			case wins != 0:
+				s = append(s, fmt.Sprintf("%s missed a forced win with %s.", name, slashSquares(wins)))
+				winning[mover] = false
+			default:
+				winning[mover] = false
+				if before.Loses[mover]&mask == 0 && MoveLoses(before, move, depth) {
+					if safe := before.LegalMoves() &^ LosingMoves(before, depth); safe != 0 {
+						verb := "was"
+						if bits.OnesCount64(uint64(safe)) > 1 {
+							verb = "were"
+						}
+						s = append(s, fmt.Sprintf("%s loses by force; %s %s safe.", move, firstSquares(safe, 3), verb))
+					}
+				}
+			}
+		}
+		notes[i] = strings.Join(s, " ")
+	}
+	return notes
+}
+
+// firstSquares lists at most n squares of bb, as "D5/F5/G2 and others".
+func firstSquares(bb game.Bitboard, n int) string {
+	first, rest := splitSquares(bb, n)
+	if rest != 0 {
+		return slashSquares(first) + " and others"
+	}
+	return slashSquares(first)
+}
+
+// splitSquares splits off the lowest n squares of bb from the rest.
+func splitSquares(bb game.Bitboard, n int) (first, rest game.Bitboard) {
+	for i := 0; i < n && bb != 0; i++ {
+		first |= bb & -bb
+		bb &= bb - 1
+	}
+	return first, bb
+}
+
+// Annotate adds the Commentary on each move of r, searching depth of a player's
+// moves ahead, to the move's comment. Notes a comment already holds are not
+// added again, so annotating twice changes nothing.
+func Annotate(r *game.GameRecord, depth int) error {
+	positions, err := r.Positions()
+	if err != nil {
+		return err
+	}
+	for i, note := range Commentary(positions, r.Moves, depth) {
+		c := r.Comment(i)
+		switch {
+		case note == "" || strings.Contains(c, note):
+		case c == "":
+			r.SetComment(i, note)
+		default:
+			r.SetComment(i, c+"; "+note)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"squava/game"
+)
+
+// --- m,n,k-game formats ---
+
+// Squava is an 8,8,4 game for three players, so the formats of two-player
+// m,n,k games such as gomoku and renju can hold its placement sequence but
+// not who played each stone. Games are written in two of them:
+//
+// SGF, with GM[4] (gomoku and renju) and SZ[8]. Moves alternate B and W as
+// two-player viewers expect, so the colors do not tell the players apart;
+// each move labels its stone with the player's symbol instead (LB), and the
+// game comment (GC) says so. Player 1 and 2 are PB and PW, player 3 is the
+// private property P3, and marks are the move annotations TE, BM, DO and IT.
+//
+// PSQ, the format of Piskvork and Gomocup: a "Piskvorky 8x8, 11:11, 0"
+// line, then a line "x,y,time" per move, with 1-based coordinates from the
+// top left and the time in milliseconds, ended by "-1".
+//
+// Reading either takes the placement sequence only: the owner of every
+// stone follows from the rules, and the moves must be legal. Neither format
+// has resignations; a game that ends in one is written without it.
+
+// sgfMarks are the SGF move annotations of the marks, as property and
+// value, in the order of game.MoveMarks.
+var sgfMarks = [][2]string{{"TE", "1"}, {"BM", "1"}, {"TE", "2"}, {"BM", "2"}, {"IT", ""}, {"DO", ""}}
+
+// sgfTags are the SGF root properties of record header tags.
+var sgfTags = [][2]string{{"EV", "Event"}, {"DT", "Date"}, {"PC", "Site"}, {"RO", "Round"}}
+
+// sgfPoint returns the SGF point of m: column then row letters from "a",
+// rows counted from the top.
+func sgfPoint(m game.Move) string {
+	return string([]byte{'a' + byte(m.Col()), 'a' + byte(game.BoardSize-1-m.Row())})
+}
+
+// parseSGFPoint parses an SGF point of the 8x8 board.
+func parseSGFPoint(s string) (game.Move, error) {
+	if len(s) != 2 || s[0] < 'a' || s[0] >= 'a'+game.BoardSize || s[1] < 'a' || s[1] >= 'a'+game.BoardSize {
+		return game.Move{}, fmt.Errorf("bad point %q", s)
+	}
+	return game.MoveFromIndex((game.BoardSize-1-int(s[1]-'a'))*game.BoardSize + int(s[0]-'a')), nil
+}
+
+// sgfText escapes s for an SGF property value.
+func sgfText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "]", `\]`).Replace(s)
+}
+
+// WriteSGF writes recs as an SGF collection.
+func WriteSGF(w io.Writer, recs []*game.GameRecord) error {
+	var sb strings.Builder
+	for _, r := range recs {
+		sb.WriteString("(;FF[4]GM[4]SZ[8]CA[UTF-8]AP[squava]\n")
+		sb.WriteString("GC[Three-player squava: stones are labeled X, O and Z by player; their colors only alternate.]\n")
+		for i, prop := range []string{"PB", "PW", "P3"} {
+			if r.Players[i] != "" {
+				fmt.Fprintf(&sb, "%s[%s]", prop, sgfText(r.Players[i]))
+			}
+		}
+		for _, t := range r.Tags {
+			for _, st := range sgfTags {
+				if t.Key == st[1] {
+					fmt.Fprintf(&sb, "%s[%s]", st[0], sgfText(t.Value))
+				}
+			}
+		}
+		if r.Result != "" {
+			fmt.Fprintf(&sb, "RE[%s]", sgfText(r.Result))
+		}
+		if r.Intro != "" {
+			fmt.Fprintf(&sb, "C[%s]", sgfText(r.Intro))
+		}
+		positions, err := r.Positions()
+		if err != nil {
+			return err
+		}
+		color := "B"
+		for i, m := range r.Moves {
+			if m == game.ResignMove {
+				break
+			}
+			p := sgfPoint(m)
+			fmt.Fprintf(&sb, "\n;%s[%s]LB[%s:%c]", color, p, p, game.PositionStones[positions[i].PlayerID])
+			if mark := r.Mark(i); mark != "" {
+				for j, mm := range game.MoveMarks {
+					if mm == mark {
+						fmt.Fprintf(&sb, "%s[%s]", sgfMarks[j][0], sgfMarks[j][1])
+					}
+				}
+			}
+			if c := r.Comment(i); c != "" {
+				fmt.Fprintf(&sb, "C[%s]", sgfText(c))
+			}
+			if color == "B" {
+				color = "W"
+			} else {
+				color = "B"
+			}
+		}
+		sb.WriteString(")\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// sgfNode is the properties of an SGF node, in order.
+type sgfNode [][2]string
+
+// ReadSGF reads the games of an SGF collection, following the main line of
+// each, the first variation wherever the game branches.
+func ReadSGF(rd io.Reader) ([]*game.GameRecord, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	p := &sgfParser{s: string(data)}
+	var recs []*game.GameRecord
+	for {
+		p.space()
+		if p.i >= len(p.s) {
+			break
+		}
+		nodes, err := p.tree()
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %v", len(recs)+1, err)
+		}
+		r, err := sgfRecord(nodes)
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %v", len(recs)+1, err)
+		}
+		recs = append(recs, r)
+	}
+	return recs, nil
+}
+
+// sgfRecord makes a record of the main line of an SGF game.
+func sgfRecord(nodes []sgfNode) (*game.GameRecord, error) {
+	r := &game.GameRecord{}
+	for n, node := range nodes {
+		for _, prop := range node {
+			key, value := prop[0], prop[1]
+			switch key {
+			case "SZ":
+				if value != "8" && value != "8:8" {
+					return nil, fmt.Errorf("the board is %s, not 8x8", value)
+				}
+			case "AB", "AW", "AE":
+				return nil, fmt.Errorf("node %d: setup stones (%s) cannot be replayed as moves", n+1, key)
+			case "B", "W":
+				if value == "" || value == "tt" {
+					return nil, fmt.Errorf("node %d: squava has no passes", n+1)
+				}
+				m, err := parseSGFPoint(value)
+				if err != nil {
+					return nil, fmt.Errorf("node %d: %v", n+1, err)
+				}
+				r.Moves = append(r.Moves, m)
+			case "PB", "PW", "P3":
+				r.Players[strings.Index("BW3", key[1:])] = value
+			case "RE":
+				r.Result = value
+			case "C":
+				if len(r.Moves) == 0 {
+					r.Intro = strings.TrimSpace(r.Intro + " " + value)
+				} else {
+					r.SetComment(len(r.Moves)-1, strings.TrimSpace(r.Comment(len(r.Moves)-1)+" "+value))
+				}
+			}
+			for _, st := range sgfTags {
+				if key == st[0] {
+					r.Tags = append(r.Tags, game.RecordTag{Key: st[1], Value: value})
+				}
+			}
+		}
+		// Annotations follow the move of their node in any order.
+		for _, prop := range node {
+			for j, sm := range sgfMarks {
+				if prop[0] == sm[0] && (sm[1] == "" || prop[1] == sm[1] || prop[1] == "" && sm[1] == "1") && len(r.Moves) > 0 {
+					r.SetMark(len(r.Moves)-1, game.MoveMarks[j])
+				}
+			}
+		}
+	}
+	if _, err := r.Positions(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// sgfParser reads SGF text from s at i.
+type sgfParser struct {
+	s string
+	i int
+}
+
+func (p *sgfParser) space() {
+	for p.i < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+// tree reads a game tree and returns the nodes of its main line.
+func (p *sgfParser) tree() ([]sgfNode, error) {
+	p.space()
+	if p.i >= len(p.s) || p.s[p.i] != '(' {
+		return nil, fmt.Errorf("expected ( at offset %d", p.i)
+	}
+	p.i++
+	var nodes []sgfNode
+	for {
+		p.space()
+		if p.i >= len(p.s) {
+			return nil, fmt.Errorf("unterminated game tree")
+		}
+		switch p.s[p.i] {
+		case ';':
+			p.i++
+			node, err := p.node()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		case '(':
+			main, err := p.tree()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, main...)
+			// Skip the other variations.
+			for p.space(); p.i < len(p.s) && p.s[p.i] == '('; p.space() {
+				if _, err := p.tree(); err != nil {
+					return nil, err
+				}
+			}
+		case ')':
+			p.i++
+			return nodes, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+		}
+	}
+}
+
+// node reads the properties of a node.
+func (p *sgfParser) node() (sgfNode, error) {
+	var node sgfNode
+	for {
+		p.space()
+		start := p.i
+		for p.i < len(p.s) && p.s[p.i] >= 'A' && p.s[p.i] <= 'Z' || p.i > start && p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+			p.i++
+		}
+		if p.i == start {
+			return node, nil
+		}
+		key := p.s[start:p.i]
+		p.space()
+		if p.i >= len(p.s) || p.s[p.i] != '[' {
+			return nil, fmt.Errorf("property %s without a value", key)
+		}
+		for p.space(); p.i < len(p.s) && p.s[p.i] == '['; p.space() {
+			var value strings.Builder
+			for p.i++; ; p.i++ {
+				if p.i >= len(p.s) {
+					return nil, fmt.Errorf("unterminated value of %s", key)
+				}
+				ch := p.s[p.i]
+				if ch == ']' {
+					p.i++
+					break
+				}
+				if ch == '\\' && p.i+1 < len(p.s) {
+					p.i++
+					ch = p.s[p.i]
+				}
+				value.WriteByte(ch)
+			}
+			node = append(node, [2]string{key, value.String()})
+		}
+	}
+}
+
+// psqHeader starts a PSQ file of an 8x8 game.
+const psqHeader = "Piskvorky 8x8, 11:11, 0"
+
+// WritePSQ writes r in the PSQ format of Piskvork and Gomocup.
+func WritePSQ(w io.Writer, r *game.GameRecord) error {
+	var sb strings.Builder
+	sb.WriteString(psqHeader + "\n")
+	for i, m := range r.Moves {
+		if m == game.ResignMove {
+			break
+		}
+		fmt.Fprintf(&sb, "%d,%d,%d\n", m.Col()+1, game.BoardSize-m.Row(), r.MoveTime(i).Milliseconds())
+	}
+	sb.WriteString("-1\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// ReadPSQ reads a game in the PSQ format. Lines after the moves, such as
+// the engines' names, are ignored.
+func ReadPSQ(rd io.Reader) (*game.GameRecord, error) {
+	scanner := bufio.NewScanner(rd)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "Piskvorky") {
+		return nil, fmt.Errorf("not a PSQ file")
+	}
+	if size, _, _ := strings.Cut(strings.TrimPrefix(scanner.Text(), "Piskvorky "), ","); size != "8x8" {
+		return nil, fmt.Errorf("the board is %s, not 8x8", size)
+	}
+	r := &game.GameRecord{}
+	for line := 2; scanner.Scan(); line++ {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ",")
+		if len(fields) < 2 {
+			break
+		}
+		x, err1 := strconv.Atoi(fields[0])
+		y, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			break
+		}
+		if x < 1 || x > game.BoardSize || y < 1 || y > game.BoardSize {
+			return nil, fmt.Errorf("line %d: %d,%d is off the board", line, x, y)
+		}
+		r.Moves = append(r.Moves, game.MoveFromIndex((game.BoardSize-y)*game.BoardSize+x-1))
+		if len(fields) > 2 {
+			if ms, err := strconv.Atoi(fields[2]); err == nil && ms > 0 {
+				r.SetMoveTime(len(r.Moves)-1, time.Duration(ms)*time.Millisecond)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := r.Positions(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
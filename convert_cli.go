@@ -0,0 +1,97 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"squava/game"
+)
+
+// runConvert implements `squava convert`, translating game records between
+// squava's format and the SGF and PSQ formats of m,n,k games.
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava convert in.sqv|in.sgf|in.psq out.sqv|out.sgf|out.psq")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	in, out := fs.Arg(0), fs.Arg(1)
+
+	recs, err := readConvertFile(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", in, err)
+		return exitError
+	}
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(out)) {
+	case ".sqv":
+		for i, r := range recs {
+			if i > 0 {
+				buf.WriteByte('\n')
+			}
+			err = r.Write(&buf)
+		}
+	case ".sgf":
+		err = WriteSGF(&buf, recs)
+	case ".psq":
+		if len(recs) != 1 {
+			err = fmt.Errorf("a PSQ file holds one game, not %d", len(recs))
+		} else {
+			err = WritePSQ(&buf, recs[0])
+		}
+	default:
+		err = fmt.Errorf("unknown format; convert writes .sqv, .sgf and .psq files")
+	}
+	if err == nil {
+		err = os.WriteFile(out, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", out, err)
+		return exitError
+	}
+	resigned := 0
+	for _, r := range recs {
+		if n := len(r.Moves); n > 0 && r.Moves[n-1] == game.ResignMove && !strings.EqualFold(filepath.Ext(out), ".sqv") {
+			resigned++
+		}
+	}
+	fmt.Printf("Converted %d game(s) to %s\n", len(recs), out)
+	if resigned > 0 {
+		fmt.Fprintf(os.Stderr, "%d game(s) ended in a resignation, which %s cannot hold; it was left out\n", resigned, filepath.Ext(out))
+	}
+	return 0
+}
+
+// readConvertFile reads the games of a file in any of the formats convert
+// takes, told by the extension.
+func readConvertFile(path string) ([]*game.GameRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".sqv":
+		return game.ReadGameRecords(f)
+	case ".sgf":
+		return ReadSGF(f)
+	case ".psq":
+		r, err := ReadPSQ(f)
+		if err != nil {
+			return nil, err
+		}
+		return []*game.GameRecord{r}, nil
+	}
+	return nil, fmt.Errorf("unknown format; convert reads .sqv, .sgf and .psq files")
+}
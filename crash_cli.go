@@ -0,0 +1,169 @@
+//go:build !wasm
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"squava/game"
+	"squava/internal/kernels"
+)
+
+// --- Crash reports ---
+
+// A crash report is written when the game panics, so that a bug report can
+// carry an exact reproduction. The report is a move script: everything but
+// the human players' moves is a '#' comment, so replaying it with -script
+// and the seed it gives plays the same game up to the crash.
+
+// recoverCrash, deferred around a game, writes a crash report when the game
+// panics and then panics again with the same value.
+func (g *SquavaGame) recoverCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	value, stack := any(r), debug.Stack()
+	if p, ok := r.(*threadPanic); ok {
+		value, stack = fmt.Sprintf("search thread %d: %v", p.thread, p.value), p.stack
+	}
+	if path, err := g.writeCrash(value, stack, os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write crash report: %v\n", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "squava crashed; please attach %s to the bug report\n", path)
+	}
+	panic(r)
+}
+
+// writeCrash writes the crash report to a new file in the current
+// directory, or in the temporary directory if that is not writable, and
+// returns its path.
+func (g *SquavaGame) writeCrash(value any, stack []byte, args []string) (string, error) {
+	name := "squava-crash-" + time.Now().Format("20060102-150405") + ".txt"
+	var err error
+	for _, dir := range []string{".", os.TempDir()} {
+		var f *os.File
+		if f, err = os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); err != nil {
+			continue
+		}
+		path := f.Name()
+		err = g.writeCrashReport(f, path, value, stack, args)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return path, err
+	}
+	return "", err
+}
+
+// writeCrashReport writes the report of a panic with value and stack. path
+// is where the report is saved, for the command that replays it, and args
+// the command line the game was started with.
+func (g *SquavaGame) writeCrashReport(w io.Writer, path string, value any, stack []byte, args []string) error {
+	var sb strings.Builder
+	comment := func(format string, a ...any) {
+		for _, line := range strings.Split(strings.TrimRight(fmt.Sprintf(format, a...), "\n"), "\n") {
+			sb.WriteString(strings.TrimRight("# "+line, " "))
+			sb.WriteByte('\n')
+		}
+	}
+	comment("squava crash report")
+	comment("")
+	comment("Panic: %v", value)
+	comment("Platform: %s/%s, %s, %s kernels", runtime.GOOS, runtime.GOARCH, runtime.Version(), kernels.Name())
+	comment("Command: %s", strings.Join(args, " "))
+	comment("")
+	comment("Position: %s", game.FormatPosition(g.gs))
+	comment("To move: %s", g.playerName(g.gs.PlayerID))
+	comment("Seed: %d", g.seed)
+	for _, p := range g.players {
+		comment("Player%d: %s", p.ID()+1, g.playerType(p))
+	}
+	comment("Iterations: %d", g.iterations)
+	var moves []string
+	for i, m := range g.moves {
+		moves = append(moves, fmt.Sprintf("%d.%s", i+1, game.FormatRecordMove(m)))
+	}
+	comment("Moves: %s", strings.Join(moves, " "))
+	comment("")
+	if g.resumed {
+		comment("The game was resumed from a saved game, so replaying it from the")
+		comment("seed may not reach the crash; resume the game record below instead.")
+	} else {
+		comment("Reproduce: %s", strings.Join(crashReplayArgs(args, g.seed, path, g.humanMoves() != nil), " "))
+	}
+	comment("")
+	var rec strings.Builder
+	if err := g.Record().Write(&rec); err != nil {
+		return err
+	}
+	comment("Game record:")
+	comment("%s", rec.String())
+	comment("")
+	comment("Stack:")
+	comment("%s", stack)
+	sb.WriteByte('\n')
+	for _, m := range g.humanMoves() {
+		sb.WriteString(m)
+		sb.WriteByte('\n')
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// playerName returns the name of the player with the given ID.
+func (g *SquavaGame) playerName(id int) string {
+	if p := g.GetPlayer(id); p != nil {
+		return p.Name()
+	}
+	return fmt.Sprintf("player %d", id+1)
+}
+
+// humanMoves returns the moves the human and scripted players made, in
+// order, as a move script gives them.
+func (g *SquavaGame) humanMoves() []string {
+	var moves []string
+	for i, m := range g.moves {
+		switch g.GetPlayer(g.history[i].PlayerID).(type) {
+		case *HumanPlayer, *ScriptedPlayer:
+			if m == game.ResignMove {
+				moves = append(moves, "resign")
+			} else {
+				moves = append(moves, m.String())
+			}
+		}
+	}
+	return moves
+}
+
+// crashReplayArgs returns the command line that replays a crashed game:
+// args with the seed fixed and, if humans moved, their moves read from the
+// crash report at path. Flags that would write over files or listen on a
+// port are left out.
+func crashReplayArgs(args []string, seed uint64, path string, scripted bool) []string {
+	replay := []string{args[0]}
+	for i := 1; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		switch name {
+		case "seed", "script", "autosave", "report", "tt-file", "tree-dump", "cpuprofile", "memprofile", "trace", "pprof":
+			if !hasValue && i+1 < len(args) {
+				i++
+			}
+			continue
+		}
+		replay = append(replay, args[i])
+	}
+	// -seed takes the signed value that seeds the same stream.
+	replay = append(replay, "-seed", fmt.Sprint(int64(seed)))
+	if scripted {
+		replay = append(replay, "-script", path)
+	}
+	return replay
+}
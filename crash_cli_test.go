@@ -0,0 +1,52 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestCrashReport(t *testing.T) {
+	g := newTestGame("human", "mcts", "human")
+	g.seed = 42
+	g.SetIterations(100)
+	for _, idx := range []int{0, 9, 18, 27, 36} {
+		g.play(game.MoveFromIndex(idx))
+	}
+	g.play(game.ResignMove)
+
+	var buf bytes.Buffer
+	args := []string{"squava", "-p2", "mcts", "-seed=7", "-autosave", "game.sqv", "-plain"}
+	if err := g.writeCrashReport(&buf, "crash.txt", "boom", []byte("goroutine 1 [running]:\n"), args); err != nil {
+		t.Fatal(err)
+	}
+	report := buf.String()
+	for _, want := range []string{
+		"# Panic: boom\n",
+		"# Position: " + game.FormatPosition(g.gs) + "\n",
+		"# Seed: 42\n",
+		"# Player2: mcts\n",
+		"# Moves: 1.A1 2.B2 3.C3 4.D4 5.E5 6.resign\n",
+		"# Reproduce: squava -p2 mcts -plain -seed 42 -script crash.txt\n",
+		"# [Seed \"42\"]\n",
+		"# goroutine 1 [running]:\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("crash report lacks %q:\n%s", want, report)
+		}
+	}
+
+	// Replayed as a script, the report gives the humans' moves only.
+	script := NewMoveScript(strings.NewReader(report), "crash.txt")
+	var moves []string
+	for tok, ok := script.Next(); ok; tok, ok = script.Next() {
+		moves = append(moves, tok)
+	}
+	if want := []string{"A1", "C3", "D4", "resign"}; strings.Join(moves, " ") != strings.Join(want, " ") {
+		t.Errorf("script moves = %v, want %v", moves, want)
+	}
+}
@@ -0,0 +1,275 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"squava/game"
+)
+
+// dbCommands are run as `squava db <name> [args]`.
+var dbCommands = map[string]func(args []string) int{
+	"import":  runDBImport,
+	"list":    runDBList,
+	"stats":   runDBStats,
+	"export":  runDBExport,
+	"explore": runDBExplore,
+}
+
+// runDB implements `squava db`, queries on a database of saved games.
+func runDB(args []string) int {
+	if len(args) > 0 {
+		if cmd, ok := dbCommands[args[0]]; ok {
+			return cmd(args[1:])
+		}
+	}
+	fmt.Fprintln(os.Stderr, "usage: squava db import|list|stats|export|explore [flags]")
+	fmt.Fprintln(os.Stderr, "Run a command with -h for its flags.")
+	return exitUsage
+}
+
+// dbFlags are the flags shared by the db commands: the database file and,
+// for queries, a game filter.
+type dbFlags struct {
+	fs      *flag.FlagSet
+	path    *string
+	filter  game.GameFilter
+	opening string
+}
+
+func newDBFlags(name, usage string, filter bool) *dbFlags {
+	f := &dbFlags{fs: flag.NewFlagSet("db "+name, flag.ExitOnError)}
+	f.path = f.fs.String("db", "squava.db", "Game database file")
+	if filter {
+		f.fs.StringVar(&f.filter.Player, "player", "", "Only games with this player type in any seat, or in one seat as p2=mcts")
+		f.fs.StringVar(&f.filter.Outcome, "result", "", "Only games with this result: p1, p2, p3, draw or * (unfinished)")
+		f.fs.StringVar(&f.opening, "opening", "", "Only games starting with these moves, e.g. \"D4 E5\"")
+		f.fs.BoolVar(&f.filter.Duplicates, "duplicates", false, "Also games linked as duplicates of earlier ones")
+	}
+	f.fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava db "+name+" "+usage)
+		f.fs.PrintDefaults()
+	}
+	return f
+}
+
+// parse parses args and opens the database.
+func (f *dbFlags) parse(args []string) (*game.GameDB, error) {
+	f.fs.Parse(args)
+	var moves []string
+	for _, tok := range strings.Fields(f.opening) {
+		m, err := game.ParseMove(tok)
+		if err != nil {
+			return nil, fmt.Errorf("-opening: %s: %v", tok, err)
+		}
+		moves = append(moves, m.String())
+	}
+	f.filter.Opening = strings.Join(moves, " ")
+	switch f.filter.Outcome {
+	case "", "p1", "p2", "p3", "draw", "*":
+	default:
+		return nil, fmt.Errorf("-result must be p1, p2, p3, draw or *")
+	}
+	return game.OpenGameDB(*f.path)
+}
+
+// percent formats n out of total as a percentage for the db tables.
+func percent(n, total int) string {
+	return fmt.Sprintf("%6.1f%%", 100*float64(n)/float64(total))
+}
+
+// printPosition prints gs in the position notation and, if it differs, its
+// canonical form, under which the db and the book find its rotations and
+// reflections too.
+func printPosition(gs game.GameState) {
+	fmt.Println(game.FormatPosition(gs))
+	if pos, s := game.CanonicalPosition(gs); s != 0 {
+		fmt.Printf("Canonical: %s (symmetry %d)\n", pos, s)
+	}
+}
+
+func runDBImport(args []string) int {
+	f := newDBFlags("import", "[-db file] [-duplicates skip|link] game.sqv|dir...", false)
+	dups := f.fs.String("duplicates", "skip", "What to do with a game already in the database up to a rotation or reflection: skip it, or link it to the earlier game")
+	db, err := f.parse(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if f.fs.NArg() == 0 || *dups != "skip" && *dups != "link" {
+		f.fs.Usage()
+		return exitUsage
+	}
+	files, err := recordPaths(f.fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	added, duplicates, skipped := 0, 0, 0
+	for _, path := range files {
+		recs, names, err := readRecordFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v; skipped\n", path, err)
+			skipped++
+			continue
+		}
+		for i, rec := range recs {
+			if db.Duplicate(rec) != nil && *dups == "skip" {
+				duplicates++
+				continue
+			}
+			g, err := db.Add(rec, names[i])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v; skipped\n", names[i], err)
+				skipped++
+				continue
+			}
+			if g.DuplicateOf != 0 {
+				duplicates++
+			}
+			added++
+		}
+	}
+	if err := db.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not save %s: %v\n", *f.path, err)
+		return exitError
+	}
+	verb := "skipped"
+	if *dups == "link" {
+		verb = "linked"
+	}
+	fmt.Printf("Imported %d games (%d duplicates %s, %d others skipped); %s now holds %d\n", added, duplicates, verb, skipped, *f.path, len(db.Games))
+	return 0
+}
+
+func runDBList(args []string) int {
+	f := newDBFlags("list", "[-db file] [filters]", true)
+	db, err := f.parse(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	games := db.Select(f.filter)
+	fmt.Printf("%5s  %-30s %-6s %5s  %s\n", "ID", "Players", "Result", "Moves", "Opening")
+	for _, g := range games {
+		opening := g.Opening(3)
+		if g.DuplicateOf != 0 {
+			opening += fmt.Sprintf(" (duplicate of %d)", g.DuplicateOf)
+		}
+		fmt.Printf("%5d  %-30s %-6s %5d  %s\n", g.ID, strings.Join(g.Players[:], ", "), g.Outcome, g.Length, opening)
+	}
+	fmt.Printf("%d of %d games\n", len(games), len(db.Games))
+	return 0
+}
+
+func runDBStats(args []string) int {
+	f := newDBFlags("stats", "[-db file] [-plies N] [-min N] [filters]", true)
+	plies := f.fs.Int("plies", 3, "Length of the openings to group games by the position they reach")
+	minGames := f.fs.Int("min", 1, "Leave out openings played fewer times than this")
+	db, err := f.parse(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	stats, err := game.OpeningStats(db.Select(f.filter), *plies)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *f.path, err)
+		return exitError
+	}
+	fmt.Printf("%-20s %6s %6s %7s %7s %7s %7s\n", "Opening", "Games", "Orders", "P1 win", "P2 win", "P3 win", "Draw")
+	for _, s := range stats {
+		if s.Games < *minGames {
+			continue
+		}
+		fmt.Printf("%-20s %6d %6d %7s %7s %7s %7s\n", s.Opening, s.Games, s.Orders,
+			percent(s.Wins[0], s.Games), percent(s.Wins[1], s.Games), percent(s.Wins[2], s.Games), percent(s.Draws, s.Games))
+	}
+	return 0
+}
+
+func runDBExport(args []string) int {
+	f := newDBFlags("export", "[-db file] [filters] -o dir", true)
+	out := f.fs.String("o", "", "Directory to write the games to, as game-<id>.sqv")
+	db, err := f.parse(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if *out == "" {
+		f.fs.Usage()
+		return exitUsage
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	games := db.Select(f.filter)
+	for _, g := range games {
+		path := filepath.Join(*out, fmt.Sprintf("game-%04d.sqv", g.ID))
+		if err := os.WriteFile(path, []byte(g.Record), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	fmt.Printf("Exported %d games to %s\n", len(games), *out)
+	return 0
+}
+
+func runDBExplore(args []string) int {
+	f := newDBFlags("explore", "[-db file] [-moves \"D4 E5\" | -position pos] [-plain] [filters]", true)
+	movesFlag := f.fs.String("moves", "", "Explore the position after these moves (default: the empty board)")
+	position := f.fs.String("position", "", "Explore this position, in the notation of test suites")
+	plain := f.fs.Bool("plain", false, "Plain ASCII board without colors or unicode stones")
+	db, err := f.parse(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if *movesFlag != "" && *position != "" {
+		fmt.Fprintln(os.Stderr, "-moves and -position cannot be used together")
+		return exitUsage
+	}
+	rec, err := game.ReadGameRecord(strings.NewReader(*movesFlag))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-moves: %v\n", err)
+		return exitUsage
+	}
+	g, err := loadRecord(rec, *plain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-moves: %v\n", err)
+		return exitUsage
+	}
+	if *position != "" {
+		if g.gs, err = game.ParsePosition(*position); err != nil {
+			fmt.Fprintf(os.Stderr, "-position: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	idx, err := game.NewPositionIndex(db.Select(f.filter))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *f.path, err)
+		return exitError
+	}
+	g.PrintBoard()
+	reached, moves := idx.Explore(g.gs)
+	printPosition(g.gs)
+	fmt.Printf("Reached in %d games\n", reached)
+	if len(moves) == 0 {
+		return 0
+	}
+	mover := g.gs.PlayerID
+	fmt.Printf("%-6s %6s %7s %7s %7s %7s %7s\n", "Move", "Games", "P1 win", "P2 win", "P3 win", "Draw", "Score")
+	for _, m := range moves {
+		// The mover's score counts a win as 1 and a draw as 1/3.
+		score := 100 * (float64(m.Wins[mover]) + float64(m.Draws)/3) / float64(m.Games)
+		fmt.Printf("%-6s %6d %7s %7s %7s %7s %6.1f%%\n", m.Move, m.Games,
+			percent(m.Wins[0], m.Games), percent(m.Wins[1], m.Games), percent(m.Wins[2], m.Games), percent(m.Draws, m.Games), score)
+	}
+	return 0
+}
@@ -0,0 +1,534 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Distributed tournaments ---
+//
+// A tournament started with -serve becomes a coordinator: instead of playing
+// its games, it hands them to `squava worker` processes over HTTP.
+//
+//	POST /next    {"worker": name}           -> 200 workJob, 204 none right now, 410 finished
+//	POST /result  workResult                 -> 200
+//
+// Every request carries the tournament's token as "Authorization: Bearer
+// token", and is refused with 401 without it. A worker runs only squava's
+// own engines, and engines that run a command (cmd:) only if it was started
+// with -allow-engine for that engine's name, running the command given there
+// rather than the one the coordinator names.
+//
+// A game is leased to one worker at a time. If its result does not arrive
+// before the lease runs out, for instance because the worker died, the game
+// goes back in the queue for another worker. Late or repeated results for a
+// game that is already finished are ignored.
+
+// workJob is a game for a worker to play.
+type workJob struct {
+	Game       int       `json:"game"`
+	Seed       int64     `json:"seed"`
+	Iterations int       `json:"iterations"`
+	Specs      [3]string `json:"specs"`
+	Names      [3]string `json:"names"` // The engines' names, for -allow-engine
+}
+
+// workResult is what a worker reports for a game.
+type workResult struct {
+	Worker  string      `json:"worker"`
+	Game    int         `json:"game"`
+	Outcome GameOutcome `json:"outcome"`
+	Record  string      `json:"record,omitempty"` // The .sqv game record
+	Error   string      `json:"error,omitempty"`
+}
+
+// lease is a game handed to a worker.
+type lease struct {
+	game     *tournamentGame
+	worker   string
+	deadline time.Time
+}
+
+// coordinator hands a matchRunner's games to remote workers.
+type coordinator struct {
+	m         *matchRunner
+	leaseTime time.Duration
+	token     string // Workers must present it
+
+	mu        sync.Mutex
+	next      func() *tournamentGame
+	exhausted bool                 // next has no more games
+	stopped   bool                 // The runner wants no more games
+	finished  bool                 // The tournament is over; workers may leave
+	queue     []*tournamentGame    // Games to hand out before asking next
+	leased    map[int]*lease       // Games being played, by number
+	sending   int                  // Results on their way to done
+	done      chan *tournamentGame // Finished games, for the runner
+	workers   map[string]time.Time // When each worker was last heard from
+}
+
+func newCoordinator(m *matchRunner, leaseTime time.Duration, token string) *coordinator {
+	return &coordinator{m: m, leaseTime: leaseTime, token: token, leased: map[int]*lease{}, workers: map[string]time.Time{}}
+}
+
+// newToken returns a random token for workers to present.
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// listen starts serving workers on addr.
+func (c *coordinator) listen(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: c}
+	go srv.Serve(ln)
+	return srv, nil
+}
+
+// run plays the games returned by next on the workers, like matchRunner.play.
+func (c *coordinator) run(next func() *tournamentGame, stop <-chan struct{}) <-chan *tournamentGame {
+	c.mu.Lock()
+	c.next, c.exhausted, c.stopped, c.queue = next, false, false, nil
+	if g := next(); g != nil {
+		c.queue = append(c.queue, g)
+	} else {
+		c.exhausted = true
+	}
+	c.done = make(chan *tournamentGame)
+	c.mu.Unlock()
+	go func() {
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				c.mu.Lock()
+				c.stopped = true
+				c.mu.Unlock()
+				stop = nil
+			case <-tick.C:
+			}
+			c.mu.Lock()
+			c.expire()
+			over := (c.stopped || c.exhausted && len(c.queue) == 0) && len(c.leased) == 0 && c.sending == 0
+			c.mu.Unlock()
+			if over {
+				close(c.done)
+				return
+			}
+		}
+	}()
+	return c.done
+}
+
+// expire returns games whose lease has run out to the queue. It is called
+// with c.mu held.
+func (c *coordinator) expire() {
+	now := time.Now()
+	for id, l := range c.leased {
+		if now.After(l.deadline) {
+			slog.Warn(fmt.Sprintf("Game %d: no result from %s in %v, reassigning it", id, l.worker, c.leaseTime),
+				"event", "lease_expired", "game", id, "worker", l.worker, "lease", c.leaseTime)
+			delete(c.leased, id)
+			if !c.stopped {
+				c.queue = append(c.queue, l.game)
+			}
+		}
+	}
+}
+
+// assign picks the next game for worker, or returns nil if there is none. It
+// is called with c.mu held.
+func (c *coordinator) assign(worker string) *tournamentGame {
+	if c.stopped || c.next == nil {
+		return nil
+	}
+	var g *tournamentGame
+	switch {
+	case len(c.queue) > 0:
+		g, c.queue = c.queue[0], c.queue[1:]
+	case c.exhausted:
+		return nil
+	default:
+		if g = c.next(); g == nil {
+			c.exhausted = true
+			return nil
+		}
+	}
+	c.leased[g.Index] = &lease{game: g, worker: worker, deadline: time.Now().Add(c.leaseTime)}
+	if logEnabled(slog.LevelDebug) {
+		slog.Debug(fmt.Sprintf("Game %d leased to %s", g.Index, worker), "event", "lease", "game", g.Index, "worker", worker)
+	}
+	return g
+}
+
+// claim removes game number id from the leased or queued games and returns
+// it, or returns nil if it is neither. A result that arrives after its lease
+// ran out is still welcome if nobody else has started the game. It is called
+// with c.mu held.
+func (c *coordinator) claim(id int) *tournamentGame {
+	if l, ok := c.leased[id]; ok {
+		delete(c.leased, id)
+		return l.game
+	}
+	for i, g := range c.queue {
+		if g.Index == id {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return g
+		}
+	}
+	return nil
+}
+
+func (c *coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if logEnabled(LevelTrace) {
+		logTrace(fmt.Sprintf("%s %s from %s", r.Method, r.URL.Path, r.RemoteAddr), "event", "request", "path", r.URL.Path, "remote", r.RemoteAddr)
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+c.token)) != 1 {
+		slog.Warn(fmt.Sprintf("Refused a request from %s without the token", r.RemoteAddr), "event", "unauthorized", "remote", r.RemoteAddr)
+		http.Error(w, "wrong token", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/next":
+		var req struct {
+			Worker string `json:"worker"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Worker == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		if _, seen := c.workers[req.Worker]; !seen {
+			slog.Info(fmt.Sprintf("Worker %s joined", req.Worker), "event", "worker_joined", "worker", req.Worker)
+		}
+		c.workers[req.Worker] = time.Now()
+		finished := c.finished
+		g := c.assign(req.Worker)
+		if g != nil {
+			c.m.bind(g)
+		}
+		c.mu.Unlock()
+		switch {
+		case g != nil:
+			job := workJob{Game: g.Index, Seed: g.Seed, Iterations: g.Iterations, Specs: g.Specs}
+			for i, seat := range g.Seats {
+				job.Names[i] = c.m.engines[seat].Name
+			}
+			json.NewEncoder(w).Encode(job)
+		case finished:
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case "/result":
+		var res workResult
+		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		c.workers[res.Worker] = time.Now()
+		g := c.claim(res.Game)
+		if g != nil {
+			c.sending++
+		}
+		c.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		if g == nil {
+			// Already finished by another worker.
+			if logEnabled(slog.LevelDebug) {
+				slog.Debug(fmt.Sprintf("Game %d: ignoring the late result from %s", res.Game, res.Worker), "event", "late_result", "game", res.Game, "worker", res.Worker)
+			}
+			return
+		}
+		if logEnabled(slog.LevelDebug) {
+			slog.Debug(fmt.Sprintf("Game %d: result from %s", res.Game, res.Worker), "event", "result", "game", res.Game, "worker", res.Worker)
+		}
+		if res.Error != "" {
+			g.Err = fmt.Errorf("worker %s: %s", res.Worker, res.Error)
+		} else {
+			g.Outcome = res.Outcome
+			if path := c.m.recordPath(g); path != "" && res.Record != "" {
+				if err := os.WriteFile(path, []byte(res.Record), 0o644); err != nil {
+					slog.Error(fmt.Sprintf("could not save the record of game %d: %v", g.Index, err), "event", "save_failed", "game", g.Index, "error", err)
+				}
+			}
+		}
+		c.done <- g
+		c.mu.Lock()
+		c.sending--
+		c.mu.Unlock()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// finish tells workers that the tournament is over, giving those waiting
+// for a game time to hear it before srv shuts down.
+func (c *coordinator) finish(srv *http.Server) {
+	c.mu.Lock()
+	c.finished, c.stopped = true, true
+	c.mu.Unlock()
+	time.Sleep(3 * time.Second)
+	srv.Close()
+}
+
+// --- Worker ---
+
+// workerClient talks to a coordinator.
+type workerClient struct {
+	url     string
+	name    string
+	token   string
+	allowed commandList // The engines that may run a command, and their commands
+	client  *http.Client
+}
+
+// commandList collects repeated -allow-engine flags: the command each named
+// engine runs on this machine.
+type commandList map[string]string
+
+func (l commandList) String() string { return fmt.Sprint(map[string]string(l)) }
+
+func (l commandList) Set(s string) error {
+	name, cmd, ok := strings.Cut(s, "=")
+	cmd = strings.TrimPrefix(cmd, "cmd:")
+	if !ok || name == "" || strings.TrimSpace(cmd) == "" {
+		return fmt.Errorf("%q is not name=command", s)
+	}
+	l[name] = cmd
+	return nil
+}
+
+// errFinished is returned by fetch when the coordinator has no more games.
+var errFinished = errors.New("the tournament is over")
+
+// errUnauthorized is returned by fetch when the coordinator refuses the
+// worker's token.
+var errUnauthorized = errors.New("the coordinator refused the token")
+
+// post sends v as JSON to path and returns the response.
+func (w *workerClient) post(path string, v any) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+w.token)
+	return w.client.Do(req)
+}
+
+// fetch asks for a game; it returns nil if none is available right now.
+func (w *workerClient) fetch() (*workJob, error) {
+	resp, err := w.post("/next", map[string]string{"worker": w.name})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var job workJob
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			return nil, err
+		}
+		return &job, nil
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusGone:
+		return nil, errFinished
+	case http.StatusUnauthorized:
+		return nil, errUnauthorized
+	}
+	return nil, fmt.Errorf("coordinator: %s", resp.Status)
+}
+
+// localSpecs returns the player types to play job with on this machine:
+// squava's engines as sent, and engines that run a command with the command
+// allowed for their name. Any other engine is refused.
+func (w *workerClient) localSpecs(job *workJob) ([3]string, error) {
+	specs := job.Specs
+	for i, spec := range specs {
+		seat, err := ParsePlayerType(spec)
+		if err != nil {
+			return specs, err
+		}
+		switch seat.Kind {
+		case "human":
+			return specs, fmt.Errorf("engine %q: humans cannot play in tournaments", job.Names[i])
+		case "cmd":
+			cmd, ok := w.allowed[job.Names[i]]
+			if !ok {
+				return specs, fmt.Errorf("engine %q runs a command; start the worker with -allow-engine %s=command to allow it", job.Names[i], job.Names[i])
+			}
+			specs[i] = "cmd:" + cmd
+		}
+	}
+	return specs, nil
+}
+
+// play plays job in a separate process and returns the result to report.
+func (w *workerClient) play(exe string, job *workJob) workResult {
+	res := workResult{Worker: w.name, Game: job.Game}
+	specs, err := w.localSpecs(job)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	dir, err := os.MkdirTemp("", "squava-worker")
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer os.RemoveAll(dir)
+	record := filepath.Join(dir, "game.sqv")
+	res.Outcome, err = playMatchGame(exe, matchGame{Specs: specs, Iterations: job.Iterations, Seed: job.Seed, Record: record})
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if data, err := os.ReadFile(record); err == nil {
+		res.Record = string(data)
+	}
+	return res
+}
+
+// runWorker implements `squava worker`, playing games for a coordinator.
+func runWorker(args []string) int {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	host, _ := os.Hostname()
+	name := fs.String("name", fmt.Sprintf("%s-%d", host, os.Getpid()), "Worker name shown by the coordinator")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Games to play at the same time")
+	patience := fs.Duration("patience", time.Minute, "Give up after the coordinator has been unreachable this long")
+	token := fs.String("token", os.Getenv("SQUAVA_TOKEN"), "The coordinator's token (default $SQUAVA_TOKEN)")
+	allowed := commandList{}
+	fs.Var(allowed, "allow-engine", "Let the engine with this name run a command here, as name=command, e.g. net=./engine (repeatable)")
+	logs := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava worker -token T [flags] http://coordinator:8080")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *token == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	stopLog, err := logs.start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	defer stopLog()
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not find the squava executable: %v\n", err)
+		return exitError
+	}
+	url := strings.TrimSuffix(fs.Arg(0), "/")
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(*concurrency, 1); i++ {
+		w := &workerClient{url: url, name: fmt.Sprintf("%s/%d", *name, i+1), token: *token, allowed: allowed,
+			client: &http.Client{Timeout: 30 * time.Second}}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(exe, *patience)
+		}()
+	}
+	wg.Wait()
+	return 0
+}
+
+// loop fetches and plays games until the tournament is over or the
+// coordinator stays unreachable for longer than patience.
+func (w *workerClient) loop(exe string, patience time.Duration) {
+	var failingSince time.Time
+	for {
+		job, err := w.fetch()
+		switch {
+		case errors.Is(err, errFinished):
+			slog.Info(fmt.Sprintf("%s: %v", w.name, err), "event", "finished", "worker", w.name)
+			return
+		case errors.Is(err, errUnauthorized):
+			slog.Error(fmt.Sprintf("%s: %v", w.name, err), "event", "unauthorized", "worker", w.name)
+			return
+		case err != nil:
+			if failingSince.IsZero() {
+				failingSince = time.Now()
+			}
+			if time.Since(failingSince) > patience {
+				slog.Error(fmt.Sprintf("%s: giving up: %v", w.name, err), "event", "gave_up", "worker", w.name, "error", err)
+				return
+			}
+			if logEnabled(LevelTrace) {
+				logTrace(fmt.Sprintf("%s: coordinator unreachable: %v", w.name, err), "event", "unreachable", "worker", w.name, "error", err)
+			}
+			time.Sleep(5 * time.Second)
+			continue
+		case job == nil:
+			failingSince = time.Time{}
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		failingSince = time.Time{}
+
+		if logEnabled(slog.LevelDebug) {
+			slog.Debug(fmt.Sprintf("%s: playing game %d", w.name, job.Game), "event", "game_started", "worker", w.name, "game", job.Game, "seed", job.Seed)
+		}
+		res := w.play(exe, job)
+		if res.Error != "" {
+			slog.Error(fmt.Sprintf("%s: game %d: %s", w.name, job.Game, res.Error), "event", "game_failed", "worker", w.name, "game", job.Game, "error", res.Error)
+		} else {
+			slog.Info(fmt.Sprintf("%s: game %d done", w.name, job.Game), "event", "game_done", "worker", w.name, "game", job.Game, "outcome", res.Outcome)
+		}
+		// Keep trying to deliver the result; the coordinator reassigns the
+		// game if it never arrives.
+		for start := time.Now(); ; {
+			resp, err := w.post("/result", res)
+			if err == nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				break
+			}
+			if time.Since(start) > patience {
+				slog.Error(fmt.Sprintf("%s: could not report game %d: %v", w.name, job.Game, err), "event", "report_failed", "worker", w.name, "game", job.Game, "error", err)
+				return
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
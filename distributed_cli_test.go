@@ -0,0 +1,104 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCoordinatorLeases(t *testing.T) {
+	state := &TournamentState{Seed: 1, Iterations: 10,
+		Engines: []TournamentEngine{{"a", "mcts"}, {"b", "mcts"}, {"c", "mcts"}}}
+	m := &matchRunner{state: state, engines: state.Engines}
+	c := newCoordinator(m, time.Hour, "secret")
+	games := []*tournamentGame{{Index: 1, Seats: [3]int{0, 1, 2}}, {Index: 2, Seats: [3]int{1, 2, 0}}}
+	done := c.run(m.schedule(games), nil)
+
+	request := func(path, body, token string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+	// Results are delivered to done, so they are posted in the background.
+	post := func(path, body string) {
+		go c.ServeHTTP(httptest.NewRecorder(), request(path, body, "secret"))
+	}
+	next := func(worker string) workJob {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, request("/next", `{"worker":"`+worker+`"}`, "secret"))
+		var job workJob
+		if rec.Code == http.StatusOK {
+			json.NewDecoder(rec.Body).Decode(&job)
+		}
+		return job
+	}
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, request("/next", `{"worker":"intruder"}`, "guess"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("A request with the wrong token got %d", rec.Code)
+	}
+	if job := next("w1"); job.Game != 1 || job.Specs[0] != "mcts" || job.Names[1] != "b" || job.Iterations != 10 {
+		t.Fatalf("Unexpected first job %+v", job)
+	}
+	// w1 dies; its lease runs out and game 1 goes to w2 after game 2.
+	c.mu.Lock()
+	c.leased[1].deadline = time.Now().Add(-time.Second)
+	c.expire()
+	c.mu.Unlock()
+	if job := next("w2"); job.Game != 1 {
+		t.Errorf("Expected the expired game to be handed out again, got %+v", job)
+	}
+	if job := next("w2"); job.Game != 2 {
+		t.Errorf("Expected game 2, got %+v", job)
+	}
+	if job := next("w3"); job.Game != 0 {
+		t.Errorf("Expected no more games, got %+v", job)
+	}
+
+	post("/result", `{"worker":"w2","game":2,"outcome":{"Result":["win","loss","loss"]}}`)
+	if g := <-done; g.Index != 2 || g.Outcome.Result[0] != "win" {
+		t.Errorf("Unexpected result %+v", g)
+	}
+	post("/result", `{"worker":"w2","game":1,"outcome":{"Result":["draw","draw","draw"]}}`)
+	if g := <-done; g.Index != 1 {
+		t.Errorf("Unexpected result %+v", g)
+	}
+	// A late duplicate from w1 is ignored.
+	c.mu.Lock()
+	if g := c.claim(1); g != nil {
+		t.Errorf("Game 1 was claimed twice")
+	}
+	c.mu.Unlock()
+	if _, open := <-done; open {
+		t.Error("Expected the results to end")
+	}
+}
+
+func TestWorkerAllowsCommands(t *testing.T) {
+	w := &workerClient{allowed: commandList{}}
+	if err := w.allowed.Set("net=cmd:./engine --fast"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.allowed.Set("net"); err == nil {
+		t.Error("Expected -allow-engine without a command to be refused")
+	}
+	job := &workJob{Specs: [3]string{"mcts", "cmd:rm -rf ~", "mcts@100"}, Names: [3]string{"a", "net", "c"}}
+	specs, err := w.localSpecs(job)
+	if err != nil || specs != [3]string{"mcts", "cmd:./engine --fast", "mcts@100"} {
+		t.Errorf("localSpecs = %q, %v; want the allowed command for net", specs, err)
+	}
+	job.Names[1] = "other"
+	if _, err := w.localSpecs(job); err == nil {
+		t.Error("Expected a command of an engine not allowed to be refused")
+	}
+	job.Specs[1] = "human"
+	if _, err := w.localSpecs(job); err == nil {
+		t.Error("Expected a human seat to be refused")
+	}
+}
@@ -3,70 +3,15 @@ package main
 import (
 	"math"
 	"math/bits"
-)
-
-// --- Faster random number generation (xorshift64*) ---
-var xorState uint64 = 1 // seed should be non-zero
-
-func xrand() uint64 {
-	xorState ^= xorState >> 12
-	xorState ^= xorState << 25
-	xorState ^= xorState >> 27
-	return xorState * 0x2545F4914F6CDD1D
-}
-
-type ZobristTable struct {
-	piece  [3][64]uint64
-	turn   [3]uint64
-	active [256]uint64
-}
-
-func NewZobristTable() *ZobristTable {
-	z := &ZobristTable{}
-	// Use a local xorshift for deterministic initialization
-	s := uint64(42)
-	next := func() uint64 {
-		s ^= s >> 12
-		s ^= s << 25
-		s ^= s >> 27
-		return s * 0x2545F4914F6CDD1D
-	}
-
-	for p := 0; p < 3; p++ {
-		for i := 0; i < 64; i++ {
-			z.piece[p][i] = next()
-		}
-		z.turn[p] = next()
-	}
-	for i := 0; i < 256; i++ {
-		z.active[i] = next()
-	}
-	return z
-}
-
-var zobrist *ZobristTable
+	"time"
+	"unsafe"
 
-const (
-	BoardSize = 8
+	"squava/game"
+	"squava/internal/kernels"
 )
 
-// Bitboard constants
-const (
-	MaskNotA   uint64 = 0xFEFEFEFEFEFEFEFE
-	MaskNotH   uint64 = 0x7F7F7F7F7F7F7F7F
-	MaskNotAB  uint64 = 0xFCFCFCFCFCFCFCFC
-	MaskNotGH  uint64 = 0x3F3F3F3F3F3F3F3F
-	MaskNotABC uint64 = 0xF8F8F8F8F8F8F8F8
-	MaskNotFGH uint64 = 0x1F1F1F1F1F1F1F1F
-)
-
-type Board struct {
-	P        [3]Bitboard
-	Occupied Bitboard
-}
-type Bitboard uint64
 type Player interface {
-	GetMove(board Board, players []int, turnIdx int) Move
+	GetMove(board game.Board, players []int, turnIdx int) game.Move
 	Name() string
 	Symbol() string
 	ID() int // 0, 1, 2
@@ -81,462 +26,301 @@ func (p *PlayerInfo) Name() string   { return p.name }
 func (p *PlayerInfo) Symbol() string { return p.symbol }
 func (p *PlayerInfo) ID() int        { return p.id }
 
-type Move struct {
-	r, c int8
-}
-
-func (m Move) ToIndex() int {
-	return int(m.r)*8 + int(m.c)
-}
-func MoveFromIndex(idx int) Move {
-	return Move{r: int8(idx / 8), c: int8(idx % 8)}
-}
-
-// --- Bitboard Logic ---
-func (b *Board) Set(idx int, pID int) {
-	mask := Bitboard(uint64(1) << idx)
-	b.P[pID] |= mask
-	b.Occupied |= mask
-}
-
-func (b *Board) Move(pID int, idx int) Bitboard {
-	mask := Bitboard(uint64(1) << uint(idx))
-	b.P[pID] |= mask
-	b.Occupied |= mask
-	return mask
-}
-func (b *Board) GetPlayerBoard(pID int) Bitboard {
-	return b.P[pID]
-}
-
-func CheckBoard(bb Bitboard) (isWin, isLoss bool) {
-	wins, loses := GetWinsAndLosses(bb, bb)
-	isWin = wins != 0
-	isLoss = !isWin && loses != 0
-	return
-}
-
-// GetWinsAndLosses calculates win and loss bitboards.
-func GetWinsAndLosses(bb Bitboard, empty Bitboard) (wins Bitboard, loses Bitboard) {
-	w, l := getWinsAndLossesAVX2(uint64(bb), uint64(empty))
-	return Bitboard(w), Bitboard(l & ^w)
-}
-
-func getWinsAndLossesGo(b, e uint64) (w, l uint64) {
-	// Direction 0: Horizontal (s=1)
-	{
-		r1 := (b >> 1) & MaskNotH
-		l1 := (b << 1) & MaskNotA
-		r2 := (b >> 2) & MaskNotGH
-		l2 := (b << 2) & MaskNotAB
-
-		r1r2 := r1 & r2
-		l1l2 := l1 & l2
-		l |= e & (r1r2 | r1&l1 | l1l2)
-
-		r3 := (b >> 3) & MaskNotFGH
-		l3 := (b << 3) & MaskNotABC
-		w |= e & (r1r2&(r3|l1) | l1l2&(r1|l3))
-	}
-
-	// Direction 1: Vertical (s=8)
-	{
-		r1 := (b >> 8)
-		l1 := (b << 8)
-		r2 := (b >> 16)
-		l2 := (b << 16)
-
-		r1r2 := r1 & r2
-		l1l2 := l1 & l2
-		l |= e & (r1r2 | r1&l1 | l1l2)
-
-		r3 := (b >> 24)
-		l3 := (b << 24)
-		w |= e & (r1r2&(r3|l1) | l1l2&(r1|l3))
-	}
-
-	// Direction 2: Diagonal (s=9)
-	{
-		r1 := (b >> 9) & MaskNotH
-		l1 := (b << 9) & MaskNotA
-		r2 := (b >> 18) & MaskNotGH
-		l2 := (b << 18) & MaskNotAB
-
-		r1r2 := r1 & r2
-		l1l2 := l1 & l2
-		l |= e & (r1r2 | r1&l1 | l1l2)
-
-		r3 := (b >> 27) & MaskNotFGH
-		l3 := (b << 27) & MaskNotABC
-		w |= e & (r1r2&(r3|l1) | l1l2&(r1|l3))
-	}
-
-	// Direction 3: Anti-diagonal (s=7)
-	{
-		r1 := (b >> 7) & MaskNotA
-		l1 := (b << 7) & MaskNotH
-		r2 := (b >> 14) & MaskNotAB
-		l2 := (b << 14) & MaskNotGH
-
-		r1r2 := r1 & r2
-		l1l2 := l1 & l2
-		l |= e & (r1r2 | r1&l1 | l1l2)
-
-		r3 := (b >> 21) & MaskNotABC
-		l3 := (b << 21) & MaskNotFGH
-		w |= e & (r1r2&(r3|l1) | l1l2&(r1|l3))
-	}
-
-	return
-}
-
-func GetForcedMoves(board Board, players []int, turnIdx int) Bitboard {
-	activeMask := uint8(0)
-	for _, pID := range players {
-		activeMask |= 1 << uint(pID)
-	}
-	gs := NewGameState(board, players[turnIdx], activeMask)
-
-	if gs.Wins[gs.PlayerID] != 0 {
-		return gs.Wins[gs.PlayerID]
-	}
-	nextP := gs.NextPlayer()
-	if nextP != -1 {
-		return gs.Wins[nextP]
-	}
-	return 0
-}
-
 var (
-	invSqrtTable    [100000]float32
-	coeffTable      [100000]float32
-	tt              TranspositionTable
-	nextPlayerTable [3][256]int8
+	invSqrtTable [100000]float32
+	coeffTable   [100000]float32
+	tt           *TranspositionTable
 )
 
-func (z *ZobristTable) Move(h uint64, pID int, idx int) uint64 {
-	return h ^ z.piece[pID][idx]
-}
-
-func (z *ZobristTable) SwapTurn(h uint64, oldPID, newPID int) uint64 {
-	if newPID == -1 {
-		return h ^ z.turn[oldPID]
-	}
-	return h ^ z.turn[oldPID] ^ z.turn[newPID]
-}
+// benchSink keeps the compiler from dropping the results of the kernels in
+// benchmarks: those of squava bench, and those of the tests, which also
+// build on wasm.
+var benchSink game.Bitboard
 
-func (z *ZobristTable) UpdateMask(h uint64, oldMask, newMask uint8) uint64 {
-	return h ^ z.active[oldMask] ^ z.active[newMask]
+// ucb1Coeff returns sqrt(2 ln n), the exploration coefficient of a node
+// with n-1 visits. It takes the logarithm with math.Log1p, which is the same
+// Go code on every platform, where math.Log is assembly on amd64, so that a
+// seed plays the same game everywhere.
+func ucb1Coeff(n int) float32 {
+	return float32(math.Sqrt(2 * math.Log1p(float64(n-1))))
 }
 
-func (z *ZobristTable) ComputeHash(board Board, playerToMoveID int, activeMask uint8) uint64 {
-	var h uint64
-	if playerToMoveID >= 0 && playerToMoveID < 3 {
-		h = z.turn[playerToMoveID]
-	}
-	h ^= z.active[activeMask]
-	for p := 0; p < 3; p++ {
-		pBoard := uint64(board.P[p])
-		for pBoard != 0 {
-			idx := bits.TrailingZeros64(pBoard)
-			h ^= z.piece[p][idx]
-			pBoard &= pBoard - 1
-		}
-	}
-	return h
-}
+// --- MCTS Player ---
+const TTSize = 1 << 23 // ~8M entries, 96 MB
 
 func init() {
-	zobrist = NewZobristTable()
-	for p := 0; p < 3; p++ {
-		for m := 0; m < 256; m++ {
-			nextPlayerTable[p][m] = -1
-			for i := 1; i <= 2; i++ {
-				next := (p + i) % 3
-				if (m & (1 << uint(next))) != 0 {
-					nextPlayerTable[p][m] = int8(next)
-					break
-				}
-			}
-		}
-	}
 	for i := 1; i < len(invSqrtTable); i++ {
 		invSqrtTable[i] = float32(1.0 / math.Sqrt(float64(i)))
 	}
 	for i := 1; i < len(coeffTable); i++ {
-		coeffTable[i] = float32(math.Sqrt(2.0 * math.Log(float64(i))))
+		coeffTable[i] = ucb1Coeff(i)
 	}
-	tt = make(TranspositionTable, TTSize)
+	tt = NewTranspositionTable(TTSize)
 }
 
-func getNextPlayer(currentID int, activeMask uint8) int {
-	return int(nextPlayerTable[currentID][activeMask])
-}
-
-// --- MCTS Player ---
-const TTSize = 1 << 24 // ~16M entries
-const TTMask = TTSize - 1
+type MCTSPlayer struct {
+	info       PlayerInfo
+	iterations int
+	root       *MCGSNode
+	rollouts   int // Of the last search
+	Verbose    bool
 
-type GameState struct {
-	Board      Board
-	Hash       uint64
-	PlayerID   int
-	ActiveMask uint8
-	WinnerID   int
-	Terminal   bool
-	Wins       [3]Bitboard
-	Loses      [3]Bitboard
-}
+	// OnProgress, if set, is called every ProgressInterval rollouts during
+	// Search and once when it finishes.
+	OnProgress func(SearchInfo)
 
-func NewGameState(board Board, playerID int, activeMask uint8) GameState {
-	gs := GameState{
-		Board:      board,
-		PlayerID:   playerID,
-		ActiveMask: activeMask,
-		WinnerID:   -1,
-	}
-	gs.Hash = zobrist.ComputeHash(board, playerID, activeMask)
-	gs.InitThreats()
-	return gs
-}
+	personality *Personality   // nil plays the standard engine
+	rules       Rules          // nil searches squava itself, see SetRules
+	variant     game.GameState // Position the rules are called on
+	table       *TranspositionTable
+	arena       nodeArena
 
-func (gs *GameState) NextPlayer() int {
-	return int(nextPlayerTable[gs.PlayerID][gs.ActiveMask])
-}
+	// Playouts, if set, records the playouts of the standard engine's search.
+	Playouts *PlayoutStats
 
-func (gs *GameState) IsTerminal() (int, bool) {
-	return gs.WinnerID, gs.Terminal
-}
+	rand *Rand // Stream of the search's random choices
 
-func (gs *GameState) ActiveIDs() []int {
-	ids := make([]int, 0, 3)
-	for i := 0; i < 3; i++ {
-		if (gs.ActiveMask & (1 << uint(i))) != 0 {
-			ids = append(ids, i)
-		}
-	}
-	return ids
-}
+	// treeAge and the roots of the last treeAge searches, see SetTreeAge.
+	treeAge     int
+	recentRoots []*MCGSNode
 
-func (gs *GameState) GetBestMoves() Bitboard {
-	if gs.Wins[gs.PlayerID] != 0 {
-		return gs.Wins[gs.PlayerID]
-	}
-	nextP := gs.NextPlayer()
-	if nextP != -1 && gs.Wins[nextP] != 0 {
-		return gs.Wins[nextP]
-	}
-	empty := ^gs.Board.Occupied
-	safe := empty & ^gs.Loses[gs.PlayerID]
-	if safe != 0 {
-		return safe
-	}
-	return empty
-}
-
-func (gs *GameState) InitThreats() {
-	empty := ^gs.Board.Occupied
-	activeCount := bits.OnesCount8(gs.ActiveMask)
+	// MemoryStats makes GetMove measure the memory use of every search,
+	// which PrintStats then reports.
+	MemoryStats bool
+	memory      SearchMemory
 
-	// Re-evaluate terminal state
-	if gs.WinnerID != -1 {
-		gs.Terminal = true
-	} else if activeCount <= 1 {
-		gs.Terminal = true
-		if activeCount == 1 {
-			gs.WinnerID = bits.TrailingZeros8(gs.ActiveMask)
-		}
-	} else if empty == 0 {
-		gs.Terminal = true
-	} else {
-		gs.Terminal = false
-	}
+	// Book, if set, is probed before every search: a position in it is
+	// played from the book, by the moves' weights, without a search.
+	Book     *Book
+	bookMove *BookMove // The last move, if it came from the book
 
-	for p := 0; p < 3; p++ {
-		if (gs.ActiveMask & (1 << uint(p))) != 0 {
-			gs.Wins[p], gs.Loses[p] = GetWinsAndLosses(gs.Board.P[p], empty)
-		} else {
-			gs.Wins[p] = 0
-			gs.Loses[p] = 0
-		}
-	}
-}
+	// The other threads of a root-parallel search, see SetThreads, and the
+	// root statistics of all threads after the last one.
+	helpers       []*MCTSPlayer
+	autoThreads   bool
+	deterministic bool
+	merged        []MoveEval
 
-func (gs *GameState) applyPiece(idx int) {
-	gs.Board.Move(gs.PlayerID, idx)
-	gs.Hash = zobrist.Move(gs.Hash, gs.PlayerID, idx)
+	// The threads of the last search, and how they searched.
+	threads     int
+	parallelism int
 }
 
-func (gs *GameState) updateTurn(nextID int) {
-	gs.Hash = zobrist.SwapTurn(gs.Hash, gs.PlayerID, nextID)
-	gs.PlayerID = nextID
+// SearchInfo is a snapshot of a running search.
+type SearchInfo struct {
+	Rollouts int // Rollouts done by this search so far
+	Visits   int // Root visits, including reused ones
+	Target   int // Root visits at which the search stops
+	Elapsed  time.Duration
+	Best     game.Move
+	Winrate  float32 // Of the best move, for the player to move
+	Done     bool
 }
 
-func (gs *GameState) updateActiveMask(newMask uint8) {
-	gs.Hash = zobrist.UpdateMask(gs.Hash, gs.ActiveMask, newMask)
-	gs.ActiveMask = newMask
-}
+const ProgressInterval = 4096
 
-func (gs *GameState) setWinner(winnerID int) {
-	gs.WinnerID = winnerID
-	gs.Hash = zobrist.SwapTurn(gs.Hash, gs.PlayerID, -1)
-	gs.PlayerID = -1
-	gs.Terminal = true
+func NewMCTSPlayer(name, symbol string, id int, iterations int) *MCTSPlayer {
+	return &MCTSPlayer{
+		info:       PlayerInfo{name: name, symbol: symbol, id: id},
+		iterations: iterations,
+		table:      tt,
+		rand:       &mainRand,
+	}
 }
 
-func (gs *GameState) ApplyMove(move Move) {
-	gs.ApplyMoveIdx(move.ToIndex())
+// SetRand gives the player its own stream of random numbers, such as a
+// Split of the main stream, so that it can search on another goroutine.
+// Players share the main stream by default.
+func (m *MCTSPlayer) SetRand(r *Rand) {
+	m.rand = r
 }
 
-func (gs *GameState) ApplyMoveIdx(idx int) {
-	mask := Bitboard(1 << uint(idx))
-	pID := gs.PlayerID
-
-	// 1. Immediate win
-	if (gs.Wins[pID] & mask) != 0 {
-		gs.applyPiece(idx)
-		gs.setWinner(pID)
-		return
-	}
-
-	// 2. Normal move or elimination
-	isLoss := (gs.Loses[pID] & mask) != 0
-	gs.applyPiece(idx)
-
-	empty := ^gs.Board.Occupied
-	invMask := ^mask
-
-	if isLoss {
-		newMask := gs.ActiveMask & ^(1 << uint(pID))
-		gs.updateActiveMask(newMask)
-		if bits.OnesCount8(newMask) == 1 {
-			gs.setWinner(bits.TrailingZeros8(newMask))
-		} else {
-			gs.updateTurn(getNextPlayer(pID, newMask))
-		}
-		gs.Wins[pID] = 0
-		gs.Loses[pID] = 0
-	} else {
-		gs.updateTurn(gs.NextPlayer())
-		if empty == 0 {
-			gs.Terminal = true
-		} else {
-			gs.Wins[pID], gs.Loses[pID] = GetWinsAndLosses(gs.Board.P[pID], empty)
-		}
-	}
+// personalityTTSize is the size of the private transposition table of a
+// player with a personality, whose shaped statistics must not leak into the
+// shared table.
+const personalityTTSize = 1 << 20
 
-	// Update other players' threats - unrolled loop
-	if pID != 0 {
-		gs.Wins[0] &= invMask
-		gs.Loses[0] &= invMask
-	}
-	if pID != 1 {
-		gs.Wins[1] &= invMask
-		gs.Loses[1] &= invMask
-	}
-	if pID != 2 {
-		gs.Wins[2] &= invMask
-		gs.Loses[2] &= invMask
-	}
+// SetPersonality gives the player a personality, or removes it with nil.
+func (m *MCTSPlayer) SetPersonality(p *Personality) {
+	m.personality = p
+	m.resetTable()
 }
 
-type TranspositionTable []*MCGSNode
-
-func (tt TranspositionTable) Lookup(gs *GameState) *MCGSNode {
-	idx := gs.Hash & TTMask
-	node := tt[idx]
-	if node != nil && node.Hash == gs.Hash {
-		return node
+// resetTable gives the player the shared transposition table, or a private
+// one if its graph must not be shared: with a personality, a node cap or
+// rules of its own.
+func (m *MCTSPlayer) resetTable() {
+	m.table = tt
+	if m.personality != nil || m.arena.limit > 0 || m.rules != nil {
+		m.table = NewTranspositionTable(personalityTTSize)
 	}
-	return nil
 }
 
-func (tt TranspositionTable) Store(hash uint64, node *MCGSNode) {
-	idx := hash & TTMask
-	tt[idx] = node
+// Personality returns the player's personality, or nil.
+func (m *MCTSPlayer) Personality() *Personality {
+	return m.personality
 }
+func (m *MCTSPlayer) Name() string   { return m.info.name }
+func (m *MCTSPlayer) Symbol() string { return m.info.symbol }
+func (m *MCTSPlayer) ID() int        { return m.info.id }
 
-func (tt TranspositionTable) Clear() {
-	for i := range tt {
-		tt[i] = nil
+func (m *MCTSPlayer) Search(gs game.GameState) (int, int) {
+	n, how := m.schedule(&gs)
+	m.threads, m.parallelism = n, how
+	if n > 1 {
+		return m.searchParallel(gs, n, how)
 	}
+	m.merged = nil
+	return m.search(gs, m.findRoot(gs), m.iterations, nil)
 }
 
-type MCTSPlayer struct {
-	info       PlayerInfo
-	iterations int
-	root       *MCGSNode
-	Verbose    bool
-}
-
-func NewMCTSPlayer(name, symbol string, id int, iterations int) *MCTSPlayer {
-	return &MCTSPlayer{
-		info:       PlayerInfo{name: name, symbol: symbol, id: id},
-		iterations: iterations,
+// findRoot starts a search of gs in m's table and returns its root.
+func (m *MCTSPlayer) findRoot(gs game.GameState) *MCGSNode {
+	m.table.NewSearch()
+	if m.Verbose {
+		m.table.CountStats() // For PrintStats
 	}
-}
-func (m *MCTSPlayer) Name() string   { return m.info.name }
-func (m *MCTSPlayer) Symbol() string { return m.info.symbol }
-func (m *MCTSPlayer) ID() int        { return m.info.id }
-
-func (m *MCTSPlayer) Search(gs GameState) (int, int) {
-	root := tt.Lookup(&gs)
+	root := m.table.Lookup(&gs)
 	if root == nil {
-		root = NewMCGSNode(gs)
-		tt.Store(gs.Hash, root)
+		root = m.newNode(gs)
+		m.table.Store(gs.Hash, root)
+	}
+	if m.treeAge > 0 && m.arena.limit > 0 {
+		m.ageTree(root)
 	}
 	m.root = root
+	return root
+}
 
+// search runs rollouts from root, the node of gs, until it has target
+// visits or, if take is not nil, until take refuses another rollout.
+func (m *MCTSPlayer) search(gs game.GameState, root *MCGSNode, target int, take func() bool) (int, int) {
 	initialN := root.N
 	totalSteps := 0
+	start := time.Now()
 	path := make([]PathStep, 0, 64)
-	for root.N < m.iterations {
+	for root.N < target && (take == nil || take()) {
+		if m.arena.full() {
+			m.prune(root)
+		}
+		if m.OnProgress != nil && (root.N-initialN)%ProgressInterval == 0 && root.N > initialN {
+			m.OnProgress(m.searchInfo(initialN, target, start, false))
+		}
 		tmpGS := gs
 		path = path[:0]
 		path = m.Select(root, &tmpGS, path)
-
-		var result [3]float32
-		winnerID, terminal := tmpGS.IsTerminal()
-		if terminal {
-			result = ScoreTerminal(tmpGS.ActiveMask, winnerID)
-		} else {
-			var s int
-			result, s, _ = RunSimulation(&tmpGS)
-			totalSteps += s
-		}
+		result, s := m.rollout(&tmpGS, gs.ActiveMask, m.rand, m.Playouts)
+		totalSteps += s
 		m.Backprop(path, result)
 	}
+	if m.OnProgress != nil {
+		m.OnProgress(m.searchInfo(initialN, target, start, true))
+	}
 	return totalSteps, root.N - initialN
 }
 
-func (m *MCTSPlayer) GetMove(board Board, players []int, turnIdx int) Move {
+// rollout plays out leaf, the position a rollout of a search of a position
+// with activeMask has reached, with the stream r, recording the playout in
+// stats if it is not nil. It returns the result to back up and the moves
+// played.
+func (m *MCTSPlayer) rollout(leaf *game.GameState, activeMask uint8, r *Rand, stats *PlayoutStats) ([3]float32, int) {
+	if m.rules != nil {
+		return m.playOut(leaf)
+	}
+	var result [3]float32
+	steps := 0
+	if winnerID, terminal := leaf.IsTerminal(); terminal {
+		result = ScoreTerminal(leaf.ActiveMask, winnerID)
+	} else if m.personality != nil {
+		result, steps = m.personality.simulate(leaf, m.info.id, r)
+	} else if stats != nil {
+		result, steps = stats.Simulate(leaf, r)
+	} else {
+		result, steps, _ = RunSimulation(leaf, r)
+	}
+	if m.personality != nil {
+		result = m.personality.shape(result, activeMask, leaf, m.info.id)
+	}
+	return result, steps
+}
+
+func (m *MCTSPlayer) searchInfo(initialN, target int, start time.Time, done bool) SearchInfo {
+	info := SearchInfo{
+		Rollouts: m.root.N - initialN,
+		Visits:   m.root.N,
+		Target:   target,
+		Elapsed:  time.Since(start),
+		Done:     done,
+	}
+	bestVisits := int32(-1)
+	for i := range m.root.Edges {
+		if m.root.Edges[i].N > bestVisits {
+			bestVisits = m.root.Edges[i].N
+			info.Best = m.root.Edges[i].Move
+			info.Winrate = m.root.EdgeQs[i]
+		}
+	}
+	return info
+}
+
+func (m *MCTSPlayer) GetMove(board game.Board, players []int, turnIdx int) game.Move {
 	activeMask := uint8(0)
 	for _, pID := range players {
 		activeMask |= 1 << uint(pID)
 	}
-	gs := NewGameState(board, players[turnIdx], activeMask)
+	gs := game.NewGameState(board, players[turnIdx], activeMask)
+
+	m.bookMove = nil
+	if m.Book != nil && m.rules == nil {
+		if bm, ok := m.Book.Pick(&gs, m.rand); ok {
+			m.root, m.merged, m.rollouts, m.bookMove = nil, nil, 0, &bm
+			m.PrintBookMove(&bm)
+			return bm.Move
+		}
+	}
 
-	totalSteps, rollouts := m.Search(gs)
+	var totalSteps, rollouts int
+	if m.MemoryStats {
+		totalSteps, rollouts = m.measureSearch(gs)
+	} else {
+		totalSteps, rollouts = m.Search(gs)
+	}
+	m.rollouts = rollouts
 
 	m.PrintStats(players[turnIdx], totalSteps, rollouts)
 
+	if m.personality != nil && m.rules == nil {
+		if move, ok := m.personality.pickMove(m.root, m.rand); ok {
+			return move
+		}
+	}
+
 	bestVisits := -1
-	var bestMove Move
-	for i := range m.root.Edges {
-		edge := &m.root.Edges[i]
-		visits := int(edge.N)
-		if visits > bestVisits {
-			bestVisits = visits
-			bestMove = edge.Move
+	var bestMove game.Move
+	if m.merged != nil {
+		for _, mv := range m.merged {
+			if mv.Visits > bestVisits {
+				bestVisits = mv.Visits
+				bestMove = mv.Move
+			}
+		}
+	} else {
+		for i := range m.root.Edges {
+			edge := &m.root.Edges[i]
+			visits := int(edge.N)
+			if visits > bestVisits {
+				bestVisits = visits
+				bestMove = edge.Move
+			}
 		}
 	}
 
 	if bestVisits == -1 {
 		// Fallback
-		moves := gs.GetBestMoves()
+		moves := m.moves(&gs)
 		if moves != 0 {
 			idx := bits.TrailingZeros64(uint64(moves))
-			return MoveFromIndex(idx)
+			return game.MoveFromIndex(idx)
 		}
 	}
 	return bestMove
@@ -550,18 +334,28 @@ type PathStep struct {
 
 var negInf = math.Inf(-1)
 
-func (m *MCTSPlayer) Select(root *MCGSNode, gs *GameState, path []PathStep) []PathStep {
+func (m *MCTSPlayer) Select(root *MCGSNode, gs *game.GameState, path []PathStep) []PathStep {
+	return m.descend(root, gs, path, m.rand, false)
+}
+
+// descend is Select with the stream r. With virtualLoss, it adds a virtual
+// loss to every edge it takes, for backpropVirtual to take back.
+func (m *MCTSPlayer) descend(root *MCGSNode, gs *game.GameState, path []PathStep, r *Rand, virtualLoss bool) []PathStep {
 	path = append(path, PathStep{Node: root, EdgeIdx: -1, PlayerID: gs.PlayerID})
 	curr := root
 
 	for {
-		if _, terminal := gs.IsTerminal(); terminal {
+		if _, terminal := m.terminal(gs); terminal {
 			return path
 		}
 
+		playerID := gs.PlayerID
 		if curr.untriedMoves != 0 {
-			move, _ := curr.PopUntriedMove()
-			child, _, edgeIdx := m.expand(curr, gs, move, gs.PlayerID)
+			move, _ := curr.PopUntriedMove(r)
+			child, _, edgeIdx := m.expand(curr, gs, move, playerID)
+			if virtualLoss {
+				curr.addVirtualLoss(edgeIdx, playerID)
+			}
 			path = append(path, PathStep{Node: child, EdgeIdx: edgeIdx, PlayerID: gs.PlayerID})
 			return path
 		} else {
@@ -570,21 +364,29 @@ func (m *MCTSPlayer) Select(root *MCGSNode, gs *GameState, path []PathStep) []Pa
 				return path
 			}
 			edge := &curr.Edges[bestIdx]
-			gs.ApplyMoveIdx(edge.Move.ToIndex())
+			if virtualLoss {
+				curr.addVirtualLoss(bestIdx, playerID)
+			}
+			m.play(gs, edge.Move.ToIndex())
 			path = append(path, PathStep{Node: edge.Dest, EdgeIdx: bestIdx, PlayerID: gs.PlayerID})
 			curr = edge.Dest
 		}
 	}
 }
 
-func (m *MCTSPlayer) expand(curr *MCGSNode, gs *GameState, move Move, playerID int) (*MCGSNode, bool, int) {
-	gs.ApplyMove(move)
+func (m *MCTSPlayer) expand(curr *MCGSNode, gs *game.GameState, move game.Move, playerID int) (*MCGSNode, bool, int) {
+	m.play(gs, move.ToIndex())
 
 	// Skip TT lookup during search to save time (low hit rate).
 	// We still store the node so it can be found if it becomes the root later.
-	child := NewMCGSNode(*gs)
-	tt.Store(gs.Hash, child)
+	child := m.newNode(*gs)
+	m.table.Store(gs.Hash, child)
 
+	if len(curr.Edges) == cap(curr.Edges) {
+		// The node's remaining moves are known, so its edges are grown once,
+		// to hold all of them, rather than doubled as they are added.
+		curr.Edges, curr.EdgeQs, curr.EdgeUs = m.arena.growEdges(curr, len(curr.Edges)+1+bits.OnesCount64(uint64(curr.untriedMoves)))
+	}
 	edgeIdx := curr.AddEdge(move, child, playerID)
 	return child, true, edgeIdx
 }
@@ -602,21 +404,28 @@ func (m *MCTSPlayer) Backprop(path []PathStep, result [3]float32) {
 }
 
 type MCGSEdge struct {
-	Move Move
-	Dest *MCGSNode
-	N    int32
+	Move    game.Move
+	Dest    *MCGSNode
+	N       int32
+	Virtual int32 // Visits in flight through the edge, see addVirtualLoss
 }
 
 const InlineEdgeCap = 4
 
 type MCGSNode struct {
-	Hash         uint64
-	N            int
-	Q            [3]float32
-	Edges        []MCGSEdge
+	Hash  uint64
+	N     int
+	Q     [3]float32
+	Edges []MCGSEdge
+
+	// The selection statistics of the edges are kept by the parent in
+	// float32 arrays parallel to Edges, so that kernels.SelectBestEdge scores
+	// them in place: EdgeQs[i] is the winrate of edge i's child for the
+	// player to move here, EdgeUs[i] is 1/sqrt(visits+1), and UCB1Coeff is
+	// sqrt(2 ln(N+1)).
 	EdgeQs       []float32
 	EdgeUs       []float32
-	untriedMoves Bitboard
+	untriedMoves game.Bitboard
 	UCB1Coeff    float32
 
 	edgesBuf [InlineEdgeCap]MCGSEdge
@@ -624,7 +433,7 @@ type MCGSNode struct {
 	usBuf    [InlineEdgeCap]float32
 }
 
-func (n *MCGSNode) AddEdge(move Move, dest *MCGSNode, playerID int) int {
+func (n *MCGSNode) AddEdge(move game.Move, dest *MCGSNode, playerID int) int {
 	idx := len(n.Edges)
 	n.Edges = append(n.Edges, MCGSEdge{
 		Move: move,
@@ -642,7 +451,7 @@ func (n *MCGSNode) selectBestEdge() int {
 	}
 
 	if len(n.Edges) >= 8 {
-		return selectBestEdgeAVX2(n.EdgeQs, n.EdgeUs, n.UCB1Coeff)
+		return kernels.SelectBestEdge(n.EdgeQs, n.EdgeUs, n.UCB1Coeff)
 	}
 
 	bestIdx := -1
@@ -650,7 +459,7 @@ func (n *MCGSNode) selectBestEdge() int {
 	coeff := n.UCB1Coeff
 
 	for i := range n.Edges {
-		score := n.EdgeQs[i] + coeff*n.EdgeUs[i]
+		score := n.EdgeQs[i] + float32(coeff*n.EdgeUs[i])
 		if score > bestScore {
 			bestScore = score
 			bestIdx = i
@@ -662,16 +471,18 @@ func (n *MCGSNode) selectBestEdge() int {
 func (n *MCGSNode) UpdateStats(result [3]float32) {
 	n.N++
 	invN := 1.0 / float32(n.N)
-	n.Q[0] += (result[0] - n.Q[0]) * invN
-	n.Q[1] += (result[1] - n.Q[1]) * invN
-	n.Q[2] += (result[2] - n.Q[2]) * invN
+	// The conversions round the products, so that no platform fuses them
+	// into a multiply-add that rounds differently.
+	n.Q[0] += float32((result[0] - n.Q[0]) * invN)
+	n.Q[1] += float32((result[1] - n.Q[1]) * invN)
+	n.Q[2] += float32((result[2] - n.Q[2]) * invN)
 
 	// Update cached coeff
 	nPlus1 := n.N + 1
 	if nPlus1 < len(coeffTable) {
 		n.UCB1Coeff = coeffTable[nPlus1]
 	} else {
-		n.UCB1Coeff = float32(math.Sqrt(2.0 * math.Log(float64(nPlus1))))
+		n.UCB1Coeff = ucb1Coeff(nPlus1)
 	}
 }
 
@@ -679,49 +490,118 @@ func (n *MCGSNode) SyncEdge(idx int, child *MCGSNode, playerID int) {
 	edge := &n.Edges[idx]
 	edge.N++
 	n.EdgeQs[idx] = child.Q[playerID]
-	vPlus1 := int(edge.N) + 1
-	if vPlus1 < len(invSqrtTable) {
-		n.EdgeUs[idx] = invSqrtTable[vPlus1]
-	} else {
-		n.EdgeUs[idx] = float32(1.0 / math.Sqrt(float64(vPlus1)))
+	n.EdgeUs[idx] = invSqrt(int(edge.N) + 1)
+}
+
+// invSqrt returns 1/sqrt(v), from the table for small v.
+func invSqrt(v int) float32 {
+	if v < len(invSqrtTable) {
+		return invSqrtTable[v]
 	}
+	return float32(1.0 / math.Sqrt(float64(v)))
 }
 
-func (n *MCGSNode) PopUntriedMove() (Move, bool) {
-	moveIdx := PickRandomBit(n.untriedMoves)
+func (n *MCGSNode) PopUntriedMove(r *Rand) (game.Move, bool) {
+	moveIdx := r.PickBit(n.untriedMoves)
 	if moveIdx == -1 {
-		return Move{}, false
+		return game.Move{}, false
 	}
-	n.untriedMoves &= ^(Bitboard(1) << uint(moveIdx))
-	return MoveFromIndex(moveIdx), true
+	n.untriedMoves &= ^(game.Bitboard(1) << uint(moveIdx))
+	return game.MoveFromIndex(moveIdx), true
 }
 
-func NewMCGSNode(gs GameState) *MCGSNode {
-	_, terminal := gs.IsTerminal()
-	var untried Bitboard
-	if !terminal {
-		untried = gs.GetBestMoves()
+func NewMCGSNode(gs game.GameState) *MCGSNode {
+	n := &MCGSNode{}
+	n.init(gs)
+	return n
+}
+
+// init sets n up as a new node for gs. A recycled node keeps edge arrays it
+// had outgrown its inline ones for, to reuse them.
+func (n *MCGSNode) init(gs game.GameState) {
+	edges, qs, us := n.Edges[:0], n.EdgeQs[:0], n.EdgeUs[:0]
+	*n = MCGSNode{Hash: gs.Hash}
+	if cap(edges) > InlineEdgeCap {
+		n.Edges, n.EdgeQs, n.EdgeUs = edges, qs, us
+	} else {
+		n.Edges = n.edgesBuf[:0]
+		n.EdgeQs = n.qsBuf[:0]
+		n.EdgeUs = n.usBuf[:0]
 	}
-	n := &MCGSNode{
-		Hash:         gs.Hash,
-		untriedMoves: untried,
+	if _, terminal := gs.IsTerminal(); !terminal {
+		n.untriedMoves = gs.GetBestMoves()
 	}
-	n.Edges = n.edgesBuf[:0]
-	n.EdgeQs = n.qsBuf[:0]
-	n.EdgeUs = n.usBuf[:0]
+}
+
+// nodeArena hands out the nodes and edge arrays of a search from large
+// blocks, so that a search makes a few big allocations instead of one or
+// more per node, and nodes expanded one after another sit together in
+// memory. A block stays alive while any node in it is reachable, which the
+// table and the game's search graph keep most of anyway.
+type nodeArena struct {
+	nodes  []MCGSNode
+	edges  []MCGSEdge
+	floats []float32
+
+	// With a limit, the arena hands out at most limit nodes, and keeps its
+	// blocks so that the node pool can recycle the nodes a search no longer
+	// reaches.
+	limit  int
+	blocks [][]MCGSNode
+	handed int // Nodes handed out from blocks, freed or not
+	free   []*MCGSNode
+
+	peak  int   // Most nodes in use at once since the last measureSearch
+	bytes int64 // Memory taken for nodes and edges
+}
+
+// Sizes of the arena's blocks: 1024 nodes take about 250 KB.
+const (
+	arenaNodes = 1024
+	arenaEdges = 8192
+)
+
+func (a *nodeArena) newNode(gs game.GameState) *MCGSNode {
+	if k := len(a.free); k > 0 {
+		n := a.free[k-1]
+		a.free = a.free[:k-1]
+		n.init(gs)
+		return n
+	}
+	if len(a.nodes) == 0 {
+		size := arenaNodes
+		if a.limit > 0 {
+			size = max(1, min(size, a.limit-a.handed))
+		}
+		a.nodes = make([]MCGSNode, size)
+		a.bytes += int64(size) * int64(unsafe.Sizeof(MCGSNode{}))
+		if a.limit > 0 {
+			a.blocks = append(a.blocks, a.nodes)
+		}
+	}
+	n := &a.nodes[0]
+	a.nodes = a.nodes[1:]
+	a.handed++
+	n.init(gs)
 	return n
 }
 
-func PickRandomBit(bb Bitboard) int {
-	count := bits.OnesCount64(uint64(bb))
-	if count == 0 {
-		return -1
+// growEdges returns n's edge arrays moved to storage for size edges.
+func (a *nodeArena) growEdges(n *MCGSNode, size int) ([]MCGSEdge, []float32, []float32) {
+	if len(a.edges) < size {
+		a.edges = make([]MCGSEdge, max(arenaEdges, size))
+		a.bytes += int64(len(a.edges)) * int64(unsafe.Sizeof(MCGSEdge{}))
 	}
-	if count == 1 {
-		return bits.TrailingZeros64(uint64(bb))
+	if len(a.floats) < 2*size {
+		a.floats = make([]float32, max(2*arenaEdges, 2*size))
+		a.bytes += int64(len(a.floats)) * 4
 	}
-	hi, _ := bits.Mul64(xrand(), uint64(count))
-	return SelectBit64(uint64(bb), int(hi))
+	edges := append(a.edges[:0:size], n.Edges...)
+	qs := append(a.floats[:0:size], n.EdgeQs...)
+	us := append(a.floats[size:size:2*size], n.EdgeUs...)
+	a.edges = a.edges[size:]
+	a.floats = a.floats[2*size:]
+	return edges, qs, us
 }
 
 func ScoreWin(winnerID int) [3]float32 {
@@ -755,7 +635,7 @@ func ScoreTerminal(activeMask uint8, winnerID int) [3]float32 {
 }
 
 // --- Simulation Logic ---
-func RunSimulation(gs *GameState) ([3]float32, int, Board) {
+func RunSimulation(gs *game.GameState, r *Rand) ([3]float32, int, game.Board) {
 	steps := 0
 	for {
 		steps++
@@ -765,11 +645,11 @@ func RunSimulation(gs *GameState) ([3]float32, int, Board) {
 		}
 
 		moves := gs.GetBestMoves()
-		idx := PickRandomBit(moves)
+		idx := r.PickBit(moves)
 		if idx == -1 {
 			return ScoreDraw(gs.ActiveMask), steps, gs.Board
 		}
 
 		gs.ApplyMoveIdx(idx)
 	}
-}
\ No newline at end of file
+}
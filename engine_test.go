@@ -1,13 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
 	"math"
 	"math/bits"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"unsafe"
+
+	"squava/game"
+	"squava/internal/kernels"
 )
 
-func generateRandomBoard(numPieces int) Board {
-	board := Board{}
+func generateRandomBoard(numPieces int) game.Board {
+	board := game.Board{}
 	for j := 0; j < numPieces; j++ {
 		idx := int(xrand() % 64)
 		p := int(xrand() % 3)
@@ -20,141 +34,45 @@ func generateRandomBoard(numPieces int) Board {
 func TestCheckBoard(t *testing.T) {
 	// A horizontal win at the start of the row (A1, B1, C1, D1)
 	// Bits: 0, 1, 2, 3
-	winA1 := Bitboard(0x000000000000000F)
-	isWin, _ := CheckBoard(winA1)
+	winA1 := game.Bitboard(0x000000000000000F)
+	isWin, _ := game.CheckBoard(winA1)
 	if !isWin {
 		t.Errorf("CheckBoard failed to detect horizontal win at A1-D1.")
 	}
 	// A horizontal line that wraps around: G1, H1, A2, B2
 	// Bits: 6, 7, 8, 9
 	// This SHOULD NOT be a win.
-	wrap := Bitboard(0x00000000000003C0)
-	isWin, _ = CheckBoard(wrap)
+	wrap := game.Bitboard(0x00000000000003C0)
+	isWin, _ = game.CheckBoard(wrap)
 	if isWin {
 		t.Errorf("CheckBoard incorrectly detected a wrap-around horizontal line (G1, H1, A2, B2) as a win.")
 	}
 	// Anti-diagonal win starting at H1 (H1, G2, F3, E4)
 	// Bits: 7, 14, 21, 28
-	winH1 := Bitboard((uint64(1) << 7) | (uint64(1) << 14) | (uint64(1) << 21) | (uint64(1) << 28))
-	isWin, _ = CheckBoard(winH1)
+	winH1 := game.Bitboard((uint64(1) << 7) | (uint64(1) << 14) | (uint64(1) << 21) | (uint64(1) << 28))
+	isWin, _ = game.CheckBoard(winH1)
 	if !isWin {
 		t.Errorf("CheckBoard failed to detect anti-diagonal win starting at H1.")
 	}
 }
 
-// slowGetWinsAndLosses is a simple, obviously correct implementation for testing.
-func slowGetWinsAndLosses(bb Bitboard, empty Bitboard) (wins Bitboard, loses Bitboard) {
-	b := uint64(bb)
-	e := uint64(empty)
-	var w, l uint64
-	directions := []struct{ dr, dc int }{
-		{0, 1},
-		{1, 0},
-		{1, 1},
-		{1, -1},
-	}
-	for i := 0; i < 64; i++ {
-		if (e & (1 << uint(i))) == 0 {
-			continue
-		}
-		r, c := i/8, i%8
-		// Check for 4-in-a-row (win)
-		isWin := false
-		for _, dir := range directions {
-			// A win can start at any of 4 offsets relative to the new piece
-			for startOffset := -3; startOffset <= 0; startOffset++ {
-				count := 0
-				for k := 0; k < 4; k++ {
-					nr, nc := r+(startOffset+k)*dir.dr, c+(startOffset+k)*dir.dc
-					if nr >= 0 && nr < 8 && nc >= 0 && nc < 8 {
-						// Check if it's the new piece or an existing piece
-						if (nr == r && nc == c) || (b&(1<<uint(nr*8+nc))) != 0 {
-							count++
-						}
-					}
-				}
-				if count == 4 {
-					isWin = true
-					break
-				}
-			}
-			if isWin {
-				break
-			}
-		}
-		if isWin {
-			w |= (1 << uint(i))
-			continue
-		}
-		// Check for 3-in-a-row (loss)
-		isLoss := false
-		for _, dir := range directions {
-			// A loss can start at any of 3 offsets relative to the new piece
-			for startOffset := -2; startOffset <= 0; startOffset++ {
-				count := 0
-				for k := 0; k < 3; k++ {
-					nr, nc := r+(startOffset+k)*dir.dr, c+(startOffset+k)*dir.dc
-					if nr >= 0 && nr < 8 && nc >= 0 && nc < 8 {
-						if (nr == r && nc == c) || (b&(1<<uint(nr*8+nc))) != 0 {
-							count++
-						}
-					}
-				}
-				if count == 3 {
-					isLoss = true
-					break
-				}
-			}
-			if isLoss {
-				break
-			}
-		}
-		if isLoss {
-			l |= (1 << uint(i))
-		}
-	}
-	return Bitboard(w), Bitboard(l & ^w)
-}
-func FuzzGetWinsAndLossesAgainstSlow(f *testing.F) {
-	f.Add(uint64(0), uint64(0))
-	f.Fuzz(func(t *testing.T, b uint64, e uint64) {
-		wExpected, lExpected := slowGetWinsAndLosses(Bitboard(b), Bitboard(e))
-		wActual, lActual := GetWinsAndLosses(Bitboard(b), Bitboard(e))
-		if wActual != wExpected {
-			t.Errorf("Win bitboard mismatch. Expected %016x, got %016x", uint64(wExpected), uint64(wActual))
-		}
-		if lActual != lExpected {
-			t.Errorf("Loss bitboard mismatch. Expected %016x, got %016x", uint64(lExpected), uint64(lActual))
-		}
-	})
-}
-
 func BenchmarkGetWinsAndLosses(b *testing.B) {
-	bb := Bitboard(0x000000000000000F)
-	empty := Bitboard(0xFFFFFFFFFFFFFFFF)
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		GetWinsAndLosses(bb, empty)
-	}
-}
-
-func BenchmarkGetWinsAndLossesGo(b *testing.B) {
-	bb := Bitboard(0x000000000000000F)
-	empty := Bitboard(0xFFFFFFFFFFFFFFFF)
+	bb := game.Bitboard(0x000000000000000F)
+	empty := game.Bitboard(0xFFFFFFFFFFFFFFFF)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		getWinsAndLossesGo(uint64(bb), uint64(empty))
+		game.GetWinsAndLosses(bb, empty)
 	}
 }
 
 func TestSimulationLogic(t *testing.T) {
 	// Test elimination logic: P0 makes 3-in-a-row and should be eliminated.
-	board := Board{}
+	board := game.Board{}
 	board.Set(0, 0)
 	board.Set(1, 0)
 	// P0 moves to 2, creating 3-in-a-row
-	gs := NewGameState(board, 0, 0x07)
-	gs.ApplyMove(MoveFromIndex(2))
+	gs := game.NewGameState(board, 0, 0x07)
+	gs.ApplyMove(game.MoveFromIndex(2))
 	if gs.WinnerID != -1 {
 		t.Errorf("Expected no winner yet, got %d", gs.WinnerID)
 	}
@@ -165,37 +83,37 @@ func TestSimulationLogic(t *testing.T) {
 		t.Errorf("Expected next player to be 1, got %d", gs.PlayerID)
 	}
 	// Test last man standing: P0 eliminated, P1 eliminated, P2 should win.
-	board = Board{}
+	board = game.Board{}
 	board.Set(0, 0)
 	board.Set(1, 0)
 	board.Set(8, 1)
 	board.Set(9, 1)
 	// P0 moves to 2 -> eliminated. Mask becomes 0x06 (P1, P2)
-	gs1 := NewGameState(board, 0, 0x07)
-	gs1.ApplyMove(MoveFromIndex(2))
+	gs1 := game.NewGameState(board, 0, 0x07)
+	gs1.ApplyMove(game.MoveFromIndex(2))
 	// P1 moves to 10 -> eliminated. Mask becomes 0x04 (P2)
-	gs1.ApplyMove(MoveFromIndex(10))
+	gs1.ApplyMove(game.MoveFromIndex(10))
 	if gs1.WinnerID != 2 {
 		t.Errorf("Expected Player 2 to win as last man standing, got %d", gs1.WinnerID)
 	}
 }
 func TestZobristConsistency(t *testing.T) {
-	board := Board{}
+	board := game.Board{}
 	board.Set(0, 0)
 	board.Set(1, 1)
 	board.Set(2, 2)
-	h1 := zobrist.ComputeHash(board, 0, 0x07)
-	h2 := zobrist.ComputeHash(board, 0, 0x07)
+	h1 := game.ComputeHash(board, 0, 0x07)
+	h2 := game.ComputeHash(board, 0, 0x07)
 	if h1 != h2 {
 		t.Errorf("Hash mismatch for identical states")
 	}
-	h3 := zobrist.ComputeHash(board, 1, 0x07)
+	h3 := game.ComputeHash(board, 1, 0x07)
 	if h1 == h3 {
 		t.Errorf("Hash collision for different turn index")
 	}
 	board2 := board
 	board2.Set(3, 0)
-	h4 := zobrist.ComputeHash(board2, 0, 0x07)
+	h4 := game.ComputeHash(board2, 0, 0x07)
 	if h1 == h4 {
 		t.Errorf("Hash collision for different board state")
 	}
@@ -203,7 +121,7 @@ func TestZobristConsistency(t *testing.T) {
 func TestMCTSTerminal(t *testing.T) {
 	// Test that MCTS can see an immediate win
 	player := NewMCTSPlayer("Test", "T", 0, 100)
-	board := Board{}
+	board := game.Board{}
 	board.Set(0, 0)
 	board.Set(1, 0)
 	board.Set(2, 0)
@@ -214,14 +132,14 @@ func TestMCTSTerminal(t *testing.T) {
 }
 func TestDrawOnFullBoard(t *testing.T) {
 	// Create a board that is almost full
-	board := Board{}
+	board := game.Board{}
 	// Fill almost everything with a pattern that doesn't create wins/losses
 	for i := 0; i < 63; i++ {
 		board.Set(i, (i/2)%3)
 	}
 	// Simulation should terminate with a draw if no moves left
-	gs := NewGameState(board, 0, 0x07)
-	res, _, _ := RunSimulation(&gs)
+	gs := game.NewGameState(board, 0, 0x07)
+	res, _, _ := RunSimulation(&gs, &mainRand)
 	// Expected draw score for 3 players is 1/3 each
 	expected := float32(1.0 / 3.0)
 	for i := 0; i < 3; i++ {
@@ -230,10 +148,125 @@ func TestDrawOnFullBoard(t *testing.T) {
 		}
 	}
 }
+func TestSquavaRulesFullBoard(t *testing.T) {
+	// X's last stone on E3 fills the board and makes 3 in a row: X is out,
+	// and O and Z are left with no squares to play.
+	gs, err := game.ParsePosition("XOXZZXZO/OXOXOOZZ/OXZZOXXO/ZZOXXZOZ/XOXZOXOZ/ZZOO1ZZX/XOXZXXOX/ZOZXXOZO 1 123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules SquavaRules
+	if _, over := rules.Terminal(&gs); over {
+		t.Fatal("Expected the game to go on with one square left")
+	}
+	rules.Play(&gs, 20)
+	winner, over := rules.Terminal(&gs)
+	if r := rules.Rewards(&gs); !over || winner != -1 || r != [3]float32{0, 0.5, 0.5} {
+		t.Errorf("Expected a draw between O and Z, got over %v, winner %d, rewards %v", over, winner, r)
+	}
+}
+
+// gravityRules are squava with stones that fall to the lowest empty square of
+// their column, as a variant would plug in through Rules.
+type gravityRules struct{ SquavaRules }
+
+func (gravityRules) LegalMoves(gs *game.GameState) game.Bitboard {
+	if gs.Terminal {
+		return 0
+	}
+	var moves game.Bitboard
+	for c := 0; c < game.BoardSize; c++ {
+		for r := 0; r < game.BoardSize; r++ {
+			if bit := game.Bitboard(1) << uint(r*game.BoardSize+c); gs.Board.Occupied&bit == 0 {
+				moves |= bit
+				break
+			}
+		}
+	}
+	return moves
+}
+
+func TestRulesVariant(t *testing.T) {
+	var rules gravityRules
+	start := rules.Start()
+	if moves := rules.LegalMoves(&start); moves != 0xFF {
+		t.Errorf("Expected the first rank to be legal, got %x", uint64(moves))
+	}
+	// X has A1 B1 C1 and wins on D1, which is on the floor.
+	var board game.Board
+	for idx, p := range map[int]int{0: 0, 1: 0, 2: 0, 7: 1, 15: 1, 6: 2, 14: 2} {
+		board.Set(idx, p)
+	}
+	p := NewMCTSPlayer("Gravity", "G", 0, 500)
+	p.SetRand(NewRand(1))
+	p.SetRules(rules)
+	if m := p.GetMove(board, []int{0, 1, 2}, 0); m.ToIndex() != 3 {
+		t.Errorf("Expected the search to win on D1, got %v", m)
+	}
+	gs := game.NewGameState(board, 0, 0b111)
+	rules.Play(&gs, 3)
+	if winner, over := rules.Terminal(&gs); !over || winner != 0 {
+		t.Errorf("Expected X to win, got over %v, winner %d", over, winner)
+	}
+
+	// With X's three on the second rank and D1 empty, D2 would win at
+	// squava, but under gravity only D1 can be played in that column.
+	board = game.Board{}
+	for idx, p := range map[int]int{0: 1, 1: 2, 2: 1, 8: 0, 9: 0, 10: 0, 7: 2} {
+		board.Set(idx, p)
+	}
+	p.SetRules(rules)
+	gs = game.NewGameState(board, 0, 0b111)
+	if m := p.GetMove(board, []int{0, 1, 2}, 0); rules.LegalMoves(&gs)&(game.Bitboard(1)<<uint(m.ToIndex())) == 0 {
+		t.Fatalf("Expected a move that is legal under gravity, got %v", m)
+	}
+	for i := range p.root.Edges {
+		if m := p.root.Edges[i].Move; rules.LegalMoves(&gs)&(game.Bitboard(1)<<uint(m.ToIndex())) == 0 {
+			t.Errorf("Expected the search to try only legal moves, got %v", m)
+		}
+	}
+	squava := NewMCTSPlayer("Squava", "S", 0, 500)
+	squava.SetRand(NewRand(1))
+	squava.SetRules(SquavaRules{})
+	if squava.rules != nil {
+		t.Error("Expected SquavaRules to keep the fast path")
+	}
+	if m := squava.GetMove(board, []int{0, 1, 2}, 0); m.ToIndex() != 11 {
+		t.Errorf("Expected squava to win on D2, got %v", m)
+	}
+}
+
+// TestRulesSwitchThreads checks that switching rules leaves no node of the
+// old rules in the helpers' graphs for them to search from.
+func TestRulesSwitchThreads(t *testing.T) {
+	var board game.Board
+	for idx, p := range map[int]int{0: 0, 1: 1, 2: 2} {
+		board.Set(idx, p)
+	}
+	gs := game.NewGameState(board, 0, 0b111)
+	var rules gravityRules
+	p := NewMCTSPlayer("Switch", "S", 0, 400)
+	p.SetRand(NewRand(1))
+	p.SetThreads(2, true)
+	p.GetMove(board, []int{0, 1, 2}, 0)
+	p.SetRules(rules)
+	p.GetMove(board, []int{0, 1, 2}, 0)
+	for _, h := range p.helpers {
+		if h.root == nil {
+			t.Fatal("Expected the helper to search")
+		}
+		for i := range h.root.Edges {
+			if m := h.root.Edges[i].Move; rules.LegalMoves(&gs)&(game.Bitboard(1)<<uint(m.ToIndex())) == 0 {
+				t.Fatalf("Expected the helper to try only moves legal under gravity, got %v", m)
+			}
+		}
+	}
+}
+
 func TestMCTSHeuristic(t *testing.T) {
 	// Test that MCTS respects the GetBestMoves heuristic (blocking opponent)
 	player := NewMCTSPlayer("AI", "A", 0, 100)
-	board := Board{}
+	board := game.Board{}
 	// Player 1 (next) has 3 in a row at A1, A2, A3
 	board.Set(0, 1)  // A1
 	board.Set(8, 1)  // A2
@@ -246,32 +279,32 @@ func TestMCTSHeuristic(t *testing.T) {
 }
 func TestRunSimulationDetailed(t *testing.T) {
 	// 1. Immediate win detection
-	board := Board{}
+	board := game.Board{}
 	board.Set(0, 0) // A1
 	board.Set(1, 0) // B1
 	board.Set(2, 0) // C1
 	// P0 to move, D1 (3) is win
-	gs1 := NewGameState(board, 0, 0x07)
-	res, _, _ := RunSimulation(&gs1)
+	gs1 := game.NewGameState(board, 0, 0x07)
+	res, _, _ := RunSimulation(&gs1, &mainRand)
 	if res[0] != 1.0 {
 		t.Errorf("Immediate win failed. Expected P0 win, got %v", res)
 	}
 	// 2. Forced block detection
-	board = Board{}
+	board = game.Board{}
 	board.Set(0, 1) // P1: A1
 	board.Set(1, 1) // P1: B1
 	board.Set(2, 1) // P1: C1
 	// P0 to move, P1 is next. P0 must block at D1 (3)
-	// We seed xorState to ensure we don't just "get lucky"
-	xorState = 42
-	gs2 := NewGameState(board, 0, 0x07)
-	res, steps, _ := RunSimulation(&gs2)
+	// We seed the random numbers to ensure we don't just "get lucky"
+	mainRand.Seed(42)
+	gs2 := game.NewGameState(board, 0, 0x07)
+	res, steps, _ := RunSimulation(&gs2, &mainRand)
 	// If P0 blocks correctly, the game should continue for more than 1 step
 	if steps <= 1 && res[1] == 1.0 {
 		t.Errorf("Forced block failed. P0 should have blocked P1's win at D1. Steps: %d, Result: %v", steps, res)
 	}
 	// 3. Elimination logic
-	board = Board{}
+	board = game.Board{}
 	// Set up P0 so any move is a loss
 	board.Set(0, 0) // A1
 	board.Set(8, 0) // A2
@@ -283,14 +316,14 @@ func TestRunSimulationDetailed(t *testing.T) {
 		}
 	}
 	// Only bit 16 is empty. P0 must move there.
-	gs3 := NewGameState(board, 0, 0x07)
-	res, _, _ = RunSimulation(&gs3)
+	gs3 := game.NewGameState(board, 0, 0x07)
+	res, _, _ = RunSimulation(&gs3, &mainRand)
 	if res[0] == 1.0 {
 		t.Errorf("Elimination failed. P0 should have lost, but won: %v", res)
 	}
 }
-func referenceRunSimulation(board Board, activeMask uint8, currentID int) ([3]float32, Board) {
-	gs := NewGameState(board, currentID, activeMask)
+func referenceRunSimulation(board game.Board, activeMask uint8, currentID int) ([3]float32, game.Board) {
+	gs := game.NewGameState(board, currentID, activeMask)
 	for {
 		if winnerID, ok := gs.IsTerminal(); ok {
 			return ScoreTerminal(gs.ActiveMask, winnerID), gs.Board
@@ -302,18 +335,18 @@ func referenceRunSimulation(board Board, activeMask uint8, currentID int) ([3]fl
 			return ScoreDraw(gs.ActiveMask), gs.Board
 		}
 
-		gs.ApplyMove(MoveFromIndex(idx))
+		gs.ApplyMove(game.MoveFromIndex(idx))
 	}
 }
 func FuzzRunSimulation(f *testing.F) {
 	f.Add(uint64(1), uint64(0)) // seed, boardPieces
 	f.Fuzz(func(t *testing.T, seed uint64, boardPieces uint64) {
-		xorState = seed
+		mainRand.Seed(seed)
 		numPieces := int(boardPieces % 40)
 		board := generateRandomBoard(numPieces)
 		won := false
 		for p := 0; p < 3; p++ {
-			isW, isL := CheckBoard(board.P[p])
+			isW, isL := game.CheckBoard(board.P[p])
 			if isW || isL {
 				won = true
 				break
@@ -324,10 +357,10 @@ func FuzzRunSimulation(f *testing.F) {
 		}
 		// Ensure both use exact same random sequence
 		runSeed := xrand()
-		xorState = runSeed
-		gs := NewGameState(board, 0, 0x07)
-		resOpt, _, boardOpt := RunSimulation(&gs)
-		xorState = runSeed
+		mainRand.Seed(runSeed)
+		gs := game.NewGameState(board, 0, 0x07)
+		resOpt, _, boardOpt := RunSimulation(&gs, &mainRand)
+		mainRand.Seed(runSeed)
 		resRef, boardRef := referenceRunSimulation(board, 0x07, 0)
 		if resOpt != resRef {
 			t.Errorf("Result mismatch. Opt: %v, Ref: %v", resOpt, resRef)
@@ -340,7 +373,7 @@ func FuzzRunSimulation(f *testing.F) {
 func FuzzZobristIncremental(f *testing.F) {
 	f.Add(uint64(1), uint64(20))
 	f.Fuzz(func(t *testing.T, seed uint64, numPieces uint64) {
-		xorState = seed
+		mainRand.Seed(seed)
 		board := generateRandomBoard(int(numPieces % 40))
 		var activeMask uint8
 		for {
@@ -362,11 +395,11 @@ func FuzzZobristIncremental(f *testing.F) {
 		}
 		count := bits.OnesCount64(uint64(empty))
 		n := int(xrand() % uint64(count))
-		idx := SelectBit64(uint64(empty), n)
-		move := MoveFromIndex(idx)
-		gs := NewGameState(board, currentID, activeMask)
+		idx := kernels.SelectBit64(uint64(empty), n)
+		move := game.MoveFromIndex(idx)
+		gs := game.NewGameState(board, currentID, activeMask)
 		gs.ApplyMove(move)
-		refHash := zobrist.ComputeHash(gs.Board, gs.PlayerID, gs.ActiveMask)
+		refHash := game.ComputeHash(gs.Board, gs.PlayerID, gs.ActiveMask)
 		if gs.Hash != refHash {
 			t.Errorf("Hash mismatch. Incremental: %016x, Reference: %016x", gs.Hash, refHash)
 		}
@@ -393,7 +426,7 @@ func FuzzSelectBit64Internal(f *testing.F) {
 			return 64
 		}
 		expected := referenceSelectBit64(v, k)
-		actual := SelectBit64(v, k)
+		actual := kernels.SelectBit64(v, k)
 		if actual != expected {
 			t.Errorf("Mismatch for v=%016x, k=%d. Expected bit %d, got %d", v, k, expected, actual)
 		}
@@ -402,11 +435,11 @@ func FuzzSelectBit64Internal(f *testing.F) {
 func FuzzHeuristicMoveGeneration(f *testing.F) {
 	f.Add(uint64(1), uint64(25))
 	f.Fuzz(func(t *testing.T, seed uint64, numPieces64 uint64) {
-		xorState = seed
+		mainRand.Seed(seed)
 		board := generateRandomBoard(int(numPieces64 % 40))
 		clean := true
 		for p := 0; p < 3; p++ {
-			isW, isL := CheckBoard(board.P[p])
+			isW, isL := game.CheckBoard(board.P[p])
 			if isW || isL {
 				clean = false
 				break
@@ -416,8 +449,8 @@ func FuzzHeuristicMoveGeneration(f *testing.F) {
 			return
 		}
 		currentID := int(xrand() % 3)
-		gs := NewGameState(board, currentID, 0x07)
-		forced := GetForcedMoves(board, []int{0, 1, 2}, currentID)
+		gs := game.NewGameState(board, currentID, 0x07)
+		forced := game.GetForcedMoves(board, []int{0, 1, 2}, currentID)
 		best := gs.GetBestMoves()
 		myWins := gs.Wins[currentID]
 		myLoses := gs.Loses[currentID]
@@ -433,7 +466,7 @@ func FuzzHeuristicMoveGeneration(f *testing.F) {
 			idx := bits.TrailingZeros64(uint64(w))
 			testBoard := board
 			testBoard.Set(idx, currentID)
-			isWin, _ := CheckBoard(testBoard.P[currentID])
+			isWin, _ := game.CheckBoard(testBoard.P[currentID])
 			if !isWin {
 				t.Errorf("GameState claimed immediate win at %d, but CheckBoard said no.", idx)
 			}
@@ -444,7 +477,7 @@ func FuzzHeuristicMoveGeneration(f *testing.F) {
 			idx := bits.TrailingZeros64(uint64(nw))
 			testBoard := board
 			testBoard.Set(idx, nextID)
-			isWin, _ := CheckBoard(testBoard.P[nextID])
+			isWin, _ := game.CheckBoard(testBoard.P[nextID])
 			if !isWin {
 				t.Errorf("GameState claimed opponent win at %d, but CheckBoard said no.", idx)
 			}
@@ -455,7 +488,7 @@ func FuzzHeuristicMoveGeneration(f *testing.F) {
 			idx := bits.TrailingZeros64(uint64(l))
 			testBoard := board
 			testBoard.Set(idx, currentID)
-			_, isLoss := CheckBoard(testBoard.P[currentID])
+			_, isLoss := game.CheckBoard(testBoard.P[currentID])
 			if !isLoss {
 				t.Errorf("GameState claimed self-loss at %d, but CheckBoard said no.", idx)
 			}
@@ -484,7 +517,7 @@ func FuzzHeuristicMoveGeneration(f *testing.F) {
 		}
 	})
 }
-func ValidateMCTSGraph(t *testing.T, root *MCGSNode, rootGS GameState) {
+func ValidateMCTSGraph(t *testing.T, root *MCGSNode, rootGS game.GameState) {
 	if root == nil {
 		t.Error("Root is nil")
 		return
@@ -493,8 +526,8 @@ func ValidateMCTSGraph(t *testing.T, root *MCGSNode, rootGS GameState) {
 	visited := make(map[*MCGSNode]bool)
 	// Track recursion stack for cycle detection
 	stack := make(map[*MCGSNode]bool)
-	var checkNode func(node *MCGSNode, gs GameState)
-	checkNode = func(node *MCGSNode, gs GameState) {
+	var checkNode func(node *MCGSNode, gs game.GameState)
+	checkNode = func(node *MCGSNode, gs game.GameState) {
 		// 1. Cycle Detection
 		if stack[node] {
 			t.Errorf("Cycle detected in MCTS graph at node hash %016x", gs.Hash)
@@ -560,7 +593,7 @@ func ValidateMCTSGraph(t *testing.T, root *MCGSNode, rootGS GameState) {
 func FuzzMCTSInvariants(f *testing.F) {
 	f.Add(uint64(1), uint64(25), uint64(200))
 	f.Fuzz(func(t *testing.T, seed uint64, numPieces64 uint64, mctsIters64 uint64) {
-		xorState = seed
+		mainRand.Seed(seed)
 		mctsIters := int(mctsIters64 % 1000)
 		if mctsIters < 10 {
 			mctsIters = 10
@@ -568,7 +601,7 @@ func FuzzMCTSInvariants(f *testing.F) {
 		board := generateRandomBoard(int(numPieces64 % 40))
 		clean := true
 		for p := 0; p < 3; p++ {
-			isW, isL := CheckBoard(board.P[p])
+			isW, isL := game.CheckBoard(board.P[p])
 			if isW || isL {
 				clean = false
 				break
@@ -584,15 +617,15 @@ func FuzzMCTSInvariants(f *testing.F) {
 			t.Errorf("MCTS did not generate a root node")
 			return
 		}
-		rootGS := NewGameState(board, 0, 0x07)
+		rootGS := game.NewGameState(board, 0, 0x07)
 		ValidateMCTSGraph(t, player.root, rootGS)
 	})
 }
 func FuzzFullGameTermination(f *testing.F) {
 	f.Add(uint64(1))
 	f.Fuzz(func(t *testing.T, seed uint64) {
-		xorState = seed
-		board := Board{}
+		mainRand.Seed(seed)
+		board := game.Board{}
 		activeMask := uint8(0x07)
 		currentPID := 0
 		players := []int{0, 1, 2}
@@ -603,15 +636,15 @@ func FuzzFullGameTermination(f *testing.F) {
 			}
 			count := bits.OnesCount64(uint64(empty))
 			n := int(xrand() % uint64(count))
-			idx := SelectBit64(uint64(empty), n)
+			idx := kernels.SelectBit64(uint64(empty), n)
 			board.Set(idx, currentPID)
-			isWin, isLoss := CheckBoard(board.P[currentPID])
+			isWin, isLoss := game.CheckBoard(board.P[currentPID])
 			if isWin {
 				for _, p := range players {
 					if p == currentPID {
 						continue
 					}
-					w, _ := CheckBoard(board.P[p])
+					w, _ := game.CheckBoard(board.P[p])
 					if w {
 						t.Errorf("Invalid state. Multiple players have wins.")
 					}
@@ -630,12 +663,12 @@ func FuzzFullGameTermination(f *testing.F) {
 					goto GameEnd
 				}
 			}
-			if board.Occupied == Bitboard(0xFFFFFFFFFFFFFFFF) {
+			if board.Occupied == game.Bitboard(0xFFFFFFFFFFFFFFFF) {
 				goto GameEnd
 			}
-			nextPID := int(nextPlayerTable[currentPID][activeMask])
+			nextPID := game.NextPlayer(currentPID, activeMask)
 			if nextPID == -1 {
-				t.Errorf("nextPlayerTable returned -1 for activeMask %02x", activeMask)
+				t.Errorf("NextPlayer returned -1 for activeMask %02x", activeMask)
 				goto GameEnd
 			}
 			currentPID = nextPID
@@ -643,7 +676,7 @@ func FuzzFullGameTermination(f *testing.F) {
 	GameEnd:
 		winCount := 0
 		for p := 0; p < 3; p++ {
-			isW, _ := CheckBoard(board.P[p])
+			isW, _ := game.CheckBoard(board.P[p])
 			if isW {
 				winCount++
 			}
@@ -703,7 +736,7 @@ func TestIncrementalUpdateEquivalence(t *testing.T) {
 func TestMCTSBackpropIncremental(t *testing.T) {
 	// Test the actual Backprop method of MCTSPlayer
 	m := NewMCTSPlayer("Test", "T", 0, 100)
-	gs := NewGameState(Board{}, 0, 0x07)
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
 	node := NewMCGSNode(gs)
 
 	path := []PathStep{{Node: node, EdgeIdx: -1}}
@@ -732,14 +765,14 @@ func TestMCTSBackpropIncremental(t *testing.T) {
 }
 
 func TestMCGSNodeMethods(t *testing.T) {
-	gs1 := NewGameState(Board{}, 0, 0x07)
+	gs1 := game.NewGameState(game.Board{}, 0, 0x07)
 	node := NewMCGSNode(gs1)
-	gs2 := NewGameState(Board{}, 1, 0x07)
+	gs2 := game.NewGameState(game.Board{}, 1, 0x07)
 	child := NewMCGSNode(gs2)
 	child.Q = [3]float32{0.1, 0.2, 0.3}
 
 	// Test AddEdge
-	move := Move{r: 1, c: 1}
+	move := game.MoveFromIndex(9)
 	idx := node.AddEdge(move, child, gs1.PlayerID)
 	if idx != 0 {
 		t.Errorf("Expected edge index 0, got %d", idx)
@@ -778,8 +811,8 @@ func TestMCGSNodeMethods(t *testing.T) {
 	}
 
 	// Test PopUntriedMove
-	node.untriedMoves = Bitboard(1 << 5)
-	mv, ok := node.PopUntriedMove()
+	node.untriedMoves = game.Bitboard(1 << 5)
+	mv, ok := node.PopUntriedMove(&mainRand)
 	if !ok || mv.ToIndex() != 5 {
 		t.Errorf("PopUntriedMove failed: got %v, %v", mv, ok)
 	}
@@ -789,9 +822,9 @@ func TestMCGSNodeMethods(t *testing.T) {
 }
 
 func TestTranspositionTableMethods(t *testing.T) {
-	table := make(TranspositionTable, TTSize)
-	board := Board{}
-	gs := NewGameState(board, 0, 0x07)
+	table := NewTranspositionTable(TTSize)
+	board := game.Board{}
+	gs := game.NewGameState(board, 0, 0x07)
 	node := NewMCGSNode(gs)
 
 	table.Store(gs.Hash, node)
@@ -808,89 +841,37 @@ func TestTranspositionTableMethods(t *testing.T) {
 	}
 	gsWrongPlayer := gs
 	gsWrongPlayer.PlayerID = 1
-	gsWrongPlayer.Hash = zobrist.ComputeHash(gsWrongPlayer.Board, gsWrongPlayer.PlayerID, gsWrongPlayer.ActiveMask)
+	gsWrongPlayer.Hash = game.ComputeHash(gsWrongPlayer.Board, gsWrongPlayer.PlayerID, gsWrongPlayer.ActiveMask)
 	if table.Lookup(&gsWrongPlayer) != nil {
 		t.Errorf("Lookup should fail for different playerID")
 	}
 }
 
-func TestZobristHelper(t *testing.T) {
-	h := uint64(100)
-	h2 := zobrist.Move(h, 0, 10)
-	if h2 != h^zobrist.piece[0][10] {
-		t.Errorf("Zobrist.Move failed")
-	}
-
-	h3 := zobrist.SwapTurn(h, 0, 1)
-	if h3 != h^zobrist.turn[0]^zobrist.turn[1] {
-		t.Errorf("Zobrist.SwapTurn failed for non-terminal")
-	}
-
-	h4 := zobrist.SwapTurn(h, 0, -1)
-	if h4 != h^zobrist.turn[0] {
-		t.Errorf("Zobrist.SwapTurn failed for terminal")
-	}
-
-	h5 := zobrist.UpdateMask(h, 0x07, 0x03)
-	if h5 != h^zobrist.active[0x07]^zobrist.active[0x03] {
-		t.Errorf("Zobrist.UpdateMask failed")
-	}
-}
-
 func TestGameRulesHelper(t *testing.T) {
 	// Test IsTerminal
-	gs := NewGameState(Board{}, 0, 0x01)
+	gs := game.NewGameState(game.Board{}, 0, 0x01)
 	if winner, ok := gs.IsTerminal(); !ok || winner != 0 {
 		t.Errorf("IsTerminal failed for single player mask 0x01: got %v, %v", winner, ok)
 	}
-	gs = NewGameState(Board{}, 0, 0x03)
+	gs = game.NewGameState(game.Board{}, 0, 0x03)
 	if _, ok := gs.IsTerminal(); ok {
 		t.Errorf("IsTerminal should be false for multi-player mask 0x03")
 	}
 }
 
-func TestPdep(t *testing.T) {
-	// PDEP mask, src -> spreads bits of src into mask
-	// In our code: pdep(1<<k, v)
-	// src = 1<<k, mask = v
-	// This should return a uint64 with only the k-th set bit of v set.
-
-	tests := []struct {
-		v    uint64
-		k    int
-		want uint64
-	}{
-		{0b101010, 0, 1 << 1},
-		{0b101010, 1, 1 << 3},
-		{0b101010, 2, 1 << 5},
-		{0b111, 0, 1 << 0},
-		{0b111, 1, 1 << 1},
-		{0b111, 2, 1 << 2},
-		{0x8000000000000001, 0, 1 << 0},
-		{0x8000000000000001, 1, 1 << 63},
-	}
-
-	for _, tc := range tests {
-		got := pdep(uint64(1)<<uint(tc.k), tc.v)
-		if got != tc.want {
-			t.Errorf("pdep(1<<%d, %b) = %b, want %b", tc.k, tc.v, got, tc.want)
-		}
-	}
-}
-
 func TestSelectBit64(t *testing.T) {
 	v := uint64(0b101010)
 	// k=0 -> bit 1
 	// k=1 -> bit 3
 	// k=2 -> bit 5
 
-	if got := SelectBit64(v, 0); got != 1 {
+	if got := kernels.SelectBit64(v, 0); got != 1 {
 		t.Errorf("SelectBit64(0b101010, 0) = %d, want 1", got)
 	}
-	if got := SelectBit64(v, 1); got != 3 {
+	if got := kernels.SelectBit64(v, 1); got != 3 {
 		t.Errorf("SelectBit64(0b101010, 1) = %d, want 3", got)
 	}
-	if got := SelectBit64(v, 2); got != 5 {
+	if got := kernels.SelectBit64(v, 2); got != 5 {
 		t.Errorf("SelectBit64(0b101010, 2) = %d, want 5", got)
 	}
 }
@@ -898,11 +879,11 @@ func TestSelectBit64(t *testing.T) {
 func FuzzIncrementalThreats(f *testing.F) {
 	f.Add(uint64(1), uint64(25))
 	f.Fuzz(func(t *testing.T, seed uint64, numPieces64 uint64) {
-		xorState = seed
+		mainRand.Seed(seed)
 		board := generateRandomBoard(int(numPieces64 % 40))
 		clean := true
 		for p := 0; p < 3; p++ {
-			isW, isL := CheckBoard(board.P[p])
+			isW, isL := game.CheckBoard(board.P[p])
 			if isW || isL {
 				clean = false
 				break
@@ -931,12 +912,12 @@ func FuzzIncrementalThreats(f *testing.F) {
 		}
 		count := bits.OnesCount64(uint64(empty))
 		n := int(xrand() % uint64(count))
-		idx := SelectBit64(uint64(empty), n)
-		move := MoveFromIndex(idx)
-		gs := NewGameState(board, currentID, activeMask)
+		idx := kernels.SelectBit64(uint64(empty), n)
+		move := game.MoveFromIndex(idx)
+		gs := game.NewGameState(board, currentID, activeMask)
 		mover := gs.PlayerID
 		gs.ApplyMove(move)
-		refGS := NewGameState(gs.Board, gs.PlayerID, gs.ActiveMask)
+		refGS := game.NewGameState(gs.Board, gs.PlayerID, gs.ActiveMask)
 		if gs.WinnerID != -1 {
 			return
 		}
@@ -955,7 +936,7 @@ func FuzzIncrementalThreats(f *testing.F) {
 }
 func BenchmarkMCTSBlankBoard10k(b *testing.B) {
 	player := NewMCTSPlayer("Bench", "B", 0, 10000)
-	gs := NewGameState(Board{}, 0, 0x07)
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
@@ -970,9 +951,9 @@ func selectBestEdgeGoRef(qs []float32, us []float32, coeff float32) int {
 		return -1
 	}
 	bestIdx := 0
-	bestScore := qs[0] + coeff*us[0]
+	bestScore := qs[0] + float32(coeff*us[0])
 	for i := 1; i < len(qs); i++ {
-		score := qs[i] + coeff*us[i]
+		score := qs[i] + float32(coeff*us[i])
 		if score > bestScore {
 			bestScore = score
 			bestIdx = i
@@ -1007,35 +988,1702 @@ func FuzzSelectBestEdge(f *testing.F) {
 			coeff = 1.0
 		}
 
-		got := selectBestEdgeAVX2(qs, us, coeff)
+		got := kernels.SelectBestEdge(qs, us, coeff)
 		if got == -1 {
 			return
 		}
 		want := selectBestEdgeGoRef(qs, us, coeff)
-		if got != want {
-			scoreGot := qs[got] + coeff*us[got]
-			scoreWant := qs[want] + coeff*us[want]
-
-			// Use relative tolerance for large values to account for FMA vs sequential precision
-			absDiff := math.Abs(float64(scoreGot - scoreWant))
-			maxVal := math.Max(math.Abs(float64(scoreGot)), math.Abs(float64(scoreWant)))
-			if maxVal > 0 && absDiff/maxVal > 1e-6 {
-				t.Errorf("coeff=%f, n=%d", coeff, n)
-				t.Errorf("got=%d: qs[%d]=%e, us[%d]=%e, score=%e", got, got, qs[got], got, us[got], scoreGot)
-				t.Errorf("want=%d: qs[%d]=%e, us[%d]=%e, score=%e", want, want, qs[want], want, us[want], scoreWant)
-				t.Errorf("AVX index %d (score %e) != Go index %d (score %e)", got, scoreGot, want, scoreWant)
+		for i := range qs {
+			// A NaN score, such as Inf times 0, compares unlike any other.
+			if math.IsNaN(float64(qs[i] + float32(coeff*us[i]))) {
+				return
 			}
 		}
+		// The kernels score and break ties alike, so that seeds give the
+		// same games on every platform.
+		if got != want {
+			t.Errorf("coeff=%e, n=%d: SIMD index %d (score %e) != Go index %d (score %e)",
+				coeff, n, got, qs[got]+float32(coeff*us[got]), want, qs[want]+float32(coeff*us[want]))
+		}
 	})
 }
 
 func FuzzWinsLossesSIMD(f *testing.F) {
 	f.Add(uint64(0), uint64(0))
 	f.Fuzz(func(t *testing.T, board uint64, empty uint64) {
-		wAVX, lAVX := getWinsAndLossesAVX2(board, empty)
-		wGo, lGo := getWinsAndLossesGo(board, empty)
+		wAVX, lAVX := kernels.WinsAndLosses(board, empty)
+		wGo, lGo := kernels.WinsAndLossesGo(board, empty)
 		if wAVX != wGo || lAVX != lGo {
 			t.Errorf("AVX(w:%x, l:%x) != Go(w:%x, l:%x)", wAVX, lAVX, wGo, lGo)
 		}
 	})
 }
+
+func TestLegalMoves(t *testing.T) {
+	// Empty board: every square is legal.
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
+	if gs.LegalMoves() != ^game.Bitboard(0) {
+		t.Errorf("Expected all squares legal on empty board, got %x", gs.LegalMoves())
+	}
+
+	// Player 1 (ID 1) threatens D1; Player 0 must block.
+	board := game.Board{}
+	board.Set(0, 1)
+	board.Set(1, 1)
+	board.Set(2, 1)
+	board.Set(63, 0)
+	gs = game.NewGameState(board, 0, 0x07)
+	if gs.LegalMoves() != game.Bitboard(1<<3) {
+		t.Errorf("Expected only D1 legal, got %x", gs.LegalMoves())
+	}
+	if gs.LegalMoves() != game.GetForcedMoves(board, []int{0, 1, 2}, 0) {
+		t.Errorf("LegalMoves disagrees with GetForcedMoves")
+	}
+
+	// Terminal state has no legal moves.
+	gs.ApplyMoveIdx(3)
+	gs.Terminal, gs.WinnerID, gs.PlayerID = true, 0, -1
+	if gs.LegalMoves() != 0 {
+		t.Errorf("Expected no legal moves in terminal state, got %x", gs.LegalMoves())
+	}
+}
+
+// refRun returns the length of the longest row, column or diagonal run of
+// the stones in bb through idx, following the squares' coordinates rather
+// than the shifts and masks of the threat kernels.
+func refRun(bb game.Bitboard, idx int) int {
+	f, r := idx%8, idx/8
+	longest := 0
+	for _, d := range [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}} {
+		n := 1
+		for _, s := range []int{1, -1} {
+			x, y := f+s*d[0], r+s*d[1]
+			for x >= 0 && x < 8 && y >= 0 && y < 8 && bb&(game.Bitboard(1)<<uint(y*8+x)) != 0 {
+				n++
+				x, y = x+s*d[0], y+s*d[1]
+			}
+		}
+		longest = max(longest, n)
+	}
+	return longest
+}
+
+// TestForcedMovesCorpus checks the forced moves, wins and self-losses of the
+// bitboard implementation against the rules applied square by square, on
+// every filling of a few 7-square lines with the three players' stones, for
+// every player to move and set of players still in the game. Some lines run
+// along the board; the others are runs of square indices that wrap around
+// its edges, where a shift that is not masked would find a line that is not
+// there. A sample of every 16th filling is also checked against the forced
+// moves the exact solver finds.
+func TestForcedMovesCorpus(t *testing.T) {
+	lines := []struct{ start, stride int }{
+		{24, 1}, // A4-G4
+		{15, 8}, // H2-H8
+		{0, 9},  // A1-G7
+		{7, 7},  // H1-B7
+		{5, 1},  // F1-H1, A2-D2
+		{5, 9},  // F1-H3, A5-D8
+		{2, 7},  // C1-A3, H3-E6
+	}
+	var positions, wins, blocks, solved int
+	for _, line := range lines {
+		for filling := 0; filling < 1<<14; filling++ {
+			board := game.Board{}
+			for i := 0; i < 7; i++ {
+				if p := filling >> (2 * i) & 3; p != 3 {
+					board.Set(line.start+i*line.stride, p)
+				}
+			}
+			// Skip boards a game cannot reach, with a 3 or 4 in a row.
+			reachable := true
+			for p := 0; p < 3; p++ {
+				for bb := board.P[p]; bb != 0; bb &= bb - 1 {
+					if refRun(board.P[p], bits.TrailingZeros64(uint64(bb))) >= 3 {
+						reachable = false
+					}
+				}
+			}
+			if !reachable {
+				continue
+			}
+			var refWins, refLoses [3]game.Bitboard
+			for p := 0; p < 3; p++ {
+				for bb := ^board.Occupied; bb != 0; bb &= bb - 1 {
+					idx := bits.TrailingZeros64(uint64(bb))
+					switch refRun(board.P[p]|game.Bitboard(1)<<uint(idx), idx) {
+					case 3:
+						refLoses[p] |= game.Bitboard(1) << uint(idx)
+					case 4, 5, 6, 7, 8:
+						refWins[p] |= game.Bitboard(1) << uint(idx)
+					}
+				}
+			}
+
+			for _, mask := range []uint8{0b111, 0b011, 0b101, 0b110} {
+				for me := 0; me < 3; me++ {
+					if mask&(1<<uint(me)) == 0 {
+						continue
+					}
+					next := (me + 1) % 3
+					if mask&(1<<uint(next)) == 0 {
+						next = (next + 1) % 3
+					}
+					want := refWins[me]
+					if want == 0 {
+						want = refWins[next]
+					}
+					gs := game.NewGameState(board, me, mask)
+					if gs.Wins[me] != refWins[me] || gs.Loses[me] != refLoses[me] || gs.ForcedMoves() != want {
+						t.Fatalf("%s: wins [%s], loses [%s], forced [%s]; want [%s], [%s], [%s]",
+							game.FormatPosition(gs), formatSquares(gs.Wins[me]), formatSquares(gs.Loses[me]), formatSquares(gs.ForcedMoves()),
+							formatSquares(refWins[me]), formatSquares(refLoses[me]), formatSquares(want))
+					}
+					var players []int
+					for p := 0; p < 3; p++ {
+						if mask&(1<<uint(p)) != 0 {
+							players = append(players, p)
+						}
+					}
+					if got := game.GetForcedMoves(board, players, slices.Index(players, me)); got != want {
+						t.Fatalf("%s: GetForcedMoves gives [%s], want [%s]", game.FormatPosition(gs), formatSquares(got), formatSquares(want))
+					}
+					if filling%16 == 0 {
+						if got := solverForcedMoves(t, gs); got != want {
+							t.Fatalf("%s: the solver forces [%s], want [%s]", game.FormatPosition(gs), formatSquares(got), formatSquares(want))
+						}
+						solved++
+					}
+					positions++
+					if refWins[me] != 0 {
+						wins++
+					} else if want != 0 {
+						blocks++
+					}
+				}
+			}
+		}
+	}
+	if wins == 0 || blocks == 0 {
+		t.Errorf("The corpus should have forced wins and blocks, got %d and %d", wins, blocks)
+	}
+	t.Logf("%d positions: %d forced wins, %d forced blocks; %d checked with the solver", positions, wins, blocks, solved)
+}
+
+// solverForcedMoves is what the exact solver makes of the forced-move rule
+// in gs, trying every empty square: the moves it proves win at once or, if
+// there are none, the squares where it proves the next player would win at
+// once. When the next player has one such square, it also checks that any
+// other move lets them win.
+func solverForcedMoves(t *testing.T, gs game.GameState) game.Bitboard {
+	t.Helper()
+	var wins, threats game.Bitboard
+	next := game.NewGameState(gs.Board, gs.NextPlayer(), gs.ActiveMask)
+	for bb := ^gs.Board.Occupied; bb != 0; bb &= bb - 1 {
+		m := game.MoveFromIndex(bits.TrailingZeros64(uint64(bb)))
+		if ProveMove(gs, m, 1) == ProvenWin {
+			wins |= bb & -bb
+		}
+		if ProveMove(next, m, 1) == ProvenWin {
+			threats |= bb & -bb
+		}
+	}
+	if wins != 0 {
+		return wins
+	}
+	if bits.OnesCount64(uint64(threats)) == 1 {
+		for bb := ^gs.Board.Occupied &^ threats; bb != 0; bb &= bb - 1 {
+			child := gs
+			child.ApplyMoveIdx(bits.TrailingZeros64(uint64(bb)))
+			if !CanForceWin(&child, next.PlayerID, 1) {
+				t.Fatalf("%s: %s leaves the threat on %s, but the solver finds no win for player %d", game.FormatPosition(gs),
+					game.MoveFromIndex(bits.TrailingZeros64(uint64(bb))), formatSquares(threats), next.PlayerID+1)
+			}
+		}
+	}
+	return threats
+}
+
+func TestResign(t *testing.T) {
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
+	gs.ApplyMoveIdx(0)
+	gs.Resign()
+	if gs.ActiveMask != 0x05 || gs.PlayerID != 2 {
+		t.Errorf("Resign failed: mask %x, player %d", gs.ActiveMask, gs.PlayerID)
+	}
+	if gs.Hash != game.ComputeHash(gs.Board, gs.PlayerID, gs.ActiveMask) {
+		t.Errorf("Hash mismatch after Resign")
+	}
+	gs.Resign()
+	if winner, terminal := gs.IsTerminal(); !terminal || winner != 0 {
+		t.Errorf("Expected P0 to win after two resignations, got %d, %v", winner, terminal)
+	}
+}
+
+func TestDescribeMove(t *testing.T) {
+	board := game.Board{}
+	board.Set(0, 1) // P2: A1, B1, C1 threatens D1
+	board.Set(1, 1)
+	board.Set(2, 1)
+	board.Set(8, 0) // P1: A2, B2 -> C2 would make 3
+	board.Set(9, 0)
+	gs := game.NewGameState(board, 0, 0x07)
+
+	reasons := DescribeMove(gs, game.MoveFromIndex(3))
+	if len(reasons) != 1 || reasons[0] != "blocks Player 2's 4-in-a-row" {
+		t.Errorf("Unexpected description for block: %v", reasons)
+	}
+	reasons = DescribeMove(gs, game.MoveFromIndex(10))
+	if len(reasons) != 1 || reasons[0] != "makes 3-in-a-row and is eliminated" {
+		t.Errorf("Unexpected description for suicide: %v", reasons)
+	}
+}
+
+func TestAnalyzeRanksMoves(t *testing.T) {
+	tt.Clear()
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
+	a := Analyze(gs, 500)
+	if len(a.Moves) == 0 || a.Best != a.Moves[0].Move {
+		t.Fatalf("Analyze returned no ranked moves")
+	}
+	for i := 1; i < len(a.Moves); i++ {
+		if a.Moves[i].Visits > a.Moves[i-1].Visits {
+			t.Errorf("Moves not sorted by visits at %d", i)
+		}
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	mainRand.Seed(5)
+	state := mainRand.State()
+	an := NewAnalyzer(MinMaxNodes)
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
+	first := an.Analyze(gs, 500)
+	if first.Rollouts != 500 || mainRand.State() != state {
+		t.Fatalf("Expected 500 visits from a private stream, got %d and the main stream moved: %v", first.Rollouts, mainRand.State() != state)
+	}
+	if again := an.Analyze(gs, 500); !slices.Equal(again.Moves, first.Moves) {
+		t.Error("Expected a repeated request to be served from the graph")
+	}
+	if more := an.Analyze(gs, 800); more.Rollouts != 800 {
+		t.Errorf("Expected the graph to be searched on to 800 visits, got %d", more.Rollouts)
+	}
+
+	// The position after the best move starts from its earlier visits.
+	child := gs
+	child.ApplyMove(first.Best)
+	if a := an.Analyze(child, 1); a.Rollouts <= 1 {
+		t.Errorf("Expected the child's visits to be reused, got %d", a.Rollouts)
+	}
+
+	// Unrelated positions stay within the cap.
+	for i := 0; i < 5; i++ {
+		an.Analyze(game.NewGameState(generateRandomBoard(10), 0, 0x07), 2000)
+		if n := an.m.NodeCount(); n > MinMaxNodes {
+			t.Fatalf("Analyzer graph grew to %d nodes", n)
+		}
+	}
+
+	an.Reset()
+	if a := an.Analyze(gs, 500); !slices.Equal(a.Moves, first.Moves) {
+		t.Error("Expected a reset Analyzer to answer like a new one")
+	}
+}
+
+func TestTableFile(t *testing.T) {
+	m := NewMCTSPlayer("Saved", "X", 0, 3000)
+	m.SetRand(NewRand(7))
+	m.SetMaxNodes(1 << 16)
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
+	m.Search(gs)
+	root := m.root
+
+	var buf bytes.Buffer
+	saved, err := SaveTable(&buf, []*MCTSPlayer{m}, []game.GameState{gs}, 1)
+	if err != nil || saved != len(reachable(root)) {
+		t.Fatalf("Expected the %d nodes below the root to be saved, got %d, %v", len(reachable(root)), saved, err)
+	}
+	data := bytes.Clone(buf.Bytes())
+
+	l := NewMCTSPlayer("Loaded", "X", 0, 3000)
+	l.SetMaxNodes(1 << 16)
+	if n, err := LoadTable(bytes.NewReader(data), []*MCTSPlayer{l}); err != nil || n != saved {
+		t.Fatalf("Expected %d nodes to load, got %d, %v", saved, n, err)
+	}
+	got := l.table.Lookup(&gs)
+	if got == nil || got.N != root.N || got.Q != root.Q || len(got.Edges) != len(root.Edges) || got.untriedMoves != root.untriedMoves {
+		t.Fatalf("Loaded root differs: %+v", got)
+	}
+	for i := range root.Edges {
+		e, f := root.Edges[i], got.Edges[i]
+		if e.Move != f.Move || e.N != f.N || e.Dest.N != f.Dest.N || root.EdgeQs[i] != got.EdgeQs[i] {
+			t.Errorf("Edge %v: saved %+v, loaded %+v", e.Move, e, f)
+		}
+	}
+	if n := l.NodeCount(); n != saved {
+		t.Errorf("Expected %d nodes in the graph, got %d", saved, n)
+	}
+	// The search goes on from the saved visits.
+	if _, rollouts := l.Search(gs); rollouts != 3000-root.N || l.root != got {
+		t.Errorf("Expected the search to reuse the loaded root, got %d rollouts", rollouts)
+	}
+
+	// A distilled table keeps the well visited nodes; a capped arena takes
+	// what fits.
+	buf.Reset()
+	few, _ := SaveTable(&buf, []*MCTSPlayer{m}, []game.GameState{gs}, 50)
+	if few >= saved || few < 2 {
+		t.Errorf("Expected some of the %d nodes to have 50 visits, got %d", saved, few)
+	}
+	c := NewMCTSPlayer("Capped", "X", 0, 3000)
+	c.SetMaxNodes(MinMaxNodes)
+	if _, err := LoadTable(bytes.NewReader(data), []*MCTSPlayer{c}); err != nil || c.NodeCount() > MinMaxNodes {
+		t.Errorf("Expected the capped graph to stay within %d nodes, got %d, %v", MinMaxNodes, c.NodeCount(), err)
+	}
+	if r := c.table.Lookup(&gs); r == nil || r.N != root.N {
+		t.Error("Expected the capped graph to take the root first")
+	}
+
+	if _, err := LoadTable(bytes.NewReader(data[:len(data)-3]), nil); err == nil {
+		t.Error("Expected a truncated table to be refused")
+	}
+	newer := append([]byte{}, data...)
+	newer[4] = TableVersion + 1
+	if _, err := LoadTable(bytes.NewReader(newer), nil); err == nil {
+		t.Error("Expected a newer table to be refused")
+	}
+}
+
+func TestWinningLinesAndExplanation(t *testing.T) {
+	board := game.Board{}
+	for _, idx := range []int{0, 1, 3} { // P1: A1, B1, D1
+		board.Set(idx, 0)
+	}
+	lines := WinningLines(board.P[0], 2)
+	if len(lines) != 1 || lines[0] != game.Bitboard(0x0F) {
+		t.Fatalf("Expected the A1-D1 line through C1, got %v", lines)
+	}
+	if len(WinningLines(board.P[0], 4)) != 0 {
+		t.Errorf("E1 should not be a winning square")
+	}
+
+	// Player 3 must block Player 1 at C1.
+	gs := game.NewGameState(board, 2, 0x07)
+	reasons := ExplainForcedMoves(gs)
+	if len(reasons) != 1 || reasons[0] != "C1 blocks: Player 1 threatens A1-B1-C1-D1" {
+		t.Errorf("Unexpected explanation: %v", reasons)
+	}
+	// Player 1 must take the win.
+	gs = game.NewGameState(board, 0, 0x07)
+	reasons = ExplainForcedMoves(gs)
+	if len(reasons) != 1 || reasons[0] != "C1 wins: completes your line A1-B1-C1-D1" {
+		t.Errorf("Unexpected explanation: %v", reasons)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	a1 := game.Bitboard(1)
+	if got, want := Neighbors(a1), game.Bitboard(1<<1|1<<8|1<<9); got != want {
+		t.Errorf("Neighbors(A1) = %x, want %x", got, want)
+	}
+	h4 := game.Bitboard(1) << 31
+	// G3, H3, G4, G5, H5; nothing wraps to the A file.
+	want := game.Bitboard(1)<<22 | game.Bitboard(1)<<23 | game.Bitboard(1)<<30 | game.Bitboard(1)<<38 | game.Bitboard(1)<<39
+	if got := Neighbors(h4); got != want {
+		t.Errorf("Neighbors(H4) = %x, want %x", got, want)
+	}
+}
+
+func TestParsePlayerType(t *testing.T) {
+	if s, err := ParsePlayerType("mcts"); s.Kind != "mcts" || s.Personality != nil || s.Iterations != 0 || err != nil {
+		t.Errorf("mcts: got %+v, %v", s, err)
+	}
+	if s, err := ParsePlayerType("mcts:trappy"); s.Kind != "mcts" || s.Personality != Personalities["trappy"] || err != nil {
+		t.Errorf("mcts:trappy: got %+v, %v", s, err)
+	}
+	if s, err := ParsePlayerType("mcts:trappy@5000"); s.Personality != Personalities["trappy"] || s.Iterations != 5000 || err != nil {
+		t.Errorf("mcts:trappy@5000: got %+v, %v", s, err)
+	}
+	if s, err := ParsePlayerType("cmd:./engine --fast"); s.Kind != "cmd" || s.Command != "./engine --fast" || err != nil {
+		t.Errorf("cmd: got %+v, %v", s, err)
+	}
+	for _, bad := range []string{"mcts:nope", "human:trappy", "human@100", "mcts@0", "mcts@x", "cmd:", "robot"} {
+		if _, err := ParsePlayerType(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+	for _, typ := range []string{"human", "mcts", "mcts:defensive", "mcts@5000", "mcts:random@200", "cmd:./engine"} {
+		s, _ := ParsePlayerType(typ)
+		if got := s.PlayerType(1000); got != typ {
+			t.Errorf("PlayerType round trip: got %q, want %q", got, typ)
+		}
+	}
+}
+
+func TestPersonalityShape(t *testing.T) {
+	// Player 2 eliminated by a 3-in-a-row, player 1 won with most of the board empty.
+	var b game.Board
+	for _, idx := range []int{0, 1, 2, 3} {
+		b.Set(idx, 0)
+	}
+	for _, idx := range []int{16, 17, 18} {
+		b.Set(idx, 1)
+	}
+	end := game.NewGameState(b, 2, 0x05)
+	end.Terminal = true
+	end.WinnerID = 0
+
+	trappy := Personalities["trappy"].shape(ScoreWin(0), 0x07, &end, 0)
+	if trappy[0] != 1+Personalities["trappy"].Trap {
+		t.Errorf("Trappy reward: got %v", trappy)
+	}
+	defensive := Personalities["defensive"].shape(ScoreWin(0), 0x07, &end, 2)
+	if defensive[2] != Personalities["defensive"].Survival {
+		t.Errorf("Defensive survival reward: got %v", defensive)
+	}
+	aggressive := Personalities["aggressive"].shape(ScoreWin(0), 0x07, &end, 0)
+	if aggressive[0] <= 1 || aggressive[1] != 0 {
+		t.Errorf("Aggressive speed reward: got %v", aggressive)
+	}
+}
+
+func TestPersonalitySearchUsesPrivateTable(t *testing.T) {
+	tt.Clear()
+	m := NewMCTSPlayer("P", "P", 0, 200)
+	m.SetPersonality(Personalities["aggressive"])
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
+	m.Search(gs)
+	if tt.Lookup(&gs) != nil {
+		t.Errorf("A personality's search should not touch the shared table")
+	}
+	if m.table.Lookup(&gs) == nil {
+		t.Errorf("Expected the root in the private table")
+	}
+}
+
+func TestSolver(t *testing.T) {
+	// E2 makes two threats, at D2 and E3; O must block Z at H7, so only one
+	// of them can be stopped.
+	gs, err := game.ParsePosition("7Z/8/7Z/4X2Z/4X3/8/1XX5/O6O 1 123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2, _ := game.ParseMove("E2")
+	if wins := WinningMoves(gs, 2); wins != game.Bitboard(1)<<uint(e2.ToIndex()) {
+		t.Errorf("Expected E2 to be the only win in 2, got [%s]", formatSquares(wins))
+	}
+	if wins := WinningMoves(gs, 1); wins != 0 {
+		t.Errorf("Expected no win in 1, got [%s]", formatSquares(wins))
+	}
+	d2, _ := game.ParseMove("D2")
+	if !MoveLoses(gs, d2, 1) {
+		t.Error("D2 makes 3-in-a-row and should lose")
+	}
+	if LosingMoves(gs, 1)&^gs.Loses[0] != 0 {
+		t.Errorf("Unexpected losing moves [%s]", formatSquares(LosingMoves(gs, 1)))
+	}
+}
+
+func TestCoachWarning(t *testing.T) {
+	gs, err := game.ParsePosition("7Z/8/7Z/4X2Z/4X3/8/1XX5/O6O 1 123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		move  string
+		depth int
+		want  string
+	}{
+		{"E2", 2, ""},
+		{"D2", 2, "D2 makes a 3-in-a-row"},
+		{"A5", 2, "A5 misses a forced win with E2."},
+		{"A5", 1, ""}, // Wins in 2 are beyond a coach of depth 1
+		{"D2", 0, ""},
+	} {
+		m, _ := game.ParseMove(c.move)
+		if got := CoachWarning(gs, m, c.depth); c.want == "" && got != "" || !strings.HasPrefix(got, c.want) {
+			t.Errorf("%s at depth %d: got %q, want %q", c.move, c.depth, got, c.want)
+		}
+	}
+
+	// In random games, moves are warned about as losing by force exactly
+	// when the solver finds them losing and a safe move was left.
+	r := NewRand(5)
+	found := 0
+	for g := 0; g < 20; g++ {
+		gs := game.NewGameState(game.Board{}, 0, 0b111)
+		for !gs.Terminal {
+			losing := LosingMoves(gs, 1)
+			for bb := gs.LegalMoves(); bb != 0 && gs.Wins[gs.PlayerID] == 0; bb &= bb - 1 {
+				idx := bits.TrailingZeros64(uint64(bb))
+				warned := CoachWarning(gs, game.MoveFromIndex(idx), 1) != ""
+				want := losing&(game.Bitboard(1)<<uint(idx)) != 0 && gs.LegalMoves()&^losing != 0
+				if warned != want {
+					t.Fatalf("%s: %s warned %v, want %v", game.FormatPosition(gs), game.MoveFromIndex(idx), warned, want)
+				}
+				if warned && gs.Loses[gs.PlayerID]&(game.Bitboard(1)<<uint(idx)) == 0 {
+					found++
+				}
+			}
+			gs.ApplyMoveIdx(r.PickBit(gs.GetBestMoves()))
+		}
+	}
+	if found == 0 {
+		t.Error("Expected some moves that lose by force without a 3-in-a-row")
+	}
+}
+
+func TestProveMove(t *testing.T) {
+	// Near the end of random games, moves are proven wins exactly when the
+	// solver can force a win, draws exactly when every way on ends drawn,
+	// and an analysis reports the outcomes instead of its estimates.
+	r := NewRand(7)
+	proven := map[Outcome]int{}
+	for g := 0; g < 2000 && (proven[ProvenWin] == 0 || proven[ProvenDraw] == 0); g++ {
+		gs := game.NewGameState(game.Board{}, 0, 0b111)
+		for !gs.Terminal {
+			empties := bits.OnesCount64(uint64(^gs.Board.Occupied))
+			if empties <= 5 {
+				all, best, ok := ProveMoves(gs)
+				var legal []Outcome
+				for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+					move := game.MoveFromIndex(bits.TrailingZeros64(uint64(bb)))
+					child := gs
+					child.ApplyMove(move)
+					o := ProveMove(gs, move, empties)
+					proven[o]++
+					if legal = append(legal, o); !ok || all[move.ToIndex()] != o {
+						t.Fatalf("%s: ProveMoves has %s as a %s (%v), not a %s", game.FormatPosition(gs), move, all[move.ToIndex()], ok, o)
+					}
+					if win := child.Terminal && child.WinnerID == gs.PlayerID || !child.Terminal && CanForceWin(&child, gs.PlayerID, empties); win != (o == ProvenWin) {
+						t.Fatalf("%s: %s is a %s, forced win %v", game.FormatPosition(gs), move, o, win)
+					}
+					if draws := alwaysDraws(&child, gs.PlayerID); draws != (o == ProvenDraw) {
+						t.Fatalf("%s: %s is a %s, always draws %v", game.FormatPosition(gs), move, o, draws)
+					}
+				}
+				if best != BestOutcome(legal) {
+					t.Fatalf("%s: ProveMoves gives a %s of %v", game.FormatPosition(gs), best, legal)
+				}
+				a := Analyze(gs, 200)
+				outcomes := []Outcome{}
+				for _, e := range a.Moves {
+					if e.Outcome != ProveMove(gs, e.Move, empties) {
+						t.Fatalf("%s: analysis has %s as a %s", game.FormatPosition(gs), e.Move, e.Outcome)
+					}
+					if e.Outcome != Unproven && e.Eval(1) != strings.ToUpper(e.Outcome.String()) {
+						t.Errorf("Unexpected eval %q of a proven %s", e.Eval(1), e.Outcome)
+					}
+					outcomes = append(outcomes, e.Outcome)
+				}
+				if a.Outcome != BestOutcome(outcomes) {
+					t.Fatalf("%s: analysis is a %s of %v", game.FormatPosition(gs), a.Outcome, outcomes)
+				}
+			}
+			gs.ApplyMoveIdx(r.PickBit(gs.GetBestMoves()))
+		}
+	}
+	if proven[ProvenWin] == 0 || proven[ProvenDraw] == 0 || proven[ProvenLoss] == 0 {
+		t.Errorf("Expected moves of every outcome, got %v", proven)
+	}
+	if _, _, ok := ProveMoves(game.NewGameState(game.Board{}, 0, 0b111)); ok {
+		t.Errorf("Expected nothing proven at the start of a game")
+	}
+	if o := BestOutcome([]Outcome{ProvenLoss, ProvenDraw}); o != ProvenDraw {
+		t.Errorf("Expected a draw from a loss and a draw, got %s", o)
+	}
+	if o := BestOutcome([]Outcome{ProvenDraw, Unproven, ProvenLoss}); o != Unproven {
+		t.Errorf("Expected an unproven position with an unproven move, got %s", o)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	gs, err := game.ParsePosition("7Z/8/7Z/4X2Z/4X3/8/1XX5/O6O 1 123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Classify(gs, 2)
+	if c.Winner != 0 || c.WinIn != 2 || formatSquares(c.Best) != "E2" {
+		t.Errorf("Expected X to win in 2 with E2, got player %d in %d with [%s]", c.Winner+1, c.WinIn, formatSquares(c.Best))
+	}
+	ops := c.Ops(gs)
+	if got := game.FormatEPD(gs, ops); !strings.HasSuffix(got, " win 1 2; bm E2;") {
+		t.Errorf("Unexpected operations %q", got)
+	}
+	if err := VerifyClassification(gs, ops); err != nil {
+		t.Errorf("Verifying its own classification: %v", err)
+	}
+
+	// After D1, O must block Z at H7, and X still wins.
+	d1, _ := game.ParseMove("D1")
+	gs.ApplyMoveIdx(d1.ToIndex())
+	if err := VerifyClassification(gs, Classify(gs, 2).Ops(gs)); err != nil {
+		t.Errorf("Verifying its own classification after D1: %v", err)
+	}
+	for _, claim := range []string{"win 1 1", "win 2 2", "block H7 A1", "am A1; depth 2"} {
+		state, ops, err := game.ParseEPD(game.FormatPosition(gs) + " " + claim + ";")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyClassification(state, ops); err == nil {
+			t.Errorf("%s: expected verification to fail", claim)
+		}
+	}
+	if err := VerifyClassification(gs, []game.EPDOp{{Name: "block", Args: []string{"H7"}}}); err != nil {
+		t.Errorf("block H7: %v", err)
+	}
+}
+
+// slowPerft counts paths like Perft, but plays every move by the rules
+// directly and rebuilds the state from the board, so it checks the
+// incremental updates of ApplyMoveIdx.
+func slowPerft(gs game.GameState, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+	var n uint64
+	for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		board := gs.Board
+		board.Set(idx, gs.PlayerID)
+		win, loss := game.CheckBoard(board.P[gs.PlayerID])
+		mask := gs.ActiveMask
+		if loss {
+			mask &^= 1 << uint(gs.PlayerID)
+		}
+		if win || bits.OnesCount8(mask) == 1 || board.Occupied == ^game.Bitboard(0) {
+			if depth == 1 {
+				n++
+			}
+			continue
+		}
+		next := gs.PlayerID
+		for {
+			next = (next + 1) % 3
+			if mask&(1<<uint(next)) != 0 {
+				break
+			}
+		}
+		n += slowPerft(game.NewGameState(board, next, mask), depth-1)
+	}
+	return n
+}
+
+func TestPerft(t *testing.T) {
+	tests := []struct {
+		position string
+		counts   []uint64
+	}{
+		{"8/8/8/8/8/8/8/8 1 123", []uint64{64, 4032, 249984, 15249024}},
+		// Forced wins and blocks.
+		{"O4XOO/O1OZ4/8/1Z1Z1Z2/O1OO4/ZX1XZ2Z/1X3X1X/2X1X3 3 123", []uint64{41, 80, 2620}},
+		// Two players left, so a 3-in-a-row ends the game.
+		{"1O1ZZOZ1/OZ1O4/Z1O5/1XXZ1XZZ/OXX1Z3/O1OXO2X/2X4Z/5OX1 2 23", []uint64{35, 1055, 26331, 683991}},
+	}
+	for _, tt := range tests {
+		gs, err := game.ParsePosition(tt.position)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range tt.counts {
+			depth := i + 1
+			if got := Perft(&gs, depth); got != want {
+				t.Errorf("%s: perft(%d) = %d, want %d", tt.position, depth, got, want)
+			}
+			if depth <= 3 {
+				if got := slowPerft(gs, depth); got != want {
+					t.Errorf("%s: slow perft(%d) = %d, want %d", tt.position, depth, got, want)
+				}
+			}
+		}
+		var sum uint64
+		for _, n := range PerftDivide(&gs, 2) {
+			sum += n
+		}
+		if sum != tt.counts[1] {
+			t.Errorf("%s: divide(2) sums to %d, want %d", tt.position, sum, tt.counts[1])
+		}
+	}
+}
+
+func TestSymmetries(t *testing.T) {
+	mainRand.Seed(12345)
+	for s := 0; s < game.NumSymmetries; s++ {
+		seen := game.Bitboard(0)
+		for idx := 0; idx < 64; idx++ {
+			seen |= game.Bitboard(1) << uint(game.TransformSquare(idx, s))
+		}
+		if seen != ^game.Bitboard(0) {
+			t.Errorf("symmetry %d is not a permutation of the squares", s)
+		}
+		// Threats are found alike on transformed boards.
+		for i := 0; i < 100; i++ {
+			board := generateRandomBoard(30)
+			empty := ^board.Occupied
+			wins, loses := game.GetWinsAndLosses(board.P[0], empty)
+			tw, tl := game.GetWinsAndLosses(game.TransformBitboard(board.P[0], s), game.TransformBitboard(empty, s))
+			if tw != game.TransformBitboard(wins, s) || tl != game.TransformBitboard(loses, s) {
+				t.Fatalf("symmetry %d changes the threats of %x", s, board.P[0])
+			}
+		}
+	}
+}
+
+func TestCanonicalPosition(t *testing.T) {
+	mainRand.Seed(8765)
+	for i := 0; i < 200; i++ {
+		gs := game.NewGameState(generateRandomBoard(i%40), i%3, uint8(1+i%7))
+		pos, s := game.CanonicalPosition(gs)
+		if got := game.FormatPosition(game.TransformPosition(gs, s)); got != pos {
+			t.Fatalf("symmetry %d gives %s, not the canonical %s", s, got, pos)
+		}
+		if back := game.TransformPosition(game.TransformPosition(gs, s), game.InverseSymmetry(s)); back.Hash != gs.Hash {
+			t.Fatalf("Expected the inverse symmetry to give the position back")
+		}
+		// Every rotation and reflection has the same canonical form.
+		for u := 0; u < game.NumSymmetries; u++ {
+			if other, _ := game.CanonicalPosition(game.TransformPosition(gs, u)); other != pos {
+				t.Fatalf("symmetry %d: canonical %s, want %s", u, other, pos)
+			}
+		}
+	}
+}
+
+// BenchmarkSymHashes compares hashing a busy position under all 8
+// symmetries at once against transforming it and hashing each.
+func BenchmarkSymHashes(b *testing.B) {
+	mainRand.Seed(6)
+	gs := game.NewGameState(generateRandomBoard(30), 0, 0b111)
+	b.Run("Batched", func(b *testing.B) {
+		var sink uint64
+		for i := 0; i < b.N; i++ {
+			h := gs.SymHashes()
+			sink ^= h[7]
+		}
+		benchSink = game.Bitboard(sink)
+	})
+	b.Run("Separate", func(b *testing.B) {
+		var sink uint64
+		for i := 0; i < b.N; i++ {
+			for s := 0; s < game.NumSymmetries; s++ {
+				var board game.Board
+				for p := range board.P {
+					board.P[p] = game.TransformBitboard(gs.Board.P[p], s)
+				}
+				sink ^= game.ComputeHash(board, gs.PlayerID, gs.ActiveMask)
+			}
+		}
+		benchSink = game.Bitboard(sink)
+	})
+}
+
+func TestPlayoutStats(t *testing.T) {
+	var stats PlayoutStats
+	for i := uint64(1); i <= 200; i++ {
+		gs := game.NewGameState(game.Board{}, 0, 0b111)
+		mainRand.Seed(i)
+		want, _, wantBoard := RunSimulation(&gs, &mainRand)
+
+		gs = game.NewGameState(game.Board{}, 0, 0b111)
+		mainRand.Seed(i)
+		got, moves := stats.Simulate(&gs, &mainRand)
+		if got != want || gs.Board != wantBoard {
+			t.Fatalf("Seed %d: Simulate played %v to %v, RunSimulation %v", i, gs.Board, got, want)
+		}
+		if moves != bits.OnesCount64(uint64(gs.Board.Occupied)) {
+			t.Errorf("Seed %d: %d moves for %d stones", i, moves, bits.OnesCount64(uint64(gs.Board.Occupied)))
+		}
+	}
+	if stats.Playouts != 200 || stats.FourInARow+stats.LastStanding+stats.Draws != 200 {
+		t.Errorf("Endings do not add up: %+v", stats)
+	}
+	lengths := 0
+	for _, c := range stats.Lengths {
+		lengths += c
+	}
+	if lengths != 200 || stats.ForcedWins != stats.FourInARow || stats.EliminationPlayouts > stats.Eliminations {
+		t.Errorf("Inconsistent counts: %+v", stats)
+	}
+}
+
+// TestPlayoutsMatchGameState plays random games through each playout path
+// and, with the same random stream, one move at a time through GameState,
+// checking every position on the way against one rebuilt from its board.
+// The paths pick their candidates and decide when a game is over on their
+// own, so they must reach the same position, result and length. Squava's
+// Rules pick from all legal moves, the others from GetBestMoves.
+func TestPlayoutsMatchGameState(t *testing.T) {
+	var stats PlayoutStats
+	neutral := &Personality{}
+	paths := map[string]struct {
+		moves func(gs *game.GameState) game.Bitboard
+		play  func(gs *game.GameState, r *Rand) ([3]float32, int)
+	}{
+		"RunSimulation": {(*game.GameState).GetBestMoves, func(gs *game.GameState, r *Rand) ([3]float32, int) {
+			result, steps, _ := RunSimulation(gs, r)
+			return result, steps - 1
+		}},
+		"PlayoutStats": {(*game.GameState).GetBestMoves, stats.Simulate},
+		"Personality": {(*game.GameState).GetBestMoves, func(gs *game.GameState, r *Rand) ([3]float32, int) {
+			result, steps := neutral.simulate(gs, gs.PlayerID, r)
+			return result, steps - 1
+		}},
+		"PlayoutRules": {(*game.GameState).LegalMoves, func(gs *game.GameState, r *Rand) ([3]float32, int) {
+			return PlayoutRules(SquavaRules{}, gs, r)
+		}},
+	}
+	defer func(v bool) { kernels.UseLineTables = v }(kernels.UseLineTables)
+	for _, kernels.UseLineTables = range []bool{false, true} {
+		for g := uint64(1); g <= 2000; g++ {
+			// Start a few random moves in, so that some games start with
+			// a player already eliminated.
+			r := NewRand(g)
+			start := game.NewGameState(game.Board{}, 0, 0b111)
+			for n := r.Uint64() % 24; n > 0 && !start.Terminal; n-- {
+				start.ApplyMoveIdx(r.PickBit(start.LegalMoves()))
+			}
+
+			for name, p := range paths {
+				want, wantRand := start, *r
+				wantResult, wantMoves := playByRules(t, &want, &wantRand, p.moves)
+				gs, pr := start, *r
+				result, moves := p.play(&gs, &pr)
+				if gs != want || pr != wantRand {
+					t.Fatalf("Line tables %v, game %d: %s ended at %+v, GameState at %+v", kernels.UseLineTables, g, name, gs, want)
+				}
+				if result != wantResult || moves != wantMoves {
+					t.Fatalf("Line tables %v, game %d: %s gave %v after %d moves, GameState %v after %d", kernels.UseLineTables, g, name, result, moves, wantResult, wantMoves)
+				}
+			}
+		}
+	}
+}
+
+// playByRules plays gs out with GameState's rules, picking from the squares
+// moves gives with r, and checks each position against one rebuilt from its
+// board. It returns the result and the number of moves played.
+func playByRules(t *testing.T, gs *game.GameState, r *Rand, moves func(gs *game.GameState) game.Bitboard) ([3]float32, int) {
+	t.Helper()
+	for n := 0; ; n++ {
+		if winner, ok := gs.IsTerminal(); ok {
+			return ScoreTerminal(gs.ActiveMask, winner), n
+		}
+		// A player eliminated on the last empty square leaves a full
+		// board that IsTerminal does not see, but a rebuilt state does.
+		if gs.Board.Occupied != ^game.Bitboard(0) {
+			if ref := game.NewGameState(gs.Board, gs.PlayerID, gs.ActiveMask); *gs != ref {
+				t.Fatalf("After %d moves: incremental state %+v, rebuilt %+v", n, *gs, ref)
+			}
+		}
+		idx := r.PickBit(moves(gs))
+		if idx == -1 {
+			return ScoreDraw(gs.ActiveMask), n
+		}
+		gs.ApplyMoveIdx(idx)
+	}
+}
+
+func BenchmarkRunSimulation(b *testing.B) {
+	mainRand.Seed(3)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		gs := game.NewGameState(game.Board{}, 0, 0b111)
+		RunSimulation(&gs, &mainRand)
+	}
+}
+
+// TestPlayoutAllocs keeps every kind of playout, and the searches that run
+// them, free of allocations.
+func TestPlayoutAllocs(t *testing.T) {
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	r := NewRand(3)
+	var stats PlayoutStats
+	personality := Personalities[PersonalityNames()[0]]
+	playouts := map[string]func(){
+		"RunSimulation": func() {
+			g := gs
+			RunSimulation(&g, r)
+		},
+		"PlayoutStats": func() {
+			g := gs
+			stats.Simulate(&g, r)
+		},
+		"Personality": func() {
+			g := gs
+			personality.simulate(&g, 0, r)
+		},
+	}
+	for name, f := range playouts {
+		if n := testing.AllocsPerRun(100, f); n != 0 {
+			t.Errorf("%s: expected no allocations per playout, got %v", name, n)
+		}
+	}
+
+	// Searches allocate nodes, in batches from the arena, but under one per
+	// rollout once the root's edges exist.
+	setups := map[string]func(p *MCTSPlayer){
+		"standard":    func(p *MCTSPlayer) {},
+		"personality": func(p *MCTSPlayer) { p.SetPersonality(personality) },
+		"stats":       func(p *MCTSPlayer) { p.Playouts = &stats },
+	}
+	for name, setup := range setups {
+		p := NewMCTSPlayer("Allocs", "A", 0, 1000)
+		p.SetRand(r)
+		p.table = NewTranspositionTable(1 << 12)
+		setup(p)
+		p.Search(gs)
+		if n := testing.AllocsPerRun(20, func() {
+			p.iterations += 50
+			p.Search(gs)
+		}); n >= 50 {
+			t.Errorf("%s search: expected under one allocation per rollout, got %v per 50", name, n)
+		}
+	}
+}
+
+func TestRandSplit(t *testing.T) {
+	// The main stream is the xorshift64* sequence it always was, so seeded
+	// games replay as before.
+	r := NewRand(1)
+	if got := r.Uint64(); got != 0x47E4CE4B896CDD1D {
+		t.Errorf("First number from seed 1 = %#x", got)
+	}
+
+	a, b := NewRand(42), NewRand(42)
+	sa, sb := a.Split(), b.Split()
+	if *sa != *sb || *a != *b {
+		t.Fatal("Splitting equal streams gave different streams")
+	}
+	s2 := a.Split()
+	seen := map[uint64]bool{}
+	for i := 0; i < 1000; i++ {
+		for _, r := range []*Rand{a, sa, s2} {
+			v := r.Uint64()
+			if seen[v] {
+				t.Fatalf("Split streams overlap at draw %d", i)
+			}
+			seen[v] = true
+		}
+	}
+
+	// Streams of consecutive indices are unrelated, unlike xorshift64*
+	// seeded with consecutive numbers, whose first draws are related.
+	clear(seen)
+	for i := 0; i < 100; i++ {
+		r := NthStream(1, i)
+		if *r != *NthStream(1, i) {
+			t.Fatalf("Stream %d differs between calls", i)
+		}
+		for j := 0; j < 10; j++ {
+			v := r.Uint64()
+			if seen[v] {
+				t.Fatalf("Streams overlap at stream %d, draw %d", i, j)
+			}
+			seen[v] = true
+		}
+	}
+}
+
+// TestParallelSearch runs engines on their own goroutines with split
+// streams and private tables, which must be reproducible and, under -race,
+// free of data races.
+func TestParallelSearch(t *testing.T) {
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	search := func() [4][]int32 {
+		root := NewRand(11)
+		var visits [4][]int32
+		var wg sync.WaitGroup
+		for i := range visits {
+			p := NewMCTSPlayer("Parallel", "P", 0, 2000)
+			p.SetRand(root.Split())
+			p.table = NewTranspositionTable(1 << 12)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.Search(gs)
+				for _, e := range p.root.Edges {
+					visits[i] = append(visits[i], e.N)
+				}
+			}()
+		}
+		wg.Wait()
+		return visits
+	}
+	first, second := search(), search()
+	for i := range first {
+		if !slices.Equal(first[i], second[i]) {
+			t.Errorf("Engine %d searched differently with the same stream", i)
+		}
+	}
+	if slices.Equal(first[0], first[1]) {
+		t.Error("Engines with different streams searched alike")
+	}
+}
+
+func TestThreads(t *testing.T) {
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	search := func(deterministic bool) (*MCTSPlayer, int) {
+		p := NewMCTSPlayer("Threads", "T", 0, 3001)
+		p.SetRand(NewRand(5))
+		p.table = NewTranspositionTable(1 << 12)
+		p.SetThreads(4, deterministic)
+		_, rollouts := p.Search(gs)
+		return p, rollouts
+	}
+	for _, deterministic := range []bool{false, true} {
+		p, rollouts := search(deterministic)
+		visits := 0
+		for _, mv := range p.merged {
+			visits += mv.Visits
+		}
+		if rollouts != 3001 || visits != 3001 {
+			t.Errorf("deterministic=%v: expected 3001 rollouts and root visits, got %d and %d", deterministic, rollouts, visits)
+		}
+		if p.root.N >= 3001 {
+			t.Errorf("deterministic=%v: the first thread did all %d rollouts", deterministic, p.root.N)
+		}
+	}
+
+	first, _ := search(true)
+	second, _ := search(true)
+	if !slices.Equal(first.merged, second.merged) {
+		t.Error("Deterministic searches with the same seed and threads differed")
+	}
+	// A second search of the position reuses every thread's graph.
+	first.iterations = 5000
+	if _, rollouts := first.Search(gs); rollouts != 1999 {
+		t.Errorf("Expected 1999 more rollouts, got %d", rollouts)
+	}
+}
+
+func TestNodeArena(t *testing.T) {
+	tt.Clear()
+	defer tt.Clear()
+	mainRand.Seed(7)
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	p := NewMCTSPlayer("Arena", "A", 0, 3000)
+	p.Search(gs)
+	root := p.root
+	if len(root.Edges) != 64 || cap(root.Edges) != 64 || len(root.EdgeQs) != 64 || len(root.EdgeUs) != 64 {
+		t.Fatalf("Expected the root's edges grown once to 64, got len %d cap %d", len(root.Edges), cap(root.Edges))
+	}
+	seen := map[game.Move]bool{}
+	visits := 0
+	for i, e := range root.Edges {
+		if seen[e.Move] {
+			t.Errorf("Edge %d repeats %s", i, e.Move)
+		}
+		seen[e.Move] = true
+		visits += int(e.N)
+		if root.EdgeQs[i] != e.Dest.Q[0] {
+			t.Errorf("Edge %d: cached Q %v, node Q %v", i, root.EdgeQs[i], e.Dest.Q[0])
+		}
+	}
+	if visits != root.N {
+		t.Errorf("Edge visits add up to %d, root has %d", visits, root.N)
+	}
+	// Nodes that outgrew their inline edges hold room for all their moves.
+	for _, e := range root.Edges {
+		if len(e.Dest.Edges) > InlineEdgeCap {
+			if cap(e.Dest.Edges) != len(e.Dest.Edges)+bits.OnesCount64(uint64(e.Dest.untriedMoves)) {
+				t.Errorf("%s: edge capacity %d for %d edges and %d untried moves", e.Move, cap(e.Dest.Edges), len(e.Dest.Edges), bits.OnesCount64(uint64(e.Dest.untriedMoves)))
+			}
+		}
+	}
+	// Searching on must not move or overwrite the edges.
+	before := append([]MCGSEdge(nil), root.Edges...)
+	p.iterations += 2000
+	p.Search(gs)
+	for i := range before {
+		if root.Edges[i].Move != before[i].Move || root.Edges[i].Dest != before[i].Dest {
+			t.Fatalf("Edge %d of the root changed from %+v to %+v", i, before[i], root.Edges[i])
+		}
+	}
+}
+
+func TestRolloutShares(t *testing.T) {
+	// A thread left alone steals every rollout of the others, the last
+	// ones included.
+	shares := make(rolloutShares, 4)
+	for i := range shares {
+		shares[i].n.Store(250)
+	}
+	taken := 0
+	for shares.take(0) {
+		taken++
+	}
+	if taken != 1000 {
+		t.Errorf("Expected the first thread to take 1000 rollouts, got %d", taken)
+	}
+	for i := 1; i < 4; i++ {
+		if shares.take(i) {
+			t.Errorf("Expected thread %d to be left no rollout", i)
+		}
+	}
+
+	// Racing threads take every rollout exactly once.
+	for i := range shares {
+		shares[i].n.Store(int64(1000 * i))
+	}
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	for i := range shares {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shares.take(i) {
+				total.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if total.Load() != 6000 {
+		t.Errorf("Expected 6000 rollouts taken, got %d", total.Load())
+	}
+}
+
+// TestParallelSchedule checks how positions are searched in parallel.
+func TestParallelSchedule(t *testing.T) {
+	p := NewMCTSPlayer("Schedule", "S", 0, 1000)
+	p.SetThreads(4, false)
+	// Player 3 has a 4-in-a-row to make at C1, which Player 2 must block.
+	var threat game.Board
+	for _, idx := range []int{0, 1, 3} {
+		threat.Set(idx, 2)
+	}
+	// Player 1 must block Player 2 at C1 or E1.
+	var block game.Board
+	for _, idx := range []int{0, 1, 3, 5, 6} {
+		block.Set(idx, 1)
+	}
+	for _, tc := range []struct {
+		name          string
+		gs            game.GameState
+		deterministic bool
+		threads, how  int
+	}{
+		{"open", game.NewGameState(game.Board{}, 0, 0b111), false, 4, parallelRoot},
+		{"threat", game.NewGameState(threat, 0, 0b111), false, 4, parallelTree},
+		{"two moves", game.NewGameState(block, 0, 0b111), false, 4, parallelLeaf},
+		{"deterministic", game.NewGameState(threat, 0, 0b111), true, 4, parallelRoot},
+		{"forced", game.NewGameState(threat, 1, 0b111), false, 1, parallelRoot},
+	} {
+		p.deterministic = tc.deterministic
+		if n, how := p.schedule(&tc.gs); n != tc.threads || how != tc.how {
+			t.Errorf("%s: expected %d threads with %s parallelism, got %d with %s",
+				tc.name, tc.threads, parallelNames[tc.how], n, parallelNames[how])
+		}
+	}
+}
+
+// TestTreeAndLeafParallel searches with threads sharing a graph and with
+// threads playing out the same leaves, and checks that the graph is sound
+// and every virtual loss taken back.
+func TestTreeAndLeafParallel(t *testing.T) {
+	var threat game.Board
+	for _, idx := range []int{0, 1, 3} {
+		threat.Set(idx, 2)
+	}
+	var block game.Board
+	for _, idx := range []int{0, 1, 3, 5, 6} {
+		block.Set(idx, 1)
+	}
+	for _, tc := range []struct {
+		name     string
+		gs       game.GameState
+		how      int
+		maxNodes int
+	}{
+		{"tree", game.NewGameState(threat, 0, 0b111), parallelTree, 0},
+		{"tree, capped", game.NewGameState(threat, 0, 0b111), parallelTree, MinMaxNodes},
+		{"leaf", game.NewGameState(block, 0, 0b111), parallelLeaf, 0},
+		{"leaf, capped", game.NewGameState(block, 0, 0b111), parallelLeaf, MinMaxNodes},
+	} {
+		search := func() *MCTSPlayer {
+			p := NewMCTSPlayer("Parallel", "P", 0, 5001)
+			p.SetRand(NewRand(13))
+			p.SetMaxNodes(tc.maxNodes)
+			if tc.maxNodes == 0 {
+				p.table = NewTranspositionTable(1 << 12)
+			}
+			p.SetThreads(4, false)
+			if _, rollouts := p.Search(tc.gs); rollouts != 5001 || p.root.N != 5001 {
+				t.Errorf("%s: expected 5001 rollouts and root visits, got %d and %d", tc.name, rollouts, p.root.N)
+			}
+			if p.parallelism != tc.how || p.merged != nil {
+				t.Errorf("%s: searched with %s parallelism", tc.name, parallelNames[p.parallelism])
+			}
+			return p
+		}
+		p := search()
+		ValidateMCTSGraph(t, p.root, tc.gs)
+		for n := range reachable(p.root) {
+			for i := range n.Edges {
+				if v := n.Edges[i].Virtual; v != 0 {
+					t.Fatalf("%s: %d virtual losses left on %s", tc.name, v, n.Edges[i].Move)
+				}
+				if q := n.Edges[i].Dest.Q[0]; n.EdgeQs[i] != q && n == p.root {
+					t.Errorf("%s: root edge %s caches winrate %v, its node has %v", tc.name, n.Edges[i].Move, n.EdgeQs[i], q)
+				}
+			}
+		}
+		// Leaf parallelism backs the playouts up in thread order, each
+		// thread with its own stream, so it depends only on the seed.
+		if tc.how == parallelLeaf {
+			if again := search(); again.root.Q != p.root.Q {
+				t.Errorf("%s: searches with the same seed gave %v and %v", tc.name, p.root.Q, again.root.Q)
+			}
+		}
+	}
+}
+
+func TestAutoThreads(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	p := NewMCTSPlayer("Auto", "A", 0, 2000)
+	p.SetRand(NewRand(9))
+	p.table = NewTranspositionTable(1 << 12)
+	p.SetThreads(AutoThreads, false)
+	p.Search(game.NewGameState(game.Board{}, 0, 0b111))
+	if len(p.helpers) != 3 || p.merged == nil {
+		t.Errorf("Expected an open position searched with 4 threads, got %d helpers", len(p.helpers))
+	}
+
+	// Player 1 must block Player 2's A1-D1 at C1.
+	var board game.Board
+	for _, idx := range []int{0, 1, 3} {
+		board.Set(idx, 1)
+	}
+	gs := game.NewGameState(board, 0, 0b111)
+	if p.Search(gs); p.merged != nil || p.root.Edges[0].Move != game.MoveFromIndex(2) {
+		t.Error("Expected a forced move searched with one thread")
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	mainRand.Seed(11)
+	p := NewMCTSPlayer("Capped", "C", 0, 30000)
+	p.SetMaxNodes(MinMaxNodes)
+	p.MemoryStats = true
+	p.GetMove(game.Board{}, []int{0, 1, 2}, 0)
+	mem := p.memory
+	if mem.PeakNodes != MinMaxNodes || mem.Nodes > mem.PeakNodes || mem.Nodes != p.NodeCount() {
+		t.Errorf("Expected the capped search to peak at %d nodes and end with %d, got %+v", MinMaxNodes, p.NodeCount(), mem)
+	}
+	if least := int64(MinMaxNodes) * int64(unsafe.Sizeof(MCGSNode{})); mem.ArenaBytes < least {
+		t.Errorf("Expected the arena to have taken at least %d bytes, got %d", least, mem.ArenaBytes)
+	}
+}
+
+func TestTreeAge(t *testing.T) {
+	mainRand.Seed(13)
+	p := NewMCTSPlayer("Aging", "A", 0, 2000)
+	p.SetMaxNodes(100000)
+	p.SetTreeAge(2)
+	a := game.NewGameState(game.Board{}, 0, 0b111)
+	b := game.NewGameState(generateRandomBoard(12), 0, 0b111)
+	c := game.NewGameState(generateRandomBoard(12), 0, 0b111)
+
+	p.Search(a)
+	oldRoot := p.root
+	p.Search(b)
+	if p.table.Lookup(&a) != oldRoot {
+		t.Fatal("Expected the previous root to be kept with a tree age of 2")
+	}
+	p.Search(c)
+	if p.table.Lookup(&a) != nil {
+		t.Error("Expected the root two searches back to be aged out and removed from the table")
+	}
+	if n, reach := p.NodeCount(), len(reachable(p.recentRoots...)); n != reach {
+		t.Errorf("Expected only the last two searches' %d nodes to be kept, got %d", reach, n)
+	}
+	if p.table.Lookup(&b) == nil || len(p.recentRoots) != 2 {
+		t.Error("Expected the last two roots to be kept")
+	}
+}
+
+func TestMaxNodes(t *testing.T) {
+	mainRand.Seed(11)
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	p := NewMCTSPlayer("Capped", "C", 0, 30000)
+	p.SetMaxNodes(MinMaxNodes)
+	p.Search(gs)
+	if p.root.N < 30000 {
+		t.Fatalf("Search stopped at %d visits", p.root.N)
+	}
+	if p.arena.handed != MinMaxNodes {
+		t.Errorf("Expected the search to fill the pool, %d nodes handed out", p.arena.handed)
+	}
+	if n := p.NodeCount(); n > MinMaxNodes {
+		t.Errorf("%d nodes in use, limit %d", n, MinMaxNodes)
+	}
+	free := map[*MCGSNode]bool{}
+	for _, n := range p.arena.free {
+		free[n] = true
+	}
+	reach := reachable(p.root)
+	if len(reach) > MinMaxNodes {
+		t.Errorf("%d nodes reachable, limit %d", len(reach), MinMaxNodes)
+	}
+	for n := range reach {
+		if free[n] {
+			t.Fatalf("A recycled node is still in the graph")
+		}
+		for i, e := range n.Edges {
+			if n.EdgeQs[i] != e.Dest.Q[0] && n.EdgeQs[i] != e.Dest.Q[1] && n.EdgeQs[i] != e.Dest.Q[2] {
+				t.Errorf("Edge %s caches %v, its node has %v", e.Move, n.EdgeQs[i], e.Dest.Q)
+			}
+		}
+	}
+	for i := range p.table.slots {
+		if n := p.table.slots[i].Load(); n != nil && free[n] {
+			t.Fatalf("A recycled node is still in the table")
+		}
+	}
+
+	// The capped engine still finds a forced win.
+	board := game.Board{}
+	board.Set(0, 0)
+	board.Set(1, 0)
+	board.Set(2, 0)
+	board.Set(8, 1)
+	board.Set(9, 1)
+	board.Set(16, 2)
+	if move := p.GetMove(board, []int{0, 1, 2}, 0); move.ToIndex() != 3 {
+		t.Errorf("Expected the win at D1, got %s", move)
+	}
+}
+
+func TestTranspositionTableReplacement(t *testing.T) {
+	table := NewTranspositionTable(1000)
+	if table.Len() != 512 {
+		t.Fatalf("Expected 512 slots, got %d", table.Len())
+	}
+	table.Store(1, &MCGSNode{Hash: 1})
+	table.Lookup(&game.GameState{Hash: 1})
+	if s := table.Stats(); s.Stores != 0 || s.Hits != 0 {
+		t.Errorf("Expected no counts before CountStats, got %+v", s)
+	}
+	table.Clear()
+	table.CountStats()
+	// Three positions in one bucket: the first stays, the second slot takes
+	// the newest.
+	var nodes [4]*MCGSNode
+	for i := range nodes {
+		nodes[i] = &MCGSNode{Hash: uint64(i) << 20}
+		table.Store(nodes[i].Hash, nodes[i])
+	}
+	find := func(n *MCGSNode) bool {
+		return table.Lookup(&game.GameState{Hash: n.Hash}) == n
+	}
+	if !find(nodes[0]) || find(nodes[1]) || find(nodes[2]) || !find(nodes[3]) {
+		t.Errorf("Expected the first and newest nodes to stay")
+	}
+	// In a new search, entries of earlier ones go first.
+	table.NewSearch()
+	fresh := &MCGSNode{Hash: 5 << 20}
+	table.Store(fresh.Hash, fresh)
+	if find(nodes[0]) || !find(nodes[3]) || !find(fresh) {
+		t.Errorf("Expected the stale first slot to be replaced")
+	}
+	s := table.Stats()
+	if s.Stores != 5 || s.Replaced != 3 || s.Hits != 4 || s.Misses != 3 {
+		t.Errorf("Unexpected counts: %+v", s)
+	}
+	table.Remove(fresh)
+	if find(fresh) {
+		t.Errorf("Expected the removed node to be gone")
+	}
+}
+
+func TestTranspositionTableConcurrent(t *testing.T) {
+	table := NewTranspositionTable(1 << 10)
+	table.CountStats()
+	nodes := make([]*MCGSNode, 4096)
+	for i := range nodes {
+		nodes[i] = &MCGSNode{Hash: uint64(i) * 0x9E3779B97F4A7C15}
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range nodes {
+				n := nodes[(i*7+w*131)%len(nodes)]
+				table.Store(n.Hash, n)
+				if got := table.Lookup(&game.GameState{Hash: n.Hash}); got != nil && got.Hash != n.Hash {
+					t.Errorf("Lookup of %x returned a node for %x", n.Hash, got.Hash)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if s := table.Stats(); s.Stores != 8*uint64(len(nodes)) || s.Hits+s.Misses != s.Stores {
+		t.Errorf("Unexpected counts: %+v", s)
+	}
+}
+
+func TestUnmakeMove(t *testing.T) {
+	for g := uint64(1); g <= 200; g++ {
+		mainRand.Seed(g)
+		gs := game.NewGameState(game.Board{}, 0, 0b111)
+		for !gs.Terminal {
+			// Every legal move is taken back exactly, including wins and
+			// eliminations.
+			for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+				idx := bits.TrailingZeros64(uint64(bb))
+				want := gs
+				want.ApplyMoveIdx(idx)
+				before := gs
+				u := gs.MakeMove(idx)
+				if gs != want {
+					t.Fatalf("Game %d: MakeMove(%d) differs from ApplyMoveIdx", g, idx)
+				}
+				gs.UnmakeMove(u)
+				if gs != before {
+					t.Fatalf("Game %d: UnmakeMove(%d) left %+v, want %+v", g, idx, gs, before)
+				}
+			}
+			gs.ApplyMoveIdx(PickRandomBit(gs.LegalMoves()))
+		}
+	}
+}
+
+// TestKernelsMatchGo checks the threat and edge selection kernels in use
+// against the portable Go versions on random inputs, so a port to a new
+// architecture is checked by the plain test run.
+func TestKernelsMatchGo(t *testing.T) {
+	checkKernels(t)
+}
+
+func checkKernels(t *testing.T) {
+	t.Helper()
+	mainRand.Seed(99)
+	for i := 0; i < 20000; i++ {
+		b, e := xrand()&xrand(), xrand()
+		e &^= b
+		w, l := kernels.WinsAndLosses(b, e)
+		wGo, lGo := kernels.WinsAndLossesGo(b, e)
+		if w != wGo || l != lGo {
+			t.Fatalf("%s: getWinsAndLossesSIMD(%x, %x) = %x, %x; Go gives %x, %x", kernels.Name(), b, e, w, l, wGo, lGo)
+		}
+	}
+	for n := 1; n <= 64; n++ {
+		for trial := 0; trial < 50; trial++ {
+			qs, us := make([]float32, n), make([]float32, n)
+			for i := range qs {
+				qs[i] = float32(xrand()>>40) / (1 << 24)
+				us[i] = float32(xrand()>>40) / (1 << 24)
+			}
+			switch trial % 5 {
+			case 0:
+				// Ties must go to the first edge.
+				us[n-1], qs[n-1] = us[0], qs[0]
+			case 1:
+				// Also among the lanes of a vector.
+				for i := range qs {
+					qs[i], us[i] = float32(xrand()%3)/2, float32(xrand()%3)/2
+				}
+			}
+			coeff := float32(xrand()>>40) / (1 << 22)
+			got, want := kernels.SelectBestEdge(qs, us, coeff), selectBestEdgeGoRef(qs, us, coeff)
+			if got != want {
+				t.Fatalf("%s, n=%d: selectBestEdgeSIMD picked %d (%v), Go %d (%v)", kernels.Name(), n, got, qs[got]+coeff*us[got], want, qs[want]+coeff*us[want])
+			}
+		}
+	}
+	var keys [64][game.NumSymmetries]uint64
+	for sq := range keys {
+		for s := range keys[sq] {
+			keys[sq][s] = xrand()
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		var h [game.NumSymmetries]uint64
+		for s := range h {
+			h[s] = xrand()
+		}
+		stones := xrand() & xrand()
+		if i%100 == 0 {
+			stones = uint64(1) << uint(i/100) >> 1 // None, then single squares
+		}
+		want := h
+		kernels.SymXorGo(&want, &keys, stones)
+		if kernels.SymXor(&h, &keys, stones); h != want {
+			t.Fatalf("%s: symXor(%x) = %x; Go gives %x", kernels.Name(), stones, h, want)
+		}
+	}
+}
+
+func BenchmarkSelectBestEdge(b *testing.B) {
+	mainRand.Seed(5)
+	qs, us := make([]float32, 32), make([]float32, 32)
+	for i := range qs {
+		qs[i] = float32(xrand()>>40) / (1 << 24)
+		us[i] = float32(xrand()>>40) / (1 << 24)
+	}
+	sum := 0
+	for i := 0; i < b.N; i++ {
+		sum += kernels.SelectBestEdge(qs, us, 1.3)
+	}
+	benchSink = game.Bitboard(sum)
+}
+
+// BenchmarkSelectNode compares scoring the root's edges after a search from
+// the float32 statistics the root keeps for them, as selection does, with
+// reading each child's Q and the edge's visits, as it would without them.
+func BenchmarkSelectNode(b *testing.B) {
+	player := NewMCTSPlayer("Bench", "B", 0, 10000)
+	player.SetRand(NewRand(5))
+	tt.Clear()
+	player.Search(game.NewGameState(game.Board{}, 0, 0x07))
+	root := player.root
+	b.Run("ParentArrays", func(b *testing.B) {
+		sum := 0
+		for i := 0; i < b.N; i++ {
+			sum += root.selectBestEdge()
+		}
+		benchSink = game.Bitboard(sum)
+	})
+	b.Run("Children", func(b *testing.B) {
+		sum := 0
+		for i := 0; i < b.N; i++ {
+			best, bestScore := -1, float32(negInf)
+			for j := range root.Edges {
+				e := &root.Edges[j]
+				if score := e.Dest.Q[0] + float32(root.UCB1Coeff*invSqrt(int(e.N)+1)); score > bestScore {
+					best, bestScore = j, score
+				}
+			}
+			sum += best
+		}
+		benchSink = game.Bitboard(sum)
+	})
+}
+
+var updateGolden = flag.Bool("update-golden", false, "Rewrite the golden games in testdata/golden with what the engine plays now")
+
+// goldenGames are engine games at fixed seeds whose moves are kept in
+// testdata/golden, so that a change to what the engine plays shows up. A
+// seed gives the same game on every platform and kernel set, which `make
+// repro` checks.
+var goldenGames = []struct {
+	name       string
+	seed       uint64
+	players    [3]string
+	iterations int
+}{
+	{"mcts-200-seed1", 1, [3]string{"mcts", "mcts", "mcts"}, 200},
+	{"mcts-1000-seed7", 7, [3]string{"mcts", "mcts", "mcts"}, 1000},
+	{"mixed-iterations-seed3", 3, [3]string{"mcts@100", "mcts", "mcts@1600"}, 400},
+	{"personalities-seed5", 5, [3]string{"mcts:aggressive", "mcts:defensive", "mcts:trappy"}, 300},
+}
+
+// playGoldenGame plays the engines of players against each other from
+// seed, as `squava -seed` does, and returns the game's record.
+func playGoldenGame(seed uint64, players [3]string, iterations int) (*game.GameRecord, error) {
+	tt.Clear()
+	mainRand.Seed(seed)
+	rec := &game.GameRecord{Seed: mainRand.State(), Players: players, Iterations: iterations}
+	var engines [3]*MCTSPlayer
+	for i, t := range players {
+		spec, err := ParsePlayerType(t)
+		if err != nil || spec.Kind != "mcts" {
+			return nil, fmt.Errorf("player %d: %q is not an engine", i+1, t)
+		}
+		n := iterations
+		if spec.Iterations > 0 {
+			n = spec.Iterations
+		}
+		engines[i] = NewMCTSPlayer("AI", "A", i, n)
+		engines[i].SetPersonality(spec.Personality)
+	}
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	for {
+		if winner, ok := gs.IsTerminal(); ok {
+			// The result as SquavaGame records it.
+			rec.Result = "Draw"
+			if winner != -1 {
+				how := "Last Standing"
+				if four, _ := game.CheckBoard(gs.Board.P[winner]); four {
+					how = "4-in-a-row"
+				}
+				rec.Result = fmt.Sprintf("Player %d Wins (%s)", winner+1, how)
+			}
+			return rec, nil
+		}
+		active := gs.ActiveIDs()
+		m := engines[gs.PlayerID].GetMove(gs.Board, active, slices.Index(active, gs.PlayerID))
+		rec.Moves = append(rec.Moves, m)
+		if m == game.ResignMove {
+			gs.Resign()
+		} else {
+			gs.ApplyMove(m)
+		}
+	}
+}
+
+// TestGoldenGames replays the golden games, with the threat kernel and the
+// line tables, and fails if the engine now plays any of them differently.
+// After an intended change, rewrite them with `make golden`.
+func TestGoldenGames(t *testing.T) {
+	if *updateGolden {
+		for _, gg := range goldenGames {
+			rec, err := playGoldenGame(gg.seed, gg.players, gg.iterations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := rec.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", "golden", gg.name+".sqv")
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+	defer func(v bool) { kernels.UseLineTables = v }(kernels.UseLineTables)
+	for _, kernels.UseLineTables = range []bool{false, true} {
+		checkGoldenGames(t)
+	}
+}
+
+func checkGoldenGames(t *testing.T) {
+	t.Helper()
+	defer tt.Clear()
+	for _, gg := range goldenGames {
+		path := filepath.Join("testdata", "golden", gg.name+".sqv")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%v; run make golden to record it", err)
+		}
+		want, err := game.ReadGameRecord(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		got, err := playGoldenGame(want.Seed, want.Players, want.Iterations)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		for i := range max(len(got.Moves), len(want.Moves)) {
+			if i >= len(got.Moves) || i >= len(want.Moves) || got.Moves[i] != want.Moves[i] {
+				t.Errorf("%s (%s kernels, line tables %v): the engine now plays %s at move %d where the golden game has %s; if that is intended, run make golden",
+					path, kernels.Name(), kernels.UseLineTables, moveAt(got.Moves, i), i+1, moveAt(want.Moves, i))
+				break
+			}
+		}
+	}
+}
+
+// moveAt returns the i-th of moves as written in a record, or "nothing"
+// past the end.
+func moveAt(moves []game.Move, i int) string {
+	if i >= len(moves) {
+		return "nothing"
+	}
+	return game.FormatRecordMove(moves[i])
+}
@@ -0,0 +1,118 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"strings"
+
+	"squava/game"
+)
+
+// --- Static evaluation ---
+
+// PlayerEval is what `squava eval` reports of one player: its threats as
+// squares and as hexadecimal bitboards, bit 0 being A1, and its threat
+// score in percent.
+type PlayerEval struct {
+	Player          int      `json:"player"` // From 1
+	Active          bool     `json:"active"`
+	ToMove          bool     `json:"to_move,omitempty"`
+	Wins            []string `json:"wins"`
+	Loses           []string `json:"loses"`
+	Doubles         []string `json:"doubles"`
+	WinsBitboard    string   `json:"wins_bitboard"`
+	LosesBitboard   string   `json:"loses_bitboard"`
+	DoublesBitboard string   `json:"doubles_bitboard"`
+	ThreatScore     float64  `json:"threat_score"`
+}
+
+// EvalPosition reports every player's threats in gs and its threat score.
+func EvalPosition(gs *game.GameState) []PlayerEval {
+	score := ThreatScore(gs)
+	evals := make([]PlayerEval, 3)
+	for id := range evals {
+		e := PlayerEval{Player: id + 1, Active: gs.ActiveMask&(1<<uint(id)) != 0, ToMove: !gs.Terminal && gs.PlayerID == id}
+		var wins, loses, doubles game.Bitboard
+		if e.Active && !gs.Terminal {
+			wins, loses, doubles = gs.Wins[id], gs.Loses[id], DoubleThreats(gs, id)
+		}
+		e.Wins, e.Loses, e.Doubles = squareNames(wins), squareNames(loses), squareNames(doubles)
+		e.WinsBitboard = fmt.Sprintf("0x%016x", uint64(wins))
+		e.LosesBitboard = fmt.Sprintf("0x%016x", uint64(loses))
+		e.DoublesBitboard = fmt.Sprintf("0x%016x", uint64(doubles))
+		e.ThreatScore = winratePercent(score[id])
+		evals[id] = e
+	}
+	return evals
+}
+
+// squareNames lists the squares of bb, A1 first.
+func squareNames(bb game.Bitboard) []string {
+	names := []string{}
+	for ; bb != 0; bb &= bb - 1 {
+		names = append(names, game.MoveFromIndex(bits.TrailingZeros64(uint64(bb))).String())
+	}
+	return names
+}
+
+// runEval implements `squava eval`, which prints the threats of every
+// player in a position and the threat score they add up to.
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	position := fs.String("position", "", "The position, in the position notation")
+	asJSON := fs.Bool("json", false, "Print JSON instead of text")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `usage: squava eval -position "8/8/8/8/3X4/8/8/8 2 123" [-json]`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *position == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	gs, err := game.ParsePosition(*position)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-position: %v\n", err)
+		return exitUsage
+	}
+	evals := EvalPosition(&gs)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			Position string       `json:"position"`
+			Players  []PlayerEval `json:"players"`
+		}{game.FormatPosition(gs), evals})
+		return 0
+	}
+	fmt.Printf("Position: %s\n", game.FormatPosition(gs))
+	list := func(names []string) string {
+		if len(names) == 0 {
+			return "-"
+		}
+		return strings.Join(names, ", ")
+	}
+	for _, e := range evals {
+		status := ""
+		switch {
+		case !e.Active:
+			status = ", out of the game"
+		case e.ToMove:
+			status = ", to move"
+		}
+		fmt.Printf("Player %d (%s)%s\n", e.Player, asciiStones[e.Player-1], status)
+		if !e.Active {
+			continue
+		}
+		fmt.Printf("  Winning squares:       %-24s %s\n", list(e.Wins), e.WinsBitboard)
+		fmt.Printf("  Losing squares:        %-24s %s\n", list(e.Loses), e.LosesBitboard)
+		fmt.Printf("  Double-threat squares: %-24s %s\n", list(e.Doubles), e.DoublesBitboard)
+		fmt.Printf("  Threat score:          %.1f%%\n", e.ThreatScore)
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+//go:build !wasm
+
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestEvalPosition(t *testing.T) {
+	gs, err := game.ParsePosition("7Z/8/7Z/4X2Z/4X3/8/1XX5/O6O 1 123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// E2 gives X two winning squares, D2 and E3, and H3 gives Z H4 and H7.
+	if d := formatSquares(DoubleThreats(&gs, 0)); d != "E2" {
+		t.Errorf("Unexpected double threats of X [%s]", d)
+	}
+	if d := formatSquares(DoubleThreats(&gs, 2)); d != "H3" {
+		t.Errorf("Unexpected double threats of Z [%s]", d)
+	}
+	score := ThreatScore(&gs)
+	if sum := score[0] + score[1] + score[2]; math.Abs(float64(sum)-1) > 1e-6 || score[2] <= score[0] || score[0] <= score[1] {
+		t.Errorf("Unexpected threat score %v", score)
+	}
+	evals := EvalPosition(&gs)
+	if z := evals[2]; !z.Active || z.ToMove || strings.Join(z.Wins, " ") != "H7" || z.WinsBitboard != "0x0080000000000000" {
+		t.Errorf("Unexpected eval of Z %+v", z)
+	}
+	if !evals[0].ToMove || strings.Join(evals[0].Doubles, " ") != "E2" {
+		t.Errorf("Unexpected eval of X %+v", evals[0])
+	}
+}
@@ -0,0 +1,113 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"squava/game"
+)
+
+// --- External engine player ---
+
+// ExternalPlayer asks another program for its moves. The program is started
+// once, with the shell, and spoken to line by line: for every move squava
+// writes the game so far as
+//
+//	moves D4 E5 C3
+//
+// ("moves" alone on an empty board) and reads back one line holding the move
+// in any notation ParseMove accepts, or "resign". An engine that fails,
+// answers late with garbage, or plays an illegal move resigns.
+type ExternalPlayer struct {
+	info    PlayerInfo
+	command string
+	game    *SquavaGame // Set by AddPlayer; supplies the move history
+
+	proc *exec.Cmd
+	in   io.WriteCloser
+	out  *bufio.Reader
+}
+
+func NewExternalPlayer(name, symbol string, id int, command string) *ExternalPlayer {
+	return &ExternalPlayer{info: PlayerInfo{name: name, symbol: symbol, id: id}, command: command}
+}
+func (e *ExternalPlayer) Name() string   { return e.info.name }
+func (e *ExternalPlayer) Symbol() string { return e.info.symbol }
+func (e *ExternalPlayer) ID() int        { return e.info.id }
+
+func (e *ExternalPlayer) start() error {
+	e.proc = exec.Command("sh", "-c", e.command)
+	e.proc.Stderr = os.Stderr
+	in, err := e.proc.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := e.proc.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := e.proc.Start(); err != nil {
+		return err
+	}
+	e.in, e.out = in, bufio.NewReader(out)
+	return nil
+}
+
+func (e *ExternalPlayer) fail(format string, args ...any) game.Move {
+	fmt.Fprintf(os.Stderr, "%s (%s): %s; resigning\n", e.info.name, e.command, fmt.Sprintf(format, args...))
+	return game.ResignMove
+}
+
+func (e *ExternalPlayer) GetMove(board game.Board, players []int, turnIdx int) game.Move {
+	if e.proc == nil {
+		if err := e.start(); err != nil {
+			return e.fail("could not start: %v", err)
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString("moves")
+	if e.game != nil {
+		for _, m := range e.game.moves {
+			sb.WriteByte(' ')
+			sb.WriteString(game.FormatRecordMove(m))
+		}
+	}
+	sb.WriteByte('\n')
+	if _, err := io.WriteString(e.in, sb.String()); err != nil {
+		return e.fail("could not send the position: %v", err)
+	}
+	line, err := e.out.ReadString('\n')
+	if err != nil && line == "" {
+		return e.fail("no reply: %v", err)
+	}
+	line = strings.TrimSpace(line)
+	if strings.EqualFold(line, "resign") {
+		return game.ResignMove
+	}
+	move, err := game.ParseMove(line)
+	if err != nil {
+		return e.fail("bad reply %q: %v", line, err)
+	}
+	gs := game.NewGameState(board, players[turnIdx], game.ActiveMaskOf(players))
+	if gs.LegalMoves()&(game.Bitboard(1)<<uint(move.ToIndex())) == 0 {
+		return e.fail("illegal move %s", move)
+	}
+	return move
+}
+
+// Close stops the engine process.
+func (e *ExternalPlayer) Close() error {
+	if e.proc == nil {
+		return nil
+	}
+	e.in.Close()
+	err := e.proc.Wait()
+	e.proc = nil
+	return err
+}
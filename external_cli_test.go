@@ -0,0 +1,28 @@
+//go:build !wasm
+
+package main
+
+import (
+	"testing"
+
+	"squava/game"
+)
+
+func TestExternalPlayer(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	ext := NewExternalPlayer("Ext", "E", 0, "while read line; do echo D4; done")
+	defer ext.Close()
+	g.players[0] = ext
+	ext.game = g
+	players := []int{0, 1, 2}
+	if m := ext.GetMove(g.gs.Board, players, 0); m.String() != "D4" {
+		t.Fatalf("Expected D4, got %v", m)
+	}
+	g.play(game.MoveFromIndex(27))
+	g.play(game.MoveFromIndex(0))
+	g.play(game.MoveFromIndex(1))
+	// D4 is taken now, so the engine's answer is illegal.
+	if m := ext.GetMove(g.gs.Board, players, 0); m != game.ResignMove {
+		t.Errorf("Expected an illegal reply to resign, got %v", m)
+	}
+}
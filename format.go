@@ -0,0 +1,31 @@
+package main
+
+import "squava/game"
+
+// --- File format versions ---
+
+// The files squava writes name the version of their format in their header:
+// a [Version] tag in a game record, a "# squava puzzles version N" line in a
+// puzzle file, a {"format":"squava-db","version":N} line in a game database,
+// a "version" field in a user profile and a binary header in an opening book
+// or a table file. Additions that older readers can
+// safely ignore, such as a new tag, keep the version, since readers skip
+// what they do not know. A version is bumped only by a change older readers
+// would misread, and they refuse such files rather than guess. Files from before versions are
+// version 0; readers upgrade older versions as they read them, and `squava
+// migrate` rewrites files in the current version.
+
+// Versions of the files of this package. Game records and databases take
+// theirs from package game: game.RecordVersion and game.DBVersion.
+const (
+	PuzzleVersion  = 1 // .sqp puzzle files
+	BookVersion    = 1 // .sqb opening books
+	TableVersion   = 1 // .sqt saved search tables
+	ProfileVersion = 1 // User profiles
+)
+
+// checkVersion returns an error if a file of the given kind in version v is
+// newer than this squava reads.
+func checkVersion(kind string, v, current int) error {
+	return game.CheckVersion(kind, v, current)
+}
@@ -0,0 +1,28 @@
+package game
+
+import "fmt"
+
+// --- File format versions ---
+
+// The files of this package name the version of their format in their
+// header: a [Version] tag in a game record and a
+// {"format":"squava-db","version":N} line in a game database. Additions that
+// older readers can safely ignore keep the version; a version is bumped only
+// by a change older readers would misread, and they refuse such files
+// rather than guess. Files from before versions are version 0.
+const (
+	RecordVersion = 1 // .sqv game records
+	DBVersion     = 1 // Game databases
+)
+
+// CheckVersion returns an error if a file of the given kind in version v is
+// newer than this squava reads, which reads up to version current.
+func CheckVersion(kind string, v, current int) error {
+	if v < 0 {
+		return fmt.Errorf("bad %s version %d", kind, v)
+	}
+	if v > current {
+		return fmt.Errorf("%s version %d is newer than this squava reads (up to %d); upgrade squava to read it", kind, v, current)
+	}
+	return nil
+}
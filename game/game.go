@@ -0,0 +1,500 @@
+// Package game is the game of squava and its files: the board, moves and
+// positions, the rules that play them, the notation, and the game records
+// and databases squava saves, with iterators that replay them move by move
+// for other programs.
+package game
+
+import (
+	"math/bits"
+
+	"squava/internal/kernels"
+)
+
+const (
+	BoardSize = 8
+)
+
+type Board struct {
+	P        [3]Bitboard
+	Occupied Bitboard
+}
+type Bitboard uint64
+
+type Move struct {
+	r, c int8
+}
+
+func (m Move) ToIndex() int {
+	return int(m.r)*8 + int(m.c)
+}
+func MoveFromIndex(idx int) Move {
+	return Move{r: int8(idx / 8), c: int8(idx % 8)}
+}
+
+// Row and Col return the move's row and column, from 0.
+func (m Move) Row() int { return int(m.r) }
+func (m Move) Col() int { return int(m.c) }
+
+// String returns the move in algebraic notation, e.g. "A1".
+func (m Move) String() string {
+	return string([]byte{'A' + byte(m.c), '1' + byte(m.r)})
+}
+
+// --- Bitboard Logic ---
+func (b *Board) Set(idx int, pID int) {
+	mask := Bitboard(uint64(1) << idx)
+	b.P[pID] |= mask
+	b.Occupied |= mask
+}
+
+func (b *Board) Move(pID int, idx int) Bitboard {
+	mask := Bitboard(uint64(1) << uint(idx))
+	b.P[pID] |= mask
+	b.Occupied |= mask
+	return mask
+}
+func (b *Board) GetPlayerBoard(pID int) Bitboard {
+	return b.P[pID]
+}
+
+func CheckBoard(bb Bitboard) (isWin, isLoss bool) {
+	wins, loses := GetWinsAndLosses(bb, bb)
+	isWin = wins != 0
+	isLoss = !isWin && loses != 0
+	return
+}
+
+// GetWinsAndLosses calculates win and loss bitboards.
+func GetWinsAndLosses(bb Bitboard, empty Bitboard) (wins Bitboard, loses Bitboard) {
+	w, l := kernels.WinsAndLosses(uint64(bb), uint64(empty))
+	return Bitboard(w), Bitboard(l & ^w)
+}
+
+// ActiveMaskOf converts a list of active player IDs to a bitmask.
+func ActiveMaskOf(players []int) uint8 {
+	activeMask := uint8(0)
+	for _, pID := range players {
+		activeMask |= 1 << uint(pID)
+	}
+	return activeMask
+}
+
+func GetForcedMoves(board Board, players []int, turnIdx int) Bitboard {
+	gs := NewGameState(board, players[turnIdx], ActiveMaskOf(players))
+
+	if gs.Wins[gs.PlayerID] != 0 {
+		return gs.Wins[gs.PlayerID]
+	}
+	nextP := gs.NextPlayer()
+	if nextP != -1 {
+		return gs.Wins[nextP]
+	}
+	return 0
+}
+
+var nextPlayerTable [3][256]int8
+
+type zobristTable struct {
+	piece  [3][64]uint64
+	turn   [3]uint64
+	active [256]uint64
+
+	// sym[p][idx][s] is piece[p] of the square symmetry s maps idx to, the
+	// key of the stone in the position transformed by s.
+	sym [3][64][NumSymmetries]uint64
+}
+
+func newZobristTable() *zobristTable {
+	z := &zobristTable{}
+	// Use a local xorshift for deterministic initialization
+	s := uint64(42)
+	next := func() uint64 {
+		s ^= s >> 12
+		s ^= s << 25
+		s ^= s >> 27
+		return s * 0x2545F4914F6CDD1D
+	}
+
+	for p := 0; p < 3; p++ {
+		for i := 0; i < 64; i++ {
+			z.piece[p][i] = next()
+		}
+		z.turn[p] = next()
+	}
+	for i := 0; i < 256; i++ {
+		z.active[i] = next()
+	}
+	for p := range z.sym {
+		for i := range z.sym[p] {
+			for s := range z.sym[p][i] {
+				z.sym[p][i][s] = z.piece[p][TransformSquare(i, s)]
+			}
+		}
+	}
+	return z
+}
+
+var zobrist *zobristTable
+
+func (z *zobristTable) Move(h uint64, pID int, idx int) uint64 {
+	return h ^ z.piece[pID][idx]
+}
+
+func (z *zobristTable) SwapTurn(h uint64, oldPID, newPID int) uint64 {
+	if newPID == -1 {
+		return h ^ z.turn[oldPID]
+	}
+	return h ^ z.turn[oldPID] ^ z.turn[newPID]
+}
+
+func (z *zobristTable) UpdateMask(h uint64, oldMask, newMask uint8) uint64 {
+	return h ^ z.active[oldMask] ^ z.active[newMask]
+}
+
+func (z *zobristTable) ComputeHash(board Board, playerToMoveID int, activeMask uint8) uint64 {
+	var h uint64
+	if playerToMoveID >= 0 && playerToMoveID < 3 {
+		h = z.turn[playerToMoveID]
+	}
+	h ^= z.active[activeMask]
+	for p := 0; p < 3; p++ {
+		pBoard := uint64(board.P[p])
+		for pBoard != 0 {
+			idx := bits.TrailingZeros64(pBoard)
+			h ^= z.piece[p][idx]
+			pBoard &= pBoard - 1
+		}
+	}
+	return h
+}
+
+// ComputeHash returns the Zobrist hash of the position: the hash a
+// GameState of it keeps in Hash.
+func ComputeHash(board Board, playerToMoveID int, activeMask uint8) uint64 {
+	return zobrist.ComputeHash(board, playerToMoveID, activeMask)
+}
+
+func init() {
+	zobrist = newZobristTable()
+	for p := 0; p < 3; p++ {
+		for m := 0; m < 256; m++ {
+			nextPlayerTable[p][m] = -1
+			for i := 1; i <= 2; i++ {
+				next := (p + i) % 3
+				if (m & (1 << uint(next))) != 0 {
+					nextPlayerTable[p][m] = int8(next)
+					break
+				}
+			}
+		}
+	}
+}
+
+// NextPlayer returns the player after currentID among the players in
+// activeMask, or -1 if none is left.
+func NextPlayer(currentID int, activeMask uint8) int {
+	return int(nextPlayerTable[currentID][activeMask])
+}
+
+type GameState struct {
+	Board      Board
+	Hash       uint64
+	PlayerID   int
+	ActiveMask uint8
+	WinnerID   int
+	Terminal   bool
+	Wins       [3]Bitboard
+	Loses      [3]Bitboard
+}
+
+func NewGameState(board Board, playerID int, activeMask uint8) GameState {
+	gs := GameState{
+		Board:      board,
+		PlayerID:   playerID,
+		ActiveMask: activeMask,
+		WinnerID:   -1,
+	}
+	gs.Hash = zobrist.ComputeHash(board, playerID, activeMask)
+	gs.InitThreats()
+	return gs
+}
+
+func (gs *GameState) NextPlayer() int {
+	return int(nextPlayerTable[gs.PlayerID][gs.ActiveMask])
+}
+
+func (gs *GameState) IsTerminal() (int, bool) {
+	return gs.WinnerID, gs.Terminal
+}
+
+func (gs *GameState) ActiveIDs() []int {
+	ids := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		if (gs.ActiveMask & (1 << uint(i))) != 0 {
+			ids = append(ids, i)
+		}
+	}
+	return ids
+}
+
+func (gs *GameState) GetBestMoves() Bitboard {
+	if gs.Wins[gs.PlayerID] != 0 {
+		return gs.Wins[gs.PlayerID]
+	}
+	nextP := gs.NextPlayer()
+	if nextP != -1 && gs.Wins[nextP] != 0 {
+		return gs.Wins[nextP]
+	}
+	empty := ^gs.Board.Occupied
+	safe := empty & ^gs.Loses[gs.PlayerID]
+	if safe != 0 {
+		return safe
+	}
+	return empty
+}
+
+// LegalMoves returns every square the player to move may play. When a forced
+// move applies (an immediate win, or blocking the next player's win) only those
+// squares are legal; otherwise any empty square is. Terminal states have none.
+func (gs *GameState) LegalMoves() Bitboard {
+	if gs.Terminal {
+		return 0
+	}
+	if forced := gs.ForcedMoves(); forced != 0 {
+		return forced
+	}
+	return ^gs.Board.Occupied
+}
+
+// ForcedMoves returns the squares the player to move is restricted to, or 0
+// when any empty square may be played.
+func (gs *GameState) ForcedMoves() Bitboard {
+	if gs.Terminal {
+		return 0
+	}
+	if gs.Wins[gs.PlayerID] != 0 {
+		return gs.Wins[gs.PlayerID]
+	}
+	nextP := gs.NextPlayer()
+	if nextP != -1 {
+		return gs.Wins[nextP]
+	}
+	return 0
+}
+
+func (gs *GameState) InitThreats() {
+	empty := ^gs.Board.Occupied
+	activeCount := bits.OnesCount8(gs.ActiveMask)
+
+	// Re-evaluate terminal state
+	if gs.WinnerID != -1 {
+		gs.Terminal = true
+	} else if activeCount <= 1 {
+		gs.Terminal = true
+		if activeCount == 1 {
+			gs.WinnerID = bits.TrailingZeros8(gs.ActiveMask)
+		}
+	} else if empty == 0 {
+		gs.Terminal = true
+	} else {
+		gs.Terminal = false
+	}
+
+	for p := 0; p < 3; p++ {
+		if (gs.ActiveMask & (1 << uint(p))) != 0 {
+			gs.Wins[p], gs.Loses[p] = GetWinsAndLosses(gs.Board.P[p], empty)
+		} else {
+			gs.Wins[p] = 0
+			gs.Loses[p] = 0
+		}
+	}
+}
+
+func (gs *GameState) applyPiece(idx int) {
+	gs.Board.Move(gs.PlayerID, idx)
+	gs.Hash = zobrist.Move(gs.Hash, gs.PlayerID, idx)
+}
+
+func (gs *GameState) updateTurn(nextID int) {
+	gs.Hash = zobrist.SwapTurn(gs.Hash, gs.PlayerID, nextID)
+	gs.PlayerID = nextID
+}
+
+func (gs *GameState) updateActiveMask(newMask uint8) {
+	gs.Hash = zobrist.UpdateMask(gs.Hash, gs.ActiveMask, newMask)
+	gs.ActiveMask = newMask
+}
+
+func (gs *GameState) setWinner(winnerID int) {
+	gs.WinnerID = winnerID
+	gs.Hash = zobrist.SwapTurn(gs.Hash, gs.PlayerID, -1)
+	gs.PlayerID = -1
+	gs.Terminal = true
+}
+
+func (gs *GameState) ApplyMove(move Move) {
+	gs.ApplyMoveIdx(move.ToIndex())
+}
+
+func (gs *GameState) ApplyMoveIdx(idx int) {
+	if debugChecks {
+		before := *gs
+		gs.applyMoveIdx(idx)
+		gs.checkInvariants("ApplyMoveIdx", idx, &before)
+		return
+	}
+	gs.applyMoveIdx(idx)
+}
+
+func (gs *GameState) applyMoveIdx(idx int) {
+	mask := Bitboard(1 << uint(idx))
+	pID := gs.PlayerID
+
+	// 1. Immediate win
+	if (gs.Wins[pID] & mask) != 0 {
+		gs.applyPiece(idx)
+		gs.setWinner(pID)
+		return
+	}
+
+	// 2. Normal move or elimination
+	isLoss := (gs.Loses[pID] & mask) != 0
+	gs.applyPiece(idx)
+
+	empty := ^gs.Board.Occupied
+	invMask := ^mask
+
+	if isLoss {
+		newMask := gs.ActiveMask & ^(1 << uint(pID))
+		gs.updateActiveMask(newMask)
+		if bits.OnesCount8(newMask) == 1 {
+			gs.setWinner(bits.TrailingZeros8(newMask))
+		} else {
+			gs.updateTurn(NextPlayer(pID, newMask))
+		}
+		gs.Wins[pID] = 0
+		gs.Loses[pID] = 0
+	} else {
+		gs.updateTurn(gs.NextPlayer())
+		if empty == 0 {
+			gs.Terminal = true
+		} else {
+			if kernels.UseLineTables {
+				// Threats only grow with the mover's stones, so adding
+				// those on the lines through idx is enough.
+				w, l := kernels.LineWinsAndLosses(uint64(gs.Board.P[pID]), idx)
+				gs.Wins[pID] |= Bitboard(w) & empty
+				gs.Loses[pID] = (gs.Loses[pID] | Bitboard(l)&empty) &^ gs.Wins[pID]
+			} else {
+				// The kernel takes as long on part of the board as on all
+				// of it, but only the mover's stones on the lines through
+				// idx can make a new threat.
+				w, l := kernels.WinsAndLosses(uint64(gs.Board.P[pID])&kernels.LinesThrough(idx), uint64(empty))
+				gs.Wins[pID] |= Bitboard(w)
+				gs.Loses[pID] = (gs.Loses[pID] | Bitboard(l)) &^ gs.Wins[pID]
+			}
+		}
+	}
+
+	// Update other players' threats - unrolled loop
+	if pID != 0 {
+		gs.Wins[0] &= invMask
+		gs.Loses[0] &= invMask
+	}
+	if pID != 1 {
+		gs.Wins[1] &= invMask
+		gs.Loses[1] &= invMask
+	}
+	if pID != 2 {
+		gs.Wins[2] &= invMask
+		gs.Loses[2] &= invMask
+	}
+}
+
+// MoveUndo is what MakeMove changed, for UnmakeMove to take the move back:
+// the square and the mover, the mover's threats, which other players'
+// threats included the square, and the game's status and hash.
+type MoveUndo struct {
+	hash       uint64
+	wins       Bitboard // The mover's
+	loses      Bitboard
+	idx        int8
+	playerID   int8
+	winnerID   int8
+	activeMask uint8
+	terminal   bool
+	others     uint8 // Bit 2p is set if idx was in Wins[p], bit 2p+1 if in Loses[p]
+}
+
+// MakeMove plays the square idx like ApplyMoveIdx and returns what
+// UnmakeMove needs to take it back. Searches that make and unmake moves on
+// one GameState avoid copying it at every node.
+func (gs *GameState) MakeMove(idx int) MoveUndo {
+	pID := gs.PlayerID
+	u := MoveUndo{
+		hash:       gs.Hash,
+		wins:       gs.Wins[pID],
+		loses:      gs.Loses[pID],
+		idx:        int8(idx),
+		playerID:   int8(pID),
+		winnerID:   int8(gs.WinnerID),
+		activeMask: gs.ActiveMask,
+		terminal:   gs.Terminal,
+	}
+	mask := Bitboard(1) << uint(idx)
+	for p := 0; p < 3; p++ {
+		if gs.Wins[p]&mask != 0 {
+			u.others |= 1 << uint(2*p)
+		}
+		if gs.Loses[p]&mask != 0 {
+			u.others |= 1 << uint(2*p+1)
+		}
+	}
+	gs.ApplyMoveIdx(idx)
+	return u
+}
+
+// UnmakeMove takes back the move u was returned for, which must be the last
+// move made on gs.
+func (gs *GameState) UnmakeMove(u MoveUndo) {
+	pID := int(u.playerID)
+	mask := Bitboard(1) << uint(u.idx)
+	gs.Board.P[pID] &^= mask
+	gs.Board.Occupied &^= mask
+	for p := 0; p < 3; p++ {
+		if u.others&(1<<uint(2*p)) != 0 {
+			gs.Wins[p] |= mask
+		}
+		if u.others&(2<<uint(2*p)) != 0 {
+			gs.Loses[p] |= mask
+		}
+	}
+	gs.Wins[pID], gs.Loses[pID] = u.wins, u.loses
+	gs.Hash = u.hash
+	gs.PlayerID = pID
+	gs.WinnerID = int(u.winnerID)
+	gs.ActiveMask = u.activeMask
+	gs.Terminal = u.terminal
+	if debugChecks {
+		gs.checkInvariants("UnmakeMove", int(u.idx), gs)
+	}
+}
+
+// Resign removes the player to move from the game. Their pieces stay on the
+// board, exactly as if they had been eliminated by a 3-in-a-row.
+func (gs *GameState) Resign() {
+	if debugChecks {
+		before := *gs
+		defer gs.checkInvariants("Resign", -1, &before)
+	}
+	pID := gs.PlayerID
+	newMask := gs.ActiveMask & ^(1 << uint(pID))
+	gs.updateActiveMask(newMask)
+	if bits.OnesCount8(newMask) == 1 {
+		gs.setWinner(bits.TrailingZeros8(newMask))
+	} else {
+		gs.updateTurn(NextPlayer(pID, newMask))
+	}
+	gs.Wins[pID] = 0
+	gs.Loses[pID] = 0
+}
@@ -0,0 +1,190 @@
+package game
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"squava/internal/kernels"
+)
+
+var sink Bitboard
+
+// randomBoard scatters up to n stones of random players over the board.
+func randomBoard(rng *rand.Rand, n int) Board {
+	var board Board
+	for j := 0; j < n; j++ {
+		idx := rng.IntN(64)
+		if board.Occupied&(1<<uint(idx)) == 0 {
+			board.Set(idx, rng.IntN(3))
+		}
+	}
+	return board
+}
+
+// randomBit picks one of the set squares of bb.
+func randomBit(rng *rand.Rand, bb Bitboard) int {
+	for n := rng.IntN(bits.OnesCount64(uint64(bb))); n > 0; n-- {
+		bb &= bb - 1
+	}
+	return bits.TrailingZeros64(uint64(bb))
+}
+
+func TestZobristHelper(t *testing.T) {
+	h := uint64(100)
+	h2 := zobrist.Move(h, 0, 10)
+	if h2 != h^zobrist.piece[0][10] {
+		t.Errorf("Zobrist.Move failed")
+	}
+
+	h3 := zobrist.SwapTurn(h, 0, 1)
+	if h3 != h^zobrist.turn[0]^zobrist.turn[1] {
+		t.Errorf("Zobrist.SwapTurn failed for non-terminal")
+	}
+
+	h4 := zobrist.SwapTurn(h, 0, -1)
+	if h4 != h^zobrist.turn[0] {
+		t.Errorf("Zobrist.SwapTurn failed for terminal")
+	}
+
+	h5 := zobrist.UpdateMask(h, 0x07, 0x03)
+	if h5 != h^zobrist.active[0x07]^zobrist.active[0x03] {
+		t.Errorf("Zobrist.UpdateMask failed")
+	}
+}
+
+func TestSymHashes(t *testing.T) {
+	rng := rand.New(rand.NewPCG(4321, 0))
+	for i := 0; i < 200; i++ {
+		gs := NewGameState(randomBoard(rng, i%40), i%3, uint8(1+i%7))
+		h := gs.SymHashes()
+		for s := 0; s < NumSymmetries; s++ {
+			var board Board
+			for p := range board.P {
+				board.P[p] = TransformBitboard(gs.Board.P[p], s)
+			}
+			if want := ComputeHash(board, gs.PlayerID, gs.ActiveMask); h[s] != want {
+				t.Fatalf("symmetry %d: hash %x, want %x for the transformed board", s, h[s], want)
+			}
+		}
+		if h[0] != gs.Hash {
+			t.Fatalf("Expected the identity's hash to be the position's")
+		}
+
+		// Adding stones one at a time gives the same hashes.
+		inc := zobrist.ComputeSymHashes(Board{}, gs.PlayerID, gs.ActiveMask)
+		for p := range gs.Board.P {
+			for bb := uint64(gs.Board.P[p]); bb != 0; bb &= bb - 1 {
+				kernels.SymXor((*[NumSymmetries]uint64)(&inc), &zobrist.sym[p], bb&-bb)
+			}
+		}
+		if inc != h {
+			t.Fatalf("Expected adding one stone at a time to give the same hashes")
+		}
+	}
+}
+
+// TestStateInvariants checks that random games keep the invariants the
+// debug build checks, and that breaking each is caught with a dump.
+func TestStateInvariants(t *testing.T) {
+	for g := uint64(1); g <= 200; g++ {
+		rng := rand.New(rand.NewPCG(g, 0))
+		gs := NewGameState(Board{}, 0, 0b111)
+		for !gs.Terminal {
+			gs.ApplyMoveIdx(randomBit(rng, gs.LegalMoves()))
+			if err := gs.Validate(); err != nil {
+				t.Fatalf("Game %d: %v\n%s", g, err, gs.dump())
+			}
+		}
+	}
+
+	gs, _ := ParsePosition("8/8/8/3ZO3/3XX3/2O5/8/8 3 123")
+	for name, breakIt := range map[string]func(gs *GameState){
+		"both have stones": func(gs *GameState) { gs.Board.P[1] |= gs.Board.P[0] },
+		"Occupied":         func(gs *GameState) { gs.Board.Occupied |= 1 },
+		"hash":             func(gs *GameState) { gs.Hash++ },
+		"fourth player":    func(gs *GameState) { gs.ActiveMask |= 8 },
+		"active players":   func(gs *GameState) { gs.ActiveMask = 1 << uint(gs.PlayerID) },
+		"not active":       func(gs *GameState) { gs.ActiveMask &^= 1 << uint(gs.PlayerID) },
+		"threats":          func(gs *GameState) { gs.Loses[0] = 0 },
+	} {
+		bad := gs
+		breakIt(&bad)
+		if name != "hash" {
+			bad.Hash = ComputeHash(bad.Board, bad.PlayerID, bad.ActiveMask)
+		}
+		if err := bad.Validate(); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected an error about %s, got %v", name, err)
+		}
+	}
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "ApplyMoveIdx D4 broke a state invariant") || !strings.Contains(msg, "Before:") || !strings.Contains(msg, "    ABCDEFGH") {
+			t.Errorf("Expected a panic with a dump, got %q", msg)
+		}
+	}()
+	bad := gs
+	bad.Hash++
+	bad.checkInvariants("ApplyMoveIdx", 27, &gs)
+}
+
+func TestIncrementalThreats(t *testing.T) {
+	defer func(v bool) { kernels.UseLineTables = v }(kernels.UseLineTables)
+	for _, kernels.UseLineTables = range []bool{false, true} {
+		for g := uint64(1); g <= 300; g++ {
+			rng := rand.New(rand.NewPCG(g, 0))
+			gs := NewGameState(Board{}, 0, 0b111)
+			for !gs.Terminal {
+				gs.ApplyMoveIdx(randomBit(rng, gs.LegalMoves()))
+				ref := NewGameState(gs.Board, gs.PlayerID, gs.ActiveMask)
+				if gs.Terminal {
+					break
+				}
+				if gs.Wins != ref.Wins || gs.Loses != ref.Loses {
+					t.Fatalf("Line tables %v, game %d: incremental threats %x/%x, recomputed %x/%x", kernels.UseLineTables, g, gs.Wins, gs.Loses, ref.Wins, ref.Loses)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkThreatUpdate compares the ways to update the mover's threats:
+// the threat kernel on the whole board, the kernel on the lines through the
+// played square as ApplyMoveIdx runs it, and the line tables.
+func BenchmarkThreatUpdate(b *testing.B) {
+	rng := rand.New(rand.NewPCG(8, 0))
+	var boards [256]Bitboard
+	var empties [256]Bitboard
+	for i := range boards {
+		boards[i] = Bitboard(rng.Uint64() & rng.Uint64())
+		empties[i] = ^boards[i] & Bitboard(rng.Uint64()|rng.Uint64())
+	}
+	b.Run("Kernel", func(b *testing.B) {
+		var sum Bitboard
+		for i := 0; i < b.N; i++ {
+			j := i & 255
+			w, l := GetWinsAndLosses(boards[j], empties[j])
+			sum ^= w ^ l
+		}
+		sink = sum
+	})
+	b.Run("KernelLines", func(b *testing.B) {
+		var sum Bitboard
+		for i := 0; i < b.N; i++ {
+			j, idx := i&255, i&63
+			w, l := kernels.WinsAndLosses(uint64(boards[j])&kernels.LinesThrough(idx), uint64(empties[j]))
+			sum ^= Bitboard(w ^ l)
+		}
+		sink = sum
+	})
+	b.Run("Lines", func(b *testing.B) {
+		var sum Bitboard
+		for i := 0; i < b.N; i++ {
+			j, idx := i&255, i&63
+			w, l := kernels.LineWinsAndLosses(uint64(boards[j]), idx)
+			sum ^= Bitboard(w^l) & empties[j]
+		}
+		sink = sum
+	})
+}
@@ -0,0 +1,451 @@
+//go:build !wasm
+
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"sort"
+	"strings"
+)
+
+// --- Game database ---
+
+// DBGame is a game kept in a GameDB: its full record, plus what queries need
+// without replaying it.
+type DBGame struct {
+	ID      int       `json:"id"`
+	Source  string    `json:"source,omitempty"` // File the game was imported from
+	Players [3]string `json:"players"`
+	Outcome string    `json:"outcome"` // "p1", "p2", "p3", "draw", or "*" if unfinished
+	Length  int       `json:"length"`
+	Moves   string    `json:"moves"`  // The moves in record notation
+	Record  string    `json:"record"` // The game in canonical .sqv form
+
+	// DuplicateOf is the ID of an earlier game with the same moves, up to
+	// a rotation or reflection of the board, or 0 for the first of them.
+	DuplicateOf int `json:"duplicate_of,omitempty"`
+}
+
+// ParseRecord reads the game's record back.
+func (g *DBGame) ParseRecord() (*GameRecord, error) {
+	return ReadGameRecord(strings.NewReader(g.Record))
+}
+
+// Opening returns the first plies moves of the game in record notation.
+func (g *DBGame) Opening(plies int) string {
+	moves := strings.Fields(g.Moves)
+	return strings.Join(moves[:min(plies, len(moves))], " ")
+}
+
+// gameOutcome tells how a game that reached gs ended.
+func gameOutcome(gs GameState) string {
+	switch {
+	case !gs.Terminal:
+		return "*"
+	case gs.WinnerID < 0:
+		return "draw"
+	}
+	return fmt.Sprintf("p%d", gs.WinnerID+1)
+}
+
+// GameDB is a collection of games stored in a file, one JSON object per line,
+// after a header line giving the format version (see DBVersion):
+//
+//	{"format":"squava-db","version":1}
+//
+// It is read whole when opened and rewritten by Save.
+type GameDB struct {
+	path    string
+	Version int // Format version of the file when opened
+	Games   []*DBGame
+	nextID  int
+	games   map[string]*DBGame // The first game of each CanonicalGame
+}
+
+// dbHeader is the first line of a database file.
+type dbHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+const dbFormat = "squava-db"
+
+// OpenGameDB reads the database at path; a missing file is an empty
+// database. A database in an earlier format version is upgraded as it is
+// read, and written in the current one by Save.
+func OpenGameDB(path string) (*GameDB, error) {
+	db := &GameDB{path: path, Version: DBVersion, nextID: 1, games: map[string]*DBGame{}}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	db.Version = 0
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		if len(db.Games) == 0 && db.Version == 0 {
+			var h dbHeader
+			if json.Unmarshal(sc.Bytes(), &h) == nil && h.Format == dbFormat {
+				if err := CheckVersion("database", h.Version, DBVersion); err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+				}
+				db.Version = h.Version
+				continue
+			}
+		}
+		g := &DBGame{}
+		if err := json.Unmarshal(sc.Bytes(), g); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		db.Games = append(db.Games, g)
+		db.nextID = max(db.nextID, g.ID+1)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if db.Version < 1 {
+		// Version 0 kept the records of its games as written, without a
+		// version of their own.
+		for _, g := range db.Games {
+			if err := g.upgradeRecord(); err != nil {
+				return nil, fmt.Errorf("%s: game %d: %v", path, g.ID, err)
+			}
+		}
+	}
+	for _, g := range db.Games {
+		if err := db.index(g); err != nil {
+			return nil, fmt.Errorf("%s: game %d: %v", path, g.ID, err)
+		}
+	}
+	return db, nil
+}
+
+// index records g as the first of its moves if no earlier game has them.
+func (db *GameDB) index(g *DBGame) error {
+	rec := &GameRecord{}
+	if err := rec.parseMoves(g.Moves, 1); err != nil {
+		return err
+	}
+	key, _ := CanonicalGame(rec.Moves)
+	if db.games == nil {
+		db.games = map[string]*DBGame{}
+	}
+	if _, ok := db.games[key]; !ok {
+		db.games[key] = g
+	}
+	return nil
+}
+
+// Duplicate returns the game of the database with the same moves as rec, up
+// to a rotation or reflection of the board, or nil if there is none.
+func (db *GameDB) Duplicate(rec *GameRecord) *DBGame {
+	key, _ := CanonicalGame(rec.Moves)
+	return db.games[key]
+}
+
+// upgradeRecord rewrites the game's record in the current record format.
+func (g *DBGame) upgradeRecord() error {
+	rec, err := g.ParseRecord()
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if err := rec.Write(&sb); err != nil {
+		return err
+	}
+	g.Record = sb.String()
+	return nil
+}
+
+// Add validates rec against the rules and adds it to the database. A game
+// that duplicates one already there is added linked to it (see DuplicateOf);
+// callers that would rather skip it check Duplicate first.
+func (db *GameDB) Add(rec *GameRecord, source string) (*DBGame, error) {
+	positions, err := rec.Positions()
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	if err := rec.Write(&sb); err != nil {
+		return nil, err
+	}
+	moves := make([]string, len(rec.Moves))
+	for i, m := range rec.Moves {
+		moves[i] = FormatRecordMove(m)
+	}
+	g := &DBGame{
+		ID:      db.nextID,
+		Source:  source,
+		Players: rec.Players,
+		Outcome: gameOutcome(positions[len(positions)-1]),
+		Length:  len(rec.Moves),
+		Moves:   strings.Join(moves, " "),
+		Record:  sb.String(),
+	}
+	if orig := db.Duplicate(rec); orig != nil {
+		g.DuplicateOf = orig.ID
+	}
+	db.nextID++
+	db.Games = append(db.Games, g)
+	if err := db.index(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Save writes the database back to its file, replacing it only once fully
+// written.
+func (db *GameDB) Save() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(dbHeader{dbFormat, DBVersion}); err != nil {
+		return err
+	}
+	for _, g := range db.Games {
+		if err := enc.Encode(g); err != nil {
+			return err
+		}
+	}
+	tmp := db.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, db.path)
+}
+
+// GameFilter selects games of a database; zero fields match every game but
+// the duplicates, so that each game counts once in statistics.
+type GameFilter struct {
+	Player     string // A player type in any seat, or in one seat as "p2=mcts"
+	Outcome    string // "p1", "p2", "p3", "draw" or "*"
+	Opening    string // Moves the game must start with, e.g. "D4 E5"
+	Duplicates bool   // Also match the games linked as duplicates
+}
+
+// Match reports whether g passes the filter.
+func (f *GameFilter) Match(g *DBGame) bool {
+	if g.DuplicateOf != 0 && !f.Duplicates {
+		return false
+	}
+	if f.Outcome != "" && g.Outcome != f.Outcome {
+		return false
+	}
+	if f.Player != "" {
+		seat, player, ok := strings.Cut(f.Player, "=")
+		found := false
+		for i, p := range g.Players {
+			if ok && seat == fmt.Sprintf("p%d", i+1) && p == player || !ok && p == f.Player {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Opening != "" {
+		want := strings.Fields(f.Opening)
+		if g.Opening(len(want)) != strings.Join(want, " ") {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the games that pass f, in database order.
+func (db *GameDB) Select(f GameFilter) []*DBGame {
+	var out []*DBGame
+	for _, g := range db.Games {
+		if f.Match(g) {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// OpeningStat counts the results of games that reached the same position
+// after their first moves, by any move order and up to a rotation or
+// reflection of the board.
+type OpeningStat struct {
+	Opening  string // The move order played most often, as played
+	Orders   int    // How many move orders reached the position
+	Position string // The position, in its canonical form
+	Games    int
+	Wins     [3]int
+	Draws    int
+}
+
+// OpeningStats groups finished games by the position after their first plies
+// moves, most played first. Positions are keyed by their canonical hash (see
+// SymHashes.Canonical), so transpositions and mirror images of an opening
+// count as one.
+func OpeningStats(games []*DBGame, plies int) ([]OpeningStat, error) {
+	index := map[uint64]int{}
+	var stats []OpeningStat
+	var orders []map[string]int
+	for _, g := range games {
+		if g.Length < plies || g.Outcome == "*" {
+			continue
+		}
+		_, positions, err := g.Replay()
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %v", g.ID, err)
+		}
+		h := positions[plies].SymHashes()
+		key, _ := h.Canonical()
+		i, ok := index[key]
+		if !ok {
+			i = len(stats)
+			index[key] = i
+			pos, _ := CanonicalPosition(positions[plies])
+			stats = append(stats, OpeningStat{Position: pos})
+			orders = append(orders, map[string]int{})
+		}
+		s := &stats[i]
+		s.Games++
+		if g.Outcome == "draw" {
+			s.Draws++
+		} else {
+			s.Wins[g.Outcome[1]-'1']++
+		}
+		orders[i][g.Opening(plies)]++
+	}
+	for i := range stats {
+		s := &stats[i]
+		s.Orders = len(orders[i])
+		for opening, n := range orders[i] {
+			if best := orders[i][s.Opening]; s.Opening == "" || n > best || n == best && opening < s.Opening {
+				s.Opening = opening
+			}
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Games != stats[j].Games {
+			return stats[i].Games > stats[j].Games
+		}
+		return stats[i].Opening < stats[j].Opening
+	})
+	return stats, nil
+}
+
+// Records returns an iterator over the records of the database's games, in
+// order, leaving out the duplicates. A game whose record does not parse yields an error naming it and
+// ends the iteration.
+func (db *GameDB) Records() iter.Seq2[*GameRecord, error] {
+	return func(yield func(*GameRecord, error) bool) {
+		for _, g := range db.Select(GameFilter{}) {
+			rec, err := g.ParseRecord()
+			if err != nil {
+				yield(nil, fmt.Errorf("game %d: %v", g.ID, err))
+				return
+			}
+			if !yield(rec, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Replay parses the game's moves and returns them with the position before
+// each move, followed by the final one.
+func (g *DBGame) Replay() ([]Move, []GameState, error) {
+	rec := &GameRecord{}
+	if err := rec.parseMoves(g.Moves, 1); err != nil {
+		return nil, nil, err
+	}
+	positions, err := rec.Positions()
+	return rec.Moves, positions, err
+}
+
+// GamePly is a position of a stored game: the one after its first Ply moves,
+// which symmetry Sym maps to its canonical form (see CanonicalPosition).
+type GamePly struct {
+	Game *DBGame
+	Ply  int
+	Sym  int
+}
+
+// PositionIndex finds where positions occur in a set of games, by their
+// canonical form. It covers the stones, the player to move and the players
+// still in, so move orders that reach the same position meet, and so do
+// games that reach its rotations and reflections.
+type PositionIndex map[string][]GamePly
+
+// NewPositionIndex indexes every position of games.
+func NewPositionIndex(games []*DBGame) (PositionIndex, error) {
+	idx := PositionIndex{}
+	for _, g := range games {
+		_, positions, err := g.Replay()
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %v", g.ID, err)
+		}
+		for ply, gs := range positions {
+			pos, s := CanonicalPosition(gs)
+			idx[pos] = append(idx[pos], GamePly{g, ply, s})
+		}
+	}
+	return idx, nil
+}
+
+// ExplorerMove is what followed a position when one move was played from it.
+type ExplorerMove struct {
+	Move  string
+	Games int
+	Wins  [3]int
+	Draws int
+}
+
+// Explore lists the moves played from gs in the indexed games, most played
+// first and turned into the orientation of gs, and the number of games that
+// reached gs or one of its rotations and reflections.
+func (idx PositionIndex) Explore(gs GameState) (int, []ExplorerMove) {
+	pos, s := CanonicalPosition(gs)
+	inv := InverseSymmetry(s)
+	plies := idx[pos]
+	index := map[string]int{}
+	var moves []ExplorerMove
+	for _, at := range plies {
+		played := strings.Fields(at.Game.Moves)
+		if at.Ply >= len(played) {
+			continue
+		}
+		// Turn the move of the game into the orientation of gs.
+		move := played[at.Ply]
+		if m, err := ParseMove(move); err == nil {
+			move = MoveFromIndex(TransformSquare(TransformSquare(m.ToIndex(), at.Sym), inv)).String()
+		}
+		i, ok := index[move]
+		if !ok {
+			i = len(moves)
+			index[move] = i
+			moves = append(moves, ExplorerMove{Move: move})
+		}
+		m := &moves[i]
+		m.Games++
+		switch o := at.Game.Outcome; o {
+		case "draw":
+			m.Draws++
+		case "p1", "p2", "p3":
+			m.Wins[o[1]-'1']++
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		if moves[i].Games != moves[j].Games {
+			return moves[i].Games > moves[j].Games
+		}
+		return moves[i].Move < moves[j].Move
+	})
+	return len(plies), moves
+}
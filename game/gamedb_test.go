@@ -0,0 +1,169 @@
+//go:build !wasm
+
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGameDB(t *testing.T) {
+	path := t.TempDir() + "/games.db"
+	db, err := OpenGameDB(path)
+	if err != nil || len(db.Games) != 0 {
+		t.Fatalf("Expected an empty database, got %v, %v", db, err)
+	}
+	for _, moves := range []string{
+		"D4 E5 C3 A1 A2 H8",
+		"D4 E5 F6",
+		"C3 D4 E5",
+		// X and then Z make 3-in-a-row, leaving O the last player.
+		"A1 H8 H1 B1 G8 H2 C1 A5 H3",
+	} {
+		rec, _ := ReadGameRecord(strings.NewReader(moves))
+		rec.Players = [3]string{"mcts", "human", "mcts@500"}
+		if _, err := db.Add(rec, "test"); err != nil {
+			t.Fatalf("%s: %v", moves, err)
+		}
+	}
+	rec, _ := ReadGameRecord(strings.NewReader("D4 D4"))
+	if _, err := db.Add(rec, "test"); err == nil {
+		t.Error("Expected an illegal game to be rejected")
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = OpenGameDB(path)
+	if err != nil || len(db.Games) != 4 {
+		t.Fatalf("Expected 4 games after reopening, got %v", err)
+	}
+	if g := db.Games[3]; g.ID != 4 || g.Outcome != "p2" || g.Length != 9 || g.Opening(3) != "A1 H8 H1" {
+		t.Errorf("Unexpected game %+v", g)
+	}
+	if r, err := db.Games[0].ParseRecord(); err != nil || len(r.Moves) != 6 {
+		t.Errorf("Record did not round trip: %v", err)
+	}
+	count := func(f GameFilter) int { return len(db.Select(f)) }
+	if n := count(GameFilter{Opening: "D4 E5"}); n != 2 {
+		t.Errorf("Expected 2 games opening D4 E5, got %d", n)
+	}
+	if n := count(GameFilter{Outcome: "*"}); n != 3 {
+		t.Errorf("Expected 3 unfinished games, got %d", n)
+	}
+	if count(GameFilter{Player: "p2=human"}) != 4 || count(GameFilter{Player: "p1=human"}) != 0 || count(GameFilter{Player: "mcts@500"}) != 4 {
+		t.Error("Player filters matched the wrong games")
+	}
+	stats, err := OpeningStats(db.Games, 2)
+	if err != nil || len(stats) != 1 || stats[0].Opening != "A1 H8" || stats[0].Wins[1] != 1 {
+		t.Errorf("Unexpected opening stats %+v", stats)
+	}
+}
+
+func TestGameDBDuplicates(t *testing.T) {
+	path := t.TempDir() + "/games.db"
+	db, _ := OpenGameDB(path)
+	add := func(moves string) *DBGame {
+		t.Helper()
+		rec, _ := ReadGameRecord(strings.NewReader(moves))
+		g, err := db.Add(rec, "test")
+		if err != nil {
+			t.Fatalf("%s: %v", moves, err)
+		}
+		return g
+	}
+	add("D4 E5 C3 A1 B2 H8")
+	add("A1 B2 H8 D4 E5 C3") // The same position by another move order
+	if g := add("E4 D5 F3 H1 G2 A8"); g.DuplicateOf != 1 {
+		t.Errorf("Expected the mirrored game to duplicate game 1, got %d", g.DuplicateOf)
+	}
+	if g := add("D4 E5 C3 A1 B2 H8 resign"); g.DuplicateOf != 0 {
+		t.Errorf("Expected a longer game not to be a duplicate, got %d", g.DuplicateOf)
+	}
+	rec, _ := ReadGameRecord(strings.NewReader("D5 E4 C6 A8 B7 H1"))
+	if g := db.Duplicate(rec); g == nil || g.ID != 1 {
+		t.Errorf("Expected the flipped game to be found as game 1, got %+v", g)
+	}
+	if n := len(db.Select(GameFilter{})); n != 3 {
+		t.Errorf("Expected 3 games without the duplicate, got %d", n)
+	}
+	if n := len(db.Select(GameFilter{Duplicates: true})); n != 4 {
+		t.Errorf("Expected 4 games with the duplicate, got %d", n)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenGameDB(path)
+	if err != nil || db.Games[2].DuplicateOf != 1 || db.Duplicate(rec) != db.Games[0] {
+		t.Fatalf("Duplicates were not kept on reopening: %v", err)
+	}
+	n := 0
+	for _, err := range db.Records() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("Expected Records to leave out the duplicate, got %d games", n)
+	}
+}
+
+func TestOpeningStats(t *testing.T) {
+	db := &GameDB{nextID: 1}
+	for _, moves := range []string{
+		"D4 E5 C3 A1 resign resign",
+		"A1 E5 C3 D4 resign resign", // The same position by another move order
+		"E4 D5 F3 H1 resign resign", // The first game mirrored
+		"D4 E5 F6 A1 resign resign",
+		"D4 E5 C3 A1", // Unfinished
+	} {
+		rec, _ := ReadGameRecord(strings.NewReader(moves))
+		if _, err := db.Add(rec, "test"); err != nil {
+			t.Fatalf("%s: %v", moves, err)
+		}
+	}
+	stats, err := OpeningStats(db.Games, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Games != 3 || stats[0].Orders != 3 || stats[0].Opening != "A1 E5 C3 D4" || stats[0].Wins[0] != 3 || stats[1].Games != 1 {
+		t.Errorf("Unexpected opening stats %+v", stats)
+	}
+	rec, _ := ReadGameRecord(strings.NewReader("D4 E5 C3 A1"))
+	positions, _ := rec.Positions()
+	if want, _ := CanonicalPosition(positions[4]); stats[0].Position != want {
+		t.Errorf("Expected position %s, got %s", want, stats[0].Position)
+	}
+}
+
+func TestPositionIndex(t *testing.T) {
+	db := &GameDB{nextID: 1}
+	for _, moves := range []string{
+		"D4 E5 C3 A1 B2 H8 F6",
+		"A1 B2 H8 D4 E5 C3 G7", // The same position by another move order
+		"D4 E5 H8",
+		"A1 H8 H1 B1 G8 H2 C1 A5 H3",
+		"E4 D5 F3 H1 G2 A8 C6", // The first game mirrored
+	} {
+		rec, _ := ReadGameRecord(strings.NewReader(moves))
+		if _, err := db.Add(rec, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx, err := NewPositionIndex(db.Games)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _ := ReadGameRecord(strings.NewReader("D4 E5 C3 A1 B2 H8"))
+	positions, _ := rec.Positions()
+	reached, moves := idx.Explore(positions[6])
+	if reached != 3 || len(moves) != 2 || moves[0].Move != "F6" || moves[1].Move != "G7" || moves[0].Games != 2 {
+		t.Errorf("Unexpected exploration: %d games, %+v", reached, moves)
+	}
+	reached, moves = idx.Explore(NewGameState(Board{}, 0, 0x07))
+	if reached != 5 || moves[0].Move != "A1" || moves[0].Games != 2 || moves[0].Wins[1] != 1 || moves[1].Move != "D4" {
+		t.Errorf("Unexpected exploration of the empty board: %d games, %+v", reached, moves)
+	}
+}
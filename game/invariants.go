@@ -0,0 +1,106 @@
+package game
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// --- State invariants ---
+
+// Built with -tags debug, squava checks the invariants of a GameState after
+// every move, resignation and unmade move, and panics with a dump of the
+// state, and of the state before the move, when one fails. Without the tag
+// the checks compile away.
+
+// checkInvariants panics if gs breaks an invariant after op, which turned
+// before into gs playing the square idx, or -1 for none.
+func (gs *GameState) checkInvariants(op string, idx int, before *GameState) {
+	if err := gs.Validate(); err != nil {
+		if idx >= 0 {
+			op += " " + MoveFromIndex(idx).String()
+		}
+		panic(fmt.Sprintf("%s broke a state invariant: %v\nBefore:\n%sAfter:\n%s", op, err, before.dump(), gs.dump()))
+	}
+}
+
+// Validate returns the first invariant gs breaks, or nil: the
+// players' stones are disjoint and make up Occupied, the hash is the
+// hash of the position, the active players are a subset of the three, and
+// an unfinished game has a player to move among at least two active ones,
+// whose threats are those of the board.
+func (gs *GameState) Validate() error {
+	b := &gs.Board
+	for p := 0; p < 3; p++ {
+		for q := p + 1; q < 3; q++ {
+			if both := b.P[p] & b.P[q]; both != 0 {
+				return fmt.Errorf("players %d and %d both have stones on %x", p+1, q+1, uint64(both))
+			}
+		}
+	}
+	if union := b.P[0] | b.P[1] | b.P[2]; b.Occupied != union {
+		return fmt.Errorf("Occupied is %x, the stones %x", uint64(b.Occupied), uint64(union))
+	}
+	if h := zobrist.ComputeHash(gs.Board, gs.PlayerID, gs.ActiveMask); gs.Hash != h {
+		return fmt.Errorf("hash is %016x, the position's %016x", gs.Hash, h)
+	}
+	if gs.ActiveMask&^0b111 != 0 {
+		return fmt.Errorf("active mask %b names a fourth player", gs.ActiveMask)
+	}
+	if gs.Terminal {
+		if gs.WinnerID != -1 && (gs.WinnerID < 0 || gs.WinnerID > 2 || gs.ActiveMask&(1<<uint(gs.WinnerID)) == 0) {
+			return fmt.Errorf("winner %d is not an active player (mask %b)", gs.WinnerID, gs.ActiveMask)
+		}
+		return nil
+	}
+	if gs.WinnerID != -1 {
+		return fmt.Errorf("unfinished game has winner %d", gs.WinnerID)
+	}
+	if n := bits.OnesCount8(gs.ActiveMask); n < 2 {
+		return fmt.Errorf("unfinished game has %d active players (mask %b)", n, gs.ActiveMask)
+	}
+	if gs.PlayerID < 0 || gs.PlayerID > 2 || gs.ActiveMask&(1<<uint(gs.PlayerID)) == 0 {
+		return fmt.Errorf("player to move %d is not active (mask %b)", gs.PlayerID, gs.ActiveMask)
+	}
+	ref := NewGameState(gs.Board, gs.PlayerID, gs.ActiveMask)
+	for p := 0; p < 3; p++ {
+		if gs.Wins[p] != ref.Wins[p] || gs.Loses[p] != ref.Loses[p] {
+			return fmt.Errorf("player %d's threats are %x/%x, the board's %x/%x", p+1, uint64(gs.Wins[p]), uint64(gs.Loses[p]), uint64(ref.Wins[p]), uint64(ref.Loses[p]))
+		}
+	}
+	return nil
+}
+
+// dump describes every field of gs, with the board drawn row by row, 8 at
+// the top, and '?' on a square that more than one player holds.
+func (gs *GameState) dump() string {
+	var sb strings.Builder
+	for r := BoardSize - 1; r >= 0; r-- {
+		fmt.Fprintf(&sb, "  %d ", r+1)
+		for c := 0; c < BoardSize; c++ {
+			mask := Bitboard(1) << uint(r*BoardSize+c)
+			ch := byte('.')
+			for p, sym := range []byte{'X', 'O', 'Z'} {
+				if gs.Board.P[p]&mask != 0 {
+					if ch != '.' {
+						ch = '?'
+					} else {
+						ch = sym
+					}
+				}
+			}
+			if ch == '.' && gs.Board.Occupied&mask != 0 {
+				ch = '?'
+			}
+			sb.WriteByte(ch)
+		}
+		sb.WriteByte('\n')
+	}
+	sb.WriteString("    ABCDEFGH\n")
+	fmt.Fprintf(&sb, "  Stones %016x %016x %016x, occupied %016x\n", uint64(gs.Board.P[0]), uint64(gs.Board.P[1]), uint64(gs.Board.P[2]), uint64(gs.Board.Occupied))
+	fmt.Fprintf(&sb, "  Player %d, active %03b, winner %d, terminal %v, hash %016x\n", gs.PlayerID, gs.ActiveMask, gs.WinnerID, gs.Terminal, gs.Hash)
+	for p := 0; p < 3; p++ {
+		fmt.Fprintf(&sb, "  Player %d wins %016x, loses %016x\n", p, uint64(gs.Wins[p]), uint64(gs.Loses[p]))
+	}
+	return sb.String()
+}
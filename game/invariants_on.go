@@ -0,0 +1,6 @@
+//go:build debug
+
+package game
+
+// debugChecks makes GameState check its invariants after every change.
+const debugChecks = true
@@ -0,0 +1,294 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrInvalidMove     = errors.New("invalid move format")
+	ErrMoveOutOfBounds = errors.New("move out of bounds")
+)
+
+// normalizeMoveText folds full-width characters to ASCII, trims surrounding
+// whitespace and upper-cases the result.
+func normalizeMoveText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E: // Full-width ASCII block
+			return r - 0xFEE0
+		case r == 0x3000: // Ideographic space
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isRowCol reports whether s has the form R<digits>C<digits>.
+func isRowCol(s string) bool {
+	ci := strings.IndexByte(s, 'C')
+	return s[0] == 'R' && ci > 1 && isDigits(s[1:ci]) && isDigits(s[ci+1:])
+}
+
+// ParseMove parses a square in any of the accepted notations: algebraic
+// ("A1", "a1"), reversed ("1A"), row/column ("R1C1", both 1-based), or a raw
+// 0-63 square index. Full-width characters and surrounding whitespace are
+// accepted. It is the single parser used for prompts and game records.
+func ParseMove(s string) (Move, error) {
+	s = normalizeMoveText(s)
+	if s == "" {
+		return Move{}, ErrInvalidMove
+	}
+
+	var r, c int
+	switch {
+	case isDigits(s):
+		idx, _ := strconv.Atoi(s)
+		if idx >= BoardSize*BoardSize {
+			return Move{}, ErrMoveOutOfBounds
+		}
+		return MoveFromIndex(idx), nil
+	case isRowCol(s):
+		ci := strings.IndexByte(s, 'C')
+		r, _ = strconv.Atoi(s[1:ci])
+		c, _ = strconv.Atoi(s[ci+1:])
+		r, c = r-1, c-1
+	case unicode.IsLetter(rune(s[0])) && isDigits(s[1:]):
+		c = int(s[0] - 'A')
+		r, _ = strconv.Atoi(s[1:])
+		r--
+	case unicode.IsLetter(rune(s[len(s)-1])) && isDigits(s[:len(s)-1]):
+		c = int(s[len(s)-1] - 'A')
+		r, _ = strconv.Atoi(s[:len(s)-1])
+		r--
+	default:
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, s)
+	}
+	if r < 0 || r >= BoardSize || c < 0 || c >= BoardSize {
+		return Move{}, ErrMoveOutOfBounds
+	}
+	return Move{r: int8(r), c: int8(c)}, nil
+}
+
+// PositionStones are the characters of each player's stones in the position
+// notation.
+const PositionStones = "XOZ"
+
+// FormatPosition writes gs in the position notation, a FEN-like line: the
+// ranks from 8 down to 1 separated by '/', each listing X, O and Z for the
+// players' stones and a digit for a run of empty squares, then the player to
+// move and the players still in the game, e.g. "8/8/8/3X4/4O3/8/8/8 3 123".
+func FormatPosition(gs GameState) string {
+	var sb strings.Builder
+	for r := BoardSize - 1; r >= 0; r-- {
+		empty := 0
+		for c := 0; c < BoardSize; c++ {
+			bit := Bitboard(1) << uint(r*BoardSize+c)
+			stone := byte(0)
+			for id := 0; id < 3; id++ {
+				if gs.Board.P[id]&bit != 0 {
+					stone = PositionStones[id]
+				}
+			}
+			if stone == 0 {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			sb.WriteByte(stone)
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+		}
+		if r > 0 {
+			sb.WriteByte('/')
+		}
+	}
+	fmt.Fprintf(&sb, " %d ", gs.PlayerID+1)
+	for id := 0; id < 3; id++ {
+		if gs.ActiveMask&(1<<uint(id)) != 0 {
+			sb.WriteByte(byte('1' + id))
+		}
+	}
+	return sb.String()
+}
+
+// CanonicalPosition returns the least, as a string, of the position notations
+// of gs under the 8 symmetries, which is the same for a position and all its
+// rotations and reflections, and the first symmetry that gives it: it is
+// FormatPosition(TransformPosition(gs, s)).
+func CanonicalPosition(gs GameState) (string, int) {
+	best, bestS := FormatPosition(gs), 0
+	for s := 1; s < NumSymmetries; s++ {
+		if pos := FormatPosition(TransformPosition(gs, s)); pos < best {
+			best, bestS = pos, s
+		}
+	}
+	return best, bestS
+}
+
+// ParsePosition parses a position written by FormatPosition. Stones may also
+// be given in lower case. A position in which a player still in the game has
+// a 4-in-a-row, or a 3-in-a-row, is refused: the game would already be over,
+// or the player out of it.
+func ParsePosition(s string) (GameState, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return GameState{}, fmt.Errorf("position %q: want ranks, player to move and active players", s)
+	}
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != BoardSize {
+		return GameState{}, fmt.Errorf("position has %d ranks, want %d", len(ranks), BoardSize)
+	}
+	var board Board
+	for i, rank := range ranks {
+		r, c := BoardSize-1-i, 0
+		for _, ch := range strings.ToUpper(rank) {
+			switch {
+			case ch >= '1' && ch <= '8':
+				c += int(ch - '0')
+			case strings.ContainsRune(PositionStones, ch) && c < BoardSize:
+				board.Set(r*BoardSize+c, strings.IndexRune(PositionStones, ch))
+				c++
+			default:
+				return GameState{}, fmt.Errorf("rank %d: unexpected %q", r+1, ch)
+			}
+		}
+		if c != BoardSize {
+			return GameState{}, fmt.Errorf("rank %d has %d squares, want %d", r+1, c, BoardSize)
+		}
+	}
+	if len(fields[1]) != 1 || fields[1][0] < '1' || fields[1][0] > '3' {
+		return GameState{}, fmt.Errorf("bad player to move %q", fields[1])
+	}
+	mover := int(fields[1][0] - '1')
+	var active uint8
+	for _, ch := range fields[2] {
+		if ch < '1' || ch > '3' || active&(1<<uint(ch-'1')) != 0 {
+			return GameState{}, fmt.Errorf("bad active players %q", fields[2])
+		}
+		active |= 1 << uint(ch-'1')
+	}
+	if active&(1<<uint(mover)) == 0 {
+		return GameState{}, fmt.Errorf("player %d is to move but not in the game", mover+1)
+	}
+	for id := 0; id < 3; id++ {
+		if active&(1<<uint(id)) == 0 {
+			continue
+		}
+		switch isWin, isLoss := CheckBoard(board.P[id]); {
+		case isWin:
+			return GameState{}, fmt.Errorf("player %d has a 4-in-a-row, so the game is over", id+1)
+		case isLoss:
+			return GameState{}, fmt.Errorf("player %d has a 3-in-a-row but is still in the game", id+1)
+		}
+	}
+	return NewGameState(board, mover, active), nil
+}
+
+// EPDOp is one operation of a line in the EPD-like format, e.g. "bm C1 D2".
+type EPDOp struct {
+	Name string
+	Args []string
+}
+
+// ParseEPD parses a line of the EPD-like format used by test suites and
+// puzzle files: a position in the position notation followed by
+// semicolon-terminated operations, each a name and its arguments:
+//
+//	8/8/8/8/2XX4/8/8/8 1 123 bm B4 E4; id "open three";
+//
+// Double quotes group an argument that contains spaces or semicolons; they
+// are removed.
+func ParseEPD(line string) (GameState, []EPDOp, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return GameState{}, nil, errors.New("missing position")
+	}
+	gs, err := ParsePosition(strings.Join(fields[:3], " "))
+	if err != nil {
+		return GameState{}, nil, err
+	}
+	// Skip the three position fields in the original text.
+	rest := strings.TrimSpace(line)
+	for i := 0; i < 3; i++ {
+		rest = strings.TrimSpace(rest[len(fields[i]):])
+	}
+
+	var ops []EPDOp
+	var args []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	endWord := func() {
+		if inWord {
+			args = append(args, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	for _, ch := range rest {
+		switch {
+		case ch == '"':
+			quoted, inWord = !quoted, true
+		case quoted:
+			word.WriteRune(ch)
+		case ch == ';':
+			endWord()
+			if len(args) > 0 {
+				ops = append(ops, EPDOp{args[0], args[1:]})
+			}
+			args = nil
+		case unicode.IsSpace(ch):
+			endWord()
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+	if quoted {
+		return GameState{}, nil, errors.New("unterminated quote")
+	}
+	endWord()
+	if len(args) > 0 {
+		ops = append(ops, EPDOp{args[0], args[1:]})
+	}
+	return gs, ops, nil
+}
+
+// FormatEPD writes gs and ops as a line that ParseEPD reads back. Arguments
+// that are empty or contain spaces, semicolons or quotes are quoted; quotes
+// inside them are dropped.
+func FormatEPD(gs GameState, ops []EPDOp) string {
+	var sb strings.Builder
+	sb.WriteString(FormatPosition(gs))
+	for _, op := range ops {
+		sb.WriteString(" " + op.Name)
+		for _, a := range op.Args {
+			if a == "" || strings.ContainsAny(a, " \t;\"") {
+				a = `"` + strings.ReplaceAll(a, `"`, "") + `"`
+			}
+			sb.WriteString(" " + a)
+		}
+		sb.WriteByte(';')
+	}
+	return sb.String()
+}
@@ -0,0 +1,145 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMove(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Move
+	}{
+		{"A1", Move{0, 0}},
+		{"a1", Move{0, 0}},
+		{"h8", Move{7, 7}},
+		{"  D5 \n", Move{4, 3}},
+		{"5D", Move{4, 3}},
+		{"r5c4", Move{4, 3}},
+		{"R1C8", Move{0, 7}},
+		{"0", Move{0, 0}},
+		{"63", Move{7, 7}},
+		{"Ｄ５", Move{4, 3}},
+		{"　ｄ５", Move{4, 3}},
+	}
+	for _, c := range cases {
+		got, err := ParseMove(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("ParseMove(%q) = %v, %v; want %v", c.in, got, err, c.want)
+		}
+	}
+
+	for _, in := range []string{"I1", "A9", "A0", "64", "R9C1", "R1C0"} {
+		if _, err := ParseMove(in); !errors.Is(err, ErrMoveOutOfBounds) {
+			t.Errorf("ParseMove(%q): expected out of bounds, got %v", in, err)
+		}
+	}
+	for _, in := range []string{"", "A", "AB", "A1B", "R1C", "-1", "1A1"} {
+		if _, err := ParseMove(in); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("ParseMove(%q): expected invalid format, got %v", in, err)
+		}
+	}
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	for _, pos := range []string{
+		"8/8/8/8/8/8/8/8 1 123",
+		"8/8/8/3X4/4O3/8/8/Z7 3 123",
+		"XOZXOZXO/8/8/8/8/8/8/7Z 2 23",
+		"8/8/8/8/8/8/8/1XXX4 2 23", // X is out, so its 3-in-a-row is fine
+	} {
+		gs, err := ParsePosition(pos)
+		if err != nil {
+			t.Errorf("ParsePosition(%q): %v", pos, err)
+			continue
+		}
+		if got := FormatPosition(gs); got != pos {
+			t.Errorf("Round trip of %q gave %q", pos, got)
+		}
+	}
+	gs, _ := ParsePosition("8/8/8/8/3x4/8/8/8 2 123") // X on D4
+	if gs.Board.P[0] != Bitboard(1)<<27 || gs.PlayerID != 1 || gs.ActiveMask != 0x07 {
+		t.Errorf("Unexpected state %+v", gs)
+	}
+	for _, bad := range []string{
+		"8/8/8/8/8/8/8 1 123",
+		"8/8/8/8/8/8/8/9 1 123",
+		"8/8/8/8/8/8/8/7Y 1 123",
+		"8/8/8/8/8/8/8/8 4 123",
+		"8/8/8/8/8/8/8/8 1 23",
+		"8/8/8/8/8/8/8/8 1 113",
+		"8/8/8/8/8/8/8/8 1",
+		"XXXX4/8/8/8/8/8/8/8 2 123", // X has already won
+		"8/8/8/8/8/8/8/1OOO4 1 123", // O is still in with a 3-in-a-row
+	} {
+		if _, err := ParsePosition(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestEPDRoundTrip(t *testing.T) {
+	gs, ops, err := ParseEPD(`8/8/8/8/8/8/8/XX1X4 1 123 bm C1; id "take; the win";  c0 a "";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 || ops[0].Name != "bm" || len(ops[0].Args) != 1 || ops[1].Args[0] != "take; the win" || len(ops[2].Args) != 2 || ops[2].Args[1] != "" {
+		t.Fatalf("Unexpected operations %+v", ops)
+	}
+	line := FormatEPD(gs, ops)
+	if want := `8/8/8/8/8/8/8/XX1X4 1 123 bm C1; id "take; the win"; c0 a "";`; line != want {
+		t.Errorf("FormatEPD gave %q, want %q", line, want)
+	}
+	if _, _, err := ParseEPD(`8/8/8/8/8/8/8/8 1 123 id "open`); err == nil {
+		t.Error("Expected an error for an unterminated quote")
+	}
+}
+
+// FuzzParseMove checks that ParseMove, which reads every typed move, never
+// panics and that the moves it accepts print back to themselves.
+func FuzzParseMove(f *testing.F) {
+	for _, s := range []string{"A1", "h8", "  D5 \n", "5D", "r5c4", "63", "Ｄ５", "R1C", "-1", "A9", "R99999999999999999999C1"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		m, err := ParseMove(s)
+		if err != nil {
+			return
+		}
+		if m.r < 0 || m.r >= BoardSize || m.c < 0 || m.c >= BoardSize {
+			t.Fatalf("ParseMove(%q) = %v, off the board", s, m)
+		}
+		if back, err := ParseMove(m.String()); err != nil || back != m {
+			t.Errorf("ParseMove(%q) = %v, which reads back as %v, %v", s, m, back, err)
+		}
+	})
+}
+
+// FuzzParsePosition checks that ParsePosition never panics and that the
+// positions it accepts read back the same once written.
+func FuzzParsePosition(f *testing.F) {
+	for _, s := range []string{"8/8/8/8/8/8/8/8 1 123", "8/8/8/3X4/4O3/8/8/Z7 3 123", "XOZXOZXO/8/8/8/8/8/8/7Z 2 23", "8/8/8/8/8/8/8/9 1 123", "8/8/8/8/8/8/8/8 1 113"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		gs, err := ParsePosition(s)
+		if err != nil {
+			return
+		}
+		pos := FormatPosition(gs)
+		back, err := ParsePosition(pos)
+		if err != nil || FormatPosition(back) != pos || back.Board != gs.Board {
+			t.Errorf("ParsePosition(%q) wrote %q, which reads back as %q, %v", s, pos, FormatPosition(back), err)
+		}
+	})
+}
+
+// FuzzParseEPD checks that ParseEPD never panics.
+func FuzzParseEPD(f *testing.F) {
+	for _, s := range []string{`8/8/8/8/8/8/8/XX1X4 1 123 bm C1; id "take; the win";  c0 a "";`, `8/8/8/8/8/8/8/8 1 123`, `8/8/8/8/8/8/8/8 1 123 id "open`} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		ParseEPD(s)
+	})
+}
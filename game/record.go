@@ -0,0 +1,780 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResignMove marks a resignation in a game record's move list.
+var ResignMove = Move{r: -1, c: -1}
+
+// GameRecord is the portable description of a game: enough to replay it
+// move by move from the empty board, or to resume it with the same players.
+//
+// The canonical file form (.sqv) is a header of [Key "Value"] tags in a fixed
+// order, followed by any other tags such as Event or Date in the order they
+// were read, a blank line, then the moves separated by whitespace:
+//
+//	[Version "1"]
+//	[Seed "641728870"]
+//	[Player1 "mcts"]
+//	[Player2 "human"]
+//	[Player3 "mcts"]
+//	[Iterations "1000"]
+//	[Result "*"]
+//	[Event "club night"]
+//
+//	{a comment on the game} D4!? {winrate 36.2%} E5 C3? resign
+//
+// A move may carry a mark: ! good, ? poor, !! brilliant, ?? a blunder, !?
+// interesting or ?! dubious. A {comment} after a move annotates it, e.g.
+// with the engine's evaluation. A comment may hold tags: the time spent on
+// the move in seconds, as in {[%emt 2.350] winrate 36.2%}, the time left on
+// the mover's clock, [%clk 0:04:57.650], an engine's winrate for the mover
+// in percent, [%eval 36.2], and, for engine moves, what the search found:
+// [%search 2000 2000] gives its rollouts and the visits of the root, [%pv D4
+// E5 C3] its principal variation, and [%visits D4:120:45.2 E5:80:40.1] the
+// most visited moves with their visits and winrates in percent, and, for
+// human moves checked during play, [%check inaccuracy] gives the verdict:
+// ok, inaccuracy or blunder. Unknown tags are ignored when reading. Version gives the format version (see
+// RecordVersion); records without it are from before versions.
+//
+// Reading is lenient, so that records edited by hand or written by other
+// programs load: ; starts a comment that runs to the end of the line, move
+// numbers such as "1." or "2..." are skipped, $1 to $6 stand for the marks
+// in the order above, and a file may hold several games one after another,
+// each starting with its header (see ReadGameRecords).
+type GameRecord struct {
+	Version    int // Format version the record was read in; Write writes RecordVersion
+	Seed       uint64
+	Players    [3]string   // Player type per seat, e.g. "human" or "mcts"
+	Iterations int         // MCTS iterations for engine seats
+	Tags       []RecordTag // Other header tags, in order
+	Intro      string      // A comment on the game, before the first move
+	Moves      []Move
+	Marks      []string        // Per move, "" if none; nil when no move has one
+	Comments   []string        // Per move, "" if none; nil when no move has one
+	Times      []time.Duration // Think time per move; nil when not recorded
+	Clocks     []time.Duration // Clock time left after each move, 0 if unknown; nil when not recorded
+	Evals      []float32       // Engine winrate for the mover per move, NaN if none; nil when not recorded
+	Searches   []*SearchStats  // Engine search per move, nil if none; nil when not recorded
+	Checks     []string        // Move check verdict per move, "" if none; nil when not recorded
+	Result     string
+}
+
+// RecordTag is a header tag of a game record.
+type RecordTag struct {
+	Key, Value string
+}
+
+// MoveMarks are the marks a move may carry, in the order of the $1 to $6
+// glyphs that stand for them.
+var MoveMarks = []string{"!", "?", "!!", "??", "!?", "?!"}
+
+// Mark returns the mark of move i, if any.
+func (r *GameRecord) Mark(i int) string {
+	if i < len(r.Marks) {
+		return r.Marks[i]
+	}
+	return ""
+}
+
+// Comment returns the annotation of move i, if any.
+func (r *GameRecord) Comment(i int) string {
+	if i < len(r.Comments) {
+		return r.Comments[i]
+	}
+	return ""
+}
+
+// MoveTime returns the time spent on move i, or 0 if it was not recorded.
+func (r *GameRecord) MoveTime(i int) time.Duration {
+	if i < len(r.Times) {
+		return r.Times[i]
+	}
+	return 0
+}
+
+// Clock returns the time left on the mover's clock after move i, or 0 if it
+// was not recorded.
+func (r *GameRecord) Clock(i int) time.Duration {
+	if i < len(r.Clocks) {
+		return r.Clocks[i]
+	}
+	return 0
+}
+
+// Eval returns an engine's winrate for the mover of move i, and whether
+// there is one.
+func (r *GameRecord) Eval(i int) (float32, bool) {
+	if i < len(r.Evals) && !math.IsNaN(float64(r.Evals[i])) {
+		return r.Evals[i], true
+	}
+	return 0, false
+}
+
+// Search returns the engine search behind move i, or nil.
+func (r *GameRecord) Search(i int) *SearchStats {
+	if i < len(r.Searches) {
+		return r.Searches[i]
+	}
+	return nil
+}
+
+// Check returns the verdict of the check of move i, if any.
+func (r *GameRecord) Check(i int) string {
+	if i < len(r.Checks) {
+		return r.Checks[i]
+	}
+	return ""
+}
+
+// SearchStats is what an engine's search found when it chose a move.
+type SearchStats struct {
+	Rollouts int          // Rollouts of this search
+	Visits   int          // Visits of the root, including those of earlier searches
+	PV       []Move       // Principal variation: the most visited line
+	Moves    []MoveVisits // Most visited moves first
+}
+
+// Verdicts of a move check, as saved in the [%check] tag of a record.
+const (
+	CheckOK         = "ok"
+	CheckInaccuracy = "inaccuracy"
+	CheckBlunder    = "blunder"
+)
+
+// MoveVisits is a move a search considered, with its visits and its winrate
+// for the player to move.
+type MoveVisits struct {
+	Move    Move
+	Visits  int
+	Winrate float32
+}
+
+// String describes s in words, e.g. "2000 rollouts, pv D4 E5 C3, D4 120
+// (45.2%), E5 80 (40.1%)".
+func (s *SearchStats) String() string {
+	parts := []string{fmt.Sprintf("%d rollouts", s.Rollouts)}
+	if len(s.PV) > 0 {
+		pv := make([]string, len(s.PV))
+		for i, m := range s.PV {
+			pv[i] = m.String()
+		}
+		parts = append(parts, "pv "+strings.Join(pv, " "))
+	}
+	for _, m := range s.Moves {
+		parts = append(parts, fmt.Sprintf("%s %d (%.1f%%)", m.Move, m.Visits, m.Winrate*100))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tags formats s as comment tags.
+func (s *SearchStats) tags() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%%search %d %d]", s.Rollouts, s.Visits)
+	if len(s.PV) > 0 {
+		sb.WriteString(" [%pv")
+		for _, m := range s.PV {
+			sb.WriteString(" " + m.String())
+		}
+		sb.WriteString("]")
+	}
+	if len(s.Moves) > 0 {
+		sb.WriteString(" [%visits")
+		for _, m := range s.Moves {
+			fmt.Fprintf(&sb, " %s:%d:%.1f", m.Move, m.Visits, m.Winrate*100)
+		}
+		sb.WriteString("]")
+	}
+	return sb.String()
+}
+
+// parseTag reads the value of a [%search], [%pv] or [%visits] tag into s.
+func (s *SearchStats) parseTag(key, value string) error {
+	fields := strings.Fields(value)
+	switch key {
+	case "search":
+		if len(fields) != 2 {
+			return fmt.Errorf("bad search tag %q", value)
+		}
+		var err error
+		if s.Rollouts, err = strconv.Atoi(fields[0]); err != nil {
+			return fmt.Errorf("bad search tag %q", value)
+		}
+		if s.Visits, err = strconv.Atoi(fields[1]); err != nil {
+			return fmt.Errorf("bad search tag %q", value)
+		}
+	case "pv":
+		for _, f := range fields {
+			m, err := ParseMove(f)
+			if err != nil {
+				return fmt.Errorf("bad move %q in pv: %v", f, err)
+			}
+			s.PV = append(s.PV, m)
+		}
+	case "visits":
+		for _, f := range fields {
+			parts := strings.Split(f, ":")
+			if len(parts) != 3 {
+				return fmt.Errorf("bad visits entry %q", f)
+			}
+			m, err := ParseMove(parts[0])
+			if err != nil {
+				return fmt.Errorf("bad visits entry %q: %v", f, err)
+			}
+			n, err1 := strconv.Atoi(parts[1])
+			w, err2 := strconv.ParseFloat(parts[2], 32)
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("bad visits entry %q", f)
+			}
+			s.Moves = append(s.Moves, MoveVisits{Move: m, Visits: n, Winrate: float32(w / 100)})
+		}
+	}
+	return nil
+}
+
+// FormatRecordMove formats m as a record's move list does: "resign" for
+// ResignMove, else in algebraic notation.
+func FormatRecordMove(m Move) string {
+	if m == ResignMove {
+		return "resign"
+	}
+	return m.String()
+}
+
+// Write serializes the record in canonical form.
+func (r *GameRecord) Write(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Version \"%d\"]\n", RecordVersion)
+	fmt.Fprintf(&sb, "[Seed \"%d\"]\n", r.Seed)
+	for i, p := range r.Players {
+		fmt.Fprintf(&sb, "[Player%d %q]\n", i+1, p)
+	}
+	fmt.Fprintf(&sb, "[Iterations \"%d\"]\n", r.Iterations)
+	result := r.Result
+	if result == "" {
+		result = "*"
+	}
+	fmt.Fprintf(&sb, "[Result %q]\n", result)
+	for _, t := range r.Tags {
+		fmt.Fprintf(&sb, "[%s %q]\n", t.Key, t.Value)
+	}
+	sb.WriteByte('\n')
+
+	if r.Intro != "" {
+		fmt.Fprintf(&sb, "{%s}\n", commentText(r.Intro))
+	}
+	for i, m := range r.Moves {
+		if i > 0 {
+			if i%12 == 0 {
+				sb.WriteByte('\n')
+			} else {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(FormatRecordMove(m) + r.Mark(i))
+		var tags []string
+		if d := r.MoveTime(i); d > 0 {
+			tags = append(tags, fmt.Sprintf("[%%emt %.3f]", d.Seconds()))
+		}
+		if d := r.Clock(i); d > 0 {
+			tags = append(tags, "[%clk "+formatClockTag(d)+"]")
+		}
+		if w, ok := r.Eval(i); ok {
+			tags = append(tags, fmt.Sprintf("[%%eval %.1f]", w*100))
+		}
+		if s := r.Search(i); s != nil {
+			tags = append(tags, s.tags())
+		}
+		if v := r.Check(i); v != "" {
+			tags = append(tags, "[%check "+v+"]")
+		}
+		if c := strings.TrimSpace(strings.Join(append(tags, commentText(r.Comment(i))), " ")); c != "" {
+			fmt.Fprintf(&sb, " {%s}", c)
+		}
+	}
+	sb.WriteByte('\n')
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// parseTag splits a `[Key "Value"]` header line.
+func parseTag(line string) (key, value string, ok bool) {
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", "", false
+	}
+	body := strings.TrimSpace(line[1 : len(line)-1])
+	sp := strings.IndexByte(body, ' ')
+	if sp < 0 {
+		return "", "", false
+	}
+	key = body[:sp]
+	value, err := strconv.Unquote(strings.TrimSpace(body[sp+1:]))
+	if err != nil {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// commentText makes c safe to write between braces.
+func commentText(c string) string {
+	return strings.ReplaceAll(c, "}", ")")
+}
+
+// formatClockTag formats d as the value of a [%clk] tag, e.g. "0:04:57.650".
+func formatClockTag(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	h, m := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	return fmt.Sprintf("%d:%02d:%06.3f", h, m, (d % time.Minute).Seconds())
+}
+
+// parseClockTag parses the value of a [%clk] tag: hours, minutes and
+// seconds, or fewer of them from the right, as in "4:57.6".
+func parseClockTag(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("bad clock time %q", value)
+	}
+	var secs float64
+	for _, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f < 0 {
+			return 0, fmt.Errorf("bad clock time %q", value)
+		}
+		secs = secs*60 + f
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// ReadGameRecord parses a file holding one record written by Write, in this
+// or an earlier format version, or a record in the lenient form other
+// programs write. Moves are only checked for notation here; use
+// SquavaGame.Load to check them against the rules.
+func ReadGameRecord(rd io.Reader) (*GameRecord, error) {
+	recs, err := ReadGameRecords(rd)
+	if err != nil {
+		return nil, err
+	}
+	switch len(recs) {
+	case 0:
+		return &GameRecord{}, nil
+	case 1:
+		return recs[0], nil
+	}
+	return nil, fmt.Errorf("the file holds %d games; expected one", len(recs))
+}
+
+// ReadGameRecords parses a file of game records, one after another. A
+// header tag after the moves of a game, or after a blank line that ends a
+// header, starts the next game. Errors give the line in the file.
+func ReadGameRecords(rd io.Reader) ([]*GameRecord, error) {
+	var recs []*GameRecord
+	for rec, err := range GameRecords(rd) {
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// GameRecords returns an iterator over the games of a file of game records,
+// read as by ReadGameRecords but yielding each game as soon as it is parsed,
+// so that a large file is never held in memory whole. An error is yielded
+// last, after the games before it.
+func GameRecords(rd io.Reader) iter.Seq2[*GameRecord, error] {
+	return func(yield func(*GameRecord, error) bool) {
+		var r *GameRecord
+		var body strings.Builder
+		bodyStart := 0
+		// next yields the game read so far, if any, and reports whether to
+		// go on.
+		next := func() bool {
+			if r == nil {
+				return true
+			}
+			rec := r
+			if err := rec.parseMoves(body.String(), bodyStart); err != nil {
+				yield(nil, err)
+				return false
+			}
+			r, bodyStart = nil, 0
+			body.Reset()
+			return yield(rec, nil)
+		}
+
+		scanner := bufio.NewScanner(rd)
+		lineNo := 0
+		inHeader, inComment := false, false
+		for scanner.Scan() {
+			lineNo++
+			line := strings.TrimSpace(scanner.Text())
+			if !inComment && strings.HasPrefix(line, "[") && !strings.HasPrefix(line, "[%") {
+				if !inHeader {
+					if !next() {
+						return
+					}
+					r, inHeader = &GameRecord{}, true
+				}
+				key, value, ok := parseTag(line)
+				if !ok {
+					yield(nil, fmt.Errorf("line %d: malformed tag %q", lineNo, line))
+					return
+				}
+				if err := r.setTag(key, value); err != nil {
+					yield(nil, fmt.Errorf("line %d: %v", lineNo, err))
+					return
+				}
+				continue
+			}
+			if bodyStart == 0 {
+				if line == "" {
+					// The blank line after a header ends it.
+					inHeader = false
+					continue
+				}
+				if r == nil {
+					r = &GameRecord{}
+				}
+				inHeader, bodyStart = false, lineNo
+			}
+			body.WriteString(line)
+			body.WriteByte('\n')
+		scan:
+			for _, ch := range line {
+				switch {
+				case inComment:
+					inComment = ch != '}'
+				case ch == '{':
+					inComment = true
+				case ch == ';':
+					break scan
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(nil, err)
+			return
+		}
+		next()
+	}
+}
+
+// parseMoves reads the move list: moves separated by whitespace, each
+// optionally followed by a {comment} that may span lines.
+func (r *GameRecord) parseMoves(text string, lineNo int) error {
+	for len(text) > 0 {
+		switch ch := text[0]; {
+		case ch == '\n':
+			lineNo++
+			text = text[1:]
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			text = text[1:]
+		case ch == '{':
+			end := strings.IndexByte(text, '}')
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated comment", lineNo)
+			}
+			comment := text[1:end]
+			if err := r.parseComment(comment, lineNo); err != nil {
+				return err
+			}
+			lineNo += strings.Count(comment, "\n")
+			text = text[end+1:]
+		case ch == ';':
+			end := strings.IndexByte(text, '\n')
+			if end < 0 {
+				end = len(text)
+			}
+			if err := r.parseComment(text[1:end], lineNo); err != nil {
+				return err
+			}
+			text = text[end:]
+		default:
+			end := strings.IndexAny(text, " \t\r\n{;")
+			if end < 0 {
+				end = len(text)
+			}
+			tok := text[:end]
+			text = text[end:]
+			if tok == "*" {
+				continue // The result, as other programs end the moves
+			}
+			if strings.HasPrefix(tok, "$") {
+				n, err := strconv.Atoi(tok[1:])
+				if err != nil || len(r.Moves) == 0 {
+					return fmt.Errorf("line %d: %s: bad annotation glyph", lineNo, tok)
+				}
+				if n >= 1 && n <= len(MoveMarks) {
+					r.SetMark(len(r.Moves)-1, MoveMarks[n-1])
+				}
+				continue
+			}
+			if tok = trimMoveNumber(tok); tok == "" {
+				continue
+			}
+			body := strings.TrimRight(tok, "!?")
+			mark := tok[len(body):]
+			if mark != "" && !slices.Contains(MoveMarks, mark) {
+				return fmt.Errorf("line %d: %s: bad mark %q", lineNo, tok, mark)
+			}
+			if strings.EqualFold(body, "resign") {
+				r.Moves = append(r.Moves, ResignMove)
+			} else {
+				m, err := ParseMove(body)
+				if err != nil {
+					return fmt.Errorf("line %d: %s: %v", lineNo, tok, err)
+				}
+				r.Moves = append(r.Moves, m)
+			}
+			if mark != "" {
+				r.SetMark(len(r.Moves)-1, mark)
+			}
+		}
+	}
+	return nil
+}
+
+// trimMoveNumber strips a move number such as "12." or "3..." from the
+// start of tok.
+func trimMoveNumber(tok string) string {
+	digits := len(tok) - len(strings.TrimLeft(tok, "0123456789"))
+	if digits == 0 || digits == len(tok) || tok[digits] != '.' {
+		return tok
+	}
+	return strings.TrimLeft(tok[digits:], ".")
+}
+
+// parseComment reads a comment on the last move read, or on the game if
+// there is none yet, taking out the tags it holds. A move's comments add up.
+func (r *GameRecord) parseComment(comment string, lineNo int) error {
+	i := len(r.Moves) - 1
+	var search *SearchStats
+	var text []string
+	for {
+		start := strings.Index(comment, "[%")
+		if start < 0 {
+			break
+		}
+		tag, after, ok := strings.Cut(comment[start+2:], "]")
+		if !ok {
+			break
+		}
+		text = append(text, comment[:start])
+		comment = after
+		if i < 0 {
+			continue
+		}
+		lines := lineNo + strings.Count(strings.Join(text, ""), "\n")
+		key, value, _ := strings.Cut(strings.Join(strings.Fields(tag), " "), " ")
+		switch key {
+		case "emt":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || f < 0 {
+				return fmt.Errorf("line %d: bad move time %q", lines, value)
+			}
+			r.SetMoveTime(i, time.Duration(f*float64(time.Second)))
+		case "clk":
+			d, err := parseClockTag(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", lines, err)
+			}
+			r.SetClock(i, d)
+		case "eval":
+			f, err := strconv.ParseFloat(value, 32)
+			if err != nil || f < 0 || f > 100 {
+				return fmt.Errorf("line %d: bad eval %q", lines, value)
+			}
+			r.SetEval(i, float32(f/100))
+		case "check":
+			switch value {
+			case CheckOK, CheckInaccuracy, CheckBlunder:
+			default:
+				return fmt.Errorf("line %d: bad check %q", lines, value)
+			}
+			r.SetCheck(i, value)
+		case "search", "pv", "visits":
+			if search == nil {
+				search = &SearchStats{}
+			}
+			if err := search.parseTag(key, value); err != nil {
+				return fmt.Errorf("line %d: %v", lines, err)
+			}
+		}
+	}
+	if search != nil {
+		r.SetSearch(i, search)
+	}
+	c := strings.Join(strings.Fields(strings.Join(append(text, comment), " ")), " ")
+	switch {
+	case c == "":
+	case i < 0:
+		r.Intro = strings.TrimSpace(r.Intro + " " + c)
+	default:
+		r.SetComment(i, strings.TrimSpace(r.Comment(i)+" "+c))
+	}
+	return nil
+}
+
+// SetComment sets the annotation of move i.
+func (r *GameRecord) SetComment(i int, c string) {
+	for len(r.Comments) <= i {
+		r.Comments = append(r.Comments, "")
+	}
+	r.Comments[i] = c
+}
+
+// SetMark sets the mark of move i.
+func (r *GameRecord) SetMark(i int, m string) {
+	for len(r.Marks) <= i {
+		r.Marks = append(r.Marks, "")
+	}
+	r.Marks[i] = m
+}
+
+// SetClock sets the time left on the mover's clock after move i.
+func (r *GameRecord) SetClock(i int, d time.Duration) {
+	for len(r.Clocks) <= i {
+		r.Clocks = append(r.Clocks, 0)
+	}
+	r.Clocks[i] = d
+}
+
+// SetEval sets an engine's winrate for the mover of move i.
+func (r *GameRecord) SetEval(i int, w float32) {
+	for len(r.Evals) <= i {
+		r.Evals = append(r.Evals, float32(math.NaN()))
+	}
+	r.Evals[i] = w
+}
+
+// SetSearch sets the engine search behind move i.
+func (r *GameRecord) SetSearch(i int, s *SearchStats) {
+	for len(r.Searches) <= i {
+		r.Searches = append(r.Searches, nil)
+	}
+	r.Searches[i] = s
+}
+
+// SetCheck sets the verdict of the check of move i.
+func (r *GameRecord) SetCheck(i int, v string) {
+	for len(r.Checks) <= i {
+		r.Checks = append(r.Checks, "")
+	}
+	r.Checks[i] = v
+}
+
+// SetMoveTime sets the time spent on move i.
+func (r *GameRecord) SetMoveTime(i int, d time.Duration) {
+	for len(r.Times) <= i {
+		r.Times = append(r.Times, 0)
+	}
+	r.Times[i] = d
+}
+
+func (r *GameRecord) setTag(key, value string) error {
+	var err error
+	switch key {
+	case "Version":
+		if r.Version, err = strconv.Atoi(value); err == nil {
+			return CheckVersion("record", r.Version, RecordVersion)
+		}
+	case "Seed":
+		r.Seed, err = strconv.ParseUint(value, 10, 64)
+	case "Player1", "Player2", "Player3":
+		r.Players[key[6]-'1'] = value
+	case "Iterations":
+		r.Iterations, err = strconv.Atoi(value)
+	case "Result":
+		if value != "*" {
+			r.Result = value
+		}
+	default:
+		r.Tags = append(r.Tags, RecordTag{key, value})
+	}
+	if err != nil {
+		return fmt.Errorf("bad %s tag: %v", key, err)
+	}
+	return nil
+}
+
+// Positions replays the moves from the empty board and returns the position
+// before each move followed by the final one. It fails on the first move that
+// is illegal or played after the game ended.
+func (r *GameRecord) Positions() ([]GameState, error) {
+	final := NewGameState(Board{}, 0, 0x07)
+	positions := make([]GameState, 0, len(r.Moves)+1)
+	for m, err := range r.Replay() {
+		if err != nil {
+			return nil, err
+		}
+		positions, final = append(positions, m.Before), m.After
+	}
+	return append(positions, final), nil
+}
+
+// ReplayMove is a move of a stored game as the replay iterators deliver it,
+// with the positions before and after it, and the record it is from for its
+// header, comments and evaluations.
+type ReplayMove struct {
+	Record *GameRecord
+	Ply    int // Of the move in the game, from 0
+	Move   Move
+	Before GameState
+	After  GameState
+}
+
+// Replay returns an iterator over the moves of r, replayed from the empty
+// board. A move that is illegal or played after the game ended yields an
+// error and ends the replay.
+func (r *GameRecord) Replay() iter.Seq2[ReplayMove, error] {
+	return func(yield func(ReplayMove, error) bool) {
+		gs := NewGameState(Board{}, 0, 0x07)
+		for i, m := range r.Moves {
+			if gs.Terminal {
+				yield(ReplayMove{}, fmt.Errorf("move %d: %s played after the game ended", i+1, FormatRecordMove(m)))
+				return
+			}
+			before := gs
+			if m == ResignMove {
+				gs.Resign()
+			} else if gs.LegalMoves()&(Bitboard(1)<<uint(m.ToIndex())) == 0 {
+				yield(ReplayMove{}, fmt.Errorf("move %d: %s is not legal", i+1, m))
+				return
+			} else {
+				gs.ApplyMove(m)
+			}
+			if !yield(ReplayMove{Record: r, Ply: i, Move: m, Before: before, After: gs}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ReplayAll returns an iterator over the moves of all games, one game after
+// another, such as those of GameRecords or GameDB.Records. An error, from
+// games or from a replay, is yielded and ends the iteration.
+func ReplayAll(games iter.Seq2[*GameRecord, error]) iter.Seq2[ReplayMove, error] {
+	return func(yield func(ReplayMove, error) bool) {
+		for rec, err := range games {
+			if err != nil {
+				yield(ReplayMove{}, err)
+				return
+			}
+			for m, err := range rec.Replay() {
+				if !yield(m, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGameRecordRoundTrip(t *testing.T) {
+	r := &GameRecord{
+		Seed:       641728870,
+		Players:    [3]string{"mcts", "human", "mcts"},
+		Iterations: 1000,
+		Result:     "Player 1 Wins (4-in-a-row)",
+	}
+	for i := 0; i < 30; i++ {
+		r.Moves = append(r.Moves, MoveFromIndex(i*2))
+	}
+	r.Moves = append(r.Moves, ResignMove)
+	r.SetComment(0, "winrate 36.2%")
+	r.SetComment(12, "opens a front")
+	r.SetMoveTime(0, 2350*time.Millisecond)
+	r.SetMoveTime(5, 90*time.Second)
+	r.SetSearch(0, &SearchStats{Rollouts: 1000, Visits: 1450, PV: []Move{MoveFromIndex(0), MoveFromIndex(9)},
+		Moves: []MoveVisits{{Move: MoveFromIndex(0), Visits: 800, Winrate: 0.362}, {Move: MoveFromIndex(27), Visits: 300, Winrate: 0.25}}})
+	r.SetSearch(2, &SearchStats{Rollouts: 1, Visits: 1})
+	r.SetCheck(1, CheckBlunder)
+	r.SetCheck(3, CheckOK)
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadGameRecord(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Seed != r.Seed || got.Players != r.Players || got.Iterations != r.Iterations || got.Result != r.Result {
+		t.Errorf("Header mismatch: got %+v", got)
+	}
+	if len(got.Moves) != len(r.Moves) {
+		t.Fatalf("Expected %d moves, got %d", len(r.Moves), len(got.Moves))
+	}
+	for i := range r.Moves {
+		if got.Moves[i] != r.Moves[i] {
+			t.Errorf("Move %d: expected %v, got %v", i, r.Moves[i], got.Moves[i])
+		}
+		if got.Comment(i) != r.Comment(i) {
+			t.Errorf("Move %d: expected comment %q, got %q", i, r.Comment(i), got.Comment(i))
+		}
+		if got.MoveTime(i) != r.MoveTime(i) {
+			t.Errorf("Move %d: expected time %v, got %v", i, r.MoveTime(i), got.MoveTime(i))
+		}
+		if got.Check(i) != r.Check(i) {
+			t.Errorf("Move %d: expected check %q, got %q", i, r.Check(i), got.Check(i))
+		}
+		if want, s := r.Search(i), got.Search(i); (want == nil) != (s == nil) || want != nil && want.String() != s.String() {
+			t.Errorf("Move %d: expected search %v, got %v", i, want, s)
+		}
+	}
+}
+
+func TestReadGameRecordComments(t *testing.T) {
+	r, err := ReadGameRecord(strings.NewReader("A1 {first\nmove} B2{tight} C3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Moves) != 3 || r.Comment(0) != "first move" || r.Comment(1) != "tight" || r.Comment(2) != "" {
+		t.Errorf("Unexpected parse: %+v", r)
+	}
+	if _, err := ReadGameRecord(strings.NewReader("A1 {open\n")); err == nil {
+		t.Errorf("Expected error for unterminated comment")
+	}
+	if _, err := ReadGameRecord(strings.NewReader("A1 {[%emt soon]}\n")); err == nil {
+		t.Errorf("Expected error for a bad move time")
+	}
+	if _, err := ReadGameRecord(strings.NewReader("A1 {[%check great]}\n")); err == nil {
+		t.Errorf("Expected error for a bad check")
+	}
+	if _, err := ReadGameRecord(strings.NewReader("A1 {[%visits A1:many:50]}\n")); err == nil {
+		t.Errorf("Expected error for bad search statistics")
+	}
+}
+
+func TestRecordAnnotations(t *testing.T) {
+	r := &GameRecord{Seed: 5, Intro: "club night, round 2", Tags: []RecordTag{{"Event", "club night"}, {"Date", "2024.06.11"}}}
+	for i := 0; i < 4; i++ {
+		r.Moves = append(r.Moves, MoveFromIndex(i*9))
+	}
+	r.SetMark(0, "!?")
+	r.SetMark(3, "??")
+	r.SetClock(1, 4*time.Minute+57650*time.Millisecond)
+	r.SetEval(1, 0.362)
+	r.SetEval(2, 0)
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "A1!? B2 {[%clk 0:04:57.650] [%eval 36.2]} C3 {[%eval 0.0]} D4??") {
+		t.Errorf("Unexpected record:\n%s", buf.String())
+	}
+	got, err := ReadGameRecord(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Intro != r.Intro || fmt.Sprint(got.Tags) != fmt.Sprint(r.Tags) || fmt.Sprint(got.Marks) != fmt.Sprint(r.Marks) {
+		t.Errorf("Expected %+v, got %+v", r, got)
+	}
+	for i := range r.Moves {
+		w, ok := got.Eval(i)
+		wantW, wantOK := r.Eval(i)
+		if got.Clock(i) != r.Clock(i) || ok != wantOK || math.Abs(float64(w-wantW)) > 1e-6 {
+			t.Errorf("Move %d: clock %v, eval %v %v; want %v, %v %v", i, got.Clock(i), w, ok, r.Clock(i), wantW, wantOK)
+		}
+	}
+
+	// A record as another program or a person might write it.
+	got, err = ReadGameRecord(strings.NewReader(`[Event "club night"]
+[Seed "5"]
+{Opening experiment} ; from the club's notebook
+1. D4! E5 $6 C3 {dubious; [%clk 4:57.5] well [%eval 40]} ; the critical moment
+2. B2?? {[%emt 1.5]} A1 *
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Moves) != 5 || got.Seed != 5 || got.Intro != "Opening experiment from the club's notebook" {
+		t.Fatalf("Unexpected parse %+v", got)
+	}
+	if fmt.Sprint(got.Marks) != "[! ?!  ??]" || got.Comment(2) != "dubious; well the critical moment" {
+		t.Errorf("Unexpected marks %q, comment %q", got.Marks, got.Comment(2))
+	}
+	if w, ok := got.Eval(2); got.Clock(2) != 4*time.Minute+57500*time.Millisecond || !ok || w != 0.4 || got.MoveTime(3) != 1500*time.Millisecond {
+		t.Errorf("Unexpected clock %v, eval %v, time %v", got.Clock(2), w, got.MoveTime(3))
+	}
+	for _, bad := range []string{"A1!!!\n", "$2 A1\n", "A1 {[%eval lots]}\n", "A1 {[%clk 1:2:3:4]}\n"} {
+		if _, err := ReadGameRecord(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestReadGameRecords(t *testing.T) {
+	file := `[Seed "1"]
+
+A1 B2 {a comment
+[%emt 2.0] spanning lines}
+[Seed "2"]
+[Result "*"]
+
+[Seed "3"]
+
+C3 D4
+E5
+`
+	recs, err := ReadGameRecords(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 || recs[0].Seed != 1 || len(recs[0].Moves) != 2 || recs[0].MoveTime(1) != 2*time.Second ||
+		recs[1].Seed != 2 || len(recs[1].Moves) != 0 || recs[2].Seed != 3 || len(recs[2].Moves) != 3 {
+		t.Fatalf("Unexpected games %+v", recs)
+	}
+	if _, err := ReadGameRecord(strings.NewReader(file)); err == nil || !strings.Contains(err.Error(), "3 games") {
+		t.Errorf("Expected one game to be required, got %v", err)
+	}
+	_, err = ReadGameRecords(strings.NewReader(file + "\n[Seed \"4\"]\n\nA1 Z9\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 15") {
+		t.Errorf("Expected an error on line 15, got %v", err)
+	}
+}
+
+func TestReplayAll(t *testing.T) {
+	file := `[Seed "1"]
+
+A1 B2 {a comment} C3
+[Seed "2"]
+
+D4 E5
+[Seed "3"]
+
+A1 A1
+`
+	var plies []string
+	var streamErr error
+	for m, err := range ReplayAll(GameRecords(strings.NewReader(file))) {
+		if err != nil {
+			streamErr = err
+			break
+		}
+		if bit := Bitboard(1) << uint(m.Move.ToIndex()); m.Before.Board.Occupied&bit != 0 || m.After.Board.Occupied&bit == 0 {
+			t.Errorf("Seed %d ply %d: %s was not played from Before to After", m.Record.Seed, m.Ply, m.Move)
+		}
+		plies = append(plies, fmt.Sprintf("%d:%d:%s", m.Record.Seed, m.Ply, m.Move))
+	}
+	if got := strings.Join(plies, " "); got != "1:0:A1 1:1:B2 1:2:C3 2:0:D4 2:1:E5 3:0:A1" {
+		t.Errorf("Unexpected moves %s", got)
+	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "move 2: A1 is not legal") {
+		t.Errorf("Expected the illegal move to end the stream, got %v", streamErr)
+	}
+
+	// A consumer may stop early; the file is read no further than needed.
+	games := 0
+	for rec, err := range GameRecords(strings.NewReader(file + "[Seed \"4\"]\n\nA1 Z9\n")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if games++; rec.Seed == 2 {
+			break
+		}
+	}
+	if games != 2 {
+		t.Errorf("Read %d games, want 2", games)
+	}
+}
+
+func TestReadGameRecordErrors(t *testing.T) {
+	for _, in := range []string{
+		"[Seed 12]\n",
+		"[Seed \"abc\"]\n",
+		"A1 Z9\n",
+	} {
+		if _, err := ReadGameRecord(strings.NewReader(in)); err == nil {
+			t.Errorf("Expected error for %q", in)
+		}
+	}
+	r, err := ReadGameRecord(strings.NewReader("[Event \"club night\"]\n\nd4 5e\n"))
+	if err != nil || len(r.Moves) != 2 || r.Result != "" {
+		t.Errorf("Expected unknown tags to be ignored, got %+v, %v", r, err)
+	}
+}
+
+func TestFormatVersions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (&GameRecord{Moves: []Move{MoveFromIndex(0)}}).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadGameRecord(&buf)
+	if err != nil || r.Version != RecordVersion {
+		t.Errorf("Expected a record in version %d, got %+v, %v", RecordVersion, r, err)
+	}
+	// Records from before versions still load, and later additions that
+	// keep the version are skipped.
+	r, err = ReadGameRecord(strings.NewReader("[Seed \"5\"]\n[Clock \"5+0\"]\n\nA1 {[%eval 0.3] good} B2\n"))
+	if err != nil || r.Version != 0 || r.Seed != 5 || len(r.Moves) != 2 || r.Comment(0) != "good" {
+		t.Errorf("Expected a legacy record to load, got %+v, %v", r, err)
+	}
+	newer := fmt.Sprintf("[Version \"%d\"]\n\nA1\n", RecordVersion+1)
+	if _, err := ReadGameRecord(strings.NewReader(newer)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Expected a newer record to be refused, got %v", err)
+	}
+
+}
+
+// FuzzReadGameRecord checks that ReadGameRecord never panics and that the
+// records it accepts keep their moves when written and read again.
+func FuzzReadGameRecord(f *testing.F) {
+	f.Add("[Version \"1\"]\n[Seed \"5\"]\n[Player1 \"mcts\"]\n\nD4 {[%eval 0.3] good} e5 R1C1\n")
+	f.Add("[Seed \"5\"]\n[Clock \"5+0\"]\n\nA1 {[%eval 0.3] good} B2\n")
+	f.Add("[Event \"club night\"]\n\nd4 5e\n")
+	f.Add("[Seed 12]\n{unclosed A1\n")
+	f.Add("[Event \"x\"]\n{intro} 1. D4!? $2 ; note\nE5 {[%clk 1:00] [%eval 40] ok}\n[Seed \"2\"]\n\nA1\n")
+	f.Fuzz(func(t *testing.T, s string) {
+		r, err := ReadGameRecord(strings.NewReader(s))
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := r.Write(&buf); err != nil {
+			return
+		}
+		back, err := ReadGameRecord(&buf)
+		if err != nil {
+			t.Fatalf("Record read from %q was written as %q, which does not read back: %v", s, buf.String(), err)
+		}
+		if fmt.Sprint(back.Moves) != fmt.Sprint(r.Moves) {
+			t.Errorf("Record read from %q has moves %v, but %v once written and read again", s, r.Moves, back.Moves)
+		}
+	})
+}
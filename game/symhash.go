@@ -0,0 +1,60 @@
+package game
+
+import "squava/internal/kernels"
+
+// --- Symmetric hashes ---
+
+// SymHashes are the Zobrist hashes of a position under each symmetry:
+// SymHashes[s] is the hash of the position transformed by symmetry s, so
+// SymHashes[0] is its own hash. The turn and the active players look the
+// same under every symmetry; only the stones' keys differ.
+type SymHashes [NumSymmetries]uint64
+
+// Canonical returns the least of the hashes, which is the same for a
+// position and all its rotations and reflections, and the first symmetry
+// that gives it.
+func (h *SymHashes) Canonical() (uint64, int) {
+	best := 0
+	for s := 1; s < NumSymmetries; s++ {
+		if h[s] < h[best] {
+			best = s
+		}
+	}
+	return h[best], best
+}
+
+// CanonicalSquare maps idx into the orientation of the canonical hash. When
+// several symmetries give that hash, the position is symmetric and they map
+// idx to equivalent squares, of which the least is returned.
+func (h *SymHashes) CanonicalSquare(idx int) int {
+	hash, _ := h.Canonical()
+	best := BoardSize * BoardSize
+	for s := range NumSymmetries {
+		if h[s] == hash {
+			best = min(best, TransformSquare(idx, s))
+		}
+	}
+	return best
+}
+
+// ComputeSymHashes returns the hashes of the position under every symmetry,
+// adding the stones of each player to all 8 hashes at once.
+func (z *zobristTable) ComputeSymHashes(board Board, playerToMoveID int, activeMask uint8) SymHashes {
+	var h SymHashes
+	base := z.active[activeMask]
+	if playerToMoveID >= 0 && playerToMoveID < 3 {
+		base ^= z.turn[playerToMoveID]
+	}
+	for s := range h {
+		h[s] = base
+	}
+	for p := 0; p < 3; p++ {
+		kernels.SymXor((*[NumSymmetries]uint64)(&h), &z.sym[p], uint64(board.P[p]))
+	}
+	return h
+}
+
+// SymHashes returns the hashes of gs under every symmetry.
+func (gs *GameState) SymHashes() SymHashes {
+	return zobrist.ComputeSymHashes(gs.Board, gs.PlayerID, gs.ActiveMask)
+}
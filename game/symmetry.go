@@ -0,0 +1,84 @@
+package game
+
+import (
+	"math/bits"
+	"strings"
+)
+
+// --- Board symmetries ---
+
+// The rules look the same under the 8 symmetries of the square board, so a
+// position and its rotations and reflections are equally good for each
+// player. Symmetry s transposes the board if s&4 is set, then mirrors the
+// columns if s&1 is set and the rows if s&2 is set; 0 is the identity.
+const NumSymmetries = 8
+
+// TransformSquare returns the square idx is mapped to by symmetry s.
+func TransformSquare(idx, s int) int {
+	r, c := idx/BoardSize, idx%BoardSize
+	if s&4 != 0 {
+		r, c = c, r
+	}
+	if s&1 != 0 {
+		c = BoardSize - 1 - c
+	}
+	if s&2 != 0 {
+		r = BoardSize - 1 - r
+	}
+	return r*BoardSize + c
+}
+
+// InverseSymmetry returns the symmetry that undoes s.
+func InverseSymmetry(s int) int {
+	// B1 lies on no axis of the board, so only the identity leaves it be.
+	for t := range NumSymmetries {
+		if TransformSquare(TransformSquare(1, s), t) == 1 {
+			return t
+		}
+	}
+	return 0
+}
+
+// TransformBitboard maps every square of bb by symmetry s.
+func TransformBitboard(bb Bitboard, s int) Bitboard {
+	if s == 0 {
+		return bb
+	}
+	var out Bitboard
+	for ; bb != 0; bb &= bb - 1 {
+		out |= Bitboard(1) << uint(TransformSquare(bits.TrailingZeros64(uint64(bb)), s))
+	}
+	return out
+}
+
+// TransformPosition returns gs with its stones mapped by symmetry s; the
+// player to move and the players still in are the same.
+func TransformPosition(gs GameState, s int) GameState {
+	var board Board
+	for p := range board.P {
+		board.P[p] = TransformBitboard(gs.Board.P[p], s)
+	}
+	board.Occupied = TransformBitboard(gs.Board.Occupied, s)
+	return NewGameState(board, gs.PlayerID, gs.ActiveMask)
+}
+
+// CanonicalGame returns the least, as a string, of the record notations of
+// moves under the 8 symmetries, each mapping every move of the game alike, and
+// the first symmetry that gives it. Two games get the same string exactly when
+// one is a rotation or reflection of the other, move for move.
+func CanonicalGame(moves []Move) (string, int) {
+	best, bestS := "", 0
+	tokens := make([]string, len(moves))
+	for s := range NumSymmetries {
+		for i, m := range moves {
+			if m != ResignMove {
+				m = MoveFromIndex(TransformSquare(m.ToIndex(), s))
+			}
+			tokens[i] = FormatRecordMove(m)
+		}
+		if game := strings.Join(tokens, " "); s == 0 || game < best {
+			best, bestS = game, s
+		}
+	}
+	return best, bestS
+}
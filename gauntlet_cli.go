@@ -0,0 +1,195 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// --- Gauntlet evaluation ---
+
+// scoreInterval returns a player's mean score per game in s and the
+// half-width of its 95% confidence interval, by the normal approximation. As
+// in the SPRT, the variance is regularized with one game's worth of the
+// variance at equal strength, so that a short run of identical results does
+// not give an empty interval.
+func scoreInterval(s Standing) (mean, half float64) {
+	if s.Games == 0 {
+		return 0, math.Inf(1)
+	}
+	n := float64(s.Games)
+	mean = s.Score() / n
+	sq := (float64(s.Wins) + float64(s.Draws)/9) / n
+	s0 := eloScore(0)
+	variance := (n*(sq-mean*mean) + s0*(1-s0)) / (n + 1)
+	return mean, 1.96 * math.Sqrt(variance/n)
+}
+
+// eloInterval converts scoreInterval to Elo.
+func eloInterval(s Standing) (elo, lo, hi float64) {
+	mean, half := scoreInterval(s)
+	return scoreElo(mean), scoreElo(mean - half), scoreElo(mean + half)
+}
+
+// gauntletMinGames is the fewest games a decision is taken on, since the
+// normal approximation of the interval is poor below it.
+const gauntletMinGames = 30
+
+// GauntletDecision decides on a candidate from its results: "promote" when
+// its whole 95% interval is above threshold Elo, "reject" when it is below,
+// and "inconclusive" otherwise or before gauntletMinGames games.
+func GauntletDecision(s Standing, threshold float64) string {
+	_, lo, hi := eloInterval(s)
+	switch {
+	case s.Games < gauntletMinGames:
+	case lo > threshold:
+		return "promote"
+	case hi < threshold:
+		return "reject"
+	}
+	return "inconclusive"
+}
+
+// runGauntlet implements `squava gauntlet`, playing a candidate against a
+// pool of reference engines and deciding whether to promote it.
+func runGauntlet(args []string) int {
+	fs := flag.NewFlagSet("gauntlet", flag.ExitOnError)
+	candidate := fs.String("candidate", "", "The engine under test, as name=type, e.g. new=mcts@2000 or net=cmd:./engine")
+	var refs engineList
+	fs.Var(&refs, "ref", "A reference engine as name=type (repeatable)")
+	games := fs.Int("games", 60, "Games against each reference engine, rounded up to a multiple of 3 for seat rotation")
+	threshold := fs.Float64("promote", 0, "Promote the candidate if its whole 95% interval is above this many Elo")
+	iterations := fs.Int("iterations", 1000, "MCTS iterations for engines without @N")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Games to play at the same time")
+	seed := fs.Int64("seed", 0, "Random seed of the first game; later games count up from it (0 for time-based)")
+	out := fs.String("out", "", "Append one JSON line per game to this results file")
+	recordsDir := fs.String("records", "", "Save the record of every game in this directory")
+	logs := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava gauntlet -candidate new=mcts@2000 -ref base=mcts@1000 [-ref ...] [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *candidate == "" || len(refs) == 0 || *games < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	stopLog, err := logs.start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	defer stopLog()
+	cand, err := ParseTournamentEngine(*candidate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-candidate: %v\n", err)
+		return exitUsage
+	}
+	for _, r := range refs {
+		if r.Name == cand.Name {
+			fmt.Fprintf(os.Stderr, "the reference %s has the candidate's name\n", r.Name)
+			return exitUsage
+		}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	// The candidate meets each reference engine in its own games, against two
+	// copies of it, and takes every seat equally often.
+	state := &TournamentState{Format: "gauntlet", Seed: *seed, Iterations: *iterations, Engines: append(engineList{cand}, refs...)}
+	m, err := newMatchRunner(state, *concurrency)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if *recordsDir != "" {
+		if err := os.MkdirAll(*recordsDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		m.recordsDir = *recordsDir
+	}
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open results file: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		m.results = f
+	}
+	var schedule []*tournamentGame
+	for r := 1; r <= len(refs); r++ {
+		seatings := Seatings([3]int{0, r, r})
+		for i := 0; i < (*games+len(seatings)-1)/len(seatings)*len(seatings); i++ {
+			schedule = append(schedule, &tournamentGame{Index: len(schedule) + 1, Seed: *seed + int64(len(schedule)), Seats: seatings[i%len(seatings)]})
+		}
+	}
+	slog.Info(fmt.Sprintf("Gauntlet: %s (%s) against %d reference engines, %d games, %s", cand.Name, cand.Spec, len(refs), len(schedule), m.pace()),
+		"event", "start", "format", "gauntlet", "candidate", cand.Name, "references", len(refs), "games", len(schedule))
+
+	// vs[r] is the candidate's record against reference engine r.
+	vs := make([]Standing, len(m.engines))
+	var total Standing
+	failed := 0
+	for g := range m.play(m.schedule(schedule), nil) {
+		if g.Err != nil {
+			failed++
+			slog.Error(fmt.Sprintf("Game %d: %v", g.Index, g.Err), m.gameAttrs(g)...)
+			continue
+		}
+		desc, err := m.record(g)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		slog.Info(fmt.Sprintf("Game %d %s", g.Index, desc), m.gameAttrs(g)...)
+		for i, e := range g.Seats {
+			if e == 0 {
+				ref := g.Seats[(i+1)%3]
+				vs[ref].add(g.Outcome.Result[i])
+				total.add(g.Outcome.Result[i])
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("%-20s %6s %5s %5s %5s %7s %8s %17s\n", "Reference", "Games", "Wins", "Draws", "Loss", "Score", "Elo", "95% interval")
+	for r := 1; r < len(m.engines); r++ {
+		vs[r].Name = m.engines[r].Name
+		printGauntletRow(vs[r])
+	}
+	total.Name = "all"
+	printGauntletRow(total)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d game(s) failed\n", failed)
+	}
+
+	decision := GauntletDecision(total, *threshold)
+	elo, lo, hi := eloInterval(total)
+	fmt.Printf("\n%s: %s (%+.1f Elo, 95%% interval [%+.1f, %+.1f], threshold %+g)\n", cand.Name, strings.ToUpper(decision[:1])+decision[1:], elo, lo, hi, *threshold)
+	fmt.Printf("GAUNTLET decision=%s elo=%.1f lo=%.1f hi=%.1f games=%d\n", decision, elo, lo, hi, total.Games)
+	if decision != "promote" {
+		return exitError
+	}
+	return 0
+}
+
+// printGauntletRow writes the candidate's record against one reference.
+func printGauntletRow(s Standing) {
+	if s.Games == 0 {
+		fmt.Printf("%-20s %6d\n", s.Name, 0)
+		return
+	}
+	mean, _ := scoreInterval(s)
+	elo, lo, hi := eloInterval(s)
+	fmt.Printf("%-20s %6d %5d %5d %5d %6.1f%% %+8.1f [%+7.1f, %+7.1f]\n", s.Name, s.Games, s.Wins, s.Draws, s.Losses, 100*mean, elo, lo, hi)
+}
@@ -0,0 +1,28 @@
+//go:build !wasm
+
+package main
+
+import "testing"
+
+func TestGauntletDecision(t *testing.T) {
+	tests := []struct {
+		s    Standing
+		want string
+	}{
+		{Standing{Games: 90, Wins: 30, Losses: 60}, "inconclusive"},
+		{Standing{Games: 90, Wins: 60, Losses: 30}, "promote"},
+		{Standing{Games: 90, Wins: 5, Losses: 85}, "reject"},
+		// A short run of wins is not enough.
+		{Standing{Games: 2, Wins: 2}, "inconclusive"},
+		{Standing{}, "inconclusive"},
+	}
+	for _, tt := range tests {
+		if got := GauntletDecision(tt.s, 0); got != tt.want {
+			elo, lo, hi := eloInterval(tt.s)
+			t.Errorf("%+v: %s (%.0f Elo in [%.0f, %.0f]), want %s", tt.s, got, elo, lo, hi, tt.want)
+		}
+	}
+	if got := GauntletDecision(Standing{Games: 90, Wins: 60, Losses: 30}, 400); got != "reject" {
+		t.Errorf("against a 400 Elo threshold: %s, want reject", got)
+	}
+}
@@ -0,0 +1,155 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"squava/game"
+)
+
+var (
+	asciiSparks   = []rune("_.-=+*#@")
+	unicodeSparks = []rune("▁▂▃▄▅▆▇█")
+)
+
+// Sparkline draws values in [0, 1] as one character each, from lowest to
+// highest bar.
+func Sparkline(values []float32, unicode bool) string {
+	sparks := asciiSparks
+	if unicode {
+		sparks = unicodeSparks
+	}
+	var sb strings.Builder
+	for _, v := range values {
+		level := int(v * float32(len(sparks)))
+		if level < 0 {
+			level = 0
+		}
+		if level >= len(sparks) {
+			level = len(sparks) - 1
+		}
+		sb.WriteRune(sparks[level])
+	}
+	return sb.String()
+}
+
+// positions returns every position of the game, from the first to the
+// current one.
+func (g *SquavaGame) positions() []game.GameState {
+	return append(append([]game.GameState(nil), g.history...), g.gs)
+}
+
+// renderEvalGraph draws one sparkline per player over series, followed by the
+// points the solver proved and the move where the game turned the most.
+func (g *SquavaGame) renderEvalGraph(series []EvalPoint) []string {
+	var lines []string
+	for _, p := range g.players {
+		id := p.ID()
+		values := make([]float32, len(series))
+		for i, pt := range series {
+			values[i] = pt.Winrates[id]
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s) %s %5.1f%% -> %5.1f%%", p.Name(), p.Symbol(),
+			Sparkline(values, g.style.Unicode), values[0]*100, values[len(values)-1]*100))
+	}
+	var proven []string
+	positions := g.positions()
+	for _, pt := range series {
+		if pt.Outcome != "" {
+			p := g.GetPlayer(positions[pt.Ply].PlayerID)
+			proven = append(proven, fmt.Sprintf("move %d %s %s", pt.Ply, p.Symbol(), pt.Outcome))
+		}
+	}
+	if len(proven) > 0 {
+		lines = append(lines, "Proven for the player to move after "+strings.Join(proven, ", "))
+	}
+	if ply, id, delta := BiggestSwing(series); ply > 0 {
+		mover := g.GetPlayer(g.history[ply-1].PlayerID)
+		lines = append(lines, fmt.Sprintf("Biggest swing: move %d, %s %s, changed %s's winrate by %+.1f%%",
+			ply, mover.Name(), game.FormatRecordMove(g.moves[ply-1]), g.GetPlayer(id).Name(), delta*100))
+	}
+	return lines
+}
+
+// runGraph implements `squava graph game.sqv`, analyzing every position of a
+// saved game and showing how each player's winrate evolved.
+func runGraph(args []string) int {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	plain := fs.Bool("plain", false, "Plain ASCII sparklines")
+	iterations := fs.Int("iterations", 2000, "MCTS iterations per position")
+	asJSON := fs.Bool("json", false, "Print the evaluation series as JSON")
+	report := fs.String("report", "", "Also write an HTML report of the game to this file")
+	reportEngine := fs.String("report-engine", "", "Embed this WASM build of squava (make wasm) in -report to explore its positions with")
+	ttFile := fs.String("tt-file", "", "Start from the search graph saved in this file, if any, and save it there afterwards")
+	ttMinVisits := fs.Int("tt-min-visits", DefaultTableMinVisits, "Leave nodes with fewer visits out of -tt-file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava graph [-plain] [-json] [-iterations N] [-report game.html] [-tt-file table.sqt] game.sqv")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	g, _, err := loadRecordFile(fs.Arg(0), *plain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	if *reportEngine != "" {
+		wasm, err := LoadReportEngine(*reportEngine)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load %s: %v\n", *reportEngine, err)
+			return 1
+		}
+		g.SetReportEngine(wasm)
+	}
+
+	analyzer := NewAnalyzer(0)
+	positions := g.positions()
+	if *ttFile != "" {
+		if _, err := loadTableFile(*ttFile, []*MCTSPlayer{analyzer.m}); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load %s: %v\n", *ttFile, err)
+			return 1
+		}
+	}
+	series := analyzer.EvalSeries(positions, *iterations)
+	if *ttFile != "" {
+		if _, err := saveTableFile(*ttFile, []*MCTSPlayer{analyzer.m}, positions, *ttMinVisits); err != nil {
+			fmt.Fprintf(os.Stderr, "could not save %s: %v\n", *ttFile, err)
+			return 1
+		}
+	}
+	if *report != "" {
+		if err := g.writeReportFile(*report, series); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write report: %v\n", err)
+			return 1
+		}
+	}
+	if *asJSON {
+		out := struct {
+			Moves  []string    `json:"moves"`
+			Series []EvalPoint `json:"series"`
+		}{Moves: []string{}, Series: series}
+		for _, m := range g.moves {
+			out.Moves = append(out.Moves, game.FormatRecordMove(m))
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write JSON: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("Evaluation over %d moves (%d iterations per position):\n", len(g.moves), *iterations)
+	for _, line := range g.renderEvalGraph(series) {
+		fmt.Println(line)
+	}
+	return 0
+}
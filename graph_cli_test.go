@@ -0,0 +1,41 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestSparklineAndSwing(t *testing.T) {
+	if got := Sparkline([]float32{0, 0.5, 1}, false); got != "_+@" {
+		t.Errorf("Sparkline: got %q", got)
+	}
+	series := []EvalPoint{
+		{Ply: 0, Winrates: [3]float32{0.3, 0.3, 0.3}},
+		{Ply: 1, Winrates: [3]float32{0.4, 0.3, 0.3}},
+		{Ply: 2, Winrates: [3]float32{0, 0.9, 0.1}},
+	}
+	ply, id, delta := BiggestSwing(series)
+	if ply != 2 || id != 1 || delta < 0.59 || delta > 0.61 {
+		t.Errorf("BiggestSwing: got ply %d player %d delta %f", ply, id, delta)
+	}
+}
+
+func TestRenderEvalGraphProven(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	g.play(game.MoveFromIndex(0))
+	g.play(game.MoveFromIndex(63))
+	series := []EvalPoint{
+		{Ply: 0, Winrates: [3]float32{0.3, 0.3, 0.3}},
+		{Ply: 1, Winrates: [3]float32{0.4, 0.3, 0.3}},
+		{Ply: 2, Winrates: [3]float32{0.2, 0.2, 0.6}, Outcome: "win"},
+	}
+	lines := g.renderEvalGraph(series)
+	want := "Proven for the player to move after move 2 " + g.GetPlayer(2).Symbol() + " win"
+	if !strings.Contains(strings.Join(lines, "\n"), want) {
+		t.Errorf("Expected %q in the graph:\n%s", want, strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,110 @@
+package kernels
+
+// --- Line tables ---
+
+// A table-driven alternative to the shift kernels for the threats a move
+// makes. Each line through a square (its row, column, diagonal and
+// anti-diagonal) is gathered into a byte, one bit per square in order along
+// the line, and looked up in a table of the threats on 8 squares.
+
+// lineThreats[m] is, for a line whose squares in m hold the player's stones,
+// the squares where another stone would make 4 in a row (low byte) and 3 in
+// a row (high byte), whether those squares are empty or not.
+var lineThreats [256]uint16
+
+var (
+	// diagonalOf[idx] and antiDiagonalOf[idx] are the diagonals through idx.
+	// Their squares lie in different columns, so a byte indexed by column
+	// holds either.
+	diagonalOf, antiDiagonalOf [64]uint64
+
+	// columnOf[m] is the A-file squares of the rows in m.
+	columnOf [256]uint64
+
+	// linesThrough[idx] is the row, column and diagonals through idx.
+	linesThrough [64]uint64
+)
+
+// UseLineTables tells the game to update the mover's threats after a move
+// from the line tables instead of the threat kernel. Each architecture sets
+// it to the faster of the two.
+var UseLineTables bool
+
+const (
+	boardSize = 8
+	fileA     = 0x0101010101010101
+	// columnMagic gathers the A file into the top byte, row i to bit i.
+	columnMagic = 0x0102040810204080
+)
+
+func init() {
+	for m := range lineThreats {
+		for p := 0; p < 8; p++ {
+			mine := uint(m) &^ (1 << uint(p))
+			for s := max(p-3, 0); s <= min(p, 4); s++ {
+				if window := uint(0xF<<uint(s)) &^ (1 << uint(p)); mine&window == window {
+					lineThreats[m] |= 1 << uint(p)
+				}
+			}
+			for s := max(p-2, 0); s <= min(p, 5); s++ {
+				if window := uint(0x7<<uint(s)) &^ (1 << uint(p)); mine&window == window {
+					lineThreats[m] |= 1 << uint(8+p)
+				}
+			}
+		}
+	}
+	for idx := range diagonalOf {
+		r, c := idx/boardSize, idx%boardSize
+		for rr := 0; rr < boardSize; rr++ {
+			if cc := c + rr - r; cc >= 0 && cc < boardSize {
+				diagonalOf[idx] |= uint64(1) << uint(rr*boardSize+cc)
+			}
+			if cc := c - rr + r; cc >= 0 && cc < boardSize {
+				antiDiagonalOf[idx] |= uint64(1) << uint(rr*boardSize+cc)
+			}
+		}
+	}
+	for idx := range linesThrough {
+		r, c := idx/boardSize, idx%boardSize
+		linesThrough[idx] = 0xFF<<uint(r*boardSize) | fileA<<uint(c) | diagonalOf[idx] | antiDiagonalOf[idx]
+	}
+	for m := range columnOf {
+		for r := 0; r < boardSize; r++ {
+			if m&(1<<uint(r)) != 0 {
+				columnOf[m] |= uint64(1) << uint(r*boardSize)
+			}
+		}
+	}
+}
+
+// LineWinsAndLosses returns the squares on the lines through idx where a
+// stone of the player with stones b would make 4 in a row (wins) or 3 in a
+// row (loses), empty or not. Unlike WinsAndLosses, a square can be in both.
+func LineWinsAndLosses(b uint64, idx int) (wins, loses uint64) {
+	r, c := uint(idx/boardSize), uint(idx%boardSize)
+
+	t := lineThreats[uint8(b>>(8*r))]
+	wins = uint64(t&0xFF) << (8 * r)
+	loses = uint64(t>>8) << (8 * r)
+
+	t = lineThreats[uint8((b>>c&fileA)*columnMagic>>56)]
+	wins |= columnOf[uint8(t)] << c
+	loses |= columnOf[t>>8] << c
+
+	d := diagonalOf[idx&63]
+	t = lineThreats[uint8(b&d*fileA>>56)]
+	wins |= uint64(t&0xFF) * fileA & d
+	loses |= uint64(t>>8) * fileA & d
+
+	d = antiDiagonalOf[idx&63]
+	t = lineThreats[uint8(b&d*fileA>>56)]
+	wins |= uint64(t&0xFF) * fileA & d
+	loses |= uint64(t>>8) * fileA & d
+	return wins, loses
+}
+
+// LinesThrough returns the squares on the row, column and diagonals through
+// idx, the only squares whose stones can make a threat with a stone on idx.
+func LinesThrough(idx int) uint64 {
+	return linesThrough[idx&63]
+}
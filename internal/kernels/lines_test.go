@@ -0,0 +1,28 @@
+package kernels
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// TestLineWinsAndLosses checks the line tables against the threat kernel on
+// each line through each square. Restricted to the stones on one line, the
+// kernel finds only the threats along it.
+func TestLineWinsAndLosses(t *testing.T) {
+	rng := rand.New(rand.NewPCG(21, 0))
+	for i := 0; i < 2000; i++ {
+		b := rng.Uint64() & rng.Uint64()
+		empty := ^b & rng.Uint64()
+		for idx := 0; idx < 64; idx++ {
+			var wantW, wantL uint64
+			for _, line := range []uint64{0xFF << uint(idx/8*8), fileA << uint(idx%8), diagonalOf[idx], antiDiagonalOf[idx]} {
+				w, l := WinsAndLossesGo(b&line, empty&line)
+				wantW, wantL = wantW|w, wantL|l
+			}
+			w, l := LineWinsAndLosses(b, idx)
+			if w&empty != wantW || l&empty != wantL {
+				t.Fatalf("LineWinsAndLosses(%x, %d) = %x, %x within %x; want %x, %x", b, idx, w, l, empty, wantW, wantL)
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build amd64 && !js
+
+package kernels
+
+//go:noescape
+func symXorAVX2(h *[8]uint64, keys *[64][8]uint64, stones uint64)
+
+//go:noescape
+func symXorAVX512(h *[8]uint64, keys *[64][8]uint64, stones uint64)
+
+// SymXor is SymXorGo on the kernels in use.
+func SymXor(h *[8]uint64, keys *[64][8]uint64, stones uint64) {
+	switch Level {
+	case simdAVX512:
+		symXorAVX512(h, keys, stones)
+	case simdAVX2:
+		symXorAVX2(h, keys, stones)
+	default:
+		SymXorGo(h, keys, stones)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build amd64 && !js
+
+#include "textflag.h"
+
+// The 8 hashes stay in two YMM registers (AVX2) or one ZMM register
+// (AVX-512) while the keys of each stone, 64 bytes at keys+64*idx, are
+// XORed in.
+
+// func symXorAVX2(h *[8]uint64, keys *[64][8]uint64, stones uint64)
+TEXT ·symXorAVX2(SB), NOSPLIT, $0-24
+	MOVQ h+0(FP), DI
+	MOVQ keys+8(FP), SI
+	MOVQ stones+16(FP), AX
+	VMOVDQU (DI), Y0
+	VMOVDQU 32(DI), Y1
+	TESTQ AX, AX
+	JZ done
+
+loop:
+	BSFQ AX, CX
+	SHLQ $6, CX
+	VPXOR (SI)(CX*1), Y0, Y0
+	VPXOR 32(SI)(CX*1), Y1, Y1
+	LEAQ -1(AX), DX
+	ANDQ DX, AX
+	JNZ loop
+
+done:
+	VMOVDQU Y0, (DI)
+	VMOVDQU Y1, 32(DI)
+	VZEROUPPER
+	RET
+
+// func symXorAVX512(h *[8]uint64, keys *[64][8]uint64, stones uint64)
+TEXT ·symXorAVX512(SB), NOSPLIT, $0-24
+	MOVQ h+0(FP), DI
+	MOVQ keys+8(FP), SI
+	MOVQ stones+16(FP), AX
+	VMOVDQU64 (DI), Z0
+	TESTQ AX, AX
+	JZ done
+
+loop:
+	BSFQ AX, CX
+	SHLQ $6, CX
+	VPXORQ (SI)(CX*1), Z0, Z0
+	LEAQ -1(AX), DX
+	ANDQ DX, AX
+	JNZ loop
+
+done:
+	VMOVDQU64 Z0, (DI)
+	VZEROUPPER
+	RET
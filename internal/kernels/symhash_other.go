@@ -0,0 +1,8 @@
+//go:build !amd64 || js
+
+package kernels
+
+// SymXor is SymXorGo on the kernels in use.
+func SymXor(h *[8]uint64, keys *[64][8]uint64, stones uint64) {
+	SymXorGo(h, keys, stones)
+}
@@ -0,0 +1,168 @@
+// Package kernels holds squava's hot loops on bitboards and edge statistics:
+// the threat kernel, edge selection, symmetric hashing and bit selection.
+// Each has a portable Go version and, where the CPU has them, SIMD ones in
+// assembly, picked at startup. The game package and the engine share them.
+package kernels
+
+import "math/bits"
+
+// --- Portable kernels ---
+
+// These are the Go versions of the SIMD kernels, used on architectures and
+// CPUs without them.
+
+// Edge masks of the shifts: the squares a shift along a row may move a
+// stone to without it wrapping to the next row.
+const (
+	maskNotA   uint64 = 0xFEFEFEFEFEFEFEFE
+	maskNotH   uint64 = 0x7F7F7F7F7F7F7F7F
+	maskNotAB  uint64 = 0xFCFCFCFCFCFCFCFC
+	maskNotGH  uint64 = 0x3F3F3F3F3F3F3F3F
+	maskNotABC uint64 = 0xF8F8F8F8F8F8F8F8
+	maskNotFGH uint64 = 0x1F1F1F1F1F1F1F1F
+)
+
+// WinsAndLossesGo returns the squares of e where a stone of the player with
+// stones b would make 4 in a row (w) or 3 in a row (l); a square can be in
+// both.
+func WinsAndLossesGo(b, e uint64) (w, l uint64) {
+	// Direction 0: Horizontal (s=1)
+	{
+		r1 := (b >> 1) & maskNotH
+		l1 := (b << 1) & maskNotA
+		r2 := (b >> 2) & maskNotGH
+		l2 := (b << 2) & maskNotAB
+
+		r1r2 := r1 & r2
+		l1l2 := l1 & l2
+		l |= e & (r1r2 | r1&l1 | l1l2)
+
+		r3 := (b >> 3) & maskNotFGH
+		l3 := (b << 3) & maskNotABC
+		w |= e & (r1r2&(r3|l1) | l1l2&(r1|l3))
+	}
+
+	// Direction 1: Vertical (s=8)
+	{
+		r1 := (b >> 8)
+		l1 := (b << 8)
+		r2 := (b >> 16)
+		l2 := (b << 16)
+
+		r1r2 := r1 & r2
+		l1l2 := l1 & l2
+		l |= e & (r1r2 | r1&l1 | l1l2)
+
+		r3 := (b >> 24)
+		l3 := (b << 24)
+		w |= e & (r1r2&(r3|l1) | l1l2&(r1|l3))
+	}
+
+	// Direction 2: Diagonal (s=9)
+	{
+		r1 := (b >> 9) & maskNotH
+		l1 := (b << 9) & maskNotA
+		r2 := (b >> 18) & maskNotGH
+		l2 := (b << 18) & maskNotAB
+
+		r1r2 := r1 & r2
+		l1l2 := l1 & l2
+		l |= e & (r1r2 | r1&l1 | l1l2)
+
+		r3 := (b >> 27) & maskNotFGH
+		l3 := (b << 27) & maskNotABC
+		w |= e & (r1r2&(r3|l1) | l1l2&(r1|l3))
+	}
+
+	// Direction 3: Anti-diagonal (s=7)
+	{
+		r1 := (b >> 7) & maskNotA
+		l1 := (b << 7) & maskNotH
+		r2 := (b >> 14) & maskNotAB
+		l2 := (b << 14) & maskNotGH
+
+		r1r2 := r1 & r2
+		l1l2 := l1 & l2
+		l |= e & (r1r2 | r1&l1 | l1l2)
+
+		r3 := (b >> 21) & maskNotABC
+		l3 := (b << 21) & maskNotFGH
+		w |= e & (r1r2&(r3|l1) | l1l2&(r1|l3))
+	}
+
+	return
+}
+
+// SelectBestEdgeGo returns the first edge with the best score. Rounding the
+// product before the sum keeps the compiler from fusing them into a
+// multiply-add, so that every platform and kernel scores edges alike.
+func SelectBestEdgeGo(qs []float32, us []float32, coeff float32) int {
+	if len(qs) == 0 {
+		return -1
+	}
+	bestIdx := 0
+	bestScore := qs[0] + float32(coeff*us[0])
+	for i := 1; i < len(qs); i++ {
+		score := qs[i] + float32(coeff*us[i])
+		if score > bestScore {
+			bestScore = score
+			bestIdx = i
+		}
+	}
+	return bestIdx
+}
+
+// selectBit64Go is SelectBit64 for CPUs without PDEP. It uses a
+// hierarchical bit-counting approach (logarithmic steps) which is
+// significantly faster than iterating or using software pdep on WASM.
+func selectBit64Go(v uint64, k int) int {
+	b := 0
+	// 32-bit step
+	if n := bits.OnesCount64(v & 0xFFFFFFFF); k >= n {
+		k -= n
+		b += 32
+		v >>= 32
+	}
+	// 16-bit step
+	if n := bits.OnesCount64(v & 0xFFFF); k >= n {
+		k -= n
+		b += 16
+		v >>= 16
+	}
+	// 8-bit step
+	if n := bits.OnesCount64(v & 0xFF); k >= n {
+		k -= n
+		b += 8
+		v >>= 8
+	}
+	// 4-bit step
+	if n := bits.OnesCount64(v & 0xF); k >= n {
+		k -= n
+		b += 4
+		v >>= 4
+	}
+	// 2-bit step
+	if n := bits.OnesCount64(v & 0x3); k >= n {
+		k -= n
+		b += 2
+		v >>= 2
+	}
+	// 1-bit step
+	if n := bits.OnesCount64(v & 0x1); k >= n {
+		b += 1
+	}
+	return b
+}
+
+// SymXorGo XORs into h the keys of every square in stones. keys[idx] holds
+// the 8 keys of a stone on idx, one per symmetry, next to each other, so
+// that the SIMD versions load and XOR them as one or two vectors.
+func SymXorGo(h *[8]uint64, keys *[64][8]uint64, stones uint64) {
+	h0, h1, h2, h3, h4, h5, h6, h7 := h[0], h[1], h[2], h[3], h[4], h[5], h[6], h[7]
+	for ; stones != 0; stones &= stones - 1 {
+		k := &keys[bits.TrailingZeros64(stones)&63]
+		h0, h1, h2, h3 = h0^k[0], h1^k[1], h2^k[2], h3^k[3]
+		h4, h5, h6, h7 = h4^k[4], h5^k[5], h6^k[6], h7^k[7]
+	}
+	*h = [8]uint64{h0, h1, h2, h3, h4, h5, h6, h7}
+}
@@ -0,0 +1,100 @@
+//go:build amd64 && !js
+
+package kernels
+
+import "math/bits"
+
+func getWinsAndLossesAVX2(b, e uint64) (w, l uint64)
+func getWinsAndLossesAVX512(b, e uint64) (w, l uint64)
+func pdep(src, mask uint64) uint64
+func selectBestEdgeAVX2(qs []float32, us []float32, coeff float32) int
+func selectBestEdgeAVX512(qs []float32, us []float32, coeff float32) int
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+func xgetbv() (eax, edx uint32)
+
+// Kernel sets, in order of preference.
+const (
+	simdGo = iota
+	simdAVX2
+	simdAVX512
+)
+
+var simdNames = [...]string{simdGo: "go", simdAVX2: "avx2", simdAVX512: "avx512"}
+
+var (
+	// Level is the kernel set in use: the best the CPU and OS support,
+	// found at startup. Tests and benchmarks lower it to compare the paths.
+	Level, MaxLevel int
+	hasBMI2         bool
+)
+
+func init() {
+	MaxLevel, hasBMI2 = detectSIMD()
+	Level = MaxLevel
+	// The line tables beat the Go kernel, but not the SIMD ones.
+	UseLineTables = Level == simdGo
+}
+
+// detectSIMD reads the CPU's features. AVX2 kernels need AVX2 and FMA,
+// AVX-512 kernels AVX-512F and VL, each also needing the OS to save the
+// registers they use. The AVX-512 kernels keep to those two extensions:
+// they extract with VEXTRACTI32X4, say, not VEXTRACTI64X2, which needs DQ.
+func detectSIMD() (level int, bmi2 bool) {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return simdGo, false
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	_, ebx7, _, _ := cpuid(7, 0)
+	has := func(reg uint32, bit uint) bool { return reg&(1<<bit) != 0 }
+	bmi2 = has(ebx7, 8)
+	if !has(ecx1, 27) { // OSXSAVE
+		return simdGo, bmi2
+	}
+	xcr0, _ := xgetbv()
+	const (
+		ymmState = 0x6  // SSE and AVX
+		zmmState = 0xe6 // and the opmask and upper ZMM registers
+	)
+	if !has(ecx1, 28) || !has(ecx1, 12) || !has(ebx7, 5) || xcr0&ymmState != ymmState {
+		return simdGo, bmi2
+	}
+	if !has(ebx7, 16) || !has(ebx7, 31) || xcr0&zmmState != zmmState {
+		return simdAVX2, bmi2
+	}
+	return simdAVX512, bmi2
+}
+
+// Name names the kernels in use: "avx512", "avx2" or "go".
+func Name() string { return simdNames[Level] }
+
+// WinsAndLosses is WinsAndLossesGo on the kernels in use.
+func WinsAndLosses(b, e uint64) (w, l uint64) {
+	switch Level {
+	case simdAVX512:
+		return getWinsAndLossesAVX512(b, e)
+	case simdAVX2:
+		return getWinsAndLossesAVX2(b, e)
+	}
+	return WinsAndLossesGo(b, e)
+}
+
+// SelectBestEdge is SelectBestEdgeGo on the kernels in use.
+func SelectBestEdge(qs []float32, us []float32, coeff float32) int {
+	switch Level {
+	case simdAVX512:
+		return selectBestEdgeAVX512(qs, us, coeff)
+	case simdAVX2:
+		return selectBestEdgeAVX2(qs, us, coeff)
+	}
+	return SelectBestEdgeGo(qs, us, coeff)
+}
+
+// SelectBit64 returns the position (0-63) of the k-th set bit in v.
+// k is 0-indexed.
+func SelectBit64(v uint64, k int) int {
+	if !hasBMI2 {
+		return selectBit64Go(v, k)
+	}
+	return bits.TrailingZeros64(pdep(uint64(1)<<uint(k), v))
+}
@@ -181,7 +181,8 @@ loop:
     VMOVUPS (SI)(DX*4), Y5    // load 8 Qs
     VMOVUPS (DI)(DX*4), Y6    // load 8 Us
     
-    VFMADD213PS Y5, Y0, Y6    // Y6 = Y0*Y6 + Y5 = coeff*U + Q
+    VMULPS Y6, Y0, Y6         // Y6 = coeff*U, rounded as in Go
+    VADDPS Y5, Y6, Y6         // Y6 = coeff*U + Q
     
     VCMPPS $14, Y1, Y6, Y8    // Y8 = Y6 > Y1
     
@@ -193,22 +194,35 @@ loop:
     JMP loop
 
 reduce:
-    // Reduce Y1 (scores) and Y2 (indices) to scalar X1/X2 lane 0
+    // Reduce Y1 (scores) and Y2 (indices) to scalar X1/X2 lane 0. Of equal
+    // scores the smaller index stays, so that ties go to the first edge.
     VEXTRACTI128 $1, Y1, X5
     VEXTRACTI128 $1, Y2, X6
     VCMPPS $14, X1, X5, X8
+    VCMPPS $0, X1, X5, X9
+    VPCMPGTD X6, X2, X10
+    VPAND X10, X9, X9
+    VPOR X9, X8, X8           // X8 = X5 > X1, or equal with a smaller index
     VBLENDVPS X8, X5, X1, X1
     VBLENDVPS X8, X6, X2, X2
 
     VPSHUFD $0x4E, X1, X5
     VPSHUFD $0x4E, X2, X6
     VCMPPS $14, X1, X5, X8
+    VCMPPS $0, X1, X5, X9
+    VPCMPGTD X6, X2, X10
+    VPAND X10, X9, X9
+    VPOR X9, X8, X8           // X8 = X5 > X1, or equal with a smaller index
     VBLENDVPS X8, X5, X1, X1
     VBLENDVPS X8, X6, X2, X2
 
     VPSHUFD $0xB1, X1, X5
     VPSHUFD $0xB1, X2, X6
     VCMPPS $14, X1, X5, X8
+    VCMPPS $0, X1, X5, X9
+    VPCMPGTD X6, X2, X10
+    VPAND X10, X9, X9
+    VPOR X9, X8, X8           // X8 = X5 > X1, or equal with a smaller index
     VBLENDVPS X8, X5, X1, X1
     VBLENDVPS X8, X6, X2, X2
 
@@ -220,7 +234,8 @@ remainder:
     
     VMOVSS (SI)(DX*4), X5     // Q
     VMOVSS (DI)(DX*4), X6     // U
-    VFMADD213SS X5, X0, X6    // X6 = X0 * X6 + X5 = coeff * U + Q
+    VMULSS X6, X0, X6         // X6 = coeff * U
+    VADDSS X5, X6, X6         // X6 = coeff * U + Q
     
     VCOMISS X1, X6            // compare current score (X6) with best (X1)
     JBE next_rem
@@ -235,3 +250,173 @@ done_final:
     MOVQ AX, ret+56(FP)
     VZEROUPPER
     RET
+
+// func getWinsAndLossesAVX512(b, e uint64) (w, l uint64)
+//
+// The same lanes as getWinsAndLossesAVX2, with the AVX-512 three-input
+// logic instruction (VPTERNLOGQ) folding the ANDs and ORs of each formula.
+TEXT ·getWinsAndLossesAVX512(SB), NOSPLIT, $0-32
+    VPBROADCASTQ b+0(FP), Y0  // Y0 = [b, b, b, b]
+    VPBROADCASTQ e+8(FP), Y1  // Y1 = [e, e, e, e]
+
+    VMOVDQU64 ·shifts1(SB), Y2
+    VPSRLVQ Y2, Y0, Y3
+    VPANDQ ·maskR1(SB), Y3, Y3 // Y3 = r1
+    VPSLLVQ Y2, Y0, Y4
+    VPANDQ ·maskL1(SB), Y4, Y4 // Y4 = l1
+
+    VMOVDQU64 ·shifts2(SB), Y2
+    VPSRLVQ Y2, Y0, Y5
+    VPANDQ ·maskR2(SB), Y5, Y5 // Y5 = r2
+    VPSLLVQ Y2, Y0, Y6
+    VPANDQ ·maskL2(SB), Y6, Y6 // Y6 = l2
+
+    VMOVDQU64 ·shifts3(SB), Y2
+    VPSRLVQ Y2, Y0, Y7
+    VPANDQ ·maskR3(SB), Y7, Y7 // Y7 = r3
+    VPSLLVQ Y2, Y0, Y8
+    VPANDQ ·maskL3(SB), Y8, Y8 // Y8 = l3
+
+    VPANDQ Y3, Y5, Y9          // Y9 = r1 & r2
+    VPANDQ Y4, Y6, Y10         // Y10 = l1 & l2
+
+    // In VPTERNLOGQ $f, C, B, A, A is also the destination and f is the
+    // truth table indexed by A<<2 | B<<1 | C.
+
+    // W lanes: e & (r1&r2&(r3|l1) | l1&l2&(r1|l3))
+    VPTERNLOGQ $0xa8, Y9, Y4, Y7   // Y7 = r1&r2 & (r3|l1)
+    VPTERNLOGQ $0xa8, Y10, Y3, Y8  // Y8 = l1&l2 & (l3|r1)
+    VPTERNLOGQ $0xa8, Y1, Y8, Y7   // Y7 = (Y7|Y8) & e
+
+    // L lanes: e & (r1&r2 | r1&l1 | l1&l2)
+    VPANDQ Y3, Y4, Y11             // Y11 = r1 & l1
+    VPTERNLOGQ $0xfe, Y10, Y9, Y11 // Y11 = r1&l1 | r1&r2 | l1&l2
+    VPANDQ Y1, Y11, Y11
+
+    // Horizontal OR for W
+    VEXTRACTI32X4 $1, Y7, X12 // AVX-512F, where VEXTRACTI64X2 needs DQ
+    VPORQ X12, X7, X7
+    VPSHUFD $0x4E, X7, X12
+    VPORQ X12, X7, X7
+    VMOVQ X7, w+16(FP)
+
+    // Horizontal OR for L
+    VEXTRACTI32X4 $1, Y11, X12
+    VPORQ X12, X11, X11
+    VPSHUFD $0x4E, X11, X12
+    VPORQ X12, X11, X11
+    VMOVQ X11, l+24(FP)
+
+    VZEROUPPER
+    RET
+
+DATA ·asmIndices16+0(SB)/4, $0
+DATA ·asmIndices16+4(SB)/4, $1
+DATA ·asmIndices16+8(SB)/4, $2
+DATA ·asmIndices16+12(SB)/4, $3
+DATA ·asmIndices16+16(SB)/4, $4
+DATA ·asmIndices16+20(SB)/4, $5
+DATA ·asmIndices16+24(SB)/4, $6
+DATA ·asmIndices16+28(SB)/4, $7
+DATA ·asmIndices16+32(SB)/4, $8
+DATA ·asmIndices16+36(SB)/4, $9
+DATA ·asmIndices16+40(SB)/4, $10
+DATA ·asmIndices16+44(SB)/4, $11
+DATA ·asmIndices16+48(SB)/4, $12
+DATA ·asmIndices16+52(SB)/4, $13
+DATA ·asmIndices16+56(SB)/4, $14
+DATA ·asmIndices16+60(SB)/4, $15
+GLOBL ·asmIndices16(SB), RODATA, $64
+
+// func selectBestEdgeAVX512(qs []float32, us []float32, coeff float32) int
+//
+// Scores 16 edges at a time, each lane keeping the first of its best. The
+// last, partial batch is loaded under a mask, so there is no scalar
+// remainder. The result is the first edge with the best score.
+TEXT ·selectBestEdgeAVX512(SB), NOSPLIT, $0-64
+    MOVQ qs_base+0(FP), SI
+    MOVQ qs_len+8(FP), R8      // R8 = length
+    MOVQ us_base+24(FP), DI
+    VBROADCASTSS coeff+48(FP), Z0 // Z0 = [coeff...]
+
+    VMOVDQU32 ·asmIndices16(SB), Z3 // Z3 = current indices [0..15]
+    VBROADCASTSS ·asmNegInf(SB), Z1 // Z1 = best scores (-inf)
+    VPXORD Z2, Z2, Z2               // Z2 = best indices (0)
+    MOVL $16, AX
+    VPBROADCASTD AX, Z4             // Z4 = [16...]
+
+    MOVQ $0, DX                // loop counter
+loop16:
+    MOVQ R8, CX
+    SUBQ DX, CX
+    JLE reduce16
+    MOVL $0xFFFF, AX
+    CMPQ CX, $16
+    JGE full16
+    // Partial batch: lanes [0, CX) only.
+    MOVL $1, AX
+    SHLL CX, AX
+    DECL AX
+full16:
+    KMOVW AX, K2
+
+    VMOVUPS.Z (SI)(DX*4), K2, Z5 // load Qs
+    VMOVUPS.Z (DI)(DX*4), K2, Z6 // load Us
+    VMULPS Z6, Z0, Z6            // Z6 = coeff*U, rounded as in Go
+    VADDPS Z5, Z6, Z6            // Z6 = coeff*U + Q
+
+    VCMPPS $14, Z1, Z6, K2, K1   // K1 = lanes where Z6 > Z1
+    VMOVAPS Z6, K1, Z1           // update best scores
+    VMOVDQA32 Z3, K1, Z2         // update best indices
+
+    VPADDD Z4, Z3, Z3            // current indices += 16
+    ADDQ $16, DX
+    JMP loop16
+
+reduce16:
+    // X5 lane 0 = the best score of all lanes.
+    VEXTRACTF64X4 $1, Z1, Y5
+    VMAXPS Y5, Y1, Y5
+    VEXTRACTF128 $1, Y5, X6
+    VMAXPS X6, X5, X5
+    VPSHUFD $0x4E, X5, X6
+    VMAXPS X6, X5, X5
+    VPSHUFD $0xB1, X5, X6
+    VMAXPS X6, X5, X5
+
+    // The smallest index among the lanes holding that score.
+    VBROADCASTSS X5, Z5
+    VCMPPS $0, Z5, Z1, K1        // K1 = lanes equal to the best
+    VPTERNLOGD $0xff, Z7, Z7, Z7 // Z7 = all ones
+    VMOVDQA32 Z2, K1, Z7
+    VEXTRACTI64X4 $1, Z7, Y8
+    VPMINUD Y8, Y7, Y7
+    VEXTRACTI128 $1, Y7, X8
+    VPMINUD X8, X7, X7
+    VPSHUFD $0x4E, X7, X8
+    VPMINUD X8, X7, X7
+    VPSHUFD $0xB1, X7, X8
+    VPMINUD X8, X7, X7
+    VMOVD X7, AX
+    MOVQ AX, ret+56(FP)
+    VZEROUPPER
+    RET
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+    MOVL eaxArg+0(FP), AX
+    MOVL ecxArg+4(FP), CX
+    CPUID
+    MOVL AX, eax+8(FP)
+    MOVL BX, ebx+12(FP)
+    MOVL CX, ecx+16(FP)
+    MOVL DX, edx+20(FP)
+    RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+    MOVL $0, CX
+    XGETBV
+    MOVL AX, eax+0(FP)
+    MOVL DX, edx+4(FP)
+    RET
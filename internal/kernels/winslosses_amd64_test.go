@@ -0,0 +1,70 @@
+//go:build amd64 && !js
+
+package kernels
+
+import "testing"
+
+func TestPdep(t *testing.T) {
+	// PDEP mask, src -> spreads bits of src into mask
+	// In our code: pdep(1<<k, v)
+	// src = 1<<k, mask = v
+	// This should return a uint64 with only the k-th set bit of v set.
+
+	tests := []struct {
+		v    uint64
+		k    int
+		want uint64
+	}{
+		{0b101010, 0, 1 << 1},
+		{0b101010, 1, 1 << 3},
+		{0b101010, 2, 1 << 5},
+		{0b111, 0, 1 << 0},
+		{0b111, 1, 1 << 1},
+		{0b111, 2, 1 << 2},
+		{0x8000000000000001, 0, 1 << 0},
+		{0x8000000000000001, 1, 1 << 63},
+	}
+
+	for _, tc := range tests {
+		got := pdep(uint64(1)<<uint(tc.k), tc.v)
+		if got != tc.want {
+			t.Errorf("pdep(1<<%d, %b) = %b, want %b", tc.k, tc.v, got, tc.want)
+		}
+	}
+}
+
+// FuzzWinsLossesKernels checks every threat kernel the CPU runs and the line
+// tables against the reference on the same board.
+func FuzzWinsLossesKernels(f *testing.F) {
+	f.Add(uint64(0), uint64(0))
+	f.Add(uint64(0x0F), ^uint64(0x0F))
+	f.Add(uint64(0x8040201000000000), ^uint64(0))
+	f.Add(uint64(0x0000000001010100), uint64(0x0100000100000001))
+	f.Fuzz(func(t *testing.T, b uint64, e uint64) {
+		want, wantL := slowWinsAndLosses(b, e)
+		check := func(name string, w, l uint64) {
+			if w != want || l&^w != wantL {
+				t.Errorf("%s(%x, %x) = %x, %x; reference gives %x, %x", name, b, e, w, l&^w, want, wantL)
+			}
+		}
+		w, l := WinsAndLossesGo(b, e)
+		check("WinsAndLossesGo", w, l)
+		if MaxLevel >= simdAVX2 {
+			w, l = getWinsAndLossesAVX2(b, e)
+			check("getWinsAndLossesAVX2", w, l)
+		}
+		if MaxLevel >= simdAVX512 {
+			w, l = getWinsAndLossesAVX512(b, e)
+			check("getWinsAndLossesAVX512", w, l)
+		}
+
+		// The line tables give the threats along the lines through one
+		// square; those through all squares cover every line.
+		var tw, tl uint64
+		for idx := 0; idx < 64; idx++ {
+			lw, ll := LineWinsAndLosses(b, idx)
+			tw, tl = tw|lw, tl|ll
+		}
+		check("LineWinsAndLosses", tw&e, tl&e)
+	})
+}
@@ -0,0 +1,27 @@
+//go:build !amd64 || js
+
+package kernels
+
+func init() {
+	// The line tables beat the Go kernel.
+	UseLineTables = true
+}
+
+// Name names the kernels in use: the portable Go ones.
+func Name() string { return "go" }
+
+// WinsAndLosses is WinsAndLossesGo on the kernels in use.
+func WinsAndLosses(b, e uint64) (w, l uint64) {
+	return WinsAndLossesGo(b, e)
+}
+
+// SelectBestEdge is SelectBestEdgeGo on the kernels in use.
+func SelectBestEdge(qs []float32, us []float32, coeff float32) int {
+	return SelectBestEdgeGo(qs, us, coeff)
+}
+
+// SelectBit64 returns the position (0-63) of the k-th set bit in v.
+// k is 0-indexed.
+func SelectBit64(v uint64, k int) int {
+	return selectBit64Go(v, k)
+}
@@ -0,0 +1,98 @@
+package kernels
+
+import "testing"
+
+// slowWinsAndLosses is a simple, obviously correct implementation for testing.
+func slowWinsAndLosses(b, e uint64) (wins, loses uint64) {
+	var w, l uint64
+	directions := []struct{ dr, dc int }{
+		{0, 1},
+		{1, 0},
+		{1, 1},
+		{1, -1},
+	}
+	for i := 0; i < 64; i++ {
+		if (e & (1 << uint(i))) == 0 {
+			continue
+		}
+		r, c := i/8, i%8
+		// Check for 4-in-a-row (win)
+		isWin := false
+		for _, dir := range directions {
+			// A win can start at any of 4 offsets relative to the new piece
+			for startOffset := -3; startOffset <= 0; startOffset++ {
+				count := 0
+				for k := 0; k < 4; k++ {
+					nr, nc := r+(startOffset+k)*dir.dr, c+(startOffset+k)*dir.dc
+					if nr >= 0 && nr < 8 && nc >= 0 && nc < 8 {
+						// Check if it's the new piece or an existing piece
+						if (nr == r && nc == c) || (b&(1<<uint(nr*8+nc))) != 0 {
+							count++
+						}
+					}
+				}
+				if count == 4 {
+					isWin = true
+					break
+				}
+			}
+			if isWin {
+				break
+			}
+		}
+		if isWin {
+			w |= (1 << uint(i))
+			continue
+		}
+		// Check for 3-in-a-row (loss)
+		isLoss := false
+		for _, dir := range directions {
+			// A loss can start at any of 3 offsets relative to the new piece
+			for startOffset := -2; startOffset <= 0; startOffset++ {
+				count := 0
+				for k := 0; k < 3; k++ {
+					nr, nc := r+(startOffset+k)*dir.dr, c+(startOffset+k)*dir.dc
+					if nr >= 0 && nr < 8 && nc >= 0 && nc < 8 {
+						if (nr == r && nc == c) || (b&(1<<uint(nr*8+nc))) != 0 {
+							count++
+						}
+					}
+				}
+				if count == 3 {
+					isLoss = true
+					break
+				}
+			}
+			if isLoss {
+				break
+			}
+		}
+		if isLoss {
+			l |= (1 << uint(i))
+		}
+	}
+	return w, l & ^w
+}
+func FuzzWinsAndLossesAgainstSlow(f *testing.F) {
+	f.Add(uint64(0), uint64(0))
+	f.Fuzz(func(t *testing.T, b uint64, e uint64) {
+		wExpected, lExpected := slowWinsAndLosses(b, e)
+		wActual, lActual := WinsAndLosses(b, e)
+		lActual &^= wActual
+		if wActual != wExpected {
+			t.Errorf("Win bitboard mismatch. Expected %016x, got %016x", wExpected, wActual)
+		}
+		if lActual != lExpected {
+			t.Errorf("Loss bitboard mismatch. Expected %016x, got %016x", lExpected, lActual)
+		}
+	})
+}
+
+func BenchmarkWinsAndLossesGo(b *testing.B) {
+	bb := uint64(0x000000000000000F)
+	empty := uint64(0xFFFFFFFFFFFFFFFF)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		WinsAndLossesGo(bb, empty)
+	}
+}
@@ -0,0 +1,169 @@
+//go:build !wasm
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"squava/game"
+)
+
+// missedWinThreshold is the winrate at which the engine considers a move a
+// win for the player making it.
+const missedWinThreshold = 0.95
+
+// kibitzPonderRounds caps the background search of a position at this many
+// times the kibitzer's iterations, so a long think does not outgrow the
+// graph.
+const kibitzPonderRounds = 50
+
+// Kibitzer is a spectating engine: it evaluates every position of a game and
+// comments on the moves played without taking part. While the players think
+// it goes on searching the position in the background (see Watch), so the
+// longer a move takes, the deeper the evaluation it is judged by. Its
+// searches preserve the game's random number stream, so play is unaffected,
+// and each builds on the search of the position before.
+type Kibitzer struct {
+	iterations int
+	analyzer   *Analyzer
+	last       Analysis // Evaluation of the position with hash lastHash
+	lastHash   uint64
+
+	mu   sync.Mutex
+	stop chan struct{} // Closed to stop the background search
+	done chan struct{} // Closed when it has stopped
+}
+
+func NewKibitzer(iterations int) *Kibitzer {
+	return &Kibitzer{iterations: iterations, analyzer: NewAnalyzer(0)}
+}
+
+// Watch searches gs in the background, a round of the kibitzer's iterations
+// at a time, until Stop or the next Comment. It replaces any search already
+// running.
+func (k *Kibitzer) Watch(gs game.GameState) {
+	k.Stop()
+	if _, terminal := gs.IsTerminal(); terminal {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	k.mu.Lock()
+	k.stop, k.done = stop, done
+	k.mu.Unlock()
+	go func() {
+		defer close(done)
+		for round := 1; round <= kibitzPonderRounds; round++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if a := k.analyzer.Analyze(gs, round*k.iterations); a.Rollouts < round*k.iterations {
+				return // Proven, or the graph is full
+			}
+		}
+	}()
+}
+
+// Stop ends the background search, if any, and waits for it.
+func (k *Kibitzer) Stop() {
+	k.mu.Lock()
+	stop, done := k.stop, k.done
+	k.stop, k.done = nil, nil
+	k.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// analyze evaluates gs, reusing the previous evaluation if gs is unchanged.
+// The Analyzer answers from its graph, so a position searched in the
+// background gets the evaluation of all the search it has had.
+func (k *Kibitzer) analyze(gs game.GameState) Analysis {
+	if k.lastHash == gs.Hash && k.last.Rollouts > 0 {
+		return k.last
+	}
+	a := k.analyzer.Analyze(gs, k.iterations)
+	k.last, k.lastHash = a, gs.Hash
+	return a
+}
+
+// winrates returns every player's winrate in gs: exact if the game is over,
+// otherwise the engine's estimate.
+func (k *Kibitzer) winrates(gs game.GameState) [3]float32 {
+	var w [3]float32
+	if winner, terminal := gs.IsTerminal(); terminal {
+		if winner >= 0 {
+			w[winner] = 1
+		}
+		return w
+	}
+	a := k.analyze(gs)
+	for _, id := range gs.ActiveIDs() {
+		w[id] = a.Winrates[id]
+	}
+	return w
+}
+
+// wins reports whether e is a win for the player making it, proven or
+// nearly certain.
+func (e MoveEval) wins() bool {
+	return e.Outcome == ProvenWin || e.Outcome == Unproven && e.Winrate >= missedWinThreshold
+}
+
+// Comment returns brief commentary on move, played from before and leading
+// to after. It stops the background search of before, and starts one of
+// after.
+func (k *Kibitzer) Comment(g *SquavaGame, before, after game.GameState, move game.Move) []string {
+	k.Stop()
+	defer k.Watch(after)
+	mover := before.PlayerID
+	name := g.GetPlayer(mover).Name()
+	prev := k.analyze(before)
+	was := prev.Winrates[mover]
+	now := k.winrates(after)
+
+	var lines []string
+	if len(prev.Moves) > 0 && prev.Best != move {
+		best := prev.Moves[0]
+		played := now[mover] >= missedWinThreshold
+		for _, e := range prev.Moves {
+			if e.Move == prev.Best {
+				best = e
+			}
+			if e.Move == move && e.wins() {
+				played = true
+			}
+		}
+		switch {
+		case best.wins() && !played:
+			lines = append(lines, fmt.Sprintf("%s missed a win with %s.", name, best.Move))
+		case was-now[mover] >= BlunderThreshold:
+			lines = append(lines, fmt.Sprintf("%s is a blunder: %s's winrate falls from %.0f%% to %.0f%%; %s was better.",
+				game.FormatRecordMove(move), name, was*100, now[mover]*100, best.Move))
+		}
+	} else if len(prev.Moves) > 1 && move != game.ResignMove {
+		lines = append(lines, fmt.Sprintf("%s is the engine's choice too.", move))
+	}
+
+	for _, e := range prev.Moves {
+		if e.Move == move && e.Outcome != Unproven {
+			lines = append(lines, fmt.Sprintf("%s is a proven %s for %s.", move, e.Outcome, name))
+		}
+	}
+
+	var evals []string
+	for _, p := range g.players {
+		id := p.ID()
+		if after.ActiveMask&(1<<uint(id)) != 0 {
+			evals = append(evals, fmt.Sprintf("%s %.0f%%", p.Name(), now[id]*100))
+		}
+	}
+	if _, terminal := after.IsTerminal(); !terminal {
+		lines = append(lines, "Evaluation: "+strings.Join(evals, ", "))
+	}
+	return lines
+}
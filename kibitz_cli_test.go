@@ -0,0 +1,74 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"squava/game"
+)
+
+func TestKibitzerSpotsBlunder(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	for _, m := range []string{"A1", "A8", "H8", "B1", "B8", "G8"} {
+		mv, _ := game.ParseMove(m)
+		g.play(mv)
+	}
+	k := NewKibitzer(2000)
+	before := g.gs
+	c1, _ := game.ParseMove("C1")
+	g.play(c1)
+
+	rng := mainRand
+	lines := k.Comment(g, before, g.gs, c1)
+	if mainRand != rng {
+		t.Errorf("Kibitzer changed the random number stream")
+	}
+	if len(lines) == 0 || !strings.Contains(lines[0], "C1 is a blunder") {
+		t.Errorf("Expected C1 to be called a blunder, got %q", lines)
+	}
+}
+
+func TestKibitzerOtherWinIsNotMissed(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	before, err := game.ParsePosition("8/8/8/8/8/XX1X4/8/XX1X4 1 123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := NewKibitzer(2000)
+	c1, _ := game.ParseMove("C1")
+	c3, _ := game.ParseMove("C3")
+	move := c1
+	if k.analyze(before).Best == c1 {
+		move = c3
+	}
+	after := before
+	after.ApplyMove(move)
+	for _, line := range k.Comment(g, before, after, move) {
+		if strings.Contains(line, "missed a win") {
+			t.Errorf("%s wins too, got %q", move, line)
+		}
+	}
+	k.Stop()
+}
+
+func TestKibitzerWatch(t *testing.T) {
+	k := NewKibitzer(200)
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
+	k.Watch(gs)
+	deadline := time.Now().Add(10 * time.Second)
+	for k.analyzer.Analyze(gs, 1).Rollouts <= k.iterations {
+		if time.Now().After(deadline) {
+			t.Fatal("The background search did not go past one round")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	k.Stop()
+	n := k.analyzer.Analyze(gs, 1).Rollouts
+	time.Sleep(50 * time.Millisecond)
+	if m := k.analyzer.Analyze(gs, 1).Rollouts; m != n {
+		t.Errorf("The search went on after Stop: %d visits, then %d", n, m)
+	}
+}
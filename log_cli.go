@@ -0,0 +1,156 @@
+//go:build !wasm
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Logging ---
+
+// What commands report while they run, such as the engines' search
+// statistics, tournament progress and the coordinator's dealings with its
+// workers, goes through log/slog. The level picks how much of it is shown:
+//
+//	quiet  warnings and errors only
+//	info   progress and the engines' search summaries (the default)
+//	debug  every candidate move, leases, workers' games
+//	trace  every request between coordinator and workers
+//
+// The text format prints each message as a line, to stdout up to info and
+// to stderr from warnings up, as the commands always have. The json format
+// writes one object per message with its fields, for other programs.
+
+// LevelTrace is the level below slog.LevelDebug.
+const LevelTrace = slog.LevelDebug - 4
+
+// logLevels are the names of the levels for -log-level.
+var logLevels = map[string]slog.Level{
+	"quiet": slog.LevelWarn,
+	"info":  slog.LevelInfo,
+	"debug": slog.LevelDebug,
+	"trace": LevelTrace,
+}
+
+func init() {
+	slog.SetDefault(slog.New(newTextHandler(os.Stdout, os.Stderr, slog.LevelInfo, false)))
+}
+
+// logTrace logs a message at LevelTrace.
+func logTrace(msg string, args ...any) {
+	slog.Log(context.Background(), LevelTrace, msg, args...)
+}
+
+// logEnabled reports whether messages at level are logged.
+func logEnabled(level slog.Level) bool {
+	return slog.Default().Enabled(context.Background(), level)
+}
+
+// logFlags are the logging options of a command.
+type logFlags struct {
+	level, format, file *string
+}
+
+// addLogFlags defines the logging flags in fs.
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		level:  fs.String("log-level", "info", "How much to log: quiet, info, debug or trace"),
+		format: fs.String("log-format", "text", "Log as text lines or as json objects, one per line"),
+		file:   fs.String("log-file", "", "Append the log to this file instead of printing it"),
+	}
+}
+
+// start sets up the default logger as the flags ask and returns a function
+// that closes the log file, if any.
+func (l *logFlags) start() (stop func(), err error) {
+	level, ok := logLevels[*l.level]
+	if !ok {
+		return nil, fmt.Errorf("unknown log level %q; use quiet, info, debug or trace", *l.level)
+	}
+	if *l.format != "text" && *l.format != "json" {
+		return nil, fmt.Errorf("unknown log format %q; use text or json", *l.format)
+	}
+	out, errOut := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	stop = func() {}
+	if *l.file != "" {
+		f, err := os.OpenFile(*l.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open log file: %v", err)
+		}
+		out, errOut = f, f
+		stop = func() { f.Close() }
+	}
+	var h slog.Handler
+	if *l.format == "json" {
+		// Without a file, the objects go to stderr, apart from the output.
+		h = slog.NewJSONHandler(errOut, &slog.HandlerOptions{Level: level, ReplaceAttr: jsonAttr})
+	} else {
+		h = newTextHandler(out, errOut, level, *l.file != "")
+	}
+	slog.SetDefault(slog.New(h))
+	return stop, nil
+}
+
+// jsonAttr names LevelTrace TRACE rather than slog's DEBUG-4, and drops the
+// indentation that lays out messages as text.
+func jsonAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.LevelKey:
+		if level, ok := a.Value.Any().(slog.Level); ok && level == LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	case slog.MessageKey:
+		a.Value = slog.StringValue(strings.TrimSpace(a.Value.String()))
+	}
+	return a
+}
+
+// textHandler prints the message of each record as a line, leaving out its
+// fields, which the message already tells.
+type textHandler struct {
+	mu          *sync.Mutex
+	out, errOut io.Writer // Where messages below and from slog.LevelWarn go
+	level       slog.Leveler
+	stamp       bool // Start each line with the time and level, for log files
+}
+
+func newTextHandler(out, errOut io.Writer, level slog.Leveler, stamp bool) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, out: out, errOut: errOut, level: level, stamp: stamp}
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	line := r.Message + "\n"
+	if h.stamp {
+		level := r.Level.String()
+		if r.Level == LevelTrace {
+			level = "TRACE"
+		}
+		line = fmt.Sprintf("%s %-5s %s", r.Time.Format(time.DateTime+".000"), level, line)
+	}
+	w := h.out
+	if r.Level >= slog.LevelWarn {
+		w = h.errOut
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(w, line)
+	return err
+}
+
+func (h *textHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *textHandler) WithGroup(string) slog.Handler      { return h }
@@ -0,0 +1,61 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogFlags(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	path := filepath.Join(t.TempDir(), "squava.log")
+	for _, format := range []string{"text", "json"} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		logs := addLogFlags(fs)
+		if err := fs.Parse([]string{"-log-level", "debug", "-log-format", format, "-log-file", path}); err != nil {
+			t.Fatal(err)
+		}
+		stop, err := logs.start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		slog.Info("  Game 1 done", "game", 1)
+		slog.Debug("leased")
+		logTrace("request")
+		slog.Error("failed")
+		stop()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("got %d log lines, want 6 without the trace ones:\n%s", len(lines), data)
+	}
+	for i, want := range []string{"INFO    Game 1 done", "DEBUG leased", "ERROR failed"} {
+		if !strings.HasSuffix(lines[i], want) {
+			t.Errorf("text line %d = %q, want it to end in %q", i, lines[i], want)
+		}
+	}
+	var rec struct {
+		Level, Msg string
+		Game       int
+	}
+	if err := json.Unmarshal([]byte(lines[3]), &rec); err != nil || rec.Level != "INFO" || rec.Msg != "Game 1 done" || rec.Game != 1 {
+		t.Errorf("json line %q gives %+v, %v", lines[3], rec, err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	logs := addLogFlags(fs)
+	fs.Parse([]string{"-log-level", "loud"})
+	if _, err := logs.start(); err == nil {
+		t.Error("an unknown log level was accepted")
+	}
+}
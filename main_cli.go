@@ -6,51 +6,363 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"runtime/pprof"
+	"strconv"
 	"time"
+
+	"squava/game"
 )
 
+// subcommands are run as `squava <name> [args]`; without one, squava plays
+// a game configured by flags.
+var subcommands = map[string]func(args []string) int{
+	"analyze":    runAnalyze,
+	"annotate":   runAnnotate,
+	"arena":      runArena,
+	"balance":    runBalance,
+	"bench":      runBench,
+	"bestmove":   runBestMove,
+	"book":       runBook,
+	"convert":    runConvert,
+	"db":         runDB,
+	"eval":       runEval,
+	"gauntlet":   runGauntlet,
+	"graph":      runGraph,
+	"migrate":    runMigrate,
+	"perft":      runPerft,
+	"playouts":   runPlayouts,
+	"profile":    runProfile,
+	"puzzle":     runPuzzle,
+	"puzzlegen":  runPuzzleGen,
+	"ratings":    runRatings,
+	"render":     runRender,
+	"replay":     runReplay,
+	"results":    runResults,
+	"selfcheck":  runSelfCheck,
+	"selfplay":   runSelfPlay,
+	"suite":      runSuite,
+	"suitegen":   runSuiteGen,
+	"tournament": runTournament,
+	"traindata":  runTrainData,
+	"worker":     runWorker,
+}
+
 func main() {
-	p1Type := flag.String("p1", "human", "Player 1 type (human/mcts)")
-	p2Type := flag.String("p2", "human", "Player 2 type (human/mcts)")
-	p3Type := flag.String("p3", "human", "Player 3 type (human/mcts)")
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+	os.Exit(playGame())
+}
+
+// playGame plays one game configured by the command line flags and returns
+// the process exit code.
+func playGame() int {
+	p1Type := flag.String("p1", "human", "Player 1 type (human/mcts/mcts:<personality>)")
+	p2Type := flag.String("p2", "human", "Player 2 type (human/mcts/mcts:<personality>)")
+	p3Type := flag.String("p3", "human", "Player 3 type (human/mcts/mcts:<personality>)")
 	iterations := flag.Int("iterations", 1000, "MCTS iterations")
-	cpuProfile := flag.String("cpuprofile", "", "write cpu profile to file")
+	hintIterations := flag.Int("hint-iterations", 20000, "MCTS iterations for the hint command")
+	profile := addProfileFlags(flag.CommandLine)
+	logs := addLogFlags(flag.CommandLine)
 	seed := flag.Int64("seed", 0, "Random seed (0 for time-based)")
+	plain := flag.Bool("plain", false, "Plain ASCII board without colors or unicode stones")
+	checkMoves := flag.Int("check-moves", 0, "Check every human move in the background with this many MCTS iterations and tag it in the record as ok, inaccuracy or blunder (0 for no checks)")
+	coach := flag.Int("coach", 0, "Warn humans before a move that loses by force or misses a forced win within this many of the players' moves, and have them enter it again to play it (0 for no coach; 1 catches moves that lose at once, 2 or 3 look deeper)")
+	kibitz := flag.Bool("kibitz", false, "Have an engine comment on every move of a human-only game (uses -hint-iterations)")
+	compare := flag.Bool("compare", false, "Show the top moves and winrates of each engine configuration side by side after every engine move")
+	compareTop := flag.Int("compare-top", 5, "Candidate moves per engine shown by -compare")
+	treeDump := flag.String("tree-dump", "", "Export the search tree after every engine move to this file, as DOT if it ends in .dot or JSON otherwise; %d in the name becomes the move number")
+	treeDepth := flag.Int("tree-depth", 2, "Moves deep to export the search tree with -tree-dump")
+	treeMinVisits := flag.Int("tree-min-visits", 1, "Leave out moves with fewer visits from -tree-dump")
+	maxNodes := flag.Int("max-nodes", 0, "Cap each engine's search graph at this many nodes, recycling the least useful ones (0 for no cap)")
+	hashMB := flag.Int("hash-mb", 0, "Cap each engine's search graph at about this many megabytes (0 for no cap)")
+	treeAge := flag.Int("tree-age", 0, "Before each search, recycle the nodes of each engine's graph that its last N search positions no longer reach (needs -max-nodes or -hash-mb; 0 to keep them until the cap)")
+	ttMB := flag.Int("tt-mb", 0, "Size of the shared transposition table in megabytes (0 for the default of 96)")
+	threads := flag.String("threads", "1", "Threads each engine searches with, in separate graphs, one graph or on the same leaves as the position suits, or auto for one per CPU")
+	deterministic := flag.Bool("deterministic", false, "Split each engine's rollouts evenly among its threads, so that -seed and -threads fix its moves")
+	memoryStats := flag.Bool("memory-stats", false, "Report each engine's search graph size, arena memory and GC pauses after every move")
+	ttFile := flag.String("tt-file", "", "Start the engines from the search graph saved in this file, if any, and save it there after every move, for correspondence play")
+	ttMinVisits := flag.Int("tt-min-visits", DefaultTableMinVisits, "Leave nodes with fewer visits out of -tt-file")
+	bookPath := flag.String("book", "", "Have the engines play from this opening book while it has the position")
+	playoutStats := flag.Bool("playout-stats", false, "Record the engines' playouts and print their statistics when the game ends")
+	accessible := flag.Bool("accessible", false, "Describe the board, moves and threats in words for screen readers")
+	tui := flag.Bool("tui", false, "Full-screen terminal UI with cursor-based move selection")
+	kifu := flag.Bool("kifu", false, "Print a board with numbered stones when the game ends")
+	scriptFile := flag.String("script", "", "Read human moves from a file instead of prompting")
+	autosave := flag.String("autosave", "", "Rewrite the game record to this file after every move")
+	resume := flag.String("resume", "", "Resume the game saved in this file")
+	report := flag.String("report", "", "Write an HTML report with replay, evaluation graph and blunders when the game ends")
+	reportEngine := flag.String("report-engine", "", "Embed this WASM build of squava (make wasm) in -report to explore its positions with")
+	lang := flag.String("lang", "en", "Language of messages (en, zh, de)")
+	adaptive := flag.Bool("adaptive", false, "Have the engines play as strong as the profile's results against them call for, aiming at its target win rate (one human against two mcts engines)")
+	profileFlag := flag.String("profile", "", "Play as this user profile, using its preferences and keeping its rating against the engines (default: $SQUAVA_PROFILE or \"default\"); see squava profile")
 	flag.Parse()
 
-	if *cpuProfile != "" {
-		f, err := os.Create(*cpuProfile)
+	if err := SetLanguage(*lang); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	user, err := profileName(*profileFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	userProfile, err := LoadUserProfile(user)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read profile: %v\n", err)
+		return exitError
+	}
+	// The profile's preferences stand in for flags not given.
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if userProfile.Iterations > 0 && !given["iterations"] {
+		*iterations = userProfile.Iterations
+	}
+
+	var resumeRecord *game.GameRecord
+	if *resume != "" {
+		f, err := os.Open(*resume)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "could not create CPU profile: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "could not open saved game: %v\n", err)
+			return exitError
 		}
-		defer f.Close()
-		if err := pprof.StartCPUProfile(f); err != nil {
-			fmt.Fprintf(os.Stderr, "could not start CPU profile: %v\n", err)
-			os.Exit(1)
+		resumeRecord, err = game.ReadGameRecord(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read saved game %s: %v\n", *resume, err)
+			return exitError
+		}
+		// The saved player setup replaces the command line one.
+		*p1Type, *p2Type, *p3Type = resumeRecord.Players[0], resumeRecord.Players[1], resumeRecord.Players[2]
+		if resumeRecord.Iterations > 0 {
+			*iterations = resumeRecord.Iterations
+		}
+		if *autosave == "" {
+			*autosave = *resume
 		}
-		defer pprof.StopCPUProfile()
+	}
+
+	stopLog, err := logs.start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	defer stopLog()
+	stopProfiles, err := profile.start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer stopProfiles()
+	if *maxNodes < 0 || *hashMB < 0 || *maxNodes > 0 && *hashMB > 0 {
+		fmt.Fprintln(os.Stderr, "use one of -max-nodes and -hash-mb")
+		return exitUsage
+	}
+	if *ttMB < 0 {
+		fmt.Fprintln(os.Stderr, "-tt-mb must not be negative")
+		return exitUsage
+	}
+	nThreads := AutoThreads
+	if *threads != "auto" {
+		if n, err := strconv.Atoi(*threads); err == nil && n >= 1 {
+			nThreads = n
+		} else {
+			fmt.Fprintln(os.Stderr, "-threads must be at least 1, or auto")
+			return exitUsage
+		}
+	}
+	if *ttMB > 0 {
+		tt = NewTranspositionTableMB(*ttMB)
+	}
+	if *hashMB > 0 {
+		*maxNodes = NodesForMB(*hashMB)
+	}
+	if *maxNodes > 0 && *maxNodes < MinMaxNodes {
+		fmt.Fprintf(os.Stderr, "-max-nodes must be at least %d\n", MinMaxNodes)
+		return exitUsage
+	}
+	if *treeAge < 0 {
+		fmt.Fprintln(os.Stderr, "-tree-age must not be negative")
+		return exitUsage
+	}
+	if *treeAge > 0 && *maxNodes == 0 {
+		fmt.Fprintln(os.Stderr, "-tree-age needs -max-nodes or -hash-mb")
+		return exitUsage
 	}
 	if *seed == 0 {
-		xorState = uint64(time.Now().UnixNano())
+		mainRand.Seed(uint64(time.Now().UnixNano()))
 	} else {
-		xorState = uint64(*seed)
-	}
-	if xorState == 0 {
-		xorState = 1
+		mainRand.Seed(uint64(*seed))
 	}
 	game := NewSquavaGame()
-	createPlayer := func(t, name, symbol string, id int) Player {
-		if t == "mcts" {
-			p := NewMCTSPlayer(name, symbol, id, *iterations)
+	game.SetHintIterations(*hintIterations)
+	style := DefaultBoardStyle(*plain || *accessible)
+	style.Accessible = *accessible
+	if !*plain && !*accessible {
+		userProfile.ApplyStyle(&style)
+	}
+	game.SetBoardStyle(style)
+	game.SetShowKifu(*kifu)
+	game.SetIterations(*iterations)
+	game.SetAutosave(*autosave)
+	game.SetReport(*report)
+	if *reportEngine != "" {
+		wasm, err := LoadReportEngine(*reportEngine)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load %s: %v\n", *reportEngine, err)
+			return exitError
+		}
+		game.SetReportEngine(wasm)
+	}
+	if *ttFile != "" {
+		game.SetTableFile(*ttFile, *ttMinVisits)
+	}
+	if *treeDump != "" {
+		game.SetTreeDump(&TreeDump{Path: *treeDump, Depth: *treeDepth, MinVisits: *treeMinVisits})
+	}
+	if *coach < 0 || *coach > 3 {
+		fmt.Fprintln(os.Stderr, "-coach must be from 0 to 3")
+		return exitUsage
+	}
+	game.SetCoach(*coach)
+	if *checkMoves < 0 {
+		fmt.Fprintln(os.Stderr, "-check-moves must not be negative")
+		return exitUsage
+	}
+	if *checkMoves > 0 {
+		game.SetMoveChecker(NewMoveChecker(*checkMoves))
+	}
+	if *kibitz {
+		if *p1Type != "human" || *p2Type != "human" || *p3Type != "human" {
+			fmt.Fprintln(os.Stderr, "-kibitz needs all three players to be human")
+			return exitUsage
+		}
+		game.SetKibitzer(NewKibitzer(*hintIterations))
+	}
+	// Human moves come from a script when one is given or stdin is piped.
+	var script *MoveScript
+	if *scriptFile != "" {
+		f, err := os.Open(*scriptFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open script: %v\n", err)
+			return exitUsage
+		}
+		defer f.Close()
+		script = NewMoveScript(f, *scriptFile)
+	} else if !stdinIsTerminal() && !*tui {
+		script = NewMoveScript(stdin, "stdin")
+	}
+	// Scripted and engine-only games are non-interactive: they end with a
+	// RESULT line and an exit code telling the outcome.
+	var seats [3]SeatSpec
+	engineOnly := true
+	for i, t := range []string{*p1Type, *p2Type, *p3Type} {
+		spec, err := ParsePlayerType(t)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-p%d: %v\n", i+1, err)
+			return exitUsage
+		}
+		seats[i] = spec
+		engineOnly = engineOnly && spec.Kind != "human"
+	}
+	if *adaptive {
+		if _, _, ok := ratingOpponents(seats, *iterations); !ok {
+			fmt.Fprintln(os.Stderr, "-adaptive needs one human against two engines, e.g. -p2 mcts -p3 mcts")
+			return exitUsage
+		}
+		// A resumed game keeps the strength it was saved with.
+		if resumeRecord == nil {
+			history, err := ReadRatingHistory(user)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not read profile: %v\n", err)
+				return exitError
+			}
+			level := AdaptiveLevel(history)
+			if err := adaptiveSeats(&seats, level); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitUsage
+			}
+			fmt.Printf("Adaptive engines: level %.1f of %d (%s)\n", level, len(adaptivePresets), AdaptivePreset(level))
+		}
+	}
+	game.SetMachineResult(script != nil || engineOnly)
+	var book *Book
+	if *bookPath != "" {
+		if book, err = OpenBook(*bookPath); err != nil {
+			fmt.Fprintf(os.Stderr, "could not open book: %v\n", err)
+			return exitError
+		}
+		defer book.Close()
+	}
+	var playouts *PlayoutStats
+	if *playoutStats {
+		playouts = &PlayoutStats{}
+	}
+	createPlayer := func(name, symbol string, id int) Player {
+		switch seats[id].Kind {
+		case "cmd":
+			return NewExternalPlayer(name, symbol, id, seats[id].Command)
+		case "mcts":
+			n := *iterations
+			if seats[id].Iterations > 0 {
+				n = seats[id].Iterations
+			}
+			p := NewMCTSPlayer(name, symbol, id, n)
+			p.SetPersonality(seats[id].Personality)
+			p.SetMaxNodes(*maxNodes)
+			p.SetTreeAge(*treeAge)
 			p.Verbose = true
+			p.Playouts = playouts
+			p.SetThreads(nThreads, *deterministic)
+			p.MemoryStats = *memoryStats
+			p.Book = book
+			if stdoutIsTerminal() && !*tui {
+				p.OnProgress = PrintProgress
+			}
 			return p
 		}
+		if script != nil {
+			return NewScriptedPlayer(name, symbol, id, script)
+		}
 		return NewHumanPlayer(name, symbol, id)
 	}
-	game.AddPlayer(createPlayer(*p1Type, "Player 1", "X", 0))
-	game.AddPlayer(createPlayer(*p2Type, "Player 2", "O", 1))
-	game.AddPlayer(createPlayer(*p3Type, "Player 3", "Z", 2))
+	symbols := asciiStones
+	if style.Stones[0] != "" {
+		symbols = style.Stones
+	}
+	for i, symbol := range symbols {
+		game.AddPlayer(createPlayer(tr("player", i+1), symbol, i))
+	}
+	defer game.Close()
+	defer game.recoverCrash()
+	if *compare {
+		v := NewEngineViewer(game, *compareTop)
+		if v == nil {
+			fmt.Fprintln(os.Stderr, "-compare needs at least two engine configurations, e.g. -p1 mcts@1000 -p2 mcts@20000")
+			return exitUsage
+		}
+		game.SetViewer(v)
+	}
+	if resumeRecord != nil {
+		if err := game.Load(resumeRecord); err != nil {
+			fmt.Fprintf(os.Stderr, "could not resume %s: %v\n", *resume, err)
+			return exitError
+		}
+	}
+	if *tui {
+		if err := NewTUI(game).Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not start TUI: %v\n", err)
+			return exitError
+		}
+		recordProfileGame(game, userProfile, seats, *iterations, script != nil, *adaptive)
+		return 0
+	}
 	game.Run()
+	recordProfileGame(game, userProfile, seats, *iterations, script != nil, *adaptive)
+	if playouts != nil {
+		fmt.Println("Playout statistics:")
+		playouts.Print(os.Stdout)
+	}
+	return game.exitCode()
 }
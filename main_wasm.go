@@ -6,25 +6,38 @@ import (
 	"math/bits"
 	"strconv"
 	"syscall/js"
+	"time"
+
+	"squava/game"
 )
 
-var currentGS GameState
+var currentGS game.GameState
+
+// difficultyLevels maps each difficulty to the time an AI move should take on
+// the calibrated device. Budgets are derived from measured iterations/sec.
+var difficultyLevels = []struct {
+	name    string
+	seconds float64
+}{
+	{"easy", 0.2},
+	{"medium", 1.0},
+	{"hard", 3.0},
+}
+
+const minCalibratedIterations = 1000
 
 func newGame(this js.Value, args []js.Value) any {
 	if len(args) > 0 {
 		seedStr := args[0].String()
 		s, _ := strconv.ParseUint(seedStr, 10, 64)
-		if s == 0 {
-			s = 1
-		}
-		xorState = s
+		mainRand.Seed(s)
 	}
 	// Clear the transposition table to ensure a fresh MCTS search
 	tt.Clear()
 
-	board := Board{}
+	board := game.Board{}
 	activeMask := uint8(0x07) // All 3 players active
-	currentGS = NewGameState(board, 0, activeMask)
+	currentGS = game.NewGameState(board, 0, activeMask)
 	return js.ValueOf(strconv.FormatUint(currentGS.Hash, 10))
 }
 
@@ -33,26 +46,16 @@ func applyMove(this js.Value, args []js.Value) any {
 		return js.ValueOf(false)
 	}
 	idx := args[0].Int()
-	mask := Bitboard(1 << uint(idx))
-
-	if (currentGS.Board.Occupied & mask) != 0 {
+	if idx < 0 || idx >= 64 {
 		return js.ValueOf(false)
 	}
+	mask := game.Bitboard(1 << uint(idx))
 
-	activeIDs := currentGS.ActiveIDs()
-	var turnIdx int
-	for i, id := range activeIDs {
-		if id == currentGS.PlayerID {
-			turnIdx = i
-			break
-		}
-	}
-	forced := GetForcedMoves(currentGS.Board, activeIDs, turnIdx)
-	if forced != 0 && (forced&(Bitboard(1)<<uint(idx))) == 0 {
+	if (currentGS.LegalMoves() & mask) == 0 {
 		return js.ValueOf(false)
 	}
 
-	move := MoveFromIndex(idx)
+	move := game.MoveFromIndex(idx)
 	currentGS.ApplyMove(move)
 	return js.ValueOf(strconv.FormatUint(currentGS.Hash, 10))
 }
@@ -66,7 +69,7 @@ func getForcedMoves(this js.Value, args []js.Value) any {
 			break
 		}
 	}
-	forced := GetForcedMoves(currentGS.Board, activeIDs, turnIdx)
+	forced := game.GetForcedMoves(currentGS.Board, activeIDs, turnIdx)
 	return js.ValueOf(strconv.FormatUint(uint64(forced), 10))
 }
 
@@ -86,7 +89,7 @@ func getBestMove(this js.Value, args []js.Value) any {
 	}
 
 	// Fast path for forced moves
-	forced := GetForcedMoves(currentGS.Board, activeIDs, turnIdx)
+	forced := game.GetForcedMoves(currentGS.Board, activeIDs, turnIdx)
 	if forced != 0 && bits.OnesCount64(uint64(forced)) == 1 {
 		return js.ValueOf(bits.TrailingZeros64(uint64(forced)))
 	}
@@ -97,6 +100,48 @@ func getBestMove(this js.Value, args []js.Value) any {
 	return js.ValueOf(move.ToIndex())
 }
 
+// calibrate runs MCTS on an empty board for the given number of milliseconds
+// and returns the measured rate plus a recommended iteration budget for each
+// difficulty level, so slower devices get proportionally smaller searches.
+func calibrate(this js.Value, args []js.Value) any {
+	ms := 500
+	if len(args) > 0 {
+		ms = args[0].Int()
+	}
+	if ms <= 0 {
+		ms = 1
+	}
+	budget := time.Duration(ms) * time.Millisecond
+
+	gs := game.NewGameState(game.Board{}, 0, 0x07)
+	player := NewMCTSPlayer("Calibrate", "C", 0, 0)
+	rollouts := 0
+	start := time.Now()
+	for time.Since(start) < budget {
+		player.iterations += 1000
+		_, n := player.Search(gs)
+		rollouts += n
+	}
+	elapsed := time.Since(start).Seconds()
+	// The calibration tree is not part of any game, drop it.
+	tt.Clear()
+
+	ips := float64(rollouts) / elapsed
+	levels := js.Global().Get("Object").New()
+	for _, level := range difficultyLevels {
+		iterations := int(ips * level.seconds)
+		if iterations < minCalibratedIterations {
+			iterations = minCalibratedIterations
+		}
+		levels.Set(level.name, iterations)
+	}
+
+	res := js.Global().Get("Object").New()
+	res.Set("iterationsPerSecond", int(ips))
+	res.Set("levels", levels)
+	return res
+}
+
 func getBoard(this js.Value, args []js.Value) any {
 	p0 := strconv.FormatUint(uint64(currentGS.Board.P[0]), 10)
 	p1 := strconv.FormatUint(uint64(currentGS.Board.P[1]), 10)
@@ -110,16 +155,16 @@ func getBoard(this js.Value, args []js.Value) any {
 			break
 		}
 	}
-	forced := GetForcedMoves(currentGS.Board, activeIDs, turnIdx)
+	forced := game.GetForcedMoves(currentGS.Board, activeIDs, turnIdx)
 
 	winnerID, terminal := currentGS.IsTerminal()
 
-	var winningBits, losingBits Bitboard
+	var winningBits, losingBits game.Bitboard
 	for p := 0; p < 3; p++ {
 		isEliminated := (currentGS.ActiveMask & (1 << uint(p))) == 0
 		isWinner := terminal && winnerID == p
 		if isEliminated || isWinner {
-			w, l := GetWinsAndLosses(currentGS.Board.P[p], currentGS.Board.P[p])
+			w, l := game.GetWinsAndLosses(currentGS.Board.P[p], currentGS.Board.P[p])
 			if isWinner {
 				winningBits |= w
 			}
@@ -136,14 +181,95 @@ func getBoard(this js.Value, args []js.Value) any {
 	res.Set("playerID", currentGS.PlayerID)
 	res.Set("activeMask", int(currentGS.ActiveMask))
 	res.Set("forcedMoves", strconv.FormatUint(uint64(forced), 10))
+	res.Set("legalMoves", strconv.FormatUint(uint64(currentGS.LegalMoves()), 10))
 	res.Set("winningBits", strconv.FormatUint(uint64(winningBits), 10))
 	res.Set("losingBits", strconv.FormatUint(uint64(losingBits), 10))
 	res.Set("winnerID", winnerID)
 	res.Set("terminal", terminal)
 
+	// Near the end the solver proves the moves, and the page marks them
+	// apart from the engine's estimates.
+	proven, outcome, _ := ProveMoves(currentGS)
+	var provenBits [ProvenLoss + 1]game.Bitboard
+	for idx, o := range proven {
+		provenBits[o] |= game.Bitboard(1) << uint(idx)
+	}
+	res.Set("outcome", outcome.String())
+	res.Set("provenWins", strconv.FormatUint(uint64(provenBits[ProvenWin]), 10))
+	res.Set("provenDraws", strconv.FormatUint(uint64(provenBits[ProvenDraw]), 10))
+	res.Set("provenLosses", strconv.FormatUint(uint64(provenBits[ProvenLoss]), 10))
+
+	return res
+}
+
+// analyze searches the current position for the player to move and returns
+// its evaluation and its candidate moves, most visited first. Each move has
+// either a proven outcome or an estimated winrate; "outcome" is "unproven"
+// for the latter.
+func analyze(this js.Value, args []js.Value) any {
+	iterations := 10000
+	if len(args) > 0 {
+		iterations = args[0].Int()
+	}
+	a := Analyze(currentGS, iterations)
+
+	moves := js.Global().Get("Array").New()
+	for _, e := range a.Moves {
+		m := js.Global().Get("Object").New()
+		m.Set("idx", e.Move.ToIndex())
+		m.Set("move", e.Move.String())
+		m.Set("visits", e.Visits)
+		m.Set("winrate", float64(e.Winrate))
+		m.Set("outcome", e.Outcome.String())
+		m.Set("eval", e.Eval(1))
+		moves.Call("push", m)
+	}
+	res := js.Global().Get("Object").New()
+	res.Set("best", a.Best.ToIndex())
+	res.Set("outcome", a.Outcome.String())
+	res.Set("eval", a.Eval(1))
+	res.Set("moves", moves)
+	return res
+}
+
+// loadPuzzle makes a line of a puzzle file the current position. It returns
+// the moves that solve it and those to avoid as bitmask strings, or null if
+// the line cannot be read.
+func loadPuzzle(this js.Value, args []js.Value) any {
+	if len(args) < 1 {
+		return js.Null()
+	}
+	p, err := ParsePuzzle(args[0].String())
+	if err != nil {
+		return js.Null()
+	}
+	tt.Clear()
+	currentGS = p.Position
+
+	res := js.Global().Get("Object").New()
+	res.Set("win", p.IsWin())
+	res.Set("solutions", strconv.FormatUint(uint64(p.Solutions()), 10))
+	res.Set("avoid", strconv.FormatUint(uint64(p.Avoid), 10))
+	res.Set("depth", p.Depth)
+	res.Set("source", p.Source)
 	return res
 }
 
+// setPosition makes a position in the position notation the current one, as
+// game reports do to explore a position of the game. It returns false if the
+// line cannot be read.
+func setPosition(this js.Value, args []js.Value) any {
+	if len(args) < 1 {
+		return js.ValueOf(false)
+	}
+	gs, err := game.ParsePosition(args[0].String())
+	if err != nil {
+		return js.ValueOf(false)
+	}
+	tt.Clear()
+	currentGS = gs
+	return js.ValueOf(true)
+}
 
 func main() {
 	c := make(chan struct{}, 0)
@@ -153,5 +279,9 @@ func main() {
 	js.Global().Set("squavaGetBestMove", js.FuncOf(getBestMove))
 	js.Global().Set("squavaGetBoard", js.FuncOf(getBoard))
 	js.Global().Set("squavaGetForcedMoves", js.FuncOf(getForcedMoves))
+	js.Global().Set("squavaCalibrate", js.FuncOf(calibrate))
+	js.Global().Set("squavaLoadPuzzle", js.FuncOf(loadPuzzle))
+	js.Global().Set("squavaSetPosition", js.FuncOf(setPosition))
+	js.Global().Set("squavaAnalyze", js.FuncOf(analyze))
 	<-c
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// --- Message catalog ---
+
+// Catalog maps message keys to fmt format strings in one language.
+type Catalog map[string]string
+
+var enMessages = Catalog{
+	"player":               "Player %d",
+	"banner":               "Starting 3-Player Squava!",
+	"rules":                "Rules: 4-in-a-row wins. 3-in-a-row loses.",
+	"resuming":             "Resuming after %d moves.",
+	"move.header":          "Move %d: %s (%s)",
+	"thinking":             "%s is thinking...",
+	"prompt":               "%s (%s), enter your move (e.g., A1): ",
+	"forced.win":           "FORCED MOVE! You must take the win. Valid moves: %s",
+	"forced.block":         "FORCED MOVE! You must block the next player. Valid moves: %s",
+	"end.of.input":         "End of input.",
+	"err.bounds":           "Move out of bounds.",
+	"err.format":           "Invalid format. Use algebraic (A1), or type 'help'.",
+	"err.occupied":         "Cell already occupied.",
+	"err.forced":           "Invalid move. You must block the opponent or win immediately.",
+	"err.illegal":          "Invalid move. The rules of this game do not allow it.",
+	"took.back":            "Took back %d move(s).",
+	"nothing.to.undo":      "Nothing to undo.",
+	"result":               "Result: %s",
+	"result.draw":          "Draw",
+	"result.four":          "%s Wins (4-in-a-row)",
+	"result.last":          "%s Wins (Last Standing)",
+	"exit.resigned":        "%s Resigned",
+	"exit.eliminated":      "%s Eliminated (3-in-a-row)",
+	"time":                 "Time: %s (total %s)",
+	"time.used":            "Time used:",
+	"time.player":          "  %s (%s): %s over %d moves, %s per move",
+	"help.header":          "Enter a move (e.g., A1) or one of these commands:",
+	"coach.warning":        "Coach: %s",
+	"coach.confirm":        "Enter %s again to play it anyway, or choose another move.",
+	"coach.again":          "Press enter again to play it anyway.",
+	"seed":                 "Random Seed: %d",
+	"board.size":           "Board Size: %dx%d",
+	"forced":               "FORCED MOVE! Valid moves: %s",
+	"hint":                 "Hint: %s (%s)",
+	"hint.why":             "  This move %s.",
+	"why.wins":             "completes 4-in-a-row and wins",
+	"why.blocks":           "blocks %s's 4-in-a-row",
+	"why.eliminated":       "makes 3-in-a-row and is eliminated",
+	"why.threatens":        "threatens 4-in-a-row at %s",
+	"forced.why.win":       "%s wins: completes your line %s",
+	"forced.why.block":     "%s blocks: %s threatens %s",
+	"forced.why.block.own": "%s blocks: %s threatens %s (but makes your own 3-in-a-row)",
+	"forced.why.double":    "%s has more than one winning square; you can block only one of them.",
+	"coach.eliminates":     "%s makes a 3-in-a-row, which eliminates you; %s",
+	"coach.misses":         "%s misses a forced win with %s.",
+	"coach.loses":          "%s loses by force; %s",
+	"coach.safe":           "%s is safe.",
+	"coach.safe.many":      "%s are safe.",
+	"help.hint":            "Suggest a move using a short engine search",
+	"help.undo":            "Take back your last move and the moves after it",
+	"help.board":           "Show the board again",
+	"help.threats":         "Show each player's winning and losing squares on the board",
+	"help.save":            "Save the game record to a file",
+	"help.history":         "List the moves played so far",
+	"help.kifu":            "Show the board with stones numbered by move",
+	"help.resign":          "Resign from the game",
+	"help.help":            "Show this list of commands",
+	"squares.more":         "%s and others",
+}
+
+var zhMessages = Catalog{
+	"player":               "玩家%d",
+	"banner":               "三人 Squava 开始！",
+	"rules":                "规则：四子连线获胜，三子连线出局。",
+	"resuming":             "从第 %d 手之后继续。",
+	"move.header":          "第 %d 手：%s（%s）",
+	"thinking":             "%s 正在思考……",
+	"prompt":               "%s（%s），请输入落子（例如 A1）：",
+	"forced.win":           "强制落子！你必须取胜。可选位置：%s",
+	"forced.block":         "强制落子！你必须阻挡下一位玩家。可选位置：%s",
+	"end.of.input":         "输入结束。",
+	"err.bounds":           "落子超出棋盘。",
+	"err.format":           "格式无效。请使用坐标（A1），或输入 help。",
+	"err.occupied":         "该位置已有棋子。",
+	"err.forced":           "无效落子。你必须阻挡对手或立即取胜。",
+	"err.illegal":          "无效落子。本局规则不允许这步棋。",
+	"took.back":            "悔棋 %d 手。",
+	"nothing.to.undo":      "没有可悔的棋。",
+	"result":               "结果：%s",
+	"result.draw":          "和棋",
+	"result.four":          "%s 获胜（四子连线）",
+	"result.last":          "%s 获胜（最后幸存）",
+	"exit.resigned":        "%s 认输",
+	"exit.eliminated":      "%s 出局（三子连线）",
+	"time":                 "用时：%s（累计 %s）",
+	"time.used":            "用时统计：",
+	"time.player":          "  %s（%s）：%s，共 %d 手，每手 %s",
+	"help.header":          "输入落子（例如 A1）或以下命令：",
+	"coach.warning":        "教练：%s",
+	"coach.confirm":        "再次输入 %s 以坚持落子，或选择其他位置。",
+	"coach.again":          "再按回车以坚持落子。",
+	"seed":                 "随机种子：%d",
+	"board.size":           "棋盘大小：%dx%d",
+	"forced":               "强制落子！可选位置：%s",
+	"hint":                 "提示：%s（%s）",
+	"hint.why":             "  这步棋%s。",
+	"why.wins":             "连成四子并获胜",
+	"why.blocks":           "阻挡%s的四子连线",
+	"why.eliminated":       "连成三子而出局",
+	"why.threatens":        "威胁在 %s 连成四子",
+	"forced.why.win":       "%s 获胜：补全你的连线 %s",
+	"forced.why.block":     "%s 阻挡：%s 威胁 %s",
+	"forced.why.block.own": "%s 阻挡：%s 威胁 %s（但会让你自己连成三子）",
+	"forced.why.double":    "%s 有不止一个获胜位置；你只能阻挡其中一个。",
+	"coach.eliminates":     "%s 会连成三子，使你出局；%s",
+	"coach.misses":         "%s 错过了用 %s 的必胜。",
+	"coach.loses":          "%s 必败；%s",
+	"coach.safe":           "%s 是安全的。",
+	"coach.safe.many":      "%s 是安全的。",
+	"help.hint":            "用简短的引擎搜索推荐一步棋",
+	"help.undo":            "悔回你的上一步及其后的所有着法",
+	"help.board":           "再次显示棋盘",
+	"help.threats":         "在棋盘上显示每位玩家的获胜和出局位置",
+	"help.save":            "将棋谱保存到文件",
+	"help.history":         "列出目前为止的着法",
+	"help.kifu":            "显示按落子顺序编号的棋盘",
+	"help.resign":          "认输",
+	"help.help":            "显示此命令列表",
+	"squares.more":         "%s 等",
+}
+
+var deMessages = Catalog{
+	"player":               "Spieler %d",
+	"banner":               "3-Spieler-Squava startet!",
+	"rules":                "Regeln: 4 in einer Reihe gewinnt. 3 in einer Reihe verliert.",
+	"resuming":             "Fortsetzung nach %d Zügen.",
+	"move.header":          "Zug %d: %s (%s)",
+	"thinking":             "%s denkt nach...",
+	"prompt":               "%s (%s), gib deinen Zug ein (z. B. A1): ",
+	"forced.win":           "ZUGZWANG! Du musst den Gewinnzug spielen. Gültige Züge: %s",
+	"forced.block":         "ZUGZWANG! Du musst den nächsten Spieler blockieren. Gültige Züge: %s",
+	"end.of.input":         "Ende der Eingabe.",
+	"err.bounds":           "Zug außerhalb des Bretts.",
+	"err.format":           "Ungültiges Format. Verwende Koordinaten (A1) oder gib 'help' ein.",
+	"err.occupied":         "Feld ist bereits besetzt.",
+	"err.forced":           "Ungültiger Zug. Du musst den Gegner blockieren oder sofort gewinnen.",
+	"err.illegal":          "Ungültiger Zug. Die Regeln dieses Spiels erlauben ihn nicht.",
+	"took.back":            "%d Zug/Züge zurückgenommen.",
+	"nothing.to.undo":      "Nichts zurückzunehmen.",
+	"result":               "Ergebnis: %s",
+	"result.draw":          "Unentschieden",
+	"result.four":          "%s gewinnt (4 in einer Reihe)",
+	"result.last":          "%s gewinnt (als Letzter übrig)",
+	"exit.resigned":        "%s gibt auf",
+	"exit.eliminated":      "%s ist ausgeschieden (3 in einer Reihe)",
+	"time":                 "Zeit: %s (gesamt %s)",
+	"time.used":            "Verbrauchte Zeit:",
+	"time.player":          "  %s (%s): %s für %d Züge, %s pro Zug",
+	"help.header":          "Gib einen Zug ein (z. B. A1) oder einen dieser Befehle:",
+	"coach.warning":        "Trainer: %s",
+	"coach.confirm":        "Gib %s noch einmal ein, um ihn trotzdem zu spielen, oder wähle einen anderen Zug.",
+	"coach.again":          "Drücke noch einmal Enter, um ihn trotzdem zu spielen.",
+	"seed":                 "Zufallsstartwert: %d",
+	"board.size":           "Brettgröße: %dx%d",
+	"forced":               "ZUGZWANG! Gültige Züge: %s",
+	"hint":                 "Tipp: %s (%s)",
+	"hint.why":             "  Dieser Zug %s.",
+	"why.wins":             "vervollständigt 4 in einer Reihe und gewinnt",
+	"why.blocks":           "blockiert die 4 in einer Reihe von %s",
+	"why.eliminated":       "bildet 3 in einer Reihe und scheidet aus",
+	"why.threatens":        "droht 4 in einer Reihe auf %s",
+	"forced.why.win":       "%s gewinnt: vervollständigt deine Reihe %s",
+	"forced.why.block":     "%s blockiert: %s droht %s",
+	"forced.why.block.own": "%s blockiert: %s droht %s (bildet aber deine eigenen 3 in einer Reihe)",
+	"forced.why.double":    "%s hat mehr als ein Gewinnfeld; du kannst nur eines davon blockieren.",
+	"coach.eliminates":     "%s bildet 3 in einer Reihe, womit du ausscheidest; %s",
+	"coach.misses":         "%s verpasst einen erzwungenen Gewinn mit %s.",
+	"coach.loses":          "%s verliert erzwungen; %s",
+	"coach.safe":           "%s ist sicher.",
+	"coach.safe.many":      "%s sind sicher.",
+	"help.hint":            "Einen Zug mit einer kurzen Engine-Suche vorschlagen",
+	"help.undo":            "Deinen letzten Zug und die Züge danach zurücknehmen",
+	"help.board":           "Das Brett erneut anzeigen",
+	"help.threats":         "Die Gewinn- und Verlustfelder jedes Spielers auf dem Brett anzeigen",
+	"help.save":            "Die Partie in einer Datei speichern",
+	"help.history":         "Die bisherigen Züge auflisten",
+	"help.kifu":            "Das Brett mit nach Zug nummerierten Steinen anzeigen",
+	"help.resign":          "Die Partie aufgeben",
+	"help.help":            "Diese Befehlsliste anzeigen",
+	"squares.more":         "%s und weitere",
+}
+
+var catalogs = map[string]Catalog{
+	"en": enMessages,
+	"zh": zhMessages,
+	"de": deMessages,
+}
+
+// messages is the catalog used for output; see SetLanguage.
+var messages = enMessages
+
+// SetLanguage selects the catalog for user-facing messages.
+func SetLanguage(lang string) error {
+	c, ok := catalogs[strings.ToLower(lang)]
+	if !ok {
+		names := make([]string, 0, len(catalogs))
+		for name := range catalogs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown language %q (available: %s)", lang, strings.Join(names, ", "))
+	}
+	messages = c
+	return nil
+}
+
+// format looks up key, falling back to English for untranslated messages.
+func (c Catalog) format(key string, args ...any) string {
+	f, ok := c[key]
+	if !ok {
+		f = enMessages[key]
+	}
+	return fmt.Sprintf(f, args...)
+}
+
+// tr formats a message in the current language.
+func tr(key string, args ...any) string {
+	return messages.format(key, args...)
+}
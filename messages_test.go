@@ -0,0 +1,45 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestCatalogsMatchEnglish(t *testing.T) {
+	for lang, c := range catalogs {
+		for key, en := range enMessages {
+			msg, ok := c[key]
+			if !ok {
+				t.Errorf("%s: missing %q", lang, key)
+				continue
+			}
+			if strings.Count(msg, "%") != strings.Count(en, "%") {
+				t.Errorf("%s: %q has different arguments than English: %q", lang, key, msg)
+			}
+		}
+	}
+	defer SetLanguage("en")
+	if err := SetLanguage("DE"); err != nil || tr("player", 2) != "Spieler 2" {
+		t.Errorf("SetLanguage(DE): %v, %q", err, tr("player", 2))
+	}
+	if err := SetLanguage("xx"); err == nil {
+		t.Errorf("Expected an error for an unknown language")
+	}
+	for _, cmd := range shellCommands {
+		if _, ok := enMessages[cmd.help]; !ok {
+			t.Errorf("%s: no message %q", cmd.name, cmd.help)
+		}
+	}
+
+	// The reasons for forced moves are in the player's language too.
+	SetLanguage("de")
+	gs := game.NewGameState(game.Board{P: [3]game.Bitboard{0, 0b111}}, 0, 0x07)
+	reasons := ExplainForcedMoves(gs)
+	if len(reasons) == 0 || reasons[0] != "D1 blockiert: Spieler 2 droht A1-B1-C1-D1" {
+		t.Errorf("ExplainForcedMoves in German: %q", reasons)
+	}
+}
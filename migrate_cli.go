@@ -0,0 +1,137 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"squava/game"
+)
+
+// runMigrate implements `squava migrate`, rewriting saved files in the
+// current version of their format.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	check := fs.Bool("check", false, "Only list the files in an earlier version, exiting with 1 if there are any")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava migrate [-check] game.sqv|puzzles.sqp|book.sqb|table.sqt|games.db|dir...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	files, err := recordPaths(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	stale := 0
+	for _, path := range files {
+		from, to, err := migrateFile(path, *check)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return exitError
+		}
+		switch {
+		case from == to:
+			fmt.Printf("%s: version %d, up to date\n", path, from)
+		case *check:
+			fmt.Printf("%s: version %d, current is %d\n", path, from, to)
+			stale++
+		default:
+			fmt.Printf("%s: version %d, migrated to %d\n", path, from, to)
+		}
+	}
+	if stale > 0 {
+		return exitError
+	}
+	return 0
+}
+
+// migrateFile rewrites the file at path in the current version of its
+// format, unless it is in it already or dryRun is set. The format is told
+// by the extension. It returns the version the file was in and the current
+// one.
+func migrateFile(path string, dryRun bool) (from, to int, err error) {
+	if strings.EqualFold(filepath.Ext(path), ".db") {
+		db, err := game.OpenGameDB(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		if db.Version == game.DBVersion || dryRun {
+			return db.Version, game.DBVersion, nil
+		}
+		return db.Version, game.DBVersion, db.Save()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var out []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".sqv":
+		from, to, out, err = migrateRecord(data)
+	case ".sqp":
+		from, to, out, err = migratePuzzles(data)
+	case ".sqb":
+		// Books and tables have had one version so far.
+		_, err = ParseBook(data)
+		from, to = BookVersion, BookVersion
+	case ".sqt":
+		_, err = LoadTable(bytes.NewReader(data), nil)
+		from, to = TableVersion, TableVersion
+	default:
+		return 0, 0, fmt.Errorf("unknown format; migrate takes .sqv, .sqp, .sqb, .sqt and .db files")
+	}
+	if err != nil || from == to || dryRun {
+		return from, to, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o644); err != nil {
+		return 0, 0, err
+	}
+	return from, to, os.Rename(tmp, path)
+}
+
+// migrateRecord returns the version of a game record and the record
+// written in the current version.
+func migrateRecord(data []byte) (from, to int, out []byte, err error) {
+	rec, err := game.ReadGameRecord(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	var buf bytes.Buffer
+	if err := rec.Write(&buf); err != nil {
+		return 0, 0, nil, err
+	}
+	return rec.Version, game.RecordVersion, buf.Bytes(), nil
+}
+
+// migratePuzzles returns the version of a puzzle file and the file in the
+// current version. Version 0 had no header; the puzzles and comments are
+// kept as they are.
+func migratePuzzles(data []byte) (from, to int, out []byte, err error) {
+	_, from, err = readPuzzles(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	var buf bytes.Buffer
+	WritePuzzleHeader(&buf)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if !strings.HasPrefix(strings.TrimSpace(sc.Text()), puzzleHeader) {
+			buf.WriteString(sc.Text() + "\n")
+		}
+	}
+	return from, PuzzleVersion, buf.Bytes(), sc.Err()
+}
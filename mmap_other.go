@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// mapFile reads the file at path whole, where files cannot be mapped into
+// memory.
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
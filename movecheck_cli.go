@@ -0,0 +1,99 @@
+//go:build !wasm
+
+package main
+
+import (
+	"sync"
+
+	"squava/game"
+)
+
+// --- Move checks ---
+
+// MoveChecker checks moves in the background with one Analyzer, so that
+// play does not wait for the checks and the game record can carry their
+// verdicts. It never touches the game's random number stream.
+type MoveChecker struct {
+	iterations int
+	analyzer   *Analyzer
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	queue      []pendingCheck    // Waiting, in the order they were played
+	running    bool              // Whether a goroutine is working through queue
+	checks     map[int]moveCheck // By ply
+}
+
+// pendingCheck is a move waiting to be checked.
+type pendingCheck struct {
+	ply    int
+	before game.GameState
+	move   game.Move
+}
+
+// moveCheck is the verdict on the move played from the position with hash.
+type moveCheck struct {
+	hash    uint64
+	move    game.Move
+	verdict string
+}
+
+func NewMoveChecker(iterations int) *MoveChecker {
+	return &MoveChecker{iterations: iterations, analyzer: NewAnalyzer(0), checks: map[int]moveCheck{}}
+}
+
+// Check queues move, played from before as the ply-th move of the game,
+// counting from 0, to be checked.
+func (c *MoveChecker) Check(ply int, before game.GameState, move game.Move) {
+	c.wg.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queue = append(c.queue, pendingCheck{ply, before, move})
+	if !c.running {
+		c.running = true
+		go c.work()
+	}
+}
+
+// work checks the queued moves one at a time, in the order they were
+// played. The Analyzer's answers depend on what it searched before, so
+// checks running side by side could get different verdicts from run to
+// run.
+func (c *MoveChecker) work() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.queue) > 0 {
+		p := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+		verdict := CheckMove(p.before, c.analyzer.Analyze(p.before, c.iterations), p.move)
+		c.mu.Lock()
+		c.checks[p.ply] = moveCheck{p.before.Hash, p.move, verdict}
+		c.wg.Done()
+	}
+	c.running = false
+}
+
+// Verdict returns the verdict on move, played from before as the ply-th
+// move, or "" if its check has not finished. A check of a move that was
+// taken back and replaced does not count for the new one.
+func (c *MoveChecker) Verdict(ply int, before game.GameState, move game.Move) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if mc, ok := c.checks[ply]; ok && mc.hash == before.Hash && mc.move == move {
+		return mc.verdict
+	}
+	return ""
+}
+
+// Wait waits for the checks started so far to finish.
+func (c *MoveChecker) Wait() {
+	c.wg.Wait()
+}
+
+// checkMove hands the move just played, from before, to the game's move
+// checker if a human played it.
+func (g *SquavaGame) checkMove(before game.GameState, move game.Move) {
+	if g.checker != nil && move != game.ResignMove && g.playerType(g.GetPlayer(before.PlayerID)) == "human" {
+		g.checker.Check(len(g.moves)-1, before, move)
+	}
+}
@@ -0,0 +1,59 @@
+//go:build !wasm
+
+package main
+
+import (
+	"testing"
+
+	"squava/game"
+)
+
+func TestMoveChecker(t *testing.T) {
+	// C1 makes a 3-in-a-row that eliminates X, a blunder, while the
+	// engine's choice is fine.
+	gs, err := game.ParsePosition("8/8/8/3ZO3/8/8/8/XX6 1 123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Analyze(gs, 2000)
+	c1, _ := game.ParseMove("C1")
+	if v := CheckMove(gs, a, c1); v != game.CheckBlunder {
+		t.Errorf("Expected C1 to be a blunder, got %q", v)
+	}
+	if v := CheckMove(gs, a, a.Best); v != game.CheckOK {
+		t.Errorf("Expected the engine's %s to be ok, got %q", a.Best, v)
+	}
+
+	// Human moves of a game are checked in the background, and a move taken
+	// back does not pass its verdict on to the move that replaces it.
+	g, _ := loadRecord(&game.GameRecord{}, true)
+	g.SetMoveChecker(NewMoveChecker(200))
+	for _, sq := range []string{"D4", "E5", "C3"} {
+		m, _ := game.ParseMove(sq)
+		before := g.gs
+		g.play(m)
+		g.checkMove(before, m)
+	}
+	g.checker.Wait()
+	// The checks ran one after another in the order of play, so one
+	// Analyzer doing the same gives the same verdicts.
+	a2 := NewAnalyzer(0)
+	for ply, mv := range g.moves {
+		before := g.history[ply]
+		if want := CheckMove(before, a2.Analyze(before, 200), mv); g.checker.Verdict(ply, before, mv) != want {
+			t.Errorf("Move %d: checked as %q, want %q", ply+1, g.checker.Verdict(ply, before, mv), want)
+		}
+	}
+	g.undo(2)
+	m, _ := game.ParseMove("F6")
+	g.play(m)
+	r := g.Record()
+	for i := 0; i < 2; i++ {
+		if v := r.Check(i); v != game.CheckOK && v != game.CheckInaccuracy && v != game.CheckBlunder {
+			t.Errorf("Move %d: unexpected check %q", i+1, v)
+		}
+	}
+	if v := r.Check(2); v != "" {
+		t.Errorf("Expected no check of the replaced move, got %q", v)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"runtime"
+	"time"
+	"unsafe"
+
+	"squava/game"
+)
+
+// --- Node pool ---
+
+// MinMaxNodes is the smallest node limit an engine accepts: enough for the
+// root, its children and room to search below them.
+const MinMaxNodes = 1024
+
+// NodesForMB returns about how many search nodes fit in mb megabytes,
+// counting each node with the edge storage of a typical node.
+func NodesForMB(mb int) int {
+	perNode := int(unsafe.Sizeof(MCGSNode{})) + 8*int(unsafe.Sizeof(MCGSEdge{})+8)
+	return mb << 20 / perNode
+}
+
+// SetMaxNodes caps the nodes the player's search graph may hold, or lifts
+// the cap with 0. When a search reaches the cap, the nodes it no longer
+// reaches from its root are recycled, and if the rest still fills more than
+// half the cap, the least visited subtrees below the root are cut. A capped
+// player has a private transposition table, since the nodes it recycles must
+// not be reachable from other players' graphs.
+func (m *MCTSPlayer) SetMaxNodes(n int) {
+	if n > 0 {
+		n = max(n, MinMaxNodes)
+	}
+	m.arena = nodeArena{limit: n}
+	m.root = nil
+	m.recentRoots = nil
+	m.resetTable()
+}
+
+// full reports whether the arena has a limit and no node left to hand out.
+func (a *nodeArena) full() bool {
+	return a.limit > 0 && len(a.free) == 0 && a.handed >= a.limit
+}
+
+// reachable returns the nodes of the graphs below roots.
+func reachable(roots ...*MCGSNode) map[*MCGSNode]bool {
+	seen := map[*MCGSNode]bool{}
+	var stack []*MCGSNode
+	for _, root := range roots {
+		if !seen[root] {
+			seen[root] = true
+			stack = append(stack, root)
+		}
+	}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for i := range n.Edges {
+			if d := n.Edges[i].Dest; !seen[d] {
+				seen[d] = true
+				stack = append(stack, d)
+			}
+		}
+	}
+	return seen
+}
+
+// cutEdges removes the edges with fewer than threshold visits. Their moves
+// go back among the untried ones, to be expanded afresh if the search
+// returns to them; the node's own statistics are kept.
+func (n *MCGSNode) cutEdges(threshold int32) {
+	k := 0
+	for i := range n.Edges {
+		if n.Edges[i].N >= threshold {
+			n.Edges[k], n.EdgeQs[k], n.EdgeUs[k] = n.Edges[i], n.EdgeQs[i], n.EdgeUs[i]
+			k++
+		} else {
+			n.untriedMoves |= game.Bitboard(1) << uint(n.Edges[i].Move.ToIndex())
+		}
+	}
+	clear(n.Edges[k:])
+	n.Edges, n.EdgeQs, n.EdgeUs = n.Edges[:k], n.EdgeQs[:k], n.EdgeUs[:k]
+}
+
+// prune frees the nodes of m's arena that the search from root does not
+// reach. If more than half the limit is reached, it first cuts the edges
+// below the root with the fewest visits, doubling the visits needed to stay
+// until enough is cut. The root's own edges are kept so that every move it
+// has tried still competes for the choice.
+func (m *MCTSPlayer) prune(root *MCGSNode) {
+	a := &m.arena
+	a.peak = max(a.peak, m.NodeCount())
+	reach := reachable(root)
+	for threshold := int32(2); len(reach) > a.limit/2; threshold *= 2 {
+		for n := range reach {
+			if n != root {
+				n.cutEdges(threshold)
+			}
+		}
+		reach = reachable(root)
+	}
+	// The cap comes first: the graphs of earlier roots go now.
+	if m.treeAge > 0 {
+		m.recentRoots = append(m.recentRoots[:0], root)
+	}
+	m.recycle(reach)
+}
+
+// recycle frees the nodes of m's arena that are not in reach, removing them
+// from m's table.
+func (m *MCTSPlayer) recycle(reach map[*MCGSNode]bool) {
+	a := &m.arena
+	a.free = a.free[:0]
+	for i, b := range a.blocks {
+		if i == len(a.blocks)-1 {
+			b = b[:len(b)-len(a.nodes)]
+		}
+		for j := range b {
+			if n := &b[j]; !reach[n] {
+				m.table.Remove(n)
+				a.free = append(a.free, n)
+			}
+		}
+	}
+}
+
+// SetTreeAge makes a capped player recycle, before each search, the nodes
+// that neither the search's root nor the roots of its last n-1 searches
+// reach, rather than keeping them until the graph is full, and removes them
+// from its table. A game only moves forward, so a graph the current root no
+// longer reaches is of use only if an earlier position comes back, by an
+// undo or a new game, and n sets how far back that may be. 0 keeps the
+// nodes until the cap needs them.
+func (m *MCTSPlayer) SetTreeAge(n int) {
+	m.treeAge = max(n, 0)
+	m.recentRoots = nil
+}
+
+// ageTree records root as the latest search's root and recycles the nodes
+// that m's last treeAge roots no longer reach.
+func (m *MCTSPlayer) ageTree(root *MCGSNode) {
+	if k := len(m.recentRoots); k > 0 && m.recentRoots[k-1] == root {
+		return
+	}
+	m.recentRoots = append(m.recentRoots, root)
+	if k := len(m.recentRoots); k > m.treeAge {
+		m.recentRoots = append(m.recentRoots[:0], m.recentRoots[k-m.treeAge:]...)
+	}
+	m.arena.peak = max(m.arena.peak, m.NodeCount())
+	m.recycle(reachable(m.recentRoots...))
+}
+
+// NodeCount returns how many nodes the player has allocated and not
+// recycled.
+func (m *MCTSPlayer) NodeCount() int {
+	return m.arena.handed - len(m.arena.free)
+}
+
+// SearchMemory is the memory use of a search, with all its threads.
+type SearchMemory struct {
+	Nodes      int   // In the search graph at the end
+	PeakNodes  int   // In the search graph at once, at most
+	ArenaBytes int64 // Taken by the arena for nodes and edges, in all
+	GCs        int   // Garbage collections during the search
+	GCPause    time.Duration
+}
+
+// measureSearch is Search, recording its memory use in m.memory. Reading
+// the runtime's statistics stops the world, so searches are only measured
+// on request.
+func (m *MCTSPlayer) measureSearch(gs game.GameState) (int, int) {
+	workers := append([]*MCTSPlayer{m}, m.helpers...)
+	for _, w := range workers {
+		w.arena.peak = 0
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	totalSteps, rollouts := m.Search(gs)
+	runtime.ReadMemStats(&after)
+
+	mem := SearchMemory{
+		GCs:     int(after.NumGC - before.NumGC),
+		GCPause: time.Duration(after.PauseTotalNs - before.PauseTotalNs),
+	}
+	for _, w := range workers {
+		mem.Nodes += w.NodeCount()
+		mem.PeakNodes += max(w.arena.peak, w.NodeCount())
+		mem.ArenaBytes += w.arena.bytes
+	}
+	m.memory = mem
+	return totalSteps, rollouts
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"squava/game"
+)
+
+// --- Parallel search ---
+
+// A parallel search runs its threads in one of three ways, which schedule
+// picks for each search from the position:
+//
+//   - Root parallelism: each thread searches the position in a graph of its
+//     own, with a private transposition table and a stream split from the
+//     player's, and the threads' root statistics are summed to choose the
+//     move. The first thread is the player itself, in the player's usual
+//     table. Each thread takes rollouts from a share of its own, and steals
+//     from the others' when it runs out.
+//   - Tree parallelism: the threads share the player's graph. Selection,
+//     expansion and backpropagation hold a lock, and the playouts, where a
+//     rollout spends most of its time, run in parallel. A thread puts a
+//     virtual loss on the edges it takes until its result is backed up, so
+//     that the other threads try other moves meanwhile.
+//   - Leaf parallelism: the player selects and expands alone, and every
+//     thread plays out the same leaf with a stream of its own. Each playout
+//     is backed up as a visit of its own.
+
+// Ways to search in parallel.
+const (
+	parallelRoot = iota
+	parallelTree
+	parallelLeaf
+)
+
+var parallelNames = [...]string{parallelRoot: "root", parallelTree: "tree", parallelLeaf: "leaf"}
+
+// AutoThreads, given to SetThreads, picks the threads for every search: one
+// per CPU the Go runtime may use, or just one when the move is forced.
+const AutoThreads = -1
+
+// SetThreads makes the player search with n threads, with one for n <= 1,
+// or as AutoThreads decides. How the threads search is chosen for each
+// position, see schedule. Deterministic searches always use root
+// parallelism, with an even share of the rollouts for each thread, and
+// merge the threads' statistics in thread order, so that a seed and thread
+// count always give the same result, at the cost of waiting for the slowest
+// thread. Otherwise a thread that finishes its share steals from the
+// others, so the result depends on the scheduling.
+func (m *MCTSPlayer) SetThreads(n int, deterministic bool) {
+	m.autoThreads = n == AutoThreads
+	m.helpers = m.helpers[:0]
+	for i := 1; i < n; i++ {
+		m.addHelper()
+	}
+	m.deterministic = deterministic
+	m.merged = nil
+}
+
+// addHelper adds a thread to m's root-parallel searches.
+func (m *MCTSPlayer) addHelper() {
+	h := NewMCTSPlayer(m.info.name, m.info.symbol, m.info.id, m.iterations)
+	h.table = NewTranspositionTable(personalityTTSize)
+	m.helpers = append(m.helpers, h)
+}
+
+// schedule returns how many threads to search gs with, and how. A forced
+// move is searched with one thread, as more would only repeat it. Otherwise:
+//
+//   - With fewer moves than threads, the threads play out the same leaves:
+//     in one graph or in several, most threads would search the same moves.
+//   - When a player has a winning square, the position leads into forced
+//     sequences, narrow and deep, which the threads search in one graph, so
+//     that each builds on the lines the others found.
+//   - An open position is searched in a graph per thread, which needs no
+//     lock and spreads the threads over its many moves.
+//
+// Deterministic searches use root parallelism, as the others depend on the
+// scheduling, and so do searches under other rules, whose calls share the
+// player's copy of the position.
+func (m *MCTSPlayer) schedule(gs *game.GameState) (int, int) {
+	n := len(m.helpers) + 1
+	if m.autoThreads {
+		n = runtime.GOMAXPROCS(0)
+		for len(m.helpers) < n-1 {
+			m.addHelper()
+		}
+	}
+	moves := bits.OnesCount64(uint64(m.moves(gs)))
+	switch {
+	case n == 1 || moves <= 1:
+		return 1, parallelRoot
+	case m.deterministic || m.rules != nil:
+		return n, parallelRoot
+	case moves < n:
+		return n, parallelLeaf
+	case gs.Wins[0]|gs.Wins[1]|gs.Wins[2] != 0:
+		return n, parallelTree
+	}
+	return n, parallelRoot
+}
+
+// searchParallel is Search with n threads searching as how says.
+func (m *MCTSPlayer) searchParallel(gs game.GameState, n, how int) (int, int) {
+	switch how {
+	case parallelTree:
+		return m.searchTreeParallel(gs, n)
+	case parallelLeaf:
+		return m.searchLeafParallel(gs, n)
+	}
+	return m.searchRootParallel(gs, n)
+}
+
+// searchRootParallel is Search with n root-parallel threads: m and its
+// first n-1 helpers. The root visits of all threads together, reused ones
+// included, reach m.iterations.
+func (m *MCTSPlayer) searchRootParallel(gs game.GameState, n int) (int, int) {
+	workers := append([]*MCTSPlayer{m}, m.helpers[:n-1]...)
+	roots := make([]*MCGSNode, len(workers))
+	reused := 0
+	for i, w := range workers {
+		if w != m {
+			// The helpers follow the player's settings, and their streams
+			// are split from its stream, in order, for every search.
+			w.personality = m.personality
+			w.rules = m.rules
+			w.rand = m.rand.Split()
+			w.treeAge = m.treeAge
+			if w.arena.limit != m.arena.limit {
+				w.arena = nodeArena{limit: m.arena.limit}
+				w.recentRoots = nil
+			}
+		}
+		roots[i] = w.findRoot(gs)
+		reused += roots[i].N
+	}
+	remaining := max(m.iterations-reused, 0)
+
+	shares := make(rolloutShares, len(workers))
+	for i := range shares {
+		share := remaining / len(workers)
+		if i < remaining%len(workers) {
+			share++
+		}
+		shares[i].n.Store(int64(share))
+	}
+	steps := make([]int, len(workers))
+	rollouts := make([]int, len(workers))
+	panics := make([]*threadPanic, len(workers))
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		target, take := m.iterations, func() bool { return shares.take(i) }
+		if m.deterministic {
+			target, take = roots[i].N+int(shares[i].n.Load()), nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer recoverThread(panics, i)
+			steps[i], rollouts[i] = w.search(gs, roots[i], target, take)
+		}()
+	}
+	wg.Wait()
+	raise(panics)
+
+	m.merged = mergeRoots(roots)
+	totalSteps, total := 0, 0
+	for i := range workers {
+		totalSteps += steps[i]
+		total += rollouts[i]
+	}
+	return totalSteps, total
+}
+
+// threadStreams returns the streams of n threads searching m's graph: m's
+// own for the first, and streams split from it, in order, for the others.
+func (m *MCTSPlayer) threadStreams(n int) []*Rand {
+	streams := []*Rand{m.rand}
+	for len(streams) < n {
+		streams = append(streams, m.rand.Split())
+	}
+	return streams
+}
+
+// searchTreeParallel is Search with n threads sharing m's graph. The threads
+// take rollouts from one count as they are free, until the root has
+// m.iterations visits.
+func (m *MCTSPlayer) searchTreeParallel(gs game.GameState, n int) (int, int) {
+	m.merged = nil
+	root := m.findRoot(gs)
+	initialN, target := root.N, m.iterations
+	start := time.Now()
+	streams := m.threadStreams(n)
+
+	var (
+		mu       sync.Mutex
+		idle     = sync.NewCond(&mu)
+		inFlight int  // Rollouts selected and not yet backed up
+		stopped  bool // Set when a thread panics
+	)
+	// next selects the leaf of a thread's next rollout into leaf and path,
+	// and reports whether there is one. A full graph is pruned first, which
+	// waits for the other threads' rollouts to be backed up, as pruning may
+	// recycle the nodes on their paths.
+	next := func(leaf *game.GameState, path []PathStep, r *Rand) ([]PathStep, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			if stopped || root.N+inFlight >= target {
+				return path, false
+			}
+			if !m.arena.full() {
+				break
+			}
+			if inFlight == 0 {
+				m.prune(root)
+				break
+			}
+			idle.Wait()
+		}
+		*leaf = gs
+		path = m.descend(root, leaf, path[:0], r, true)
+		inFlight++
+		return path, true
+	}
+	backUp := func(path []PathStep, result [3]float32) {
+		mu.Lock()
+		defer mu.Unlock()
+		m.backpropVirtual(path, result)
+		if inFlight--; inFlight == 0 {
+			idle.Broadcast()
+		}
+		if m.OnProgress != nil && (root.N-initialN)%ProgressInterval == 0 {
+			m.OnProgress(m.searchInfo(initialN, target, start, false))
+		}
+	}
+
+	steps := make([]int, n)
+	panics := make([]*threadPanic, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		// Only the player's own thread records its playouts.
+		var stats *PlayoutStats
+		if i == 0 {
+			stats = m.Playouts
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if panics[i] != nil {
+					mu.Lock()
+					stopped = true
+					idle.Broadcast()
+					mu.Unlock()
+				}
+			}()
+			defer recoverThread(panics, i)
+			var leaf game.GameState
+			path := make([]PathStep, 0, 64)
+			for {
+				var more bool
+				if path, more = next(&leaf, path, streams[i]); !more {
+					return
+				}
+				result, s := m.rollout(&leaf, gs.ActiveMask, streams[i], stats)
+				steps[i] += s
+				backUp(path, result)
+			}
+		}()
+	}
+	wg.Wait()
+	raise(panics)
+
+	if m.OnProgress != nil {
+		m.OnProgress(m.searchInfo(initialN, target, start, true))
+	}
+	totalSteps := 0
+	for _, s := range steps {
+		totalSteps += s
+	}
+	return totalSteps, root.N - initialN
+}
+
+// backpropVirtual is Backprop for a path descend took with virtual losses,
+// taking them back.
+func (m *MCTSPlayer) backpropVirtual(path []PathStep, result [3]float32) {
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].Node.UpdateStats(result)
+		if i > 0 && path[i].EdgeIdx != -1 {
+			parent := path[i-1]
+			parent.Node.syncVirtualEdge(path[i].EdgeIdx, parent.PlayerID)
+		}
+	}
+}
+
+// addVirtualLoss counts a visit in flight through edge idx of n as a loss
+// for playerID, the player to move at n, until syncVirtualEdge backs it up,
+// so that other threads choosing at n meanwhile prefer other edges.
+func (n *MCGSNode) addVirtualLoss(idx int, playerID int) {
+	n.Edges[idx].Virtual++
+	n.cacheVirtualEdge(idx, playerID)
+}
+
+// syncVirtualEdge is SyncEdge for a visit through edge idx that had a
+// virtual loss.
+func (n *MCGSNode) syncVirtualEdge(idx int, playerID int) {
+	edge := &n.Edges[idx]
+	edge.Virtual--
+	edge.N++
+	n.cacheVirtualEdge(idx, playerID)
+}
+
+// cacheVirtualEdge sets the selection statistics of edge idx from its
+// child's winrate and its visits, counting those in flight as losses.
+func (n *MCGSNode) cacheVirtualEdge(idx int, playerID int) {
+	edge := &n.Edges[idx]
+	visits := edge.N + edge.Virtual
+	q := edge.Dest.Q[playerID]
+	if edge.Virtual > 0 {
+		q *= float32(edge.N) / float32(visits)
+	}
+	n.EdgeQs[idx] = q
+	n.EdgeUs[idx] = invSqrt(int(visits) + 1)
+}
+
+// searchLeafParallel is Search with n threads playing out each leaf. The
+// last leaf gets only as many playouts as the root has visits left to
+// reach m.iterations.
+func (m *MCTSPlayer) searchLeafParallel(gs game.GameState, n int) (int, int) {
+	m.merged = nil
+	root := m.findRoot(gs)
+	initialN, target := root.N, m.iterations
+	start := time.Now()
+	streams := m.threadStreams(n)
+
+	// The other threads wait on wake for the next leaf, and play it out
+	// into results and steps.
+	var leaf game.GameState
+	results := make([][3]float32, n)
+	steps := make([]int, n)
+	panics := make([]*threadPanic, n)
+	wake := make([]chan struct{}, n)
+	var wg sync.WaitGroup
+	for i := 1; i < n; i++ {
+		wake[i] = make(chan struct{}, 1)
+		go func() {
+			for range wake[i] {
+				func() {
+					defer wg.Done()
+					defer recoverThread(panics, i)
+					end := leaf
+					var s int
+					results[i], s = m.rollout(&end, gs.ActiveMask, streams[i], nil)
+					steps[i] += s
+				}()
+			}
+		}()
+	}
+	defer func() {
+		for _, c := range wake[1:] {
+			close(c)
+		}
+	}()
+
+	path := make([]PathStep, 0, 64)
+	nextProgress := initialN + ProgressInterval
+	for root.N < target {
+		if m.arena.full() {
+			m.prune(root)
+		}
+		if m.OnProgress != nil && root.N >= nextProgress {
+			m.OnProgress(m.searchInfo(initialN, target, start, false))
+			nextProgress += ProgressInterval
+		}
+		leaf = gs
+		path = m.descend(root, &leaf, path[:0], streams[0], false)
+		k := min(n, target-root.N)
+		wg.Add(k - 1)
+		for _, c := range wake[1:k] {
+			c <- struct{}{}
+		}
+		end := leaf
+		var s int
+		results[0], s = m.rollout(&end, gs.ActiveMask, streams[0], m.Playouts)
+		steps[0] += s
+		wg.Wait()
+		raise(panics)
+		for _, result := range results[:k] {
+			m.Backprop(path, result)
+		}
+	}
+
+	if m.OnProgress != nil {
+		m.OnProgress(m.searchInfo(initialN, target, start, true))
+	}
+	totalSteps := 0
+	for _, s := range steps {
+		totalSteps += s
+	}
+	return totalSteps, root.N - initialN
+}
+
+// A panic in a search thread would end the program from its own goroutine,
+// past the caller's deferred crash handling, so it is carried back and
+// raised again once every thread has stopped.
+
+// recoverThread, deferred by thread i of a search, records a panic of the
+// thread in panics.
+func recoverThread(panics []*threadPanic, i int) {
+	if r := recover(); r != nil {
+		panics[i] = &threadPanic{thread: i, value: r, stack: debug.Stack()}
+	}
+}
+
+// raise panics again with the first of panics, if any.
+func raise(panics []*threadPanic) {
+	for _, p := range panics {
+		if p != nil {
+			panic(p)
+		}
+	}
+}
+
+// threadPanic is a panic raised by a thread of a parallel search, with the
+// stack of the thread it came from.
+type threadPanic struct {
+	thread int
+	value  any
+	stack  []byte
+}
+
+func (p *threadPanic) Error() string {
+	return fmt.Sprintf("search thread %d: %v\n\n%s", p.thread, p.value, p.stack)
+}
+
+// rolloutShares are the rollouts left to each thread of a search. A thread
+// takes from its own share, which no other thread adds to, and steals when
+// it runs out, so the threads rarely touch the same counter.
+type rolloutShares []struct {
+	n atomic.Int64
+	_ [56]byte // Keeps the counters on separate cache lines
+}
+
+// take reports whether thread i may do another rollout, taking it from its
+// own share or else from half of the largest share left, rounded up, so
+// that even a last rollout goes to whichever thread is free first.
+func (sh rolloutShares) take(i int) bool {
+	for {
+		if sh[i].n.Add(-1) >= 0 {
+			return true
+		}
+		victim, most := -1, int64(0)
+		for j := range sh {
+			if v := sh[j].n.Load(); v > most {
+				victim, most = j, v
+			}
+		}
+		if victim < 0 {
+			return false
+		}
+		half := (most + 1) / 2
+		if sh[victim].n.CompareAndSwap(most, most-half) {
+			sh[i].n.Store(half)
+		} else {
+			sh[i].n.Store(0)
+		}
+	}
+}
+
+// mergeRoots sums the edge statistics of roots, in order, into one list of
+// moves in the order they first appear. Each move's winrate is the mean of
+// its winrates in the roots, weighted by visits.
+func mergeRoots(roots []*MCGSNode) []MoveEval {
+	var moves []MoveEval
+	var sums []float64
+	var pos [64]int
+	for i := range pos {
+		pos[i] = -1
+	}
+	for _, root := range roots {
+		for i := range root.Edges {
+			edge := &root.Edges[i]
+			idx := edge.Move.ToIndex()
+			if pos[idx] < 0 {
+				pos[idx] = len(moves)
+				moves = append(moves, MoveEval{Move: edge.Move, Winrate: root.EdgeQs[i]})
+				sums = append(sums, 0)
+			}
+			j := pos[idx]
+			moves[j].Visits += int(edge.N)
+			// The conversion rounds the product, which keeps the compiler
+			// from fusing it into the sum where it has a fused multiply-add.
+			sums[j] += float64(float64(root.EdgeQs[i]) * float64(edge.N))
+		}
+	}
+	for j := range moves {
+		if moves[j].Visits > 0 {
+			moves[j].Winrate = float32(sums[j] / float64(moves[j].Visits))
+		}
+	}
+	return moves
+}
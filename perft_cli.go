@@ -0,0 +1,74 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"squava/game"
+)
+
+// runPerft implements `squava perft`, counting the move paths from a
+// position to validate move generation.
+func runPerft(args []string) int {
+	fs := flag.NewFlagSet("perft", flag.ExitOnError)
+	depth := fs.Int("depth", 4, "Count paths of up to this many moves")
+	position := fs.String("position", "", "Start from this position, in the notation of test suites (default: the empty board)")
+	movesFlag := fs.String("moves", "", "Start from the position after these moves, e.g. \"D4 E5\"")
+	divide := fs.Bool("divide", false, "Also count the paths at the full depth after each legal move")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava perft [-depth N] [-position pos | -moves \"D4 E5\"] [-divide]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *depth < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *movesFlag != "" && *position != "" {
+		fmt.Fprintln(os.Stderr, "-moves and -position cannot be used together")
+		return exitUsage
+	}
+	rec, err := game.ReadGameRecord(strings.NewReader(*movesFlag))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-moves: %v\n", err)
+		return exitUsage
+	}
+	positions, err := rec.Positions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-moves: %v\n", err)
+		return exitUsage
+	}
+	gs := positions[len(positions)-1]
+	if *position != "" {
+		if gs, err = game.ParsePosition(*position); err != nil {
+			fmt.Fprintf(os.Stderr, "-position: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	fmt.Println(game.FormatPosition(gs))
+	for d := 1; d <= *depth; d++ {
+		start := time.Now()
+		n := Perft(&gs, d)
+		elapsed := time.Since(start)
+		fmt.Printf("perft(%d) = %d (%.3fs)\n", d, n, elapsed.Seconds())
+	}
+	if *divide {
+		counts := PerftDivide(&gs, *depth)
+		moves := make([]game.Move, 0, len(counts))
+		for m := range counts {
+			moves = append(moves, m)
+		}
+		sort.Slice(moves, func(i, j int) bool { return moves[i].ToIndex() < moves[j].ToIndex() })
+		for _, m := range moves {
+			fmt.Printf("%s: %d\n", m, counts[m])
+		}
+	}
+	return 0
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+
+	"squava/game"
+)
+
+// Personality changes how an MCTSPlayer plays without changing the rules:
+// how it imagines its own moves in playouts, what outcomes it values beyond
+// winning, and how it picks among the moves it searched.
+type Personality struct {
+	Name        string
+	Description string
+
+	// Playout policy: the chance that one of our playout moves is drawn from
+	// the squares next to our own stones (Cluster) or next to an opponent's
+	// stones (Mark) rather than from all legal squares.
+	Cluster float32
+	Mark    float32
+
+	// Reward shaping, added to our result of a playout.
+	Survival float32 // For still being in the game at the end without winning
+	Trap     float32 // Per opponent eliminated by 3-in-a-row during the playout
+	Speed    float32 // Times the fraction of the board still empty when we win
+
+	// Temperature > 0 plays a root move with probability proportional to
+	// visits^(1/Temperature) instead of always the most visited one.
+	Temperature float64
+}
+
+// Personalities are the built-in engine characters, selected per seat with
+// a player type such as "mcts:aggressive". The plain "mcts" engine has none.
+var Personalities = map[string]*Personality{
+	"aggressive": {
+		Name:        "aggressive",
+		Description: "builds its own lines and goes for quick wins",
+		Cluster:     0.5,
+		Speed:       0.3,
+	},
+	"defensive": {
+		Name:        "defensive",
+		Description: "stays close to its opponents and values survival",
+		Mark:        0.5,
+		Survival:    0.4,
+	},
+	"trappy": {
+		Name:        "trappy",
+		Description: "steers towards positions where opponents eliminate themselves",
+		Mark:        0.25,
+		Trap:        0.25,
+	},
+	"random": {
+		Name:        "random",
+		Description: "picks among the good moves at random, in proportion to their visits",
+		Temperature: 0.5,
+	},
+}
+
+// PersonalityNames lists the built-in personalities in alphabetical order.
+func PersonalityNames() []string {
+	names := make([]string, 0, len(Personalities))
+	for name := range Personalities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+const (
+	notFileA = game.Bitboard(0xFEFEFEFEFEFEFEFE)
+	notFileH = game.Bitboard(0x7F7F7F7F7F7F7F7F)
+)
+
+// Neighbors returns the squares adjacent (including diagonally) to bb.
+func Neighbors(bb game.Bitboard) game.Bitboard {
+	east := (bb << 1) & notFileA
+	west := (bb >> 1) & notFileH
+	row := bb | east | west
+	return (row | row<<8 | row>>8) &^ bb
+}
+
+// chance returns true with probability p.
+func chance(r *Rand, p float32) bool {
+	return p > 0 && float32(r.Uint64()>>40)/float32(1<<24) < p
+}
+
+// simulate is RunSimulation with this personality's policy for player me.
+func (p *Personality) simulate(gs *game.GameState, me int, r *Rand) ([3]float32, int) {
+	steps := 0
+	for {
+		steps++
+		winnerID, ok := gs.IsTerminal()
+		if ok {
+			return ScoreTerminal(gs.ActiveMask, winnerID), steps
+		}
+
+		moves := gs.GetBestMoves()
+		if gs.PlayerID == me && gs.ForcedMoves() == 0 {
+			var near game.Bitboard
+			if chance(r, p.Cluster) {
+				near = Neighbors(gs.Board.P[me]) & moves
+			} else if chance(r, p.Mark) {
+				near = Neighbors(gs.Board.Occupied&^gs.Board.P[me]) & moves
+			}
+			if near != 0 {
+				moves = near
+			}
+		}
+		idx := r.PickBit(moves)
+		if idx == -1 {
+			return ScoreDraw(gs.ActiveMask), steps
+		}
+
+		gs.ApplyMoveIdx(idx)
+	}
+}
+
+// shape adds this personality's rewards for player me to the result of a
+// playout that started with activeMask and ended in end.
+func (p *Personality) shape(result [3]float32, activeMask uint8, end *game.GameState, me int) [3]float32 {
+	winnerID, _ := end.IsTerminal()
+	stillIn := end.ActiveMask&(1<<uint(me)) != 0
+	if stillIn && winnerID != me {
+		result[me] += p.Survival
+	}
+	if winnerID == me {
+		empty := bits.OnesCount64(uint64(^end.Board.Occupied))
+		result[me] += p.Speed * float32(empty) / float32(game.BoardSize*game.BoardSize)
+	}
+	if p.Trap != 0 {
+		for id := 0; id < 3; id++ {
+			gone := activeMask&(1<<uint(id)) != 0 && end.ActiveMask&(1<<uint(id)) == 0
+			if id != me && gone {
+				if isWin, isLoss := game.CheckBoard(end.Board.P[id]); isLoss && !isWin {
+					result[me] += p.Trap
+				}
+			}
+		}
+	}
+	return result
+}
+
+// pickMove chooses among the searched root edges, weighting each by
+// visits^(1/Temperature).
+func (p *Personality) pickMove(root *MCGSNode, rnd *Rand) (game.Move, bool) {
+	if p.Temperature <= 0 || len(root.Edges) == 0 {
+		return game.Move{}, false
+	}
+	visits := make([]int, len(root.Edges))
+	for i := range root.Edges {
+		visits[i] = int(root.Edges[i].N)
+	}
+	i := pickByVisits(visits, p.Temperature, rnd)
+	if i < 0 {
+		return game.Move{}, false
+	}
+	return root.Edges[i].Move, true
+}
+
+// pickByVisits picks an index of visits at random, weighting each by
+// visits^(1/temperature), or returns -1 if there is nothing to pick. The
+// power is taken with math.Log1p and math.Expm1, which are the same Go code
+// on every platform, where math.Pow is not.
+func pickByVisits(visits []int, temperature float64, rnd *Rand) int {
+	weights := make([]float64, len(visits))
+	total := 0.0
+	for i, n := range visits {
+		weights[i] = math.Expm1(math.Log1p(float64(n-1))/temperature) + 1
+		total += weights[i]
+	}
+	if total == 0 {
+		return -1
+	}
+	r := float64(rnd.Uint64()>>11) / float64(1<<53) * total
+	for i, w := range weights {
+		r -= w
+		if r < 0 {
+			return i
+		}
+	}
+	return len(visits) - 1
+}
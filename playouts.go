@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math/bits"
+
+	"squava/game"
+)
+
+// --- Playout statistics ---
+
+// PlayoutStats counts what happens in random playouts, as data for designing
+// better playout policies. Playouts are counted from the position they start
+// in, which for a search is the leaf it expanded.
+type PlayoutStats struct {
+	Playouts int `json:"playouts"`
+	Moves    int `json:"moves"` // Moves played in all playouts
+
+	// Lengths[n] is the number of playouts that lasted n moves.
+	Lengths [game.BoardSize*game.BoardSize + 1]int `json:"lengths"`
+
+	// How the moves were chosen. A move is forced when the mover can win, or
+	// must block the next player's win; otherwise it is drawn from the squares
+	// that do not make a 3-in-a-row, and Unsafe counts the moves where there
+	// were none.
+	ForcedWins   int `json:"forced_wins"`
+	ForcedBlocks int `json:"forced_blocks"`
+	Unsafe       int `json:"unsafe"`
+
+	Eliminations        int `json:"eliminations"`         // Players eliminated by a 3-in-a-row
+	EliminationPlayouts int `json:"elimination_playouts"` // Playouts in which at least one player was eliminated
+
+	// How the playouts ended.
+	FourInARow   int `json:"four_in_a_row"`
+	LastStanding int `json:"last_standing"`
+	Draws        int `json:"draws"`
+}
+
+// Simulate plays gs out like RunSimulation, recording what happens in s. It
+// returns the final score and the number of moves played.
+func (s *PlayoutStats) Simulate(gs *game.GameState, r *Rand) ([3]float32, int) {
+	moves := 0
+	eliminated := false
+	for !gs.Terminal {
+		var candidates game.Bitboard
+		nextP := gs.NextPlayer()
+		switch {
+		case gs.Wins[gs.PlayerID] != 0:
+			candidates = gs.Wins[gs.PlayerID]
+			s.ForcedWins++
+		case nextP != -1 && gs.Wins[nextP] != 0:
+			candidates = gs.Wins[nextP]
+			s.ForcedBlocks++
+		default:
+			empty := ^gs.Board.Occupied
+			if candidates = empty &^ gs.Loses[gs.PlayerID]; candidates == 0 {
+				candidates = empty
+				s.Unsafe++
+			}
+		}
+		idx := r.PickBit(candidates)
+		if idx == -1 {
+			break
+		}
+		mask := gs.ActiveMask
+		gs.ApplyMoveIdx(idx)
+		moves++
+		if n := bits.OnesCount8(mask &^ gs.ActiveMask); n > 0 {
+			s.Eliminations += n
+			eliminated = true
+		}
+	}
+
+	s.Playouts++
+	s.Moves += moves
+	s.Lengths[moves]++
+	if eliminated {
+		s.EliminationPlayouts++
+	}
+	switch {
+	case gs.WinnerID == -1:
+		s.Draws++
+		return ScoreDraw(gs.ActiveMask), moves
+	case bits.OnesCount8(gs.ActiveMask) == 1:
+		s.LastStanding++
+	default:
+		s.FourInARow++
+	}
+	return ScoreWin(gs.WinnerID), moves
+}
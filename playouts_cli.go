@@ -0,0 +1,113 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"squava/game"
+)
+
+// playoutHistogramWidth is the length of the longest bar of the playout
+// length histogram.
+const playoutHistogramWidth = 40
+
+// Print writes a summary of s: the rates of each kind of move and ending,
+// and a histogram of the playout lengths.
+func (s *PlayoutStats) Print(w io.Writer) {
+	if s.Playouts == 0 {
+		fmt.Fprintln(w, "No playouts recorded")
+		return
+	}
+	pct := func(n, of int) float64 {
+		if of == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(of)
+	}
+	p := float64(s.Playouts)
+	fmt.Fprintf(w, "Playouts:       %d, %.1f moves on average\n", s.Playouts, float64(s.Moves)/p)
+	fmt.Fprintf(w, "Forced wins:    %5.1f%% of moves\n", pct(s.ForcedWins, s.Moves))
+	fmt.Fprintf(w, "Forced blocks:  %5.1f%% of moves\n", pct(s.ForcedBlocks, s.Moves))
+	fmt.Fprintf(w, "No safe square: %5.1f%% of moves\n", pct(s.Unsafe, s.Moves))
+	fmt.Fprintf(w, "Eliminations:   %.2f per playout, in %.1f%% of playouts\n", float64(s.Eliminations)/p, pct(s.EliminationPlayouts, s.Playouts))
+	fmt.Fprintf(w, "Endings:        %.1f%% 4-in-a-row, %.1f%% last standing, %.1f%% draws\n",
+		pct(s.FourInARow, s.Playouts), pct(s.LastStanding, s.Playouts), pct(s.Draws, s.Playouts))
+
+	lo, hi, most := -1, 0, 0
+	for n, c := range s.Lengths {
+		if c > 0 {
+			if lo < 0 {
+				lo = n
+			}
+			hi = n
+			most = max(most, c)
+		}
+	}
+	fmt.Fprintln(w, "Playout lengths:")
+	for n := lo; n <= hi; n++ {
+		c := s.Lengths[n]
+		bar := strings.Repeat("#", (c*playoutHistogramWidth+most-1)/most)
+		fmt.Fprintf(w, "  %2d %5.1f%% %s\n", n, pct(c, s.Playouts), bar)
+	}
+}
+
+// runPlayouts implements `squava playouts`, sampling random playouts from a
+// position to study the playout policy.
+func runPlayouts(args []string) int {
+	fs := flag.NewFlagSet("playouts", flag.ExitOnError)
+	n := fs.Int("n", 100000, "Number of playouts")
+	position := fs.String("position", "", "Start from this position, in the notation of test suites (default: the empty board)")
+	movesFlag := fs.String("moves", "", "Start from the position after these moves, e.g. \"D4 E5\"")
+	seed := fs.Uint64("seed", 1, "Random seed")
+	asJSON := fs.Bool("json", false, "Print the counts as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava playouts [-n N] [-position pos | -moves \"D4 E5\"] [-seed N] [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *n < 1 || *seed == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *movesFlag != "" && *position != "" {
+		fmt.Fprintln(os.Stderr, "-moves and -position cannot be used together")
+		return exitUsage
+	}
+	rec, err := game.ReadGameRecord(strings.NewReader(*movesFlag))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-moves: %v\n", err)
+		return exitUsage
+	}
+	positions, err := rec.Positions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-moves: %v\n", err)
+		return exitUsage
+	}
+	gs := positions[len(positions)-1]
+	if *position != "" {
+		if gs, err = game.ParsePosition(*position); err != nil {
+			fmt.Fprintf(os.Stderr, "-position: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	mainRand.Seed(*seed)
+	var stats PlayoutStats
+	for i := 0; i < *n; i++ {
+		g := gs
+		stats.Simulate(&g, &mainRand)
+	}
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(stats)
+		return 0
+	}
+	fmt.Println(game.FormatPosition(gs))
+	stats.Print(os.Stdout)
+	return 0
+}
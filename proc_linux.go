@@ -0,0 +1,61 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processCPUTime returns the CPU time, user and system, that the process
+// pid has used so far, from /proc.
+func processCPUTime(pid int) (time.Duration, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name, in parentheses, may hold spaces. The fields after
+	// it start with the state; utime and stime are the 12th and 13th.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, errors.New("unexpected /proc stat format")
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 13 {
+		return 0, errors.New("unexpected /proc stat format")
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	// They count clock ticks, which are 1/100 s (USER_HZ) for user space.
+	return time.Duration(utime+stime) * (time.Second / 100), nil
+}
+
+// processRSS returns the memory the process pid has resident, in bytes,
+// from /proc.
+func processRSS(pid int) (int64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The size of the program comes first, then the resident set, in pages.
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, errors.New("unexpected /proc statm format")
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// processCPUTime cannot read another process's CPU time while it runs
+// outside Linux.
+func processCPUTime(pid int) (time.Duration, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// processRSS cannot read another process's memory while it runs outside
+// Linux.
+func processRSS(pid int) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
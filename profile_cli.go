@@ -0,0 +1,101 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof" // Registers /debug/pprof/ on http.DefaultServeMux
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// --- Profiling ---
+
+// profileFlags are the profiling options of a command.
+type profileFlags struct {
+	cpu, mem, trace, listen *string
+}
+
+// addProfileFlags defines the profiling flags in fs.
+func addProfileFlags(fs *flag.FlagSet) *profileFlags {
+	return &profileFlags{
+		cpu:    fs.String("cpuprofile", "", "write cpu profile to file"),
+		mem:    fs.String("memprofile", "", "Write a heap profile to this file on exit"),
+		trace:  fs.String("trace", "", "Write an execution trace to this file, for go tool trace"),
+		listen: fs.String("pprof", "", "Serve net/http/pprof on this address (e.g. localhost:6060) while running"),
+	}
+}
+
+// start starts the requested profiles and returns a function that finishes
+// them, writing the heap profile last so that it shows what the run left
+// live. On an error, whatever was started has been finished.
+func (p *profileFlags) start() (stop func(), err error) {
+	var stops []func()
+	stop = func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	fail := func(what string, err error) (func(), error) {
+		stop()
+		return nil, fmt.Errorf("could not %s: %v", what, err)
+	}
+
+	if *p.mem != "" {
+		f, err := os.Create(*p.mem)
+		if err != nil {
+			return fail("create heap profile", err)
+		}
+		stops = append(stops, func() {
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fmt.Fprintf(os.Stderr, "could not write heap profile: %v\n", err)
+			}
+			f.Close()
+		})
+	}
+	if *p.cpu != "" {
+		f, err := os.Create(*p.cpu)
+		if err != nil {
+			return fail("create CPU profile", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fail("start CPU profile", err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+	if *p.trace != "" {
+		f, err := os.Create(*p.trace)
+		if err != nil {
+			return fail("create trace", err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return fail("start trace", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+	if *p.listen != "" {
+		ln, err := net.Listen("tcp", *p.listen)
+		if err != nil {
+			return fail("serve pprof", err)
+		}
+		fmt.Fprintf(os.Stderr, "pprof: http://%s/debug/pprof/\n", ln.Addr())
+		srv := &http.Server{Handler: http.DefaultServeMux}
+		go srv.Serve(ln)
+		stops = append(stops, func() { srv.Close() })
+	}
+	return stop, nil
+}
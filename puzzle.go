@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"squava/game"
+)
+
+// --- Puzzles ---
+
+// Puzzle is a position with a solution proven by the solver: the player to
+// move can force a win, or must stay clear of the moves that lose by force.
+//
+// Puzzle files (.sqp) hold one puzzle per line in the EPD-like format (see
+// ParseEPD), so they can also be run as a test suite, after a header line
+// with the format version (see PuzzleVersion):
+//
+//	# squava puzzles version 1
+//	8/8/8/2OO4/8/8/XX1X4/8 1 123 bm C2; depth 2; src game.sqv:17;
+//
+// "bm" lists the winning moves of a win puzzle, "am" the losing moves of an
+// avoid puzzle, "depth" the number of moves of the player concerned within
+// which the solver proved it, and "src" where the puzzle was found.
+type Puzzle struct {
+	ID       string
+	Position game.GameState
+	Best     game.Bitboard // The moves that force a win; 0 for an avoid puzzle
+	Avoid    game.Bitboard // The moves that lose by force
+	Depth    int
+	Source   string
+}
+
+// IsWin reports whether the puzzle asks for a forced win rather than for
+// avoiding a loss.
+func (p *Puzzle) IsWin() bool {
+	return p.Best != 0
+}
+
+// Difficulty rates the puzzle from 1 up: the solver depth, plus one when a
+// single move solves it.
+func (p *Puzzle) Difficulty() int {
+	if bits.OnesCount64(uint64(p.Solutions())) == 1 {
+		return p.Depth + 1
+	}
+	return p.Depth
+}
+
+// Solutions returns the moves that answer the puzzle.
+func (p *Puzzle) Solutions() game.Bitboard {
+	if p.IsWin() {
+		return p.Best
+	}
+	return p.Position.LegalMoves() &^ p.Avoid
+}
+
+// Solved reports whether move answers the puzzle.
+func (p *Puzzle) Solved(move game.Move) bool {
+	return p.Solutions()&(game.Bitboard(1)<<uint(move.ToIndex())) != 0
+}
+
+func squareArgs(bb game.Bitboard) []string {
+	var args []string
+	for ; bb != 0; bb &= bb - 1 {
+		args = append(args, game.MoveFromIndex(bits.TrailingZeros64(uint64(bb))).String())
+	}
+	return args
+}
+
+// String formats the puzzle as a line of a puzzle file.
+func (p *Puzzle) String() string {
+	var ops []game.EPDOp
+	if p.IsWin() {
+		ops = append(ops, game.EPDOp{Name: "bm", Args: squareArgs(p.Best)})
+	} else {
+		ops = append(ops, game.EPDOp{Name: "am", Args: squareArgs(p.Avoid)})
+	}
+	ops = append(ops, game.EPDOp{Name: "depth", Args: []string{strconv.Itoa(p.Depth)}})
+	if p.ID != "" {
+		ops = append(ops, game.EPDOp{Name: "id", Args: []string{p.ID}})
+	}
+	if p.Source != "" {
+		ops = append(ops, game.EPDOp{Name: "src", Args: []string{p.Source}})
+	}
+	return game.FormatEPD(p.Position, ops)
+}
+
+// ParsePuzzle reads one line of a puzzle file.
+func ParsePuzzle(line string) (Puzzle, error) {
+	gs, ops, err := game.ParseEPD(line)
+	if err != nil {
+		return Puzzle{}, err
+	}
+	p := Puzzle{Position: gs, Depth: 1}
+	for _, op := range ops {
+		switch op.Name {
+		case "bm", "am":
+			for _, a := range op.Args {
+				m, err := game.ParseMove(a)
+				if err != nil {
+					return Puzzle{}, fmt.Errorf("%s: %v", op.Name, err)
+				}
+				if op.Name == "bm" {
+					p.Best |= game.Bitboard(1) << uint(m.ToIndex())
+				} else {
+					p.Avoid |= game.Bitboard(1) << uint(m.ToIndex())
+				}
+			}
+		case "depth":
+			if len(op.Args) != 1 {
+				return Puzzle{}, fmt.Errorf("depth takes one argument")
+			}
+			p.Depth, err = strconv.Atoi(op.Args[0])
+			if err != nil || p.Depth < 1 {
+				return Puzzle{}, fmt.Errorf("bad depth %q", op.Args[0])
+			}
+		case "id":
+			p.ID = strings.Join(op.Args, " ")
+		case "src":
+			p.Source = strings.Join(op.Args, " ")
+		}
+	}
+	if p.Best == 0 && p.Avoid == 0 {
+		return Puzzle{}, fmt.Errorf("no bm or am operation")
+	}
+	return p, nil
+}
+
+// puzzleHeader starts the header line of a puzzle file; the version follows.
+const puzzleHeader = "# squava puzzles version "
+
+// WritePuzzleHeader writes the header line of a puzzle file.
+func WritePuzzleHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s%d\n", puzzleHeader, PuzzleVersion)
+	return err
+}
+
+// ReadPuzzles reads a puzzle file, skipping blank lines and lines starting
+// with '#'.
+func ReadPuzzles(r io.Reader) ([]Puzzle, error) {
+	puzzles, _, err := readPuzzles(r)
+	return puzzles, err
+}
+
+// readPuzzles is ReadPuzzles, also returning the file's format version: 0
+// if it has no header.
+func readPuzzles(r io.Reader) ([]Puzzle, int, error) {
+	var puzzles []Puzzle
+	version := 0
+	sc := bufio.NewScanner(r)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if v, ok := strings.CutPrefix(line, puzzleHeader); ok {
+			var err error
+			if version, err = strconv.Atoi(v); err != nil {
+				return nil, 0, fmt.Errorf("line %d: bad puzzle version %q", lineNo, v)
+			}
+			if err := checkVersion("puzzle", version, PuzzleVersion); err != nil {
+				return nil, 0, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := ParsePuzzle(line)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		puzzles = append(puzzles, p)
+	}
+	return puzzles, version, sc.Err()
+}
+
+// FindPuzzles looks through a recorded game for moves that missed a forced
+// win, or walked into a forced loss that another move avoided, as proven by
+// the solver within depth moves. source names the game in the puzzles'
+// sources.
+func FindPuzzles(rec *game.GameRecord, source string, depth int) ([]Puzzle, error) {
+	positions, err := rec.Positions()
+	if err != nil {
+		return nil, err
+	}
+	var puzzles []Puzzle
+	for i, m := range rec.Moves {
+		gs := positions[i]
+		legal := gs.LegalMoves()
+		if m == game.ResignMove || bits.OnesCount64(uint64(legal)) < 2 {
+			continue
+		}
+		mask := game.Bitboard(1) << uint(m.ToIndex())
+		p := Puzzle{Position: gs, Source: fmt.Sprintf("%s:%d", source, i+1)}
+
+		// Wins in one move are forced by the rules, so they cannot be missed.
+		var wins game.Bitboard
+		for p.Depth = 2; p.Depth <= depth && wins == 0; p.Depth++ {
+			wins = WinningMoves(gs, p.Depth)
+		}
+		p.Depth--
+		if wins != 0 {
+			if wins&mask == 0 && wins != legal {
+				p.Best = wins
+				puzzles = append(puzzles, p)
+			}
+			continue
+		}
+
+		for p.Depth = 1; p.Depth <= depth; p.Depth++ {
+			if MoveLoses(gs, m, p.Depth) {
+				break
+			}
+		}
+		if p.Depth > depth {
+			continue
+		}
+		if losing := LosingMoves(gs, depth); losing != legal {
+			p.Avoid = losing
+			puzzles = append(puzzles, p)
+		}
+	}
+	return puzzles, nil
+}
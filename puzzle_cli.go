@@ -0,0 +1,251 @@
+//go:build !wasm
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"squava/game"
+)
+
+// --- Puzzle training ---
+
+// PuzzleTrainer hands out puzzles at the player's level: solving
+// promoteAfter puzzles in a row moves the level up, and a failure moves it
+// down.
+type PuzzleTrainer struct {
+	puzzles []Puzzle
+	played  []bool
+
+	Level      int
+	Streak     int // Puzzles solved in a row
+	BestStreak int
+	Solved     int
+	Tried      int
+	run        int // Puzzles solved in a row at the current level
+}
+
+const promoteAfter = 3
+
+// NewPuzzleTrainer starts a session at level, which is clamped to the
+// difficulties the puzzles offer.
+func NewPuzzleTrainer(puzzles []Puzzle, level int) *PuzzleTrainer {
+	t := &PuzzleTrainer{puzzles: puzzles, played: make([]bool, len(puzzles)), Level: level}
+	t.Level = t.clamp(level)
+	return t
+}
+
+func (t *PuzzleTrainer) clamp(level int) int {
+	lo, hi := -1, -1
+	for i := range t.puzzles {
+		d := t.puzzles[i].Difficulty()
+		if lo < 0 || d < lo {
+			lo = d
+		}
+		if d > hi {
+			hi = d
+		}
+	}
+	return max(lo, min(hi, level))
+}
+
+// Next returns an unplayed puzzle whose difficulty is closest to the level,
+// chosen at random among equals, or nil when all have been played.
+func (t *PuzzleTrainer) Next() *Puzzle {
+	pick, bestGap, ties := -1, 0, 0
+	for i := range t.puzzles {
+		if t.played[i] {
+			continue
+		}
+		gap := t.puzzles[i].Difficulty() - t.Level
+		if gap < 0 {
+			gap = -gap
+		}
+		switch {
+		case pick < 0 || gap < bestGap:
+			pick, bestGap, ties = i, gap, 1
+		case gap == bestGap:
+			ties++
+			if xrand()%uint64(ties) == 0 {
+				pick = i
+			}
+		}
+	}
+	if pick < 0 {
+		return nil
+	}
+	t.played[pick] = true
+	return &t.puzzles[pick]
+}
+
+// Record scores the last puzzle and adapts the level.
+func (t *PuzzleTrainer) Record(solved bool) {
+	t.Tried++
+	if !solved {
+		t.Streak, t.run = 0, 0
+		t.Level = t.clamp(t.Level - 1)
+		return
+	}
+	t.Solved++
+	t.Streak++
+	t.BestStreak = max(t.BestStreak, t.Streak)
+	if t.run++; t.run >= promoteAfter {
+		t.run = 0
+		t.Level = t.clamp(t.Level + 1)
+	}
+}
+
+// CheckPuzzleMove plays move for the player to move in a win puzzle with
+// moves of that player left, and tells whether the win is still forced.
+func CheckPuzzleMove(gs game.GameState, move game.Move, moves int) bool {
+	id := gs.PlayerID
+	gs.ApplyMove(move)
+	return CanForceWin(&gs, id, moves-1)
+}
+
+var errQuit = errors.New("quit")
+
+// readPuzzleMove prompts until the player enters a legal move, "skip" or
+// "quit".
+func readPuzzleMove(gs game.GameState) (game.Move, error) {
+	for {
+		fmt.Print("Your move (or skip, quit)> ")
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println()
+			return game.Move{}, errQuit
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "skip":
+			return game.ResignMove, nil
+		case "quit", "q":
+			return game.Move{}, errQuit
+		}
+		move, err := game.ParseMove(line)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if gs.LegalMoves()&(game.Bitboard(1)<<uint(move.ToIndex())) == 0 {
+			fmt.Printf("%s is not legal here; legal moves: %s\n", move, formatSquares(gs.LegalMoves()))
+			continue
+		}
+		return move, nil
+	}
+}
+
+// playPuzzle presents p on g's board and reports whether the player solved
+// it. Win puzzles are played out against defending replies, checking every
+// move of the player with the solver.
+func playPuzzle(g *SquavaGame, p *Puzzle) (bool, error) {
+	g.history, g.moves, g.comments, g.times = nil, nil, nil, nil
+	g.gs = p.Position
+	me := g.gs.PlayerID
+	mover := g.GetPlayer(me)
+	if p.IsWin() {
+		fmt.Printf("%s (%s) to move and win within %d moves.\n", mover.Name(), mover.Symbol(), p.Depth)
+	} else {
+		fmt.Printf("%s (%s) to move. Find a move that does not lose by force.\n", mover.Name(), mover.Symbol())
+	}
+
+	for left := p.Depth; ; left-- {
+		g.PrintBoard()
+		move, err := readPuzzleMove(g.gs)
+		if err != nil {
+			return false, err
+		}
+		if move == game.ResignMove {
+			answer := p.Solutions()
+			if p.IsWin() {
+				answer = WinningMoves(g.gs, left)
+			}
+			fmt.Printf("Solution: %s\n", formatSquares(answer))
+			return false, nil
+		}
+		if !p.IsWin() {
+			if !p.Solved(move) {
+				fmt.Printf("%s loses by force. Safe moves: %s\n", move, formatSquares(p.Solutions()))
+				return false, nil
+			}
+			return true, nil
+		}
+		if !CheckPuzzleMove(g.gs, move, left) {
+			fmt.Printf("%s lets the win slip. Winning moves: %s\n", move, formatSquares(WinningMoves(g.gs, left)))
+			return false, nil
+		}
+		g.play(move)
+		for !g.gs.Terminal && g.gs.PlayerID != me {
+			reply := DefendingMove(g.gs, me, left-1)
+			defender := g.GetPlayer(g.gs.PlayerID)
+			fmt.Printf("%s (%s) plays %s\n", defender.Name(), defender.Symbol(), reply)
+			g.play(reply)
+		}
+		if g.gs.Terminal {
+			g.PrintBoard()
+			return g.gs.WinnerID == me, nil
+		}
+	}
+}
+
+// runPuzzle implements `squava puzzle puzzles.sqp`, an interactive tactics
+// trainer.
+func runPuzzle(args []string) int {
+	fs := flag.NewFlagSet("puzzle", flag.ExitOnError)
+	level := fs.Int("level", 1, "Difficulty to start at")
+	count := fs.Int("n", 0, "Stop after this many puzzles (0 for all)")
+	plain := fs.Bool("plain", false, "Plain ASCII board without colors or unicode stones")
+	seed := fs.Int64("seed", 0, "Random seed for picking puzzles (0 for time-based)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava puzzle [-level N] [-n N] [-plain] puzzles.sqp")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	puzzles, err := ReadPuzzles(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fs.Arg(0), err)
+		return exitError
+	}
+	if len(puzzles) == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no puzzles\n", fs.Arg(0))
+		return exitError
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano() | 1
+	}
+	mainRand.Seed(uint64(*seed))
+
+	g, _ := loadRecord(&game.GameRecord{}, *plain)
+	t := NewPuzzleTrainer(puzzles, *level)
+	for *count == 0 || t.Tried < *count {
+		p := t.Next()
+		if p == nil {
+			break
+		}
+		fmt.Printf("\nPuzzle %d (level %d, streak %d)\n", t.Tried+1, p.Difficulty(), t.Streak)
+		solved, err := playPuzzle(g, p)
+		if err != nil {
+			break
+		}
+		if solved {
+			fmt.Println("Solved!")
+		}
+		t.Record(solved)
+	}
+	fmt.Printf("\nSolved %d of %d, best streak %d, level %d\n", t.Solved, t.Tried, t.BestStreak, t.Level)
+	return 0
+}
@@ -0,0 +1,54 @@
+//go:build !wasm
+
+package main
+
+import (
+	"testing"
+
+	"squava/game"
+)
+
+func TestPuzzleTrainer(t *testing.T) {
+	easy, _ := ParsePuzzle("8/8/8/8/8/8/8/XX6 1 123 am C1; depth 1;")
+	hard, _ := ParsePuzzle("7Z/8/7Z/4X2Z/4X3/8/1XX5/O6O 1 123 bm E2; depth 2;")
+	if easy.Difficulty() != 1 || hard.Difficulty() != 3 {
+		t.Fatalf("Unexpected difficulties %d and %d", easy.Difficulty(), hard.Difficulty())
+	}
+	var puzzles []Puzzle
+	for i := 0; i < 4; i++ {
+		puzzles = append(puzzles, easy, hard)
+	}
+	tr := NewPuzzleTrainer(puzzles, 0)
+	if tr.Level != 1 {
+		t.Errorf("Expected the level clamped to 1, got %d", tr.Level)
+	}
+	for i := 0; i < promoteAfter; i++ {
+		if p := tr.Next(); p.Difficulty() != 1 {
+			t.Errorf("Puzzle %d: expected an easy puzzle at level 1", i)
+		}
+		tr.Record(true)
+	}
+	if tr.Level != 2 || tr.Streak != promoteAfter {
+		t.Errorf("Expected promotion to level 2 with a streak, got level %d streak %d", tr.Level, tr.Streak)
+	}
+	tr.Next()
+	tr.Record(false)
+	if tr.Level != 1 || tr.Streak != 0 || tr.BestStreak != promoteAfter || tr.Solved != 3 || tr.Tried != 4 {
+		t.Errorf("Unexpected trainer state %+v", tr)
+	}
+
+	// The solution line: E2, then after the defence X wins at once.
+	gs := hard.Position
+	e2, _ := game.ParseMove("E2")
+	a8, _ := game.ParseMove("A8")
+	if !CheckPuzzleMove(gs, e2, 2) || CheckPuzzleMove(gs, a8, 2) {
+		t.Error("Only E2 should keep the win")
+	}
+	gs.ApplyMove(e2)
+	for gs.PlayerID != 0 {
+		gs.ApplyMove(DefendingMove(gs, 0, 1))
+	}
+	if gs.Terminal || gs.Wins[0] == 0 {
+		t.Errorf("Expected X to have a winning square after the defence, got %s", game.FormatPosition(gs))
+	}
+}
@@ -0,0 +1,141 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+
+	"squava/game"
+)
+
+// recordPaths expands the directories among paths into the .sqv files they
+// contain.
+func recordPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.sqv"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// readRecordFile reads the games of a .sqv file, which may hold several,
+// and names each for messages: by the path, and by its number in the file
+// when there are several.
+func readRecordFile(path string) ([]*game.GameRecord, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	recs, err := game.ReadGameRecords(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, len(recs))
+	for i := range recs {
+		names[i] = path
+		if len(recs) > 1 {
+			names[i] = fmt.Sprintf("%s: game %d", path, i+1)
+		}
+	}
+	return recs, names, nil
+}
+
+// runPuzzleGen implements `squava puzzlegen`, mining saved games for missed
+// tactics.
+func runPuzzleGen(args []string) int {
+	fs := flag.NewFlagSet("puzzlegen", flag.ExitOnError)
+	depth := fs.Int("depth", 2, "Solver depth in moves of the player concerned (2 or 3 is practical)")
+	maxSolutions := fs.Int("max-solutions", 3, "Skip puzzles with more moves than this that solve them")
+	out := fs.String("o", "", "Write the puzzles to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava puzzlegen [-depth N] [-o puzzles.sqp] game.sqv|dir...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || *depth < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	files, err := recordPaths(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := WritePuzzleHeader(w); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	// The same position can come up in several games, or its rotations and
+	// reflections; keep the first.
+	seen := make(map[string]bool)
+	games, wins, avoids := 0, 0, 0
+	for _, path := range files {
+		recs, names, err := readRecordFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return exitError
+		}
+		for i, rec := range recs {
+			games++
+			source := filepath.Base(path)
+			if len(recs) > 1 {
+				source = fmt.Sprintf("%s#%d", source, i+1)
+			}
+			puzzles, err := FindPuzzles(rec, source, *depth)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", names[i], err)
+				return exitError
+			}
+			for _, p := range puzzles {
+				pos, _ := game.CanonicalPosition(p.Position)
+				if seen[pos] || bits.OnesCount64(uint64(p.Solutions())) > *maxSolutions {
+					continue
+				}
+				seen[pos] = true
+				if p.IsWin() {
+					wins++
+				} else {
+					avoids++
+				}
+				if _, err := fmt.Fprintln(w, p.String()); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					return exitError
+				}
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d games, %d puzzles: %d missed wins, %d avoidable losses\n",
+		games, wins+avoids, wins, avoids)
+	return 0
+}
@@ -0,0 +1,322 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// --- Plackett-Luce ratings ---
+
+// The rating model for 3-player games: each engine has a strength
+// s = 10^(elo/400), and the winner of a game is drawn in proportion to the
+// strengths of the three seats, as with the Elo of the SPRT: 400 Elo above
+// both opponents wins ten times as often as each of them. This is the
+// Plackett-Luce model observed only for first place. A draw competes as a
+// fourth outcome of strength ν times the geometric mean of the three
+// strengths, after Davidson. The ratings, centered on 0, and ν are the
+// maximum a posteriori estimate under a weak normal prior, which keeps the
+// rating of an engine that never lost finite; their error bars come from the
+// curvature of the likelihood at the maximum.
+
+// ratingPriorElo is the standard deviation of the prior on ratings.
+const ratingPriorElo = 1000
+
+var eloPerNat = 400 / math.Ln10
+
+// RatingGame is one game for the rating model: the engine index in each seat,
+// and the winning seat or -1 for a draw.
+type RatingGame struct {
+	Seats  [3]int
+	Winner int
+}
+
+// Rating is an engine's fitted rating.
+type Rating struct {
+	Name  string
+	Elo   float64
+	CI95  float64 // Half-width of the 95% interval
+	Games int
+	Score float64 // Wins plus a third of the draws
+}
+
+// Ratings is the fit of the model to a set of games.
+type Ratings struct {
+	Engines  []Rating // Strongest first
+	DrawRate float64  // ν: how likely a draw is next to a win by equal players
+}
+
+// ratingLogLikelihood returns the log posterior of x (the strengths in nats
+// followed by log ν) and its gradient.
+func ratingLogLikelihood(games []RatingGame, x []float64) (float64, []float64) {
+	n := len(x) - 1
+	grad := make([]float64, len(x))
+	nu := math.Exp(x[n])
+	ll := 0.0
+	for _, g := range games {
+		var sum, mean float64
+		for _, p := range g.Seats {
+			sum += math.Exp(x[p])
+			mean += x[p] / 3
+		}
+		draw := nu * math.Exp(mean)
+		z := sum + draw
+		ll -= math.Log(z)
+		for _, p := range g.Seats {
+			grad[p] -= (math.Exp(x[p]) + draw/3) / z
+		}
+		grad[n] -= draw / z
+		if g.Winner >= 0 {
+			ll += x[g.Seats[g.Winner]]
+			grad[g.Seats[g.Winner]]++
+		} else {
+			ll += x[n] + mean
+			for _, p := range g.Seats {
+				grad[p] += 1.0 / 3
+			}
+			grad[n]++
+		}
+	}
+	sigma := ratingPriorElo / eloPerNat
+	for i := 0; i < n; i++ {
+		ll -= x[i] * x[i] / (2 * sigma * sigma)
+		grad[i] -= x[i] / (sigma * sigma)
+	}
+	// A unit-variance prior on log ν around 0 keeps it finite without draws.
+	ll -= x[n] * x[n] / 2
+	grad[n] -= x[n]
+	return ll, grad
+}
+
+// invert returns the inverse of the square matrix a by Gauss-Jordan
+// elimination, or nil if it is singular.
+func invert(a [][]float64) [][]float64 {
+	n := len(a)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = make([]float64, 2*n)
+		copy(m[i], a[i])
+		m[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		div := m[col][col]
+		for c := range m[col] {
+			m[col][c] /= div
+		}
+		for r := 0; r < n; r++ {
+			if r != col && m[r][col] != 0 {
+				f := m[r][col]
+				for c := range m[r] {
+					m[r][c] -= f * m[col][c]
+				}
+			}
+		}
+	}
+	inv := make([][]float64, n)
+	for i := range m {
+		inv[i] = m[i][n:]
+	}
+	return inv
+}
+
+// ratingHessian differentiates the gradient numerically.
+func ratingHessian(games []RatingGame, x []float64) [][]float64 {
+	const h = 1e-5
+	hess := make([][]float64, len(x))
+	for i := range x {
+		hess[i] = make([]float64, len(x))
+	}
+	for j := range x {
+		orig := x[j]
+		x[j] = orig + h
+		_, up := ratingLogLikelihood(games, x)
+		x[j] = orig - h
+		_, down := ratingLogLikelihood(games, x)
+		x[j] = orig
+		for i := range x {
+			hess[i][j] = (up[i] - down[i]) / (2 * h)
+		}
+	}
+	// Symmetrize away the rounding.
+	for i := range hess {
+		for j := 0; j < i; j++ {
+			avg := (hess[i][j] + hess[j][i]) / 2
+			hess[i][j], hess[j][i] = avg, avg
+		}
+	}
+	return hess
+}
+
+// FitRatings fits the model to games among the named engines by Newton's
+// method.
+func FitRatings(names []string, games []RatingGame) Ratings {
+	n := len(names)
+	x := make([]float64, n+1)
+	ll, grad := ratingLogLikelihood(games, x)
+	var hess [][]float64
+	for iter := 0; iter < 100; iter++ {
+		hess = ratingHessian(games, x)
+		inv := invert(hess)
+		if inv == nil {
+			break
+		}
+		step := make([]float64, len(x))
+		size := 0.0
+		for i := range x {
+			for j := range x {
+				step[i] -= inv[i][j] * grad[j]
+			}
+			size = math.Max(size, math.Abs(step[i]))
+		}
+		// Halve the step until the posterior improves.
+		next := make([]float64, len(x))
+		improved := false
+		for t := 1.0; t > 1e-6; t /= 2 {
+			for i := range x {
+				next[i] = x[i] + t*step[i]
+			}
+			nextLL, nextGrad := ratingLogLikelihood(games, next)
+			if nextLL >= ll {
+				copy(x, next)
+				ll, grad, improved = nextLL, nextGrad, true
+				break
+			}
+		}
+		if !improved || size < 1e-9 {
+			break
+		}
+	}
+	hess = ratingHessian(games, x)
+
+	// The covariance of the ratings comes from the inverse of the negative
+	// Hessian, taken relative to their mean.
+	var cov [][]float64
+	if inv := invert(hess); inv != nil {
+		cov = inv
+	}
+	mean := 0.0
+	for i := 0; i < n; i++ {
+		mean += x[i] / float64(n)
+	}
+	r := Ratings{DrawRate: math.Exp(x[n])}
+	for i, name := range names {
+		rating := Rating{Name: name, Elo: (x[i] - mean) * eloPerNat, CI95: math.NaN()}
+		if cov != nil {
+			// Var(x_i - mean) with the centering matrix applied to -H^-1.
+			v, rowMean, total := -cov[i][i], 0.0, 0.0
+			for j := 0; j < n; j++ {
+				rowMean -= cov[i][j] / float64(n)
+				for k := 0; k < n; k++ {
+					total -= cov[j][k] / float64(n*n)
+				}
+			}
+			v += total - 2*rowMean
+			rating.CI95 = 1.96 * math.Sqrt(math.Max(v, 0)) * eloPerNat
+		}
+		r.Engines = append(r.Engines, rating)
+	}
+	for _, g := range games {
+		for seat, p := range g.Seats {
+			r.Engines[p].Games++
+			switch g.Winner {
+			case seat:
+				r.Engines[p].Score++
+			case -1:
+				r.Engines[p].Score += 1.0 / 3
+			}
+		}
+	}
+	sort.SliceStable(r.Engines, func(i, j int) bool { return r.Engines[i].Elo > r.Engines[j].Elo })
+	return r
+}
+
+// RatingGames converts tournament results for the model. Games that ended
+// without a winner count as draws.
+func RatingGames(recs []tournamentRecord) ([]string, []RatingGame) {
+	var names []string
+	index := map[string]int{}
+	var games []RatingGame
+	for _, rec := range recs {
+		g := RatingGame{Winner: -1}
+		for seat, name := range rec.Seats {
+			i, ok := index[name]
+			if !ok {
+				i = len(names)
+				index[name] = i
+				names = append(names, name)
+			}
+			g.Seats[seat] = i
+			if rec.Result[seat] == "win" {
+				g.Winner = seat
+			}
+		}
+		games = append(games, g)
+	}
+	return names, games
+}
+
+// Print writes the ratings as a table.
+func (r Ratings) Print(w io.Writer) {
+	fmt.Fprintf(w, "%4s %-20s %7s %7s %6s %7s\n", "Rank", "Engine", "Elo", "±95%", "Games", "Score")
+	for i, e := range r.Engines {
+		ci := "-"
+		if !math.IsNaN(e.CI95) {
+			ci = fmt.Sprintf("%.0f", e.CI95)
+		}
+		fmt.Fprintf(w, "%4d %-20s %7.0f %7s %6d %6.1f%%\n", i+1, e.Name, e.Elo, ci, e.Games, 100*e.Score/float64(max(e.Games, 1)))
+	}
+	fmt.Fprintf(w, "Draw strength ν = %.3f (equal players draw %.1f%% of their games)\n", r.DrawRate, 100*r.DrawRate/(3+r.DrawRate))
+}
+
+// runRatings implements `squava ratings`, rating the engines of tournament
+// results files.
+func runRatings(args []string) int {
+	fs := flag.NewFlagSet("ratings", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava ratings results.jsonl...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	var recs []tournamentRecord
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		more, err := ReadTournamentResults(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return exitError
+		}
+		recs = append(recs, more...)
+	}
+	if len(recs) == 0 {
+		fmt.Fprintln(os.Stderr, "no games to rate")
+		return exitError
+	}
+	names, games := RatingGames(recs)
+	fmt.Printf("%d games, %d engines\n", len(games), len(names))
+	FitRatings(names, games).Print(os.Stdout)
+	return 0
+}
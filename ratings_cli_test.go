@@ -0,0 +1,41 @@
+//go:build !wasm
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitRatings(t *testing.T) {
+	// A wins ten times as often as each of B and C: 400 Elo above both.
+	var games []RatingGame
+	for i := 0; i < 260; i++ {
+		// A sits in seat 0, 2, 1, 0, ...; each block of 26 games has 20
+		// wins for A, 2 each for B and C, and 2 draws.
+		g := RatingGame{Seats: [3]int{i % 3, (i + 1) % 3, (i + 2) % 3}, Winner: -1}
+		switch k := i % 26; {
+		case k < 20:
+			g.Winner = (3 - i%3) % 3
+		case k < 22:
+			g.Winner = (4 - i%3) % 3
+		case k < 24:
+			g.Winner = (5 - i%3) % 3
+		}
+		games = append(games, g)
+	}
+	r := FitRatings([]string{"A", "B", "C"}, games)
+	a, b, c := r.Engines[0], r.Engines[1], r.Engines[2]
+	if a.Name != "A" || math.Abs(a.Elo-b.Elo-400) > 40 || math.Abs(b.Elo-c.Elo) > 1 {
+		t.Errorf("Unexpected ratings %+v", r.Engines)
+	}
+	if math.Abs(a.Elo+b.Elo+c.Elo) > 1e-6 || !(a.CI95 > 20 && a.CI95 < 200) {
+		t.Errorf("Expected centered ratings with error bars, got %+v", r.Engines)
+	}
+	if a.Games != 260 || math.Abs(a.Score-(200+20.0/3)) > 1e-9 {
+		t.Errorf("Unexpected tally %+v", a)
+	}
+	if r.DrawRate <= 0 {
+		t.Errorf("Expected a positive draw strength, got %v", r.DrawRate)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"squava/game"
+)
+
+func TestFormatVersions(t *testing.T) {
+	var buf bytes.Buffer
+	WritePuzzleHeader(&buf)
+	buf.WriteString("8/8/8/8/8/8/8/XX1X4 1 123 bm C1; depth 1; rating 1200;\n")
+	puzzles, v, err := readPuzzles(&buf)
+	if err != nil || v != PuzzleVersion || len(puzzles) != 1 {
+		t.Errorf("Expected one puzzle in version %d, got %d in %d, %v", PuzzleVersion, len(puzzles), v, err)
+	}
+	newer := fmt.Sprintf("%s%d\n", puzzleHeader, PuzzleVersion+1)
+	if _, err := ReadPuzzles(strings.NewReader(newer)); err == nil {
+		t.Error("Expected a newer puzzle file to be refused")
+	}
+}
+
+func TestFindPuzzles(t *testing.T) {
+	// X could win with E2 (threatening D2 and E3 while O must stop Z at H7)
+	// but plays G5 instead.
+	r, err := game.ReadGameRecord(strings.NewReader("B2 A1 H8 C2 H1 H6 E4 A8 D8 E5 B8 H5 G5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	puzzles, err := FindPuzzles(r, "t.sqv", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found *Puzzle
+	for i := range puzzles {
+		if puzzles[i].Source == "t.sqv:13" {
+			found = &puzzles[i]
+		}
+	}
+	e2, _ := game.ParseMove("E2")
+	if found == nil || !found.IsWin() || found.Depth != 2 || !found.Solved(e2) || found.Best != game.Bitboard(1)<<uint(e2.ToIndex()) {
+		t.Fatalf("Expected a win puzzle at move 13, got %+v", puzzles)
+	}
+
+	back, err := ParsePuzzle(found.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Position.Hash != found.Position.Hash || back.Best != found.Best || back.Depth != 2 || back.Source != "t.sqv:13" {
+		t.Errorf("Round trip of %q gave %+v", found.String(), back)
+	}
+
+	if _, err := (&game.GameRecord{Moves: []game.Move{game.MoveFromIndex(0), game.MoveFromIndex(0)}}).Positions(); err == nil {
+		t.Error("Expected an error for a move on an occupied square")
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	rec, err := game.ReadGameRecord(strings.NewReader("H8 F1 B8 C8 G8 E4 A4 F8 G5 C5 D1 E7 H3 A1 C2 C1 C4 G4 E5 D3 {winrate 25.8%} H4 E2 F6 F4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Annotate(rec, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := map[int][]string{
+		19: {"winrate 25.8%; ", "threatens to win at E2; Player 1 must block.", "D3 loses by force"},
+		20: {"double threat at F4/F6; Player 2 must block.", "H4 forces a win within 2 moves."},
+		21: {"Player 1 is forced to block Player 2 at E2."},
+		22: {"Player 2 can block only one of Player 3's threats at F4/F6."},
+		23: {"Player 3 completes a 4-in-a-row and wins."},
+	}
+	for i := range rec.Moves {
+		c := rec.Comment(i)
+		if want[i] == nil && c != "" {
+			t.Errorf("move %d: unexpected comment %q", i+1, c)
+		}
+		for _, s := range want[i] {
+			if !strings.Contains(c, s) {
+				t.Errorf("move %d: comment %q lacks %q", i+1, c, s)
+			}
+		}
+	}
+	before := append([]string(nil), rec.Comments...)
+	if err := Annotate(rec, 2); err != nil {
+		t.Fatal(err)
+	}
+	for i := range before {
+		if rec.Comments[i] != before[i] {
+			t.Errorf("annotating again changed move %d to %q", i+1, rec.Comments[i])
+		}
+	}
+}
+
+func TestBook(t *testing.T) {
+	// The same finished game, as played and rotated a quarter turn, and an
+	// unfinished one.
+	played, err := game.ReadGameRecord(strings.NewReader("C8 G1 H2 H7 G5 C2 E4 H5 F8 A8 D8 G7 E6 B3 C7 F5 G6 D7 H4 G3 A5 G4 D1 A7 B7 E8 F6 E7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	positions, err := played.Positions()
+	if err != nil || !positions[len(positions)-1].Terminal {
+		t.Fatalf("Expected a finished game, got %v", err)
+	}
+	rotated := &game.GameRecord{}
+	for _, m := range played.Moves {
+		rotated.Moves = append(rotated.Moves, game.MoveFromIndex(game.TransformSquare(m.ToIndex(), 5)))
+	}
+	bb := NewBookBuilder()
+	for _, rec := range []*game.GameRecord{played, rotated} {
+		if ok, err := bb.AddGame(rec, 4); !ok || err != nil {
+			t.Fatalf("Expected the game to be added, got %v, %v", ok, err)
+		}
+	}
+	if ok, _ := bb.AddGame(&game.GameRecord{Moves: played.Moves[:3]}, 4); ok {
+		t.Error("Expected an unfinished game to be left out")
+	}
+
+	var buf bytes.Buffer
+	if err := bb.Write(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseBook(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 4 {
+		t.Errorf("Expected the two games to share 4 entries, got %d", b.Len())
+	}
+	winner := positions[len(positions)-1].WinnerID
+	for _, rec := range []*game.GameRecord{played, rotated} {
+		gs := game.NewGameState(game.Board{}, 0, 0x07)
+		for i, m := range rec.Moves[:4] {
+			// In a symmetric position the book may give an equivalent move.
+			moves, h := b.Probe(&gs), gs.SymHashes()
+			if len(moves) != 1 || h.CanonicalSquare(moves[0].Move.ToIndex()) != h.CanonicalSquare(m.ToIndex()) || moves[0].Games != 2 {
+				t.Fatalf("Move %d: expected %v played in 2 games, got %+v", i+1, m, moves)
+			}
+			if won := moves[0].Wins == 2; won != (gs.PlayerID == winner) || moves[0].Weight != 3*moves[0].Wins {
+				t.Errorf("Move %d: unexpected results %+v", i+1, moves[0])
+			}
+			gs.ApplyMove(m)
+		}
+		if b.Probe(&gs) != nil {
+			t.Errorf("Expected no book moves after 4 plies")
+		}
+	}
+
+	// C8 lost both games, so the book does not recommend it.
+	if winner != 0 {
+		start := game.NewGameState(game.Board{}, 0, 0x07)
+		if replies := b.Replies(&start); replies != 0 {
+			t.Errorf("Expected no replies that scored, got [%s]", formatSquares(replies))
+		}
+	}
+
+	// A later version may lengthen the entries, but not change their meaning.
+	data := buf.Bytes()
+	longer := append([]byte{}, data[:bookHeaderSize]...)
+	binary.LittleEndian.PutUint16(longer[6:], bookEntrySize+8)
+	for i := bookHeaderSize; i < len(data); i += bookEntrySize {
+		longer = append(longer, data[i:i+bookEntrySize]...)
+		longer = append(longer, make([]byte, 8)...)
+	}
+	empty := game.NewGameState(game.Board{}, 0, 0x07)
+	if b2, err := ParseBook(longer); err != nil || len(b2.Probe(&empty)) != 1 {
+		t.Errorf("Expected longer entries to be read, got %v", err)
+	}
+	if _, err := ParseBook(data[:bookHeaderSize+5]); err == nil {
+		t.Error("Expected a truncated book to be refused")
+	}
+	binary.LittleEndian.PutUint16(data[4:], BookVersion+1)
+	if _, err := ParseBook(data); err == nil {
+		t.Error("Expected a newer book to be refused")
+	}
+}
+
+// FuzzParsePuzzle checks that ParsePuzzle never panics.
+func FuzzParsePuzzle(f *testing.F) {
+	f.Add("8/8/8/8/8/8/8/XX1X4 1 123 bm C1; depth 1; rating 1200;")
+	f.Add("8/8/8/8/8/8/8/XX1X4 1 123 am C1 D1; depth 0;")
+	f.Add("8/8/8/8/8/8/8/XX1X4 1 123 id \"x\";")
+	f.Fuzz(func(t *testing.T, s string) {
+		ParsePuzzle(s)
+	})
+}
+
+func TestSGFAndPSQ(t *testing.T) {
+	r, err := game.ReadGameRecord(strings.NewReader(`[Player1 "mcts"]
+[Player2 "human"]
+[Player3 "mcts:trappy"]
+[Result "Player 2 Wins (4-in-a-row)"]
+[Event "club night"]
+
+{a [bracketed] note} D4!? {first} E5 C3?? D5 resign
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteSGF(&buf, []*game.GameRecord{r, r}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), ";B[de]LB[de:X]IT[]C[first]\n;W[ed]LB[ed:O]\n;B[cf]LB[cf:Z]BM[2]") {
+		t.Errorf("Unexpected SGF:\n%s", buf.String())
+	}
+	recs, err := ReadSGF(&buf)
+	if err != nil || len(recs) != 2 {
+		t.Fatalf("Expected 2 games, got %d, %v", len(recs), err)
+	}
+	got := recs[1]
+	if fmt.Sprint(got.Moves) != fmt.Sprint(r.Moves[:4]) || got.Players != r.Players || got.Result != r.Result ||
+		got.Intro != r.Intro || fmt.Sprint(got.Marks) != fmt.Sprint(r.Marks) || got.Comment(0) != "first" ||
+		fmt.Sprint(got.Tags) != fmt.Sprint(r.Tags) {
+		t.Errorf("Expected %+v without the resignation, got %+v", r, got)
+	}
+
+	// The main line of a game from another program, whose colors do not
+	// matter.
+	recs, err = ReadSGF(strings.NewReader("(;GM[4]SZ[8];W[de]C[a\\]b];W[ed](;B[cf];B[aa])(;B[hh]))"))
+	if err != nil || len(recs) != 1 || fmt.Sprint(recs[0].Moves) != "[D4 E5 C3 A8]" || recs[0].Comment(0) != "a]b" {
+		t.Errorf("Unexpected games %+v, %v", recs, err)
+	}
+	for _, bad := range []string{"(;SZ[15];B[aa])", "(;SZ[8]AB[aa];W[bb])", "(;B[de];W[de])", "(;B[]", "(;B[zz])"} {
+		if _, err := ReadSGF(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+
+	r.SetMoveTime(1, 2350*time.Millisecond)
+	buf.Reset()
+	if err := WritePSQ(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Piskvorky 8x8, 11:11, 0\n4,5,0\n5,4,2350\n3,6,0\n4,4,0\n-1\n"; buf.String() != want {
+		t.Errorf("Expected PSQ\n%s\ngot\n%s", want, buf.String())
+	}
+	got, err = ReadPSQ(&buf)
+	if err != nil || fmt.Sprint(got.Moves) != fmt.Sprint(r.Moves[:4]) || got.MoveTime(1) != 2350*time.Millisecond {
+		t.Errorf("Unexpected game %+v, %v", got, err)
+	}
+	for _, bad := range []string{"Piskvorky 20x20, 11:11, 0\n1,1,0\n", "Piskvorky 8x8, 11:11, 0\n9,1,0\n", "8,8\n"} {
+		if _, err := ReadPSQ(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
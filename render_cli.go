@@ -0,0 +1,251 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"squava/game"
+)
+
+const (
+	renderCell   = 48 // Pixels per square
+	renderMargin = 24 // Room for the coordinates around the board
+	renderSize   = 2*renderMargin + game.BoardSize*renderCell
+)
+
+// renderPalette is shared by all images so GIF frames need no quantization.
+var renderPalette = color.Palette{
+	color.RGBA{0xff, 0xff, 0xff, 0xff}, // Background
+	color.RGBA{0xf0, 0xd9, 0xb5, 0xff}, // Square
+	color.RGBA{0x8b, 0x6b, 0x45, 0xff}, // Grid
+	color.RGBA{0xff, 0xe9, 0x80, 0xff}, // Last move
+	color.RGBA{0xc6, 0x28, 0x28, 0xff}, // Player 1
+	color.RGBA{0x15, 0x65, 0xc0, 0xff}, // Player 2
+	color.RGBA{0x2e, 0x7d, 0x32, 0xff}, // Player 3
+	color.RGBA{0x9e, 0x9e, 0x9e, 0xff}, // Eliminated player
+}
+
+const (
+	colorBackground = iota
+	colorSquare
+	colorGrid
+	colorLast
+	colorPlayer1
+	colorEliminated = colorPlayer1 + 3
+)
+
+// stoneColor returns the palette index used for a player's stones in gs.
+func stoneColor(gs *game.GameState, id int) uint8 {
+	if gs.ActiveMask&(1<<uint(id)) == 0 {
+		return colorEliminated
+	}
+	return uint8(colorPlayer1 + id)
+}
+
+// inStone reports whether the point (x, y), relative to the center of a
+// square, is part of player id's stone: a disc, a ring, or a triangle.
+func inStone(id int, x, y float64) bool {
+	r := float64(renderCell) * 0.38
+	d2 := x*x + y*y
+	switch id {
+	case 0:
+		return d2 <= r*r
+	case 1:
+		inner := r * 0.6
+		return d2 <= r*r && d2 >= inner*inner
+	default:
+		// Upward triangle with its base at y = r*0.8.
+		if y > r*0.8 || y < -r {
+			return false
+		}
+		half := (y + r) / (1.8 * r) * r
+		return x >= -half && x <= half
+	}
+}
+
+// RenderImage draws the position as a paletted image with the square of last
+// (or -1) highlighted.
+func RenderImage(gs *game.GameState, last int) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, renderSize, renderSize), renderPalette)
+	for py := 0; py < renderSize; py++ {
+		for px := 0; px < renderSize; px++ {
+			bx, by := px-renderMargin, py-renderMargin
+			if bx < 0 || by < 0 || bx >= game.BoardSize*renderCell || by >= game.BoardSize*renderCell {
+				continue
+			}
+			c, row := bx/renderCell, game.BoardSize-1-by/renderCell
+			ox, oy := bx%renderCell, by%renderCell
+			idx := uint8(colorSquare)
+			if ox == 0 || oy == 0 || ox == renderCell-1 || oy == renderCell-1 {
+				idx = colorGrid
+			} else {
+				sq := row*8 + c
+				if sq == last {
+					idx = colorLast
+				}
+				x := float64(ox) - float64(renderCell)/2
+				y := float64(oy) - float64(renderCell)/2
+				for id := 0; id < 3; id++ {
+					if gs.Board.P[id]&(game.Bitboard(1)<<uint(sq)) != 0 && inStone(id, x, y) {
+						idx = stoneColor(gs, id)
+					}
+				}
+			}
+			img.SetColorIndex(px, py, idx)
+		}
+	}
+	return img
+}
+
+// RenderSVG writes the position as an SVG document with coordinates.
+func RenderSVG(w io.Writer, gs *game.GameState, last int) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		renderSize, renderSize, renderSize, renderSize)
+	hex := func(i uint8) string {
+		c := renderPalette[i].(color.RGBA)
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hex(colorBackground))
+	for row := 0; row < game.BoardSize; row++ {
+		for c := 0; c < game.BoardSize; c++ {
+			sq := row*8 + c
+			x := renderMargin + c*renderCell
+			y := renderMargin + (game.BoardSize-1-row)*renderCell
+			fill := hex(colorSquare)
+			if sq == last {
+				fill = hex(colorLast)
+			}
+			fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="%s"/>`+"\n",
+				x, y, renderCell, renderCell, fill, hex(colorGrid))
+			cx, cy := float64(x)+renderCell/2, float64(y)+renderCell/2
+			r := float64(renderCell) * 0.38
+			for id := 0; id < 3; id++ {
+				if gs.Board.P[id]&(game.Bitboard(1)<<uint(sq)) == 0 {
+					continue
+				}
+				col := hex(stoneColor(gs, id))
+				switch id {
+				case 0:
+					fmt.Fprintf(&sb, `<circle cx="%g" cy="%g" r="%g" fill="%s"/>`+"\n", cx, cy, r, col)
+				case 1:
+					fmt.Fprintf(&sb, `<circle cx="%g" cy="%g" r="%g" fill="none" stroke="%s" stroke-width="%g"/>`+"\n",
+						cx, cy, r*0.8, col, r*0.4)
+				default:
+					fmt.Fprintf(&sb, `<polygon points="%g,%g %g,%g %g,%g" fill="%s"/>`+"\n",
+						cx, cy-r, cx-r, cy+r*0.8, cx+r, cy+r*0.8, col)
+				}
+			}
+		}
+	}
+	for i := 0; i < game.BoardSize; i++ {
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" font-family="sans-serif" font-size="14" text-anchor="middle">%c</text>`+"\n",
+			renderMargin+i*renderCell+renderCell/2, renderSize-6, 'A'+i)
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" font-family="sans-serif" font-size="14" text-anchor="middle">%d</text>`+"\n",
+			renderMargin/2, renderMargin+(game.BoardSize-1-i)*renderCell+renderCell/2+5, i+1)
+	}
+	sb.WriteString("</svg>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// RenderGIF writes an animation of positions, one frame per move, holding the
+// final position longer.
+func RenderGIF(w io.Writer, positions []game.GameState, lasts []int) error {
+	anim := &gif.GIF{}
+	for i := range positions {
+		anim.Image = append(anim.Image, RenderImage(&positions[i], lasts[i]))
+		delay := 80
+		if i == len(positions)-1 {
+			delay = 400
+		}
+		anim.Delay = append(anim.Delay, delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// runRender implements `squava render`, drawing a position from a saved game
+// or a move list as an SVG, PNG or animated GIF.
+func runRender(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	out := fs.String("o", "board.svg", "Output file; the extension picks the format (.svg, .png, .gif)")
+	moves := fs.String("moves", "", "Render the position after these moves instead of a saved game")
+	ply := fs.Int("ply", -1, "Render the position after this many moves (default: the final position)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava render [-o board.svg|board.png|game.gif] [-ply N] (game.sqv | -moves \"D4 E5 ...\")")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var g *SquavaGame
+	switch {
+	case *moves != "" && fs.NArg() == 0:
+		rec, err := game.ReadGameRecord(strings.NewReader(*moves))
+		if err == nil {
+			g, err = loadRecord(rec, true)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bad move list: %v\n", err)
+			return 1
+		}
+	case *moves == "" && fs.NArg() == 1:
+		var err error
+		g, _, err = loadRecordFile(fs.Arg(0), true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load %s: %v\n", fs.Arg(0), err)
+			return 1
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	if *ply > len(g.moves) {
+		fmt.Fprintf(os.Stderr, "the game has only %d moves\n", len(g.moves))
+		return 1
+	}
+	if *ply >= 0 {
+		g = g.positionAt(*ply)
+	}
+
+	ext := strings.ToLower(filepath.Ext(*out))
+	if ext != ".svg" && ext != ".png" && ext != ".gif" {
+		fmt.Fprintf(os.Stderr, "unknown image format %q; use .svg, .png or .gif\n", filepath.Ext(*out))
+		return 2
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not create %s: %v\n", *out, err)
+		return 1
+	}
+	switch ext {
+	case ".svg":
+		err = RenderSVG(f, &g.gs, g.lastPlaced())
+	case ".png":
+		err = png.Encode(f, RenderImage(&g.gs, g.lastPlaced()))
+	case ".gif":
+		positions := g.positions()
+		lasts := make([]int, len(positions))
+		for i := range positions {
+			lasts[i] = g.positionAt(i).lastPlaced()
+		}
+		err = RenderGIF(f, positions, lasts)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not render %s: %v\n", *out, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,39 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestRenderImageAndSVG(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	g.play(game.MoveFromIndex(0))  // A1 by player 1
+	g.play(game.MoveFromIndex(63)) // H8 by player 2
+
+	img := RenderImage(&g.gs, g.lastPlaced())
+	center := func(sq int) (int, int) {
+		r, c := sq/8, sq%8
+		return renderMargin + c*renderCell + renderCell/2, renderMargin + (game.BoardSize-1-r)*renderCell + renderCell/2
+	}
+	if x, y := center(0); img.ColorIndexAt(x, y) != colorPlayer1 {
+		t.Errorf("A1 should hold player 1's disc")
+	}
+	if x, y := center(63); img.ColorIndexAt(x, y) != colorLast {
+		t.Errorf("The center of player 2's ring on the last move should show the highlight")
+	}
+	if x, y := center(9); img.ColorIndexAt(x, y) != colorSquare {
+		t.Errorf("B2 should be empty")
+	}
+
+	var sb strings.Builder
+	if err := RenderSVG(&sb, &g.gs, g.lastPlaced()); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(sb.String(), "<circle"); n != 2 {
+		t.Errorf("Expected 2 stones in the SVG, got %d", n)
+	}
+}
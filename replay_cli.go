@@ -0,0 +1,161 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"squava/game"
+)
+
+// loadRecordFile reads and validates a saved game, returning a SquavaGame
+// positioned after its last move.
+func loadRecordFile(path string, plain bool) (*SquavaGame, *game.GameRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	rec, err := game.ReadGameRecord(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	g, err := loadRecord(rec, plain)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, rec, nil
+}
+
+// loadRecord replays rec into a new SquavaGame with three placeholder seats.
+func loadRecord(rec *game.GameRecord, plain bool) (*SquavaGame, error) {
+	g := NewSquavaGame()
+	g.SetBoardStyle(DefaultBoardStyle(plain))
+	for i := 0; i < 3; i++ {
+		g.AddPlayer(NewHumanPlayer(tr("player", i+1), asciiStones[i], i))
+	}
+	if err := g.Load(rec); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// positionAt returns a view of the game after its first n moves.
+func (g *SquavaGame) positionAt(n int) *SquavaGame {
+	view := *g
+	view.moves = g.moves[:n]
+	view.comments = g.comments[:n]
+	view.times = g.times[:n]
+	view.searches = g.searches[:n]
+	view.history = g.history[:n]
+	if n < len(g.history) {
+		view.gs = g.history[n]
+	}
+	return &view
+}
+
+// runReplay implements `squava replay game.sqv`, stepping through a recorded
+// game interactively.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	plain := fs.Bool("plain", false, "Plain ASCII board without colors or unicode stones")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava replay [-plain] game.sqv")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	g, rec, err := loadRecordFile(fs.Arg(0), *plain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+
+	total := len(g.moves)
+	pos := 0
+	show := func() {
+		view := g.positionAt(pos)
+		view.PrintBoard()
+		if pos == 0 {
+			fmt.Printf("Start of game (%d moves)\n", total)
+			if rec.Intro != "" {
+				fmt.Printf("{%s}\n", rec.Intro)
+			}
+		} else {
+			mover := g.GetPlayer(g.history[pos-1].PlayerID)
+			line := fmt.Sprintf("Move %d/%d: %s (%s) %s%s", pos, total, mover.Name(), mover.Symbol(), game.FormatRecordMove(g.moves[pos-1]), rec.Mark(pos-1))
+			if d := rec.MoveTime(pos - 1); d > 0 {
+				line += " (" + formatClock(d) + ")"
+			}
+			if d := rec.Clock(pos - 1); d > 0 {
+				line += " [clock " + formatClock(d) + "]"
+			}
+			if w, ok := rec.Eval(pos - 1); ok {
+				line += fmt.Sprintf(" [eval %.1f%%]", w*100)
+			}
+			if c := rec.Comment(pos - 1); c != "" {
+				line += " {" + c + "}"
+			}
+			fmt.Println(line)
+			if s := rec.Search(pos - 1); s != nil {
+				fmt.Printf("Search: %s\n", s)
+			}
+		}
+		if pos == total && rec.Result != "" {
+			fmt.Printf("Result: %s\n", rec.Result)
+		}
+	}
+
+	show()
+	for {
+		fmt.Print("replay [n]ext [p]rev [j]ump N [f]irst [l]ast [q]uit> ")
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println()
+			return 0
+		}
+		fields := strings.Fields(strings.ToLower(line))
+		cmd := "n"
+		if len(fields) > 0 {
+			cmd = fields[0]
+		}
+		switch cmd {
+		case "n", "next":
+			if pos < total {
+				pos++
+			}
+		case "p", "prev":
+			if pos > 0 {
+				pos--
+			}
+		case "f", "first":
+			pos = 0
+		case "l", "last":
+			pos = total
+		case "j", "jump":
+			if len(fields) < 2 {
+				fmt.Println("Usage: jump N")
+				continue
+			}
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 0 || n > total {
+				fmt.Printf("Move number must be between 0 and %d.\n", total)
+				continue
+			}
+			pos = n
+		case "q", "quit":
+			return 0
+		default:
+			fmt.Println("Unknown command.")
+			continue
+		}
+		show()
+	}
+}
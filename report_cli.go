@@ -0,0 +1,414 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+
+	"squava/game"
+)
+
+// wasmExec is Go's loader for WebAssembly programs, which a report that
+// embeds the engine runs it with.
+//
+//go:embed web/public/wasm_exec.js
+var wasmExec string
+
+// reportPly is one position of the game as shown by the HTML report.
+type reportPly struct {
+	Move     string                                `json:"move,omitempty"`
+	Player   int                                   `json:"player"`   // Who made Move
+	Position string                                `json:"position"` // In the position notation, for the engine
+	Comment  string                                `json:"comment,omitempty"`
+	Note     string                                `json:"note,omitempty"`   // Commentary on Move
+	Search   string                                `json:"search,omitempty"` // What the engine's search found for Move
+	Board    [game.BoardSize * game.BoardSize]int8 `json:"board"`            // Player ID per square, -1 if empty
+	Active   uint8                                 `json:"active"`           // Players still in the game
+	Winrates [3]float32                            `json:"winrates"`
+	Proven   string                                `json:"proven,omitempty"` // The outcome the solver proved, replacing the winrates
+	Blunder  string                                `json:"blunder,omitempty"`
+}
+
+type reportData struct {
+	Players []string    `json:"players"`
+	Symbols []string    `json:"symbols"`
+	Result  string      `json:"result"`
+	Plies   []reportPly `json:"plies"`
+}
+
+// reportPage is what the report template is given: the game, and the WASM
+// engine to explore it with, if any.
+type reportPage struct {
+	Report  reportData
+	Engine  string      // The engine's WASM binary in base64
+	Runtime template.JS // wasm_exec.js, which runs it
+}
+
+// LoadReportEngine reads a WASM build of squava (`make wasm`), gzipped or
+// not, for reports to embed.
+func LoadReportEngine(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		if b, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	if !bytes.HasPrefix(b, []byte("\x00asm")) {
+		return nil, fmt.Errorf("%s is not a WebAssembly module", path)
+	}
+	return b, nil
+}
+
+// movers returns the player who made each move of the game.
+func (g *SquavaGame) movers() []int {
+	ids := make([]int, len(g.history))
+	for i, gs := range g.history {
+		ids[i] = gs.PlayerID
+	}
+	return ids
+}
+
+// WriteReport writes a self-contained HTML page with a replay of the game,
+// the evaluation graph from series, the blunders found in it, the outcomes
+// the solver proved, and commentary on the moves. Positions are computed
+// here by the engine, so the replay needs no rules of its own. If the game
+// has a report engine (see SetReportEngine), the page embeds it, and any
+// position of the replay can be explored with it: playing other moves, and
+// asking it for its reply.
+func (g *SquavaGame) WriteReport(w io.Writer, series []EvalPoint) error {
+	data := reportData{Result: "*"}
+	if _, terminal := g.terminal(); terminal {
+		data.Result = g.resultText()
+	}
+	for id := 0; id < 3; id++ {
+		p := g.GetPlayer(id)
+		data.Players = append(data.Players, p.Name())
+		data.Symbols = append(data.Symbols, asciiStones[id])
+	}
+
+	positions := g.positions()
+	notes := Commentary(positions, g.moves, commentaryDepth)
+	for i, gs := range positions {
+		ply := reportPly{Player: -1, Active: gs.ActiveMask, Position: game.FormatPosition(gs)}
+		for sq := range ply.Board {
+			ply.Board[sq] = -1
+			for id := 0; id < 3; id++ {
+				if gs.Board.P[id]&(game.Bitboard(1)<<uint(sq)) != 0 {
+					ply.Board[sq] = int8(id)
+				}
+			}
+		}
+		if i > 0 {
+			ply.Move = game.FormatRecordMove(g.moves[i-1])
+			ply.Player = g.history[i-1].PlayerID
+			ply.Comment = g.comments[i-1]
+			if !strings.Contains(ply.Comment, notes[i-1]) {
+				ply.Note = notes[i-1]
+			}
+			if s := g.searches[i-1]; s != nil {
+				ply.Search = s.String()
+			}
+		}
+		if i < len(series) {
+			ply.Winrates = series[i].Winrates
+			if o := series[i].Outcome; o != "" {
+				ply.Proven = fmt.Sprintf("Proven %s for %s, to move", o, g.GetPlayer(gs.PlayerID).Name())
+			}
+		}
+		data.Plies = append(data.Plies, ply)
+	}
+	for _, b := range FindBlunders(series, g.movers()) {
+		data.Plies[b.Ply].Blunder = fmt.Sprintf("Blunder: %s's winrate fell from %.1f%% to %.1f%%",
+			g.GetPlayer(b.PlayerID).Name(), b.Before*100, b.After*100)
+	}
+	page := reportPage{Report: data}
+	if g.reportEngine != nil {
+		page.Engine = base64.StdEncoding.EncodeToString(g.reportEngine)
+		page.Runtime = template.JS(wasmExec)
+	}
+	return reportTemplate.Execute(w, page)
+}
+
+// SaveReport analyzes every position with iterations rollouts and writes the
+// HTML report to path.
+func (g *SquavaGame) SaveReport(path string, iterations int) error {
+	return g.writeReportFile(path, EvalSeries(g.positions(), iterations))
+}
+
+func (g *SquavaGame) writeReportFile(path string, series []EvalPoint) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := g.WriteReport(f, series); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Squava game report</title>
+<style>
+    body { font-family: sans-serif; margin: 20px; }
+    #main { display: flex; gap: 30px; flex-wrap: wrap; }
+    #board { display: grid; grid-template-columns: repeat(8, 40px); gap: 2px; }
+    .cell { width: 40px; height: 40px; border: 1px solid #ccc; display: flex;
+            align-items: center; justify-content: center; font-weight: bold; }
+    .cell.last { background: #ffe9a8; }
+    .p0 { color: #c62828; } .p1 { color: #1565c0; } .p2 { color: #2e7d32; }
+    .out { text-decoration: line-through; opacity: 0.5; }
+    #moves { max-height: 360px; overflow-y: auto; min-width: 260px; }
+    #moves div { cursor: pointer; padding: 1px 4px; }
+    #moves div.current { background: #ddd; }
+    .blunder { color: #b71c1c; }
+    .note { font-style: italic; }
+    .search { color: #555; font-size: 90%; }
+    .proven { font-weight: bold; }
+    #graph { border: 1px solid #ccc; cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>Squava game report</h1>
+<div id="result"></div>
+<div id="main">
+    <div>
+        <div id="board"></div>
+        <p>
+            <button id="first">&laquo;</button>
+            <button id="prev">&lsaquo;</button>
+            <button id="next">&rsaquo;</button>
+            <button id="last">&raquo;</button>
+        </p>
+        <div id="info"></div>
+        {{- if .Engine}}
+        <p>
+            <button id="explore">Explore this position</button>
+            <button id="engine" hidden>Engine move</button>
+            <span id="explore-status"></span>
+        </p>
+        {{- end}}
+    </div>
+    <div id="moves"></div>
+</div>
+<h2>Evaluation</h2>
+<svg id="graph" width="640" height="200"></svg>
+<div id="legend"></div>
+<script>
+const report = {{.Report}};
+const plies = report.plies;
+let pos = 0;
+// explored is the engine's position while exploring one of the game's, or null.
+let explored = null;
+
+function square(i) { return String.fromCharCode(65 + i % 8) + (Math.floor(i / 8) + 1); }
+
+function drawCells(board, active, last, onclick) {
+    const el = document.getElementById('board');
+    el.replaceChildren();
+    for (let r = 7; r >= 0; r--) {
+        for (let c = 0; c < 8; c++) {
+            const i = r * 8 + c;
+            const cell = document.createElement('div');
+            cell.className = 'cell';
+            const p = board[i];
+            if (p >= 0) {
+                cell.textContent = report.symbols[p];
+                cell.classList.add('p' + p);
+                if (!(active & (1 << p))) cell.classList.add('out');
+            }
+            if (square(i) === last) cell.classList.add('last');
+            cell.title = square(i);
+            if (onclick) cell.onclick = function () { onclick(i); };
+            el.appendChild(cell);
+        }
+    }
+}
+
+function line(parent, text, cls) {
+    if (parent.childNodes.length) parent.appendChild(document.createElement('br'));
+    const span = document.createElement('span');
+    span.textContent = text;
+    if (cls) span.className = cls;
+    parent.appendChild(span);
+}
+
+function drawBoard() {
+    explored = null;
+    const ply = plies[pos];
+    drawCells(ply.board, ply.active, ply.move && ply.move !== 'resign' ? ply.move : '');
+    const info = document.getElementById('info');
+    info.replaceChildren();
+    let head = pos === 0 ? 'Start of game' :
+        'Move ' + pos + ': ' + report.players[ply.player] + ' ' + ply.move;
+    if (ply.comment) head += ' {' + ply.comment + '}';
+    line(info, head);
+    if (ply.note) line(info, ply.note, 'note');
+    if (ply.search) line(info, 'Search: ' + ply.search, 'search');
+    if (ply.proven) {
+        line(info, ply.proven, 'proven');
+    } else {
+        line(info, report.players.map(function (name, id) {
+            return name + ': ' + (ply.winrates[id] * 100).toFixed(1) + '%';
+        }).join(', '));
+    }
+    if (ply.blunder) line(info, ply.blunder, 'blunder');
+    document.querySelectorAll('#moves div').forEach(function (d, i) {
+        d.classList.toggle('current', i + 1 === pos);
+    });
+    drawGraph();
+    if (typeof showExplore === 'function') showExplore();
+}
+
+function drawGraph() {
+    const svg = document.getElementById('graph');
+    const w = svg.width.baseVal.value, h = svg.height.baseVal.value;
+    const n = Math.max(plies.length - 1, 1);
+    const x = function (i) { return 10 + i * (w - 20) / n; };
+    const y = function (v) { return h - 10 - v * (h - 20); };
+    const colors = ['#c62828', '#1565c0', '#2e7d32'];
+    let out = '<line x1="' + x(pos) + '" y1="0" x2="' + x(pos) + '" y2="' + h + '" stroke="#999"/>';
+    for (let id = 0; id < 3; id++) {
+        const pts = plies.map(function (p, i) { return x(i) + ',' + y(p.winrates[id]); }).join(' ');
+        out += '<polyline fill="none" stroke-width="2" stroke="' + colors[id] + '" points="' + pts + '"/>';
+    }
+    plies.forEach(function (p, i) {
+        if (p.blunder) out += '<circle cx="' + x(i) + '" cy="' + y(p.winrates[p.player]) + '" r="4" fill="#b71c1c"/>';
+        // Proven points are estimates no longer: a square on the axis.
+        if (p.proven) out += '<rect x="' + (x(i) - 3) + '" y="' + (h - 8) + '" width="6" height="6" fill="#000"/>';
+    });
+    svg.innerHTML = out;
+    svg.onclick = function (e) {
+        const rect = svg.getBoundingClientRect();
+        go(Math.round((e.clientX - rect.left - 10) * n / (w - 20)));
+    };
+}
+
+function go(n) {
+    pos = Math.max(0, Math.min(plies.length - 1, n));
+    drawBoard();
+}
+
+const moves = document.getElementById('moves');
+plies.forEach(function (p, i) {
+    if (i === 0) return;
+    const d = document.createElement('div');
+    d.textContent = i + '. ' + report.symbols[p.player] + ' ' + p.move + (p.comment ? ' {' + p.comment + '}' : '');
+    if (p.blunder) { d.classList.add('blunder'); d.textContent += ' ??'; }
+    if (p.note) d.title = p.note;
+    d.onclick = function () { go(i); };
+    moves.appendChild(d);
+});
+document.getElementById('result').textContent = 'Result: ' + report.result;
+const legend = document.getElementById('legend');
+report.players.forEach(function (name, id) {
+    if (id > 0) legend.appendChild(document.createTextNode('\u00a0 '));
+    const span = document.createElement('span');
+    span.className = 'p' + id;
+    span.textContent = '\u25a0 ' + name + ' (' + report.symbols[id] + ')';
+    legend.appendChild(span);
+});
+document.getElementById('first').onclick = function () { go(0); };
+document.getElementById('prev').onclick = function () { go(pos - 1); };
+document.getElementById('next').onclick = function () { go(pos + 1); };
+document.getElementById('last').onclick = function () { go(plies.length - 1); };
+document.addEventListener('keydown', function (e) {
+    if (e.key === 'ArrowLeft') go(pos - 1);
+    if (e.key === 'ArrowRight') go(pos + 1);
+});
+</script>
+{{- if .Engine}}
+<script>{{.Runtime}}</script>
+<script>
+// The engine is squava itself, built for WebAssembly; exploring loads the
+// shown position into it, and it plays and checks the moves from there.
+const engineWasm = {{.Engine}};
+let engineReady = false;
+
+function exploreBoard() {
+    const b = squavaGetBoard();
+    const board = new Array(64).fill(-1);
+    [b.p0, b.p1, b.p2].forEach(function (bits, p) {
+        const v = BigInt(bits);
+        for (let i = 0; i < 64; i++) if ((v >> BigInt(i)) & 1n) board[i] = p;
+    });
+    return { board: board, active: b.activeMask, player: b.playerID, legal: BigInt(b.legalMoves),
+             terminal: b.terminal || BigInt(b.legalMoves) === 0n, winner: b.winnerID };
+}
+
+function drawExplored(last) {
+    explored = exploreBoard();
+    drawCells(explored.board, explored.active, last, function (i) {
+        if (explored.terminal || !((explored.legal >> BigInt(i)) & 1n)) return;
+        squavaApplyMove(i);
+        drawExplored(square(i));
+    });
+    showExplore();
+}
+
+function showExplore() {
+    const status = document.getElementById('explore-status');
+    document.getElementById('explore').textContent = explored ? 'Back to the game' : 'Explore this position';
+    document.getElementById('explore').disabled = !engineReady;
+    document.getElementById('engine').hidden = !explored;
+    if (!engineReady) {
+        status.textContent = 'Loading the engine...';
+    } else if (!explored) {
+        status.textContent = '';
+    } else if (explored.terminal) {
+        document.getElementById('engine').disabled = true;
+        status.textContent = explored.winner >= 0 ? report.players[explored.winner] + ' wins' : 'Game over';
+    } else {
+        document.getElementById('engine').disabled = false;
+        status.textContent = report.players[explored.player] + ' (' + report.symbols[explored.player] + ') to move';
+    }
+}
+
+document.getElementById('explore').onclick = function () {
+    if (explored) {
+        drawBoard();
+    } else if (squavaSetPosition(plies[pos].position)) {
+        drawExplored('');
+    }
+};
+document.getElementById('engine').onclick = function () {
+    const status = document.getElementById('explore-status');
+    status.textContent = 'Thinking...';
+    setTimeout(function () {
+        const idx = squavaGetBestMove(20000);
+        if (idx >= 0) squavaApplyMove(idx);
+        drawExplored(idx >= 0 ? square(idx) : '');
+    }, 0);
+};
+
+const runtime = new Go();
+WebAssembly.instantiate(Uint8Array.from(atob(engineWasm), function (c) { return c.charCodeAt(0); }), runtime.importObject)
+    .then(function (result) {
+        runtime.run(result.instance);
+        engineReady = true;
+        showExplore();
+    });
+</script>
+{{- end}}
+<script>go(plies.length - 1);</script>
+</body>
+</html>
+`))
@@ -0,0 +1,85 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestWriteReport(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	g.play(game.MoveFromIndex(0))
+	g.play(game.MoveFromIndex(63))
+	series := []EvalPoint{
+		{Ply: 0, Winrates: [3]float32{0.3, 0.3, 0.3}},
+		{Ply: 1, Winrates: [3]float32{0.6, 0.2, 0.2}},
+		{Ply: 2, Winrates: [3]float32{0.7, 0.1, 0.2}, Outcome: "win"},
+	}
+	if b := FindBlunders(series, g.movers()); len(b) != 0 {
+		t.Fatalf("Unexpected blunders: %+v", b)
+	}
+	series[1].Winrates[0] = 0.05
+	b := FindBlunders(series, g.movers())
+	if len(b) != 1 || b[0].Ply != 1 || b[0].PlayerID != 0 {
+		t.Fatalf("Expected a blunder by player 1 on move 1, got %+v", b)
+	}
+
+	var sb strings.Builder
+	if err := g.WriteReport(&sb, series); err != nil {
+		t.Fatal(err)
+	}
+	html := sb.String()
+	for _, want := range []string{`"move":"A1"`, `"move":"H8"`, `"blunder":"Blunder:`, `"proven":"Proven win for `} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Report is missing %s", want)
+		}
+	}
+	// Only the graph, drawn from numbers, is written as markup; comments and
+	// names are text.
+	if n := strings.Count(html, "innerHTML"); n != 1 {
+		t.Errorf("Report assigns innerHTML %d times, want only the graph's", n)
+	}
+	if strings.Contains(html, "new Go()") {
+		t.Error("Report without an engine embeds one")
+	}
+
+	wasm := []byte("\x00asm\x01\x00\x00\x00")
+	path := filepath.Join(t.TempDir(), "squava.wasm.gz")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(wasm)
+	zw.Close()
+	if err := os.WriteFile(path, gz.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := LoadReportEngine(path)
+	if err != nil || !bytes.Equal(engine, wasm) {
+		t.Fatalf("LoadReportEngine = %q, %v; want %q", engine, err, wasm)
+	}
+	g.SetReportEngine(engine)
+	sb.Reset()
+	if err := g.WriteReport(&sb, series); err != nil {
+		t.Fatal(err)
+	}
+	html = sb.String()
+	for _, want := range []string{base64.StdEncoding.EncodeToString(wasm), "new Go()", "squavaSetPosition", `"position":"8/8/8/8/8/8/8/8 1 123"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Report with an engine is missing %s", want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("not wasm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadReportEngine(path); err == nil {
+		t.Error("LoadReportEngine accepted a file that is not WebAssembly")
+	}
+}
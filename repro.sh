@@ -0,0 +1,47 @@
+#!/bin/sh
+# Replays the golden games (testdata/golden) on each platform a seed must
+# give the same game on: amd64 with every kernel set the CPU has, amd64
+# built for newer CPUs (where the compiler may fuse multiply-adds), 386,
+# wasm and arm64. A platform this machine cannot run is built as a test
+# binary instead, to be run on one that can.
+set -e
+GO=${GO:-go}
+host=$($GO env GOHOSTARCH)
+wasmexec="$($GO env GOROOT)/lib/wasm"
+
+# run NAME [VAR=value...] runs the golden games on a platform.
+run() {
+	name=$1
+	shift
+	echo "== $name"
+	env "$@" $GO test -count=1 -run 'GoldenGames' .
+}
+
+# build NAME [VAR=value...] builds the test binary of a platform.
+build() {
+	name=$1
+	shift
+	env "$@" $GO test -c -o "squava-$name.test" .
+	echo "== $name: built squava-$name.test; run ./squava-$name.test -test.run GoldenGames in this directory on $name"
+}
+
+run "$host"
+if [ "$host" = amd64 ]; then
+	run amd64-v3 GOAMD64=v3
+	run 386 GOARCH=386
+else
+	build amd64 GOARCH=amd64
+fi
+if command -v node >/dev/null; then
+	run wasm GOOS=js GOARCH=wasm PATH="$PATH:$wasmexec"
+else
+	echo "== wasm: skipped, needs node"
+fi
+if [ "$host" != arm64 ]; then
+	if command -v qemu-aarch64 >/dev/null; then
+		echo "== arm64"
+		GOARCH=arm64 $GO test -count=1 -exec qemu-aarch64 -run 'GoldenGames' .
+	else
+		build arm64 GOARCH=arm64
+	fi
+fi
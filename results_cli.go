@@ -0,0 +1,268 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// --- Match result statistics ---
+
+// tally accumulates per-game scores for a mean and its confidence interval.
+type tally struct {
+	n          int
+	sum, sumSq float64
+}
+
+func (t *tally) add(x float64) {
+	t.n++
+	t.sum += x
+	t.sumSq += x * x
+}
+
+func (t tally) Mean() float64 {
+	if t.n == 0 {
+		return 0
+	}
+	return t.sum / float64(t.n)
+}
+
+// CI95 returns the half-width of the 95% confidence interval of the mean,
+// using the normal approximation.
+func (t tally) CI95() float64 {
+	if t.n < 2 {
+		return math.NaN()
+	}
+	n := float64(t.n)
+	variance := (t.sumSq - t.sum*t.sum/n) / (n - 1)
+	return 1.96 * math.Sqrt(variance/n)
+}
+
+// MatchStats summarizes stored tournament results.
+type MatchStats struct {
+	Engines []string
+	Games   int
+	// HeadToHead[a][b] scores a against b in the games where both played: 1
+	// when a won, 0 when b won, and 1/2 when neither did.
+	HeadToHead map[string]map[string]*tally
+	Seats      [3]tally // Win rate per seat
+	SeatDraws  int
+	Overall    map[string]*tally // Score per engine: 1 per win, 1/3 per draw
+}
+
+// NewMatchStats computes the statistics of recs.
+func NewMatchStats(recs []tournamentRecord) *MatchStats {
+	s := &MatchStats{HeadToHead: map[string]map[string]*tally{}, Overall: map[string]*tally{}}
+	engine := func(name string) {
+		if _, ok := s.Overall[name]; !ok {
+			s.Engines = append(s.Engines, name)
+			s.Overall[name] = &tally{}
+			s.HeadToHead[name] = map[string]*tally{}
+		}
+	}
+	for _, r := range recs {
+		s.Games++
+		draw := true
+		for i, name := range r.Seats {
+			engine(name)
+			win := 0.0
+			switch r.Result[i] {
+			case "win":
+				win, draw = 1, false
+				s.Overall[name].add(1)
+			case "draw":
+				s.Overall[name].add(1.0 / 3)
+			default:
+				s.Overall[name].add(0)
+			}
+			s.Seats[i].add(win)
+		}
+		if draw {
+			s.SeatDraws++
+		}
+		for i, a := range r.Seats {
+			for j, b := range r.Seats {
+				if a == b {
+					continue
+				}
+				h := s.HeadToHead[a][b]
+				if h == nil {
+					h = &tally{}
+					s.HeadToHead[a][b] = h
+				}
+				switch {
+				case r.Result[i] == "win":
+					h.add(1)
+				case r.Result[j] == "win":
+					h.add(0)
+				default:
+					h.add(0.5)
+				}
+			}
+		}
+	}
+	sort.Strings(s.Engines)
+	return s
+}
+
+// formatCI formats a score and its confidence interval as percentages.
+func formatCI(t tally) string {
+	if t.n == 0 {
+		return "-"
+	}
+	if ci := t.CI95(); !math.IsNaN(ci) {
+		return fmt.Sprintf("%.1f±%.1f", 100*t.Mean(), 100*ci)
+	}
+	return fmt.Sprintf("%.1f", 100*t.Mean())
+}
+
+// padLeft right-aligns s in width columns; fmt pads by bytes, not runes.
+func padLeft(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return strings.Repeat(" ", width-n) + s
+	}
+	return s
+}
+
+// Print writes the statistics as formatted tables.
+func (s *MatchStats) Print(w io.Writer) {
+	fmt.Fprintf(w, "%d games, %d engines; scores in %% with 95%% confidence intervals\n\n", s.Games, len(s.Engines))
+
+	fmt.Fprintln(w, "Overall score (1 per win, 1/3 per draw):")
+	for _, name := range s.Engines {
+		fmt.Fprintf(w, "  %-20s %s  (%d games)\n", name, padLeft(formatCI(*s.Overall[name]), 14), s.Overall[name].n)
+	}
+
+	fmt.Fprintln(w, "\nHead to head (row against column: 100 when the row engine won, 50 when neither did):")
+	fmt.Fprintf(w, "  %-20s", "")
+	for _, b := range s.Engines {
+		fmt.Fprintf(w, " %14s", b)
+	}
+	fmt.Fprintln(w)
+	for _, a := range s.Engines {
+		fmt.Fprintf(w, "  %-20s", a)
+		for _, b := range s.Engines {
+			cell := "-"
+			if h := s.HeadToHead[a][b]; h != nil {
+				cell = fmt.Sprintf("%s/%d", formatCI(*h), h.n)
+			}
+			fmt.Fprintf(w, " %s", padLeft(cell, 14))
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "\nWin rate by seat (33.3 each if moving first, second or third gives no advantage):")
+	for i, t := range s.Seats {
+		fmt.Fprintf(w, "  Seat %d: %s\n", i+1, formatCI(t))
+	}
+	if s.Games > 0 {
+		fmt.Fprintf(w, "  Draws:  %.1f\n", 100*float64(s.SeatDraws)/float64(s.Games))
+	}
+}
+
+// WriteCSV writes the statistics in long form: one row per engine score,
+// head-to-head cell, and seat.
+func (s *MatchStats) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"table", "row", "column", "games", "score", "ci95"})
+	row := func(table, a, b string, t tally) {
+		ci := ""
+		if v := t.CI95(); !math.IsNaN(v) {
+			ci = strconv.FormatFloat(v, 'f', 4, 64)
+		}
+		cw.Write([]string{table, a, b, strconv.Itoa(t.n), strconv.FormatFloat(t.Mean(), 'f', 4, 64), ci})
+	}
+	for _, a := range s.Engines {
+		row("overall", a, "", *s.Overall[a])
+	}
+	for _, a := range s.Engines {
+		for _, b := range s.Engines {
+			if h := s.HeadToHead[a][b]; h != nil {
+				row("headtohead", a, b, *h)
+			}
+		}
+	}
+	for i, t := range s.Seats {
+		row("seat", strconv.Itoa(i+1), "", t)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadTournamentResults reads the JSON lines written by `squava tournament
+// -out`.
+func ReadTournamentResults(r io.Reader) ([]tournamentRecord, error) {
+	var recs []tournamentRecord
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec tournamentRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, sc.Err()
+}
+
+// runResults implements `squava results`, summarizing tournament results
+// files.
+func runResults(args []string) int {
+	fs := flag.NewFlagSet("results", flag.ExitOnError)
+	csvPath := fs.String("csv", "", "Also write the statistics as CSV to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava results [-csv stats.csv] results.jsonl...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var recs []tournamentRecord
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		more, err := ReadTournamentResults(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return exitError
+		}
+		recs = append(recs, more...)
+	}
+
+	stats := NewMatchStats(recs)
+	stats.Print(os.Stdout)
+	if *csvPath != "" {
+		f, err := os.Create(*csvPath)
+		if err == nil {
+			err = stats.WriteCSV(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not write %s: %v\n", *csvPath, err)
+			return exitError
+		}
+	}
+	return 0
+}
@@ -0,0 +1,45 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchStats(t *testing.T) {
+	input := `{"game":1,"seats":["a","b","c"],"result":["win","loss","loss"]}
+{"game":2,"seats":["b","c","a"],"result":["loss","win","loss"]}
+
+{"game":3,"seats":["c","a","b"],"result":["draw","draw","draw"]}
+`
+	recs, err := ReadTournamentResults(strings.NewReader(input))
+	if err != nil || len(recs) != 3 {
+		t.Fatalf("Got %d records, %v", len(recs), err)
+	}
+	s := NewMatchStats(recs)
+	if s.Games != 3 || len(s.Engines) != 3 || s.SeatDraws != 1 {
+		t.Errorf("Got %d games, engines %v, %d draws", s.Games, s.Engines, s.SeatDraws)
+	}
+	// a beat b once, b never beat a, and neither won twice.
+	if h := s.HeadToHead["a"]["b"]; h.n != 3 || h.Mean() != 2.0/3 {
+		t.Errorf("a against b: %d games, score %v", h.n, h.Mean())
+	}
+	if seat := s.Seats[0]; seat.Mean() != 1.0/3 {
+		t.Errorf("Seat 1 win rate: %v", seat.Mean())
+	}
+	if got := s.Overall["c"].Mean(); got < 0.444 || got > 0.445 {
+		t.Errorf("c's score: %v, want 4/9", got)
+	}
+
+	var sb strings.Builder
+	if err := s.WriteCSV(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "headtohead,a,b,3,0.6667,") {
+		t.Errorf("Missing head-to-head row in:\n%s", sb.String())
+	}
+	if _, err := ReadTournamentResults(strings.NewReader("{bad")); err == nil {
+		t.Error("Expected an error for a bad line")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math/bits"
+
+	"squava/game"
+	"squava/internal/kernels"
+)
+
+// --- Random numbers ---
+
+// Rand is a stream of pseudo-random numbers from a xorshift64* generator.
+// It is not safe for concurrent use: every goroutine that draws random
+// numbers needs a stream of its own, which Split makes.
+type Rand struct {
+	state uint64
+}
+
+// NewRand returns a stream seeded with seed.
+func NewRand(seed uint64) *Rand {
+	r := &Rand{}
+	r.Seed(seed)
+	return r
+}
+
+// Seed restarts r from seed. The generator's state must not be zero, so 0
+// counts as 1.
+func (r *Rand) Seed(seed uint64) {
+	r.state = max(seed, 1)
+}
+
+// State returns the seed that restarts r where it is now.
+func (r *Rand) State() uint64 {
+	return r.state
+}
+
+func (r *Rand) Uint64() uint64 {
+	r.state ^= r.state >> 12
+	r.state ^= r.state << 25
+	r.state ^= r.state >> 27
+	return r.state * 0x2545F4914F6CDD1D
+}
+
+// Split returns a new stream and advances r by one number. The new stream
+// is seeded with the SplitMix64 hash of that number, so its sequence is
+// unrelated to r's, and splitting the same r gives the same streams every
+// time: a parallel search seeded once is reproducible.
+func (r *Rand) Split() *Rand {
+	return NewRand(splitMix64(r.Uint64()))
+}
+
+// NthStream returns stream i of the streams seeded by seed, such as those of
+// the games of a batch. Stream i is seeded with the i-th number of the
+// SplitMix64 sequence from seed, so consecutive streams are as unrelated as
+// split ones, where seeds counting up from seed would start xorshift64* on
+// related numbers.
+func NthStream(seed uint64, i int) *Rand {
+	return NewRand(splitMix64(seed + uint64(i)*0x9E3779B97F4A7C15))
+}
+
+// splitMix64 returns the SplitMix64 hash of x.
+func splitMix64(x uint64) uint64 {
+	z := x + 0x9E3779B97F4A7C15
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	return z ^ z>>31
+}
+
+// PickBit returns a uniformly random set bit of bb, or -1 if there is none.
+func (r *Rand) PickBit(bb game.Bitboard) int {
+	count := bits.OnesCount64(uint64(bb))
+	if count == 0 {
+		return -1
+	}
+	if count == 1 {
+		return bits.TrailingZeros64(uint64(bb))
+	}
+	hi, _ := bits.Mul64(r.Uint64(), uint64(count))
+	return kernels.SelectBit64(uint64(bb), int(hi))
+}
+
+// mainRand is the stream seeded by -seed. Code running on the main
+// goroutine draws from it, including every engine not given a stream of its
+// own with SetRand.
+var mainRand = Rand{state: 1}
+
+// xrand returns the next number of the main stream.
+func xrand() uint64 { return mainRand.Uint64() }
+
+// PickRandomBit is PickBit on the main stream.
+func PickRandomBit(bb game.Bitboard) int { return mainRand.PickBit(bb) }
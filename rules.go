@@ -0,0 +1,162 @@
+package main
+
+import (
+	"squava/game"
+)
+
+// --- Rules ---
+
+// Rules are the rules of a game on the 8x8 board for up to three players, in
+// turn order X, O, Z: where play starts, which squares may be played, what a
+// stone does, and how the game ends and is scored. MCTSPlayer and SquavaGame
+// play under any Rules; the squava rules keep the engine's fast path.
+//
+// A variant keeps its position in a GameState: the stones, the player to
+// move, the players still in, and, once it is over, the winner. Play must
+// keep gs.Hash the position's hash, as ApplyMoveIdx does, since the search
+// finds positions by it. The threat bitboards are the squava rules' own; a
+// variant that does not build on SquavaRules may ignore them.
+type Rules interface {
+	// Start returns the position games begin from.
+	Start() game.GameState
+	// LegalMoves returns the squares the player to move may play; none
+	// once the game is over.
+	LegalMoves(gs *game.GameState) game.Bitboard
+	// Play plays idx for the player to move, knocking out players as the
+	// rules say and passing the turn to the next player still in.
+	Play(gs *game.GameState, idx int)
+	// Terminal reports whether the game is over and who won it, or -1 for
+	// a draw.
+	Terminal(gs *game.GameState) (winner int, over bool)
+	// Rewards returns each player's share of a finished game, from 0 to 1.
+	Rewards(gs *game.GameState) [3]float32
+}
+
+// SquavaRules are the rules of squava: four in a row wins, three in a row
+// knocks the player out, and the last player left wins. A player who can win
+// must, and otherwise must block the next player's win. A full board is a
+// draw between the players left, even when its last stone knocked its player
+// out, which GameState does not see as the end.
+type SquavaRules struct{}
+
+func (SquavaRules) Start() game.GameState {
+	return game.NewGameState(game.Board{}, 0, 0b111)
+}
+
+func (SquavaRules) LegalMoves(gs *game.GameState) game.Bitboard {
+	return gs.LegalMoves()
+}
+
+func (SquavaRules) Play(gs *game.GameState, idx int) {
+	gs.ApplyMoveIdx(idx)
+}
+
+func (SquavaRules) Terminal(gs *game.GameState) (int, bool) {
+	if gs.Terminal {
+		return gs.WinnerID, true
+	}
+	return -1, gs.Board.Occupied == ^game.Bitboard(0)
+}
+
+func (SquavaRules) Rewards(gs *game.GameState) [3]float32 {
+	return ScoreTerminal(gs.ActiveMask, gs.WinnerID)
+}
+
+// SetRules makes the player search the game under rules. Squava's own, nil
+// or SquavaRules, keep the engine's fast path: threat-aware expansion and
+// playouts. Other rules are searched by the same graph search, which
+// expands the squares rules.LegalMoves gives, plays out uniformly at random
+// with PlayoutRules and scores with rules.Rewards, in a table of the player's
+// own, as the same stones may be another position under other rules.
+// Personalities, books and playout statistics are squava's and left out of
+// such searches.
+func (m *MCTSPlayer) SetRules(rules Rules) {
+	if _, ok := rules.(SquavaRules); ok {
+		rules = nil
+	}
+	m.rules = rules
+	m.root = nil
+	m.recentRoots = nil
+	m.resetTable()
+	// The helpers' graphs were grown under the old rules too.
+	for _, h := range m.helpers {
+		h.rules = rules
+		h.root = nil
+		h.recentRoots = nil
+		h.table.Clear()
+	}
+}
+
+// The rules are called on a copy of the position in m.variant: a position
+// passed to an interface method would escape to the heap, and the search's
+// positions, which stay on the stack, with it.
+
+// terminal reports whether the game in gs is over under m's rules, and who
+// won it, or -1 for a draw.
+func (m *MCTSPlayer) terminal(gs *game.GameState) (int, bool) {
+	if m.rules == nil {
+		return gs.IsTerminal()
+	}
+	m.variant = *gs
+	return m.rules.Terminal(&m.variant)
+}
+
+// play plays idx in gs under m's rules.
+func (m *MCTSPlayer) play(gs *game.GameState, idx int) {
+	if m.rules == nil {
+		gs.ApplyMoveIdx(idx)
+		return
+	}
+	m.variant = *gs
+	m.rules.Play(&m.variant, idx)
+	*gs = m.variant
+}
+
+// moves returns the moves m searches in gs: under squava, the ones worth
+// playing, and under other rules, every legal one.
+func (m *MCTSPlayer) moves(gs *game.GameState) game.Bitboard {
+	if m.rules == nil {
+		return gs.GetBestMoves()
+	}
+	m.variant = *gs
+	return m.rules.LegalMoves(&m.variant)
+}
+
+// newNode returns a node for gs from m's arena, with the moves to try under
+// m's rules.
+func (m *MCTSPlayer) newNode(gs game.GameState) *MCGSNode {
+	n := m.arena.newNode(gs)
+	if m.rules != nil {
+		n.untriedMoves = 0
+		if _, over := m.terminal(&gs); !over {
+			n.untriedMoves = m.moves(&gs)
+		}
+	}
+	return n
+}
+
+// playOut plays gs out under m's rules, or scores it if the game is over,
+// returning the players' rewards and the moves played.
+func (m *MCTSPlayer) playOut(gs *game.GameState) ([3]float32, int) {
+	m.variant = *gs
+	return PlayoutRules(m.rules, &m.variant, m.rand)
+}
+
+// PlayoutRules plays gs out to the end under rules, picking legal moves
+// uniformly at random, and returns the players' rewards and the moves
+// played.
+func PlayoutRules(rules Rules, gs *game.GameState, r *Rand) ([3]float32, int) {
+	steps := 0
+	for {
+		if _, over := rules.Terminal(gs); over {
+			break
+		}
+		idx := r.PickBit(rules.LegalMoves(gs))
+		if idx == -1 {
+			break
+		}
+		rules.Play(gs, idx)
+		steps++
+	}
+	return rules.Rewards(gs), steps
+}
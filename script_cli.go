@@ -0,0 +1,95 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"squava/game"
+)
+
+// MoveScript reads human moves non-interactively from a file or pipe. Moves
+// are separated by whitespace; '#' starts a comment that runs to the end of
+// the line.
+type MoveScript struct {
+	name    string
+	scanner *bufio.Scanner
+	line    int
+	pending []string
+}
+
+func NewMoveScript(r io.Reader, name string) *MoveScript {
+	return &MoveScript{name: name, scanner: bufio.NewScanner(r)}
+}
+
+// Next returns the next move token and the line it came from.
+func (s *MoveScript) Next() (string, bool) {
+	for len(s.pending) == 0 {
+		if !s.scanner.Scan() {
+			return "", false
+		}
+		s.line++
+		text := s.scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		s.pending = strings.Fields(text)
+	}
+	tok := s.pending[0]
+	s.pending = s.pending[1:]
+	return tok, true
+}
+
+// fail reports a script error with its location and aborts the program.
+func (s *MoveScript) fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "%s:%d: %s\n", s.name, s.line, fmt.Sprintf(format, args...))
+	os.Exit(exitUsage)
+}
+
+// --- Scripted Player ---
+// ScriptedPlayer is a human seat whose moves come from a MoveScript. All
+// scripted seats share one script, consumed in turn order.
+type ScriptedPlayer struct {
+	info   PlayerInfo
+	script *MoveScript
+}
+
+func NewScriptedPlayer(name, symbol string, id int, script *MoveScript) *ScriptedPlayer {
+	return &ScriptedPlayer{info: PlayerInfo{name: name, symbol: symbol, id: id}, script: script}
+}
+func (p *ScriptedPlayer) Name() string   { return p.info.name }
+func (p *ScriptedPlayer) Symbol() string { return p.info.symbol }
+func (p *ScriptedPlayer) ID() int        { return p.info.id }
+func (p *ScriptedPlayer) GetMove(board game.Board, players []int, turnIdx int) game.Move {
+	tok, ok := p.script.Next()
+	if !ok {
+		p.script.fail("script ended before the game finished (%s to move)", p.info.name)
+	}
+	if strings.EqualFold(tok, "resign") {
+		return game.ResignMove
+	}
+	move, err := game.ParseMove(tok)
+	if errors.Is(err, game.ErrMoveOutOfBounds) {
+		p.script.fail("%s: move out of bounds", tok)
+	} else if err != nil {
+		p.script.fail("%s: %v", tok, err)
+	}
+	mask := game.Bitboard(1) << uint(move.ToIndex())
+	if board.Occupied&mask != 0 {
+		p.script.fail("%s: cell already occupied", tok)
+	}
+	if forced := game.GetForcedMoves(board, players, turnIdx); forced != 0 && forced&mask == 0 {
+		p.script.fail("%s: %s must play one of %s", tok, p.info.name, formatSquares(forced))
+	}
+	return move
+}
+
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,32 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestMoveScriptTokens(t *testing.T) {
+	s := NewMoveScript(strings.NewReader("A1 b2 # comment C3\n\n  resign\n"), "test")
+	want := []string{"A1", "b2", "resign"}
+	for _, w := range want {
+		tok, ok := s.Next()
+		if !ok || tok != w {
+			t.Fatalf("Expected %q, got %q (%v)", w, tok, ok)
+		}
+	}
+	if s.line != 3 {
+		t.Errorf("Expected to be on line 3, got %d", s.line)
+	}
+	if _, ok := s.Next(); ok {
+		t.Errorf("Expected end of script")
+	}
+
+	p := NewScriptedPlayer("P", "X", 0, NewMoveScript(strings.NewReader("d4"), "test"))
+	if m := p.GetMove(game.Board{}, []int{0, 1, 2}, 0); m != game.MoveFromIndex(27) {
+		t.Errorf("Expected D4, got %v", m)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SeatSpec describes who plays a seat, parsed from a player type such as
+// "human", "mcts", "mcts:trappy@5000" or "cmd:./my-engine --fast".
+type SeatSpec struct {
+	Kind        string       // "human", "mcts" or "cmd"
+	Personality *Personality // For "mcts"; nil for the standard engine
+	Iterations  int          // For "mcts"; 0 uses the game's default
+	Command     string       // For "cmd": the external engine to run
+}
+
+// ParsePlayerType parses a player type into a SeatSpec.
+func ParsePlayerType(t string) (SeatSpec, error) {
+	if cmd, ok := strings.CutPrefix(t, "cmd:"); ok {
+		if strings.TrimSpace(cmd) == "" {
+			return SeatSpec{}, fmt.Errorf("player type %q has no command", t)
+		}
+		return SeatSpec{Kind: "cmd", Command: cmd}, nil
+	}
+	var spec SeatSpec
+	rest, iters, hasIters := strings.Cut(t, "@")
+	kind, name, hasName := strings.Cut(rest, ":")
+	spec.Kind = kind
+	if kind != "human" && kind != "mcts" {
+		return SeatSpec{}, fmt.Errorf("unknown player type %q", kind)
+	}
+	if (hasName || hasIters) && kind != "mcts" {
+		return SeatSpec{}, fmt.Errorf("player type %q cannot have a personality or iterations", kind)
+	}
+	if hasName {
+		p, ok := Personalities[name]
+		if !ok {
+			return SeatSpec{}, fmt.Errorf("unknown personality %q (available: %s)", name, strings.Join(PersonalityNames(), ", "))
+		}
+		spec.Personality = p
+	}
+	if hasIters {
+		n, err := strconv.Atoi(iters)
+		if err != nil || n <= 0 {
+			return SeatSpec{}, fmt.Errorf("bad iteration count %q", iters)
+		}
+		spec.Iterations = n
+	}
+	return spec, nil
+}
+
+// PlayerType formats the spec as a player type; iterations equal to
+// defaultIterations are left out.
+func (s SeatSpec) PlayerType(defaultIterations int) string {
+	switch s.Kind {
+	case "cmd":
+		return "cmd:" + s.Command
+	case "mcts":
+		t := "mcts"
+		if s.Personality != nil {
+			t += ":" + s.Personality.Name
+		}
+		if s.Iterations != 0 && s.Iterations != defaultIterations {
+			t += "@" + strconv.Itoa(s.Iterations)
+		}
+		return t
+	}
+	return s.Kind
+}
@@ -0,0 +1,183 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"squava/game"
+	"squava/internal/kernels"
+)
+
+// --- Self-check ---
+
+// selfCheckSeed fixes the boards and games of the checks, so that a failure
+// can be reproduced.
+const selfCheckSeed = 20240611
+
+// selfCheck is one check of `squava selfcheck`. run returns what it
+// checked, or the first thing it found wrong.
+type selfCheck struct {
+	name string
+	run  func(scale float64) (string, error)
+}
+
+var selfChecks = []selfCheck{
+	{"kernels", selfCheckKernels},
+	{"perft", selfCheckPerft},
+	{"zobrist", selfCheckZobrist},
+}
+
+// selfCheckKernels checks the SIMD kernels in use against the portable Go
+// versions, and the Go threat kernel against the line tables, which find
+// the threats another way.
+func selfCheckKernels(scale float64) (string, error) {
+	r := NewRand(selfCheckSeed)
+	boards := int(100000 * scale)
+	for i := 0; i < boards; i++ {
+		b := r.Uint64() & r.Uint64()
+		e := ^b & (r.Uint64() | r.Uint64())
+		wGo, lGo := kernels.WinsAndLossesGo(b, e)
+		if w, l := kernels.WinsAndLosses(b, e); w != wGo || l != lGo {
+			return "", fmt.Errorf("threats of %016x with %016x empty: %s kernel gives %016x, %016x; Go gives %016x, %016x",
+				b, e, kernels.Name(), w, l, wGo, lGo)
+		}
+		var tw, tl uint64
+		for idx := 0; idx < 64; idx++ {
+			lw, ll := kernels.LineWinsAndLosses(b, idx)
+			tw, tl = tw|lw, tl|ll
+		}
+		if w, l := tw&e, tl&e&^tw; w != wGo || l != lGo&^wGo {
+			return "", fmt.Errorf("threats of %016x with %016x empty: line tables give %016x, %016x; Go gives %016x, %016x",
+				b, e, w, l, wGo, lGo&^wGo)
+		}
+	}
+
+	var qs, us [64]float32
+	for i := 0; i < boards/10; i++ {
+		n := 1 + int(r.Uint64()%64)
+		for j := 0; j < n; j++ {
+			qs[j] = float32(r.Uint64()>>40) / (1 << 24)
+			us[j] = float32(r.Uint64()>>40) / (1 << 20)
+			if r.Uint64()%4 == 0 && j > 0 {
+				// Ties must go to the first edge.
+				qs[j], us[j] = qs[j-1], us[j-1]
+			}
+		}
+		coeff := float32(r.Uint64()>>40) / (1 << 22)
+		if got, want := kernels.SelectBestEdge(qs[:n], us[:n], coeff), kernels.SelectBestEdgeGo(qs[:n], us[:n], coeff); got != want {
+			return "", fmt.Errorf("edge selection among %d edges, coefficient %g: %s kernel picks %d, Go picks %d (qs %v, us %v)",
+				n, coeff, kernels.Name(), got, want, qs[:n], us[:n])
+		}
+	}
+	return fmt.Sprintf("%s kernels match Go and the line tables on %d boards", kernels.Name(), boards), nil
+}
+
+// selfCheckPositions are positions of TestPerft with their path counts.
+var selfCheckPositions = []struct {
+	position string
+	counts   []uint64
+}{
+	{"8/8/8/8/8/8/8/8 1 123", []uint64{64, 4032, 249984}},
+	{"O4XOO/O1OZ4/8/1Z1Z1Z2/O1OO4/ZX1XZ2Z/1X3X1X/2X1X3 3 123", []uint64{41, 80, 2620}},
+	{"1O1ZZOZ1/OZ1O4/Z1O5/1XXZ1XZZ/OXX1Z3/O1OXO2X/2X4Z/5OX1 2 23", []uint64{35, 1055, 26331}},
+}
+
+// selfCheckPerft counts the move paths of positions with known counts.
+func selfCheckPerft(float64) (string, error) {
+	total := uint64(0)
+	for _, p := range selfCheckPositions {
+		gs, err := game.ParsePosition(p.position)
+		if err != nil {
+			return "", err
+		}
+		for i, want := range p.counts {
+			got := Perft(&gs, i+1)
+			if got != want {
+				return "", fmt.Errorf("%s: perft(%d) = %d, want %d", p.position, i+1, got, want)
+			}
+			total += got
+		}
+	}
+	return fmt.Sprintf("%d positions, %d paths as expected", len(selfCheckPositions), total), nil
+}
+
+// selfCheckZobrist plays random games, checking after every move that the
+// incrementally updated hash is the hash of the position, along with the
+// rest of the state's invariants, and that taking the move back restores
+// the state exactly.
+func selfCheckZobrist(scale float64) (string, error) {
+	r := NewRand(selfCheckSeed)
+	games := max(int(1000*scale), 1)
+	moves := 0
+	for i := 0; i < games; i++ {
+		gs := game.NewGameState(game.Board{}, 0, 0b111)
+		for ply := 1; !gs.Terminal; ply++ {
+			candidates := gs.GetBestMoves()
+			if candidates == 0 {
+				break // The last square eliminated a player, leaving no move
+			}
+			idx := r.PickBit(candidates)
+			before := gs
+			u := gs.MakeMove(idx)
+			if err := gs.Validate(); err != nil {
+				return "", fmt.Errorf("game %d, move %d (%s): %v", i+1, ply, game.MoveFromIndex(idx), err)
+			}
+			after := gs
+			gs.UnmakeMove(u)
+			if gs != before {
+				return "", fmt.Errorf("game %d, move %d (%s): taking the move back does not restore the state", i+1, ply, game.MoveFromIndex(idx))
+			}
+			gs = after
+			moves++
+		}
+	}
+	return fmt.Sprintf("%d games, %d moves hashed consistently", games, moves), nil
+}
+
+// runSelfCheck implements `squava selfcheck`, a quick check that a build
+// works on this machine: its kernels, move generation and hashing give the
+// expected answers, and its speed.
+func runSelfCheck(args []string) int {
+	fs := flag.NewFlagSet("selfcheck", flag.ExitOnError)
+	scale := fs.Float64("scale", 1, "Multiply the work of every check by this")
+	bench := fs.Bool("bench", true, "Also measure the playout and search speed")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava selfcheck [-scale X] [-bench=false]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *scale <= 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	fmt.Printf("Platform:  %s/%s, %s, %s kernels, %d CPUs\n", runtime.GOOS, runtime.GOARCH, runtime.Version(), kernels.Name(), runtime.NumCPU())
+	failed := 0
+	for _, c := range selfChecks {
+		summary, err := c.run(*scale)
+		if err != nil {
+			failed++
+			fmt.Printf("%-9s  FAIL  %v\n", c.name+":", err)
+			continue
+		}
+		fmt.Printf("%-9s  ok    %s\n", c.name+":", summary)
+	}
+	if *bench && failed == 0 {
+		res, err := RunBench(*scale / 10)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		fmt.Printf("%-9s  %.0f playouts/s, %.0f search rollouts/s, score %.0f (see squava bench)\n", "speed:", res.Playouts, res.SearchRollouts, res.Score)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d check(s) failed; please report them with the platform line above\n", failed)
+		return exitError
+	}
+	fmt.Println("All checks passed.")
+	return 0
+}
@@ -0,0 +1,15 @@
+//go:build !wasm
+
+package main
+
+import "testing"
+
+func TestSelfChecks(t *testing.T) {
+	for _, c := range selfChecks {
+		if summary, err := c.run(0.02); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if summary == "" {
+			t.Errorf("%s: no summary", c.name)
+		}
+	}
+}
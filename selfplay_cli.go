@@ -0,0 +1,199 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"squava/game"
+)
+
+// --- Self-play ---
+
+// SelfPlaySettings are how the engine plays its self-play games.
+type SelfPlaySettings struct {
+	Iterations  int         // Root visits per move
+	Temperature float64     // Picks moves by visits^(1/Temperature) in the opening; 0 plays the most visited
+	TempMoves   int         // Moves of the game, from the first, played with the temperature
+	Noise       float64     // Chance of playing a random one of the good moves instead
+	Opening     []game.Move // Moves the game starts with, played as given
+}
+
+// SelfPlayGame plays a game of the engine against itself with a and returns
+// its moves as a record. The game follows from the state of r alone, which
+// also seeds a's searches, so it is the same on any goroutine, and games of
+// different streams differ in their searches too. It ends the game where
+// SquavaRules do.
+func SelfPlayGame(a *Analyzer, r *Rand, s SelfPlaySettings) *game.GameRecord {
+	rec := &game.GameRecord{Players: [3]string{"mcts", "mcts", "mcts"}, Iterations: s.Iterations}
+	a.ResetWithSeed(r.Uint64())
+	var rules SquavaRules
+	gs := rules.Start()
+	for _, over := rules.Terminal(&gs); !over; _, over = rules.Terminal(&gs) {
+		moves := gs.GetBestMoves()
+		var move game.Move
+		switch {
+		case len(rec.Moves) < len(s.Opening):
+			move = s.Opening[len(rec.Moves)]
+		case bits.OnesCount64(uint64(moves)) == 1:
+			move = game.MoveFromIndex(bits.TrailingZeros64(uint64(moves)))
+		case s.Noise > 0 && float64(r.Uint64()>>11)/float64(1<<53) < s.Noise:
+			move = game.MoveFromIndex(r.PickBit(moves))
+		default:
+			an := a.Analyze(gs, s.Iterations)
+			move = an.Best
+			if s.Temperature > 0 && len(rec.Moves) < s.TempMoves {
+				visits := make([]int, len(an.Moves))
+				for i, e := range an.Moves {
+					visits[i] = e.Visits
+				}
+				if i := pickByVisits(visits, s.Temperature, r); i >= 0 {
+					move = an.Moves[i].Move
+				}
+			}
+		}
+		rec.Moves = append(rec.Moves, move)
+		gs.ApplyMove(move)
+	}
+	return rec
+}
+
+// selfPlayShard is a shard of self-play games being collected: the samples
+// of each of its games, in the order of the games.
+type selfPlayShard struct {
+	samples [][]TrainingSample
+	games   int
+}
+
+// runSelfPlay implements `squava selfplay`, which plays the engine against
+// itself on all cores and writes the games as training data shards.
+func runSelfPlay(args []string) int {
+	fs := flag.NewFlagSet("selfplay", flag.ExitOnError)
+	games := fs.Int("games", 1000, "Games to play")
+	out := fs.String("out", "", "Directory to write the shards to, as selfplay-00000.npz and on")
+	shardGames := fs.Int("shard-games", 500, "Games per shard")
+	iterations := fs.Int("iterations", 800, "MCTS visits per move")
+	temperature := fs.Float64("temperature", 1, "Play the opening moves at random by visits^(1/temperature) (0 for the most visited)")
+	tempMoves := fs.Int("temp-moves", 8, "Moves of each game played with -temperature")
+	noise := fs.Float64("noise", 0.05, "Chance of playing a random good move instead of searching")
+	augment := fs.Bool("augment", true, "Add the 7 rotations and reflections of every sample")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Games to play at the same time")
+	mb := fs.Int("hash", DefaultAnalyzerMB, "Megabytes of search graph per game played at the same time")
+	seed := fs.Int64("seed", 0, "Random seed of the games, each of which gets a stream of its own from it (0 for time-based)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava selfplay -games 10000 -out data/ [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *out == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	if *games < 1 || *shardGames < 1 || *iterations < 1 || *concurrency < 1 || *mb < 1 ||
+		*temperature < 0 || *tempMoves < 0 || *noise < 0 || *noise > 1 {
+		fmt.Fprintln(os.Stderr, "-games, -shard-games, -iterations, -concurrency and -hash must be at least 1, -temperature and -temp-moves not negative, and -noise from 0 to 1")
+		return exitUsage
+	}
+	if (*temperature == 0 || *tempMoves == 0) && *noise == 0 {
+		fmt.Fprintln(os.Stderr, "-temperature and -temp-moves, or -noise, must be above 0, so that the games differ")
+		return exitUsage
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	settings := SelfPlaySettings{Iterations: *iterations, Temperature: *temperature, TempMoves: *tempMoves, Noise: *noise}
+
+	// Game i goes to shard i / shardGames, which is written once all its
+	// games are in, so shards hold the same games however they finish.
+	shards := (*games + *shardGames - 1) / *shardGames
+	pending := make([]selfPlayShard, shards)
+	for k := range pending {
+		pending[k].samples = make([][]TrainingSample, min(*shardGames, *games-k**shardGames))
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed error
+	played, samples, written := 0, 0, 0
+	start := time.Now()
+	for range min(*concurrency, *games) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := NewAnalyzer(NodesForMB(*mb))
+			for i := range next {
+				rec := SelfPlayGame(a, NthStream(uint64(*seed), i), settings)
+				more, err := TrainingSamples(rec, *augment)
+
+				// The game that completes a shard takes its samples, and
+				// writes it once the others may go on.
+				var full [][]TrainingSample
+				mu.Lock()
+				if err != nil && failed == nil {
+					failed = fmt.Errorf("game %d: %v", i+1, err)
+				}
+				k := i / *shardGames
+				sh := &pending[k]
+				sh.samples[i%*shardGames], sh.games = more, sh.games+1
+				played, samples = played+1, samples+len(more)
+				if sh.games == len(sh.samples) && failed == nil {
+					full, sh.samples = sh.samples, nil
+				}
+				mu.Unlock()
+
+				if full != nil {
+					path := filepath.Join(*out, fmt.Sprintf("selfplay-%05d.npz", k))
+					err := writeTrainingFile(path, slices.Concat(full...))
+					mu.Lock()
+					if err != nil && failed == nil {
+						failed = err
+					}
+					written++
+					mu.Unlock()
+				}
+				mu.Lock()
+				secs := time.Since(start).Seconds()
+				fmt.Fprintf(os.Stderr, "\r%d of %d games, %d samples, %d of %d shards; %.1f games/s, %.0f samples/s",
+					played, *games, samples, written, shards, float64(played)/secs, float64(samples)/secs)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < *games; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	fmt.Fprintln(os.Stderr)
+	if failed != nil {
+		fmt.Fprintln(os.Stderr, failed)
+		return exitError
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d samples of %d games to %d shards in %s in %v\n", samples, played, shards, *out, time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// writeTrainingFile writes samples to the .npz file path.
+func writeTrainingFile(path string, samples []TrainingSample) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteTrainingData(f, samples); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
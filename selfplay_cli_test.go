@@ -0,0 +1,45 @@
+//go:build !wasm
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSelfPlay(t *testing.T) {
+	s := SelfPlaySettings{Iterations: 200, Temperature: 1, TempMoves: 8, Noise: 0.1}
+	var r Rand
+	r.Seed(7)
+	rec := SelfPlayGame(NewAnalyzer(MinMaxNodes), &r, s)
+	r.Seed(7)
+	again := SelfPlayGame(NewAnalyzer(MinMaxNodes), &r, s)
+	if !slices.Equal(rec.Moves, again.Moves) {
+		t.Errorf("Self-play games of the same seed differ:\n%v\n%v", rec.Moves, again.Moves)
+	}
+	positions, err := rec.Positions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !positions[len(positions)-1].Terminal {
+		t.Errorf("Self-play game did not finish: %v", rec.Moves)
+	}
+	if samples, err := TrainingSamples(rec, false); err != nil || len(samples) == 0 {
+		t.Errorf("No training samples from self-play game: %v", err)
+	}
+
+	dir := t.TempDir()
+	if code := runSelfPlay([]string{"-games", "3", "-shard-games", "2", "-iterations", "100", "-seed", "1", "-out", dir}); code != 0 {
+		t.Fatalf("selfplay exited with %d", code)
+	}
+	for _, name := range []string{"selfplay-00000.npz", "selfplay-00001.npz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if code := runSelfPlay([]string{"-games", "2", "-temperature", "0", "-noise", "0", "-out", dir}); code != exitUsage {
+		t.Errorf("Expected self-play without randomness refused, got exit code %d", code)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"math/bits"
+
+	"squava/game"
+)
+
+// --- Exact solver ---
+
+// CanForceWin reports whether player id can force a win from gs whatever the
+// others play, finishing by its moves-th move from here: by completing a
+// 4-in-a-row, or by being the last player left once the others have
+// eliminated themselves. Every legal move of every player is searched, so
+// the cost grows quickly with moves; 2 or 3 is practical.
+func CanForceWin(gs *game.GameState, id, moves int) bool {
+	if gs.Terminal {
+		return gs.WinnerID == id
+	}
+	if gs.ActiveMask&(1<<uint(id)) == 0 || moves == 0 {
+		return false
+	}
+	if gs.PlayerID == id {
+		if gs.Wins[id] != 0 {
+			return true
+		}
+		if moves == 1 {
+			// A move that neither wins nor leaves the player alone cannot
+			// finish the game in time.
+			return false
+		}
+		for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+			u := gs.MakeMove(bits.TrailingZeros64(uint64(bb)))
+			win := CanForceWin(gs, id, moves-1)
+			gs.UnmakeMove(u)
+			if win {
+				return true
+			}
+		}
+		return false
+	}
+	for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+		u := gs.MakeMove(bits.TrailingZeros64(uint64(bb)))
+		win := CanForceWin(gs, id, moves)
+		gs.UnmakeMove(u)
+		if !win {
+			return false
+		}
+	}
+	return true
+}
+
+// WinningMoves returns the legal moves of the player to move that force a
+// win within depth of its moves, counting the move itself.
+func WinningMoves(gs game.GameState, depth int) game.Bitboard {
+	var wins game.Bitboard
+	for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		child := gs
+		child.ApplyMoveIdx(idx)
+		if CanForceWin(&child, gs.PlayerID, depth-1) {
+			wins |= game.Bitboard(1) << uint(idx)
+		}
+	}
+	return wins
+}
+
+// MoveLoses reports whether playing move in gs loses by force: it eliminates
+// the player, or lets another player force a win within depth of that
+// player's moves.
+func MoveLoses(gs game.GameState, move game.Move, depth int) bool {
+	id := gs.PlayerID
+	child := gs
+	child.ApplyMove(move)
+	if child.Terminal {
+		return child.WinnerID != id
+	}
+	if child.ActiveMask&(1<<uint(id)) == 0 {
+		return true
+	}
+	for _, other := range child.ActiveIDs() {
+		if other != id && CanForceWin(&child, other, depth) {
+			return true
+		}
+	}
+	return false
+}
+
+// LosingMoves returns the legal moves of the player to move for which
+// MoveLoses holds.
+func LosingMoves(gs game.GameState, depth int) game.Bitboard {
+	var losing game.Bitboard
+	for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		if MoveLoses(gs, game.MoveFromIndex(idx), depth) {
+			losing |= game.Bitboard(1) << uint(idx)
+		}
+	}
+	return losing
+}
+
+// DefendingMove picks the move for the player to move that puts off a forced
+// win by player id the longest, searching up to moves of id's moves. Among
+// equally good moves it keeps the first.
+func DefendingMove(gs game.GameState, id, moves int) game.Move {
+	best, bestDepth := -1, -1
+	for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		child := gs
+		child.ApplyMoveIdx(idx)
+		d := 0
+		for d <= moves && !CanForceWin(&child, id, d) {
+			d++
+		}
+		if d > bestDepth {
+			best, bestDepth = idx, d
+		}
+	}
+	return game.MoveFromIndex(best)
+}
+
+// --- Proven outcomes ---
+
+// Outcome is what the exact solver has proven about a move for the player
+// who makes it.
+type Outcome int8
+
+const (
+	Unproven   Outcome = iota // Not proven, so only estimated
+	ProvenWin                 // The mover can force a win
+	ProvenDraw                // Every way the game can go ends in a draw the mover shares
+	ProvenLoss                // The mover is eliminated, or another player can force a win
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case ProvenWin:
+		return "win"
+	case ProvenDraw:
+		return "draw"
+	case ProvenLoss:
+		return "loss"
+	}
+	return "unproven"
+}
+
+// ProofEmpties is the number of empty squares at or below which an analysis
+// proves the outcome of every candidate move, searching to the end of the
+// game.
+const ProofEmpties = 8
+
+// ProveMove returns the outcome of move in gs for the player to move, as
+// far as the exact solver sees within depth of the players' moves. A draw
+// is only proven by searching every way the game can go, so depth should
+// reach the end of the game for one.
+func ProveMove(gs game.GameState, move game.Move, depth int) Outcome {
+	id := gs.PlayerID
+	child := gs
+	child.ApplyMove(move)
+	switch {
+	case child.Terminal && child.WinnerID == id:
+		return ProvenWin
+	case child.Terminal && child.WinnerID < 0:
+		return ProvenDraw
+	case child.Terminal || child.ActiveMask&(1<<uint(id)) == 0:
+		return ProvenLoss
+	case CanForceWin(&child, id, depth-1):
+		return ProvenWin
+	}
+	for _, other := range child.ActiveIDs() {
+		if other != id && CanForceWin(&child, other, depth) {
+			return ProvenLoss
+		}
+	}
+	if bits.OnesCount64(uint64(^child.Board.Occupied)) <= depth && alwaysDraws(&child, id) {
+		return ProvenDraw
+	}
+	return Unproven
+}
+
+// ProveMoves proves every legal move of gs once it is within ProofEmpties
+// of the end, as an analysis does: outcomes[idx] is the outcome of the move
+// on idx for the player to move, and o the outcome of the position. ok is
+// false, with nothing proven, earlier in the game or once it is over.
+func ProveMoves(gs game.GameState) (outcomes [64]Outcome, o Outcome, ok bool) {
+	empties := bits.OnesCount64(uint64(^gs.Board.Occupied))
+	if empties > ProofEmpties || gs.Terminal {
+		return outcomes, Unproven, false
+	}
+	var proven []Outcome
+	for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		outcomes[idx] = ProveMove(gs, game.MoveFromIndex(idx), empties)
+		proven = append(proven, outcomes[idx])
+	}
+	return outcomes, BestOutcome(proven), true
+}
+
+// alwaysDraws reports whether every way the game can go from gs ends in a
+// draw with player id still in it.
+func alwaysDraws(gs *game.GameState, id int) bool {
+	if gs.Terminal {
+		return gs.WinnerID < 0 && gs.ActiveMask&(1<<uint(id)) != 0
+	}
+	for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+		u := gs.MakeMove(bits.TrailingZeros64(uint64(bb)))
+		draws := alwaysDraws(gs, id)
+		gs.UnmakeMove(u)
+		if !draws {
+			return false
+		}
+	}
+	return true
+}
+
+// BestOutcome returns the outcome of the position for the player to move
+// given the outcomes of its moves: a win if any move wins, and otherwise a
+// draw or a loss only if every move is proven.
+func BestOutcome(outcomes []Outcome) Outcome {
+	best := ProvenLoss
+	for _, o := range outcomes {
+		switch {
+		case o == ProvenWin:
+			return ProvenWin
+		case o == Unproven:
+			best = Unproven
+		case o == ProvenDraw && best == ProvenLoss:
+			best = ProvenDraw
+		}
+	}
+	if len(outcomes) == 0 {
+		return Unproven
+	}
+	return best
+}
+
+// --- Perft ---
+
+// Perft counts the move paths of exactly depth moves from gs under the full
+// rules: forced wins and blocks, eliminations, and the end of the game.
+// Paths that end the game early are not counted. It is the standard check of
+// move generation: any change to the rules code should leave the counts of
+// known positions unchanged.
+func Perft(gs *game.GameState, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+	legal := gs.LegalMoves()
+	if depth == 1 {
+		return uint64(bits.OnesCount64(uint64(legal)))
+	}
+	var n uint64
+	for bb := legal; bb != 0; bb &= bb - 1 {
+		u := gs.MakeMove(bits.TrailingZeros64(uint64(bb)))
+		n += Perft(gs, depth-1)
+		gs.UnmakeMove(u)
+	}
+	return n
+}
+
+// PerftDivide returns Perft of depth-1 after each legal move of gs, so a
+// count that differs from a reference can be traced to the move that
+// differs.
+func PerftDivide(gs *game.GameState, depth int) map[game.Move]uint64 {
+	counts := map[game.Move]uint64{}
+	if depth < 1 {
+		return counts
+	}
+	for bb := gs.LegalMoves(); bb != 0; bb &= bb - 1 {
+		idx := bits.TrailingZeros64(uint64(bb))
+		child := *gs
+		child.ApplyMoveIdx(idx)
+		counts[game.MoveFromIndex(idx)] = Perft(&child, depth-1)
+	}
+	return counts
+}
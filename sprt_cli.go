@@ -0,0 +1,188 @@
+//go:build !wasm
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+)
+
+// --- Sequential probability ratio test ---
+
+// eloScore is the expected score of a player rated elo above two equal
+// opponents, with the winner of a 3-player game chosen in proportion to
+// 10^(rating/400). Equal strength scores 1/3.
+func eloScore(elo float64) float64 {
+	r := math.Pow(10, elo/400)
+	return r / (r + 2)
+}
+
+// scoreElo is the inverse of eloScore.
+func scoreElo(score float64) float64 {
+	score = math.Min(math.Max(score, 1e-6), 1-1e-6)
+	return 400 * math.Log10(2*score/(1-score))
+}
+
+// SPRT decides between the hypotheses that a candidate is elo0 or elo1
+// stronger than its opponents from its game scores (1 for a win, 1/3 for a
+// draw, 0 for a loss), using the normal approximation of the generalized
+// SPRT.
+type SPRT struct {
+	Elo0, Elo1  float64
+	Alpha, Beta float64
+
+	n          int
+	sum, sumSq float64
+}
+
+func NewSPRT(elo0, elo1, alpha, beta float64) *SPRT {
+	return &SPRT{Elo0: elo0, Elo1: elo1, Alpha: alpha, Beta: beta}
+}
+
+// Add records the candidate's score in one game.
+func (s *SPRT) Add(score float64) {
+	s.n++
+	s.sum += score
+	s.sumSq += score * score
+}
+
+// Games returns the number of scores added.
+func (s *SPRT) Games() int { return s.n }
+
+// Mean returns the candidate's average score.
+func (s *SPRT) Mean() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	return s.sum / float64(s.n)
+}
+
+// Bounds returns the LLR at which the null hypothesis (lower) or the
+// alternative (upper) is accepted.
+func (s *SPRT) Bounds() (lower, upper float64) {
+	return math.Log(s.Beta / (1 - s.Alpha)), math.Log((1 - s.Beta) / s.Alpha)
+}
+
+// LLR returns the log-likelihood ratio of the alternative over the null
+// hypothesis. The variance of the scores is regularized with one game's worth
+// of the variance expected under the null hypothesis, so that the first few
+// identical results cannot decide the test.
+func (s *SPRT) LLR() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	s0, s1 := eloScore(s.Elo0), eloScore(s.Elo1)
+	n := float64(s.n)
+	variance := (s.sumSq - s.sum*s.sum/n + s0*(1-s0)) / (n + 1)
+	return (s1 - s0) * (2*s.sum - n*(s0+s1)) / (2 * variance)
+}
+
+// Decision returns 1 once the alternative is accepted, -1 once the null
+// hypothesis is, and 0 while the test goes on.
+func (s *SPRT) Decision() int {
+	lower, upper := s.Bounds()
+	switch llr := s.LLR(); {
+	case llr >= upper:
+		return 1
+	case llr <= lower:
+		return -1
+	}
+	return 0
+}
+
+// candidateScore is the score of engine 0 in g.
+func candidateScore(g SavedGame) float64 {
+	for i, e := range g.Seats {
+		if e == 0 {
+			switch g.Result[i] {
+			case "win":
+				return 1
+			case "draw":
+				return 1.0 / 3
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// runSPRT seats the candidate (engine 0) with two copies of the baseline
+// (engine 1), rotating seats, until the test decides or the maximum number of
+// games is played. It returns 0 if the candidate is accepted as stronger.
+func (m *matchRunner) runSPRT() int {
+	test := m.state.SPRT
+	test.n, test.sum, test.sumSq = 0, 0, 0
+	lower, upper := test.Bounds()
+	cand, base := m.engines[0], m.engines[1]
+	slog.Info(fmt.Sprintf("SPRT: %s (%s) vs %s (%s), elo0=%g elo1=%g alpha=%g beta=%g, LLR bounds [%.2f, %.2f]",
+		cand.Name, cand.Spec, base.Name, base.Spec, test.Elo0, test.Elo1, test.Alpha, test.Beta, lower, upper),
+		"event", "start", "format", "sprt", "candidate", cand.Name, "baseline", base.Name, "lower", lower, "upper", upper)
+
+	// Replay the saved games in the order they finished, which is the order
+	// in which they were counted.
+	decision := 0
+	for _, g := range m.state.Games {
+		if decision == 0 {
+			test.Add(candidateScore(g))
+			decision = test.Decision()
+		}
+	}
+	if len(m.state.Games) > 0 {
+		slog.Info(fmt.Sprintf("%d saved games, LLR %.2f", len(m.state.Games), test.LLR()),
+			"event", "resume", "games", len(m.state.Games), "llr", test.LLR())
+	}
+
+	failed := 0
+	if decision == 0 {
+		seatings := Seatings([3]int{0, 1, 1})
+		var games []*tournamentGame
+		for i := 0; i < m.state.MaxGames; i++ {
+			games = append(games, &tournamentGame{Index: i + 1, Seed: m.state.Seed + int64(i), Seats: seatings[i%len(seatings)]})
+		}
+		stop := make(chan struct{})
+		for g := range m.play(m.schedule(games), stop) {
+			if g.Err != nil {
+				failed++
+				slog.Error(fmt.Sprintf("Game %d: %v", g.Index, g.Err), m.gameAttrs(g)...)
+				continue
+			}
+			desc, err := m.record(g)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+			if decision != 0 {
+				// Games that were under way when the test ended are kept in the
+				// results, but not counted.
+				slog.Info(fmt.Sprintf("Game %d %s (not counted)", g.Index, desc), append(m.gameAttrs(g), "counted", false)...)
+				continue
+			}
+			test.Add(candidateScore(m.state.Games[len(m.state.Games)-1]))
+			slog.Info(fmt.Sprintf("Game %d %s  LLR %.2f [%.2f, %.2f]", g.Index, desc, test.LLR(), lower, upper),
+				append(m.gameAttrs(g), "counted", true, "llr", test.LLR())...)
+			if decision = test.Decision(); decision != 0 {
+				close(stop)
+			}
+		}
+	}
+
+	fmt.Println()
+	printStandings(os.Stdout, m.standings)
+	fmt.Printf("\n%s scored %.3f per game over %d games (%+.1f Elo, %.3f expected at equal strength)\n",
+		cand.Name, test.Mean(), test.Games(), scoreElo(test.Mean()), eloScore(0))
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d game(s) failed\n", failed)
+	}
+	switch decision {
+	case 1:
+		fmt.Printf("SPRT: H1 accepted, %s is stronger (elo >= %g, LLR %.2f)\n", cand.Name, test.Elo1, test.LLR())
+		return 0
+	case -1:
+		fmt.Printf("SPRT: H0 accepted, %s is not stronger (elo <= %g, LLR %.2f)\n", cand.Name, test.Elo0, test.LLR())
+	default:
+		fmt.Printf("SPRT: no decision after %d games (LLR %.2f)\n", test.Games(), test.LLR())
+	}
+	return exitError
+}
@@ -0,0 +1,39 @@
+//go:build !wasm
+
+package main
+
+import "testing"
+
+func TestSPRT(t *testing.T) {
+	if got := eloScore(0); got < 0.333 || got > 0.334 {
+		t.Errorf("eloScore(0) = %v, want 1/3", got)
+	}
+	if got := scoreElo(eloScore(50)); got < 49.99 || got > 50.01 {
+		t.Errorf("scoreElo(eloScore(50)) = %v", got)
+	}
+
+	strong := NewSPRT(0, 50, 0.05, 0.05)
+	for strong.Decision() == 0 && strong.Games() < 1000 {
+		strong.Add(1)
+		strong.Add(0)
+	}
+	if strong.Decision() != 1 {
+		t.Errorf("Scoring 1/2 against two opponents should accept H1, LLR %v after %d games", strong.LLR(), strong.Games())
+	}
+	weak := NewSPRT(0, 50, 0.05, 0.05)
+	for weak.Decision() == 0 && weak.Games() < 1000 {
+		weak.Add(0)
+		weak.Add(0)
+		weak.Add(1)
+		weak.Add(1.0 / 3)
+		weak.Add(0)
+	}
+	if weak.Decision() != -1 {
+		t.Errorf("Scoring below 1/3 should accept H0, LLR %v after %d games", weak.LLR(), weak.Games())
+	}
+	first := NewSPRT(0, 50, 0.05, 0.05)
+	first.Add(1)
+	if first.Decision() != 0 {
+		t.Errorf("One win should not decide the test, LLR %v", first.LLR())
+	}
+}
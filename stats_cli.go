@@ -3,33 +3,72 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"squava/game"
 )
 
 type MoveStat struct {
-	mv      Move
+	mv      game.Move
 	visits  int
 	winrate float32
 }
 
+// PrintBookMove reports a move played from the book.
+func (m *MCTSPlayer) PrintBookMove(bm *BookMove) {
+	if m.Verbose {
+		slog.Info(fmt.Sprintf("Book move %s: %d games, score %.1f%%", bm.Move, bm.Games, bm.Score()*100),
+			"event", "book", "move", bm.Move.String(), "games", bm.Games, "score", bm.Score())
+	}
+}
+
+// PrintStats logs the summary of the last search, with the five most
+// visited moves, or all of them at the debug level.
 func (m *MCTSPlayer) PrintStats(myID int, totalSteps, rollouts int) {
 	if !m.Verbose {
 		return
 	}
 	root := m.root
-	fmt.Printf("Rollouts: %d, Steps: %d\n", rollouts, totalSteps)
-	fmt.Printf("Estimated Winrate: %.2f%%\n", root.Q[myID]*100)
+	slog.Info(fmt.Sprintf("Rollouts: %d, Steps: %d", rollouts, totalSteps),
+		"event", "search", "player", myID+1, "rollouts", rollouts, "steps", totalSteps)
+	if m.threads > 1 {
+		slog.Info(fmt.Sprintf("Threads: %d, %s parallelism", m.threads, parallelNames[m.parallelism]),
+			"event", "threads", "player", myID+1, "threads", m.threads, "parallelism", parallelNames[m.parallelism])
+	}
+	slog.Info(fmt.Sprintf("Estimated Winrate: %.2f%%", root.Q[myID]*100),
+		"event", "winrate", "player", myID+1, "winrate", root.Q[myID])
+	ts := m.table.Stats()
+	slog.Info(fmt.Sprintf("Transposition table: %.1f%% full, %d hits, %d misses, %d stores, %d replaced",
+		ts.Usage*100, ts.Hits, ts.Misses, ts.Stores, ts.Replaced),
+		"event", "table", "usage", ts.Usage, "hits", ts.Hits, "misses", ts.Misses, "stores", ts.Stores, "replaced", ts.Replaced)
+	if m.MemoryStats {
+		mem := m.memory
+		slog.Info(fmt.Sprintf("Memory: %d nodes (peak %d), %.1f MB taken by the arena, %d GCs pausing %v",
+			mem.Nodes, mem.PeakNodes, float64(mem.ArenaBytes)/(1<<20), mem.GCs, mem.GCPause),
+			"event", "memory", "nodes", mem.Nodes, "peak_nodes", mem.PeakNodes, "arena_bytes", mem.ArenaBytes, "gcs", mem.GCs, "gc_pause", mem.GCPause)
+	}
 
 	stats := []MoveStat{}
 	bestVisits := -1
-	for i := range root.Edges {
-		edge := &root.Edges[i]
-		mv := edge.Move
-		visits := int(edge.N)
-		q := root.EdgeQs[i]
-		stats = append(stats, MoveStat{mv, visits, q})
-		if visits > bestVisits {
-			bestVisits = visits
+	if m.merged != nil {
+		for _, mv := range m.merged {
+			stats = append(stats, MoveStat{mv.Move, mv.Visits, mv.Winrate})
+			bestVisits = max(bestVisits, mv.Visits)
+		}
+	} else {
+		for i := range root.Edges {
+			edge := &root.Edges[i]
+			mv := edge.Move
+			visits := int(edge.N)
+			q := root.EdgeQs[i]
+			stats = append(stats, MoveStat{mv, visits, q})
+			if visits > bestVisits {
+				bestVisits = visits
+			}
 		}
 	}
 	// Sort stats by visits descending
@@ -40,13 +79,54 @@ func (m *MCTSPlayer) PrintStats(myID int, totalSteps, rollouts int) {
 			}
 		}
 	}
-	fmt.Println("Top moves:")
+	slog.Info("Top moves:")
 	limit := 5
-	if len(stats) < limit {
+	if logEnabled(slog.LevelDebug) || len(stats) < limit {
 		limit = len(stats)
 	}
 	for i := 0; i < limit; i++ {
 		s := stats[i]
-		fmt.Printf("  %c%d: Visits: %d, Winrate: %.2f%%\n", int(s.mv.c)+65, int(s.mv.r)+1, s.visits, s.winrate*100)
+		level := slog.LevelInfo
+		if i >= 5 {
+			level = slog.LevelDebug
+		}
+		slog.Log(context.Background(), level, fmt.Sprintf("  %s: Visits: %d, Winrate: %.2f%%", s.mv, s.visits, s.winrate*100),
+			"event", "candidate", "player", myID+1, "rank", i+1, "move", s.mv.String(), "visits", s.visits, "winrate", s.winrate)
+	}
+}
+
+const (
+	progressBarWidth   = 30
+	progressMinRefresh = 100 * time.Millisecond
+)
+
+var lastProgress time.Time
+
+// PrintProgress draws a single, in-place updating progress line for a running
+// search. Use it as an MCTSPlayer's OnProgress callback on a terminal.
+func PrintProgress(info SearchInfo) {
+	if info.Done {
+		fmt.Print("\r\033[K")
+		lastProgress = time.Time{}
+		return
+	}
+	if time.Since(lastProgress) < progressMinRefresh {
+		return
+	}
+	lastProgress = time.Now()
+	frac := 0.0
+	if info.Target > 0 {
+		frac = float64(info.Visits) / float64(info.Target)
+	}
+	if frac > 1 {
+		frac = 1
+	}
+	filled := int(frac * progressBarWidth)
+	rate := 0.0
+	if secs := info.Elapsed.Seconds(); secs > 0 {
+		rate = float64(info.Rollouts) / secs
 	}
+	fmt.Printf("\r\033[K[%s%s] %3.0f%% %d/%d %.0f it/s best %s %.1f%%",
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+		frac*100, info.Visits, info.Target, rate, info.Best, info.Winrate*100)
 }
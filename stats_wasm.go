@@ -4,3 +4,6 @@ package main
 
 func (m *MCTSPlayer) PrintStats(myID int, totalSteps, rollouts int) {
 }
+
+func (m *MCTSPlayer) PrintBookMove(bm *BookMove) {
+}
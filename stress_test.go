@@ -0,0 +1,204 @@
+//go:build !wasm
+
+package main
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"squava/game"
+)
+
+// The stress tests run the engine's concurrent parts hard enough for the
+// race detector to see their interleavings:
+//
+//	go test -race -run Stress
+//
+// Each waits for every goroutine it started before it returns, so a search
+// thread or server handler left running shows up as a failure.
+
+// waitGoroutines fails t if the goroutines started since there were base of
+// them have not all stopped within a few seconds.
+func waitGoroutines(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines still running, %d before the test:\n%s",
+				runtime.NumGoroutine(), base, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestStressParallelSearch plays games with several multithreaded engines at
+// once, stealing and deterministic, in capped graphs that recycle their
+// nodes between moves.
+func TestStressParallelSearch(t *testing.T) {
+	base := runtime.NumGoroutine()
+	root := NewRand(17)
+	players := make([]*MCTSPlayer, 3)
+	last := make([]game.GameState, len(players))
+	var wg sync.WaitGroup
+	for i := range players {
+		p := NewMCTSPlayer("Stress", "S", 0, 800)
+		p.SetRand(root.Split())
+		p.SetMaxNodes(MinMaxNodes)
+		p.SetThreads(3, i == 0)
+		players[i] = p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gs := game.NewGameState(game.Board{}, 0, 0b111)
+			for ply := 0; ply < 16 && !gs.Terminal; ply++ {
+				p.info.id = gs.PlayerID
+				_, rollouts := p.Search(gs)
+				a := p.analysis(gs, rollouts)
+				if gs.LegalMoves()&(game.Bitboard(1)<<uint(a.Best.ToIndex())) == 0 {
+					t.Errorf("Engine %d chose the illegal move %s", i, a.Best)
+					return
+				}
+				last[i] = gs
+				gs.ApplyMoveIdx(a.Best.ToIndex())
+			}
+		}()
+	}
+	wg.Wait()
+	for i, p := range players {
+		ValidateMCTSGraph(t, p.root, last[i])
+	}
+	waitGoroutines(t, base)
+}
+
+// TestStressAnalyzer sends one Analyzer requests from many goroutines, as a
+// server would, about positions of the same game.
+func TestStressAnalyzer(t *testing.T) {
+	base := runtime.NumGoroutine()
+	r := NewRand(23)
+	var positions []game.GameState
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	for len(positions) < 12 && !gs.Terminal {
+		positions = append(positions, gs)
+		gs.ApplyMoveIdx(r.PickBit(gs.GetBestMoves()))
+	}
+	an := NewAnalyzer(MinMaxNodes)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range positions {
+				gs := positions[(i+j)%len(positions)]
+				a := an.Analyze(gs, 300)
+				if a.PlayerID != gs.PlayerID || gs.LegalMoves()&(game.Bitboard(1)<<uint(a.Best.ToIndex())) == 0 {
+					t.Errorf("Request %d.%d: analysis %+v does not fit the position", i, j, a)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	waitGoroutines(t, base)
+}
+
+// TestStressCoordinator serves a tournament to workers over HTTP while the
+// leases keep running out, so that games are played twice and results race
+// each other, and checks that every game is delivered exactly once and that
+// the coordinator and workers all stop.
+func TestStressCoordinator(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	base := runtime.NumGoroutine()
+	const numGames, numWorkers = 40, 6
+	state := &TournamentState{Seed: 1, Iterations: 10,
+		Engines: []TournamentEngine{{"a", "mcts"}, {"b", "mcts"}, {"c", "mcts"}}}
+	m := &matchRunner{state: state, engines: state.Engines}
+	c := newCoordinator(m, time.Hour, "secret")
+	var games []*tournamentGame
+	for i := 1; i <= numGames; i++ {
+		games = append(games, &tournamentGame{Index: i, Seats: [3]int{i % 3, (i + 1) % 3, (i + 2) % 3}})
+	}
+	srv := httptest.NewServer(c)
+	done := c.run(m.schedule(games), nil)
+
+	stopExpiring := make(chan struct{})
+	var expiring sync.WaitGroup
+	expiring.Add(1)
+	go func() {
+		defer expiring.Done()
+		for {
+			select {
+			case <-stopExpiring:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			c.mu.Lock()
+			for _, l := range c.leased {
+				if l.game.Index%4 == 0 {
+					l.deadline = time.Now().Add(-time.Second)
+				}
+			}
+			c.expire()
+			c.mu.Unlock()
+		}
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		w := &workerClient{url: srv.URL, name: "w" + strconv.Itoa(i), token: "secret", client: srv.Client()}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				job, err := w.fetch()
+				if err == errFinished {
+					return
+				}
+				if err != nil {
+					t.Errorf("%s: %v", w.name, err)
+					return
+				}
+				if job == nil {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				res := workResult{Worker: w.name, Game: job.Game, Outcome: GameOutcome{Result: [3]string{"draw", "draw", "draw"}}}
+				for repeat := 0; repeat <= job.Game%2; repeat++ {
+					resp, err := w.post("/result", res)
+					if err != nil {
+						t.Errorf("%s: %v", w.name, err)
+						return
+					}
+					resp.Body.Close()
+				}
+			}
+		}()
+	}
+
+	delivered := map[int]int{}
+	for g := range done {
+		delivered[g.Index]++
+	}
+	close(stopExpiring)
+	expiring.Wait()
+	c.mu.Lock()
+	c.finished = true
+	c.mu.Unlock()
+	workers.Wait()
+	srv.Close()
+
+	for i := 1; i <= numGames; i++ {
+		if delivered[i] != 1 {
+			t.Errorf("Game %d was delivered %d times", i, delivered[i])
+		}
+	}
+	if len(delivered) != numGames {
+		t.Errorf("Expected %d games, got %d", numGames, len(delivered))
+	}
+	waitGoroutines(t, base)
+}
@@ -0,0 +1,263 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"squava/game"
+)
+
+// --- Test suites ---
+
+// SuiteEntry is one position of a test suite with its expected answer.
+type SuiteEntry struct {
+	ID       string
+	Line     int
+	Position game.GameState
+	Best     []game.Move // bm: any of these solves the position
+	Avoid    []game.Move // am: none of these may be played
+	Block    []game.Move // block: the move must be one of these
+	Ops      []game.EPDOp
+}
+
+// Checkable reports whether an engine's move can be scored on the entry. An
+// entry that only states, say, another player's forced win can still be
+// verified against the solver.
+func (e *SuiteEntry) Checkable() bool {
+	return len(e.Best) > 0 || len(e.Avoid) > 0 || len(e.Block) > 0
+}
+
+// Solved reports whether move answers the entry.
+func (e *SuiteEntry) Solved(move game.Move) bool {
+	for _, m := range e.Avoid {
+		if m == move {
+			return false
+		}
+	}
+	return (len(e.Best) == 0 || slices.Contains(e.Best, move)) &&
+		(len(e.Block) == 0 || slices.Contains(e.Block, move))
+}
+
+// ReadSuite reads a test suite with one position per line in the EPD-like
+// format (see ParseEPD). "bm" lists the best moves, "am" moves to avoid,
+// "block" the squares the player to move must block on, and "id" names the
+// position. "win" and "depth" are kept for VerifyClassification. Other
+// operations are ignored, as are blank lines and lines starting with '#'.
+func ReadSuite(r io.Reader) ([]SuiteEntry, error) {
+	var entries []SuiteEntry
+	sc := bufio.NewScanner(r)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		gs, ops, err := game.ParseEPD(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		e := SuiteEntry{ID: fmt.Sprintf("line %d", lineNo), Line: lineNo, Position: gs, Ops: ops}
+		claims := false
+		for _, op := range ops {
+			switch op.Name {
+			case "bm", "am", "block":
+				for _, a := range op.Args {
+					m, err := game.ParseMove(a)
+					if err != nil {
+						return nil, fmt.Errorf("line %d: %s: %v", lineNo, op.Name, err)
+					}
+					switch op.Name {
+					case "bm":
+						e.Best = append(e.Best, m)
+					case "am":
+						e.Avoid = append(e.Avoid, m)
+					default:
+						e.Block = append(e.Block, m)
+					}
+				}
+			case "win":
+				claims = true
+			case "id":
+				e.ID = strings.Join(op.Args, " ")
+			}
+		}
+		if !e.Checkable() && !claims {
+			return nil, fmt.Errorf("line %d: no bm, am, block or win operation", lineNo)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// SuiteResult is how an engine did on one entry.
+type SuiteResult struct {
+	Move     game.Move
+	Solved   bool
+	Visits   int           // Root visits at which the engine settled on a solution
+	Solution time.Duration // Time at which it did so
+	Elapsed  time.Duration // Time of the whole search
+}
+
+// RunSuiteEntry searches e with a fresh engine of the given kind. The search
+// is checked as its root visits double from 64 up to iterations; the time to
+// solution is the first of these points from which the engine's preferred
+// move stayed correct.
+func RunSuiteEntry(e *SuiteEntry, spec SeatSpec, iterations int) SuiteResult {
+	gs := e.Position
+	tt.Clear()
+	p := NewMCTSPlayer("Suite", "?", gs.PlayerID, iterations)
+	p.SetPersonality(spec.Personality)
+
+	var res SuiteResult
+	settled := false
+	start := time.Now()
+	for n := 64; n < iterations; n *= 2 {
+		p.iterations = n
+		p.Search(gs)
+		switch ok := e.Solved(p.searchInfo(0, p.iterations, start, false).Best); {
+		case ok && !settled:
+			settled, res.Visits, res.Solution = true, p.root.N, time.Since(start)
+		case !ok:
+			settled = false
+		}
+	}
+	p.iterations = iterations
+	active := gs.ActiveIDs()
+	turn := 0
+	for i, id := range active {
+		if id == gs.PlayerID {
+			turn = i
+		}
+	}
+	res.Move = p.GetMove(gs.Board, active, turn)
+	res.Elapsed = time.Since(start)
+	res.Solved = e.Solved(res.Move)
+	switch {
+	case !res.Solved:
+		res.Visits, res.Solution = 0, 0
+	case !settled:
+		res.Visits, res.Solution = p.root.N, res.Elapsed
+	}
+	return res
+}
+
+// runSuite implements `squava suite`, scoring engine configurations on a test
+// suite.
+func runSuite(args []string) int {
+	fs := flag.NewFlagSet("suite", flag.ExitOnError)
+	var engines engineList
+	fs.Var(&engines, "engine", "An engine as name=type, e.g. base=mcts or deep=mcts@20000 (repeatable; default mcts)")
+	iterations := fs.Int("iterations", 10000, "MCTS iterations for engines without @N")
+	verbose := fs.Bool("v", false, "Show the result of every position")
+	minScore := fs.Float64("min", 0, "Exit with 1 if an engine solves less than this fraction of the positions")
+	verify := fs.Bool("verify", false, "Check the win, bm, block and am operations of every position against the exact solver instead of running engines")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava suite [-engine name=type ...] [flags] suite.epd")
+		fmt.Fprintln(os.Stderr, "       squava suite -verify suite.epd")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if len(engines) == 0 {
+		engines = engineList{{Name: "mcts", Spec: "mcts"}}
+	}
+	specs := make([]SeatSpec, len(engines))
+	for i, e := range engines {
+		specs[i], _ = ParsePlayerType(e.Spec)
+		if specs[i].Kind != "mcts" {
+			fmt.Fprintf(os.Stderr, "engine %s: only mcts engines can run a suite\n", e.Name)
+			return exitUsage
+		}
+		if specs[i].Iterations == 0 {
+			specs[i].Iterations = *iterations
+		}
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	entries, err := ReadSuite(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fs.Arg(0), err)
+		return exitError
+	}
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no positions\n", fs.Arg(0))
+		return exitError
+	}
+	if *verify {
+		return verifySuite(fs.Arg(0), entries, *verbose)
+	}
+	entries = slices.DeleteFunc(entries, func(e SuiteEntry) bool { return !e.Checkable() })
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no positions an engine can be scored on\n", fs.Arg(0))
+		return exitError
+	}
+
+	code := 0
+	fmt.Printf("%-20s %8s %8s %12s %12s\n", "Engine", "Solved", "Score", "Avg solve", "Total time")
+	for i, e := range engines {
+		solved := 0
+		var solveTime, total time.Duration
+		for j := range entries {
+			res := RunSuiteEntry(&entries[j], specs[i], specs[i].Iterations)
+			total += res.Elapsed
+			if res.Solved {
+				solved++
+				solveTime += res.Solution
+			}
+			if *verbose {
+				status := "FAIL"
+				if res.Solved {
+					status = fmt.Sprintf("ok after %d visits, %v", res.Visits, res.Solution.Round(time.Millisecond))
+				}
+				fmt.Printf("  %s: %-30s %s %s\n", e.Name, entries[j].ID, res.Move, status)
+			}
+		}
+		avg := "-"
+		if solved > 0 {
+			avg = (solveTime / time.Duration(solved)).Round(time.Millisecond).String()
+		}
+		score := float64(solved) / float64(len(entries))
+		fmt.Printf("%-20s %4d/%-3d %7.1f%% %12s %12s\n", e.Name, solved, len(entries), 100*score, avg, total.Round(time.Millisecond))
+		if score < *minScore {
+			code = exitError
+		}
+	}
+	return code
+}
+
+// verifySuite checks the classifications of entries against the exact
+// solver, reporting those that do not hold.
+func verifySuite(name string, entries []SuiteEntry, verbose bool) int {
+	failed := 0
+	for i := range entries {
+		e := &entries[i]
+		start := time.Now()
+		err := VerifyClassification(e.Position, e.Ops)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("%s:%d: %s: %v\n", name, e.Line, e.ID, err)
+		case verbose:
+			fmt.Printf("%s:%d: %s: ok (%v)\n", name, e.Line, e.ID, time.Since(start).Round(time.Millisecond))
+		}
+	}
+	fmt.Printf("%d of %d positions verified\n", len(entries)-failed, len(entries))
+	if failed > 0 {
+		return exitError
+	}
+	return 0
+}
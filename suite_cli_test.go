@@ -0,0 +1,81 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestReadSuite(t *testing.T) {
+	suite := `# comment
+8/8/8/8/8/8/8/XX1X4 1 123 bm C1; id "take the win";
+
+8/8/8/8/8/8/8/XX6 1 123 am C1 D1; c0 "ignored";
+8/8/8/8/8/8/8/1OO1O3 1 123 block D1;
+`
+	entries, err := ReadSuite(strings.NewReader(suite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	move := func(s string) game.Move {
+		m, _ := game.ParseMove(s)
+		return m
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.ID != "take the win" || e.Line != 2 || len(e.Best) != 1 || e.Best[0] != (move("C1")) {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if !e.Solved(move("C1")) || e.Solved(move("E1")) {
+		t.Error("Only C1 should solve the first entry")
+	}
+	e = entries[1]
+	if e.ID != "line 4" || len(e.Avoid) != 2 || e.Solved(move("D1")) || !e.Solved(move("F3")) {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	e = entries[2]
+	if !e.Solved(move("D1")) || e.Solved(move("A1")) || e.Solved(move("F1")) {
+		t.Errorf("Only a block should solve the third entry %+v", e)
+	}
+	if err := VerifyClassification(e.Position, e.Ops); err != nil {
+		t.Errorf("Verifying the block: %v", err)
+	}
+
+	var generated []string
+	err = GenerateSuite(1, 10, 2, suiteKinds, func(gs game.GameState, ops []game.EPDOp) error {
+		generated = append(generated, game.FormatEPD(gs, ops))
+		return nil
+	})
+	if err != nil || len(generated) != 10 {
+		t.Fatalf("Expected 10 generated positions, got %d (%v)", len(generated), err)
+	}
+	gen, err := ReadSuite(strings.NewReader(strings.Join(generated, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range gen {
+		if err := VerifyClassification(e.Position, e.Ops); err != nil {
+			t.Errorf("%s: %v", e.ID, err)
+		}
+	}
+
+	for _, bad := range []string{
+		"8/8/8/8/8/8/8/XX6 1 123",
+		"8/8/8/8/8/8/8/XX6 1 123 bm Z9;",
+		"8/8/8/8/8/8 1 123 bm C1;",
+	} {
+		if _, err := ReadSuite(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+
+	spec, _ := ParsePlayerType("mcts")
+	if res := RunSuiteEntry(&entries[0], spec, 500); !res.Solved || res.Move != (move("C1")) {
+		t.Errorf("Expected the engine to take the win, got %+v", res)
+	}
+}
@@ -0,0 +1,123 @@
+//go:build !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"squava/game"
+)
+
+// suiteKinds are the kinds of classification suitegen can keep.
+var suiteKinds = []string{"win", "block", "avoid"}
+
+// hasKind reports whether c, the classification of gs, is of the given
+// kind. Moves that make the player's own 3-in-a-row lose in every position
+// and the rules already rule them out, so only other losing moves make a
+// position worth avoiding.
+func (c Classification) hasKind(gs game.GameState, kind string) bool {
+	switch kind {
+	case "win":
+		return c.Winner >= 0
+	case "block":
+		return c.Block != 0
+	case "avoid":
+		return c.Losing&^gs.Loses[gs.PlayerID] != 0 && c.Losing != gs.LegalMoves()
+	}
+	return false
+}
+
+// GenerateSuite plays random games from seed and classifies their positions
+// with the exact solver to depth, calling emit with the operations of each
+// new position of one of the given kinds (see hasKind), until emit has been
+// called n times.
+func GenerateSuite(seed uint64, n, depth int, kinds []string, emit func(gs game.GameState, ops []game.EPDOp) error) error {
+	r := NewRand(seed)
+	seen := make(map[uint64]bool)
+	for found, g := 0, 1; found < n; g++ {
+		gs := game.NewGameState(game.Board{}, 0, 0b111)
+		for ply := 0; !gs.Terminal && found < n; ply++ {
+			// The opening has nothing to prove.
+			if ply >= 6 && !seen[gs.Hash] {
+				seen[gs.Hash] = true
+				c := Classify(gs, depth)
+				if slices.ContainsFunc(kinds, func(k string) bool { return c.hasKind(gs, k) }) {
+					ops := append(c.Ops(gs), game.EPDOp{Name: "id", Args: []string{fmt.Sprintf("gen %d/%d/%d", seed, g, ply)}})
+					if err := emit(gs, ops); err != nil {
+						return err
+					}
+					found++
+				}
+			}
+			moves := gs.GetBestMoves()
+			if moves == 0 {
+				break
+			}
+			gs.ApplyMoveIdx(r.PickBit(moves))
+		}
+	}
+	return nil
+}
+
+// runSuiteGen implements `squava suitegen`, writing a test suite of random
+// positions classified by the exact solver.
+func runSuiteGen(args []string) int {
+	fs := flag.NewFlagSet("suitegen", flag.ExitOnError)
+	n := fs.Int("n", 100, "Positions to generate")
+	depth := fs.Int("depth", 2, "Solver depth in moves of each player (2 or 3 is practical)")
+	kindsFlag := fs.String("kinds", "win,block,avoid", "Keep positions with these classifications: win (a forced win for some player), block (a forced block), avoid (moves that lose by force among others that do not)")
+	seed := fs.Int64("seed", 0, "Random seed of the games (0 for time-based)")
+	out := fs.String("o", "", "Write the suite to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava suitegen [-n N] [-depth N] [-kinds win,block,avoid] [-o suite.epd]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *n < 1 || *depth < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	kinds := strings.Split(*kindsFlag, ",")
+	for _, k := range kinds {
+		if !slices.Contains(suiteKinds, k) {
+			fmt.Fprintf(os.Stderr, "unknown kind %q; use win, block or avoid\n", k)
+			return exitUsage
+		}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		w = f
+	}
+	fmt.Fprintf(w, "# squava suitegen -n %d -depth %d -kinds %s -seed %d\n", *n, *depth, *kindsFlag, *seed)
+	counts := map[string]int{}
+	err := GenerateSuite(uint64(*seed), *n, *depth, kinds, func(gs game.GameState, ops []game.EPDOp) error {
+		for _, op := range ops {
+			counts[op.Name]++
+		}
+		_, err := fmt.Fprintln(w, game.FormatEPD(gs, ops))
+		return err
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Fprintf(os.Stderr, "%d positions: %d forced wins, %d forced blocks, %d with moves to avoid\n",
+		*n, counts["win"], counts["block"], counts["am"])
+	return 0
+}
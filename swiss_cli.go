@@ -0,0 +1,238 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// --- Swiss tournaments ---
+
+// SwissRound is a round of a Swiss tournament: its tables, the engines that
+// sat out, and the games played.
+type SwissRound struct {
+	Tables [][3]int    `json:"tables"`
+	Byes   []int       `json:"byes,omitempty"`
+	First  int         `json:"first_game"` // Number of the round's first game
+	Games  []SavedGame `json:"games,omitempty"`
+}
+
+// SwissStanding adds the Swiss points and tie-breaks to an engine's tally.
+type SwissStanding struct {
+	Standing
+	Index    int
+	Byes     int
+	Points   float64 // Score plus swissByePoints per bye
+	Buchholz float64 // Sum of the points of the opponents met at each table
+}
+
+// swissByePoints is what sitting out a round is worth: the score expected
+// from a round's three games between equals.
+const swissByePoints = 1.0
+
+// meetings counts how often each pair of engines has shared a table.
+func (s *TournamentState) meetings() [][]int {
+	met := make([][]int, len(s.Engines))
+	for i := range met {
+		met[i] = make([]int, len(s.Engines))
+	}
+	for _, r := range s.SwissRounds {
+		for _, t := range r.Tables {
+			for i := 0; i < 3; i++ {
+				for j := i + 1; j < 3; j++ {
+					met[t[i]][t[j]]++
+					met[t[j]][t[i]]++
+				}
+			}
+		}
+	}
+	return met
+}
+
+// SwissStandings returns the standings after the completed rounds, ranked
+// by points, then Buchholz, then wins.
+func (s *TournamentState) SwissStandings() []SwissStanding {
+	st := make([]SwissStanding, len(s.Engines))
+	for i, e := range s.Engines {
+		st[i].Name, st[i].Index = e.Name, i
+	}
+	for _, r := range s.SwissRounds {
+		for _, b := range r.Byes {
+			st[b].Byes++
+		}
+		for _, g := range r.Games {
+			for i, e := range g.Seats {
+				st[e].add(g.Result[i])
+			}
+		}
+	}
+	for i := range st {
+		st[i].Points = st[i].Score() + float64(st[i].Byes)*swissByePoints
+	}
+	for _, r := range s.SwissRounds {
+		for _, t := range r.Tables {
+			for _, a := range t {
+				for _, b := range t {
+					if a != b {
+						st[a].Buchholz += st[b].Points
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(st, func(i, j int) bool {
+		a, b := st[i], st[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		}
+		return a.Wins > b.Wins
+	})
+	return st
+}
+
+// Pair seats the engines for the next round. Engines are taken in order of
+// the standings; the leader of the unseated engines is seated with the pair
+// of lower-ranked engines that repeats the fewest earlier meetings, preferring
+// the closest in rank. When the pool does not divide into tables of three,
+// the lowest-ranked engines with the fewest byes sit the round out.
+func (s *TournamentState) Pair() (tables [][3]int, byes []int) {
+	st := s.SwissStandings()
+	if extra := len(st) % 3; extra > 0 {
+		order := make([]SwissStanding, len(st))
+		for i := range st {
+			order[len(st)-1-i] = st[i]
+		}
+		sort.SliceStable(order, func(i, j int) bool { return order[i].Byes < order[j].Byes })
+		for _, e := range order[:extra] {
+			byes = append(byes, e.Index)
+		}
+	}
+	var pool []int
+	for _, e := range st {
+		bye := false
+		for _, b := range byes {
+			bye = bye || b == e.Index
+		}
+		if !bye {
+			pool = append(pool, e.Index)
+		}
+	}
+
+	met := s.meetings()
+	for len(pool) >= 3 {
+		a := pool[0]
+		bestJ, bestK, bestCost := 1, 2, -1
+		for j := 1; j < len(pool); j++ {
+			for k := j + 1; k < len(pool); k++ {
+				b, c := pool[j], pool[k]
+				if cost := met[a][b] + met[a][c] + met[b][c]; bestCost < 0 || cost < bestCost {
+					bestJ, bestK, bestCost = j, k, cost
+				}
+			}
+		}
+		tables = append(tables, [3]int{a, pool[bestJ], pool[bestK]})
+		var rest []int
+		for i, e := range pool {
+			if i != 0 && i != bestJ && i != bestK {
+				rest = append(rest, e)
+			}
+		}
+		pool = rest
+	}
+	return tables, byes
+}
+
+// printSwissStandings writes the Swiss standings with their tie-breaks.
+func printSwissStandings(w io.Writer, st []SwissStanding) {
+	fmt.Fprintf(w, "%-4s %-20s %7s %9s %6s %6s %6s %6s %5s\n", "Rank", "Engine", "Points", "Buchholz", "Games", "Wins", "Losses", "Draws", "Byes")
+	for i, s := range st {
+		fmt.Fprintf(w, "%-4d %-20s %7.2f %9.2f %6d %6d %6d %6d %5d\n",
+			i+1, s.Name, s.Points, s.Buchholz, s.Games, s.Wins, s.Losses, s.Draws, s.Byes)
+	}
+}
+
+// WriteSwissCSV exports the standings as CSV.
+func WriteSwissCSV(w io.Writer, st []SwissStanding) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"rank", "engine", "points", "buchholz", "games", "wins", "losses", "draws", "byes"})
+	for i, s := range st {
+		cw.Write([]string{
+			strconv.Itoa(i + 1), s.Name,
+			strconv.FormatFloat(s.Points, 'f', 3, 64), strconv.FormatFloat(s.Buchholz, 'f', 3, 64),
+			strconv.Itoa(s.Games), strconv.Itoa(s.Wins), strconv.Itoa(s.Losses), strconv.Itoa(s.Draws), strconv.Itoa(s.Byes),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// runSwiss plays the Swiss rounds still to be played. Every table plays three
+// games, one in each rotation of its seats.
+func (m *matchRunner) runSwiss() int {
+	s := m.state
+	for len(s.SwissRounds) < s.Rounds {
+		if s.Current == nil {
+			tables, byes := s.Pair()
+			s.Current = &SwissRound{Tables: tables, Byes: byes, First: len(s.played()) + 1}
+			s.Games = nil
+			if err := m.checkpoint(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+		}
+		round := s.Current
+		slog.Info(fmt.Sprintf("Round %d of %d", len(s.SwissRounds)+1, s.Rounds), "event", "round", "round", len(s.SwissRounds)+1, "rounds", s.Rounds)
+		for i, t := range round.Tables {
+			names := [3]string{m.engines[t[0]].Name, m.engines[t[1]].Name, m.engines[t[2]].Name}
+			slog.Info(fmt.Sprintf("  Table %d: %s, %s, %s", i+1, names[0], names[1], names[2]), "event", "table", "table", i+1, "engines", names)
+		}
+		for _, b := range round.Byes {
+			slog.Info(fmt.Sprintf("  Bye: %s", m.engines[b].Name), "event", "bye", "engine", m.engines[b].Name)
+		}
+
+		var games []*tournamentGame
+		for _, t := range round.Tables {
+			for r := 0; r < 3; r++ {
+				index := round.First + len(games)
+				seats := [3]int{t[r], t[(r+1)%3], t[(r+2)%3]}
+				games = append(games, &tournamentGame{Index: index, Seed: s.Seed + int64(index-1), Seats: seats})
+			}
+		}
+		failed := 0
+		for g := range m.play(m.schedule(games), nil) {
+			if g.Err != nil {
+				failed++
+				slog.Error(fmt.Sprintf("Game %d: %v", g.Index, g.Err), m.gameAttrs(g)...)
+				continue
+			}
+			desc, err := m.record(g)
+			slog.Info(fmt.Sprintf("Game %d %s", g.Index, desc), m.gameAttrs(g)...)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+		}
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d game(s) of round %d failed\n", failed, len(s.SwissRounds)+1)
+			return exitError
+		}
+		round.Games, s.Games = s.Games, nil
+		s.SwissRounds = append(s.SwissRounds, *round)
+		s.Current = nil
+		if err := m.checkpoint(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		printSwissStandings(os.Stdout, s.SwissStandings())
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSwissPairing(t *testing.T) {
+	s := &TournamentState{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		s.Engines = append(s.Engines, TournamentEngine{Name: name, Spec: "mcts"})
+	}
+	byes := map[int]int{}
+	for round := 0; round < 3; round++ {
+		tables, bye := s.Pair()
+		if len(tables) != 2 || len(bye) != 1 {
+			t.Fatalf("Round %d: got %d tables and %d byes", round+1, len(tables), len(bye))
+		}
+		byes[bye[0]]++
+		r := SwissRound{Tables: tables, Byes: bye}
+		for _, table := range tables {
+			// The first engine at each table wins every game.
+			r.Games = append(r.Games, SavedGame{Seats: table, Result: [3]string{"win", "loss", "loss"}})
+		}
+		s.SwissRounds = append(s.SwissRounds, r)
+	}
+	for e, n := range byes {
+		if n > 1 {
+			t.Errorf("%s had %d byes", s.Engines[e].Name, n)
+		}
+	}
+	st := s.SwissStandings()
+	for i := 1; i < len(st); i++ {
+		if st[i].Points > st[i-1].Points {
+			t.Errorf("Standings out of order: %+v", st)
+		}
+	}
+
+	var sb strings.Builder
+	if err := WriteSwissCSV(&sb, st); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(sb.String(), "\n"); lines != len(st)+1 {
+		t.Errorf("Expected a header and %d rows, got:\n%s", len(st), sb.String())
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"squava/game"
+)
+
+// --- Saved search tables ---
+
+// A table file (.sqt) keeps the search graph below some positions from one
+// process to the next, so that a correspondence game or an analysis picks
+// up where the last one stopped. The table itself only points at nodes, so
+// the file holds the nodes, each with its position, which the table's
+// hashes cannot give back, and the edges between them. All numbers are
+// little-endian:
+//
+//	magic "SQTT" | version uint16 | reserved uint16 | nodes uint32
+//
+// and then, for every node, in the order of a breadth-first walk from the
+// saved positions:
+//
+//	stones uint64 ×3 | player int8 | active uint8 | flags uint8 | winner int8 | visits uint32 | values float32 ×3 | edges uint16 | reserved uint16
+//	edges × (move uint8 | reserved [3]uint8 | visits uint32 | node uint32)
+//
+// where flags bit 0 marks a finished game and node is the index of the
+// edge's child in the file.
+const (
+	tableMagic    = "SQTT"
+	tableNodeSize = 48
+	tableEdgeSize = 12
+)
+
+// SaveTable writes the graphs below positions, as found in the players'
+// tables, to w, leaving out the nodes with fewer than minVisits visits and
+// what is reached only through them; the positions themselves are always
+// kept. Nodes several players share are written once. It returns the
+// number of nodes written.
+func SaveTable(w io.Writer, players []*MCTSPlayer, positions []game.GameState, minVisits int) (int, error) {
+	index := map[*MCGSNode]uint32{}
+	var nodes []*MCGSNode
+	var states []game.GameState
+	visit := func(n *MCGSNode, gs game.GameState) {
+		if _, ok := index[n]; !ok {
+			index[n] = uint32(len(nodes))
+			nodes = append(nodes, n)
+			states = append(states, gs)
+		}
+	}
+	for _, p := range players {
+		for _, gs := range positions {
+			if n := p.table.Lookup(&gs); n != nil {
+				visit(n, gs)
+			}
+		}
+	}
+	for i := 0; i < len(nodes); i++ {
+		for _, e := range nodes[i].Edges {
+			if e.Dest.N >= minVisits {
+				child := states[i]
+				child.ApplyMoveIdx(e.Move.ToIndex())
+				visit(e.Dest, child)
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 12)
+	copy(header, tableMagic)
+	binary.LittleEndian.PutUint16(header[4:], TableVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(nodes)))
+	bw.Write(header)
+	rec := make([]byte, tableNodeSize)
+	edge := make([]byte, tableEdgeSize)
+	for i, n := range nodes {
+		gs := &states[i]
+		clear(rec)
+		for p := range 3 {
+			binary.LittleEndian.PutUint64(rec[8*p:], uint64(gs.Board.P[p]))
+		}
+		rec[24], rec[25] = uint8(int8(gs.PlayerID)), gs.ActiveMask
+		if gs.Terminal {
+			rec[26] = 1
+		}
+		rec[27] = uint8(int8(gs.WinnerID))
+		binary.LittleEndian.PutUint32(rec[28:], uint32(min(int64(n.N), math.MaxUint32)))
+		for p := range 3 {
+			binary.LittleEndian.PutUint32(rec[32+4*p:], math.Float32bits(n.Q[p]))
+		}
+		kept := 0
+		for _, e := range n.Edges {
+			if _, ok := index[e.Dest]; ok {
+				kept++
+			}
+		}
+		binary.LittleEndian.PutUint16(rec[44:], uint16(kept))
+		bw.Write(rec)
+		for _, e := range n.Edges {
+			if child, ok := index[e.Dest]; ok {
+				clear(edge)
+				edge[0] = uint8(e.Move.ToIndex())
+				binary.LittleEndian.PutUint32(edge[4:], uint32(e.N))
+				binary.LittleEndian.PutUint32(edge[8:], child)
+				bw.Write(edge)
+			}
+		}
+	}
+	return len(nodes), bw.Flush()
+}
+
+// tableEdge is an edge read from a table file.
+type tableEdge struct {
+	move  int
+	n     int32
+	child uint32
+}
+
+// LoadTable reads a table file into the players' graphs and tables, once
+// for each table the players use, in the arena of the first player using
+// it. A node already in a table with at least as many visits is kept over
+// the file's. A capped arena takes the nodes, nearest the saved positions
+// first, until it is full. It returns the number of nodes read.
+func LoadTable(r io.Reader, players []*MCTSPlayer) (int, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:4]) != tableMagic {
+		return 0, errors.New("not a table file")
+	}
+	if err := checkVersion("table", int(binary.LittleEndian.Uint16(header[4:])), TableVersion); err != nil {
+		return 0, err
+	}
+	count := int(binary.LittleEndian.Uint32(header[8:]))
+
+	var states []game.GameState
+	var stats []MCGSNode
+	var edges [][]tableEdge
+	rec := make([]byte, tableNodeSize)
+	edge := make([]byte, tableEdgeSize)
+	for range count {
+		if _, err := io.ReadFull(br, rec); err != nil {
+			return 0, errors.New("table file is truncated")
+		}
+		var board game.Board
+		for p := range 3 {
+			board.P[p] = game.Bitboard(binary.LittleEndian.Uint64(rec[8*p:]))
+		}
+		player := int(int8(rec[24]))
+		if player < -1 || player > 2 || rec[25] > 7 {
+			return 0, errors.New("bad position in table file")
+		}
+		gs := game.NewGameState(board, player, rec[25])
+		gs.Terminal, gs.WinnerID = rec[26]&1 != 0, int(int8(rec[27]))
+		n := MCGSNode{N: int(binary.LittleEndian.Uint32(rec[28:]))}
+		for p := range 3 {
+			n.Q[p] = math.Float32frombits(binary.LittleEndian.Uint32(rec[32+4*p:]))
+		}
+		es := make([]tableEdge, binary.LittleEndian.Uint16(rec[44:]))
+		for j := range es {
+			if _, err := io.ReadFull(br, edge); err != nil {
+				return 0, errors.New("table file is truncated")
+			}
+			es[j] = tableEdge{int(edge[0] & 63), int32(binary.LittleEndian.Uint32(edge[4:])), binary.LittleEndian.Uint32(edge[8:])}
+			if es[j].child >= uint32(count) {
+				return 0, errors.New("bad edge in table file")
+			}
+		}
+		states = append(states, gs)
+		stats = append(stats, n)
+		edges = append(edges, es)
+	}
+
+	loaded := map[*TranspositionTable]bool{}
+	for _, p := range players {
+		if !loaded[p.table] {
+			loaded[p.table] = true
+			p.loadNodes(states, stats, edges)
+		}
+	}
+	return count, nil
+}
+
+// loadNodes adds the nodes read by LoadTable to m's graph and table.
+func (m *MCTSPlayer) loadNodes(states []game.GameState, stats []MCGSNode, edges [][]tableEdge) {
+	nodes := make([]*MCGSNode, len(states))
+	fresh := make([]bool, len(states))
+	for i := range states {
+		gs := &states[i]
+		if old := m.table.Lookup(gs); old != nil && old.N >= stats[i].N {
+			nodes[i] = old
+			continue
+		}
+		if m.arena.full() {
+			continue
+		}
+		n := m.newNode(*gs)
+		n.N, n.Q = stats[i].N, stats[i].Q
+		n.UCB1Coeff = ucb1Coeff(n.N + 1)
+		m.table.Store(gs.Hash, n)
+		nodes[i], fresh[i] = n, true
+	}
+	for i, n := range nodes {
+		if !fresh[i] {
+			continue
+		}
+		k := 0
+		for _, e := range edges[i] {
+			if nodes[e.child] != nil {
+				k++
+			}
+		}
+		if k > cap(n.Edges) {
+			n.Edges, n.EdgeQs, n.EdgeUs = m.arena.growEdges(n, k)
+		}
+		for _, e := range edges[i] {
+			child := nodes[e.child]
+			if child == nil || n.untriedMoves&(game.Bitboard(1)<<uint(e.move)) == 0 {
+				continue
+			}
+			n.untriedMoves &^= game.Bitboard(1) << uint(e.move)
+			j := n.AddEdge(game.MoveFromIndex(e.move), child, states[i].PlayerID)
+			n.Edges[j].N = e.n
+			n.EdgeUs[j] = float32(1 / math.Sqrt(float64(e.n)+1))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !wasm
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"squava/game"
+)
+
+// DefaultTableMinVisits is the fewest visits a node needs to be saved in a
+// table file by default.
+const DefaultTableMinVisits = 8
+
+// loadTableFile reads the table file at path into the players' tables, and
+// returns the number of nodes read; a missing file has none.
+func loadTableFile(path string, players []*MCTSPlayer) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return LoadTable(f, players)
+}
+
+// saveTableFile writes a table file to path with SaveTable, replacing the
+// file only once fully written.
+func saveTableFile(path string, players []*MCTSPlayer, positions []game.GameState, minVisits int) (int, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	n, err := SaveTable(f, players, positions, minVisits)
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp, path)
+}
@@ -0,0 +1,874 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- Tournaments ---
+
+// TournamentEngine is one participant: a name for the standings and the
+// player type it plays with.
+type TournamentEngine struct {
+	Name string `json:"name"`
+	Spec string `json:"spec"`
+}
+
+// ParseTournamentEngine parses "name=type", or a bare player type which then
+// also serves as the name.
+func ParseTournamentEngine(s string) (TournamentEngine, error) {
+	name, spec, ok := strings.Cut(s, "=")
+	if !ok || strings.HasPrefix(s, "cmd:") {
+		name, spec = s, s
+	}
+	seat, err := ParsePlayerType(spec)
+	if err != nil {
+		return TournamentEngine{}, err
+	}
+	if seat.Kind == "human" {
+		return TournamentEngine{}, fmt.Errorf("engine %q: humans cannot play in tournaments", name)
+	}
+	return TournamentEngine{Name: name, Spec: spec}, nil
+}
+
+// TournamentTables lists the groups of engines, by index, that meet at a
+// table. A round robin seats every trio of engines once; with only two
+// engines, each takes two seats at one of the tables. A gauntlet seats the
+// first engine with every pair of the others.
+func TournamentTables(n int, gauntlet bool) [][3]int {
+	var tables [][3]int
+	switch {
+	case n == 2:
+		tables = [][3]int{{0, 0, 1}, {0, 1, 1}}
+	case gauntlet:
+		for a := 1; a < n; a++ {
+			for b := a + 1; b < n; b++ {
+				tables = append(tables, [3]int{0, a, b})
+			}
+		}
+	default:
+		for a := 0; a < n; a++ {
+			for b := a + 1; b < n; b++ {
+				for c := b + 1; c < n; c++ {
+					tables = append(tables, [3]int{a, b, c})
+				}
+			}
+		}
+	}
+	return tables
+}
+
+// Seatings returns the distinct orders in which a table's engines can be
+// seated, so that every engine moves first, second and third equally often.
+func Seatings(table [3]int) [][3]int {
+	var out [][3]int
+	seen := map[[3]int]bool{}
+	for _, p := range [][3]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}} {
+		s := [3]int{table[p[0]], table[p[1]], table[p[2]]}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// GameOutcome is the result of one game as reported by its RESULT line.
+type GameOutcome struct {
+	Result [3]string // "win", "loss" or "draw" per seat
+	Reason string
+	Moves  int
+}
+
+// ParseResultLine parses a line written by resultSummary.
+func ParseResultLine(line string) (GameOutcome, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "RESULT" {
+		return GameOutcome{}, false
+	}
+	var o GameOutcome
+	seen := 0
+	for _, f := range fields[1:] {
+		key, val, _ := strings.Cut(f, "=")
+		switch key {
+		case "p1", "p2", "p3":
+			o.Result[key[1]-'1'] = val
+			seen++
+		case "reason":
+			o.Reason = val
+		case "moves":
+			o.Moves, _ = strconv.Atoi(val)
+		}
+	}
+	return o, seen == 3
+}
+
+// tournamentGame is one scheduled game and, once played, its outcome. The
+// player types and default iterations it is played with are fixed by bind
+// when it is handed out, so that engines reconfigured during a run only
+// change the games that start afterwards.
+type tournamentGame struct {
+	Index      int
+	Seed       int64
+	Seats      [3]int
+	Specs      [3]string
+	Iterations int
+	Resume     string // Record of the moves played before an interruption, or ""
+	Outcome    GameOutcome
+	Err        error
+}
+
+// errGameInterrupted is the error of a game whose process was killed, such
+// as by the runner's halt.
+var errGameInterrupted = errors.New("the game was interrupted")
+
+// tournamentRecord is a line of the results file.
+type tournamentRecord struct {
+	Game   int       `json:"game"`
+	Seed   int64     `json:"seed"`
+	Seats  [3]string `json:"seats"`
+	Specs  [3]string `json:"specs"`
+	Result [3]string `json:"result"`
+	Reason string    `json:"reason"`
+	Moves  int       `json:"moves"`
+}
+
+// Standing is an engine's running tally; a draw is worth a third of a win,
+// since it is shared by the three players.
+type Standing struct {
+	Name                       string
+	Games, Wins, Losses, Draws int
+}
+
+func (s *Standing) Score() float64 { return float64(s.Wins) + float64(s.Draws)/3 }
+
+func (s *Standing) add(result string) {
+	s.Games++
+	switch result {
+	case "win":
+		s.Wins++
+	case "loss":
+		s.Losses++
+	default:
+		s.Draws++
+	}
+}
+
+// printStandings writes the table of standings, best score first.
+func printStandings(w io.Writer, standings []Standing) {
+	order := make([]Standing, len(standings))
+	copy(order, standings)
+	sort.SliceStable(order, func(i, j int) bool { return order[i].Score() > order[j].Score() })
+	fmt.Fprintf(w, "%-4s %-20s %6s %6s %6s %6s %8s %7s\n", "Rank", "Engine", "Games", "Wins", "Losses", "Draws", "Score", "Score%")
+	for i, s := range order {
+		pct := 0.0
+		if s.Games > 0 {
+			pct = 100 * s.Score() / float64(s.Games)
+		}
+		fmt.Fprintf(w, "%-4d %-20s %6d %6d %6d %6d %8.2f %6.1f%%\n", i+1, s.Name, s.Games, s.Wins, s.Losses, s.Draws, s.Score(), pct)
+	}
+}
+
+// GameLimits are the resources each game's process may use; 0 is no limit.
+// External engines run in processes of their own and are not limited.
+type GameLimits struct {
+	CPU time.Duration // CPU time of the whole game, enforced where it can be read while the game runs
+	MB  int           // Memory of the whole game, enforced like CPU, with an eighth each for the engines' graphs and the table
+}
+
+// matchGame is how to play one game in a separate process.
+type matchGame struct {
+	Specs      [3]string
+	Iterations int
+	Seed       int64
+	Record     string // Save the game record here after every move, or ""
+	Profile    string // Save the game's CPU profile here, or ""
+	Resume     string // Go on from the record here, with the players and iterations saved in it, or ""
+	Limits     GameLimits
+	Halt       <-chan struct{} // Closing it kills the process, leaving the record as of the last move
+}
+
+// playMatchGame plays one game in a separate squava process, since the
+// engine keeps global state and games cannot share a process. A game killed
+// by its halt or any other signal returns errGameInterrupted.
+func playMatchGame(exe string, mg matchGame) (GameOutcome, error) {
+	args := []string{"-plain", "-seed", strconv.FormatInt(mg.Seed, 10)}
+	if mg.Resume != "" {
+		args = append(args, "-resume", mg.Resume)
+	} else {
+		args = append(args, "-iterations", strconv.Itoa(mg.Iterations))
+		for i, spec := range mg.Specs {
+			args = append(args, fmt.Sprintf("-p%d", i+1), spec)
+		}
+	}
+	if mg.Record != "" && mg.Record != mg.Resume {
+		args = append(args, "-autosave", mg.Record)
+	}
+	if mg.Profile != "" {
+		args = append(args, "-cpuprofile", mg.Profile)
+	}
+	if mg.Limits.MB > 0 {
+		// The graphs and the table take half of the budget, leaving the
+		// rest to edge arrays, stacks and the runtime.
+		args = append(args, "-hash-mb", strconv.Itoa(mg.Limits.MB/8), "-tt-mb", strconv.Itoa(mg.Limits.MB/8))
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Stderr = os.Stderr
+	if mg.Limits.MB > 0 {
+		cmd.Env = append(os.Environ(), fmt.Sprintf("GOMEMLIMIT=%dMiB", mg.Limits.MB))
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return GameOutcome{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return GameOutcome{}, err
+	}
+	exited := make(chan struct{})
+	defer close(exited)
+	var overBudget atomic.Value // The error for the budget the game went over
+	if mg.Halt != nil || mg.Limits.CPU > 0 || mg.Limits.MB > 0 {
+		go func() {
+			checkCPU, checkMB := mg.Limits.CPU > 0, mg.Limits.MB > 0
+			var tick <-chan time.Time
+			if checkCPU || checkMB {
+				t := time.NewTicker(time.Second)
+				defer t.Stop()
+				tick = t.C
+			}
+			for {
+				select {
+				case <-mg.Halt:
+					cmd.Process.Kill()
+					return
+				case <-exited:
+					return
+				case <-tick:
+					// A budget that cannot be read here is no longer checked.
+					if checkCPU {
+						used, err := processCPUTime(cmd.Process.Pid)
+						checkCPU = err == nil
+						if err == nil && used > mg.Limits.CPU {
+							overBudget.Store(fmt.Errorf("the game went over its CPU time budget of %v", mg.Limits.CPU))
+							cmd.Process.Kill()
+							return
+						}
+					}
+					if checkMB {
+						rss, err := processRSS(cmd.Process.Pid)
+						checkMB = err == nil
+						if err == nil && rss > int64(mg.Limits.MB)<<20 {
+							overBudget.Store(fmt.Errorf("the game went over its memory budget of %d MB", mg.Limits.MB))
+							cmd.Process.Kill()
+							return
+						}
+					}
+					if !checkCPU && !checkMB {
+						tick = nil
+					}
+				}
+			}
+		}()
+	}
+	var outcome GameOutcome
+	found := false
+	sc := bufio.NewScanner(out)
+	for sc.Scan() {
+		if o, ok := ParseResultLine(sc.Text()); ok {
+			outcome, found = o, true
+		}
+	}
+	// The exit code reports the outcome too; only a missing RESULT is an error.
+	cmd.Wait()
+	if !found {
+		switch {
+		case overBudget.Load() != nil:
+			return GameOutcome{}, overBudget.Load().(error)
+		case cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == -1:
+			return GameOutcome{}, errGameInterrupted
+		}
+		return GameOutcome{}, errors.New("the game produced no result")
+	}
+	return outcome, nil
+}
+
+// SavedGame is a finished game as kept in the tournament state, with the
+// seats given by engine index.
+type SavedGame struct {
+	Index  int       `json:"game"`
+	Seed   int64     `json:"seed"`
+	Seats  [3]int    `json:"seats"`
+	Result [3]string `json:"result"`
+	Reason string    `json:"reason"`
+	Moves  int       `json:"moves"`
+}
+
+// GameUnderWay is a game interrupted by a shutdown, with the engines it was
+// playing and the record of its moves so far ("" if it had none), to resume.
+type GameUnderWay struct {
+	Index      int       `json:"game"`
+	Seed       int64     `json:"seed"`
+	Seats      [3]int    `json:"seats"`
+	Specs      [3]string `json:"specs"`
+	Iterations int       `json:"iterations"`
+	Record     string    `json:"record,omitempty"`
+}
+
+// TournamentState is everything needed to resume an interrupted tournament:
+// its settings and the games finished so far. Every game's seed follows from
+// the tournament seed and the game's number, so the games still to come are
+// played exactly as they would have been.
+type TournamentState struct {
+	Format     string             `json:"format"` // roundrobin, gauntlet, swiss, sprt or arena
+	Seed       int64              `json:"seed"`
+	Iterations int                `json:"iterations"`
+	Rounds     int                `json:"rounds,omitempty"`
+	MaxGames   int                `json:"max_games,omitempty"`
+	SPRT       *SPRT              `json:"sprt,omitempty"`
+	Engines    []TournamentEngine `json:"engines"`
+
+	// Games are the finished games in the order they finished; in a Swiss
+	// tournament, those of the round under way.
+	Games       []SavedGame    `json:"games,omitempty"`
+	Interrupted []GameUnderWay `json:"interrupted,omitempty"` // Arena: games stopped by a shutdown, resumed first
+	SwissRounds []SwissRound   `json:"swiss_rounds,omitempty"`
+	Current     *SwissRound    `json:"current,omitempty"` // Pairing of the round under way
+}
+
+// LoadTournamentState reads a saved tournament; a missing file is not an
+// error and returns nil.
+func LoadTournamentState(path string) (*TournamentState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s TournamentState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &s, nil
+}
+
+// Save writes the state to path, replacing it only once fully written.
+func (s *TournamentState) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// played returns the number of every game finished so far.
+func (s *TournamentState) played() map[int]bool {
+	done := map[int]bool{}
+	for _, r := range s.SwissRounds {
+		for _, g := range r.Games {
+			done[g.Index] = true
+		}
+	}
+	for _, g := range s.Games {
+		done[g.Index] = true
+	}
+	return done
+}
+
+// matchRunner plays games between engines in separate processes and keeps
+// the standings, the results file and the saved state up to date.
+type matchRunner struct {
+	exe         string
+	state       *TournamentState
+	engines     []TournamentEngine
+	concurrency int
+	results     io.Writer     // Results file, or nil
+	statePath   string        // Where to save the state after every game, or ""
+	recordsDir  string        // Where to save the game records, or ""
+	profileDir  string        // Where to save the games' CPU profiles, or ""
+	remote      *coordinator  // Hands the games to workers instead of playing them here
+	spoolDir    string        // Where games autosave when records are not kept, or ""
+	halt        chan struct{} // Closing it interrupts the games under way, or nil
+	limits      GameLimits
+	standings   []Standing
+
+	runMu      sync.Mutex
+	running    map[int]*runningGame // Games under way here, by number
+	gameTime   time.Duration        // Total time of the games finished here
+	timedGames int
+}
+
+func newMatchRunner(state *TournamentState, concurrency int) (*matchRunner, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("could not find the squava executable: %v", err)
+	}
+	m := &matchRunner{exe: exe, state: state, engines: state.Engines, concurrency: max(concurrency, 1)}
+	m.standings = make([]Standing, len(m.engines))
+	for i, e := range m.engines {
+		m.standings[i].Name = e.Name
+	}
+	for _, r := range state.SwissRounds {
+		for _, g := range r.Games {
+			m.tally(g)
+		}
+	}
+	for _, g := range state.Games {
+		m.tally(g)
+	}
+	return m, nil
+}
+
+// tally adds g to the standings.
+func (m *matchRunner) tally(g SavedGame) {
+	for i, r := range g.Result {
+		m.standings[g.Seats[i]].add(r)
+	}
+}
+
+// specs returns the player types of the engines seated at g.
+func (m *matchRunner) specs(g *tournamentGame) [3]string {
+	var specs [3]string
+	for i, e := range g.Seats {
+		specs[i] = m.engines[e].Spec
+	}
+	return specs
+}
+
+// bind fixes the player types and default iterations g is played with,
+// unless they are fixed already.
+func (m *matchRunner) bind(g *tournamentGame) {
+	if g.Specs[0] == "" {
+		g.Specs, g.Iterations = m.specs(g), m.state.Iterations
+	}
+}
+
+// recordPath returns the file for g's game record, or "" if records are not
+// kept and games are not spooled.
+func (m *matchRunner) recordPath(g *tournamentGame) string {
+	dir := m.recordsDir
+	if dir == "" {
+		dir = m.spoolDir
+	}
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, fmt.Sprintf("game-%04d.sqv", g.Index))
+}
+
+// profilePath returns the file for g's CPU profile, or "" if games are not
+// profiled.
+func (m *matchRunner) profilePath(g *tournamentGame) string {
+	if m.profileDir == "" {
+		return ""
+	}
+	return filepath.Join(m.profileDir, fmt.Sprintf("game-%04d.prof", g.Index))
+}
+
+// play plays the games returned by next, concurrency at a time, until next
+// returns nil or stop is closed, and delivers them as they finish.
+func (m *matchRunner) play(next func() *tournamentGame, stop <-chan struct{}) <-chan *tournamentGame {
+	if m.remote != nil {
+		return m.remote.run(next, stop)
+	}
+	jobs := make(chan *tournamentGame)
+	done := make(chan *tournamentGame)
+	var wg sync.WaitGroup
+	for i := 0; i < m.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range jobs {
+				m.begin(g)
+				g.Outcome, g.Err = playMatchGame(m.exe, matchGame{Specs: g.Specs, Iterations: g.Iterations, Seed: g.Seed,
+					Record: m.recordPath(g), Profile: m.profilePath(g), Resume: g.Resume, Limits: m.limits, Halt: m.halt})
+				m.end(g)
+				done <- g
+			}
+		}()
+	}
+	go func() {
+	feed:
+		for g := next(); g != nil; g = next() {
+			m.bind(g)
+			select {
+			case jobs <- g:
+			case <-stop:
+				break feed
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// runningGame is a game under way and when it started.
+type runningGame struct {
+	game  *tournamentGame
+	start time.Time
+}
+
+// begin notes that g starts.
+func (m *matchRunner) begin(g *tournamentGame) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if m.running == nil {
+		m.running = map[int]*runningGame{}
+	}
+	m.running[g.Index] = &runningGame{g, time.Now()}
+}
+
+// end notes that g is over, and times it if it finished.
+func (m *matchRunner) end(g *tournamentGame) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if r, ok := m.running[g.Index]; ok && g.Err == nil {
+		m.gameTime += time.Since(r.start)
+		m.timedGames++
+	}
+	delete(m.running, g.Index)
+}
+
+// underWay returns the games under way, in order of their numbers, and the
+// estimated time until one of the concurrency slots is free for the next
+// game, which is not known before a game has finished.
+func (m *matchRunner) underWay(now time.Time) (games []runningGame, wait time.Duration, known bool) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	for _, r := range m.running {
+		games = append(games, *r)
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].game.Index < games[j].game.Index })
+	if len(games) < m.concurrency {
+		return games, 0, true
+	}
+	if m.timedGames == 0 {
+		return games, 0, false
+	}
+	// The game nearest to the mean length ends first.
+	mean := m.gameTime / time.Duration(m.timedGames)
+	wait = mean
+	for _, r := range games {
+		wait = min(wait, max(mean-now.Sub(r.start), 0))
+	}
+	return games, wait, true
+}
+
+// schedule returns a next function for play that hands out games in order,
+// skipping those already played.
+func (m *matchRunner) schedule(games []*tournamentGame) func() *tournamentGame {
+	done := m.state.played()
+	return func() *tournamentGame {
+		for len(games) > 0 {
+			g := games[0]
+			games = games[1:]
+			if !done[g.Index] {
+				return g
+			}
+		}
+		return nil
+	}
+}
+
+// pace describes where games are played.
+func (m *matchRunner) pace() string {
+	if m.remote != nil {
+		return "played by workers"
+	}
+	return fmt.Sprintf("%d at a time", m.concurrency)
+}
+
+// names returns the names of the engines seated at g.
+func (m *matchRunner) names(g *tournamentGame) [3]string {
+	var names [3]string
+	for i, e := range g.Seats {
+		names[i] = m.engines[e].Name
+	}
+	return names
+}
+
+// record adds a successfully played game to the standings, the results file
+// and the saved state, and returns a one-line description of it.
+func (m *matchRunner) record(g *tournamentGame) (string, error) {
+	saved := SavedGame{Index: g.Index, Seed: g.Seed, Seats: g.Seats, Result: g.Outcome.Result,
+		Reason: g.Outcome.Reason, Moves: g.Outcome.Moves}
+	m.tally(saved)
+	names := m.names(g)
+	outcome := "draw"
+	for i, r := range g.Outcome.Result {
+		if r == "win" {
+			outcome = names[i] + " wins"
+		}
+	}
+	if m.results != nil {
+		rec := tournamentRecord{Game: g.Index, Seed: g.Seed, Seats: names, Specs: g.Specs, Result: g.Outcome.Result,
+			Reason: g.Outcome.Reason, Moves: g.Outcome.Moves}
+		line, _ := json.Marshal(rec)
+		fmt.Fprintf(m.results, "%s\n", line)
+	}
+	m.state.Games = append(m.state.Games, saved)
+	desc := fmt.Sprintf("(seed %d): %s: %s (%s, %d moves)", g.Seed, strings.Join(names[:], ", "),
+		outcome, g.Outcome.Reason, g.Outcome.Moves)
+	return desc, m.checkpoint()
+}
+
+// gameAttrs returns the log fields of a finished game.
+func (m *matchRunner) gameAttrs(g *tournamentGame) []any {
+	attrs := []any{"event", "game", "game", g.Index, "seed", g.Seed, "engines", m.names(g)}
+	if g.Err != nil {
+		return append(attrs, "error", g.Err)
+	}
+	return append(attrs, "result", g.Outcome.Result, "reason", g.Outcome.Reason, "moves", g.Outcome.Moves)
+}
+
+// checkpoint saves the state, if there is a file for it.
+func (m *matchRunner) checkpoint() error {
+	if m.statePath == "" {
+		return nil
+	}
+	if err := m.state.Save(m.statePath); err != nil {
+		return fmt.Errorf("could not save the tournament state: %v", err)
+	}
+	return nil
+}
+
+// engineList collects repeated -engine flags.
+type engineList []TournamentEngine
+
+func (l *engineList) String() string { return fmt.Sprint(*l) }
+
+func (l *engineList) Set(s string) error {
+	e, err := ParseTournamentEngine(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, e)
+	return nil
+}
+
+// runTournament implements `squava tournament`, playing engines against each
+// other with seat rotation and reporting standings as games finish.
+func runTournament(args []string) int {
+	fs := flag.NewFlagSet("tournament", flag.ExitOnError)
+	var engines engineList
+	fs.Var(&engines, "engine", "An engine as name=type, e.g. fast=mcts@500 or ext=cmd:./engine (repeatable)")
+	format := fs.String("format", "roundrobin", "Pairing: roundrobin, gauntlet (the first engine against all others), or swiss")
+	rounds := fs.Int("rounds", 1, "How many times to play every seating, or the number of Swiss rounds")
+	iterations := fs.Int("iterations", 1000, "MCTS iterations for engines without @N")
+	concurrency := fs.Int("concurrency", runtime.NumCPU(), "Games to play at the same time")
+	seed := fs.Int64("seed", 0, "Random seed of the first game; later games count up from it (0 for time-based)")
+	out := fs.String("out", "", "Append one JSON line per game to this results file")
+	statePath := fs.String("state", "", "Save the tournament after every game to this file, and resume from it if it exists")
+	sprt := fs.Bool("sprt", false, "Test the first engine against the second with an SPRT instead of a fixed schedule")
+	elo0 := fs.Float64("elo0", 0, "SPRT: Elo difference of the null hypothesis")
+	elo1 := fs.Float64("elo1", 20, "SPRT: Elo difference of the alternative hypothesis")
+	alpha := fs.Float64("alpha", 0.05, "SPRT: false positive rate")
+	beta := fs.Float64("beta", 0.05, "SPRT: false negative rate")
+	maxGames := fs.Int("max-games", 10000, "SPRT: stop without a decision after this many games")
+	standingsCSV := fs.String("standings", "", "Swiss: export the final standings as CSV to this file")
+	recordsDir := fs.String("records", "", "Save the record of every game in this directory")
+	profileDir := fs.String("profile-dir", "", "Save a CPU profile of every game in this directory; go tool pprof merges them")
+	logs := addLogFlags(fs)
+	serve := fs.String("serve", "", "Coordinate workers on this address (e.g. :8080) instead of playing the games here")
+	lease := fs.Duration("lease", 10*time.Minute, "With -serve: hand a game to another worker if its result takes longer than this")
+	token := fs.String("token", os.Getenv("SQUAVA_TOKEN"), "With -serve: the token workers must present (default $SQUAVA_TOKEN, or a random one)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava tournament -engine a=mcts -engine b=mcts:trappy [-engine ...] [flags]")
+		fmt.Fprintln(os.Stderr, "       squava tournament -sprt -engine new=mcts@2000 -engine base=mcts@1000 [flags]")
+		fmt.Fprintln(os.Stderr, "       squava tournament -state tournament.json   (resume)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	stopLog, err := logs.start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	defer stopLog()
+	if *format != "roundrobin" && *format != "gauntlet" && *format != "swiss" {
+		fmt.Fprintf(os.Stderr, "unknown format %q; use roundrobin, gauntlet or swiss\n", *format)
+		return exitUsage
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	state := &TournamentState{Format: *format, Seed: *seed, Iterations: *iterations, Rounds: *rounds, Engines: engines}
+	if *sprt {
+		state.Format, state.Rounds, state.MaxGames = "sprt", 0, *maxGames
+		state.SPRT = NewSPRT(*elo0, *elo1, *alpha, *beta)
+	}
+	if *statePath != "" {
+		saved, err := LoadTournamentState(*statePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load the tournament state: %v\n", err)
+			return exitError
+		}
+		if saved != nil {
+			if len(engines) > 0 && fmt.Sprint(engines) != fmt.Sprint(saved.Engines) {
+				fmt.Fprintf(os.Stderr, "the engines differ from those saved in %s\n", *statePath)
+				return exitUsage
+			}
+			// The saved settings replace the command line ones.
+			state = saved
+			slog.Info(fmt.Sprintf("Resuming from %s: %d games played", *statePath, len(state.played())),
+				"event", "resume", "state", *statePath, "games", len(state.played()))
+		}
+	}
+	switch n := len(state.Engines); {
+	case state.Format == "sprt" && n != 2:
+		fmt.Fprintln(os.Stderr, "an SPRT needs exactly 2 engines: the candidate and the baseline")
+		return exitUsage
+	case state.Format == "swiss" && n < 3:
+		fmt.Fprintln(os.Stderr, "a Swiss tournament needs at least 3 engines")
+		return exitUsage
+	case n < 2:
+		fs.Usage()
+		return exitUsage
+	}
+
+	m, err := newMatchRunner(state, *concurrency)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	m.statePath = *statePath
+	if *recordsDir != "" {
+		if err := os.MkdirAll(*recordsDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		m.recordsDir = *recordsDir
+	}
+	if *profileDir != "" {
+		if err := os.MkdirAll(*profileDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		m.profileDir = *profileDir
+	}
+	if *serve != "" {
+		made := *token == ""
+		if made {
+			*token = newToken()
+		}
+		m.remote = newCoordinator(m, *lease, *token)
+		srv, err := m.remote.listen(*serve)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not listen on %s: %v\n", *serve, err)
+			return exitError
+		}
+		defer m.remote.finish(srv)
+		slog.Info(fmt.Sprintf("Waiting for workers on %s", *serve), "event", "serve", "addr", *serve)
+		if made {
+			fmt.Fprintf(os.Stderr, "Start the workers with -token %s\n", *token)
+		}
+	}
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open results file: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		m.results = f
+	}
+
+	switch state.Format {
+	case "sprt":
+		return m.runSPRT()
+	case "swiss":
+		slog.Info(fmt.Sprintf("Swiss tournament: %d engines, %d rounds, %s", len(m.engines), state.Rounds, m.pace()),
+			"event", "start", "format", state.Format, "engines", len(m.engines), "rounds", state.Rounds)
+		if code := m.runSwiss(); code != 0 {
+			return code
+		}
+		if *standingsCSV != "" {
+			f, err := os.Create(*standingsCSV)
+			if err == nil {
+				err = WriteSwissCSV(f, state.SwissStandings())
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not export the standings: %v\n", err)
+				return exitError
+			}
+		}
+		return 0
+	}
+	return m.runSchedule()
+}
+
+// runSchedule plays a round robin or gauntlet.
+func (m *matchRunner) runSchedule() int {
+	var games []*tournamentGame
+	for r := 0; r < m.state.Rounds; r++ {
+		for _, table := range TournamentTables(len(m.engines), m.state.Format == "gauntlet") {
+			for _, seats := range Seatings(table) {
+				games = append(games, &tournamentGame{Index: len(games) + 1, Seed: m.state.Seed + int64(len(games)), Seats: seats})
+			}
+		}
+	}
+	slog.Info(fmt.Sprintf("Tournament: %d engines, %s, %d games, %s", len(m.engines), m.state.Format, len(games), m.pace()),
+		"event", "start", "format", m.state.Format, "engines", len(m.engines), "games", len(games))
+
+	finished, failed := len(m.state.Games), 0
+	for g := range m.play(m.schedule(games), nil) {
+		finished++
+		if g.Err != nil {
+			failed++
+			names := m.names(g)
+			slog.Error(fmt.Sprintf("Game %d/%d (%s): %v", finished, len(games), strings.Join(names[:], ", "), g.Err), m.gameAttrs(g)...)
+			continue
+		}
+		desc, err := m.record(g)
+		slog.Info(fmt.Sprintf("Game %d/%d %s", finished, len(games), desc), m.gameAttrs(g)...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		if finished%10 == 0 && finished < len(games) {
+			fmt.Println()
+			printStandings(os.Stdout, m.standings)
+			fmt.Println()
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Final standings:")
+	printStandings(os.Stdout, m.standings)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d game(s) failed\n", failed)
+		return exitError
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+//go:build !wasm
+
+package main
+
+import "testing"
+
+func TestTournamentSchedule(t *testing.T) {
+	if got := len(TournamentTables(4, false)); got != 4 {
+		t.Errorf("Round robin of 4 engines: got %d tables, want 4", got)
+	}
+	gauntlet := TournamentTables(4, true)
+	if len(gauntlet) != 3 {
+		t.Errorf("Gauntlet of 4 engines: got %d tables, want 3", len(gauntlet))
+	}
+	for _, table := range gauntlet {
+		if table[0] != 0 {
+			t.Errorf("Gauntlet table %v lacks the candidate", table)
+		}
+	}
+	if got := len(Seatings([3]int{0, 1, 2})); got != 6 {
+		t.Errorf("Three engines: got %d seatings, want 6", got)
+	}
+	seats := [3]int{}
+	for _, table := range TournamentTables(2, false) {
+		for _, s := range Seatings(table) {
+			for i, e := range s {
+				if e == 0 {
+					seats[i]++
+				}
+			}
+		}
+	}
+	if seats != [3]int{3, 3, 3} {
+		t.Errorf("Two engines: the first sits in each seat %v times, want equally often", seats)
+	}
+}
+
+func TestParseResultLine(t *testing.T) {
+	o, ok := ParseResultLine("RESULT p1=loss p2=win p3=loss reason=4inrow moves=31 seed=42")
+	if !ok || o.Result != [3]string{"loss", "win", "loss"} || o.Reason != "4inrow" || o.Moves != 31 {
+		t.Errorf("Got %+v, %v", o, ok)
+	}
+	for _, bad := range []string{"Result: Draw", "RESULT p1=win"} {
+		if _, ok := ParseResultLine(bad); ok {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+	e, err := ParseTournamentEngine("ext=cmd:./engine --level=3")
+	if err != nil || e.Name != "ext" || e.Spec != "cmd:./engine --level=3" {
+		t.Errorf("Got %+v, %v", e, err)
+	}
+	if _, err := ParseTournamentEngine("me=human"); err == nil {
+		t.Error("Expected humans to be rejected")
+	}
+}
+
+func TestTournamentStateResume(t *testing.T) {
+	path := t.TempDir() + "/tournament.json"
+	if s, err := LoadTournamentState(path); s != nil || err != nil {
+		t.Fatalf("A missing state file should load as nil, got %v, %v", s, err)
+	}
+	s := &TournamentState{Format: "roundrobin", Seed: 5, Iterations: 100, Rounds: 1,
+		Engines: []TournamentEngine{{"a", "mcts"}, {"b", "mcts@200"}, {"c", "mcts:trappy"}}}
+	s.Games = append(s.Games, SavedGame{Index: 2, Seed: 6, Seats: [3]int{0, 2, 1}, Result: [3]string{"loss", "win", "loss"}})
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadTournamentState(path)
+	if err != nil || loaded.Seed != 5 || len(loaded.Games) != 1 || loaded.Engines[1].Spec != "mcts@200" {
+		t.Fatalf("Got %+v, %v", loaded, err)
+	}
+
+	m, err := newMatchRunner(loaded, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := m.standings[2]; st.Games != 1 || st.Wins != 1 {
+		t.Errorf("Standings were not restored: %+v", m.standings)
+	}
+	var games []*tournamentGame
+	for i := 1; i <= 3; i++ {
+		games = append(games, &tournamentGame{Index: i})
+	}
+	next := m.schedule(games)
+	for _, want := range []int{1, 3} {
+		if g := next(); g == nil || g.Index != want {
+			t.Errorf("Expected game %d next, got %+v", want, g)
+		}
+	}
+	if g := next(); g != nil {
+		t.Errorf("Expected the schedule to end, got game %d", g.Index)
+	}
+}
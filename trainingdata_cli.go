@@ -0,0 +1,251 @@
+//go:build !wasm
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"squava/game"
+)
+
+// --- Training data export ---
+
+// The planes of a training sample, each an 8x8 grid of 0/1 indexed
+// [row][column] with A1 at [0][0]. Players are relative to the player to
+// move: "next" moves after them in seat order and "other" after that,
+// whether or not they are still in the game.
+const (
+	planeMover   = iota // Stones of the player to move
+	planeNext           // Stones of the next player
+	planeOther          // Stones of the other player
+	planeLegal          // Legal moves, which are restricted when a win or block is forced
+	planeWins           // Squares that complete a 4-in-a-row for the player to move
+	planeLoses          // Squares that make a 3-in-a-row for the player to move
+	planeNextIn         // All ones if the next player is still in the game
+	planeOtherIn        // All ones if the other player is still in the game
+	trainingPlanes
+)
+
+// TrainingSample is a position of a finished game with the move played from
+// it and how the game ended.
+type TrainingSample struct {
+	Planes  [trainingPlanes]game.Bitboard
+	Move    int        // Square played, 0 (A1) to 63 (H8)
+	Outcome [3]float32 // Final score of the mover, next and other player
+}
+
+// trainingPlanesOf encodes gs for the player to move.
+func trainingPlanesOf(gs game.GameState) [trainingPlanes]game.Bitboard {
+	mover := gs.PlayerID
+	next, other := (mover+1)%3, (mover+2)%3
+	var p [trainingPlanes]game.Bitboard
+	p[planeMover] = gs.Board.P[mover]
+	p[planeNext] = gs.Board.P[next]
+	p[planeOther] = gs.Board.P[other]
+	p[planeLegal] = gs.LegalMoves()
+	p[planeWins] = gs.Wins[mover]
+	p[planeLoses] = gs.Loses[mover] &^ gs.Wins[mover]
+	if gs.ActiveMask&(1<<uint(next)) != 0 {
+		p[planeNextIn] = ^game.Bitboard(0)
+	}
+	if gs.ActiveMask&(1<<uint(other)) != 0 {
+		p[planeOtherIn] = ^game.Bitboard(0)
+	}
+	return p
+}
+
+// TrainingSamples turns a finished game into samples, one per move, or
+// NumSymmetries per move with augment. Resignations, and the positions where
+// the move was the only legal one, teach nothing and are left out. An
+// unfinished game gives no samples.
+func TrainingSamples(rec *game.GameRecord, augment bool) ([]TrainingSample, error) {
+	positions, err := rec.Positions()
+	if err != nil {
+		return nil, err
+	}
+	final := positions[len(positions)-1]
+	if !final.Terminal {
+		return nil, nil
+	}
+	score := ScoreTerminal(final.ActiveMask, final.WinnerID)
+	symmetries := 1
+	if augment {
+		symmetries = game.NumSymmetries
+	}
+	var samples []TrainingSample
+	for i, move := range rec.Moves {
+		gs := positions[i]
+		if move == game.ResignMove || gs.LegalMoves()&(gs.LegalMoves()-1) == 0 {
+			continue
+		}
+		planes := trainingPlanesOf(gs)
+		var outcome [3]float32
+		for k := range outcome {
+			outcome[k] = score[(gs.PlayerID+k)%3]
+		}
+		for s := 0; s < symmetries; s++ {
+			sample := TrainingSample{Move: game.TransformSquare(move.ToIndex(), s), Outcome: outcome}
+			for k, bb := range planes {
+				sample.Planes[k] = game.TransformBitboard(bb, s)
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return samples, nil
+}
+
+// writeNPY writes an array in NumPy's .npy format, version 1.0. descr is the
+// NumPy type string, e.g. "|u1" or "<f4", and data the little-endian values
+// in C order.
+func writeNPY(w io.Writer, descr string, shape []int, data []byte) error {
+	dims := make([]string, len(shape))
+	for i, n := range shape {
+		dims[i] = fmt.Sprint(n)
+	}
+	tuple := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		tuple += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, tuple)
+	// The magic, version and length take 10 bytes; the header is padded with
+	// spaces to end in a newline on a 64-byte boundary.
+	header += strings.Repeat(" ", 63-(10+len(header))%64) + "\n"
+	buf := make([]byte, 0, 10+len(header))
+	buf = append(buf, "\x93NUMPY\x01\x00"...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(header)))
+	buf = append(buf, header...)
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// WriteTrainingData writes samples as a NumPy .npz archive, as read by
+// numpy.load, holding three arrays:
+//
+//	planes   uint8   (N, 8, 8, 8)  sample, plane, row, column
+//	policy   int64   (N,)          square played, row*8 + column
+//	outcome  float32 (N, 3)        final score of the mover, next and other player
+func WriteTrainingData(w io.Writer, samples []TrainingSample) error {
+	n := len(samples)
+	planes := make([]byte, 0, n*trainingPlanes*64)
+	policy := make([]byte, 0, n*8)
+	outcome := make([]byte, 0, n*3*4)
+	for _, s := range samples {
+		for _, bb := range s.Planes {
+			for sq := 0; sq < 64; sq++ {
+				planes = append(planes, byte(bb>>uint(sq)&1))
+			}
+		}
+		policy = binary.LittleEndian.AppendUint64(policy, uint64(s.Move))
+		for _, v := range s.Outcome {
+			outcome = binary.LittleEndian.AppendUint32(outcome, math.Float32bits(v))
+		}
+	}
+	z := zip.NewWriter(w)
+	arrays := []struct {
+		name, descr string
+		shape       []int
+		data        []byte
+	}{
+		{"planes.npy", "|u1", []int{n, trainingPlanes, game.BoardSize, game.BoardSize}, planes},
+		{"policy.npy", "<i8", []int{n}, policy},
+		{"outcome.npy", "<f4", []int{n, 3}, outcome},
+	}
+	for _, a := range arrays {
+		f, err := z.Create(a.name)
+		if err != nil {
+			return err
+		}
+		if err := writeNPY(f, a.descr, a.shape, a.data); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// runTrainData implements `squava traindata`, exporting saved games for
+// machine learning.
+func runTrainData(args []string) int {
+	fs := flag.NewFlagSet("traindata", flag.ExitOnError)
+	out := fs.String("o", "", "Write the samples to this .npz file")
+	augment := fs.Bool("augment", false, "Add the 7 rotations and reflections of every sample")
+	dbPath := fs.String("db", "", "Also export the games of this game database")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava traindata -o data.npz [-augment] [-db file] [game.sqv|dir...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *out == "" || fs.NArg() == 0 && *dbPath == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	files, err := recordPaths(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	var recs []*game.GameRecord
+	var sources []string
+	for _, path := range files {
+		fileRecs, names, err := readRecordFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v; skipped\n", path, err)
+			continue
+		}
+		recs, sources = append(recs, fileRecs...), append(sources, names...)
+	}
+	if *dbPath != "" {
+		db, err := game.OpenGameDB(*dbPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		for _, g := range db.Select(game.GameFilter{}) {
+			rec, err := g.ParseRecord()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: game %d: %v; skipped\n", *dbPath, g.ID, err)
+				continue
+			}
+			recs, sources = append(recs, rec), append(sources, fmt.Sprintf("%s: game %d", *dbPath, g.ID))
+		}
+	}
+
+	var samples []TrainingSample
+	games := 0
+	for i, rec := range recs {
+		more, err := TrainingSamples(rec, *augment)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v; skipped\n", sources[i], err)
+			continue
+		}
+		if len(more) > 0 {
+			games++
+		}
+		samples = append(samples, more...)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if err := WriteTrainingData(f, samples); err != nil {
+		f.Close()
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d samples from %d finished games to %s\n", len(samples), games, *out)
+	return 0
+}
@@ -0,0 +1,65 @@
+//go:build !wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestTrainingData(t *testing.T) {
+	rec, err := game.ReadGameRecord(strings.NewReader("H8 F1 B8 C8 G8 E4 A4 F8 G5 C5 D1 E7 H3 A1 C2 C1 C4 G4 E5 D3 H4 E2 F6 F4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := TrainingSamples(rec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The forced block E2 and the winning F4 were the only legal moves.
+	if len(samples) != 22 {
+		t.Fatalf("got %d samples, want 22", len(samples))
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	if first.Move != 63 || first.Outcome != [3]float32{0, 0, 1} || first.Planes[planeLegal] != ^game.Bitboard(0) {
+		t.Errorf("first sample = move %d, outcome %v", first.Move, first.Outcome)
+	}
+	// Player 2's F6 could block only one of Player 3's threats.
+	if last.Move != 45 || last.Outcome != [3]float32{0, 1, 0} {
+		t.Errorf("last sample = move %d, outcome %v", last.Move, last.Outcome)
+	}
+	augmented, _ := TrainingSamples(rec, true)
+	if len(augmented) != game.NumSymmetries*len(samples) || augmented[1].Move != 56 {
+		t.Errorf("augmented to %d samples, second move %d", len(augmented), augmented[1].Move)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTrainingData(&buf, samples); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int{"planes.npy": 22 * 8 * 64, "policy.npy": 22 * 8, "outcome.npy": 22 * 3 * 4}
+	for _, f := range z.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		headerLen := int(data[8]) | int(data[9])<<8
+		if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) || (10+headerLen)%64 != 0 {
+			t.Errorf("%s: bad .npy header %q", f.Name, data[:min(len(data), 80)])
+		}
+		if got := len(data) - 10 - headerLen; got != sizes[f.Name] {
+			t.Errorf("%s: %d bytes of data, want %d", f.Name, got, sizes[f.Name])
+		}
+		delete(sizes, f.Name)
+	}
+	if len(sizes) != 0 {
+		t.Errorf("missing arrays %v", sizes)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"math/bits"
+	"sync/atomic"
+
+	"squava/game"
+)
+
+// --- Transposition table ---
+
+// TranspositionTable maps position hashes to search nodes. It is safe for
+// concurrent use without locks: every slot is an atomic pointer, so readers
+// always see a whole entry, and racing stores simply leave one of them.
+//
+// Slots come in buckets of two. Lookups check both; a store replaces the
+// position's own entry, an empty one, or one left from an earlier search,
+// and otherwise the second slot. The first slot so keeps the first node
+// stored in its bucket during a search, which in a tree search is the one
+// nearer the root and so the more visited, while the second always takes
+// the newest.
+//
+// The table counts its hits, misses, stores and replacements only once
+// CountStats has been called: every search thread would otherwise write the
+// counters on every lookup and store.
+type TranspositionTable struct {
+	slots []atomic.Pointer[MCGSNode]
+	gens  []atomic.Uint32 // Search during which each slot was stored
+	gen   atomic.Uint32
+
+	counting                       atomic.Bool
+	hits, misses, stores, replaced ttCounter
+}
+
+// ttCounter is a count of the table's on a cache line of its own, so that
+// threads counting lookups and threads counting stores do not contend.
+type ttCounter struct {
+	atomic.Uint64
+	_ [56]byte
+}
+
+// ttEntryBytes is the memory of one slot: the pointer and its generation.
+const ttEntryBytes = 8 + 4
+
+// NewTranspositionTable returns a table of entries slots, rounded down to a
+// power of two and to at least one bucket.
+func NewTranspositionTable(entries int) *TranspositionTable {
+	if entries < 2 {
+		entries = 2
+	}
+	entries = 1 << (bits.Len(uint(entries)) - 1)
+	t := &TranspositionTable{
+		slots: make([]atomic.Pointer[MCGSNode], entries),
+		gens:  make([]atomic.Uint32, entries),
+	}
+	t.gen.Store(1)
+	return t
+}
+
+// NewTranspositionTableMB returns the largest table that fits in mb megabytes.
+func NewTranspositionTableMB(mb int) *TranspositionTable {
+	return NewTranspositionTable(mb << 20 / ttEntryBytes)
+}
+
+// CountStats makes the table count its lookups and stores from now on, for
+// Stats.
+func (t *TranspositionTable) CountStats() {
+	if !t.counting.Load() {
+		t.counting.Store(true)
+	}
+}
+
+// Len returns the number of slots.
+func (t *TranspositionTable) Len() int { return len(t.slots) }
+
+// bucket returns the index of the first slot of hash's bucket.
+func (t *TranspositionTable) bucket(hash uint64) int {
+	return int(hash & uint64(len(t.slots)-1) &^ 1)
+}
+
+func (t *TranspositionTable) Lookup(gs *game.GameState) *MCGSNode {
+	b := t.bucket(gs.Hash)
+	for i := b; i < b+2; i++ {
+		if node := t.slots[i].Load(); node != nil && node.Hash == gs.Hash {
+			if t.counting.Load() {
+				t.hits.Add(1)
+			}
+			return node
+		}
+	}
+	if t.counting.Load() {
+		t.misses.Add(1)
+	}
+	return nil
+}
+
+func (t *TranspositionTable) Store(hash uint64, node *MCGSNode) {
+	b := t.bucket(hash)
+	gen := t.gen.Load()
+	victim := -1
+	for i := b; i < b+2 && victim < 0; i++ {
+		if old := t.slots[i].Load(); old == nil || old.Hash == hash {
+			victim = i
+		}
+	}
+	if victim < 0 {
+		victim = b + 1
+		if t.gens[b].Load() != gen {
+			victim = b
+		}
+	}
+	old := t.slots[victim].Swap(node)
+	t.gens[victim].Store(gen)
+	if t.counting.Load() {
+		if old != nil && old.Hash != hash {
+			t.replaced.Add(1)
+		}
+		t.stores.Add(1)
+	}
+}
+
+// Remove clears the slot holding n, if any.
+func (t *TranspositionTable) Remove(n *MCGSNode) {
+	b := t.bucket(n.Hash)
+	for i := b; i < b+2; i++ {
+		t.slots[i].CompareAndSwap(n, nil)
+	}
+}
+
+// NewSearch starts a new generation of entries. Entries from earlier
+// searches are the first to be replaced.
+func (t *TranspositionTable) NewSearch() {
+	t.gen.Add(1)
+}
+
+// Clear empties the table and resets its counts. Unlike the other methods,
+// it must not run concurrently with searches using the table.
+func (t *TranspositionTable) Clear() {
+	clear(t.slots)
+	clear(t.gens)
+	t.hits.Store(0)
+	t.misses.Store(0)
+	t.stores.Store(0)
+	t.replaced.Store(0)
+}
+
+// TTStats are a table's counts since it was last cleared, or since
+// CountStats if that was later; the counts are 0 without CountStats.
+type TTStats struct {
+	Entries  int     `json:"entries"`
+	Usage    float64 `json:"usage"` // Share of slots in use, estimated from a sample
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	Stores   uint64  `json:"stores"`
+	Replaced uint64  `json:"replaced"` // Stores that evicted another position
+}
+
+// ttUsageSample is the number of slots Stats looks at to estimate usage.
+const ttUsageSample = 4096
+
+func (t *TranspositionTable) Stats() TTStats {
+	s := TTStats{
+		Entries:  len(t.slots),
+		Hits:     t.hits.Load(),
+		Misses:   t.misses.Load(),
+		Stores:   t.stores.Load(),
+		Replaced: t.replaced.Load(),
+	}
+	// Hashes are uniform, so slots spread evenly over the table are a fair
+	// sample.
+	n := min(ttUsageSample, len(t.slots))
+	step := len(t.slots) / n
+	used := 0
+	for i := 0; i < n; i++ {
+		if t.slots[i*step].Load() != nil {
+			used++
+		}
+	}
+	s.Usage = float64(used) / float64(n)
+	return s
+}
@@ -0,0 +1,149 @@
+//go:build !wasm
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"squava/game"
+)
+
+// --- Search tree export ---
+
+// TreeNode is a node of an exported search tree, reached by Move from its
+// parent. The engine has no learned policy: it tries its candidate moves in
+// random order, which amounts to a uniform prior over them.
+type TreeNode struct {
+	Move     string      `json:"move,omitempty"`
+	Player   int         `json:"player"`             // Player to move at this node, -1 once the game is over
+	Visits   int         `json:"visits"`             // Visits of the edge into the node, or of the root
+	Value    [3]float32  `json:"value"`              // Each player's mean score through the node
+	Prior    float32     `json:"prior,omitempty"`    // Of the edge, among the parent's candidate moves
+	Explore  float32     `json:"explore,omitempty"`  // UCB1 exploration bonus of the edge
+	Untried  int         `json:"untried"`            // Candidate moves not yet expanded
+	Repeated bool        `json:"repeated,omitempty"` // Reached before by another path; its children are listed there
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// ExportTree copies the search graph below root, which holds gs, to depth
+// moves, skipping edges with fewer than minVisits visits. Children are
+// listed most visited first. The graph merges transpositions, so a node
+// reached again is marked Repeated and not expanded a second time.
+func ExportTree(root *MCGSNode, gs game.GameState, depth, minVisits int) *TreeNode {
+	seen := map[*MCGSNode]bool{}
+	var walk func(n *MCGSNode, gs game.GameState, depth int) *TreeNode
+	walk = func(n *MCGSNode, gs game.GameState, depth int) *TreeNode {
+		t := &TreeNode{Player: gs.PlayerID, Visits: n.N, Value: n.Q, Untried: bits.OnesCount64(uint64(n.untriedMoves))}
+		if gs.Terminal {
+			t.Player = -1
+		}
+		if seen[n] {
+			t.Repeated = true
+			return t
+		}
+		seen[n] = true
+		if depth == 0 {
+			return t
+		}
+		order := make([]int, len(n.Edges))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return n.Edges[order[a]].N > n.Edges[order[b]].N })
+		prior := 1 / float32(len(n.Edges)+t.Untried)
+		for _, i := range order {
+			e := &n.Edges[i]
+			if int(e.N) < minVisits {
+				continue
+			}
+			child := gs
+			child.ApplyMove(e.Move)
+			c := walk(e.Dest, child, depth-1)
+			c.Move = e.Move.String()
+			c.Visits = int(e.N)
+			c.Prior = prior
+			c.Explore = n.UCB1Coeff * n.EdgeUs[i]
+			t.Children = append(t.Children, c)
+		}
+		return t
+	}
+	return walk(root, gs, depth)
+}
+
+// WriteTreeJSON writes t as indented JSON.
+func WriteTreeJSON(w io.Writer, t *TreeNode) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+// WriteTreeDOT writes t as a Graphviz digraph, one box per node labeled with
+// the move, the visits and the winrate of the player who made it.
+func WriteTreeDOT(w io.Writer, t *TreeNode) error {
+	var sb strings.Builder
+	sb.WriteString("digraph search {\n  node [shape=box, fontname=\"monospace\"];\n")
+	next := 0
+	var walk func(t *TreeNode, mover int) int
+	walk = func(t *TreeNode, mover int) int {
+		id := next
+		next++
+		label := fmt.Sprintf("root\\nN=%d", t.Visits)
+		if t.Move != "" {
+			label = fmt.Sprintf("%s %s\\nN=%d Q=%.1f%%", asciiStones[mover], t.Move, t.Visits, t.Value[mover]*100)
+		}
+		style := ""
+		if t.Repeated {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&sb, "  n%d [label=\"%s\"%s];\n", id, label, style)
+		for _, c := range t.Children {
+			child := walk(c, t.Player)
+			fmt.Fprintf(&sb, "  n%d -> n%d [label=\"%d\"];\n", id, child, c.Visits)
+		}
+		return id
+	}
+	walk(t, -1)
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// TreeDump writes the search tree after every engine move of a game.
+type TreeDump struct {
+	Path      string // A %d in it is replaced by the move number
+	Depth     int
+	MinVisits int
+}
+
+// Write exports the search that m made from gs for move number ply. The
+// format is Graphviz DOT if the path ends in .dot, JSON otherwise.
+func (d *TreeDump) Write(m *MCTSPlayer, gs game.GameState, ply int) error {
+	if m.root == nil {
+		return nil
+	}
+	path := d.Path
+	if strings.Contains(path, "%") {
+		path = fmt.Sprintf(path, ply)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	t := ExportTree(m.root, gs, d.Depth, d.MinVisits)
+	if strings.EqualFold(filepath.Ext(path), ".dot") {
+		err = WriteTreeDOT(f, t)
+	} else {
+		err = WriteTreeJSON(f, t)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
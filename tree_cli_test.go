@@ -0,0 +1,41 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestExportTree(t *testing.T) {
+	tt.Clear()
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	m := NewMCTSPlayer("AI", "X", 0, 300)
+	m.Search(gs)
+	tree := ExportTree(m.root, gs, 2, 2)
+	if tree.Visits != 300 || tree.Player != 0 || len(tree.Children) == 0 {
+		t.Fatalf("root = %+v", tree)
+	}
+	total := 0
+	for i, c := range tree.Children {
+		total += c.Visits
+		if c.Visits < 2 || i > 0 && c.Visits > tree.Children[i-1].Visits {
+			t.Errorf("child %d (%s) has %d visits out of order", i, c.Move, c.Visits)
+		}
+		if c.Player != 1 || c.Prior != 1.0/64 {
+			t.Errorf("child %s: player %d, prior %v", c.Move, c.Player, c.Prior)
+		}
+	}
+	if total > tree.Visits {
+		t.Errorf("children have %d visits, more than the root's %d", total, tree.Visits)
+	}
+	var sb strings.Builder
+	if err := WriteTreeDOT(&sb, tree); err != nil {
+		t.Fatal(err)
+	}
+	if dot := sb.String(); !strings.HasPrefix(dot, "digraph") || !strings.Contains(dot, "n0 -> n1") {
+		t.Errorf("DOT output:\n%s", dot)
+	}
+}
@@ -0,0 +1,316 @@
+//go:build !wasm
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"squava/game"
+)
+
+// --- Full-screen terminal UI ---
+
+type tuiKey int
+
+const (
+	keyNone tuiKey = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyEnter
+	keyUndo
+	keyHint
+	keyQuit
+)
+
+const (
+	ansiClear      = "\033[H\033[2J"
+	ansiHideCursor = "\033[?25l"
+	ansiShowCursor = "\033[?25h"
+)
+
+// TUI runs a SquavaGame full-screen: humans move a cursor with the arrow
+// keys (or hjkl) and play with enter, while clocks, threats, and engine
+// progress are shown live beside the board.
+type TUI struct {
+	g       *SquavaGame
+	cursor  int
+	message string
+	search  string // Engine progress line
+}
+
+func NewTUI(g *SquavaGame) *TUI {
+	return &TUI{g: g, cursor: 27}
+}
+
+// enterRawMode switches the terminal to unbuffered, unechoed input and
+// returns a function restoring the previous settings.
+func enterRawMode() (func(), error) {
+	get := exec.Command("stty", "-g")
+	get.Stdin = os.Stdin
+	state, err := get.Output()
+	if err != nil {
+		return nil, fmt.Errorf("stdin is not a terminal: %v", err)
+	}
+	raw := exec.Command("stty", "raw", "-echo")
+	raw.Stdin = os.Stdin
+	if err := raw.Run(); err != nil {
+		return nil, err
+	}
+	return func() {
+		restore := exec.Command("stty", strings.TrimSpace(string(state)))
+		restore.Stdin = os.Stdin
+		restore.Run()
+	}, nil
+}
+
+func readKey() tuiKey {
+	b, err := stdin.ReadByte()
+	if err != nil {
+		return keyQuit
+	}
+	if b == 0x1b && stdin.Buffered() >= 2 {
+		if next, _ := stdin.ReadByte(); next != '[' {
+			return keyNone
+		}
+		arrow, _ := stdin.ReadByte()
+		switch arrow {
+		case 'A':
+			return keyUp
+		case 'B':
+			return keyDown
+		case 'C':
+			return keyRight
+		case 'D':
+			return keyLeft
+		}
+		return keyNone
+	}
+	switch b {
+	case 'k':
+		return keyUp
+	case 'j':
+		return keyDown
+	case 'l':
+		return keyRight
+	case 'h':
+		return keyLeft
+	case '\r', '\n', ' ':
+		return keyEnter
+	case 'u':
+		return keyUndo
+	case '?':
+		return keyHint
+	case 'q', 0x03:
+		return keyQuit
+	}
+	return keyNone
+}
+
+func (t *TUI) draw() {
+	g := t.g
+	cursor := -1
+	if _, terminal := g.terminal(); !terminal {
+		if _, ok := g.GetPlayer(g.gs.PlayerID).(*HumanPlayer); ok {
+			cursor = t.cursor
+		}
+	}
+	board := g.renderBoard(cursor)
+
+	panel := []string{"3-Player Squava", ""}
+	for _, p := range g.players {
+		id := p.ID()
+		status := "  "
+		if g.gs.ActiveMask&(1<<uint(id)) == 0 {
+			status = "--"
+		} else if id == g.gs.PlayerID && !g.gs.Terminal {
+			status = "->"
+		}
+		used, _ := g.timeUsed(id)
+		panel = append(panel, fmt.Sprintf("%s %s (%s) %-5s %s", status, p.Name(), p.Symbol(),
+			g.playerType(p), formatClock(used)))
+	}
+	panel = append(panel, "")
+	for _, id := range g.gs.ActiveIDs() {
+		if g.gs.Wins[id] != 0 || g.gs.Loses[id] != 0 {
+			panel = append(panel, fmt.Sprintf("%s: wins [%s] loses [%s]", g.GetPlayer(id).Symbol(),
+				formatSquares(g.gs.Wins[id]), formatSquares(g.gs.Loses[id])))
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(ansiClear)
+	rows := len(board)
+	if len(panel) > rows {
+		rows = len(panel)
+	}
+	for i := 0; i < rows; i++ {
+		line := ""
+		if i < len(board) {
+			line = board[i]
+		} else {
+			line = strings.Repeat(" ", 3+2*game.BoardSize)
+		}
+		sb.WriteString(line)
+		if i < len(panel) {
+			sb.WriteString("   ")
+			sb.WriteString(panel[i])
+		}
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString("\r\n")
+	if t.search != "" {
+		sb.WriteString(t.search + "\r\n")
+	}
+	if t.message != "" {
+		sb.WriteString(t.message + "\r\n")
+	}
+	sb.WriteString("arrows/hjkl: move  enter: play  u: undo  ?: hint  q: quit\r\n")
+	fmt.Print(sb.String())
+}
+
+func formatSearchInfo(name string, info SearchInfo) string {
+	rate := 0.0
+	if secs := info.Elapsed.Seconds(); secs > 0 {
+		rate = float64(info.Rollouts) / secs
+	}
+	return fmt.Sprintf("%s thinking: %d/%d visits, %.0f/s, best %s (%.1f%%)",
+		name, info.Visits, info.Target, rate, info.Best, info.Winrate*100)
+}
+
+// humanMove lets the player to move pick a square with the cursor. It returns
+// false if the player quit.
+func (t *TUI) humanMove(start time.Time) bool {
+	g := t.g
+	warned, warning := -1, ""
+	for {
+		t.draw()
+		switch readKey() {
+		case keyUp:
+			if t.cursor >= 8 {
+				t.cursor -= 8
+			}
+		case keyDown:
+			if t.cursor < 56 {
+				t.cursor += 8
+			}
+		case keyLeft:
+			if t.cursor%8 > 0 {
+				t.cursor--
+			}
+		case keyRight:
+			if t.cursor%8 < 7 {
+				t.cursor++
+			}
+		case keyUndo:
+			if n := g.undo(g.gs.PlayerID); n > 0 {
+				t.message = tr("took.back", n)
+				return true
+			}
+			t.message = tr("nothing.to.undo")
+		case keyHint:
+			a := Analyze(g.gs, g.hintIterations)
+			t.cursor = a.Best.ToIndex()
+			t.message = tr("hint", a.Best, a.Eval(1))
+		case keyEnter:
+			mask := game.Bitboard(1) << uint(t.cursor)
+			if g.rules.LegalMoves(&g.gs)&mask == 0 {
+				if g.gs.Board.Occupied&mask != 0 {
+					t.message = tr("err.occupied")
+				} else {
+					t.message = tr("forced", formatSquares(g.gs.ForcedMoves()))
+				}
+				continue
+			}
+			// The coach lets a move it warned about through on a second
+			// enter.
+			if t.cursor != warned {
+				if w := g.coachWarning(game.MoveFromIndex(t.cursor)); w != "" {
+					t.message = tr("coach.warning", w) + " " + tr("coach.again")
+					warned, warning = t.cursor, w
+					continue
+				}
+			} else {
+				g.overridden = warning
+			}
+			before := g.gs
+			t.message = t.playMove(game.MoveFromIndex(t.cursor))
+			g.setMoveTime(time.Since(start))
+			g.noteOverride()
+			g.checkMove(before, game.MoveFromIndex(t.cursor))
+			return true
+		case keyQuit:
+			return false
+		}
+	}
+}
+
+func (t *TUI) playMove(move game.Move) string {
+	g := t.g
+	mover := g.gs.PlayerID
+	msg := fmt.Sprintf("%s played %s.", g.GetPlayer(mover).Name(), move)
+	if out := g.play(move); out != -1 {
+		msg += " " + g.exitText(move, out) + "."
+	}
+	return msg
+}
+
+// Run plays the game until it ends or a human quits.
+func (t *TUI) Run() error {
+	restore, err := enterRawMode()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	fmt.Print(ansiHideCursor)
+	defer fmt.Print(ansiShowCursor)
+
+	g := t.g
+	g.start()
+
+	for {
+		if _, ok := g.terminal(); ok {
+			t.search = ""
+			t.message = tr("result", g.resultText()) + " (press any key)"
+			t.draw()
+			readKey()
+			return nil
+		}
+
+		id := g.gs.PlayerID
+		start := time.Now()
+		switch p := g.GetPlayer(id).(type) {
+		case *MCTSPlayer:
+			p.Verbose = false
+			p.OnProgress = func(info SearchInfo) {
+				t.search = formatSearchInfo(p.Name(), info)
+				t.draw()
+			}
+			activeIDs := g.gs.ActiveIDs()
+			var turnIdx int
+			for i, aid := range activeIDs {
+				if aid == id {
+					turnIdx = i
+				}
+			}
+			move := p.GetMove(g.gs.Board, activeIDs, turnIdx)
+			p.OnProgress = nil
+			t.message = t.playMove(move)
+			g.setMoveTime(time.Since(start))
+			if p.bookMove != nil {
+				g.annotate(fmt.Sprintf("book, %d games, score %.1f%%", p.bookMove.Games, p.bookMove.Score()*100))
+			} else if p.root != nil {
+				g.annotate(fmt.Sprintf("winrate %.1f%%", p.root.Q[id]*100))
+			}
+		default:
+			if !t.humanMove(start) {
+				return nil
+			}
+		}
+	}
+}
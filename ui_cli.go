@@ -4,16 +4,23 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"math/bits"
 	"os"
-	"strconv"
 	"strings"
+	"time"
+
+	"squava/game"
 )
 
+var stdin = bufio.NewReader(os.Stdin)
+
 // --- Human Player ---
 type HumanPlayer struct {
 	info PlayerInfo
+	game *SquavaGame // Set by AddPlayer; serves in-game commands
 }
 
 func NewHumanPlayer(name, symbol string, id int) *HumanPlayer {
@@ -22,84 +29,187 @@ func NewHumanPlayer(name, symbol string, id int) *HumanPlayer {
 func (h *HumanPlayer) Name() string   { return h.info.name }
 func (h *HumanPlayer) Symbol() string { return h.info.symbol }
 func (h *HumanPlayer) ID() int        { return h.info.id }
-func (h *HumanPlayer) GetMove(board Board, players []int, turnIdx int) Move {
-	forcedMoves := GetForcedMoves(board, players, turnIdx)
-	reader := bufio.NewReader(os.Stdin)
+func (h *HumanPlayer) GetMove(board game.Board, players []int, turnIdx int) game.Move {
+	forcedMoves := game.GetForcedMoves(board, players, turnIdx)
+	if h.game != nil && !h.game.squava() {
+		forcedMoves = 0 // A variant's own legal moves decide
+	}
+	warned, warning := game.ResignMove, ""
 	for {
-		prompt := fmt.Sprintf("%s (%s), enter your move (e.g., A1): ", h.info.name, h.info.symbol)
+		prompt := tr("prompt", h.info.name, h.info.symbol)
 		if forcedMoves != 0 {
 			forcedStr := []string{}
 			temp := forcedMoves
 			for temp != 0 {
 				idx := bits.TrailingZeros64(uint64(temp))
-				m := MoveFromIndex(idx)
-				forcedStr = append(forcedStr, fmt.Sprintf("%c%d", int(m.c)+65, int(m.r)+1))
-				temp &= Bitboard(^(uint64(1) << idx))
+				m := game.MoveFromIndex(idx)
+				forcedStr = append(forcedStr, m.String())
+				temp &= game.Bitboard(^(uint64(1) << idx))
+			}
+			gs := game.NewGameState(board, players[turnIdx], game.ActiveMaskOf(players))
+			if gs.Wins[gs.PlayerID] != 0 {
+				fmt.Println(tr("forced.win", strings.Join(forcedStr, ", ")))
+			} else {
+				fmt.Println(tr("forced.block", strings.Join(forcedStr, ", ")))
+			}
+			for _, reason := range ExplainForcedMoves(gs) {
+				fmt.Printf("  %s\n", reason)
 			}
-			fmt.Printf("FORCED MOVE! You must block the next player. Valid moves: %s\n", strings.Join(forcedStr, ", "))
 		}
 		fmt.Print(prompt)
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(strings.ToUpper(input))
-		r, c, err := parseInput(input)
-		if err != nil {
-			fmt.Println("Invalid format. Use algebraic (A1).")
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println()
+			fmt.Println(tr("end.of.input"))
+			os.Exit(exitError)
+		}
+		if h.game != nil {
+			if handled, action := h.game.dispatch(line); handled {
+				if action != actionNone {
+					h.game.pending = action
+					return game.Move{}
+				}
+				continue
+			}
+		}
+		move, err := game.ParseMove(line)
+		if errors.Is(err, game.ErrMoveOutOfBounds) {
+			fmt.Println(tr("err.bounds"))
 			continue
 		}
-		if !isValidCoord(r, c) {
-			fmt.Println("Move out of bounds.")
+		if err != nil {
+			fmt.Println(tr("err.format"))
 			continue
 		}
-		idx := r*8 + c
+		idx := move.ToIndex()
 		mask := uint64(1) << idx
 		if (uint64(board.Occupied) & mask) != 0 {
-			fmt.Println("Cell already occupied.")
+			fmt.Println(tr("err.occupied"))
+			continue
+		}
+		if forcedMoves != 0 && (forcedMoves&(game.Bitboard(1)<<idx)) == 0 {
+			fmt.Println(tr("err.forced"))
 			continue
 		}
-		move := Move{int8(r), int8(c)}
-		if forcedMoves != 0 && (forcedMoves&(Bitboard(1)<<idx)) == 0 {
-			fmt.Println("Invalid move. You must block the opponent or win immediately.")
+		if h.game != nil && !h.game.legal(move) {
+			fmt.Println(tr("err.illegal"))
 			continue
 		}
+		// The coach lets a move it warned about through when it is entered
+		// a second time.
+		if h.game != nil && move != warned {
+			if w := h.game.coachWarning(move); w != "" {
+				fmt.Println(tr("coach.warning", w))
+				fmt.Println(tr("coach.confirm", move))
+				warned, warning = move, w
+				continue
+			}
+		}
+		if h.game != nil && move == warned {
+			h.game.overridden = warning
+		}
 		return move
 	}
 }
-func parseInput(inp string) (int, int, error) {
-	if len(inp) < 2 {
-		return 0, 0, fmt.Errorf("invalid length")
-	}
-	colChar := inp[0]
-	rowStr := inp[1:]
-	if colChar < 'A' || colChar > 'H' {
-		return 0, 0, fmt.Errorf("invalid column")
-	}
-	col := int(colChar - 'A')
-	row, err := strconv.Atoi(rowStr)
-	if err != nil {
-		return 0, 0, err
-	}
-	return row - 1, col, nil
-}
-func isValidCoord(r, c int) bool {
-	return r >= 0 && r < BoardSize && c >= 0 && c < BoardSize
-}
 
 // --- Game Engine ---
 type SquavaGame struct {
-	gs      GameState
-	players []Player
+	gs       game.GameState
+	players  []Player
+	rules    Rules // SquavaRules unless SetRules gives a variant
+	seed     uint64
+	history  []game.GameState // State before each move in moves
+	moves    []game.Move
+	comments []string            // Annotation per move, e.g. the engine's winrate
+	times    []time.Duration     // Think time per move
+	searches []*game.SearchStats // Engine search per move, nil for other players
+	pending  gameAction          // Set by a human command that interrupts GetMove
+
+	hintIterations int
+	style          BoardStyle
+	showKifu       bool // Print a numbered-stone board when the game ends
+	machineResult  bool // Print a machine-readable RESULT line at the end
+	autosavePath   string
+	tablePath      string // Table file the engines' graphs are kept in
+	tableMinVisits int
+	reportPath     string // HTML report written when the game ends
+	reportEngine   []byte // WASM build of squava embedded in reports, if any
+	kibitz         *Kibitzer
+	checker        *MoveChecker
+	coachDepth     int    // Solver depth of the coach's warnings; 0 for no coach
+	overridden     string // Warning the human played against with the pending move
+	viewer         *EngineViewer
+	treeDump       *TreeDump
+	iterations     int // Recorded so a resumed game gets the same engines
+	started        bool
+	resumed        bool             // Loaded from a record rather than played from the seed
+	loaded         *game.GameRecord // The record the game was loaded from, if any
 }
 
 func NewSquavaGame() *SquavaGame {
 	return &SquavaGame{
-		gs: GameState{WinnerID: -1},
+		gs:             game.GameState{WinnerID: -1},
+		rules:          SquavaRules{},
+		hintIterations: 20000,
 	}
 }
 
+// SetHintIterations sets the search size used for the hint command.
+func (g *SquavaGame) SetHintIterations(n int) {
+	g.hintIterations = n
+}
+
 func (g *SquavaGame) AddPlayer(p Player) {
+	switch p := p.(type) {
+	case *HumanPlayer:
+		p.game = g
+	case *ExternalPlayer:
+		p.game = g
+	case *MCTSPlayer:
+		if !g.squava() {
+			p.SetRules(g.rules)
+		}
+	}
 	g.players = append(g.players, p)
 }
 
+// SetRules makes the game a variant played under rules: its start, legal
+// moves, what a move does and when the game ends. The engines at the board
+// search under them too. Hints, the coach, the kibitzer and the threat
+// displays still read the position as squava.
+func (g *SquavaGame) SetRules(rules Rules) {
+	g.rules = rules
+	for _, p := range g.engines() {
+		p.SetRules(rules)
+	}
+}
+
+// squava reports whether the game is played under the squava rules.
+func (g *SquavaGame) squava() bool {
+	_, ok := g.rules.(SquavaRules)
+	return ok
+}
+
+// terminal reports whether the game is over under its rules, and who won
+// it, or -1 for a draw.
+func (g *SquavaGame) terminal() (int, bool) {
+	return g.rules.Terminal(&g.gs)
+}
+
+// legal reports whether the player to move may play move under the rules.
+func (g *SquavaGame) legal(move game.Move) bool {
+	return g.rules.LegalMoves(&g.gs)&(game.Bitboard(1)<<uint(move.ToIndex())) != 0
+}
+
+// Close releases the players' resources, such as external engine processes.
+func (g *SquavaGame) Close() {
+	for _, p := range g.players {
+		if c, ok := p.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
 func (g *SquavaGame) GetPlayer(id int) Player {
 	for _, p := range g.players {
 		if p.ID() == id {
@@ -109,67 +219,794 @@ func (g *SquavaGame) GetPlayer(id int) Player {
 	return nil
 }
 
+// BoardStyle controls how PrintBoard draws the board.
+type BoardStyle struct {
+	Unicode bool // Draw stones as ●○▲ instead of X O Z
+	Color   bool // Use ANSI colors and highlights
+	// Accessible describes the board and moves in words for screen readers
+	// instead of drawing them.
+	Accessible bool
+	// Stones and StoneColors replace the stones and their colors of each
+	// player where set, as a user profile's preferences do.
+	Stones      [3]string
+	StoneColors [3]string
+}
+
+var (
+	asciiStones   = [3]string{"X", "O", "Z"}
+	unicodeStones = [3]string{"●", "○", "▲"}
+	stoneColors   = [3]string{"\033[31m", "\033[34m", "\033[32m"}
+)
+
+const (
+	ansiReset     = "\033[0m"
+	ansiReverse   = "\033[7m"
+	ansiForced    = "\033[33m"
+	ansiWinLine   = "\033[42m"
+	ansiLoseLine  = "\033[41m"
+	forcedMarker  = "*"
+	emptyMarker   = "."
+	unicodeForced = "◇"
+)
+
+func stdoutIsTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// DefaultBoardStyle picks the richest style the output supports: plain ASCII
+// when requested or when stdout is not a terminal, and no color if NO_COLOR is
+// set.
+func DefaultBoardStyle(plain bool) BoardStyle {
+	if plain {
+		return BoardStyle{}
+	}
+	if !stdoutIsTerminal() {
+		return BoardStyle{}
+	}
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return BoardStyle{Unicode: true, Color: !noColor}
+}
+
+// SetShowKifu enables printing a numbered-stone board at the end of the game.
+func (g *SquavaGame) SetShowKifu(show bool) {
+	g.showKifu = show
+}
+
+// SetAutosave makes the game rewrite its record to path after every move.
+func (g *SquavaGame) SetAutosave(path string) {
+	g.autosavePath = path
+}
+
+// SetTableFile makes the engines start from the search graph saved in path,
+// if it exists, and saves their graph below the positions of the last round
+// there, without the nodes with fewer than minVisits visits, after every
+// move.
+func (g *SquavaGame) SetTableFile(path string, minVisits int) {
+	g.tablePath, g.tableMinVisits = path, minVisits
+}
+
+// engines returns the game's MCTS players.
+func (g *SquavaGame) engines() []*MCTSPlayer {
+	var engines []*MCTSPlayer
+	for _, p := range g.players {
+		if m, ok := p.(*MCTSPlayer); ok {
+			engines = append(engines, m)
+		}
+	}
+	return engines
+}
+
+// SetReport makes the game write an HTML report to path when it ends,
+// analyzing each position with the hint search size.
+func (g *SquavaGame) SetReport(path string) {
+	g.reportPath = path
+}
+
+// SetReportEngine embeds wasm, a WebAssembly build of squava read by
+// LoadReportEngine, in the game's reports to explore their positions with.
+func (g *SquavaGame) SetReportEngine(wasm []byte) {
+	g.reportEngine = wasm
+}
+
+// SetKibitzer attaches an engine that comments on every move.
+func (g *SquavaGame) SetKibitzer(k *Kibitzer) {
+	g.kibitz = k
+}
+
+// SetMoveChecker has c check the human moves and their verdicts saved in
+// the record.
+func (g *SquavaGame) SetMoveChecker(c *MoveChecker) {
+	g.checker = c
+}
+
+// SetCoach has the game warn humans before a move that loses by force or
+// misses a forced win within depth of the players' moves (see
+// CoachWarning); a move played against a warning is noted in the record.
+func (g *SquavaGame) SetCoach(depth int) {
+	g.coachDepth = depth
+}
+
+// coachWarning returns the coach's warning about move for the player to
+// move, if any.
+func (g *SquavaGame) coachWarning(move game.Move) string {
+	if g.coachDepth == 0 {
+		return ""
+	}
+	return CoachWarning(g.gs, move, g.coachDepth)
+}
+
+// noteOverride notes in the comment of the move just played the warning its
+// player overrode, if any.
+func (g *SquavaGame) noteOverride() {
+	if g.overridden != "" {
+		g.annotate("played against the coach: " + g.overridden)
+		g.overridden = ""
+	}
+}
+
+// SetViewer shows the engines' candidate moves side by side after every
+// engine move.
+func (g *SquavaGame) SetViewer(v *EngineViewer) {
+	g.viewer = v
+}
+
+// SetTreeDump exports the engines' search trees after each of their moves.
+func (g *SquavaGame) SetTreeDump(d *TreeDump) {
+	g.treeDump = d
+}
+
+// SetIterations records the engine strength in saved games.
+func (g *SquavaGame) SetIterations(n int) {
+	g.iterations = n
+}
+
+// SetMachineResult enables a final machine-readable RESULT line.
+func (g *SquavaGame) SetMachineResult(on bool) {
+	g.machineResult = on
+}
+
+// SetBoardStyle sets how the board is drawn.
+func (g *SquavaGame) SetBoardStyle(style BoardStyle) {
+	g.style = style
+}
+
+// lineHighlights returns the squares of finished lines: the winner's
+// 4-in-a-row and each eliminated player's 3-in-a-row.
+func (g *SquavaGame) lineHighlights() (winLine, loseLine game.Bitboard) {
+	winnerID, terminal := g.terminal()
+	for p := 0; p < 3; p++ {
+		isEliminated := (g.gs.ActiveMask & (1 << uint(p))) == 0
+		isWinner := terminal && winnerID == p
+		if isEliminated || isWinner {
+			w, l := game.GetWinsAndLosses(g.gs.Board.P[p], g.gs.Board.P[p])
+			if isWinner {
+				winLine |= w
+			}
+			if isEliminated {
+				loseLine |= l
+			}
+		}
+	}
+	return
+}
+
 func (g *SquavaGame) PrintBoard() {
-	fmt.Print("   ")
-	for i := 0; i < BoardSize; i++ {
-		fmt.Printf("%c ", 'A'+i)
-	}
-	fmt.Println()
-	for r := 0; r < BoardSize; r++ {
-		fmt.Printf("%2d ", r+1)
-		for c := 0; c < BoardSize; c++ {
-			symbol := "."
+	lines := g.renderBoard(-1)
+	if g.style.Accessible {
+		lines = g.describeBoard()
+	}
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+// lastPlaced returns the square of the most recent stone, or -1.
+func (g *SquavaGame) lastPlaced() int {
+	for i := len(g.moves) - 1; i >= 0; i-- {
+		if g.moves[i] != game.ResignMove {
+			return g.moves[i].ToIndex()
+		}
+	}
+	return -1
+}
+
+// renderBoard draws the board as text lines in the game's style. The square
+// at cursor is framed with brackets; without a cursor (-1) the last move is.
+func (g *SquavaGame) renderBoard(cursor int) []string {
+	styled := g.style.Unicode || g.style.Color
+	var forced, winLine, loseLine game.Bitboard
+	lastIdx := g.lastPlaced()
+	if cursor == -1 {
+		cursor = lastIdx
+	}
+	if styled {
+		forced = g.gs.ForcedMoves()
+		winLine, loseLine = g.lineHighlights()
+	}
+
+	lines := make([]string, 0, game.BoardSize+1)
+	var sb strings.Builder
+	sb.WriteString("   ")
+	for i := 0; i < game.BoardSize; i++ {
+		fmt.Fprintf(&sb, "%c ", 'A'+i)
+	}
+	lines = append(lines, sb.String())
+	for r := 0; r < game.BoardSize; r++ {
+		sb.Reset()
+		fmt.Fprintf(&sb, "%2d", r+1)
+		for c := 0; c < game.BoardSize; c++ {
 			idx := r*8 + c
-			mask := Bitboard(uint64(1) << idx)
-			if (g.gs.Board.P[0] & mask) != 0 {
-				symbol = "X"
-			} else if (g.gs.Board.P[1] & mask) != 0 {
-				symbol = "O"
-			} else if (g.gs.Board.P[2] & mask) != 0 {
-				symbol = "Z"
+			mask := game.Bitboard(uint64(1) << idx)
+			cell := emptyMarker
+			color := ""
+			for p := 0; p < 3; p++ {
+				if (g.gs.Board.P[p] & mask) != 0 {
+					cell = asciiStones[p]
+					if g.style.Unicode {
+						cell = unicodeStones[p]
+					}
+					if g.style.Stones[p] != "" {
+						cell = g.style.Stones[p]
+					}
+					color = stoneColors[p]
+					if g.style.StoneColors[p] != "" {
+						color = g.style.StoneColors[p]
+					}
+				}
+			}
+			if forced&mask != 0 {
+				cell = forcedMarker
+				if g.style.Unicode {
+					cell = unicodeForced
+				}
+				color = ansiForced
 			}
-			fmt.Printf("%s ", symbol)
+			if g.style.Color {
+				switch {
+				case winLine&mask != 0:
+					color += ansiWinLine
+				case loseLine&mask != 0:
+					color += ansiLoseLine
+				case idx == lastIdx:
+					color += ansiReverse
+				}
+				if color != "" {
+					cell = color + cell + ansiReset
+				}
+			}
+			sb.WriteByte(cellSeparator(cursor, r, c))
+			sb.WriteString(cell)
 		}
-		fmt.Println()
+		sb.WriteByte(cellSeparator(cursor, r, game.BoardSize))
+		lines = append(lines, sb.String())
 	}
+	return lines
 }
 
-func (g *SquavaGame) Run() {
-	fmt.Println("Starting 3-Player Squava!")
-	fmt.Printf("Random Seed: %d\n", xorState)
-	fmt.Println("Board Size: 8x8")
-	fmt.Println("Rules: 4-in-a-row wins. 3-in-a-row loses.")
+// describeBoard lists the stones row by row in words, for screen readers.
+func (g *SquavaGame) describeBoard() []string {
+	lines := []string{"Board:"}
+	for r := game.BoardSize - 1; r >= 0; r-- {
+		row := game.Bitboard(0xFF) << uint(r*8)
+		var parts []string
+		for _, p := range g.players {
+			if stones := g.gs.Board.P[p.ID()] & row; stones != 0 {
+				parts = append(parts, fmt.Sprintf("%s at %s", p.Name(), formatSquares(stones)))
+			}
+		}
+		if len(parts) > 0 {
+			lines = append(lines, fmt.Sprintf("Row %d: %s.", r+1, strings.Join(parts, "; ")))
+		}
+	}
+	switch {
+	case len(lines) == 1:
+		lines[0] = "The board is empty."
+	case g.gs.Board.Occupied != ^game.Bitboard(0):
+		lines = append(lines, "All other squares are empty.")
+	}
+	if last := g.lastPlaced(); last >= 0 {
+		lines = append(lines, fmt.Sprintf("Last move: %s.", game.MoveFromIndex(last)))
+	}
+	return lines
+}
+
+// describeThreats says in words which players can win or would lose on which
+// squares, or returns nil if nobody has a threat. Unless allLosses is set,
+// losing squares are only given for the player to move.
+func (g *SquavaGame) describeThreats(allLosses bool) []string {
+	var lines []string
+	for _, id := range g.gs.ActiveIDs() {
+		name := g.GetPlayer(id).Name()
+		if wins := g.gs.Wins[id] & ^g.gs.Board.Occupied; wins != 0 {
+			lines = append(lines, fmt.Sprintf("%s can win at %s.", name, formatSquares(wins)))
+		}
+		if loses := g.gs.Loses[id] & ^g.gs.Board.Occupied; loses != 0 && (allLosses || id == g.gs.PlayerID) {
+			lines = append(lines, fmt.Sprintf("%s would be eliminated at %s.", name, formatSquares(loses)))
+		}
+	}
+	return lines
+}
+
+// announceMove describes a move just played from gs in words, e.g. "Player 2
+// plays E5, which threatens 4-in-a-row at E6."
+func (g *SquavaGame) announceMove(gs game.GameState, move game.Move) string {
+	name := g.GetPlayer(gs.PlayerID).Name()
+	if move == game.ResignMove {
+		return name + " resigns."
+	}
+	msg := fmt.Sprintf("%s plays %s", name, move)
+	if reasons := DescribeMove(gs, move); len(reasons) > 0 {
+		msg += ", which " + strings.Join(reasons, " and ")
+	}
+	return msg + "."
+}
+
+// renderThreats draws one board per active player in which empty squares are
+// marked W if playing there completes a 4-in-a-row for that player, or L if it
+// makes a losing 3-in-a-row. The boards are laid out side by side.
+func (g *SquavaGame) renderThreats() []string {
+	ids := g.gs.ActiveIDs()
+	empty := ^g.gs.Board.Occupied
+	var wins, loses [3]game.Bitboard
+	for _, id := range ids {
+		wins[id], loses[id] = game.GetWinsAndLosses(g.gs.Board.P[id], empty)
+	}
+
+	const width = 3 + 2*game.BoardSize + 2
+	lines := make([]string, game.BoardSize+2)
+	for _, id := range ids {
+		p := g.GetPlayer(id)
+		lines[0] += fmt.Sprintf("%-*s", width, fmt.Sprintf("   %s (%s)", p.Name(), p.Symbol()))
+		header := "   "
+		for i := 0; i < game.BoardSize; i++ {
+			header += fmt.Sprintf("%c ", 'A'+i)
+		}
+		lines[1] += fmt.Sprintf("%-*s", width, header)
+		for r := 0; r < game.BoardSize; r++ {
+			row := fmt.Sprintf("%2d ", r+1)
+			for c := 0; c < game.BoardSize; c++ {
+				mask := game.Bitboard(uint64(1) << (r*8 + c))
+				cell := emptyMarker
+				for q := 0; q < 3; q++ {
+					if g.gs.Board.P[q]&mask != 0 {
+						cell = asciiStones[q]
+					}
+				}
+				if wins[id]&mask != 0 {
+					cell = "W"
+				} else if loses[id]&mask != 0 {
+					cell = "L"
+				}
+				row += cell + " "
+			}
+			lines[r+2] += fmt.Sprintf("%-*s", width, row)
+		}
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+	return append(lines, "W = completes 4-in-a-row (wins), L = makes 3-in-a-row (eliminated)")
+}
+
+// renderKifu draws the board with each stone labelled by its symbol and the
+// number of the move that placed it, like a kifu diagram.
+func (g *SquavaGame) renderKifu() []string {
+	var numbers [64]int
+	var owners [64]int
+	for i, m := range g.moves {
+		if m != game.ResignMove {
+			numbers[m.ToIndex()] = i + 1
+			owners[m.ToIndex()] = g.history[i].PlayerID
+		}
+	}
+	lines := make([]string, 0, game.BoardSize+1)
+	header := "   "
+	for i := 0; i < game.BoardSize; i++ {
+		header += fmt.Sprintf("%c   ", 'A'+i)
+	}
+	lines = append(lines, strings.TrimRight(header, " "))
+	for r := 0; r < game.BoardSize; r++ {
+		row := fmt.Sprintf("%2d ", r+1)
+		for c := 0; c < game.BoardSize; c++ {
+			idx := r*8 + c
+			if numbers[idx] == 0 {
+				row += ".   "
+				continue
+			}
+			row += fmt.Sprintf("%s%-2d ", asciiStones[owners[idx]], numbers[idx])
+		}
+		lines = append(lines, strings.TrimRight(row, " "))
+	}
+	return lines
+}
 
+// cellSeparator returns the character drawn before column c of row r (or
+// after the last square when c == BoardSize), framing the cursor square.
+func cellSeparator(cursor, r, c int) byte {
+	switch {
+	case c < game.BoardSize && cursor == r*8+c:
+		return '['
+	case c > 0 && cursor == r*8+c-1:
+		return ']'
+	}
+	return ' '
+}
+
+// Record returns the game so far as a portable GameRecord.
+func (g *SquavaGame) Record() *game.GameRecord {
+	r := &game.GameRecord{Seed: g.seed, Iterations: g.iterations}
+	for _, p := range g.players {
+		r.Players[p.ID()] = g.playerType(p)
+	}
+	r.Moves = append(r.Moves, g.moves...)
+	for i, c := range g.comments {
+		if c != "" {
+			r.SetComment(i, c)
+		}
+	}
+	for i, d := range g.times {
+		if d > 0 {
+			r.SetMoveTime(i, d)
+		}
+	}
+	for i, s := range g.searches {
+		if s != nil {
+			r.SetSearch(i, s)
+		}
+	}
+	for i, m := range g.moves {
+		if g.checker == nil {
+			break
+		}
+		if v := g.checker.Verdict(i, g.history[i], m); v != "" {
+			r.SetCheck(i, v)
+		}
+	}
+	if l := g.loaded; l != nil {
+		// What the game does not keep of a loaded record carries over, for
+		// the moves that are still the same.
+		r.Tags, r.Intro = l.Tags, l.Intro
+		for i := 0; i < len(r.Moves) && i < len(l.Moves) && r.Moves[i] == l.Moves[i]; i++ {
+			if m := l.Mark(i); m != "" {
+				r.SetMark(i, m)
+			}
+			if d := l.Clock(i); d > 0 {
+				r.SetClock(i, d)
+			}
+			if w, ok := l.Eval(i); ok {
+				r.SetEval(i, w)
+			}
+			if v := l.Check(i); v != "" && r.Check(i) == "" {
+				r.SetCheck(i, v)
+			}
+		}
+	}
+	if _, terminal := g.terminal(); terminal && g.started {
+		r.Result = g.recordResult()
+	}
+	return r
+}
+
+// SaveRecord writes the game record to path, replacing the file atomically
+// so an interrupted write never leaves a truncated save.
+func (g *SquavaGame) SaveRecord(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := g.Record().Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// start sets up the initial position unless a game is already in progress.
+func (g *SquavaGame) start() {
+	if g.started {
+		return
+	}
+	g.started = true
+	g.seed = mainRand.State()
 	activeMask := uint8(0)
 	for _, p := range g.players {
 		activeMask |= 1 << uint(p.ID())
 	}
-	g.gs = NewGameState(g.gs.Board, g.players[0].ID(), activeMask)
+	g.gs = g.rules.Start()
+	if g.gs.PlayerID != g.players[0].ID() || g.gs.ActiveMask != activeMask {
+		// Fewer players, or another first player, than the rules start with.
+		g.gs = game.NewGameState(g.gs.Board, g.players[0].ID(), activeMask)
+	}
+}
+
+// Load replays a record's moves from the initial position so that Run
+// continues the game from where the record ends.
+func (g *SquavaGame) Load(r *game.GameRecord) error {
+	if r.Seed != 0 {
+		mainRand.Seed(r.Seed)
+	}
+	g.started = false
+	g.resumed = true
+	g.loaded = r
+	g.history = g.history[:0]
+	g.moves = g.moves[:0]
+	g.comments = g.comments[:0]
+	g.times = g.times[:0]
+	g.searches = g.searches[:0]
+	g.start()
+	for i, m := range r.Moves {
+		if _, terminal := g.terminal(); terminal {
+			return fmt.Errorf("move %d: %s played after the game ended", i+1, game.FormatRecordMove(m))
+		}
+		if m != game.ResignMove && !g.legal(m) {
+			return fmt.Errorf("move %d: %s is not legal", i+1, m)
+		}
+		g.play(m)
+		g.annotate(r.Comment(i))
+		g.setMoveTime(r.MoveTime(i))
+		g.setSearch(r.Search(i))
+	}
+	return nil
+}
+
+// playerType returns the player type that recreates p, e.g. "mcts:trappy".
+func (g *SquavaGame) playerType(p Player) string {
+	switch p := p.(type) {
+	case *MCTSPlayer:
+		return SeatSpec{Kind: "mcts", Personality: p.Personality(), Iterations: p.iterations}.PlayerType(g.iterations)
+	case *ExternalPlayer:
+		return SeatSpec{Kind: "cmd", Command: p.command}.PlayerType(g.iterations)
+	case *HumanPlayer, *ScriptedPlayer:
+		return "human"
+	}
+	return "unknown"
+}
+
+// play applies a move (or ResignMove) for the player to move, keeping the
+// history needed for undo. It returns the ID of the player who left the game
+// with this move, or -1.
+func (g *SquavaGame) play(move game.Move) int {
+	prevMask := g.gs.ActiveMask
+	g.history = append(g.history, g.gs)
+	g.moves = append(g.moves, move)
+	g.comments = append(g.comments, "")
+	g.times = append(g.times, 0)
+	g.searches = append(g.searches, nil)
+
+	if move == game.ResignMove {
+		g.gs.Resign()
+	} else {
+		g.rules.Play(&g.gs, move.ToIndex())
+	}
+
+	if g.gs.ActiveMask != prevMask {
+		// Find who was eliminated
+		for i := 0; i < 3; i++ {
+			if (prevMask&(1<<uint(i))) != 0 && (g.gs.ActiveMask&(1<<uint(i))) == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// annotate sets the comment of the last move played.
+func (g *SquavaGame) annotate(comment string) {
+	if n := len(g.comments); n > 0 {
+		g.comments[n-1] = comment
+	}
+}
+
+// setMoveTime records the think time of the last move played.
+func (g *SquavaGame) setMoveTime(d time.Duration) {
+	if n := len(g.times); n > 0 {
+		g.times[n-1] = d
+	}
+}
+
+// setSearch records the engine search behind the last move played.
+func (g *SquavaGame) setSearch(s *game.SearchStats) {
+	if n := len(g.searches); n > 0 {
+		g.searches[n-1] = s
+	}
+}
+
+// timeUsed returns the total think time of a player and their number of moves.
+func (g *SquavaGame) timeUsed(id int) (time.Duration, int) {
+	var total time.Duration
+	moves := 0
+	for i, d := range g.times {
+		if g.history[i].PlayerID == id {
+			total += d
+			moves++
+		}
+	}
+	return total, moves
+}
+
+// formatClock rounds d for display, e.g. "15ms", "1.2s" or "2m3.4s".
+func formatClock(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// resultText describes a finished game in the current language, e.g.
+// "Player 1 Wins (4-in-a-row)".
+func (g *SquavaGame) resultText() string {
+	return g.resultIn(messages, func() string { return g.GetPlayer(g.gs.WinnerID).Name() })
+}
+
+// recordResult is the result in the canonical English form used by records.
+func (g *SquavaGame) recordResult() string {
+	return g.resultIn(enMessages, func() string { return enMessages.format("player", g.gs.WinnerID+1) })
+}
+
+func (g *SquavaGame) resultIn(c Catalog, winnerName func() string) string {
+	winnerID, _ := g.terminal()
+	if winnerID == -1 {
+		return c.format("result.draw")
+	}
+	if isWin, _ := game.CheckBoard(g.gs.Board.P[winnerID]); isWin {
+		return c.format("result.four", winnerName())
+	}
+	return c.format("result.last", winnerName())
+}
+
+// Process exit codes, distinct so that scripts can tell outcomes apart. The
+// game outcome codes are only used in non-interactive games.
+const (
+	exitError   = 1
+	exitUsage   = 2 // Bad flags, or an invalid or incomplete move script
+	exitDraw    = 3
+	exitWinBase = 10 // Player N winning exits with exitWinBase+N-1
+)
+
+// resultSummary is a single machine-readable line describing the result,
+// e.g. "RESULT p1=win p2=loss p3=loss reason=4inrow moves=31 seed=42".
+func (g *SquavaGame) resultSummary() string {
+	winnerID, _ := g.terminal()
+	reason := "draw"
+	if winnerID != -1 {
+		reason = "laststanding"
+		if isWin, _ := game.CheckBoard(g.gs.Board.P[winnerID]); isWin {
+			reason = "4inrow"
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString("RESULT")
+	for id := 0; id < 3; id++ {
+		outcome := "loss"
+		switch winnerID {
+		case -1:
+			outcome = "draw"
+		case id:
+			outcome = "win"
+		}
+		fmt.Fprintf(&sb, " p%d=%s", id+1, outcome)
+	}
+	fmt.Fprintf(&sb, " reason=%s moves=%d seed=%d", reason, len(g.moves), g.seed)
+	return sb.String()
+}
+
+// exitCode is the process exit code for a finished game: 0 for interactive
+// games, otherwise one that tells the outcome.
+func (g *SquavaGame) exitCode() int {
+	winnerID, terminal := g.terminal()
+	switch {
+	case !g.machineResult || !terminal:
+		return 0
+	case winnerID == -1:
+		return exitDraw
+	}
+	return exitWinBase + winnerID
+}
+
+// exitText describes a player leaving the game with move.
+func (g *SquavaGame) exitText(move game.Move, playerID int) string {
+	if move == game.ResignMove {
+		return tr("exit.resigned", g.GetPlayer(playerID).Name())
+	}
+	return tr("exit.eliminated", g.GetPlayer(playerID).Name())
+}
+
+// undo takes back the last move of player playerID, the human asking,
+// together with every move played after it, returning to the position where
+// that player was to move. With several humans at the board, the others'
+// moves are never taken back on their own. Whole GameStates are restored, so
+// hashes and the active mask stay consistent with the board. It returns the
+// number of moves taken back.
+func (g *SquavaGame) undo(playerID int) int {
+	for n := len(g.history) - 1; n >= 0; n-- {
+		if g.history[n].PlayerID == playerID {
+			undone := len(g.history) - n
+			g.gs = g.history[n]
+			g.history = g.history[:n]
+			g.moves = g.moves[:n]
+			g.comments = g.comments[:n]
+			g.times = g.times[:n]
+			g.searches = g.searches[:n]
+			return undone
+		}
+	}
+	return 0
+}
+
+func (g *SquavaGame) Run() {
+	resumed := g.started
+	g.start()
+	fmt.Println(tr("banner"))
+	fmt.Println(tr("seed", g.seed))
+	fmt.Println(tr("board.size", game.BoardSize, game.BoardSize))
+	fmt.Println(tr("rules"))
+	if resumed {
+		fmt.Println(tr("resuming", len(g.moves)))
+	}
+	if g.tablePath != "" {
+		if n, err := loadTableFile(g.tablePath, g.engines()); err != nil {
+			fmt.Fprintf(os.Stderr, "could not load %s: %v\n", g.tablePath, err)
+		} else if n > 0 {
+			fmt.Printf("Loaded %d search nodes from %s\n", n, g.tablePath)
+		}
+	}
+	if g.kibitz != nil {
+		g.kibitz.Watch(g.gs)
+		defer g.kibitz.Stop()
+	}
 
-	moveCount := 1
 	for {
-		winnerID, ok := g.gs.IsTerminal()
-		if ok {
+		if _, ok := g.terminal(); ok {
 			g.PrintBoard()
-			if winnerID != -1 {
-				isWin, _ := CheckBoard(g.gs.Board.P[winnerID])
-				if isWin {
-					fmt.Printf("Result: %s Wins (4-in-a-row)\n", g.GetPlayer(winnerID).Name())
-				} else {
-					fmt.Printf("Result: %s Wins (Last Standing)\n", g.GetPlayer(winnerID).Name())
+			if g.showKifu && !g.style.Accessible {
+				for _, line := range g.renderKifu() {
+					fmt.Println(line)
+				}
+			}
+			fmt.Println(tr("result", g.resultText()))
+			fmt.Println(tr("time.used"))
+			for _, p := range g.players {
+				total, moves := g.timeUsed(p.ID())
+				perMove := time.Duration(0)
+				if moves > 0 {
+					perMove = total / time.Duration(moves)
+				}
+				fmt.Println(tr("time.player", p.Name(), p.Symbol(), formatClock(total), moves, formatClock(perMove)))
+			}
+			if g.machineResult {
+				fmt.Println(g.resultSummary())
+			}
+			if g.checker != nil && g.autosavePath != "" {
+				// Save again once the checks of the last moves are in.
+				g.checker.Wait()
+				if err := g.SaveRecord(g.autosavePath); err != nil {
+					fmt.Fprintf(os.Stderr, "autosave failed: %v\n", err)
+				}
+			}
+			if g.reportPath != "" {
+				if err := g.SaveReport(g.reportPath, g.hintIterations); err != nil {
+					fmt.Fprintf(os.Stderr, "could not write report: %v\n", err)
 				}
-			} else {
-				fmt.Println("Result: Draw")
 			}
 			return
 		}
 
 		currentPlayer := g.GetPlayer(g.gs.PlayerID)
 		g.PrintBoard()
-		fmt.Printf("Move %d: %s (%s)\n", moveCount, currentPlayer.Name(), currentPlayer.Symbol())
+		fmt.Println(tr("move.header", len(g.moves)+1, currentPlayer.Name(), currentPlayer.Symbol()))
 
+		if g.style.Accessible {
+			for _, line := range g.describeThreats(false) {
+				fmt.Println(line)
+			}
+		}
 		if _, ok := currentPlayer.(*MCTSPlayer); ok {
-			fmt.Printf("%s is thinking...\n", currentPlayer.Name())
+			fmt.Println(tr("thinking", currentPlayer.Name()))
 		}
 
 		activeIDs := g.gs.ActiveIDs()
@@ -181,26 +1018,73 @@ func (g *SquavaGame) Run() {
 			}
 		}
 
+		thinkStart := time.Now()
 		move := currentPlayer.GetMove(g.gs.Board, activeIDs, turnIdx)
+		thinkTime := time.Since(thinkStart)
 
-		if _, ok := currentPlayer.(*MCTSPlayer); ok {
-			fmt.Printf("%s chooses %c%d\n", currentPlayer.Name(), int(move.c)+65, int(move.r)+1)
+		action := g.pending
+		g.pending = actionNone
+		switch action {
+		case actionUndo:
+			n := g.undo(currentPlayer.ID())
+			fmt.Println(tr("took.back", n))
+			continue
+		case actionResign:
+			move = game.ResignMove
 		}
 
-		prevMask := g.gs.ActiveMask
-		g.gs.ApplyMove(move)
-		moveCount++
-
-		if g.gs.ActiveMask != prevMask {
-			// Find who was eliminated
-			eliminatedID := -1
-			for i := 0; i < 3; i++ {
-				if (prevMask&(1<<uint(i))) != 0 && (g.gs.ActiveMask&(1<<uint(i))) == 0 {
-					eliminatedID = i
-					break
+		if p, ok := currentPlayer.(*MCTSPlayer); ok {
+			fmt.Printf("%s chooses %s\n", currentPlayer.Name(), move)
+			if g.viewer != nil && move != game.ResignMove {
+				for _, line := range g.viewer.Lines(g.gs, p, move) {
+					fmt.Println(line)
 				}
 			}
-			fmt.Printf("Result: %s Eliminated (3-in-a-row)\n", g.GetPlayer(eliminatedID).Name())
+			if g.treeDump != nil {
+				if err := g.treeDump.Write(p, g.gs, len(g.moves)+1); err != nil {
+					fmt.Fprintf(os.Stderr, "could not export the search tree: %v\n", err)
+				}
+			}
+		}
+
+		if g.style.Accessible {
+			fmt.Println(g.announceMove(g.gs, move))
+		}
+		before := g.gs
+		out := g.play(move)
+		g.setMoveTime(thinkTime)
+		g.noteOverride()
+		g.checkMove(before, move)
+		total, _ := g.timeUsed(currentPlayer.ID())
+		fmt.Println(tr("time", formatClock(thinkTime), formatClock(total)))
+		if p, ok := currentPlayer.(*MCTSPlayer); ok && p.bookMove != nil {
+			g.annotate(fmt.Sprintf("book, %d games, score %.1f%%", p.bookMove.Games, p.bookMove.Score()*100))
+		} else if ok && p.root != nil {
+			g.annotate(fmt.Sprintf("winrate %.1f%%", p.root.Q[p.ID()]*100))
+			if move != game.ResignMove {
+				g.setSearch(p.searchStats(before))
+			}
+		}
+		if out != -1 {
+			fmt.Println(tr("result", g.exitText(move, out)))
+		}
+		if g.kibitz != nil {
+			for _, line := range g.kibitz.Comment(g, before, g.gs, move) {
+				fmt.Printf("Kibitz: %s\n", line)
+			}
+		}
+		if g.autosavePath != "" {
+			if err := g.SaveRecord(g.autosavePath); err != nil {
+				fmt.Fprintf(os.Stderr, "autosave failed: %v\n", err)
+			}
+		}
+		if _, terminal := g.terminal(); g.tablePath != "" && !terminal {
+			// The engines' graphs start at the positions they searched in
+			// the last round, and the current position is below them.
+			positions := append(g.history[max(0, len(g.history)-len(g.players)):len(g.history):len(g.history)], g.gs)
+			if _, err := saveTableFile(g.tablePath, g.engines(), positions, g.tableMinVisits); err != nil {
+				fmt.Fprintf(os.Stderr, "could not save %s: %v\n", g.tablePath, err)
+			}
 		}
 	}
 }
@@ -0,0 +1,213 @@
+//go:build !wasm
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func newTestGame(types ...string) *SquavaGame {
+	g := NewSquavaGame()
+	for i, t := range types {
+		if t == "mcts" {
+			g.AddPlayer(NewMCTSPlayer("AI", "A", i, 100))
+		} else {
+			g.AddPlayer(NewHumanPlayer("Human", "H", i))
+		}
+	}
+	g.gs = game.NewGameState(game.Board{}, 0, 0x07)
+	return g
+}
+
+func TestGameUnderVariantRules(t *testing.T) {
+	// The game loop and its engines follow a variant's rules: every stone
+	// falls to the floor of its column, and the game ends as they say.
+	defer func(out *os.File) { os.Stdout = out }(os.Stdout)
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+
+	var rules gravityRules
+	g := NewSquavaGame()
+	g.AddPlayer(NewMCTSPlayer("X", "X", 0, 100))
+	g.SetRules(rules)
+	g.AddPlayer(NewMCTSPlayer("O", "O", 1, 100))
+	g.AddPlayer(NewMCTSPlayer("Z", "Z", 2, 100))
+	for _, p := range g.engines() {
+		if p.rules == nil {
+			t.Fatalf("Expected %s to search under the game's rules", p.Name())
+		}
+	}
+	g.Run()
+	if _, over := rules.Terminal(&g.gs); !over {
+		t.Fatal("Expected the game to run until the rules end it")
+	}
+	for i, m := range g.moves {
+		if rules.LegalMoves(&g.history[i])&(game.Bitboard(1)<<uint(m.ToIndex())) == 0 {
+			t.Fatalf("move %d: %s is not legal under gravity", i+1, m)
+		}
+	}
+
+	// A record is replayed under the game's rules too.
+	r := g.Record()
+	r.Moves = append([]game.Move{game.MoveFromIndex(8)}, r.Moves...)
+	h := NewSquavaGame()
+	for i := range 3 {
+		h.AddPlayer(NewHumanPlayer("H", "H", i))
+	}
+	h.SetRules(rules)
+	if err := h.Load(r); err == nil || !strings.Contains(err.Error(), "not legal") {
+		t.Errorf("Expected A2 on an empty board to be refused, got %v", err)
+	}
+}
+
+func TestUndoRestoresHumanTurn(t *testing.T) {
+	g := newTestGame("mcts", "human", "mcts")
+	// P1 (AI) A1, P2 (human) B1, P3 (AI) C1, P1 (AI) D1
+	for _, idx := range []int{0, 1, 2, 3} {
+		g.play(game.MoveFromIndex(idx))
+	}
+	before := g.history[1]
+
+	if n := g.undo(1); n != 3 {
+		t.Fatalf("Expected 3 moves taken back, got %d", n)
+	}
+	if g.gs != before {
+		t.Errorf("State after undo does not match the state before the human move")
+	}
+	if g.gs.PlayerID != 1 || len(g.moves) != 1 {
+		t.Errorf("Expected human (P2) to move after 1 move, got player %d after %d moves", g.gs.PlayerID, len(g.moves))
+	}
+	if g.gs.Hash != game.ComputeHash(g.gs.Board, g.gs.PlayerID, g.gs.ActiveMask) {
+		t.Errorf("Hash inconsistent after undo")
+	}
+
+	if n := g.undo(1); n != 0 {
+		t.Errorf("Expected nothing to undo, took back %d", n)
+	}
+}
+
+func TestUndoOwnMove(t *testing.T) {
+	g := newTestGame("human", "human", "mcts")
+	// P1 (human) A1, P2 (human) B1, P3 (AI) C1: P1 asks to undo.
+	for _, idx := range []int{0, 1, 2} {
+		g.play(game.MoveFromIndex(idx))
+	}
+	if n := g.undo(0); n != 3 || g.gs.PlayerID != 0 || len(g.moves) != 0 {
+		t.Errorf("Expected P1's own move and the 2 after it taken back, took back %d, P%d to move", n, g.gs.PlayerID+1)
+	}
+}
+
+func TestUndoElimination(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	// P1 plays A1, B1, C1 (3-in-a-row) and is eliminated.
+	for _, idx := range []int{0, 8, 16, 1, 9, 17, 2} {
+		g.play(game.MoveFromIndex(idx))
+	}
+	if g.gs.ActiveMask != 0x06 {
+		t.Fatalf("Expected P1 eliminated, mask %x", g.gs.ActiveMask)
+	}
+	// P2, to move, takes back B2, and with it P1's losing C1.
+	if n := g.undo(1); n != 3 || g.gs.ActiveMask != 0x07 || g.gs.PlayerID != 1 {
+		t.Errorf("Undo did not restore P1: took back %d, mask %x, player %d", n, g.gs.ActiveMask, g.gs.PlayerID)
+	}
+	if g.gs.Hash != game.ComputeHash(g.gs.Board, g.gs.PlayerID, g.gs.ActiveMask) {
+		t.Errorf("Hash inconsistent after undoing an elimination")
+	}
+}
+
+func TestRenderThreats(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	for _, idx := range []int{0, 8, 16, 1, 9, 17} {
+		g.play(game.MoveFromIndex(idx))
+	}
+	lines := g.renderThreats()
+	// Row 1 of Player 1's board marks C1 as losing.
+	if !strings.HasPrefix(lines[2], " 1 X X L ") {
+		t.Errorf("Expected C1 marked L for Player 1, got %q", lines[2])
+	}
+	if !strings.Contains(lines[3], " 2 O O L ") {
+		t.Errorf("Expected C2 marked L for Player 2, got %q", lines[3])
+	}
+}
+
+func TestRenderKifuAndLastMove(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	for _, idx := range []int{0, 8, 1} {
+		g.play(game.MoveFromIndex(idx))
+	}
+	kifu := g.renderKifu()
+	if !strings.HasPrefix(kifu[1], " 1 X1  Z3  .") || !strings.HasPrefix(kifu[2], " 2 O2  .") {
+		t.Errorf("Unexpected kifu rows: %q, %q", kifu[1], kifu[2])
+	}
+	board := g.renderBoard(-1)
+	if board[1] != " 1 X[Z]. . . . . . " {
+		t.Errorf("Expected last move B1 in brackets, got %q", board[1])
+	}
+}
+
+func TestLoadRejectsIllegalMoves(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	rec := &game.GameRecord{Moves: []game.Move{game.MoveFromIndex(0), game.MoveFromIndex(0)}}
+	if err := g.Load(rec); err == nil {
+		t.Errorf("Expected an error for a repeated square")
+	}
+	rec = &game.GameRecord{Moves: []game.Move{game.MoveFromIndex(0), game.MoveFromIndex(8), game.ResignMove}}
+	if err := g.Load(rec); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.moves) != 3 || g.gs.ActiveMask != 0x03 || g.gs.PlayerID != 0 {
+		t.Errorf("Unexpected state after load: %d moves, mask %x, player %d", len(g.moves), g.gs.ActiveMask, g.gs.PlayerID)
+	}
+}
+
+func TestAccessibleDescriptions(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	if got := g.describeBoard(); len(got) != 1 || got[0] != "The board is empty." {
+		t.Errorf("Empty board: got %q", got)
+	}
+	// Player 1 has A1 and B1, so C1 would make a losing 3-in-a-row.
+	for _, m := range []string{"A1", "A8", "H8", "B1", "B8", "G8"} {
+		mv, _ := game.ParseMove(m)
+		g.play(mv)
+	}
+	before := g.gs
+	c1, _ := game.ParseMove("C1")
+	if got := g.announceMove(before, c1); got != "Human plays C1, which makes 3-in-a-row and is eliminated." {
+		t.Errorf("announceMove: got %q", got)
+	}
+	board := strings.Join(g.describeBoard(), "\n")
+	for _, want := range []string{"Row 8: Human at A8, B8; Human at G8, H8.", "Row 1: Human at A1, B1.", "Last move: G8."} {
+		if !strings.Contains(board, want) {
+			t.Errorf("describeBoard is missing %q:\n%s", want, board)
+		}
+	}
+	threats := strings.Join(g.describeThreats(true), "\n")
+	if !strings.Contains(threats, "would be eliminated at C1") {
+		t.Errorf("describeThreats: got %q", threats)
+	}
+}
+
+func TestResultSummaryAndExitCode(t *testing.T) {
+	g := newTestGame("human", "human", "human")
+	g.seed = 42
+	g.play(game.ResignMove)
+	g.play(game.ResignMove)
+	if got, want := g.resultSummary(), "RESULT p1=loss p2=loss p3=win reason=laststanding moves=2 seed=42"; got != want {
+		t.Errorf("resultSummary: got %q, want %q", got, want)
+	}
+	if code := g.exitCode(); code != 0 {
+		t.Errorf("Interactive games should exit with 0, got %d", code)
+	}
+	g.SetMachineResult(true)
+	if code := g.exitCode(); code != exitWinBase+2 {
+		t.Errorf("Expected exit code %d for a player 3 win, got %d", exitWinBase+2, code)
+	}
+}
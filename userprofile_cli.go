@@ -0,0 +1,484 @@
+//go:build !wasm
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// --- User profiles ---
+
+// A user profile keeps what a person playing locally would otherwise give
+// on every command line: their preferences for the board and the engines,
+// and their rating history against the engines. Profiles are named; games
+// use the one given by -profile, else $SQUAVA_PROFILE, else "default".
+//
+// The preferences are a JSON file in the config directory,
+// $XDG_CONFIG_HOME/squava/profiles/NAME.json (~/.config by default), and
+// the history a JSON line per game in the data directory,
+// $XDG_DATA_HOME/squava/profiles/NAME.history (~/.local/share by default).
+// A profile that was never saved has no preferences and no history.
+
+// UserProfile is the preferences of a profile. Zero fields leave squava's
+// defaults, and command line flags override them.
+type UserProfile struct {
+	Version    int     `json:"version"`
+	Colors     string  `json:"colors,omitempty"`     // A color scheme of colorSchemes
+	Symbols    string  `json:"symbols,omitempty"`    // The stones of players 1 to 3, e.g. "●○▲"
+	Iterations int     `json:"iterations,omitempty"` // Engine iterations when -iterations is not given
+	Target     float64 `json:"target,omitempty"`     // The win rate adaptive engines aim to give, from 0 to 1
+
+	name string
+}
+
+// colorSchemes are the colors of the players' stones by scheme; "none"
+// draws the board without colors.
+var colorSchemes = map[string][3]string{
+	"default":    stoneColors,
+	"colorblind": {"\033[38;5;208m", "\033[38;5;33m", "\033[38;5;170m"}, // Orange, blue and pink
+	"none":       {},
+}
+
+// profileName returns the name of the profile to use given the -profile
+// flag, checking that it can name a file.
+func profileName(flagValue string) (string, error) {
+	name := flagValue
+	if name == "" {
+		name = os.Getenv("SQUAVA_PROFILE")
+	}
+	if name == "" {
+		name = "default"
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("bad profile name %q", name)
+	}
+	return name, nil
+}
+
+// profileConfigPath returns the preferences file of profile name.
+func profileConfigPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "squava", "profiles", name+".json"), nil
+}
+
+// profileHistoryPath returns the rating history file of profile name.
+func profileHistoryPath(name string) (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "squava", "profiles", name+".history"), nil
+}
+
+// LoadUserProfile reads the preferences of profile name; a profile that was
+// never saved has none.
+func LoadUserProfile(name string) (*UserProfile, error) {
+	p := &UserProfile{Version: ProfileVersion, name: name}
+	path, err := profileConfigPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := checkVersion("profile", p.Version, ProfileVersion); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := p.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	p.Version = ProfileVersion
+	return p, nil
+}
+
+// check returns an error if a preference is not one squava can use.
+func (p *UserProfile) check() error {
+	if _, ok := colorSchemes[p.Colors]; p.Colors != "" && !ok {
+		return fmt.Errorf("unknown color scheme %q (available: %s)", p.Colors, strings.Join(colorSchemeNames(), ", "))
+	}
+	if p.Symbols != "" {
+		if _, err := parseSymbols(p.Symbols); err != nil {
+			return err
+		}
+	}
+	if p.Iterations < 0 {
+		return fmt.Errorf("iterations must not be negative")
+	}
+	if p.Target < 0 || p.Target >= 1 {
+		return fmt.Errorf("target must be a win rate from 0 to 1, not %g", p.Target)
+	}
+	return nil
+}
+
+// target returns the win rate adaptive engines aim to give the profile.
+func (p *UserProfile) target() float64 {
+	if p.Target == 0 {
+		return DefaultAdaptiveTarget
+	}
+	return p.Target
+}
+
+// colorSchemeNames returns the names of the color schemes, sorted.
+func colorSchemeNames() []string {
+	names := make([]string, 0, len(colorSchemes))
+	for name := range colorSchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseSymbols splits s into the stones of the three players: three
+// different characters that are not spaces or the empty square's dot.
+func parseSymbols(s string) ([3]string, error) {
+	var stones [3]string
+	if utf8.RuneCountInString(s) != 3 {
+		return stones, fmt.Errorf("symbols %q: want one character for each of the 3 players", s)
+	}
+	i := 0
+	for _, r := range s {
+		if unicode.IsSpace(r) || string(r) == emptyMarker || slices.Contains(stones[:i], string(r)) {
+			return stones, fmt.Errorf("symbols %q: want 3 different characters other than spaces and %q", s, emptyMarker)
+		}
+		stones[i] = string(r)
+		i++
+	}
+	return stones, nil
+}
+
+// Save writes the preferences to the profile's file, creating its
+// directory.
+func (p *UserProfile) Save() error {
+	path, err := profileConfigPath(p.name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ApplyStyle sets the stones and colors of style to the preferred ones.
+func (p *UserProfile) ApplyStyle(style *BoardStyle) {
+	if p.Symbols != "" {
+		style.Stones, _ = parseSymbols(p.Symbols)
+	}
+	switch p.Colors {
+	case "":
+	case "none":
+		style.Color = false
+	default:
+		style.StoneColors = colorSchemes[p.Colors]
+	}
+}
+
+// RatingEntry is a game of the rating history: one person against two
+// engines.
+type RatingEntry struct {
+	Date      string  `json:"date"`      // When the game ended, in RFC 3339
+	Opponents string  `json:"opponents"` // The engines' player types, e.g. "mcts@1000 + mcts@1000"
+	Seat      int     `json:"seat"`      // The person's seat, from 1
+	Score     float64 `json:"score"`     // 1 for a win, 1/3 for a draw and 0 for a loss
+	Moves     int     `json:"moves"`
+	Rating    float64 `json:"rating"`          // The rating against the opponents after the game
+	Level     float64 `json:"level,omitempty"` // For adaptive games, the engines' level for the next game
+}
+
+// ratingK is the most a game moves a rating, in Elo.
+const ratingK = 32
+
+// UpdateRating returns the rating against two equal opponents after a game
+// that scored score. A rating is in Elo relative to the opponents, so 0
+// means an even match: three players the opponents rate r below each have
+// an expected score of 1/(1+2·10^(-r/400)), 1/3 at 0.
+func UpdateRating(r, score float64) float64 {
+	expected := 1 / (1 + 2*math.Pow(10, -r/400))
+	return r + ratingK*(score-expected)
+}
+
+// ReadRatingHistory reads the rating history of profile name, oldest game
+// first.
+func ReadRatingHistory(name string) ([]RatingEntry, error) {
+	path, err := profileHistoryPath(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var history []RatingEntry
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var e RatingEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		history = append(history, e)
+	}
+	return history, sc.Err()
+}
+
+// latestRating returns the rating against opponents after the last game of
+// history against them, and 0 if there was none.
+func latestRating(history []RatingEntry, opponents string) float64 {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Opponents == opponents {
+			return history[i].Rating
+		}
+	}
+	return 0
+}
+
+// RecordRating adds game e to the rating history of profile name, setting
+// its date and its rating after the game, and returns it.
+func RecordRating(name string, e RatingEntry) (RatingEntry, error) {
+	history, err := ReadRatingHistory(name)
+	if err != nil {
+		return e, err
+	}
+	e.Date = time.Now().Format(time.RFC3339)
+	e.Rating = UpdateRating(latestRating(history, e.Opponents), e.Score)
+	path, err := profileHistoryPath(name)
+	if err != nil {
+		return e, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return e, err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return e, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return e, err
+	}
+	return e, f.Close()
+}
+
+// ratingOpponents names the engines of a game that one person played
+// against two engines, and returns the person's seat; ok is false for any
+// other game. Engines without iterations of their own get defaultIterations,
+// so that a rating is against one strength.
+func ratingOpponents(seats [3]SeatSpec, defaultIterations int) (string, int, bool) {
+	human := -1
+	var engines []string
+	for i, s := range seats {
+		switch {
+		case s.Kind == "human" && human < 0:
+			human = i
+		case s.Kind == "mcts":
+			if s.Iterations == 0 {
+				s.Iterations = defaultIterations
+			}
+			engines = append(engines, s.PlayerType(0))
+		case s.Kind == "cmd":
+			engines = append(engines, s.PlayerType(0))
+		default:
+			return "", 0, false
+		}
+	}
+	if human < 0 || len(engines) != 2 {
+		return "", 0, false
+	}
+	sort.Strings(engines)
+	return strings.Join(engines, " + "), human, true
+}
+
+// runProfile implements `squava profile`, which shows a profile and sets its
+// preferences.
+func runProfile(args []string) int {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: squava profile [-profile name] [-colors scheme] [-symbols XOZ] [-iterations n] [-target rate] [-reset]")
+		fs.PrintDefaults()
+	}
+	nameFlag := fs.String("profile", "", "The profile (default: $SQUAVA_PROFILE or \"default\")")
+	colors := fs.String("colors", "", "Set the color scheme of the board: "+strings.Join(colorSchemeNames(), ", "))
+	symbols := fs.String("symbols", "", "Set the stones of players 1 to 3, e.g. \"●○▲\" or \"XOZ\"")
+	iterations := fs.Int("iterations", 0, "Set the engines' iterations when a game does not give -iterations (0 for squava's default)")
+	target := fs.Float64("target", 0, "Set the win rate -adaptive engines aim to give, e.g. 0.4 (0 for the default of 0.5)")
+	reset := fs.Bool("reset", false, "Clear the preferences before setting any")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	name, err := profileName(*nameFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	p, err := LoadUserProfile(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	changed := *reset
+	if *reset {
+		p = &UserProfile{Version: ProfileVersion, name: name}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "colors":
+			p.Colors, changed = *colors, true
+		case "symbols":
+			p.Symbols, changed = *symbols, true
+		case "iterations":
+			p.Iterations, changed = *iterations, true
+		case "target":
+			p.Target, changed = *target, true
+		}
+	})
+	if err := p.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if changed {
+		if err := p.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not save profile: %v\n", err)
+			return exitError
+		}
+	}
+
+	history, err := ReadRatingHistory(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	configPath, _ := profileConfigPath(name)
+	historyPath, _ := profileHistoryPath(name)
+	orDefault := func(s string) string {
+		if s == "" {
+			return "(default)"
+		}
+		return s
+	}
+	fmt.Printf("Profile:    %s\n", name)
+	fmt.Printf("Settings:   %s\n", configPath)
+	fmt.Printf("History:    %s\n", historyPath)
+	fmt.Printf("Colors:     %s\n", orDefault(p.Colors))
+	fmt.Printf("Symbols:    %s\n", orDefault(p.Symbols))
+	if p.Iterations > 0 {
+		fmt.Printf("Iterations: %d\n", p.Iterations)
+	} else {
+		fmt.Printf("Iterations: (default)\n")
+	}
+	fmt.Printf("Target:     %.0f%% wins against adaptive engines\n", 100*p.target())
+	level := AdaptiveLevel(history)
+	fmt.Printf("Adaptive:   level %.1f of %d (%s)\n", level, len(adaptivePresets), AdaptivePreset(level))
+	if len(history) == 0 {
+		return 0
+	}
+
+	// Ratings by opponents, most played first.
+	type tally struct {
+		opponents string
+		games     int
+		score     float64
+	}
+	index := map[string]int{}
+	var tallies []tally
+	for _, e := range history {
+		i, ok := index[e.Opponents]
+		if !ok {
+			i = len(tallies)
+			index[e.Opponents] = i
+			tallies = append(tallies, tally{opponents: e.Opponents})
+		}
+		tallies[i].games++
+		tallies[i].score += e.Score
+	}
+	sort.SliceStable(tallies, func(i, j int) bool { return tallies[i].games > tallies[j].games })
+	fmt.Printf("\n%-30s %6s %7s %7s\n", "Opponents", "Games", "Score", "Rating")
+	for _, t := range tallies {
+		fmt.Printf("%-30s %6d %6.1f%% %+7.0f\n", t.opponents, t.games, 100*t.score/float64(t.games), latestRating(history, t.opponents))
+	}
+	return 0
+}
+
+// recordProfileGame adds a finished game to the rating history of profile
+// p if one person played it against two engines, and tells the new rating.
+// An adaptive game is rated against the adaptive engines and moves their
+// level. Scripted games do not count.
+func recordProfileGame(g *SquavaGame, p *UserProfile, seats [3]SeatSpec, defaultIterations int, scripted, adaptive bool) {
+	winnerID, terminal := g.terminal()
+	opponents, seat, ok := ratingOpponents(seats, defaultIterations)
+	if scripted || !terminal || !ok {
+		return
+	}
+	e := RatingEntry{Opponents: opponents, Seat: seat + 1, Moves: len(g.moves)}
+	switch winnerID {
+	case seat:
+		e.Score = 1
+	case -1:
+		e.Score = 1.0 / 3
+	}
+	if adaptive {
+		history, err := ReadRatingHistory(p.name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not record the game in profile %s: %v\n", p.name, err)
+			return
+		}
+		e.Opponents = adaptiveOpponents
+		e.Level = NextAdaptiveLevel(AdaptiveLevel(history), e.Score, p.target())
+	}
+	e, err := RecordRating(p.name, e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not record the game in profile %s: %v\n", p.name, err)
+		return
+	}
+	fmt.Printf("Rating of %s against %s: %+.0f\n", p.name, e.Opponents, e.Rating)
+	if adaptive {
+		fmt.Printf("Adaptive engines: level %.1f next game (%s)\n", e.Level, AdaptivePreset(e.Level))
+	}
+}
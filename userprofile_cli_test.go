@@ -0,0 +1,78 @@
+//go:build !wasm
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUserProfile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("SQUAVA_PROFILE", "")
+	if name, err := profileName(""); err != nil || name != "default" {
+		t.Errorf("Expected the default profile, got %q, %v", name, err)
+	}
+	if _, err := profileName("../etc"); err == nil {
+		t.Error("Expected a profile name with a path to be rejected")
+	}
+
+	p, err := LoadUserProfile("alice")
+	if err != nil || p.Colors != "" || p.Symbols != "" || p.Iterations != 0 {
+		t.Fatalf("Expected an empty profile, got %+v, %v", p, err)
+	}
+	p.Colors, p.Symbols, p.Iterations = "colorblind", "●○▲", 5000
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+	p, err = LoadUserProfile("alice")
+	if err != nil || p.Colors != "colorblind" || p.Symbols != "●○▲" || p.Iterations != 5000 {
+		t.Fatalf("Expected the saved preferences back, got %+v, %v", p, err)
+	}
+	style := BoardStyle{Unicode: true, Color: true}
+	p.ApplyStyle(&style)
+	if style.Stones != [3]string{"●", "○", "▲"} || style.StoneColors != colorSchemes["colorblind"] {
+		t.Errorf("Unexpected style %+v", style)
+	}
+	for _, bad := range []UserProfile{{Colors: "neon"}, {Symbols: "XX"}, {Symbols: "XOX"}, {Symbols: "X.Z"}, {Iterations: -1}} {
+		if bad.check() == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+
+	var seats [3]SeatSpec
+	for i, typ := range []string{"mcts", "human", "mcts@200"} {
+		seats[i], _ = ParsePlayerType(typ)
+	}
+	opponents, seat, ok := ratingOpponents(seats, 1000)
+	if !ok || opponents != "mcts@1000 + mcts@200" || seat != 1 {
+		t.Errorf("Unexpected opponents %q, seat %d, %v", opponents, seat, ok)
+	}
+	seats[0].Kind = "human"
+	if _, _, ok := ratingOpponents(seats, 1000); ok {
+		t.Error("Expected a game of two people not to be rated")
+	}
+
+	if r := UpdateRating(0, 1.0/3); math.Abs(r) > 1e-9 {
+		t.Errorf("Expected an expected draw to keep the rating, got %v", r)
+	}
+	win, err := RecordRating("alice", RatingEntry{Opponents: opponents, Seat: 2, Score: 1, Moves: 20})
+	if err != nil || win.Rating <= 0 || win.Date == "" {
+		t.Fatalf("Expected a win to raise the rating, got %+v, %v", win, err)
+	}
+	loss, err := RecordRating("alice", RatingEntry{Opponents: opponents, Seat: 2, Moves: 12})
+	if err != nil || loss.Rating >= win.Rating {
+		t.Fatalf("Expected a loss to lower the rating, got %+v, %v", loss, err)
+	}
+	if _, err := RecordRating("alice", RatingEntry{Opponents: "mcts@50 + mcts@50", Seat: 1, Moves: 9}); err != nil {
+		t.Fatal(err)
+	}
+	history, err := ReadRatingHistory("alice")
+	if err != nil || len(history) != 3 || history[1] != loss || latestRating(history, opponents) != loss.Rating {
+		t.Errorf("Unexpected history %+v, %v", history, err)
+	}
+	if other, _ := ReadRatingHistory("bob"); other != nil {
+		t.Errorf("Expected no history for another profile, got %+v", other)
+	}
+}
@@ -0,0 +1,138 @@
+//go:build !wasm
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"squava/game"
+)
+
+// --- Engine comparison viewer ---
+
+// viewerColumn is one engine configuration in a game. Its players share the
+// column, since they would search a position alike.
+type viewerColumn struct {
+	label       string
+	iterations  int
+	personality *Personality
+	ids         []int
+	table       *TranspositionTable // For searches of positions it is not to move in
+}
+
+// EngineViewer shows, after every engine move, the top candidate moves and
+// winrates of each engine configuration in the game side by side. The engine
+// to move contributes the search it played from; the others search the same
+// position as spectators, on tables of their own and preserving the game's
+// random number stream, so play is unaffected.
+type EngineViewer struct {
+	columns []*viewerColumn
+	top     int
+}
+
+// viewerColumnWidth is the width of a column, including the gap after it.
+const viewerColumnWidth = 28
+
+// NewEngineViewer groups the MCTS players of g by configuration. It returns
+// nil if the game has fewer than two configurations to compare.
+func NewEngineViewer(g *SquavaGame, top int) *EngineViewer {
+	v := &EngineViewer{top: top}
+	for _, p := range g.players {
+		m, ok := p.(*MCTSPlayer)
+		if !ok {
+			continue
+		}
+		var col *viewerColumn
+		for _, c := range v.columns {
+			if c.iterations == m.iterations && c.personality == m.personality {
+				col = c
+			}
+		}
+		if col == nil {
+			col = &viewerColumn{iterations: m.iterations, personality: m.personality}
+			v.columns = append(v.columns, col)
+		}
+		col.ids = append(col.ids, m.ID())
+	}
+	if len(v.columns) < 2 {
+		return nil
+	}
+	for _, c := range v.columns {
+		var names []string
+		for _, id := range c.ids {
+			names = append(names, g.GetPlayer(id).Symbol())
+		}
+		config := fmt.Sprintf("%d", c.iterations)
+		if c.personality != nil {
+			config = c.personality.Name + "@" + config
+		}
+		c.label = strings.Join(names, "/") + " " + config
+	}
+	return v
+}
+
+// analyze returns the column's view of gs: mover's own search if it belongs
+// to the column, otherwise a fresh spectating search.
+func (c *viewerColumn) analyze(gs game.GameState, mover *MCTSPlayer) Analysis {
+	for _, id := range c.ids {
+		if id == mover.ID() && mover.root != nil {
+			return mover.analysis(gs, mover.root.N)
+		}
+	}
+	if c.table == nil {
+		c.table = NewTranspositionTable(personalityTTSize)
+	}
+	c.table.Clear()
+	saved := mainRand
+	m := NewMCTSPlayer("Viewer", "?", gs.PlayerID, c.iterations)
+	m.SetPersonality(c.personality)
+	m.table = c.table
+	_, rollouts := m.Search(gs)
+	mainRand = saved
+	return m.analysis(gs, rollouts)
+}
+
+// Lines renders the columns' views of gs, where mover chose played. The
+// played move is marked with a * in every column.
+func (v *EngineViewer) Lines(gs game.GameState, mover *MCTSPlayer, played game.Move) []string {
+	rows := make([][]string, len(v.columns))
+	for i, c := range v.columns {
+		a := c.analyze(gs, mover)
+		eval := fmt.Sprintf("%5.1f%%", a.Winrate*100)
+		if a.Outcome != Unproven {
+			eval = strings.ToUpper(a.Outcome.String())
+		}
+		col := []string{c.label, fmt.Sprintf("eval %s  %d visits", eval, a.Rollouts)}
+		for j := 0; j < v.top && j < len(a.Moves); j++ {
+			m := a.Moves[j]
+			mark := " "
+			if m.Move == played {
+				mark = "*"
+			}
+			col = append(col, fmt.Sprintf("%s%-4s %7d %7s", mark, m.Move, m.Visits, m.Eval(1)))
+		}
+		rows[i] = col
+	}
+	height := 0
+	for _, col := range rows {
+		height = max(height, len(col))
+	}
+	lines := make([]string, height)
+	for r := range lines {
+		var sb strings.Builder
+		for i, col := range rows {
+			cell := ""
+			if r < len(col) {
+				cell = col[r]
+			}
+			if i < len(rows)-1 {
+				fmt.Fprintf(&sb, "%-*s", viewerColumnWidth, cell)
+			} else {
+				sb.WriteString(cell)
+			}
+		}
+		lines[r] = sb.String()
+	}
+	return lines
+}
@@ -0,0 +1,48 @@
+//go:build !wasm
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"squava/game"
+)
+
+func TestEngineViewer(t *testing.T) {
+	g := NewSquavaGame()
+	g.AddPlayer(NewMCTSPlayer("Fast", "X", 0, 200))
+	g.AddPlayer(NewMCTSPlayer("Fast", "O", 1, 200))
+	g.AddPlayer(NewHumanPlayer("Human", "Z", 2))
+	if NewEngineViewer(g, 3) != nil {
+		t.Fatal("viewer with a single engine configuration")
+	}
+
+	g = NewSquavaGame()
+	fast := NewMCTSPlayer("Fast", "X", 0, 200)
+	g.AddPlayer(fast)
+	g.AddPlayer(NewMCTSPlayer("Slow", "O", 1, 800))
+	g.AddPlayer(NewMCTSPlayer("Fast", "Z", 2, 200))
+	v := NewEngineViewer(g, 3)
+	if v == nil || len(v.columns) != 2 {
+		t.Fatalf("viewer = %+v, want two columns", v)
+	}
+	gs := game.NewGameState(game.Board{}, 0, 0b111)
+	tt.Clear()
+	fast.Search(gs)
+	move := fast.analysis(gs, 0).Best
+	saved := mainRand
+	lines := v.Lines(gs, fast, move)
+	if mainRand != saved {
+		t.Error("the viewer changed the game's random numbers")
+	}
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines, want a header, an evaluation and 3 moves:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	if !strings.HasPrefix(lines[0], "X/Z 200") || !strings.Contains(lines[0], "O 800") {
+		t.Errorf("header = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[2], "*"+move.String()) {
+		t.Errorf("the played move %s is not the first marked: %q", move, lines[2])
+	}
+}
@@ -23,6 +23,16 @@ onmessage = (e) => {
     } else if (type === 'GET_AI_MOVE') {
         const move = squavaGetBestMove(payload.iterations || 10000);
         postMessage({ type: 'AI_MOVE_RESULT', payload: { move } });
+    } else if (type === 'CALIBRATE') {
+        const result = squavaCalibrate(payload.ms || 500);
+        postMessage({ type: 'CALIBRATE_RESULT', payload: result });
+    } else if (type === 'LOAD_PUZZLE') {
+        const puzzle = squavaLoadPuzzle(payload.line);
+        const board = puzzle ? squavaGetBoard() : null;
+        postMessage({ type: 'PUZZLE_LOADED', payload: { puzzle, board } });
+    } else if (type === 'ANALYZE') {
+        const analysis = squavaAnalyze(payload.iterations || 10000);
+        postMessage({ type: 'ANALYSIS_RESULT', payload: analysis });
     } else if (type === 'GET_BOARD') {
         const board = squavaGetBoard();
         postMessage({ type: 'BOARD_RESULT', payload: board });
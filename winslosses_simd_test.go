@@ -0,0 +1,76 @@
+//go:build amd64 && !js
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"squava/game"
+	"squava/internal/kernels"
+)
+
+// withSIMD runs f with each kernel set the CPU supports.
+func withSIMD(f func(name string)) {
+	defer func(level int) { kernels.Level = level }(kernels.Level)
+	for level := 0; level <= kernels.MaxLevel; level++ {
+		kernels.Level = level
+		f(kernels.Name())
+	}
+}
+
+func TestKernelsMatchGoAllPaths(t *testing.T) {
+	withSIMD(func(name string) {
+		t.Run(name, checkKernels)
+	})
+}
+
+// BenchmarkKernels compares the scalar and SIMD paths of the threat
+// kernel, of edge selection over 16 and 32 edges, and of symmetric hashing.
+func BenchmarkKernels(b *testing.B) {
+	mainRand.Seed(5)
+	qs, us := make([]float32, 32), make([]float32, 32)
+	for i := range qs {
+		qs[i] = float32(xrand()>>40) / (1 << 24)
+		us[i] = float32(xrand()>>40) / (1 << 24)
+	}
+	withSIMD(func(name string) {
+		b.Run("WinsLosses/"+name, func(b *testing.B) {
+			var sum uint64
+			for i := 0; i < b.N; i++ {
+				w, l := kernels.WinsAndLosses(uint64(i)&0x0F0F, ^uint64(0))
+				sum += w ^ l
+			}
+			benchSink = game.Bitboard(sum)
+		})
+		for _, n := range []int{16, 32} {
+			b.Run(fmt.Sprintf("SelectBestEdge%d/%s", n, name), func(b *testing.B) {
+				sum := 0
+				for i := 0; i < b.N; i++ {
+					sum += kernels.SelectBestEdge(qs[:n], us[:n], 1.3)
+				}
+				benchSink = game.Bitboard(sum)
+			})
+		}
+		b.Run("SymXor/"+name, func(b *testing.B) {
+			var h [game.NumSymmetries]uint64
+			var keys [64][game.NumSymmetries]uint64
+			for sq := range keys {
+				for s := range keys[sq] {
+					keys[sq][s] = xrand()
+				}
+			}
+			stones := xrand() & xrand() // About 16 stones
+			for i := 0; i < b.N; i++ {
+				kernels.SymXor(&h, &keys, stones)
+			}
+			benchSink = game.Bitboard(h[7])
+		})
+	})
+}
+
+func TestGoldenGamesAllPaths(t *testing.T) {
+	withSIMD(func(name string) {
+		t.Run(name, checkGoldenGames)
+	})
+}